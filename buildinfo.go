@@ -0,0 +1,35 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// version is set at build time through -ldflags "-X main.version=x.y.z"
+var version = "dev"
+
+// kafkaModule is the Go module that implements the Kafka protocol.
+const kafkaModule = "github.com/Shopify/sarama"
+
+// printBuildInfo prints the details about how the binary was built, including the Kafka client implementation in use.
+func printBuildInfo() {
+	fmt.Printf("version:      %s\n", version)
+	fmt.Printf("go:           %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	kafkaVersion := "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == kafkaModule {
+				kafkaVersion = dep.Version
+			}
+		}
+	}
+	fmt.Printf("kafka client: %s %s (pure Go, no librdkafka)\n", kafkaModule, kafkaVersion)
+	if cgoEnabled {
+		fmt.Println("cgo:          enabled (the binary might be dynamically linked against libc)")
+	} else {
+		fmt.Println("cgo:          disabled (fully static binary)")
+	}
+}
@@ -0,0 +1,8 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+//go:build !cgo
+// +build !cgo
+
+package main
+
+const cgoEnabled = false
@@ -0,0 +1,188 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// AdminAPI returns an HTTP handler for the REST API to inspect and control the pipelines at runtime, to be served under /api/v1/.
+//
+//	GET  /api/v1/status   the state, consumption, circuit breaker, assigned and paused partitions, lag and buffered bytes of each pipeline.
+//	GET  /api/v1/buffers  the partial messages of each pipeline (DELETE with id evicts one, like BuffersHandler).
+//	POST /api/v1/pause    pauses the consumption, or a single partition with partition (and topic, defaults to the main topic).
+//	POST /api/v1/resume   resumes the consumption, or a single partition, the same way.
+//	POST /api/v1/seek     resets the offsets of the group to a position (beginning, end or an offset) or an RFC3339 timestamp.
+//
+// The control endpoints apply to all the pipelines, or only to the one passed with the pipeline parameter.
+// The parameters can be passed on the query string or as a form.
+func AdminAPI(pipelines []*Pipeline) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/status", runtimeStatusHandler(pipelines))
+	mux.Handle("/api/v1/buffers", BuffersHandler(pipelines))
+	mux.Handle("/api/v1/pause", pauseHandler(pipelines, true))
+	mux.Handle("/api/v1/resume", pauseHandler(pipelines, false))
+	mux.Handle("/api/v1/seek", seekHandler(pipelines))
+	return mux
+}
+
+// runtimeStatusHandler returns an HTTP handler that reports the runtime state of each pipeline.
+func runtimeStatusHandler(pipelines []*Pipeline) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		type pipelineInfo struct {
+			PipelineStatus
+			Paused             bool             `json:"paused"`
+			CircuitBreaker     string           `json:"circuitBreaker,omitempty"` // Empty when the breaker is disabled.
+			AssignedPartitions []TopicPartition `json:"assignedPartitions"`
+			PausedPartitions   []TopicPartition `json:"pausedPartitions"`
+			PartialMessages    int              `json:"partialMessages"`
+			PendingBytes       int64            `json:"pendingBytes"`
+			Lag                map[string]int64 `json:"lag"` // By topic/partition, empty until measured.
+		}
+		infos := make([]pipelineInfo, len(pipelines))
+		for i, p := range pipelines {
+			cli := p.Client
+			info := pipelineInfo{
+				PipelineStatus:     p.Status(),
+				Paused:             cli.Paused(),
+				CircuitBreaker:     cli.BreakerState(),
+				AssignedPartitions: cli.AssignedPartitions(),
+				PausedPartitions:   cli.PausedPartitions(),
+				PartialMessages:    len(cli.PartialMessages()),
+				Lag:                make(map[string]int64),
+			}
+			if cli.budget != nil {
+				info.PendingBytes = cli.budget.Pending()
+			}
+			for tp, lag := range cli.ConsumerLag() {
+				info.Lag[tp.String()] = lag
+			}
+			infos[i] = info
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"pipelines": infos,
+		})
+	})
+}
+
+// pauseHandler returns an HTTP handler that pauses or resumes the consumption of the selected pipelines, or one of their partitions.
+func pauseHandler(pipelines []*Pipeline, pause bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		selected, ok := selectPipelines(w, r, pipelines)
+		if !ok {
+			return
+		}
+		partition := int32(-1)
+		if value := r.FormValue("partition"); value != "" {
+			p, err := strconv.ParseInt(value, 10, 32)
+			if err != nil || p < 0 {
+				http.Error(w, "invalid partition "+value, http.StatusBadRequest)
+				return
+			}
+			partition = int32(p)
+			for _, p := range selected {
+				if p.Client.partitions == nil {
+					http.Error(w, "pipeline "+p.Name+" is not running", http.StatusConflict)
+					return
+				}
+			}
+		}
+		names := make([]string, len(selected))
+		for i, p := range selected {
+			names[i] = p.Name
+			cli := p.Client
+			switch {
+			case partition < 0 && pause:
+				cli.Pause()
+			case partition < 0:
+				cli.Resume()
+			default:
+				topic := r.FormValue("topic")
+				if topic == "" {
+					topic = cli.Topic
+				}
+				if pause {
+					cli.PausePartition(topic, partition)
+				} else {
+					cli.ResumePartition(topic, partition)
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"paused":    pause,
+			"pipelines": names,
+		})
+	})
+}
+
+// seekHandler returns an HTTP handler that resets the offsets of the consumer group of the selected pipelines.
+func seekHandler(pipelines []*Pipeline) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		selected, ok := selectPipelines(w, r, pipelines)
+		if !ok {
+			return
+		}
+		position := r.FormValue("position")
+		var timestamp time.Time
+		if value := r.FormValue("timestamp"); value != "" {
+			var err error
+			if timestamp, err = time.Parse(time.RFC3339, value); err != nil {
+				http.Error(w, "invalid timestamp "+value+"; expecting RFC3339", http.StatusBadRequest)
+				return
+			}
+		}
+		if position == "" && timestamp.IsZero() {
+			http.Error(w, "either the position or the timestamp parameter is required", http.StatusBadRequest)
+			return
+		}
+		if err := validateSeekPosition(position, timestamp); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		names := make([]string, len(selected))
+		for i, p := range selected {
+			if err := p.Client.SeekTo(position, timestamp); err != nil {
+				http.Error(w, "cannot seek pipeline "+p.Name+": "+err.Error(), http.StatusConflict)
+				return
+			}
+			names[i] = p.Name
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"pipelines": names,
+		})
+	})
+}
+
+// selectPipelines Returns all the pipelines, or the one passed through the pipeline parameter.
+// It responds with 404 and returns false when the pipeline doesn't exist.
+func selectPipelines(w http.ResponseWriter, r *http.Request, pipelines []*Pipeline) ([]*Pipeline, bool) {
+	name := r.FormValue("pipeline")
+	if name == "" {
+		return pipelines, true
+	}
+	for _, p := range pipelines {
+		if p.Name == name {
+			return []*Pipeline{p}, true
+		}
+	}
+	http.Error(w, "pipeline "+name+" not found", http.StatusNotFound)
+	return nil, false
+}
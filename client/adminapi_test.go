@@ -0,0 +1,78 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestAdminAPI(t *testing.T) {
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	assert.Assert(t, cli.processMessage(buildMessage("0001", 0, 3, []byte("ABC"))) == nil)
+	handler := AdminAPI([]*Pipeline{
+		NewPipeline("traps", cli, nil),
+		NewPipeline("idle", &KafkaClient{}, nil), // Not initialized
+	})
+	call := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, call(http.MethodPost, "/api/v1/pause?pipeline=traps").Code)
+	assert.Assert(t, cli.Paused())
+	assert.Equal(t, http.StatusOK, call(http.MethodPost, "/api/v1/pause?pipeline=traps&partition=2").Code)
+	assert.Equal(t, http.StatusConflict, call(http.MethodPost, "/api/v1/pause?partition=2").Code)
+	assert.Equal(t, http.StatusNotFound, call(http.MethodPost, "/api/v1/pause?pipeline=flows").Code)
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodPost, "/api/v1/pause?partition=x").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, call(http.MethodGet, "/api/v1/pause").Code)
+
+	rec := call(http.MethodGet, "/api/v1/status")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var status struct {
+		Pipelines []struct {
+			Name             string           `json:"name"`
+			Paused           bool             `json:"paused"`
+			PausedPartitions []TopicPartition `json:"pausedPartitions"`
+			PartialMessages  int              `json:"partialMessages"`
+			PendingBytes     int64            `json:"pendingBytes"`
+		} `json:"pipelines"`
+	}
+	assert.NilError(t, json.NewDecoder(rec.Body).Decode(&status))
+	assert.Equal(t, 2, len(status.Pipelines))
+	traps := status.Pipelines[0]
+	assert.Assert(t, traps.Paused)
+	assert.DeepEqual(t, []TopicPartition{{"Test", 2}}, traps.PausedPartitions)
+	assert.Equal(t, 1, traps.PartialMessages)
+	assert.Equal(t, int64(3), traps.PendingBytes)
+	assert.Assert(t, !status.Pipelines[1].Paused)
+
+	assert.Equal(t, http.StatusOK, call(http.MethodPost, "/api/v1/resume").Code)
+	assert.Assert(t, !cli.Paused())
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/api/v1/buffers").Code)
+
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodPost, "/api/v1/seek").Code)
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodPost, "/api/v1/seek?position=middle").Code)
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodPost, "/api/v1/seek?timestamp=yesterday").Code)
+	assert.Equal(t, http.StatusConflict, call(http.MethodPost, "/api/v1/seek?pipeline=idle&position=end").Code)
+}
+
+func TestConsumptionGate(t *testing.T) {
+	gate := &consumptionGate{}
+	assert.Assert(t, gate.wait(nil))
+	assert.Assert(t, gate.setPaused(true))
+	assert.Assert(t, !gate.setPaused(true))
+	done := make(chan struct{})
+	close(done)
+	assert.Assert(t, !gate.wait(done))
+	resumed := make(chan bool)
+	go func() { resumed <- gate.wait(nil) }()
+	assert.Assert(t, gate.setPaused(false))
+	assert.Assert(t, <-resumed)
+}
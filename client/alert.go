@@ -0,0 +1,264 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Alert providers
+const (
+	PagerDuty = "pagerduty"
+	Opsgenie  = "opsgenie"
+)
+
+// defaultAlertURLs contains the default endpoints for each provider.
+var defaultAlertURLs = map[string]string{
+	PagerDuty: "https://events.pagerduty.com/v2/enqueue",
+	Opsgenie:  "https://api.opsgenie.com/v2/alerts",
+}
+
+// Alert represents an alert derived from a Syslog message or an SNMP trap.
+type Alert struct {
+	DedupKey string            // Identifies the problem, so repeated messages update the same alert.
+	Summary  string            // A short description of the problem.
+	Source   string            // The IP address of the device that sent the message.
+	Severity int               // The Syslog severity, from 0 (emergency) to 7 (debug).
+	Details  map[string]string // Additional information about the message.
+}
+
+// AlertOutput converts Syslog messages and SNMP traps into PagerDuty (Events API v2) or Opsgenie alerts,
+// so critical problems can page directly from the receiver.
+type AlertOutput struct {
+	Provider    string         // The alert provider: pagerduty or opsgenie.
+	URL         string         // The API endpoint (optional; defaults to the public endpoint of the provider).
+	Key         string         `json:"-"` // The routing key for PagerDuty, or the API key for Opsgenie; accepts secret references (see ResolveSecret).
+	MaxSeverity int            // Only Syslog messages with this severity or a more critical one trigger alerts (0=emergency, 7=debug).
+	Traps       []string       // Only traps whose enterprise OID starts with any of these prefixes trigger alerts (all traps when empty).
+	TrapLevel   int            // The severity assigned to alerts from traps (0=emergency, 7=debug).
+	Match       *regexp.Regexp `json:"-"` // Only messages that match this expression trigger alerts (optional).
+	Client      *http.Client   `json:"-"` // The HTTP client (optional).
+}
+
+// Validate Verifies the alert settings.
+func (out *AlertOutput) Validate() error {
+	if _, ok := defaultAlertURLs[out.Provider]; !ok {
+		return fmt.Errorf("invalid alert provider %q; expecting %s or %s", out.Provider, PagerDuty, Opsgenie)
+	}
+	if out.Key == "" {
+		return fmt.Errorf("the %s key is required", out.Provider)
+	}
+	if _, err := ResolveSecret(out.Key); err != nil {
+		return fmt.Errorf("cannot resolve the %s key: %v", out.Provider, err)
+	}
+	if out.MaxSeverity < 0 || out.MaxSeverity > 7 || out.TrapLevel < 0 || out.TrapLevel > 7 {
+		return fmt.Errorf("invalid severity; expecting a value between 0 and 7")
+	}
+	return nil
+}
+
+// Name Returns the name of the output.
+func (out *AlertOutput) Name() string {
+	return out.Provider
+}
+
+// Send Triggers an alert for each Syslog message or SNMP trap that satisfies the filters.
+func (out *AlertOutput) Send(ctx context.Context, msg DecodedMessage) error {
+	alerts, err := out.alerts(msg)
+	if err != nil {
+		return err
+	}
+	for _, alert := range alerts {
+		if err := out.trigger(ctx, alert); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// alerts Returns the alerts derived from a decoded message that satisfy the filters.
+func (out *AlertOutput) alerts(msg DecodedMessage) ([]Alert, error) {
+	if out.Match != nil && !out.Match.Match(msg.Payload) {
+		return nil, nil
+	}
+	switch msg.Parser {
+	case "syslog":
+		return out.syslogAlerts(msg)
+	case "snmp":
+		return out.trapAlerts(msg)
+	}
+	return nil, nil
+}
+
+// syslogAlerts Returns an alert for each Syslog message with the expected severity.
+func (out *AlertOutput) syslogAlerts(msg DecodedMessage) ([]Alert, error) {
+	var syslog struct {
+		SourceAddress string `json:"sourceAddress"`
+		Messages      []struct {
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(msg.Payload, &syslog); err != nil {
+		return nil, fmt.Errorf("invalid syslog message: %v", err)
+	}
+	var alerts []Alert
+	for _, m := range syslog.Messages {
+		fields, ok := ParseSyslog(m.Content)
+		if !ok || fields.Severity > out.MaxSeverity {
+			continue
+		}
+		alerts = append(alerts, Alert{
+			DedupKey: fmt.Sprintf("syslog:%s:%d:%x", syslog.SourceAddress, fields.Priority, fingerprint(fields.Hostname+" "+fields.AppName+" "+fields.Message)),
+			Summary:  fields.Message,
+			Source:   syslog.SourceAddress,
+			Severity: fields.Severity,
+			Details: map[string]string{
+				"location": msg.Metadata.Location,
+				"priority": strconv.Itoa(fields.Priority),
+				"hostname": fields.Hostname,
+				"appName":  fields.AppName,
+			},
+		})
+	}
+	return alerts, nil
+}
+
+// trapAlerts Returns an alert for each SNMP trap with the expected enterprise OID.
+func (out *AlertOutput) trapAlerts(msg DecodedMessage) ([]Alert, error) {
+	var trapLog struct {
+		TrapAddress string `json:"trapAddress"`
+		Messages    []struct {
+			AgentAddress string           `json:"agentAddress"`
+			Version      string           `json:"version"`
+			TrapIdentity *TrapIdentityDTO `json:"trapIdentity"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(msg.Payload, &trapLog); err != nil {
+		return nil, fmt.Errorf("invalid snmp trap message: %v", err)
+	}
+	var alerts []Alert
+	for _, trap := range trapLog.Messages {
+		if trap.TrapIdentity == nil || !out.matchesTrap(trap.TrapIdentity.EnterpriseID) {
+			continue
+		}
+		id := trap.TrapIdentity
+		source := trap.AgentAddress
+		if source == "" {
+			source = trapLog.TrapAddress
+		}
+		alerts = append(alerts, Alert{
+			DedupKey: fmt.Sprintf("trap:%s:%s:%d:%d", source, id.EnterpriseID, id.Generic, id.Specific),
+			Summary:  fmt.Sprintf("SNMP trap %s (generic %d, specific %d) from %s", id.EnterpriseID, id.Generic, id.Specific, source),
+			Source:   source,
+			Severity: out.TrapLevel,
+			Details: map[string]string{
+				"location": msg.Metadata.Location,
+				"version":  trap.Version,
+			},
+		})
+	}
+	return alerts, nil
+}
+
+// matchesTrap Returns true when the enterprise OID matches one of the configured prefixes.
+func (out *AlertOutput) matchesTrap(enterprise string) bool {
+	if len(out.Traps) == 0 {
+		return true
+	}
+	for _, prefix := range out.Traps {
+		if enterprise == prefix || strings.HasPrefix(enterprise, strings.TrimSuffix(prefix, ".")+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// trigger Sends an alert to the provider.
+func (out *AlertOutput) trigger(ctx context.Context, alert Alert) error {
+	url := out.URL
+	if url == "" {
+		url = defaultAlertURLs[out.Provider]
+	}
+	key, err := ResolveSecret(out.Key)
+	if err != nil {
+		return &OutputError{Err: fmt.Errorf("cannot resolve the %s key: %v", out.Provider, err), Retryable: true}
+	}
+	if out.Provider == Opsgenie {
+		return postJSON(ctx, out.Client, url, map[string]string{"Authorization": "GenieKey " + key}, out.opsgenieAlert(alert))
+	}
+	return postJSON(ctx, out.Client, url, nil, out.pagerDutyEvent(key, alert))
+}
+
+// pagerDutyEvent Builds the PagerDuty Events API v2 representation of an alert.
+func (out *AlertOutput) pagerDutyEvent(key string, alert Alert) map[string]interface{} {
+	severity := "info"
+	switch {
+	case alert.Severity <= 2:
+		severity = "critical"
+	case alert.Severity == 3:
+		severity = "error"
+	case alert.Severity == 4:
+		severity = "warning"
+	}
+	return map[string]interface{}{
+		"routing_key":  key,
+		"event_action": "trigger",
+		"dedup_key":    alert.DedupKey,
+		"payload": map[string]interface{}{
+			"summary":        truncate(alert.Summary, 1024),
+			"source":         alert.Source,
+			"severity":       severity,
+			"custom_details": alert.Details,
+		},
+	}
+}
+
+// opsgenieAlert Builds the Opsgenie representation of an alert.
+func (out *AlertOutput) opsgenieAlert(alert Alert) map[string]interface{} {
+	priority := "P5"
+	switch {
+	case alert.Severity <= 2:
+		priority = "P1"
+	case alert.Severity == 3:
+		priority = "P2"
+	case alert.Severity == 4:
+		priority = "P3"
+	case alert.Severity == 5:
+		priority = "P4"
+	}
+	return map[string]interface{}{
+		"message":  truncate(alert.Summary, 130),
+		"alias":    truncate(alert.DedupKey, 512),
+		"source":   alert.Source,
+		"priority": priority,
+		"details":  alert.Details,
+	}
+}
+
+// fingerprint Returns a hash of a message ignoring its digits, so timestamps and counters don't defeat the deduplication.
+func fingerprint(content string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return -1
+		}
+		return r
+	}, content)))
+	return h.Sum64()
+}
+
+// truncate Limits the length of a string.
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max]
+}
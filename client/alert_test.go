@@ -0,0 +1,64 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestAlertOutput(t *testing.T) {
+	var received []map[string]interface{}
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		received = append(received, body)
+		auth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	out := &AlertOutput{Provider: PagerDuty, URL: server.URL, Key: "secret", MaxSeverity: 2, Traps: []string{".1.3.6.1.4.1.9"}}
+	assert.NilError(t, out.Validate())
+
+	encode := func(s string) []byte { return []byte(base64.StdEncoding.EncodeToString([]byte(s))) }
+	syslog := SyslogMessageLogDTO{
+		SourceAddress: "10.0.0.1",
+		Messages: []SyslogMessageDTO{
+			{Content: encode(`<10>Oct 11 22:14:15 router01 "link" down on port 1`)}, // critical
+			{Content: encode(`<14>Oct 11 22:14:16 router01 config saved`)},          // info
+		},
+	}
+	assert.NilError(t, out.Send(context.Background(), DecodedMessage{Parser: "syslog", Payload: []byte(syslog.String())}))
+	assert.Equal(t, 1, len(received))
+	assert.Equal(t, "secret", received[0]["routing_key"])
+	assert.Equal(t, "critical", received[0]["payload"].(map[string]interface{})["severity"])
+
+	// The dedup key ignores the digits, so repeated messages update the same alert
+	syslog.Messages = syslog.Messages[:1]
+	syslog.Messages[0].Content = encode(`<10>Oct 11 22:20:00 router01 "link" down on port 1`)
+	assert.NilError(t, out.Send(context.Background(), DecodedMessage{Parser: "syslog", Payload: []byte(syslog.String())}))
+	assert.Equal(t, 2, len(received))
+	assert.Equal(t, received[0]["dedup_key"], received[1]["dedup_key"])
+
+	traps := TrapLogDTO{
+		TrapAddress: "10.0.0.2",
+		Messages: []TrapDTO{
+			{TrapIdentity: &TrapIdentityDTO{EnterpriseID: ".1.3.6.1.4.1.9.9.41", Generic: 6, Specific: 1}},
+			{TrapIdentity: &TrapIdentityDTO{EnterpriseID: ".1.3.6.1.4.1.99", Generic: 6, Specific: 1}},
+		},
+	}
+	out.Provider = Opsgenie
+	assert.NilError(t, out.Send(context.Background(), DecodedMessage{Parser: "snmp", Payload: []byte(traps.String())}))
+	assert.Equal(t, 3, len(received))
+	assert.Equal(t, "GenieKey secret", auth)
+	assert.Equal(t, "trap:10.0.0.2:.1.3.6.1.4.1.9.9.41:6:1", received[2]["alias"])
+	assert.Equal(t, "P1", received[2]["priority"])
+}
@@ -0,0 +1,324 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/netflow"
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/telemetry"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// maxAnonymizerCache is the maximum number of pseudonyms kept in memory; the cache is reset when it is full.
+const maxAnonymizerCache = 100000
+
+// Character sets of the pseudonyms
+const (
+	hostnameChars  = "abcdefghijklmnopqrstuvwxyz0123456789"
+	communityChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+var (
+	ipv4Pattern = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	ipv6Pattern = regexp.MustCompile(`[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7}(?:(?:\d{1,3}\.){3}\d{1,3})?`)
+)
+
+// Anonymizer consistently pseudonymizes IP addresses, hostnames and SNMP community strings using a secret key,
+// so captures and decoded messages can be shared without revealing the network topology.
+// The pseudonyms preserve the format: IP addresses are replaced with addresses of the same family that share
+// a prefix of the same length when the originals do (like Crypto-PAn), hostnames keep the number and length of their labels
+// and the top level domain, and community strings keep their length.
+// The same key always produces the same pseudonyms, so records anonymized on different runs can be correlated.
+type Anonymizer struct {
+	key   []byte
+	mutex sync.Mutex
+	cache map[string]string
+}
+
+// NewAnonymizer Creates an anonymizer for a given secret key.
+func NewAnonymizer(key string) (*Anonymizer, error) {
+	if key == "" {
+		return nil, fmt.Errorf("the anonymization key is required")
+	}
+	return &Anonymizer{key: []byte(key), cache: make(map[string]string)}, nil
+}
+
+// hash Returns the keyed hash of a value within a given domain, so the same value has different pseudonyms on each domain.
+func (a *Anonymizer) hash(domain string, value []byte) []byte {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(domain))
+	mac.Write([]byte{0})
+	mac.Write(value)
+	return mac.Sum(nil)
+}
+
+// cached Returns the pseudonym of a value within a given domain, generating it when it is not in the cache.
+func (a *Anonymizer) cached(domain, value string, generate func() string) string {
+	key := domain + ":" + value
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if pseudonym, ok := a.cache[key]; ok {
+		return pseudonym
+	}
+	if len(a.cache) >= maxAnonymizerCache {
+		a.cache = make(map[string]string)
+	}
+	pseudonym := generate()
+	a.cache[key] = pseudonym
+	return pseudonym
+}
+
+// token Generates a pseudonym with the same length as the value, using the given character set.
+func (a *Anonymizer) token(domain, value string, chars string) string {
+	result := make([]byte, 0, len(value))
+	for counter := 0; len(result) < len(value); counter++ {
+		for _, b := range a.hash(domain, []byte(fmt.Sprintf("%s#%d", value, counter))) {
+			if len(result) == len(value) {
+				break
+			}
+			result = append(result, chars[int(b)%len(chars)])
+		}
+	}
+	return string(result)
+}
+
+// IP Returns the pseudonym of an IP address, preserving the length of the prefixes shared with other addresses.
+// Each bit is flipped based on the keyed hash of the bits that precede it.
+func (a *Anonymizer) IP(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	if len(ip) != net.IPv4len && len(ip) != net.IPv6len {
+		return ip
+	}
+	domain := fmt.Sprintf("ip%d", len(ip)) // Different pseudonyms for each family
+	result := make(net.IP, len(ip))
+	prefix := make([]byte, len(ip)+1)
+	for i := 0; i < len(ip)*8; i++ {
+		mask := byte(0x80) >> uint(i%8)
+		prefix[len(ip)] = byte(i)
+		flip := a.hash(domain, prefix)[0] & 1
+		bit := ip[i/8] & mask
+		if flip == 1 {
+			result[i/8] |= ^bit & mask
+		} else {
+			result[i/8] |= bit
+		}
+		prefix[i/8] |= bit
+	}
+	return result
+}
+
+// Address Returns the pseudonym of an IP address in text format; the value is returned as is when it is not a valid address.
+func (a *Anonymizer) Address(value string) string {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return value
+	}
+	return a.cached("ip", value, func() string { return a.IP(ip).String() })
+}
+
+// Hostname Returns the pseudonym of a hostname, or the one of the address when it is an IP address.
+// Each label is replaced with a pseudonym of the same length, except the top level domain of fully qualified names.
+func (a *Anonymizer) Hostname(value string) string {
+	if value == "" {
+		return value
+	}
+	if net.ParseIP(value) != nil {
+		return a.Address(value)
+	}
+	return a.cached("hostname", value, func() string {
+		labels := strings.Split(strings.ToLower(value), ".")
+		last := len(labels)
+		if last > 1 {
+			last--
+		}
+		for i := 0; i < last; i++ {
+			labels[i] = a.token("hostname", labels[i], hostnameChars)
+		}
+		return strings.Join(labels, ".")
+	})
+}
+
+// Community Returns the pseudonym of an SNMP community string.
+func (a *Anonymizer) Community(value string) string {
+	if value == "" {
+		return value
+	}
+	return a.cached("community", value, func() string { return a.token("community", value, communityChars) })
+}
+
+// Text Replaces the IP addresses found within a free-form text, like the content of a Syslog message.
+func (a *Anonymizer) Text(value string) string {
+	value = ipv4Pattern.ReplaceAllStringFunc(value, a.Address)
+	if strings.Count(value, ":") < 2 {
+		return value
+	}
+	return ipv6Pattern.ReplaceAllStringFunc(value, func(match string) string {
+		if strings.Count(match, ":") < 2 || strings.Trim(match, ":") == "" {
+			return match
+		}
+		return a.Address(match)
+	})
+}
+
+// Content Anonymizes a reassembled IPC message based on the parser, before decoding it.
+// The content is rewritten in its original format, so the decoded messages and the captures only contain pseudonyms.
+// RPC, Heartbeat and Events messages are treated as free-form text.
+func (a *Anonymizer) Content(ipc string, parser string, data []byte) ([]byte, error) {
+	switch {
+	case ipc == "rpc" || isHeartbeat(parser) || isEvents(parser):
+		return []byte(a.Text(string(data))), nil
+	case isTelemetry(parser):
+		return a.telemetry(parser, data)
+	case isSyslog(parser):
+		return a.syslog(data)
+	case isSnmp(parser):
+		return a.snmp(data)
+	}
+	return nil, fmt.Errorf("invalid parser %s", parser)
+}
+
+// anonymize Returns the anonymized content of a reassembled IPC message, when the anonymization is enabled.
+// Returns nil when the content cannot be anonymized, so it is discarded instead of leaking the original values.
+func (cli *KafkaClient) anonymize(data []byte, parser string) []byte {
+	if cli.Anonymizer == nil || data == nil {
+		return data
+	}
+	content, err := cli.Anonymizer.Content(cli.IPC, parser, data)
+	if err != nil {
+		cli.logger().Warnf("discarding message, cannot anonymize it: %v", err)
+		return nil
+	}
+	return content
+}
+
+// telemetry Anonymizes a telemetry message log, including the addresses and hostnames of each flow.
+func (a *Anonymizer) telemetry(parser string, data []byte) ([]byte, error) {
+	msgLog := &telemetry.TelemetryMessageLog{}
+	if err := proto.Unmarshal(data, msgLog); err != nil {
+		return nil, fmt.Errorf("invalid telemetry message: %v", err)
+	}
+	if msgLog.SourceAddress != nil {
+		msgLog.SourceAddress = proto.String(a.Address(msgLog.GetSourceAddress()))
+	}
+	for _, msg := range msgLog.Message {
+		var err error
+		if isNetflow(parser) {
+			flow := &netflow.FlowMessage{}
+			if err = proto.Unmarshal(msg.Bytes, flow); err != nil {
+				return nil, fmt.Errorf("invalid netflow message: %v", err)
+			}
+			flow.SrcAddress = a.Address(flow.SrcAddress)
+			flow.DstAddress = a.Address(flow.DstAddress)
+			flow.NextHopAddress = a.Address(flow.NextHopAddress)
+			flow.SrcHostname = a.Hostname(flow.SrcHostname)
+			flow.DstHostname = a.Hostname(flow.DstHostname)
+			flow.NextHopHostname = a.Hostname(flow.NextHopHostname)
+			msg.Bytes, err = proto.Marshal(flow)
+		} else if isSflow(parser) {
+			doc := bson.D{}
+			if err = bson.Unmarshal(msg.Bytes, &doc); err != nil {
+				return nil, fmt.Errorf("invalid sflow message: %v", err)
+			}
+			msg.Bytes, err = bson.Marshal(a.bson(doc))
+		} else {
+			return nil, fmt.Errorf("cannot anonymize %s messages", parser)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode %s message: %v", parser, err)
+		}
+	}
+	return proto.Marshal(msgLog)
+}
+
+// bson Replaces the IP addresses found on the strings of a BSON document recursively.
+func (a *Anonymizer) bson(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.D:
+		for i := range v {
+			v[i].Value = a.bson(v[i].Value)
+		}
+		return v
+	case bson.M:
+		for key, item := range v {
+			v[key] = a.bson(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = a.bson(item)
+		}
+		return v
+	case string:
+		return a.Text(v)
+	}
+	return value
+}
+
+// syslog Anonymizes a Syslog message log, including the addresses within the messages and the hostname from their headers.
+func (a *Anonymizer) syslog(data []byte) ([]byte, error) {
+	msgLog := &SyslogMessageLogDTO{}
+	if err := xml.Unmarshal(data, msgLog); err != nil {
+		return nil, fmt.Errorf("invalid syslog message: %v", err)
+	}
+	msgLog.SourceAddress = a.Address(msgLog.SourceAddress)
+	for i, msg := range msgLog.Messages {
+		bytes, err := base64.StdEncoding.DecodeString(string(msg.Content))
+		if err != nil {
+			return nil, fmt.Errorf("invalid syslog content: %v", err)
+		}
+		content := string(bytes)
+		if fields, ok := ParseSyslog(content); ok && fields.Hostname != "" {
+			content = strings.Replace(content, " "+fields.Hostname+" ", " "+a.Hostname(fields.Hostname)+" ", 1)
+		}
+		msgLog.Messages[i].Content = []byte(base64.StdEncoding.EncodeToString([]byte(a.Text(content))))
+	}
+	return xml.Marshal(msgLog)
+}
+
+// snmp Anonymizes an SNMP trap log, including the agent addresses, the community strings, and the addresses within the varbinds.
+// The raw PDUs are removed, as they contain the original values.
+func (a *Anonymizer) snmp(data []byte) ([]byte, error) {
+	trapLog := &TrapLogDTO{}
+	if err := xml.Unmarshal(data, trapLog); err != nil {
+		return nil, fmt.Errorf("invalid snmp trap message: %v", err)
+	}
+	trapLog.TrapAddress = a.Address(trapLog.TrapAddress)
+	for i := range trapLog.Messages {
+		trap := &trapLog.Messages[i]
+		trap.AgentAddress = a.Address(trap.AgentAddress)
+		trap.Community = a.Community(trap.Community)
+		trap.RawMessage = nil
+		if trap.Results == nil {
+			continue
+		}
+		for j := range trap.Results.Results {
+			value := &trap.Results.Results[j].Value
+			bytes, err := base64.StdEncoding.DecodeString(value.Value)
+			if err != nil {
+				continue
+			}
+			switch value.Type {
+			case snmpIPAddress:
+				if len(bytes) == net.IPv4len || len(bytes) == net.IPv6len {
+					bytes = a.IP(net.IP(bytes))
+				}
+			case snmpOctetString:
+				bytes = []byte(a.Text(string(bytes)))
+			}
+			value.Value = base64.StdEncoding.EncodeToString(bytes)
+		}
+	}
+	return xml.Marshal(trapLog)
+}
@@ -0,0 +1,133 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/netflow"
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/telemetry"
+	"google.golang.org/protobuf/proto"
+	"gotest.tools/v3/assert"
+)
+
+func TestAnonymizeAddresses(t *testing.T) {
+	_, err := NewAnonymizer("")
+	assert.ErrorContains(t, err, "required")
+	a, err := NewAnonymizer("secret")
+	assert.NilError(t, err)
+	b, _ := NewAnonymizer("another")
+
+	// Consistent, keyed, and of the same family
+	ip := a.Address("10.0.1.1")
+	assert.Equal(t, ip, a.Address("10.0.1.1"))
+	assert.Assert(t, ip != "10.0.1.1")
+	assert.Assert(t, net.ParseIP(ip).To4() != nil)
+	assert.Assert(t, ip != b.Address("10.0.1.1"))
+	assert.Assert(t, net.ParseIP(a.Address("2001:db8::1")).To4() == nil)
+	assert.Equal(t, "not-an-ip", a.Address("not-an-ip"))
+
+	// Prefix preserving
+	first := a.IP(net.ParseIP("10.0.1.1")).To4()
+	second := a.IP(net.ParseIP("10.0.1.200")).To4()
+	assert.DeepEqual(t, first[:3], second[:3])
+	assert.Assert(t, first[3] != second[3])
+	other := a.IP(net.ParseIP("192.168.1.1")).To4()
+	assert.Assert(t, first[0]&0x80 != other[0]&0x80)
+
+	// Free-form text
+	text := a.Text("link from 10.0.1.1 to 2001:db8::1 at 12:30:45 is down")
+	assert.Equal(t, "link from "+ip+" to "+a.Address("2001:db8::1")+" at 12:30:45 is down", text)
+}
+
+func TestAnonymizeNames(t *testing.T) {
+	a, _ := NewAnonymizer("secret")
+	host := a.Hostname("router01.Example.com")
+	assert.Equal(t, host, a.Hostname("router01.Example.com"))
+	assert.Equal(t, len("router01.example.com"), len(host))
+	assert.Assert(t, strings.HasSuffix(host, ".com"))
+	assert.Assert(t, !strings.Contains(host, "router01") && !strings.Contains(host, "example"))
+	assert.Assert(t, strings.HasSuffix(a.Hostname("switch.example.com"), strings.TrimPrefix(host, strings.Split(host, ".")[0])))
+	assert.Equal(t, 6, len(a.Hostname("router")))
+	assert.Equal(t, a.Address("10.0.0.1"), a.Hostname("10.0.0.1"))
+
+	community := a.Community("public")
+	assert.Equal(t, 6, len(community))
+	assert.Assert(t, community != "public")
+	assert.Equal(t, community, a.Community("public"))
+}
+
+func TestAnonymizeContent(t *testing.T) {
+	a, _ := NewAnonymizer("secret")
+
+	// Syslog
+	syslog := SyslogMessageLogDTO{
+		SourceAddress: "10.0.0.1",
+		Messages: []SyslogMessageDTO{
+			{Content: []byte(base64.StdEncoding.EncodeToString([]byte("<13>Jan  2 03:04:05 router01 sshd[42]: login from 172.16.0.5")))},
+		},
+	}
+	data, _ := xml.Marshal(syslog)
+	data, err := a.Content("sink", "Syslog", data)
+	assert.NilError(t, err)
+	syslog = SyslogMessageLogDTO{}
+	assert.NilError(t, xml.Unmarshal(data, &syslog))
+	assert.Equal(t, a.Address("10.0.0.1"), syslog.SourceAddress)
+	content, _ := base64.StdEncoding.DecodeString(string(syslog.Messages[0].Content))
+	assert.Equal(t, "<13>Jan  2 03:04:05 "+a.Hostname("router01")+" sshd[42]: login from "+a.Address("172.16.0.5"), string(content))
+
+	// SNMP
+	trap := TrapLogDTO{
+		TrapAddress: "10.0.0.1",
+		Messages: []TrapDTO{{
+			AgentAddress: "172.16.0.1",
+			Community:    "public",
+			RawMessage:   []byte("raw"),
+			Results: &SNMPResults{Results: []SNMPResultDTO{
+				{Base: ".1.3.6.1.2.1.4.20.1.1", Value: SNMPValueDTO{Type: snmpIPAddress, Value: base64.StdEncoding.EncodeToString(net.ParseIP("172.16.0.1").To4())}},
+				{Base: ".1.3.6.1.2.1.1.5.0", Value: SNMPValueDTO{Type: snmpOctetString, Value: base64.StdEncoding.EncodeToString([]byte("peer 172.16.0.1"))}},
+			}},
+		}},
+	}
+	data, _ = xml.Marshal(trap)
+	data, err = a.Content("sink", "Snmp", data)
+	assert.NilError(t, err)
+	trap = TrapLogDTO{}
+	assert.NilError(t, xml.Unmarshal(data, &trap))
+	agent := a.Address("172.16.0.1")
+	assert.Equal(t, a.Address("10.0.0.1"), trap.TrapAddress)
+	assert.Equal(t, agent, trap.Messages[0].AgentAddress)
+	assert.Equal(t, a.Community("public"), trap.Messages[0].Community)
+	assert.Assert(t, trap.Messages[0].RawMessage == nil)
+	value, _ := base64.StdEncoding.DecodeString(trap.Messages[0].Results.Results[0].Value.Value)
+	assert.Equal(t, agent, net.IP(value).String())
+	value, _ = base64.StdEncoding.DecodeString(trap.Messages[0].Results.Results[1].Value.Value)
+	assert.Equal(t, "peer "+agent, string(value))
+
+	// Netflow
+	flow, _ := proto.Marshal(&netflow.FlowMessage{SrcAddress: "10.0.0.1", DstAddress: "10.0.0.2", DstHostname: "server.example.com"})
+	data, _ = proto.Marshal(&telemetry.TelemetryMessageLog{
+		Location:      proto.String("Test"),
+		SystemId:      proto.String("mock01"),
+		SourceAddress: proto.String("10.0.0.254"),
+		SourcePort:    proto.Uint32(9999),
+		Message:       []*telemetry.TelemetryMessage{{Timestamp: proto.Uint64(1), Bytes: flow}},
+	})
+	data, err = a.Content("sink", "netflow", data)
+	assert.NilError(t, err)
+	msgLog := &telemetry.TelemetryMessageLog{}
+	assert.NilError(t, proto.Unmarshal(data, msgLog))
+	assert.Equal(t, a.Address("10.0.0.254"), msgLog.GetSourceAddress())
+	result := &netflow.FlowMessage{}
+	assert.NilError(t, proto.Unmarshal(msgLog.Message[0].Bytes, result))
+	assert.Equal(t, a.Address("10.0.0.1"), result.SrcAddress)
+	assert.Equal(t, a.Address("10.0.0.2"), result.DstAddress)
+	assert.Equal(t, a.Hostname("server.example.com"), result.DstHostname)
+
+	_, err = a.Content("sink", "Syslog", []byte("invalid"))
+	assert.ErrorContains(t, err, "invalid syslog message")
+}
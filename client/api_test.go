@@ -0,0 +1,171 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bytes"
+	"flag"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// apiSnapshot is the file with the exported API of the package for the current major version.
+const apiSnapshot = "testdata/api.txt"
+
+var updateAPI = flag.Bool("update-api", false, "update the snapshot of the exported API after compatible additions")
+
+// TestAPICompatibility Verifies that the exported API remains backwards compatible with the snapshot of the current major version.
+// Removing or changing an exported declaration breaks the downstream importers, so it fails the test; additions are compatible,
+// and are recorded by running the test with -update-api.
+func TestAPICompatibility(t *testing.T) {
+	current := exportedAPI(t)
+	if *updateAPI {
+		assert.NilError(t, ioutil.WriteFile(apiSnapshot, []byte(strings.Join(current, "\n")+"\n"), 0644))
+		return
+	}
+	data, err := ioutil.ReadFile(apiSnapshot)
+	assert.NilError(t, err)
+	declared := make(map[string]bool, len(current))
+	for _, line := range current {
+		declared[line] = true
+	}
+	recorded := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		recorded[line] = true
+		if !declared[line] {
+			t.Errorf("incompatible API change, removed or modified: %s", line)
+		}
+	}
+	for _, line := range current {
+		if !recorded[line] {
+			t.Errorf("new API not recorded in %s (run with -update-api): %s", apiSnapshot, line)
+		}
+	}
+}
+
+// exportedAPI Returns a sorted description of the exported declarations of the package, one per line.
+func exportedAPI(t *testing.T) []string {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	assert.NilError(t, err)
+	print := func(node interface{}) string {
+		buf := &bytes.Buffer{}
+		printer.Fprint(buf, fset, node)
+		return strings.Join(strings.Fields(buf.String()), " ")
+	}
+	var api []string
+	for _, file := range pkgs["client"].Files {
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if !d.Name.IsExported() || (d.Recv != nil && !exportedReceiver(d.Recv)) {
+					continue
+				}
+				var recv *ast.FieldList
+				if d.Recv != nil { // The name of the receiver is not part of the API
+					recv = &ast.FieldList{List: []*ast.Field{{Type: d.Recv.List[0].Type}}}
+				}
+				api = append(api, print(&ast.FuncDecl{Recv: recv, Name: d.Name, Type: d.Type}))
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					api = append(api, exportedSpec(d.Tok, spec, print)...)
+				}
+			}
+		}
+	}
+	sort.Strings(api)
+	return api
+}
+
+// exportedReceiver Returns true when the receiver of a method is an exported type.
+func exportedReceiver(recv *ast.FieldList) bool {
+	expr := recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.IsExported()
+}
+
+// exportedSpec Describes the exported elements of a type, constant or variable declaration.
+// The values of the constants and variables are not part of the API.
+func exportedSpec(tok token.Token, spec ast.Spec, print func(node interface{}) string) []string {
+	var api []string
+	switch s := spec.(type) {
+	case *ast.TypeSpec:
+		if !s.Name.IsExported() {
+			return nil
+		}
+		switch typ := s.Type.(type) {
+		case *ast.StructType:
+			api = append(api, "type "+s.Name.Name+" struct")
+			for _, field := range typ.Fields.List {
+				for _, name := range fieldNames(field) {
+					if ast.IsExported(name) {
+						api = append(api, "field "+s.Name.Name+"."+name+" "+print(field.Type))
+					}
+				}
+			}
+		case *ast.InterfaceType:
+			api = append(api, "type "+s.Name.Name+" interface")
+			for _, method := range typ.Methods.List {
+				for _, name := range fieldNames(method) {
+					if ast.IsExported(name) {
+						api = append(api, "method "+s.Name.Name+"."+name+" "+print(method.Type))
+					}
+				}
+			}
+		default:
+			assign := " "
+			if s.Assign.IsValid() {
+				assign = " = "
+			}
+			api = append(api, "type "+s.Name.Name+assign+print(s.Type))
+		}
+	case *ast.ValueSpec:
+		for _, name := range s.Names {
+			if !name.IsExported() {
+				continue
+			}
+			line := tok.String() + " " + name.Name
+			if s.Type != nil {
+				line += " " + print(s.Type)
+			}
+			api = append(api, line)
+		}
+	}
+	return api
+}
+
+// fieldNames Returns the names of a field, or the name of the type for embedded fields.
+func fieldNames(field *ast.Field) []string {
+	if len(field.Names) == 0 {
+		expr := field.Type
+		if star, ok := expr.(*ast.StarExpr); ok {
+			expr = star.X
+		}
+		if sel, ok := expr.(*ast.SelectorExpr); ok {
+			return []string{sel.Sel.Name}
+		}
+		if ident, ok := expr.(*ast.Ident); ok {
+			return []string{ident.Name}
+		}
+		return nil
+	}
+	names := make([]string, len(field.Names))
+	for i, name := range field.Names {
+		names[i] = name.Name
+	}
+	return names
+}
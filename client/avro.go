@@ -0,0 +1,253 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/sink"
+	"github.com/linkedin/goavro/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// Wire formats
+const (
+	WireProtobuf = "protobuf" // The records contain a Sink message in protobuf format, as produced by OpenNMS (default).
+	WireAvro     = "avro"     // The records contain an Avro datum with the Confluent Schema Registry framing.
+)
+
+// SchemaRegistry resolves the Avro schemas referenced by the records through a Confluent Schema Registry.
+// The schemas are immutable, so each of them is fetched only once.
+// This is a concurrent safe object.
+type SchemaRegistry struct {
+	URL      string       // The base URL of the registry, i.e. http://localhost:8081.
+	Username string       // The user name for basic authentication (optional).
+	Password string       `json:"-"` // The password for basic authentication; accepts secret references (optional).
+	Client   *http.Client `json:"-"` // The HTTP client (optional).
+
+	mutex  sync.RWMutex
+	codecs map[uint32]*goavro.Codec
+}
+
+// Validate Verifies the registry settings.
+func (r *SchemaRegistry) Validate() error {
+	if r.URL == "" {
+		return fmt.Errorf("the schema registry URL is required")
+	}
+	r.URL = strings.TrimSuffix(r.URL, "/")
+	return nil
+}
+
+// codec Returns the codec of a schema, fetching it from the registry when it is not cached.
+func (r *SchemaRegistry) codec(id uint32) (*goavro.Codec, error) {
+	r.mutex.RLock()
+	codec, ok := r.codecs[id]
+	r.mutex.RUnlock()
+	if ok {
+		return codec, nil
+	}
+	schema, err := r.fetch(id)
+	if err != nil {
+		return nil, err
+	}
+	if codec, err = goavro.NewCodec(schema); err != nil {
+		return nil, fmt.Errorf("invalid schema %d: %v", id, err)
+	}
+	r.mutex.Lock()
+	if r.codecs == nil {
+		r.codecs = make(map[uint32]*goavro.Codec)
+	}
+	r.codecs[id] = codec
+	r.mutex.Unlock()
+	return codec, nil
+}
+
+// fetch Retrieves the definition of a schema from the registry.
+func (r *SchemaRegistry) fetch(id uint32) (string, error) {
+	url := fmt.Sprintf("%s/schemas/ids/%d", r.URL, id)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot create request: %v", err)
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	if r.Username != "" {
+		password, err := ResolveSecret(r.Password)
+		if err != nil {
+			return "", fmt.Errorf("cannot resolve schema registry password: %v", err)
+		}
+		req.SetBasicAuth(r.Username, password)
+	}
+	client := r.Client
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("cannot fetch schema %d: %v", id, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cannot fetch schema %d: %s", id, res.Status)
+	}
+	body := struct {
+		Schema string `json:"schema"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid response for schema %d: %v", id, err)
+	}
+	return body.Schema, nil
+}
+
+// Decode Deserializes an Avro datum with the Confluent framing: a zero magic byte, the schema ID as a 32-bit big-endian integer, and the binary datum.
+func (r *SchemaRegistry) Decode(data []byte) (interface{}, error) {
+	if len(data) < 5 || data[0] != 0 {
+		return nil, fmt.Errorf("invalid Avro framing")
+	}
+	codec, err := r.codec(binary.BigEndian.Uint32(data[1:5]))
+	if err != nil {
+		return nil, err
+	}
+	datum, _, err := codec.NativeFromBinary(data[5:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid Avro datum: %v", err)
+	}
+	return datum, nil
+}
+
+// validateWireFormat Verifies the wire format settings, applying defaults when necessary.
+func (cli *KafkaClient) validateWireFormat() error {
+	switch cli.WireFormat {
+	case "":
+		cli.WireFormat = WireProtobuf
+	case WireProtobuf:
+	case WireAvro:
+		if cli.IPC == "rpc" {
+			return fmt.Errorf("the %s wire format is only supported with the Sink API", WireAvro)
+		}
+		if cli.SchemaRegistry == nil {
+			return fmt.Errorf("the %s wire format requires a schema registry", WireAvro)
+		}
+		if err := cli.SchemaRegistry.Validate(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid wire format %s; expecting %s or %s", cli.WireFormat, WireProtobuf, WireAvro)
+	}
+	return nil
+}
+
+// decodeSinkMessage Deserializes the Sink message of a record based on the wire format.
+func (cli *KafkaClient) decodeSinkMessage(msg *message.Message) (*sink.SinkMessage, error) {
+	if cli.WireFormat == WireAvro {
+		datum, err := cli.SchemaRegistry.Decode(msg.Payload)
+		if err != nil {
+			return nil, err
+		}
+		return avroSinkMessage(datum, msg.UUID)
+	}
+	sinkMsg := &sink.SinkMessage{}
+	if err := proto.Unmarshal(msg.Payload, sinkMsg); err != nil {
+		return nil, err
+	}
+	return sinkMsg, nil
+}
+
+// avroSinkMessage Converts an Avro record into a Sink message.
+// Records with the fields of the Sink message (message_id, content, current_chunk_number, total_chunks, tracing_info and headers) are used as is,
+// and the content is converted to JSON unless it is a string or bytes; any other record is treated as the content of a single-chunk message in JSON.
+func avroSinkMessage(datum interface{}, id string) (*sink.SinkMessage, error) {
+	record, ok := avroUnion(datum).(map[string]interface{})
+	if !ok || record["message_id"] == nil {
+		content, err := json.Marshal(avroJSON(datum))
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode record: %v", err)
+		}
+		return &sink.SinkMessage{MessageId: id, Content: content, TotalChunks: 1}, nil
+	}
+	msg := &sink.SinkMessage{TotalChunks: 1}
+	msg.MessageId, _ = avroUnion(record["message_id"]).(string)
+	if chunk, ok := avroUnion(record["current_chunk_number"]).(int32); ok {
+		msg.CurrentChunkNumber = chunk
+	}
+	if total, ok := avroUnion(record["total_chunks"]).(int32); ok {
+		msg.TotalChunks = total
+	}
+	switch content := avroUnion(record["content"]).(type) {
+	case []byte:
+		msg.Content = content
+	case string:
+		msg.Content = []byte(content)
+	case nil:
+	default:
+		data, err := json.Marshal(avroJSON(content))
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode content: %v", err)
+		}
+		msg.Content = data
+	}
+	msg.TracingInfo = avroStringMap(record["tracing_info"])
+	msg.Headers = avroStringMap(record["headers"])
+	return msg, nil
+}
+
+// avroStringMap Returns the string values of an Avro map, or nil when it is not a map.
+func avroStringMap(datum interface{}) map[string]string {
+	items, ok := avroUnion(datum).(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	values := make(map[string]string, len(items))
+	for key, value := range items {
+		if s, ok := avroUnion(value).(string); ok {
+			values[key] = s
+		}
+	}
+	return values
+}
+
+// avroUnionTypes contains the names of the unnamed types, used by goavro to wrap the values of the unions.
+var avroUnionTypes = map[string]bool{
+	"boolean": true, "int": true, "long": true, "float": true, "double": true, "bytes": true, "string": true, "map": true, "array": true,
+}
+
+// avroUnion Returns the value of a union of an unnamed type, as represented by goavro, or the value itself otherwise.
+// Nullable fields are declared as a union of null and their type, so their values are wrapped.
+func avroUnion(value interface{}) interface{} {
+	if m, ok := value.(map[string]interface{}); ok && len(m) == 1 {
+		for key, v := range m {
+			if avroUnionTypes[key] {
+				return v
+			}
+		}
+	}
+	return value
+}
+
+// avroJSON Converts the native representation of an Avro datum into a value suitable for JSON, unwrapping the unions,
+// and encoding bytes as strings.
+func avroJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = avroJSON(avroUnion(item))
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = avroJSON(avroUnion(item))
+		}
+		return out
+	case []byte:
+		return string(v)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,95 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/linkedin/goavro/v2"
+	"gotest.tools/v3/assert"
+)
+
+const avroSinkSchema = `{
+  "type": "record", "name": "SinkMessage", "namespace": "org.opennms.sink",
+  "fields": [
+    {"name": "message_id", "type": "string"},
+    {"name": "content", "type": "bytes"},
+    {"name": "current_chunk_number", "type": "int"},
+    {"name": "total_chunks", "type": "int"},
+    {"name": "tracing_info", "type": ["null", {"type": "map", "values": "string"}], "default": null}
+  ]
+}`
+
+const avroEventSchema = `{
+  "type": "record", "name": "Event", "fields": [
+    {"name": "uei", "type": "string"},
+    {"name": "severity", "type": ["null", "int"], "default": null}
+  ]
+}`
+
+// avroRecord Encodes a native datum with the Confluent framing.
+func avroRecord(t *testing.T, id uint32, schema string, datum interface{}) []byte {
+	codec, err := goavro.NewCodec(schema)
+	assert.NilError(t, err)
+	data := []byte{0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(data[1:], id)
+	data, err = codec.BinaryFromNative(data, datum)
+	assert.NilError(t, err)
+	return data
+}
+
+func TestAvroWireFormat(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if user, password, _ := r.BasicAuth(); user != "opennms" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		schemas := map[string]string{"/schemas/ids/1": avroSinkSchema, "/schemas/ids/2": avroEventSchema}
+		schema, ok := schemas[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"schema": schema})
+	}))
+	defer server.Close()
+
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	cli.WireFormat = WireAvro
+	assert.ErrorContains(t, cli.validateWireFormat(), "requires a schema registry")
+	cli.SchemaRegistry = &SchemaRegistry{URL: server.URL + "/", Username: "opennms", Password: "secret"}
+	assert.NilError(t, cli.validateWireFormat())
+
+	chunk := func(chunk int32, data string) *message.Message {
+		return message.NewMessage("uuid", avroRecord(t, 1, avroSinkSchema, map[string]interface{}{
+			"message_id":           "0001",
+			"content":              []byte(data),
+			"current_chunk_number": chunk,
+			"total_chunks":         int32(2),
+			"tracing_info":         goavro.Union("map", map[string]interface{}{"tenant": "acme"}),
+		}))
+	}
+	assert.Assert(t, cli.processMessage(chunk(0, "ABC")) == nil)
+	assert.Equal(t, "ABCDEF", string(cli.processMessage(chunk(1, "DEF"))))
+	assert.Equal(t, 1, requests) // Cached
+
+	event := message.NewMessage("0002", avroRecord(t, 2, avroEventSchema, map[string]interface{}{"uei": "uei.opennms.org/test", "severity": goavro.Union("int", int32(5))}))
+	assert.Equal(t, `{"severity":5,"uei":"uei.opennms.org/test"}`, string(cli.processMessage(event)))
+
+	assert.Assert(t, cli.processMessage(message.NewMessage("0003", avroRecord(t, 3, avroEventSchema, map[string]interface{}{"uei": "x", "severity": nil}))) == nil) // Unknown schema
+	assert.Assert(t, cli.processMessage(message.NewMessage("0004", []byte("invalid"))) == nil)
+	_, err := cli.SchemaRegistry.Decode([]byte{1, 0, 0, 0, 1})
+	assert.ErrorContains(t, err, "invalid Avro framing")
+
+	cli.SchemaRegistry = &SchemaRegistry{URL: server.URL}
+	_, err = cli.SchemaRegistry.Decode(avroRecord(t, 2, avroEventSchema, map[string]interface{}{"uei": "x", "severity": nil}))
+	assert.ErrorContains(t, err, "401 Unauthorized")
+}
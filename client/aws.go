@@ -0,0 +1,426 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default AWS messaging output settings
+const (
+	DefaultAWSRegion = "us-east-1"
+	awsMaxBatchSize  = 10         // The maximum number of entries of PublishBatch and SendMessageBatch.
+	awsMaxBatchBytes = 256 * 1024 // The maximum size of all the messages of a batch.
+)
+
+// AWS messaging services
+const (
+	AWSServiceSNS = "sns"
+	AWSServiceSQS = "sqs"
+)
+
+// awsMetadataURL is the endpoint of the instance metadata service of EC2.
+var awsMetadataURL = "http://169.254.169.254"
+
+// awsCredentials contains the keys to sign the requests, and the expiration of the temporary ones.
+type awsCredentials struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Expires      time.Time // Zero for long-term credentials.
+}
+
+// awsCredentialProvider discovers the AWS credentials like the AWS SDKs, caching the temporary ones until they are about to expire.
+// The sources are, in order: the static keys, the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables (with AWS_SESSION_TOKEN),
+// the profile of the shared credentials file (AWS_PROFILE and AWS_SHARED_CREDENTIALS_FILE, defaulting to ~/.aws/credentials),
+// the ECS container credentials (AWS_CONTAINER_CREDENTIALS_RELATIVE_URI or AWS_CONTAINER_CREDENTIALS_FULL_URI), and the EC2 instance metadata.
+// This is a concurrent safe object.
+type awsCredentialProvider struct {
+	accessKey string
+	secretKey string // Accepts secret references.
+	client    *http.Client
+
+	mutex  sync.Mutex
+	cached awsCredentials
+}
+
+// get Returns the current credentials.
+func (p *awsCredentialProvider) get() (awsCredentials, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.cached.AccessKey != "" && (p.cached.Expires.IsZero() || time.Until(p.cached.Expires) > 5*time.Minute) {
+		return p.cached, nil
+	}
+	creds, err := p.discover()
+	if err != nil {
+		return creds, err
+	}
+	p.cached = creds
+	return creds, nil
+}
+
+// discover Looks for the credentials on each source.
+func (p *awsCredentialProvider) discover() (awsCredentials, error) {
+	if p.accessKey != "" {
+		secret, err := ResolveSecret(p.secretKey)
+		if err != nil {
+			return awsCredentials{}, fmt.Errorf("cannot resolve AWS secret key: %v", err)
+		}
+		return awsCredentials{AccessKey: p.accessKey, SecretKey: secret}, nil
+	}
+	if key := os.Getenv("AWS_ACCESS_KEY_ID"); key != "" {
+		return awsCredentials{AccessKey: key, SecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"), SessionToken: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+	if creds, ok, err := awsSharedCredentials(); ok || err != nil {
+		return creds, err
+	}
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		return p.fetch("http://169.254.170.2"+uri, nil)
+	}
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); uri != "" {
+		headers := map[string]string{}
+		if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+			headers["Authorization"] = token
+		}
+		return p.fetch(uri, headers)
+	}
+	return p.instanceCredentials()
+}
+
+// awsSharedCredentials Reads the keys of the selected profile from the shared credentials file; it returns false when the file doesn't exist.
+func awsSharedCredentials() (awsCredentials, bool, error) {
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return awsCredentials{}, false, nil
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return awsCredentials{}, false, nil
+	}
+	defer file.Close()
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	creds := awsCredentials{}
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if section != profile || len(parts) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(parts[1])
+		switch strings.TrimSpace(parts[0]) {
+		case "aws_access_key_id":
+			creds.AccessKey = value
+		case "aws_secret_access_key":
+			creds.SecretKey = value
+		case "aws_session_token":
+			creds.SessionToken = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return creds, true, fmt.Errorf("cannot read %s: %v", path, err)
+	}
+	if creds.AccessKey == "" {
+		return creds, false, nil
+	}
+	return creds, true, nil
+}
+
+// instanceCredentials Retrieves the credentials of the IAM role of the EC2 instance, through IMDSv2.
+func (p *awsCredentialProvider) instanceCredentials() (awsCredentials, error) {
+	req, err := http.NewRequest(http.MethodPut, awsMetadataURL+"/latest/api/token", nil)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("cannot create request: %v", err)
+	}
+	req.Header.Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+	token, err := doCloudRequest(p.httpClient(), req)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("no AWS credentials found, and the instance metadata is not available: %v", err)
+	}
+	headers := map[string]string{"X-Aws-Ec2-Metadata-Token": string(token)}
+	req, _ = http.NewRequest(http.MethodGet, awsMetadataURL+"/latest/meta-data/iam/security-credentials/", nil)
+	req.Header.Set("X-Aws-Ec2-Metadata-Token", string(token))
+	role, err := doCloudRequest(p.httpClient(), req)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("cannot find the IAM role of the instance: %v", err)
+	}
+	name := strings.TrimSpace(strings.SplitN(string(role), "\n", 2)[0])
+	return p.fetch(awsMetadataURL+"/latest/meta-data/iam/security-credentials/"+name, headers)
+}
+
+// fetch Retrieves temporary credentials from the container or instance metadata endpoints.
+func (p *awsCredentialProvider) fetch(url string, headers map[string]string) (awsCredentials, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("cannot create request: %v", err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	body, err := doCloudRequest(p.httpClient(), req)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("cannot fetch AWS credentials: %v", err)
+	}
+	result := struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		Token           string    `json:"Token"`
+		Expiration      time.Time `json:"Expiration"`
+	}{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return awsCredentials{}, fmt.Errorf("invalid AWS credentials: %v", err)
+	}
+	return awsCredentials{AccessKey: result.AccessKeyID, SecretKey: result.SecretAccessKey, SessionToken: result.Token, Expires: result.Expiration}, nil
+}
+
+func (p *awsCredentialProvider) httpClient() *http.Client {
+	if p.client != nil {
+		return p.client
+	}
+	return &http.Client{Timeout: 5 * time.Second}
+}
+
+// AWSOutput publishes the decoded messages to an SNS topic or an SQS queue, for instance to feed cloud analytics.
+// Each message contains the same envelope used by the ForwardOutput with the json format, and its parser, Kafka coordinates
+// and metadata as message attributes. Messages are queued and published in batches of up to 10 messages from the background,
+// through PublishBatch or SendMessageBatch; the failures are retried with an exponential backoff, and when the queue is full,
+// Send blocks until there is room or the context expires, which slows down the consumer instead of losing messages.
+// The credentials are discovered like the AWS SDKs, unless an access key is provided.
+type AWSOutput struct {
+	TopicARN      string        // The ARN of the SNS topic (either this or the queue URL is required).
+	QueueURL      string        // The URL of the SQS queue.
+	Region        string        // The region of the topic or queue (defaults to the region of the topic ARN, AWS_REGION, or DefaultAWSRegion).
+	Endpoint      string        // The endpoint of the service (defaults to https://sns.<region>.amazonaws.com for SNS, and the queue URL for SQS).
+	AccessKey     string        // The access key ID to sign the requests (optional; discovered from the environment otherwise).
+	SecretKey     string        `json:"-"` // The secret access key; accepts secret references (optional).
+	FlushInterval time.Duration // The maximum time a message waits in the queue (defaults to DefaultCloudFlushInterval).
+	MaxRetries    int           // How many times a failed batch or message is retried (defaults to DefaultCloudMaxRetries).
+	RetryDelay    time.Duration // The delay before the first retry, doubled on each attempt (defaults to DefaultCloudRetryDelay).
+	QueueSize     int           // The maximum number of queued messages (defaults to 100).
+	Client        *http.Client  `json:"-"` // The HTTP client (optional).
+
+	service     string
+	credentials *awsCredentialProvider
+	batcher     *cloudBatcher
+}
+
+// Validate Verifies the AWS output settings, applying defaults when necessary, and starts the background publisher.
+func (out *AWSOutput) Validate() error {
+	switch {
+	case out.TopicARN != "" && out.QueueURL != "":
+		return fmt.Errorf("either the SNS topic ARN or the SQS queue URL is required, not both")
+	case out.TopicARN != "":
+		out.service = AWSServiceSNS
+		if parts := strings.Split(out.TopicARN, ":"); len(parts) != 6 || parts[0] != "arn" || parts[2] != AWSServiceSNS {
+			return fmt.Errorf("invalid SNS topic ARN %s; expecting arn:aws:sns:region:account:topic", out.TopicARN)
+		} else if out.Region == "" {
+			out.Region = parts[3]
+		}
+	case out.QueueURL != "":
+		out.service = AWSServiceSQS
+		if _, err := url.Parse(out.QueueURL); err != nil {
+			return fmt.Errorf("invalid SQS queue URL %s: %v", out.QueueURL, err)
+		}
+	default:
+		return fmt.Errorf("either the SNS topic ARN or the SQS queue URL is required")
+	}
+	if out.Region == "" {
+		out.Region = os.Getenv("AWS_REGION")
+	}
+	if out.Region == "" {
+		out.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if out.Region == "" {
+		out.Region = DefaultAWSRegion
+	}
+	if out.Endpoint == "" {
+		if out.service == AWSServiceSNS {
+			out.Endpoint = "https://sns." + out.Region + ".amazonaws.com"
+		} else {
+			out.Endpoint = out.QueueURL
+		}
+	}
+	if out.FlushInterval <= 0 {
+		out.FlushInterval = DefaultCloudFlushInterval
+	}
+	if out.MaxRetries <= 0 {
+		out.MaxRetries = DefaultCloudMaxRetries
+	}
+	if out.RetryDelay <= 0 {
+		out.RetryDelay = DefaultCloudRetryDelay
+	}
+	if out.QueueSize <= 0 {
+		out.QueueSize = 10 * awsMaxBatchSize
+	}
+	if out.credentials == nil {
+		out.credentials = &awsCredentialProvider{accessKey: out.AccessKey, secretKey: out.SecretKey}
+		if _, err := out.credentials.get(); err != nil {
+			return err
+		}
+	}
+	if out.batcher == nil {
+		out.batcher = &cloudBatcher{
+			destination:   out.Name(),
+			batchSize:     awsMaxBatchSize,
+			maxBytes:      awsMaxBatchBytes,
+			flushInterval: out.FlushInterval,
+			maxRetries:    out.MaxRetries,
+			retryDelay:    out.RetryDelay,
+			publish:       out.publish,
+		}
+		out.batcher.start(out.QueueSize)
+	}
+	return nil
+}
+
+// Name Returns the name of the output, as sns:topic or sqs:queue.
+func (out *AWSOutput) Name() string {
+	if out.TopicARN != "" {
+		return AWSServiceSNS + ":" + out.TopicARN[strings.LastIndex(out.TopicARN, ":")+1:]
+	}
+	return AWSServiceSQS + ":" + out.QueueURL[strings.LastIndex(out.QueueURL, "/")+1:]
+}
+
+// Send Queues a decoded message to be published.
+func (out *AWSOutput) Send(ctx context.Context, msg DecodedMessage) error {
+	m, err := newCloudMessage(msg)
+	if err != nil {
+		return err
+	}
+	return out.batcher.enqueue(ctx, m)
+}
+
+// Close Stops the background publisher, after publishing the queued messages.
+func (out *AWSOutput) Close() error {
+	if out.batcher != nil {
+		out.batcher.close()
+		out.batcher = nil
+	}
+	return nil
+}
+
+// awsBatchError represents a failed entry of a batch; the sender faults are permanent.
+type awsBatchError struct {
+	ID          string `xml:"Id"`
+	Code        string `xml:"Code"`
+	Message     string `xml:"Message"`
+	SenderFault bool   `xml:"SenderFault"`
+}
+
+// awsBatchResponse represents the relevant content of the responses of PublishBatch and SendMessageBatch.
+type awsBatchResponse struct {
+	Failed []awsBatchError `xml:"PublishBatchResult>Failed>member"`
+	Errors []awsBatchError `xml:"SendMessageBatchResult>BatchResultErrorEntry"`
+}
+
+// publish Sends a batch through the query API of the service, returning the messages that should be retried.
+func (out *AWSOutput) publish(messages []cloudMessage) ([]cloudMessage, int, error) {
+	form := url.Values{}
+	prefix := "PublishBatchRequestEntries.member."
+	if out.service == AWSServiceSNS {
+		form.Set("Action", "PublishBatch")
+		form.Set("Version", "2010-03-31")
+		form.Set("TopicArn", out.TopicARN)
+	} else {
+		prefix = "SendMessageBatchRequestEntry."
+		form.Set("Action", "SendMessageBatch")
+		form.Set("Version", "2012-11-05")
+		form.Set("QueueUrl", out.QueueURL)
+	}
+	for i, msg := range messages {
+		entry := prefix + strconv.Itoa(i+1) + "."
+		form.Set(entry+"Id", msg.id)
+		if out.service == AWSServiceSNS {
+			form.Set(entry+"Message", string(msg.body))
+		} else {
+			form.Set(entry+"MessageBody", string(msg.body))
+		}
+		attributes := entry + "MessageAttributes.entry."
+		if out.service == AWSServiceSQS {
+			attributes = entry + "MessageAttribute."
+		}
+		n := 0
+		for _, key := range []string{"parser", "source", "location", "systemId", "sourceAddress"} {
+			if value, ok := msg.attributes[key]; ok {
+				n++
+				attribute := attributes + strconv.Itoa(n) + "."
+				form.Set(attribute+"Name", key)
+				form.Set(attribute+"Value.DataType", "String")
+				form.Set(attribute+"Value.StringValue", value)
+			}
+		}
+	}
+	body, err := out.request([]byte(form.Encode()))
+	if err != nil {
+		return nil, 0, err
+	}
+	result := &awsBatchResponse{}
+	if err := xml.Unmarshal(body, result); err != nil {
+		return nil, 0, fmt.Errorf("invalid response from %s: %v", out.Name(), err)
+	}
+	byID := make(map[string]cloudMessage, len(messages))
+	for _, msg := range messages {
+		byID[msg.id] = msg
+	}
+	var failed []cloudMessage
+	rejected := 0
+	for _, entry := range append(result.Failed, result.Errors...) {
+		msg, ok := byID[entry.ID]
+		if !ok {
+			continue
+		}
+		if entry.SenderFault {
+			rejected++
+			defaultLogger.Errorf("message rejected by %s, dropping it: %s %s", out.Name(), entry.Code, entry.Message)
+		} else {
+			failed = append(failed, msg)
+		}
+	}
+	return failed, rejected, nil
+}
+
+// request Sends a signed request to the service.
+func (out *AWSOutput) request(payload []byte) ([]byte, error) {
+	creds, err := out.credentials.get()
+	if err != nil {
+		return nil, &OutputError{Err: err, Retryable: true}
+	}
+	req, err := http.NewRequest(http.MethodPost, out.Endpoint, strings.NewReader(string(payload)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	signAWSRequest(req, path, payload, out.service, out.Region, creds, time.Now())
+	return doCloudRequest(out.Client, req)
+}
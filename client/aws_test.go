@@ -0,0 +1,120 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestAWSOutput(t *testing.T) {
+	var mutex sync.Mutex
+	var requests []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Assert(t, strings.Contains(r.Header.Get("Authorization"), "Credential=AKID/"), r.Header.Get("Authorization"))
+		assert.Equal(t, "token", r.Header.Get("X-Amz-Security-Token"))
+		r.ParseForm()
+		mutex.Lock()
+		requests = append(requests, r.PostForm)
+		first := len(requests) == 1
+		mutex.Unlock()
+		if r.PostForm.Get("Action") == "PublishBatch" {
+			if first { // The second entry is rejected temporarily, and retried
+				fmt.Fprint(w, `<PublishBatchResponse><PublishBatchResult><Failed><member><Id>1</Id><Code>InternalError</Code><SenderFault>false</SenderFault></member></Failed></PublishBatchResult></PublishBatchResponse>`)
+			} else {
+				fmt.Fprint(w, `<PublishBatchResponse><PublishBatchResult><Successful></Successful></PublishBatchResult></PublishBatchResponse>`)
+			}
+			return
+		}
+		fmt.Fprint(w, `<SendMessageBatchResponse><SendMessageBatchResult><BatchResultErrorEntry><Id>0</Id><Code>InvalidMessageContents</Code><SenderFault>true</SenderFault></BatchResultErrorEntry></SendMessageBatchResult></SendMessageBatchResponse>`)
+	}))
+	defer server.Close()
+
+	os.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	os.Setenv("AWS_SESSION_TOKEN", "token")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	defer os.Unsetenv("AWS_SESSION_TOKEN")
+
+	msg := DecodedMessage{Topic: "OpenNMS.Sink.Trap", Parser: "snmp", Offset: 1, Metadata: Metadata{Location: "Apex"}, Payload: []byte(`{"trap":1}`)}
+	sns := &AWSOutput{TopicARN: "arn:aws:sns:eu-west-1:123456789012:traps", Endpoint: server.URL, RetryDelay: time.Millisecond}
+	assert.NilError(t, sns.Validate())
+	assert.Equal(t, "sns:traps", sns.Name())
+	assert.Equal(t, "eu-west-1", sns.Region)
+	assert.NilError(t, sns.Send(context.Background(), msg))
+	assert.NilError(t, sns.Send(context.Background(), msg))
+	assert.NilError(t, sns.Close())
+	assert.Equal(t, 2, len(requests))
+	assert.Equal(t, "arn:aws:sns:eu-west-1:123456789012:traps", requests[0].Get("TopicArn"))
+	assert.Equal(t, "1", requests[0].Get("PublishBatchRequestEntries.member.2.Id"))
+	assert.Assert(t, strings.Contains(requests[0].Get("PublishBatchRequestEntries.member.1.Message"), `"payload":{"trap":1}`))
+	assert.Equal(t, "parser", requests[0].Get("PublishBatchRequestEntries.member.1.MessageAttributes.entry.1.Name"))
+	assert.Equal(t, "snmp", requests[0].Get("PublishBatchRequestEntries.member.1.MessageAttributes.entry.1.Value.StringValue"))
+	assert.Equal(t, "Apex", requests[0].Get("PublishBatchRequestEntries.member.1.MessageAttributes.entry.3.Value.StringValue"))
+	assert.Equal(t, "1", requests[1].Get("PublishBatchRequestEntries.member.1.Id"))
+	assert.Equal(t, "", requests[1].Get("PublishBatchRequestEntries.member.2.Id"))
+
+	// The permanent failures are not retried
+	requests = nil
+	sqs := &AWSOutput{QueueURL: server.URL + "/123456789012/traps", RetryDelay: time.Millisecond}
+	assert.NilError(t, sqs.Validate())
+	assert.Equal(t, "sqs:traps", sqs.Name())
+	assert.NilError(t, sqs.Send(context.Background(), msg))
+	assert.NilError(t, sqs.Close())
+	assert.Equal(t, 1, len(requests))
+	assert.Equal(t, "SendMessageBatch", requests[0].Get("Action"))
+	assert.Equal(t, "OpenNMS.Sink.Trap/0@1", requests[0].Get("SendMessageBatchRequestEntry.1.MessageAttribute.2.Value.StringValue"))
+
+	assert.ErrorContains(t, (&AWSOutput{}).Validate(), "either the SNS topic ARN or the SQS queue URL is required")
+	assert.ErrorContains(t, (&AWSOutput{TopicARN: "traps"}).Validate(), "invalid SNS topic ARN")
+}
+
+func TestAWSCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	assert.NilError(t, ioutil.WriteFile(path, []byte("[default]\naws_access_key_id = DEFAULT\naws_secret_access_key = secret\n\n[lab]\naws_access_key_id=LAB\naws_secret_access_key=lab-secret\naws_session_token=lab-token\n"), 0600))
+	os.Setenv("AWS_SHARED_CREDENTIALS_FILE", path)
+	os.Setenv("AWS_PROFILE", "lab")
+	defer os.Unsetenv("AWS_SHARED_CREDENTIALS_FILE")
+	defer os.Unsetenv("AWS_PROFILE")
+	creds, err := (&awsCredentialProvider{}).get()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, awsCredentials{AccessKey: "LAB", SecretKey: "lab-secret", SessionToken: "lab-token"}, creds)
+
+	// The temporary credentials of the instance metadata
+	os.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "missing"))
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest/api/token":
+			assert.Equal(t, http.MethodPut, r.Method)
+			fmt.Fprint(w, "imds-token")
+		case "/latest/meta-data/iam/security-credentials/":
+			assert.Equal(t, "imds-token", r.Header.Get("X-Aws-Ec2-Metadata-Token"))
+			fmt.Fprint(w, "receiver-role\n")
+		case "/latest/meta-data/iam/security-credentials/receiver-role":
+			fmt.Fprintf(w, `{"AccessKeyId":"ROLE","SecretAccessKey":"role-secret","Token":"role-token","Expiration":"%s"}`, expires.Format(time.RFC3339))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	defaultURL := awsMetadataURL
+	awsMetadataURL = server.URL
+	defer func() { awsMetadataURL = defaultURL }()
+	creds, err = (&awsCredentialProvider{}).get()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, awsCredentials{AccessKey: "ROLE", SecretKey: "role-secret", SessionToken: "role-token", Expires: expires}, creds)
+}
@@ -0,0 +1,101 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// B3 headers
+const (
+	b3Single  = "b3"
+	b3TraceID = "x-b3-traceid"
+	b3SpanID  = "x-b3-spanid"
+	b3Sampled = "x-b3-sampled"
+	b3Flags   = "x-b3-flags"
+)
+
+// b3Propagator extracts the trace context propagated through the Zipkin B3 headers, either the single b3 header
+// ({trace-id}-{span-id}[-{sampling}[-{parent-span-id}]]) or the multiple X-B3-* headers, matching their names case-insensitively.
+// The W3C trace context takes precedence, so the B3 headers are ignored when the context already has a valid span.
+// The context is injected through the single b3 header.
+type b3Propagator struct{}
+
+var _ propagation.TextMapPropagator = b3Propagator{}
+
+// Inject Sets the single b3 header with the span context of a context, if any.
+func (b3Propagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := oteltrace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	sampled := "0"
+	if sc.IsSampled() {
+		sampled = "1"
+	}
+	carrier.Set(b3Single, sc.TraceID().String()+"-"+sc.SpanID().String()+"-"+sampled)
+}
+
+// Extract Returns a context with the remote span context from the B3 headers of a carrier, or the context as is when they are missing or invalid.
+func (b3Propagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	if oteltrace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	headers := make(map[string]string)
+	for _, key := range carrier.Keys() {
+		if name := strings.ToLower(key); name == b3Single || strings.HasPrefix(name, "x-b3-") {
+			headers[name] = carrier.Get(key)
+		}
+	}
+	var traceID, spanID, sampling string
+	if single := headers[b3Single]; single != "" {
+		parts := strings.Split(single, "-")
+		if len(parts) < 2 {
+			return ctx // Only the sampling decision
+		}
+		traceID, spanID = parts[0], parts[1]
+		if len(parts) > 2 {
+			sampling = parts[2]
+		}
+	} else {
+		traceID, spanID, sampling = headers[b3TraceID], headers[b3SpanID], headers[b3Sampled]
+		if headers[b3Flags] == "1" {
+			sampling = "d"
+		}
+	}
+	if sc, ok := b3SpanContext(traceID, spanID, sampling); ok {
+		return oteltrace.ContextWithRemoteSpanContext(ctx, sc)
+	}
+	return ctx
+}
+
+// Fields Returns the headers used by the propagator.
+func (b3Propagator) Fields() []string {
+	return []string{b3Single, b3TraceID, b3SpanID, b3Sampled, b3Flags}
+}
+
+// b3SpanContext Builds a span context from the B3 identifiers, padding the 64-bit trace IDs.
+// The sampling is accepted as 1, true or d (debug) for sampled traces.
+func b3SpanContext(traceID, spanID, sampling string) (oteltrace.SpanContext, bool) {
+	if len(traceID) == 16 {
+		traceID = strings.Repeat("0", 16) + traceID
+	}
+	tid, err := oteltrace.TraceIDFromHex(strings.ToLower(traceID))
+	if err != nil {
+		return oteltrace.SpanContext{}, false
+	}
+	sid, err := oteltrace.SpanIDFromHex(strings.ToLower(spanID))
+	if err != nil {
+		return oteltrace.SpanContext{}, false
+	}
+	config := oteltrace.SpanContextConfig{TraceID: tid, SpanID: sid, Remote: true}
+	switch strings.ToLower(sampling) {
+	case "1", "true", "d":
+		config.TraceFlags = oteltrace.FlagsSampled
+	}
+	return oteltrace.NewSpanContext(config), true
+}
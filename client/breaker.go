@@ -0,0 +1,189 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"    // The messages are consumed normally.
+	BreakerOpen     = "open"      // The consumption is paused, as the outputs are failing or too slow.
+	BreakerHalfOpen = "half-open" // The consumption is resumed to probe the outputs, which closes or reopens the circuit.
+)
+
+// CircuitBreaker pauses the consumption when the outputs fail or are too slow, instead of retrying against a broken destination.
+// Only the retryable failures are considered, as the permanent ones are caused by the messages, not the destination.
+type CircuitBreaker struct {
+	ErrorRate   float64       // The fraction of failed sends within the window that opens the circuit (0 to disable).
+	Latency     time.Duration // The average send latency within the window that opens the circuit (0 to disable).
+	Window      time.Duration // The period to evaluate the sends (defaults to 30 seconds).
+	MinRequests int           // The minimum number of sends within the window to evaluate them (defaults to 10).
+	OpenTimeout time.Duration // How long the circuit stays open before probing the outputs (defaults to 30 seconds).
+	Probes      int           // The number of successful sends while half-open to close the circuit (defaults to 3).
+}
+
+// Enabled Returns true when at least one of the thresholds is set.
+func (cb CircuitBreaker) Enabled() bool {
+	return cb.ErrorRate > 0 || cb.Latency > 0
+}
+
+// validateCircuitBreaker Verifies the circuit breaker settings, applying defaults when necessary.
+func (cli *KafkaClient) validateCircuitBreaker() error {
+	cb := &cli.CircuitBreaker
+	if !cb.Enabled() {
+		return nil
+	}
+	if cb.ErrorRate < 0 || cb.ErrorRate > 1 {
+		return fmt.Errorf("invalid circuit breaker error rate %g; expecting a value between 0 and 1", cb.ErrorRate)
+	}
+	if cb.Window <= 0 {
+		cb.Window = 30 * time.Second
+	}
+	if cb.MinRequests <= 0 {
+		cb.MinRequests = 10
+	}
+	if cb.OpenTimeout <= 0 {
+		cb.OpenTimeout = 30 * time.Second
+	}
+	if cb.Probes <= 0 {
+		cb.Probes = 3
+	}
+	return nil
+}
+
+// circuitBreaker tracks the results of the outputs, and blocks the poll loop while the circuit is open.
+// This is a concurrent safe object.
+type circuitBreaker struct {
+	config CircuitBreaker
+
+	mutex       sync.Mutex
+	state       string
+	windowStart time.Time
+	requests    int
+	failures    int
+	latency     time.Duration
+	openedAt    time.Time
+	probes      int
+
+	onChange func(state, reason string) // Executed on each transition, holding the lock.
+}
+
+// newCircuitBreaker creates a new circuit breaker, or returns nil when it is disabled.
+func newCircuitBreaker(config CircuitBreaker) *circuitBreaker {
+	if !config.Enabled() {
+		return nil
+	}
+	return &circuitBreaker{config: config, state: BreakerClosed}
+}
+
+// BreakerState Returns the state of the circuit breaker: closed, open or half-open; or an empty string when it is disabled.
+func (cli *KafkaClient) BreakerState() string {
+	return cli.breaker.current()
+}
+
+// current Returns the current state, or an empty string when the breaker is disabled.
+func (b *circuitBreaker) current() string {
+	if b == nil {
+		return ""
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state
+}
+
+// record Tracks the result of sending a message to an output, opening or closing the circuit when necessary.
+func (b *circuitBreaker) record(failed bool, latency time.Duration, now time.Time) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.state {
+	case BreakerOpen: // Results of the messages in flight when the circuit opened
+	case BreakerHalfOpen:
+		if failed || (b.config.Latency > 0 && latency > b.config.Latency) {
+			b.open(now, fmt.Sprintf("probe failed after %s", latency))
+			return
+		}
+		b.probes++
+		if b.probes >= b.config.Probes {
+			b.transition(BreakerClosed, fmt.Sprintf("%d successful probes", b.probes))
+			b.reset(now)
+		}
+	default:
+		if now.Sub(b.windowStart) > b.config.Window {
+			b.reset(now)
+		}
+		b.requests++
+		b.latency += latency
+		if failed {
+			b.failures++
+		}
+		if b.requests < b.config.MinRequests {
+			return
+		}
+		rate := float64(b.failures) / float64(b.requests)
+		average := b.latency / time.Duration(b.requests)
+		if b.config.ErrorRate > 0 && rate >= b.config.ErrorRate {
+			b.open(now, fmt.Sprintf("%d of %d sends failed", b.failures, b.requests))
+		} else if b.config.Latency > 0 && average > b.config.Latency {
+			b.open(now, fmt.Sprintf("average latency of %s over %d sends", average, b.requests))
+		}
+	}
+}
+
+// open Opens the circuit; it must be called holding the lock.
+func (b *circuitBreaker) open(now time.Time, reason string) {
+	b.openedAt = now
+	b.transition(BreakerOpen, reason)
+}
+
+// reset Starts a new evaluation window; it must be called holding the lock.
+func (b *circuitBreaker) reset(now time.Time) {
+	b.windowStart = now
+	b.requests = 0
+	b.failures = 0
+	b.latency = 0
+	b.probes = 0
+}
+
+// transition Changes the state; it must be called holding the lock.
+func (b *circuitBreaker) transition(state, reason string) {
+	b.state = state
+	if b.onChange != nil {
+		b.onChange(state, reason)
+	}
+}
+
+// wait Blocks while the circuit is open, or until the done channel is closed.
+// Once the open timeout elapses, the circuit becomes half-open so the next messages probe the outputs.
+// Returns true if the consumption can continue.
+func (b *circuitBreaker) wait(done <-chan struct{}) bool {
+	if b == nil {
+		return true
+	}
+	for {
+		b.mutex.Lock()
+		if b.state != BreakerOpen {
+			b.mutex.Unlock()
+			return true
+		}
+		remaining := time.Until(b.openedAt.Add(b.config.OpenTimeout))
+		if remaining <= 0 {
+			b.probes = 0
+			b.transition(BreakerHalfOpen, "probing the outputs")
+			b.mutex.Unlock()
+			return true
+		}
+		b.mutex.Unlock()
+		select {
+		case <-time.After(remaining):
+		case <-done:
+			return false
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	cli := &KafkaClient{CircuitBreaker: CircuitBreaker{ErrorRate: 0.5, Latency: time.Second, OpenTimeout: 10 * time.Millisecond}}
+	assert.NilError(t, cli.validateCircuitBreaker())
+	assert.Equal(t, 10, cli.CircuitBreaker.MinRequests)
+	assert.Equal(t, 3, cli.CircuitBreaker.Probes)
+	b := newCircuitBreaker(cli.CircuitBreaker)
+	var states []string
+	b.onChange = func(state, reason string) {
+		states = append(states, state)
+	}
+
+	// Opens by error rate once the minimum number of requests is reached
+	now := time.Now()
+	for i := 0; i < 9; i++ {
+		b.record(true, time.Millisecond, now)
+	}
+	assert.Equal(t, BreakerClosed, b.current())
+	b.record(false, time.Millisecond, now)
+	assert.Equal(t, BreakerOpen, b.current())
+	assert.Assert(t, b.wait(make(chan struct{})))
+	assert.Equal(t, BreakerHalfOpen, b.current())
+
+	// A failed probe reopens the circuit, and the successful ones close it
+	b.record(false, 2*time.Second, now)
+	assert.Equal(t, BreakerOpen, b.current())
+	done := make(chan struct{})
+	close(done)
+	b.openedAt = time.Now().Add(time.Hour)
+	assert.Assert(t, !b.wait(done))
+	b.openedAt = time.Time{}
+	assert.Assert(t, b.wait(done))
+	for i := 0; i < 3; i++ {
+		b.record(false, time.Millisecond, now)
+	}
+	assert.Equal(t, BreakerClosed, b.current())
+
+	// Opens by latency, and a new window discards the previous sends
+	for i := 0; i < 9; i++ {
+		b.record(false, 2*time.Second, now)
+	}
+	b.record(false, 2*time.Second, now.Add(time.Minute))
+	assert.Equal(t, BreakerClosed, b.current())
+	for i := 0; i < 9; i++ {
+		b.record(false, 2*time.Second, now.Add(time.Minute))
+	}
+	assert.Equal(t, BreakerOpen, b.current())
+	assert.DeepEqual(t, []string{BreakerOpen, BreakerHalfOpen, BreakerOpen, BreakerHalfOpen, BreakerClosed, BreakerOpen}, states)
+
+	assert.Equal(t, "", (&KafkaClient{}).BreakerState())
+	cli.CircuitBreaker.ErrorRate = 2
+	assert.ErrorContains(t, cli.validateCircuitBreaker(), "invalid circuit breaker error rate")
+}
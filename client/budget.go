@@ -0,0 +1,151 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"sync"
+)
+
+// ByteBudget tracks the amount of in-process pending bytes to apply backpressure, including the bytes in flight,
+// i.e. the messages being processed by the workers and the outputs.
+// Consumption is paused when the pending bytes exceed the high-water mark,
+// and resumed when they drop below the low-water mark.
+type ByteBudget struct {
+	High int64 // The high-water mark in bytes (0 to disable).
+	Low  int64 // The low-water mark in bytes.
+
+	mutex    sync.Mutex
+	pending  int64
+	inflight int64
+	resumed  chan struct{} // Non-nil while paused, closed when resumed.
+	admit    chan struct{} // Non-nil while waiting to admit new messages, closed when admitted.
+
+	// OnPause is called (when defined) every time the state changes between paused and resumed.
+	OnPause func(paused bool, pending int64)
+}
+
+// NewByteBudget creates a new budget.
+// When low is not within 0 and high, 80% of high is used.
+func NewByteBudget(high, low int64) *ByteBudget {
+	if low <= 0 || low > high {
+		low = high * 8 / 10
+	}
+	return &ByteBudget{High: high, Low: low}
+}
+
+// Add accounts for new pending bytes.
+// This is a concurrent safe method.
+func (b *ByteBudget) Add(n int) {
+	b.update(int64(n), 0)
+}
+
+// Release accounts for pending bytes that are no longer in-process.
+// This is a concurrent safe method.
+func (b *ByteBudget) Release(n int) {
+	b.update(-int64(n), 0)
+}
+
+// AddInFlight accounts for new pending bytes dispatched to the workers and the outputs.
+// This is a concurrent safe method.
+func (b *ByteBudget) AddInFlight(n int) {
+	b.update(int64(n), int64(n))
+}
+
+// ReleaseInFlight accounts for pending bytes that were processed by the workers and the outputs.
+// This is a concurrent safe method.
+func (b *ByteBudget) ReleaseInFlight(n int) {
+	b.update(-int64(n), -int64(n))
+}
+
+// Admitted returns true when new messages can be processed: either the budget is not paused, or there are no bytes in flight,
+// so only processing more messages, i.e. the missing chunks of the partial messages, can release the pending bytes.
+// This is a concurrent safe method.
+func (b *ByteBudget) Admitted() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.admitted()
+}
+
+// admitted Returns true when new messages can be processed; the mutex must be locked.
+func (b *ByteBudget) admitted() bool {
+	return b.resumed == nil || b.inflight == 0
+}
+
+// whenAdmitted Returns a channel that is closed once new messages can be processed.
+func (b *ByteBudget) whenAdmitted() <-chan struct{} {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.admitted() {
+		closed := make(chan struct{})
+		close(closed)
+		return closed
+	}
+	if b.admit == nil {
+		b.admit = make(chan struct{})
+	}
+	return b.admit
+}
+
+// Pending returns the current amount of pending bytes.
+// This is a concurrent safe method.
+func (b *ByteBudget) Pending() int64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.pending
+}
+
+// Paused returns true when the pending bytes exceeded the high-water mark and haven't dropped below the low-water mark.
+// This is a concurrent safe method.
+func (b *ByteBudget) Paused() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.resumed != nil
+}
+
+// Wait blocks while the budget is paused, or until the done channel is closed.
+// Returns true if the budget is not paused.
+func (b *ByteBudget) Wait(done <-chan struct{}) bool {
+	b.mutex.Lock()
+	resumed := b.resumed
+	b.mutex.Unlock()
+	if resumed == nil {
+		return true
+	}
+	select {
+	case <-resumed:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// update Applies the changes to the pending bytes, and to the bytes in flight among them.
+func (b *ByteBudget) update(delta, inflight int64) {
+	b.mutex.Lock()
+	b.pending += delta
+	if b.pending < 0 {
+		b.pending = 0
+	}
+	b.inflight += inflight
+	if b.inflight < 0 {
+		b.inflight = 0
+	}
+	changed := false
+	if b.High > 0 && b.resumed == nil && b.pending > b.High {
+		b.resumed = make(chan struct{})
+		changed = true
+	} else if b.resumed != nil && b.pending <= b.Low {
+		close(b.resumed)
+		b.resumed = nil
+		changed = true
+	}
+	if b.admit != nil && b.admitted() {
+		close(b.admit)
+		b.admit = nil
+	}
+	paused, pending := b.resumed != nil, b.pending
+	b.mutex.Unlock()
+	if changed && b.OnPause != nil {
+		b.OnPause(paused, pending)
+	}
+}
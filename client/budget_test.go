@@ -0,0 +1,114 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"gotest.tools/v3/assert"
+)
+
+func TestByteBudget(t *testing.T) {
+	budget := NewByteBudget(100, 0)
+	assert.Equal(t, int64(80), budget.Low)
+
+	budget.Add(60)
+	assert.Assert(t, !budget.Paused())
+	budget.Add(60)
+	assert.Assert(t, budget.Paused())
+
+	// Releasing bytes above the low-water mark should keep the budget paused
+	budget.Release(30)
+	assert.Assert(t, budget.Paused())
+
+	resumed := make(chan bool)
+	go func() {
+		resumed <- budget.Wait(nil)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	budget.Release(20)
+	assert.Assert(t, <-resumed)
+	assert.Equal(t, int64(70), budget.Pending())
+}
+
+func TestByteBudgetDisabled(t *testing.T) {
+	budget := NewByteBudget(0, 0)
+	budget.Add(1000000)
+	assert.Assert(t, !budget.Paused())
+	assert.Assert(t, budget.Wait(nil))
+}
+
+func TestProcessMessageWithBudget(t *testing.T) {
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	cli.budget.High = 5
+	cli.budget.Low = 0
+	assert.Assert(t, cli.processMessage(buildMessage("0001", 0, 2, []byte("ABCDEF"))) == nil)
+	assert.Assert(t, cli.budget.Paused())
+	assert.Equal(t, "ABCDEFGHI", string(cli.processMessage(buildMessage("0001", 1, 2, []byte("GHI")))))
+	assert.Assert(t, !cli.budget.Paused())
+}
+
+func TestConsumeWithBudget(t *testing.T) {
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	cli.Parser = "heartbeat"
+	cli.Workers = 2
+	cli.budget.High = 5
+	cli.budget.Low = 0
+	chunks := make(chan *message.Message)
+	cli.msgChannel = chunks
+	done := make(chan struct{})
+	cli.done = done
+	defer close(done)
+	received := make(chan string, 10)
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		cli.consume(func(msg DecodedMessage) error {
+			if string(msg.Payload) == "blocked" {
+				<-release
+			}
+			received <- string(msg.Payload)
+			return nil
+		})
+	}()
+	next := func() string {
+		select {
+		case payload := <-received:
+			return payload
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for message")
+			return ""
+		}
+	}
+
+	// The partial messages over budget don't stop the chunks that complete them
+	chunks <- buildMessage("msg1", 0, 2, []byte("ABCDEF"))
+	waitFor(t, cli.budget.Paused)
+	chunks <- buildMessage("msg1", 1, 2, []byte("GHI"))
+	assert.Equal(t, "ABCDEFGHI", next())
+	waitFor(t, func() bool { return !cli.budget.Paused() })
+
+	// The new messages are held while the messages in flight exceed the budget, but not the chunks of the partial messages
+	chunks <- buildMessage("msg2", 0, 2, []byte("AB"))
+	chunks <- buildMessage("msg3", 0, 1, []byte("blocked"))
+	waitFor(t, cli.budget.Paused)
+	chunks <- buildMessage("msg2", 1, 2, []byte("CD"))
+	assert.Equal(t, "ABCD", next())
+	chunks <- buildMessage("msg4", 0, 1, []byte("new"))
+	select {
+	case payload := <-received:
+		t.Fatalf("message %s processed over budget", payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	assert.Equal(t, "blocked", next())
+	assert.Equal(t, "new", next())
+	close(chunks)
+	<-finished
+	assert.Equal(t, int64(0), cli.budget.Pending())
+}
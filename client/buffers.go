@@ -0,0 +1,135 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// EvictionManual is the reason of the partial messages evicted on demand through EvictPartialMessage.
+const EvictionManual = "manual"
+
+// PartialMessageInfo describes a multi-part message that is being reassembled.
+type PartialMessageInfo struct {
+	ID        string    `json:"id"`
+	Chunks    int32     `json:"chunks"` // The number of chunks received.
+	Total     int32     `json:"total"`  // The number of chunks expected.
+	Bytes     int       `json:"bytes"`  // The size of the content received.
+	Age       string    `json:"age"`    // The time elapsed since the first chunk arrived.
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Topic     string    `json:"topic"`
+	Partition int32     `json:"partition"` // The Kafka partition of the first chunk, or -1 when unknown.
+	Offset    int64     `json:"offset"`    // The Kafka offset of the first chunk, or -1 when unknown.
+}
+
+// PartialMessages Returns the messages in the reassembly buffer, the oldest first.
+// This is a concurrent safe method.
+func (cli *KafkaClient) PartialMessages() []PartialMessageInfo {
+	if cli.mutex == nil {
+		return []PartialMessageInfo{}
+	}
+	now := time.Now()
+	cli.mutex.RLock()
+	infos := make([]PartialMessageInfo, 0, len(cli.msgBuffer))
+	for id, partial := range cli.msgBuffer {
+		infos = append(infos, PartialMessageInfo{
+			ID:        id,
+			Chunks:    partial.chunk,
+			Total:     partial.total,
+			Bytes:     partial.size,
+			Age:       now.Sub(partial.firstSeen).Truncate(time.Millisecond).String(),
+			FirstSeen: partial.firstSeen,
+			LastSeen:  partial.lastSeen,
+			Topic:     partial.topic,
+			Partition: partial.partition,
+			Offset:    partial.offset,
+		})
+	}
+	cli.mutex.RUnlock()
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].FirstSeen.Equal(infos[j].FirstSeen) {
+			return infos[i].ID < infos[j].ID
+		}
+		return infos[i].FirstSeen.Before(infos[j].FirstSeen)
+	})
+	return infos
+}
+
+// EvictPartialMessage Removes a message from the reassembly buffer, discarding the chunks received so far.
+// Returns false when the message is not in the buffer.
+// This is a concurrent safe method.
+func (cli *KafkaClient) EvictPartialMessage(id string) bool {
+	if cli.mutex == nil {
+		return false
+	}
+	cli.mutex.Lock()
+	partial, ok := cli.msgBuffer[id]
+	if ok {
+		cli.discardPartial(id, partial)
+	}
+	cli.mutex.Unlock()
+	if !ok {
+		return false
+	}
+	cli.logger().Warnf("evicting message %s on demand, received %d of %d chunks since %s", id, partial.chunk, partial.total, partial.firstSeen.Format(time.RFC3339))
+	cli.trace(id, "partial message evicted (%s)", EvictionManual)
+	cli.countDroppedChunks(partial.topic, DropEvicted, partial.chunk)
+	if cli.manualEvicted != nil {
+		cli.manualEvicted.Inc()
+	}
+	if cli.OnPartialMessageEvicted != nil {
+		cli.OnPartialMessageEvicted(id, EvictionManual, partial.chunk, partial.total)
+	}
+	return true
+}
+
+// BuffersHandler returns an HTTP handler to inspect the reassembly buffer of each pipeline.
+// GET lists the partial messages, and DELETE with the id query parameter evicts a message,
+// optionally restricted to the pipeline passed through the pipeline query parameter.
+func BuffersHandler(pipelines []*Pipeline) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			type pipelineBuffer struct {
+				Name     string               `json:"name"`
+				Messages []PartialMessageInfo `json:"messages"`
+			}
+			buffers := make([]pipelineBuffer, len(pipelines))
+			for i, p := range pipelines {
+				buffers[i] = pipelineBuffer{p.Name, p.Client.PartialMessages()}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"pipelines": buffers,
+			})
+		case http.MethodDelete:
+			id := r.URL.Query().Get("id")
+			if id == "" {
+				http.Error(w, "the id parameter is required", http.StatusBadRequest)
+				return
+			}
+			name := r.URL.Query().Get("pipeline")
+			var evicted []string
+			for _, p := range pipelines {
+				if (name == "" || name == p.Name) && p.Client.EvictPartialMessage(id) {
+					evicted = append(evicted, p.Name)
+				}
+			}
+			if len(evicted) == 0 {
+				http.Error(w, "message "+id+" not found", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"id":        id,
+				"pipelines": evicted,
+			})
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
@@ -0,0 +1,65 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestBuffersHandler(t *testing.T) {
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	evicted := map[string]string{}
+	cli.OnPartialMessageEvicted = func(id, reason string, chunks, total int32) {
+		evicted[id] = reason
+	}
+	assert.Assert(t, cli.processMessage(buildMessage("0001", 0, 3, []byte("ABC"))) == nil)
+	assert.Assert(t, cli.processMessage(buildMessage("0001", 1, 3, []byte("DEF"))) == nil)
+	assert.Assert(t, cli.processMessage(buildMessage("0002", 0, 2, []byte("ABC"))) == nil)
+	handler := BuffersHandler([]*Pipeline{
+		NewPipeline("traps", cli, nil),
+		NewPipeline("idle", &KafkaClient{}, nil), // Not initialized
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/buffers", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var buffers struct {
+		Pipelines []struct {
+			Name     string               `json:"name"`
+			Messages []PartialMessageInfo `json:"messages"`
+		} `json:"pipelines"`
+	}
+	assert.NilError(t, json.NewDecoder(rec.Body).Decode(&buffers))
+	assert.Equal(t, 2, len(buffers.Pipelines))
+	assert.Equal(t, 0, len(buffers.Pipelines[1].Messages))
+	messages := buffers.Pipelines[0].Messages
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, "0001", messages[0].ID)
+	assert.Equal(t, int32(2), messages[0].Chunks)
+	assert.Equal(t, int32(3), messages[0].Total)
+	assert.Equal(t, 6, messages[0].Bytes)
+	assert.Equal(t, "0002", messages[1].ID)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/buffers", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/buffers?id=0001&pipeline=idle", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/buffers?id=0001", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.DeepEqual(t, map[string]string{"0001": EvictionManual}, evicted)
+	assert.Equal(t, 1, len(cli.PartialMessages()))
+	assert.Equal(t, int64(3), cli.budget.Pending())
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/buffers", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,245 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// CaptureRecord represents a raw Kafka record, as stored on capture files.
+// Capture files contain one JSON record per line.
+type CaptureRecord struct {
+	Topic     string    `json:"topic"`
+	Partition int32     `json:"partition"`
+	Offset    int64     `json:"offset"`
+	Timestamp time.Time `json:"timestamp"`
+	Key       []byte    `json:"key,omitempty"`
+	Value     []byte    `json:"value"`
+}
+
+// Coordinates Returns the Kafka coordinates of the record as topic/partition@offset.
+func (rec *CaptureRecord) Coordinates() string {
+	return fmt.Sprintf("%s/%d@%d", rec.Topic, rec.Partition, rec.Offset)
+}
+
+// CaptureWriter writes records to a capture file.
+// This is a concurrent safe object.
+type CaptureWriter struct {
+	mutex   sync.Mutex
+	file    *os.File
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	count   int
+}
+
+// NewCaptureWriter creates a new capture file, or appends to an existing one.
+func NewCaptureWriter(path string) (*CaptureWriter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open capture file %s: %v", path, err)
+	}
+	writer := bufio.NewWriter(file)
+	return &CaptureWriter{file: file, writer: writer, encoder: json.NewEncoder(writer)}, nil
+}
+
+// Write Adds a record to the capture file.
+func (w *CaptureWriter) Write(rec *CaptureRecord) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.count++
+	return w.encoder.Encode(rec)
+}
+
+// Count Returns the number of records written.
+func (w *CaptureWriter) Count() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.count
+}
+
+// Close Flushes and closes the capture file.
+func (w *CaptureWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if err := w.writer.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// ReadCapture Reads all the records from a capture stream, executing the action for each of them.
+// It stops at the first error returned by the action.
+func ReadCapture(reader io.Reader, action func(rec *CaptureRecord) error) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		rec := &CaptureRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), rec); err != nil {
+			return fmt.Errorf("invalid record at line %d: %v", line, err)
+		}
+		if err := action(rec); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// ReadCaptureFile Reads all the records from a capture file, executing the action for each of them.
+func ReadCaptureFile(path string, action func(rec *CaptureRecord) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot open capture file %s: %v", path, err)
+	}
+	defer file.Close()
+	return ReadCapture(file, action)
+}
+
+// TopicRange defines a bounded range of messages from a Kafka topic.
+type TopicRange struct {
+	Bootstrap string    // The Kafka Server Bootstrap string.
+	Topic     string    // The name of the Kafka Topic.
+	Since     time.Time // Start from the first message after this time (or the oldest message when zero).
+	Until     time.Time // Stop at the last message before this time (or the latest message when zero).
+
+	Parameters Properties // Additional Kafka consumer settings, i.e. security.protocol=SASL_SSL.
+	TLS        TLSConfig  // TLS settings to connect to Kafka (optional).
+	SASL       SASLConfig // SASL settings to authenticate against Kafka (optional).
+}
+
+// ScanTopic Reads a bounded range of records from all the partitions of a topic, executing the action for each of them.
+// The upper bound is the latest offset of each partition when the scan starts, so the operation always finishes.
+// It does not use consumer groups, so no offsets are committed.
+func ScanTopic(tr TopicRange, action func(rec *CaptureRecord) error) error {
+	config := sarama.NewConfig()
+	config.Version = sarama.V2_7_0_0
+	config.ClientID = "onms-kafka-ipc-receiver"
+	if err := tr.Parameters.apply(config); err != nil {
+		return err
+	}
+	if err := tr.TLS.apply(config); err != nil {
+		return err
+	}
+	if err := tr.SASL.apply(config); err != nil {
+		return err
+	}
+	client, err := sarama.NewClient([]string{tr.Bootstrap}, config)
+	if err != nil {
+		return fmt.Errorf("cannot connect to %s: %v", tr.Bootstrap, err)
+	}
+	defer client.Close()
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return fmt.Errorf("cannot create consumer: %v", err)
+	}
+	defer consumer.Close()
+	partitions, err := client.Partitions(tr.Topic)
+	if err != nil {
+		return fmt.Errorf("cannot get partitions for topic %s: %v", tr.Topic, err)
+	}
+	for _, partition := range partitions {
+		if err := scanPartition(client, consumer, tr, partition, action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanPartition Reads a bounded range of records from a given partition.
+func scanPartition(client sarama.Client, consumer sarama.Consumer, tr TopicRange, partition int32, action func(rec *CaptureRecord) error) error {
+	start := sarama.OffsetOldest
+	if !tr.Since.IsZero() {
+		start = tr.Since.UnixNano() / int64(time.Millisecond)
+	}
+	first, err := client.GetOffset(tr.Topic, partition, start)
+	if err != nil {
+		return fmt.Errorf("cannot get start offset for partition %d: %v", partition, err)
+	}
+	end, err := client.GetOffset(tr.Topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return fmt.Errorf("cannot get end offset for partition %d: %v", partition, err)
+	}
+	if first < 0 || first >= end {
+		return nil // Nothing to read
+	}
+	pc, err := consumer.ConsumePartition(tr.Topic, partition, first)
+	if err != nil {
+		return fmt.Errorf("cannot consume partition %d: %v", partition, err)
+	}
+	defer pc.Close()
+	defaultLogger.Infof("scanning partition %d of %s from offset %d to %d", partition, tr.Topic, first, end-1)
+	for msg := range pc.Messages() {
+		if !tr.Until.IsZero() && msg.Timestamp.After(tr.Until) {
+			return nil
+		}
+		rec := &CaptureRecord{
+			Topic:     msg.Topic,
+			Partition: msg.Partition,
+			Offset:    msg.Offset,
+			Timestamp: msg.Timestamp,
+			Key:       msg.Key,
+			Value:     msg.Value,
+		}
+		if err := action(rec); err != nil {
+			return err
+		}
+		if msg.Offset >= end-1 {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Prepare Initializes the internal state of the client without connecting to Kafka.
+// Required to decode records through DecodeRecord.
+func (cli *KafkaClient) Prepare() error {
+	if err := cli.Validate(); err != nil {
+		return err
+	}
+	if cli.msgBuffer == nil {
+		cli.createVariables()
+	}
+	cli.createCounters()
+	return nil
+}
+
+// DecodeRecord Processes a raw Kafka record, reassembling chunks when necessary.
+// The action is executed for each decoded message once all the chunks of the IPC message have been processed.
+func (cli *KafkaClient) DecodeRecord(rec *CaptureRecord, action func(msg DecodedMessage)) {
+	msg := message.NewMessage(watermill.NewUUID(), rec.Value)
+	defer endMessageSpan(msg)
+	parser := cli.parserFor(rec.Topic)
+	id, data := cli.reassemble(msg)
+	if data = cli.anonymize(data, parser); data != nil {
+		cli.decodePayload(data, rec.Topic, parser, func(payload []byte, meta Metadata) {
+			action(DecodedMessage{
+				Topic:     rec.Topic,
+				IPC:       cli.IPC,
+				Parser:    parser,
+				Partition: rec.Partition,
+				Offset:    rec.Offset,
+				Timestamp: rec.Timestamp,
+				Metadata:  meta,
+				Key:       rec.Key,
+				Received:  time.Now(),
+				Payload:   payload,
+			})
+		})
+		cli.processed(id)
+	}
+}
@@ -0,0 +1,50 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/sink"
+	"google.golang.org/protobuf/proto"
+	"gotest.tools/v3/assert"
+)
+
+func TestCaptureRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	writer, err := NewCaptureWriter(path)
+	assert.NilError(t, err)
+	for i, chunk := range []string{"ABC", "DEF"} {
+		bytes, _ := proto.Marshal(&sink.SinkMessage{
+			MessageId:          "0001",
+			CurrentChunkNumber: int32(i),
+			TotalChunks:        2,
+			Content:            []byte(chunk),
+		})
+		assert.NilError(t, writer.Write(&CaptureRecord{
+			Topic:     "OpenNMS.Sink.Heartbeat",
+			Partition: 3,
+			Offset:    int64(100 + i),
+			Timestamp: time.Now(),
+			Value:     bytes,
+		}))
+	}
+	assert.Equal(t, 2, writer.Count())
+	assert.NilError(t, writer.Close())
+
+	cli := &KafkaClient{Topic: "OpenNMS.Sink.Heartbeat", GroupID: "capture-test", Parser: "heartbeat"}
+	assert.NilError(t, cli.Prepare())
+	var decoded []DecodedMessage
+	err = ReadCaptureFile(path, func(rec *CaptureRecord) error {
+		cli.DecodeRecord(rec, func(msg DecodedMessage) {
+			decoded = append(decoded, msg)
+		})
+		return nil
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(decoded))
+	assert.Equal(t, "ABCDEF", string(decoded[0].Payload))
+	assert.Equal(t, "OpenNMS.Sink.Heartbeat/3@101", decoded[0].Coordinates())
+}
@@ -0,0 +1,106 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// Metadata represents the details extracted from a decoded message, useful for filtering and routing.
+type Metadata struct {
+	Location      string `json:"location,omitempty"`      // The location of the Minion that forwarded the message.
+	SystemID      string `json:"systemId,omitempty"`      // The ID of the Minion that forwarded the message.
+	SourceAddress string `json:"sourceAddress,omitempty"` // The IP address of the device that sent the message.
+}
+
+// DecodedMessage represents a fully reassembled and decoded IPC message.
+type DecodedMessage struct {
+	Topic     string            `json:"topic"`
+	IPC       string            `json:"ipc"`
+	Parser    string            `json:"parser"`
+	Partition int32             `json:"partition"`
+	Offset    int64             `json:"offset"`
+	Timestamp time.Time         `json:"timestamp"` // The Kafka timestamp of the last chunk.
+	Metadata  Metadata          `json:"metadata"`
+	Headers   map[string]string `json:"headers,omitempty"` // The Kafka headers of the last chunk.
+	Key       []byte            `json:"key,omitempty"`     // The Kafka key of the last chunk.
+	Received  time.Time         `json:"received"`          // When the message was reassembled and decoded.
+	Payload   []byte            `json:"payload"`
+
+	id          string                // The ID of the IPC message, used for tracing.
+	spanContext oteltrace.SpanContext // The span of the reassembled message, used as the parent of the output spans.
+}
+
+// Coordinates Returns the Kafka coordinates of the message as topic/partition@offset.
+// For multi-part messages, those are the coordinates of the last chunk.
+func (msg DecodedMessage) Coordinates() string {
+	return fmt.Sprintf("%s/%d@%d", msg.Topic, msg.Partition, msg.Offset)
+}
+
+// SpanContext Returns the OpenTelemetry span of the reassembled message, which continues the trace propagated by the producer, if any.
+// Actions can use it as the parent of their own spans; it is not valid when the tracing is disabled.
+func (msg DecodedMessage) SpanContext() oteltrace.SpanContext {
+	return msg.spanContext
+}
+
+// Envelope Returns the JSON envelope of the message, with its Kafka coordinates, key, headers and timestamps, and its metadata.
+// The payload is embedded when it is valid JSON, or added as content in base64 otherwise; this is the format used by the json forward format.
+func (msg DecodedMessage) Envelope() ([]byte, error) {
+	return json.Marshal(newForwardEnvelope(msg))
+}
+
+// newDecodedMessage Builds a decoded message from the source Kafka message and the decoded payload.
+func (cli *KafkaClient) newDecodedMessage(msg *message.Message, data []byte) DecodedMessage {
+	topic := cli.topicOf(msg)
+	decoded := DecodedMessage{
+		Topic:     topic,
+		IPC:       cli.IPC,
+		Parser:    cli.parserFor(topic),
+		Partition: -1,
+		Offset:    -1,
+		Received:  time.Now(),
+		Payload:   data,
+	}
+	if msg == nil {
+		return decoded
+	}
+	decoded.Headers = kafkaHeaders(msg)
+	md := recordMetadata(msg)
+	decoded.Partition = md.Partition
+	decoded.Offset = md.Offset
+	decoded.Timestamp = md.Timestamp
+	decoded.Key = md.Key
+	return decoded
+}
+
+// Messages Starts consuming in the background, and returns a channel with the decoded messages.
+// This is an alternative to Start, so only one of them should be used.
+//
+// The Kafka message is committed once all its decoded messages are received from the channel.
+// When MessageBuffer is greater than zero, the commit happens once they are added to the buffer,
+// so buffered messages could be lost if the application crashes before processing them.
+// The channel is closed when the client is stopped.
+func (cli *KafkaClient) Messages() <-chan DecodedMessage {
+	if cli.msgChannel == nil {
+		log.Fatal("consumer not initialized")
+	}
+	out := make(chan DecodedMessage, cli.MessageBuffer)
+	done := cli.done
+	go func() {
+		defer close(out)
+		cli.consume(func(msg DecodedMessage) error {
+			select {
+			case out <- msg:
+			case <-done:
+			}
+			return nil
+		})
+	}()
+	return out
+}
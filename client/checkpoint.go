@@ -0,0 +1,324 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// checkpointInterval is how often the reassembly checkpoint is refreshed.
+const checkpointInterval = 5 * time.Second
+
+// replayTimeout is how long to wait for a record while replaying a partition.
+const replayTimeout = 10 * time.Second
+
+// checkpointEntry represents the lowest offset that cannot be considered processed within a partition,
+// meaning the offset of the first chunk of the oldest partial message.
+type checkpointEntry struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+// reassemblyCheckpoint persists the lowest uncommittable offset of each partition.
+// The Kafka consumer holds back the committed offsets to the same values, so the replay is only needed when the committed offsets
+// went beyond them, i.e. when they were committed by an earlier version or by a custom source.
+// It must be used while holding the lock of the reassembly buffer.
+type reassemblyCheckpoint struct {
+	path    string
+	offsets map[TopicPartition]int64
+}
+
+// openReassemblyCheckpoint Loads the reassembly checkpoint from a file, which is created when it doesn't exist.
+func openReassemblyCheckpoint(path string) (*reassemblyCheckpoint, error) {
+	c := &reassemblyCheckpoint{path: path, offsets: make(map[TopicPartition]int64)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, c.save()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read reassembly checkpoint %s: %v", path, err)
+	}
+	entries := []checkpointEntry{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid reassembly checkpoint %s: %v", path, err)
+	}
+	for _, e := range entries {
+		c.offsets[TopicPartition{e.Topic, e.Partition}] = e.Offset
+	}
+	return c, nil
+}
+
+// entries Returns the content of the checkpoint sorted by topic and partition.
+func (c *reassemblyCheckpoint) entries() []checkpointEntry {
+	entries := make([]checkpointEntry, 0, len(c.offsets))
+	for tp, offset := range c.offsets {
+		entries = append(entries, checkpointEntry{tp.Topic, tp.Partition, offset})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Topic == entries[j].Topic {
+			return entries[i].Partition < entries[j].Partition
+		}
+		return entries[i].Topic < entries[j].Topic
+	})
+	return entries
+}
+
+// save Writes the checkpoint to disk through a temporary file, so it is never left incomplete.
+func (c *reassemblyCheckpoint) save() error {
+	data, err := json.Marshal(c.entries())
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("cannot write reassembly checkpoint %s: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("cannot write reassembly checkpoint %s: %v", c.path, err)
+	}
+	return nil
+}
+
+// track Persists the offset of the first chunk of a new partial message, when its partition has no pending messages.
+// As the chunks of a partition are processed in order, the checkpoint is only behind when a partition already has an entry,
+// which is safe, as it only means more records will be replayed; the checkpoint is written before the chunk is acknowledged.
+func (c *reassemblyCheckpoint) track(partial *partialMessage) error {
+	if c == nil || partial.partition < 0 || partial.offset < 0 {
+		return nil
+	}
+	tp := TopicPartition{partial.topic, partial.partition}
+	if _, ok := c.offsets[tp]; ok {
+		return nil
+	}
+	c.offsets[tp] = partial.offset
+	return c.save()
+}
+
+// update Replaces the content of the checkpoint with the given offsets, writing it only when there are changes.
+func (c *reassemblyCheckpoint) update(offsets map[TopicPartition]int64) error {
+	if c == nil {
+		return nil
+	}
+	changed := len(offsets) != len(c.offsets)
+	for tp, offset := range offsets {
+		if current, ok := c.offsets[tp]; !ok || current != offset {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	c.offsets = offsets
+	return c.save()
+}
+
+// pendingOffsets Returns the lowest offset of the partial messages of each partition.
+// Must be called while holding the lock.
+func (cli *KafkaClient) pendingOffsets() map[TopicPartition]int64 {
+	offsets := make(map[TopicPartition]int64)
+	for _, partial := range cli.msgBuffer {
+		if partial.partition < 0 || partial.offset < 0 {
+			continue
+		}
+		tp := TopicPartition{partial.topic, partial.partition}
+		if current, ok := offsets[tp]; !ok || partial.offset < current {
+			offsets[tp] = partial.offset
+		}
+	}
+	return offsets
+}
+
+// committableOffset Returns the offset to commit for a partition after processing the records before the next one,
+// held back to the first chunk of the oldest partial message of the partition, so its chunks are consumed again after a restart.
+// This is a concurrent safe method.
+func (cli *KafkaClient) committableOffset(tp TopicPartition, next int64) int64 {
+	cli.mutex.RLock()
+	defer cli.mutex.RUnlock()
+	for _, partial := range cli.msgBuffer {
+		if partial.topic == tp.Topic && partial.partition == tp.Partition && partial.offset >= 0 && partial.offset < next {
+			next = partial.offset
+		}
+	}
+	return next
+}
+
+// UncommittableOffsets Returns the offset of the first chunk of the oldest partial message of each partition.
+// Those are the offsets a consumer should restart from to avoid losing the pending partial messages.
+// This is a concurrent safe method.
+func (cli *KafkaClient) UncommittableOffsets() map[TopicPartition]int64 {
+	cli.mutex.RLock()
+	defer cli.mutex.RUnlock()
+	return cli.pendingOffsets()
+}
+
+// reassemblyCheckpoint Returns the current reassembly checkpoint, or nil when it is not enabled.
+// This is a concurrent safe method.
+func (cli *KafkaClient) reassemblyCheckpoint() *reassemblyCheckpoint {
+	cli.mutex.RLock()
+	defer cli.mutex.RUnlock()
+	return cli.checkpoint
+}
+
+// refreshCheckpoint Updates the current reassembly checkpoint, if any, with the current partial messages.
+// This is a concurrent safe method.
+func (cli *KafkaClient) refreshCheckpoint() {
+	cli.mutex.Lock()
+	defer cli.mutex.Unlock()
+	if cli.checkpoint == nil {
+		return
+	}
+	if err := cli.checkpoint.update(cli.pendingOffsets()); err != nil {
+		cli.logger().Errorf("cannot update reassembly checkpoint: %v", err)
+	}
+}
+
+// runCheckpoint Refreshes a reassembly checkpoint periodically, until the done channel is closed.
+// It receives the checkpoint of the current run, as a restarting pipeline replaces it while the previous run is stopping.
+// It does nothing when the checkpoint is not enabled.
+func (cli *KafkaClient) runCheckpoint(done <-chan struct{}, checkpoint *reassemblyCheckpoint) {
+	if checkpoint == nil {
+		return
+	}
+	ticker := time.NewTicker(checkpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			cli.mutex.Lock()
+			if err := checkpoint.update(cli.pendingOffsets()); err != nil {
+				cli.logger().Errorf("cannot update reassembly checkpoint: %v", err)
+			}
+			cli.mutex.Unlock()
+		case <-done:
+			return
+		}
+	}
+}
+
+// recoverPartialMessages Rebuilds the partial messages that were pending when the client stopped, based on the reassembly checkpoint.
+// For each partition, the records between the checkpoint and the committed offset of the consumer group are replayed through the reassembly buffer,
+// discarding the messages completed within that range, as they were already delivered.
+// The consumer group continues from the committed offsets, which completes the recovered messages.
+func (cli *KafkaClient) recoverPartialMessages(config *sarama.Config) error {
+	if cli.ReassemblyCheckpoint == "" {
+		cli.mutex.Lock()
+		cli.checkpoint = nil
+		cli.mutex.Unlock()
+		return nil
+	}
+	checkpoint, err := openReassemblyCheckpoint(cli.ReassemblyCheckpoint)
+	if err != nil {
+		return err
+	}
+	entries := checkpoint.entries()
+	cli.mutex.Lock()
+	cli.checkpoint = checkpoint
+	cli.mutex.Unlock()
+	if len(entries) == 0 {
+		return nil
+	}
+	client, err := sarama.NewClient([]string{cli.Bootstrap}, config)
+	if err != nil {
+		return fmt.Errorf("cannot connect to %s: %v", cli.Bootstrap, err)
+	}
+	defer client.Close()
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		return fmt.Errorf("cannot create cluster admin: %v", err)
+	}
+	topics := make(map[string][]int32)
+	for _, e := range entries {
+		topics[e.Topic] = append(topics[e.Topic], e.Partition)
+	}
+	committed, err := admin.ListConsumerGroupOffsets(cli.GroupID, topics)
+	if err != nil {
+		return fmt.Errorf("cannot get the offsets of group %s: %v", cli.GroupID, err)
+	}
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return fmt.Errorf("cannot create consumer: %v", err)
+	}
+	defer consumer.Close()
+	for _, e := range entries {
+		block := committed.GetBlock(e.Topic, e.Partition)
+		if block == nil || block.Offset <= e.Offset {
+			continue // The consumer group will read the chunks again
+		}
+		if err := cli.replayPartition(client, consumer, e, block.Offset); err != nil {
+			cli.logger().Errorf("cannot recover partial messages from partition %d of %s: %v", e.Partition, e.Topic, err)
+		}
+	}
+	cli.logger().Infof("recovered %d partial messages from the reassembly checkpoint", cli.pendingMessages())
+	return nil
+}
+
+// replayPartition Replays the records of a partition from the checkpoint up to the committed offset (exclusive) through the reassembly buffer.
+func (cli *KafkaClient) replayPartition(client sarama.Client, consumer sarama.Consumer, e checkpointEntry, committed int64) error {
+	first, err := client.GetOffset(e.Topic, e.Partition, sarama.OffsetOldest)
+	if err != nil {
+		return fmt.Errorf("cannot get start offset: %v", err)
+	}
+	if first < e.Offset {
+		first = e.Offset
+	}
+	if first >= committed {
+		return nil
+	}
+	pc, err := consumer.ConsumePartition(e.Topic, e.Partition, first)
+	if err != nil {
+		return fmt.Errorf("cannot consume partition: %v", err)
+	}
+	defer pc.Close()
+	cli.logger().Infof("replaying partition %d of %s from offset %d to %d", e.Partition, e.Topic, first, committed-1)
+	for {
+		select {
+		case msg := <-pc.Messages():
+			cli.replayChunk(msg.Topic, msg.Partition, msg.Offset, msg.Value)
+			if msg.Offset >= committed-1 {
+				return nil
+			}
+		case err := <-pc.Errors():
+			return err
+		case <-time.After(replayTimeout):
+			return fmt.Errorf("timeout waiting for records")
+		}
+	}
+}
+
+// replayChunk Processes a replayed record through the reassembly buffer.
+// The message is discarded when it is complete, as it was processed before the checkpoint was taken.
+func (cli *KafkaClient) replayChunk(topic string, partition int32, offset int64, value []byte) {
+	msg := message.NewMessage(watermill.NewUUID(), value)
+	msg.SetContext(context.WithValue(msg.Context(), topicContextKey{}, topic))
+	ipcmsg, err := cli.getIpcMessage(msg)
+	if err != nil {
+		cli.logger().Warnf("invalid IPC message at %s/%d@%d: %v", topic, partition, offset, err)
+		return
+	}
+	ipcmsg.partition = partition
+	ipcmsg.offset = offset
+	if ipcmsg.chunk == ipcmsg.total {
+		cli.bufferCleanup(ipcmsg.id)
+		return
+	}
+	cli.bufferChunk(ipcmsg)
+}
+
+// pendingMessages Returns the number of partial messages in the reassembly buffer.
+// This is a concurrent safe method.
+func (cli *KafkaClient) pendingMessages() int {
+	cli.mutex.RLock()
+	defer cli.mutex.RUnlock()
+	return len(cli.msgBuffer)
+}
@@ -0,0 +1,48 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestReassemblyCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	checkpoint, err := openReassemblyCheckpoint(path)
+	assert.NilError(t, err)
+	cli.checkpoint = checkpoint
+
+	// Replay the records of partition 0 up to the committed offset: m1 was completed, m2 and m3 are pending
+	cli.replayChunk("Test", 0, 10, buildMessage("m1", 0, 2, []byte("A")).Payload)
+	cli.replayChunk("Test", 0, 11, buildMessage("m2", 0, 2, []byte("B")).Payload)
+	cli.replayChunk("Test", 0, 12, buildMessage("m1", 1, 2, []byte("A")).Payload)
+	cli.replayChunk("Test", 0, 13, buildMessage("m3", 0, 3, []byte("C")).Payload)
+	cli.replayChunk("Test", 1, 5, buildMessage("m4", 0, 2, []byte("D")).Payload)
+	assert.Equal(t, 3, cli.pendingMessages())
+	assert.DeepEqual(t, map[TopicPartition]int64{{"Test", 0}: 11, {"Test", 1}: 5}, cli.UncommittableOffsets())
+
+	// The checkpoint is behind until refreshed, which is safe
+	reloaded, err := openReassemblyCheckpoint(path)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []checkpointEntry{{"Test", 0, 10}, {"Test", 1, 5}}, reloaded.entries())
+
+	// Chunks without Kafka coordinates are not tracked
+	assert.Assert(t, cli.processMessage(buildMessage("m2", 1, 2, []byte("B"))) != nil)
+	assert.Assert(t, cli.processMessage(buildMessage("m5", 0, 2, []byte("E"))) == nil)
+	cli.refreshCheckpoint()
+	reloaded, err = openReassemblyCheckpoint(path)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []checkpointEntry{{"Test", 0, 13}, {"Test", 1, 5}}, reloaded.entries())
+
+	cli.bufferCleanup("m3")
+	cli.bufferCleanup("m4")
+	cli.refreshCheckpoint()
+	reloaded, err = openReassemblyCheckpoint(path)
+	assert.NilError(t, err)
+	assert.Equal(t, 0, len(reloaded.entries()))
+}
@@ -0,0 +1,201 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// chunkStoreExtension is the extension of the files with the content of the partial messages.
+const chunkStoreExtension = ".chunks"
+
+var (
+	// chunkStoreBytes tracks the content held by the disk chunk stores.
+	chunkStoreBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "onms_ipc_chunk_store_bytes",
+		Help: "The number of bytes of the partial messages held by a disk chunk store, by directory",
+	}, []string{"dir"})
+	// chunkStoreMessages tracks the partial messages held by the disk chunk stores.
+	chunkStoreMessages = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "onms_ipc_chunk_store_messages",
+		Help: "The number of partial messages held by a disk chunk store, by directory",
+	}, []string{"dir"})
+)
+
+// ChunkStore holds the content of the partial messages while their chunks arrive, replacing the reassembly buffer in memory.
+// The chunks of each message are appended in order; the content is retrieved once the last chunk arrives, and deleted afterwards,
+// or when the message is evicted. The implementations must be concurrent safe.
+type ChunkStore interface {
+	// Append Adds the content of a chunk to a message; fails when the chunk cannot be stored, for instance due to the limits of the store.
+	Append(id string, data []byte) error
+	// Content Returns the content received so far of a message.
+	Content(id string) ([]byte, error)
+	// Delete Discards the content of a message; it does nothing when the message is unknown.
+	Delete(id string) error
+}
+
+// DiskChunkStore is a ChunkStore backed by a directory with a file per message, so very large multi-part messages,
+// like big flow batches, don't exhaust the heap. The bytes and messages held are tracked by the onms_ipc_chunk_store_bytes
+// and onms_ipc_chunk_store_messages metrics.
+// This is a concurrent safe object.
+type DiskChunkStore struct {
+	Dir         string // The directory for the files, which is created if necessary.
+	MaxBytes    int64  // The maximum number of bytes held by the store (0 for unlimited).
+	MaxMessages int    // The maximum number of messages held by the store (0 for unlimited).
+
+	mutex sync.Mutex
+	sizes map[string]int64
+	total int64
+	temp  bool // Whether the directory was created by NewDiskChunkStore.
+}
+
+// NewDiskChunkStore Creates a disk chunk store on a directory, or on a new temporary directory when empty.
+// Files left by previous executions are removed, as their messages cannot be completed.
+func NewDiskChunkStore(dir string, maxBytes int64, maxMessages int) (*DiskChunkStore, error) {
+	var err error
+	temp := dir == ""
+	if temp {
+		if dir, err = ioutil.TempDir("", "onms-ipc-chunks"); err != nil {
+			return nil, fmt.Errorf("cannot create chunk store directory: %v", err)
+		}
+	} else if err = os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("cannot create chunk store directory: %v", err)
+	}
+	stale, err := filepath.Glob(filepath.Join(dir, "*"+chunkStoreExtension))
+	if err != nil {
+		return nil, fmt.Errorf("cannot list chunk store directory: %v", err)
+	}
+	for _, path := range stale {
+		os.Remove(path)
+	}
+	store := &DiskChunkStore{Dir: dir, MaxBytes: maxBytes, MaxMessages: maxMessages, sizes: make(map[string]int64), temp: temp}
+	store.updateMetrics()
+	return store, nil
+}
+
+// Append Adds the content of a chunk to the file of a message.
+func (s *DiskChunkStore) Append(id string, data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	size, ok := s.sizes[id]
+	if !ok && s.MaxMessages > 0 && len(s.sizes) >= s.MaxMessages {
+		return fmt.Errorf("chunk store full, holding %d messages", len(s.sizes))
+	}
+	if s.MaxBytes > 0 && s.total+int64(len(data)) > s.MaxBytes {
+		return fmt.Errorf("chunk store full, holding %d bytes", s.total)
+	}
+	file, err := os.OpenFile(s.path(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("cannot open chunk file: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		file.Truncate(size) // Discard the partial write
+		return fmt.Errorf("cannot write chunk file: %v", err)
+	}
+	s.sizes[id] = size + int64(len(data))
+	s.total += int64(len(data))
+	s.updateMetrics()
+	return nil
+}
+
+// Content Returns the content of the file of a message.
+func (s *DiskChunkStore) Content(id string) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.sizes[id]; !ok {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(s.path(id))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read chunk file: %v", err)
+	}
+	return data, nil
+}
+
+// Delete Removes the file of a message.
+func (s *DiskChunkStore) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	size, ok := s.sizes[id]
+	if !ok {
+		return nil
+	}
+	delete(s.sizes, id)
+	s.total -= size
+	s.updateMetrics()
+	if err := os.Remove(s.path(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove chunk file: %v", err)
+	}
+	return nil
+}
+
+// Close Removes the files of all the messages, and the directory when it is temporary.
+func (s *DiskChunkStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for id := range s.sizes {
+		os.Remove(s.path(id))
+	}
+	s.sizes = make(map[string]int64)
+	s.total = 0
+	s.updateMetrics()
+	if s.temp {
+		return os.RemoveAll(s.Dir)
+	}
+	return nil
+}
+
+// path Returns the path of the file of a message, hashing the ID as it might contain characters not allowed on file names.
+func (s *DiskChunkStore) path(id string) string {
+	return filepath.Join(s.Dir, fmt.Sprintf("%x%s", sha1.Sum([]byte(id)), chunkStoreExtension))
+}
+
+// updateMetrics Updates the metrics of the store; must be called while holding the lock.
+func (s *DiskChunkStore) updateMetrics() {
+	chunkStoreBytes.WithLabelValues(s.Dir).Set(float64(s.total))
+	chunkStoreMessages.WithLabelValues(s.Dir).Set(float64(len(s.sizes)))
+}
+
+// appendChunk Adds the content of a chunk to a partial message, either in memory or on the chunk store.
+// Must be called while holding the lock of the reassembly buffer.
+func (cli *KafkaClient) appendChunk(id string, partial *partialMessage, data []byte) error {
+	if cli.ChunkStore != nil {
+		if err := cli.ChunkStore.Append(id, data); err != nil {
+			return err
+		}
+	} else {
+		partial.content = append(partial.content, data...)
+	}
+	partial.size += len(data)
+	return nil
+}
+
+// partialContent Returns the content received so far of a partial message.
+// Must be called while holding the lock of the reassembly buffer.
+func (cli *KafkaClient) partialContent(id string, partial *partialMessage) ([]byte, error) {
+	if cli.ChunkStore == nil {
+		return partial.content, nil
+	}
+	return cli.ChunkStore.Content(id)
+}
+
+// discardPartial Removes a partial message from the reassembly buffer, releasing its content.
+// Must be called while holding the lock of the reassembly buffer.
+func (cli *KafkaClient) discardPartial(id string, partial *partialMessage) {
+	cli.budget.Release(partial.size)
+	delete(cli.msgBuffer, id)
+	if cli.ChunkStore != nil {
+		if err := cli.ChunkStore.Delete(id); err != nil {
+			cli.logger().Warnf("cannot delete message %s from the chunk store: %v", id, err)
+		}
+	}
+}
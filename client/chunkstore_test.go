@@ -0,0 +1,78 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"gotest.tools/v3/assert"
+)
+
+func TestDiskChunkStore(t *testing.T) {
+	dir := t.TempDir()
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, "stale"+chunkStoreExtension), []byte("stale"), 0600))
+	store, err := NewDiskChunkStore(dir, 10, 2)
+	assert.NilError(t, err)
+	stale, _ := filepath.Glob(filepath.Join(dir, "*"+chunkStoreExtension))
+	assert.Equal(t, 0, len(stale))
+
+	assert.NilError(t, store.Append("0001", []byte("Min")))
+	assert.NilError(t, store.Append("0001", []byte("ion")))
+	assert.NilError(t, store.Append("0002/a", []byte("abc")))
+	assert.ErrorContains(t, store.Append("0003", []byte("x")), "2 messages")
+	assert.ErrorContains(t, store.Append("0002/a", []byte("defg")), "9 bytes")
+	data, err := store.Content("0001")
+	assert.NilError(t, err)
+	assert.Equal(t, "Minion", string(data))
+	data, err = store.Content("0002/a")
+	assert.NilError(t, err)
+	assert.Equal(t, "abc", string(data))
+
+	assert.NilError(t, store.Delete("0001"))
+	assert.NilError(t, store.Delete("0001"))
+	data, err = store.Content("0001")
+	assert.NilError(t, err)
+	assert.Equal(t, 0, len(data))
+	assert.NilError(t, store.Append("0003", []byte("x")))
+	assert.NilError(t, store.Close())
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+chunkStoreExtension))
+	assert.Equal(t, 0, len(files))
+}
+
+func TestChunkStoreReassembly(t *testing.T) {
+	pubSub := gochannel.NewGoChannel(gochannel.Config{}, watermill.NewStdLogger(false, false))
+	defer pubSub.Close()
+	store, err := NewDiskChunkStore("", 0, 0)
+	assert.NilError(t, err)
+	defer store.Close()
+	cli := &KafkaClient{Topic: "Store.Sink.Heartbeat", GroupID: "store-test", Parser: "heartbeat", Source: pubSub, ChunkStore: store}
+	assert.NilError(t, cli.Initialize(context.Background()))
+	defer cli.Stop()
+	payloads := make(chan string, 1)
+	go cli.Handle(func(msg DecodedMessage) error {
+		payloads <- string(msg.Payload)
+		return nil
+	})
+
+	pubSub.Publish("Store.Sink.Heartbeat", buildMessage("0001", 0, 3, []byte("Min")))
+	waitFor(t, func() bool { return cli.pendingMessages() == 1 })
+	pubSub.Publish("Store.Sink.Heartbeat", buildMessage("0001", 1, 3, []byte("ion")))
+	waitFor(t, func() bool { return cli.PartialMessages()[0].Bytes == 6 })
+	cli.mutex.RLock()
+	assert.Equal(t, 0, len(cli.msgBuffer["0001"].content))
+	cli.mutex.RUnlock()
+	pubSub.Publish("Store.Sink.Heartbeat", buildMessage("0001", 2, 3, []byte("-1")))
+	select {
+	case payload := <-payloads:
+		assert.Equal(t, "Minion-1", payload)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the message was not reassembled")
+	}
+	assert.Equal(t, 0, len(store.sizes))
+}
@@ -1,94 +1,470 @@
 // @author Alejandro Galue <agalue@opennms.org>
 
 // Package client implements a kafka consumer that works with single or multi-part messages for OpenNMS Sink and RPC API messages.
+//
+// Since v1.0.0, the exported API follows semantic versioning: within the same major version, exported declarations are never
+// removed nor changed in incompatible ways, and the superseded ones are kept working, flagged as deprecated.
 package client
 
 import (
 	"context"
-	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"log"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"gopkg.in/mgo.v2/bson"
 
 	"github.com/Shopify/sarama"
-	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill-kafka/v2/pkg/kafka"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/netflow"
 	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/rpc"
-	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/sink"
 	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/telemetry"
-	"github.com/golang/protobuf/proto"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/proto"
 )
 
 // AvailableParsers list of available parsers for the Sink API.
 var AvailableParsers = &EnumValue{
-	Enum: []string{"heartbeat", "snmp", "syslog", "netflow", "sflow"},
+	Enum: []string{"heartbeat", "snmp", "syslog", "events", "netflow", "ipfix", "sflow", "nxos", "jti"},
 }
 
 // ProcessMessage defines the action to execute after successfully received an IPC message.
 // It receives the payload as an array of bytes (usually in XML or JSON format).
 type ProcessMessage func(msg []byte)
 
+// AffinityViolation defines the action to execute when chunks of the same message arrive from different partitions.
+// It receives the message ID, the partition of the first chunk, and the partition of the current chunk.
+type AffinityViolation func(id string, expected, actual int32)
+
+// IdleAction defines the action to execute when no messages arrive within the idle timeout.
+// It receives the time elapsed since the last message (or since the consumer started).
+type IdleAction func(idle time.Duration)
+
 // ipcMessage internal structure that represents an IPC message.
 type ipcMessage struct {
-	chunk   int32
-	total   int32
-	id      string
-	content []byte
+	chunk     int32
+	total     int32
+	id        string
+	content   []byte
+	topic     string // The Kafka topic of the chunk.
+	partition int32  // The Kafka partition of the chunk, or -1 when unknown.
+	offset    int64  // The Kafka offset of the chunk, or -1 when unknown.
+	ref       string // The reference to the offloaded payload, if any.
+	tracing   map[string]string
+	span      oteltrace.SpanContext // The span of the chunk, when tracing through OpenTelemetry.
 }
 
 // KafkaClient defines a simple Kafka consumer client.
 type KafkaClient struct {
 	Bootstrap string // The Kafka Server Bootstrap string.
-	Topic     string // The name of the Kafka Topic.
+	Topic     string // The name of the Kafka Topic, or a comma-separated list of topics with optional parsers as topic:parser.
 	GroupID   string // The name of the Consumer Group ID.
 	IPC       string // Either rpc or sink.
 	Parser    string // See AvailableParsers.
+	Raw       bool   // Skips the parser, so the decoded messages contain the reassembled payload as is.
+
+	Seek          string    // Resets the offsets of the group once before consuming: beginning, end, or an offset (optional).
+	SeekTimestamp time.Time // Resets the offsets of the group once before consuming to the first records produced at or after this time (optional).
+
+	WireFormat     string          // The format of the records: protobuf (default) or avro.
+	SchemaRegistry *SchemaRegistry `json:",omitempty"` // The registry to resolve the Avro schemas (required with the avro wire format).
+
+	PayloadCompression string // The codec of the reassembled payloads: auto (default, detected through the magic bytes), none, gzip or zstd.
+
+	MaxPendingBytes    int64 // Pause consumption when the pending bytes exceed this limit (0 to disable).
+	ResumePendingBytes int64 // Resume consumption when the pending bytes drop below this limit (defaults to 80% of the maximum).
+	MaxMessageRate     int   // The maximum number of chunks read per second from all the partitions (0 for unlimited).
+	MaxByteRate        int64 // The maximum number of bytes read per second from all the partitions (0 for unlimited).
+
+	ChunkStallTimeout time.Duration // Evict partial messages when no new chunk arrives within this period (0 to disable).
+	ChunkMaxAge       time.Duration // Evict partial messages when the first chunk is older than this period (0 to disable).
+	ChunkStore        ChunkStore    `json:"-"` // Holds the content of the partial messages instead of the heap, i.e. a DiskChunkStore (optional).
+
+	RebalanceGracePeriod time.Duration // How long the partial messages of a revoked partition are kept, waiting for its reassignment (defaults to DefaultRebalanceGracePeriod).
+
+	ReassemblyCheckpoint string // File to persist the lowest uncommittable offset of each partition, to recover the partial messages after a restart (optional).
+	PartialBufferFile    string // File to save the partial messages on Stop, which are restored by Initialize (optional).
+
+	ShutdownTimeout time.Duration // How long Stop waits for the in-flight messages to be processed before closing the consumer (0 to close it immediately).
+
+	MessageBuffer int // The size of the channel buffer returned by Messages.
+
+	PollTimeout time.Duration // How long the broker waits for new records on each fetch request (defaults to 250ms).
+	IdleTimeout time.Duration // Execute OnIdle when no messages arrive within this period (0 to disable).
+
+	OutputTimeout time.Duration // The deadline to send each message to all the outputs (0 to disable).
+
+	LagInterval time.Duration // How often to refresh the consumer lag metrics (0 to disable).
+	MaxLag      int64         // Flag the lag as exceeded when a partition falls behind more than this number of messages (0 to disable).
+
+	CommitPolicy     string        // When to acknowledge and commit each message: message (default), periodic or success.
+	CommitInterval   time.Duration // How often to commit the offsets with the periodic policy (defaults to 5s).
+	CommitRetryDelay time.Duration // How long to wait before retrying a failed action or output delivery (defaults to 1s).
+	ActionRetry      RetryPolicy   // How to retry the failures of the action (by default, a single attempt, or unlimited attempts with the success policy).
+
+	Workers int // The number of messages processed concurrently (0 or 1 to process them sequentially); the action must be concurrent safe when greater than 1.
+
+	Parameters Properties // Additional Kafka consumer settings, i.e. security.protocol=SASL_SSL.
+	TLS        TLSConfig  // TLS settings to connect to Kafka (optional).
+	SASL       SASLConfig // SASL settings to authenticate against Kafka (optional).
 
-	subscriber   *kafka.Subscriber
-	msgChannel   <-chan *message.Message
-	msgBuffer    map[string][]byte
-	chunkTracker map[string]int32
-	mutex        *sync.RWMutex
-	stopping     bool
+	// MaxPartitionRate pauses a partition when it delivers more than this number of messages per second (0 to disable).
+	//
+	// Deprecated: use Sampler with Sampling.MaxPartitionRate, which can be changed at runtime; the Sampler takes precedence when both are set.
+	MaxPartitionRate int
 
-	msgProcessed   prometheus.Counter
-	chunkProcessed prometheus.Counter
+	HeaderFilter   HeaderRules    // Only process the chunks whose Kafka headers satisfy these rules, discarding the others before decoding them (optional).
+	OutputRoutes   OutputRoutes   // Only send the messages to an output when the Kafka headers of their last chunk satisfy its rules (optional).
+	OutputDelivery OutputDelivery // The delivery mode of each output (defaults to at-most-once).
+	Filter         *FilterRules   `json:",omitempty"` // Only process the decoded messages allowed by these include/exclude rules (optional).
+
+	TrapStats  *TrapStats      `json:"-"` // Optional tracker for the SNMP trap statistics.
+	Anonymizer *Anonymizer     `json:"-"` // Optional anonymizer to pseudonymize the addresses, hostnames and communities of the reassembled messages.
+	Captures   *CaptureManager `json:"-"` // Optional manager for the capture sessions.
+
+	LatencySLO     LatencySLO     // Optional end-to-end latency objective, based on the Kafka timestamp of the last chunk of each message.
+	CircuitBreaker CircuitBreaker // Optional thresholds to pause the consumption while the outputs are failing or too slow.
+
+	OnAffinityViolation     AffinityViolation     `json:"-"` // Optional action executed when chunks of the same message arrive from different partitions.
+	OnPartialMessageEvicted PartialMessageEvicted `json:"-"` // Optional action executed when a partial message is evicted by the reassembly hygiene policies.
+	OnIdle                  IdleAction            `json:"-"` // Optional action executed on each idle period without messages, from the consumer loop.
+	OnRebalance             RebalanceHandler      `json:"-"` // Optional action executed when a partition is assigned, revoked, or drained after the grace period.
+	Outputs                 []Output              `json:"-"` // Optional destinations for the decoded messages, in addition to the processing action.
+	DeadLetter              Output                `json:"-"` // Optional destination for the decoded messages whose action failed after all the attempts, with the error as the error header.
+	PayloadStore            PayloadStore          `json:"-"` // Optional store to fetch the payloads offloaded by OpenNMS, referenced through the payload-ref tracing info or header.
+	Logger                  Logger                `json:"-"` // Optional logger (defaults to DefaultLogger).
+	Sampler                 *Sampler              `json:"-"` // Optional runtime-tunable sampling, which overrides MaxPartitionRate.
+	Dedup                   *MessageIndex         `json:"-"` // Optional index of the processed message IDs, to discard the messages redelivered after restarts or rebalances.
+	DedupCache              *DedupCache           `json:"-"` // Optional in-memory cache of the processed message IDs, to discard the messages reprocessed after rebalances or retries.
+	Tracer                  *Tracer               `json:"-"` // Optional tracer to log every processing step of given messages.
+	Source                  Source                `json:"-"` // Optional transport replacing the Kafka consumer, i.e. GRPCSource; owned by the caller.
+
+	subscriber    Source
+	msgChannel    <-chan *message.Message
+	msgBuffer     map[string]*partialMessage
+	mutex         *sync.RWMutex
+	settingsMutex *sync.RWMutex // Protects the runtime settings changed through Reconfigure.
+	stopping      int32         // Set while stopping; accessed atomically, as Stop is called from other goroutines.
+	reloading     int32         // Set when the consumer is closed on purpose to reconnect; accessed atomically.
+	draining      chan struct{} // Closed by Stop to stop reading new messages
+	drained       chan struct{} // Closed once the consumer loop finished processing the in-flight messages
+	seeked        bool          // The offsets of the group were reset according to Seek or SeekTimestamp
+	budget        *ByteBudget
+	cancel        context.CancelFunc
+	ctx           context.Context
+	done          <-chan struct{}
+	slo           *sloTracker
+	partitions    *partitionController
+	limiter       *throughputLimiter
+	gate          *consumptionGate
+	breaker       *circuitBreaker
+	rebalances    *rebalanceTracker
+	checkpoint    *reassemblyCheckpoint
+	lag           map[TopicPartition]int64
+
+	middlewares []Middleware // Executed in order between the reassembly and the action.
+
+	msgProcessed      prometheus.Counter
+	chunkProcessed    prometheus.Counter
+	pauses            prometheus.Counter
+	throttled         prometheus.Counter
+	stalledEvicted    prometheus.Counter
+	expiredEvicted    prometheus.Counter
+	manualEvicted     prometheus.Counter
+	revokedEvicted    prometheus.Counter
+	breakerTrips      prometheus.Counter
+	rebalanceEvents   *prometheus.CounterVec
+	affinityErrors    prometheus.Counter
+	partPauses        *prometheus.CounterVec
+	outputResults     *prometheus.CounterVec
+	offloadedPayloads *prometheus.CounterVec
+	duplicates        prometheus.Counter
+	sampledOut        prometheus.Counter
+	headerFiltered    prometheus.Counter
+	ruleFiltered      prometheus.Counter
+	transformErrors   prometheus.Counter
+	integrityFailures *prometheus.CounterVec
+	actionFailures    prometheus.Counter
+	deadLettered      *prometheus.CounterVec
+	outputLatency     *prometheus.HistogramVec
 }
 
 // createConfig Creates the Kafka Configuration object.
-func (cli *KafkaClient) createConfig() *sarama.Config {
+func (cli *KafkaClient) createConfig() (*sarama.Config, error) {
 	config := kafka.DefaultSaramaSubscriberConfig()
 	config.Version = sarama.V2_7_0_0
 	config.Consumer.Offsets.Initial = sarama.OffsetNewest
 	config.Consumer.Group.Session.Timeout = 6 * time.Second
-	return config
+	if cli.PollTimeout > 0 {
+		config.Consumer.MaxWaitTime = cli.PollTimeout
+	}
+	cli.applyCommitPolicy(config)
+	if err := cli.Parameters.apply(config); err != nil {
+		return nil, err
+	}
+	if err := cli.TLS.apply(config); err != nil {
+		return nil, err
+	}
+	if err := cli.SASL.apply(config); err != nil {
+		return nil, err
+	}
+	return config, nil
 }
 
 // createVariables Initializes all internal variables.
 func (cli *KafkaClient) createVariables() {
-	cli.msgBuffer = make(map[string][]byte)
-	cli.chunkTracker = make(map[string]int32)
+	cli.msgBuffer = make(map[string]*partialMessage)
 	cli.mutex = &sync.RWMutex{}
+	if cli.settingsMutex == nil { // Kept across restarts, as it can be in use by Reconfigure
+		cli.settingsMutex = &sync.RWMutex{}
+	}
+	if cli.gate == nil { // Kept across restarts, so a paused pipeline stays paused
+		cli.gate = &consumptionGate{}
+	}
+	if cli.breaker == nil { // Kept across restarts, so an open circuit stays open
+		cli.breaker = newCircuitBreaker(cli.CircuitBreaker)
+		if cli.breaker != nil {
+			cli.breaker.onChange = func(state, reason string) {
+				if state == BreakerClosed {
+					cli.logger().Infof("closing the circuit breaker of %s: %s", cli.Topic, reason)
+					return
+				}
+				cli.logger().Warnf("the circuit breaker of %s is %s: %s", cli.Topic, state, reason)
+				if state == BreakerOpen && cli.breakerTrips != nil {
+					cli.breakerTrips.Inc()
+				}
+			}
+		}
+	}
+	if cli.rebalances == nil { // Kept across restarts, so the partitions reassigned after a reload keep their partial messages
+		cli.rebalances = newRebalanceTracker()
+	}
+	cli.partitions = newPartitionController(cli.MaxPartitionRate)
+	if cli.Sampler != nil {
+		cli.Sampler.register(cli, cli.partitions)
+	}
+	cli.partitions.onPause = func(tp TopicPartition, reason string) {
+		if reason == "manual" {
+			cli.logger().Infof("pausing partition %d of %s", tp.Partition, tp.Topic)
+		}
+		if cli.partPauses != nil {
+			cli.partPauses.WithLabelValues(reason).Inc()
+		}
+	}
+	cli.limiter = newThroughputLimiter(cli.MaxMessageRate, cli.MaxByteRate)
+	cli.limiter.onWait = func(d time.Duration) {
+		if cli.throttled != nil {
+			cli.throttled.Add(d.Seconds())
+		}
+	}
+	cli.budget = NewByteBudget(cli.MaxPendingBytes, cli.ResumePendingBytes)
+	cli.budget.OnPause = func(paused bool, pending int64) {
+		if paused {
+			cli.logger().Warnf("pausing consumption of %s, %d pending bytes exceed the limit of %d", cli.Topic, pending, cli.budget.High)
+			if cli.pauses != nil {
+				cli.pauses.Inc()
+			}
+		} else {
+			cli.logger().Infof("resuming consumption of %s, %d pending bytes", cli.Topic, pending)
+		}
+	}
 }
 
 // createCounters Creates the prometheus counters.
+// The counters are labeled with the topic and group, so multiple clients can coexist within the same process.
 func (cli *KafkaClient) createCounters() {
+	if cli.msgProcessed != nil {
+		return // Counters are registered only once, even if the client is re-initialized.
+	}
+	labels := prometheus.Labels{"topic": cli.Topic, "group": cli.GroupID}
 	cli.msgProcessed = promauto.NewCounter(prometheus.CounterOpts{
-		Name: "onms_ipc_processed_messages_total",
-		Help: "The total number of processed messages",
+		Name:        "onms_ipc_processed_messages_total",
+		Help:        "The total number of processed messages",
+		ConstLabels: labels,
 	})
 	cli.chunkProcessed = promauto.NewCounter(prometheus.CounterOpts{
-		Name: "onms_ipc_processed_chunk_total",
-		Help: "The total number of processed chunks",
+		Name:        "onms_ipc_processed_chunk_total",
+		Help:        "The total number of processed chunks",
+		ConstLabels: labels,
+	})
+	cli.pauses = promauto.NewCounter(prometheus.CounterOpts{
+		Name:        "onms_ipc_consumer_pauses_total",
+		Help:        "The total number of times the consumption was paused due to backpressure",
+		ConstLabels: labels,
+	})
+	cli.throttled = promauto.NewCounter(prometheus.CounterOpts{
+		Name:        "onms_ipc_throttled_seconds_total",
+		Help:        "The total time the consumption was paused to honor the message and byte rate limits",
+		ConstLabels: labels,
+	})
+	cli.stalledEvicted = promauto.NewCounter(prometheus.CounterOpts{
+		Name:        "onms_ipc_evicted_stalled_messages_total",
+		Help:        "The total number of partial messages evicted because no new chunk arrived on time",
+		ConstLabels: labels,
+	})
+	cli.expiredEvicted = promauto.NewCounter(prometheus.CounterOpts{
+		Name:        "onms_ipc_evicted_expired_messages_total",
+		Help:        "The total number of partial messages evicted because they were too old",
+		ConstLabels: labels,
+	})
+	cli.manualEvicted = promauto.NewCounter(prometheus.CounterOpts{
+		Name:        "onms_ipc_evicted_manual_messages_total",
+		Help:        "The total number of partial messages evicted on demand",
+		ConstLabels: labels,
+	})
+	cli.revokedEvicted = promauto.NewCounter(prometheus.CounterOpts{
+		Name:        "onms_ipc_evicted_revoked_messages_total",
+		Help:        "The total number of partial messages drained because their partition was revoked and not reassigned on time",
+		ConstLabels: labels,
+	})
+	cli.rebalanceEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name:        "onms_ipc_rebalance_events_total",
+		Help:        "The total number of partitions assigned, revoked or drained by the consumer group rebalances, by type",
+		ConstLabels: labels,
+	}, []string{"type"})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "onms_ipc_assigned_partitions",
+		Help:        "The number of partitions currently assigned to the consumer",
+		ConstLabels: labels,
+	}, func() float64 {
+		return float64(len(cli.AssignedPartitions()))
+	})
+	cli.affinityErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name:        "onms_ipc_partition_affinity_violations_total",
+		Help:        "The total number of chunks received from a different partition than the first chunk of the same message",
+		ConstLabels: labels,
+	})
+	cli.duplicates = promauto.NewCounter(prometheus.CounterOpts{
+		Name:        "onms_ipc_duplicate_messages_total",
+		Help:        "The total number of messages discarded because they were already processed",
+		ConstLabels: labels,
+	})
+	cli.sampledOut = promauto.NewCounter(prometheus.CounterOpts{
+		Name:        "onms_ipc_sampled_out_messages_total",
+		Help:        "The total number of messages discarded by the sampling",
+		ConstLabels: labels,
+	})
+	cli.headerFiltered = promauto.NewCounter(prometheus.CounterOpts{
+		Name:        "onms_ipc_header_filtered_chunks_total",
+		Help:        "The total number of chunks discarded because their Kafka headers didn't satisfy the header filter",
+		ConstLabels: labels,
+	})
+	cli.ruleFiltered = promauto.NewCounter(prometheus.CounterOpts{
+		Name:        "onms_ipc_rule_filtered_messages_total",
+		Help:        "The total number of decoded messages discarded by the filter rules",
+		ConstLabels: labels,
+	})
+	cli.transformErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name:        "onms_ipc_middleware_failures_total",
+		Help:        "The total number of decoded messages discarded because a middleware failed",
+		ConstLabels: labels,
+	})
+	cli.integrityFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name:        "onms_ipc_integrity_failures_total",
+		Help:        "The total number of reassembled messages discarded because they failed the integrity checks, by reason",
+		ConstLabels: labels,
+	}, []string{"reason"})
+	cli.deadLettered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name:        "onms_ipc_dead_letter_messages_total",
+		Help:        "The total number of messages sent to the dead letter output after exhausting the attempts of the action",
+		ConstLabels: labels,
+	}, []string{"result"})
+	cli.actionFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name:        "onms_ipc_action_failures_total",
+		Help:        "The total number of failed attempts to process a message that were retried",
+		ConstLabels: labels,
+	})
+	cli.offloadedPayloads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name:        "onms_ipc_offloaded_payloads_total",
+		Help:        "The total number of payloads fetched from an external store by result (success, retryable or permanent failure)",
+		ConstLabels: labels,
+	}, []string{"result"})
+	cli.outputResults = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name:        "onms_ipc_output_requests_total",
+		Help:        "The total number of messages sent to each output by result (success, retryable or permanent failure)",
+		ConstLabels: labels,
+	}, []string{"output", "result"})
+	cli.outputLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        "onms_ipc_output_duration_seconds",
+		Help:        "The time it takes to send a message to each output",
+		ConstLabels: labels,
+		Buckets:     prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"output"})
+	cli.partPauses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name:        "onms_ipc_partition_pauses_total",
+		Help:        "The total number of times a partition was paused, either manually or because it was too hot",
+		ConstLabels: labels,
+	}, []string{"reason"})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "onms_ipc_paused_partitions",
+		Help:        "The number of partitions currently paused",
+		ConstLabels: labels,
+	}, func() float64 {
+		if cli.partitions == nil {
+			return 0
+		}
+		return float64(len(cli.partitions.pausedPartitions()))
+	})
+	if cli.LatencySLO.Enabled() {
+		cli.slo = newSLOTracker(cli.LatencySLO, labels)
+	}
+	if cli.CircuitBreaker.Enabled() {
+		cli.breakerTrips = promauto.NewCounter(prometheus.CounterOpts{
+			Name:        "onms_ipc_circuit_breaker_trips_total",
+			Help:        "The total number of times the circuit breaker opened, pausing the consumption because the outputs were failing or too slow",
+			ConstLabels: labels,
+		})
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "onms_ipc_circuit_breaker_state",
+			Help:        "The state of the circuit breaker: 0 for closed, 1 for half-open, and 2 for open",
+			ConstLabels: labels,
+		}, func() float64 {
+			switch cli.BreakerState() {
+			case BreakerOpen:
+				return 2
+			case BreakerHalfOpen:
+				return 1
+			default:
+				return 0
+			}
+		})
+	}
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "onms_ipc_partial_messages",
+		Help:        "The number of partial messages in the reassembly buffer",
+		ConstLabels: labels,
+	}, func() float64 {
+		if cli.mutex == nil {
+			return 0
+		}
+		return float64(cli.pendingMessages())
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "onms_ipc_pending_bytes",
+		Help:        "The amount of in-process pending bytes",
+		ConstLabels: labels,
+	}, func() float64 {
+		if cli.budget == nil {
+			return 0
+		}
+		return float64(cli.budget.Pending())
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "onms_ipc_consumer_paused",
+		Help:        "Whether or not the consumption is paused due to backpressure",
+		ConstLabels: labels,
+	}, func() float64 {
+		if cli.budget != nil && cli.budget.Paused() {
+			return 1
+		}
+		return 0
 	})
 }
 
@@ -100,145 +476,400 @@ func (cli *KafkaClient) getIpcMessage(msg *message.Message) (*ipcMessage, error)
 		if err := proto.Unmarshal(msg.Payload, rpcMsg); err != nil {
 			return nil, fmt.Errorf("[warn] invalid rpc message received: %v", err)
 		}
-		cli.chunkProcessed.Inc()
 		return &ipcMessage{
-			chunk:   rpcMsg.CurrentChunkNumber + 1, // Chunks starts at 0
-			total:   rpcMsg.TotalChunks,
-			id:      rpcMsg.RpcId,
-			content: rpcMsg.RpcContent,
+			chunk:     rpcMsg.CurrentChunkNumber + 1, // Chunks starts at 0
+			total:     rpcMsg.TotalChunks,
+			id:        rpcMsg.RpcId,
+			content:   rpcMsg.RpcContent,
+			topic:     cli.topicOf(msg),
+			partition: getPartition(msg),
+			offset:    getOffset(msg),
+			ref:       getPayloadRef(msg, rpcMsg.TracingInfo),
+			tracing:   rpcMsg.TracingInfo,
 		}, nil
 	}
-	sinkMsg := &sink.SinkMessage{}
-	if err := proto.Unmarshal(msg.Payload, sinkMsg); err != nil {
+	sinkMsg, err := cli.decodeSinkMessage(msg)
+	if err != nil {
 		return nil, fmt.Errorf("[warn] invalid sink message received: %v", err)
 	}
+	addSinkHeaders(msg, sinkMsg.Headers)
 	return &ipcMessage{
-		chunk:   sinkMsg.CurrentChunkNumber + 1, // Chunks starts at 0
-		total:   sinkMsg.TotalChunks,
-		id:      sinkMsg.MessageId,
-		content: sinkMsg.Content,
+		chunk:     sinkMsg.CurrentChunkNumber + 1, // Chunks starts at 0
+		total:     sinkMsg.TotalChunks,
+		id:        sinkMsg.MessageId,
+		content:   sinkMsg.Content,
+		topic:     cli.topicOf(msg),
+		partition: getPartition(msg),
+		offset:    getOffset(msg),
+		ref:       getPayloadRef(msg, sinkMsg.TracingInfo),
+		tracing:   sinkMsg.TracingInfo,
 	}, nil
 }
 
+// addSinkHeaders Adds the headers of a Sink message to the metadata of its chunk, so they are available like the Kafka headers
+// for the routes and the outputs; the Kafka headers take precedence.
+func addSinkHeaders(msg *message.Message, headers map[string]string) {
+	if len(headers) == 0 {
+		return
+	}
+	if msg.Metadata == nil {
+		msg.Metadata = make(message.Metadata, len(headers))
+	}
+	for key, value := range headers {
+		if _, ok := msg.Metadata[key]; !ok {
+			msg.Metadata.Set(key, value)
+		}
+	}
+}
+
+// getPayloadRef Returns the reference to an offloaded payload from the tracing info of an IPC message, or from the Kafka headers.
+func getPayloadRef(msg *message.Message, tracingInfo map[string]string) string {
+	if ref, ok := tracingInfo[PayloadRefKey]; ok {
+		return ref
+	}
+	return msg.Metadata.Get(PayloadRefKey)
+}
+
+// getPartition Returns the partition of a watermill message, or -1 when unknown.
+func getPartition(msg *message.Message) int32 {
+	return recordMetadata(msg).Partition
+}
+
+// getOffset Returns the offset of a watermill message, or -1 when unknown.
+func getOffset(msg *message.Message) int64 {
+	return recordMetadata(msg).Offset
+}
+
 // processMessage Processes a watermill message.
 // It return a non-empty slice when the message is complete, otherwise returns nil.
 // This is a concurrent safe method.
 func (cli *KafkaClient) processMessage(msg *message.Message) []byte {
+	defer endMessageSpan(msg)
+	_, data := cli.reassemble(msg)
+	return data
+}
+
+// reassemble Processes a watermill message, returning the ID of the IPC message it belongs to,
+// and a non-empty slice when the message is complete, or nil otherwise.
+// This is a concurrent safe method.
+func (cli *KafkaClient) reassemble(msg *message.Message) (string, []byte) {
 	// Process IPC Messages
+	start := time.Now()
 	cli.chunkProcessed.Inc()
+	if !cli.headerFilter().Matches(msg.Metadata) {
+		if cli.headerFiltered != nil {
+			cli.headerFiltered.Inc()
+		}
+		cli.countDroppedChunks(cli.topicOf(msg), DropHeaderFilter, 1)
+		if cli.Tracer.active() {
+			cli.trace(cli.messageID(msg), "chunk discarded by the header filter")
+		}
+		return "", nil
+	}
 	ipcmsg, err := cli.getIpcMessage(msg)
 	if err != nil {
-		log.Printf("[error] invalid IPC message: %v", err)
-		return nil
+		cli.logger().Errorf("invalid IPC message: %v", err)
+		topic := cli.topicOf(msg)
+		cli.countUnmarshalFailure(topic, cli.IPC)
+		cli.countDroppedChunks(topic, DropUnmarshal, 1)
+		return "", nil
 	}
+	ctx, span := startChunkSpan(msg, ipcmsg, start)
+	defer span.End()
+	ipcmsg.span = span.SpanContext()
+	cli.trace(ipcmsg.id, "chunk %d of %d received from %s/%d@%d with %d bytes", ipcmsg.chunk, ipcmsg.total, ipcmsg.topic, ipcmsg.partition, ipcmsg.offset, len(ipcmsg.content))
 	if ipcmsg.chunk != ipcmsg.total {
-		cli.mutex.Lock()
-		if cli.chunkTracker[ipcmsg.id] < ipcmsg.chunk {
-			// Adds partial message to the buffer
-			cli.msgBuffer[ipcmsg.id] = append(cli.msgBuffer[ipcmsg.id], ipcmsg.content...)
-			cli.chunkTracker[ipcmsg.id] = ipcmsg.chunk
-		} else {
-			log.Printf("[warn] chunk %d from %s was already processed, ignoring...", ipcmsg.chunk, ipcmsg.id)
-		}
-		cli.mutex.Unlock()
-		return nil
+		cli.bufferChunk(ipcmsg)
+		return ipcmsg.id, nil
 	}
 	// Retrieve the complete message from the buffer
 	var data []byte
+	var invalid string
+	var links []oteltrace.Link
 	if ipcmsg.total == 1 { // Handle special case chunk == total == 1
 		data = ipcmsg.content
 	} else {
 		cli.mutex.RLock()
-		data = append(cli.msgBuffer[ipcmsg.id], ipcmsg.content...)
+		if partial, ok := cli.msgBuffer[ipcmsg.id]; ok {
+			cli.checkAffinity(ipcmsg, partial.partition)
+			content, err := cli.partialContent(ipcmsg.id, partial)
+			if err != nil {
+				cli.logger().Errorf("cannot retrieve message %s from the chunk store: %v", ipcmsg.id, err)
+			}
+			data = append(content, ipcmsg.content...)
+			invalid = partial.checkLastChunk(ipcmsg)
+			links = append(links, partial.links...)
+		} else {
+			data = ipcmsg.content
+			invalid = IntegrityMissingChunks
+		}
 		cli.mutex.RUnlock()
 	}
 	cli.bufferCleanup(ipcmsg.id)
+	links = append(links, oteltrace.Link{SpanContext: ipcmsg.span})
+	if invalid == "" && ipcmsg.ref == "" {
+		invalid = checkContent(ipcmsg.tracing, data)
+	}
+	if invalid != "" {
+		cli.trace(ipcmsg.id, "message discarded, integrity check failed: %s", invalid)
+		cli.integrityFailure(ipcmsg, invalid)
+		failSpan(span, "integrity check failed: "+invalid)
+		cli.countMessage(ipcmsg.topic, ResultInvalid)
+		return ipcmsg.id, nil
+	}
+	cli.trace(ipcmsg.id, "message reassembled from %d chunks with %d bytes", ipcmsg.total, len(data))
+	if cli.duplicated(ipcmsg.id) {
+		cli.logger().Warnf("message %s was already processed, ignoring...", ipcmsg.id)
+		if cli.duplicates != nil {
+			cli.duplicates.Inc()
+		}
+		cli.trace(ipcmsg.id, "message discarded as a duplicate")
+		cli.countMessage(ipcmsg.topic, ResultDuplicate)
+		span.SetAttributes(resultAttribute(ResultDuplicate))
+		return ipcmsg.id, nil
+	}
+	if cli.Sampler != nil && !cli.Sampler.KeepParser(ipcmsg.id, cli.parserFor(ipcmsg.topic)) {
+		if cli.sampledOut != nil {
+			cli.sampledOut.Inc()
+		}
+		cli.trace(ipcmsg.id, "message discarded by the sampling")
+		cli.countMessage(ipcmsg.topic, ResultSampled)
+		span.SetAttributes(resultAttribute(ResultSampled))
+		return ipcmsg.id, nil
+	}
 	cli.msgProcessed.Inc()
-	return data
+	if ipcmsg.ref != "" {
+		if data, err = cli.fetchPayload(ipcmsg.ref); err != nil {
+			cli.logger().Errorf("cannot fetch offloaded payload %s of message %s: %v", ipcmsg.ref, ipcmsg.id, err)
+			cli.countMessage(ipcmsg.topic, ResultUnavailable)
+			failSpan(span, "cannot fetch offloaded payload")
+			return ipcmsg.id, nil
+		}
+		cli.trace(ipcmsg.id, "offloaded payload %s fetched with %d bytes", ipcmsg.ref, len(data))
+	}
+	if decompressed, codec, err := cli.decompressPayload(data); err != nil {
+		cli.logger().Errorf("cannot decompress payload of message %s: %v", ipcmsg.id, err)
+		cli.countMessage(ipcmsg.topic, ResultInvalid)
+		failSpan(span, "cannot decompress payload")
+		return ipcmsg.id, nil
+	} else if codec != CompressionNone {
+		cli.trace(ipcmsg.id, "payload decompressed with %s from %d to %d bytes", codec, len(data), len(decompressed))
+		data = decompressed
+	}
+	cli.countMessage(ipcmsg.topic, ResultProcessed)
+	cli.observeMessageSize(ipcmsg.topic, len(data))
+	span.SetAttributes(resultAttribute(ResultProcessed))
+	startMessageSpan(ctx, msg, ipcmsg, links, len(data))
+	return ipcmsg.id, data
 }
 
-// isTelemetry Returns true if the client is expecting a Telemetry message.
-func (cli *KafkaClient) isTelemetry() bool {
-	return cli.isNetflow() || cli.isSflow()
+// isBuffered Returns true when a Kafka message is a chunk of a partial message on the reassembly buffer.
+// This is a concurrent safe method.
+func (cli *KafkaClient) isBuffered(msg *message.Message) bool {
+	id := cli.messageID(msg)
+	if id == "" {
+		return false
+	}
+	cli.mutex.RLock()
+	defer cli.mutex.RUnlock()
+	_, ok := cli.msgBuffer[id]
+	return ok
 }
 
-// isSflow Returns true if the client is expecting an Sflow message.
-func (cli *KafkaClient) isSflow() bool {
-	return strings.ToLower(cli.Parser) == "sflow"
+// bufferChunk Adds an intermediate chunk to the reassembly buffer.
+// This is a concurrent safe method.
+func (cli *KafkaClient) bufferChunk(ipcmsg *ipcMessage) {
+	cli.mutex.Lock()
+	defer cli.mutex.Unlock()
+	partial, ok := cli.msgBuffer[ipcmsg.id]
+	if !ok {
+		partial = &partialMessage{total: ipcmsg.total, firstSeen: time.Now(), topic: ipcmsg.topic, partition: ipcmsg.partition, offset: ipcmsg.offset}
+		cli.msgBuffer[ipcmsg.id] = partial
+		if err := cli.checkpoint.track(partial); err != nil {
+			cli.logger().Errorf("cannot update reassembly checkpoint: %v", err)
+		}
+	} else {
+		cli.checkAffinity(ipcmsg, partial.partition)
+	}
+	if partial.chunk < ipcmsg.chunk {
+		if partial.invalid == "" {
+			partial.invalid = partial.checkChunk(ipcmsg)
+		}
+		if partial.chunk == 0 {
+			partial.chunkSize = len(ipcmsg.content)
+		}
+		// Adds partial message to the buffer
+		if err := cli.appendChunk(ipcmsg.id, partial, ipcmsg.content); err != nil {
+			cli.logger().Errorf("cannot store chunk %d of message %s: %v", ipcmsg.chunk, ipcmsg.id, err)
+			cli.countDroppedChunks(ipcmsg.topic, DropStore, 1)
+			if partial.size == 0 {
+				delete(cli.msgBuffer, ipcmsg.id)
+			}
+			return
+		}
+		partial.chunk = ipcmsg.chunk
+		partial.lastSeen = time.Now()
+		if ipcmsg.span.IsValid() {
+			partial.links = append(partial.links, oteltrace.Link{SpanContext: ipcmsg.span})
+		}
+		cli.budget.Add(len(ipcmsg.content))
+		cli.trace(ipcmsg.id, "chunk %d of %d buffered, %d bytes received so far", ipcmsg.chunk, ipcmsg.total, partial.size)
+	} else {
+		cli.logger().Warnf("chunk %d from %s was already processed, ignoring...", ipcmsg.chunk, ipcmsg.id)
+		cli.countDroppedChunks(ipcmsg.topic, DropDuplicate, 1)
+	}
 }
 
-// isNetflow Returns true if the client is expecting a Netflow message.
-func (cli *KafkaClient) isNetflow() bool {
-	return strings.ToLower(cli.Parser) == "netflow"
+// checkAffinity Verifies that a chunk arrived from the same partition as the first chunk of the message.
+// Chunks of the same message spread across partitions break the ordering assumptions of the reassembly logic,
+// which is a sign of a misconfigured partitioning strategy on OpenNMS.
+func (cli *KafkaClient) checkAffinity(ipcmsg *ipcMessage, expected int32) {
+	if expected < 0 || ipcmsg.partition < 0 || expected == ipcmsg.partition {
+		return
+	}
+	cli.logger().Warnf("chunk %d of message %s arrived from partition %d, but the first chunk came from partition %d", ipcmsg.chunk, ipcmsg.id, ipcmsg.partition, expected)
+	if cli.affinityErrors != nil {
+		cli.affinityErrors.Inc()
+	}
+	if cli.OnAffinityViolation != nil {
+		cli.OnAffinityViolation(ipcmsg.id, expected, ipcmsg.partition)
+	}
 }
 
-// isSyslog Returns true if the client is expecting a Syslog message.
-func (cli *KafkaClient) isSyslog() bool {
-	return strings.ToLower(cli.Parser) == "syslog"
+// isTelemetry Returns true if the parser is expecting a Telemetry message.
+func isTelemetry(parser string) bool {
+	return isNetflow(parser) || isSflow(parser) || isRawTelemetry(parser)
 }
 
-// isSnmp Returns true if the client is expecting an SNMP Trap message.
-func (cli *KafkaClient) isSnmp() bool {
-	return strings.ToLower(cli.Parser) == "snmp"
+// isSflow Returns true if the parser is expecting an Sflow message.
+func isSflow(parser string) bool {
+	return strings.ToLower(parser) == "sflow"
 }
 
-// isHeartbeat Returns true if the client is expecting a Heartbeat message.
-func (cli *KafkaClient) isHeartbeat() bool {
-	return strings.ToLower(cli.Parser) == "heartbeat"
+// isNetflow Returns true if the parser is expecting a Netflow message, including IPFIX, as both share the same flow format.
+func isNetflow(parser string) bool {
+	p := strings.ToLower(parser)
+	return p == "netflow" || p == "ipfix"
 }
 
-// processPayload Processes the byte array payload and executed the action on success.
-func (cli *KafkaClient) processPayload(data []byte, action ProcessMessage) {
-	if cli.IPC == "rpc" {
-		action(data)
+// isRawTelemetry Returns true if the parser is expecting a telemetry message that cannot be decoded (NX-OS or JTI).
+func isRawTelemetry(parser string) bool {
+	p := strings.ToLower(parser)
+	return p == "nxos" || p == "jti"
+}
+
+// isSyslog Returns true if the parser is expecting a Syslog message.
+func isSyslog(parser string) bool {
+	return strings.ToLower(parser) == "syslog"
+}
+
+// isSnmp Returns true if the parser is expecting an SNMP Trap message.
+func isSnmp(parser string) bool {
+	return strings.ToLower(parser) == "snmp"
+}
+
+// isHeartbeat Returns true if the parser is expecting a Heartbeat message.
+func isHeartbeat(parser string) bool {
+	return strings.ToLower(parser) == "heartbeat"
+}
+
+// isEvents Returns true if the parser is expecting OpenNMS events.
+func isEvents(parser string) bool {
+	return strings.ToLower(parser) == "events"
+}
+
+// decodePayload Decodes the byte array payload based on the parser, and executes the action for each decoded message.
+// The action receives the decoded payload and the metadata extracted from the message.
+func (cli *KafkaClient) decodePayload(data []byte, topic, parser string, action func(payload []byte, meta Metadata)) {
+	if cli.IPC == "rpc" || cli.Raw {
+		action(data, Metadata{})
 		return
 	}
-	if cli.isTelemetry() {
+	if isTelemetry(parser) {
 		msgLog := &telemetry.TelemetryMessageLog{}
 		if err := proto.Unmarshal(data, msgLog); err != nil {
-			log.Printf("[warn] error processing telemetry message: %v", err)
+			cli.logger().Warnf("error processing telemetry message: %v", err)
+			cli.countUnmarshalFailure(topic, parser)
 			return
 		}
-		log.Printf("telemetry message from %s:%d at location %s (minion ID: %s)", msgLog.GetSourceAddress(), msgLog.GetSourcePort(), msgLog.GetLocation(), msgLog.GetSystemId())
+		cli.logger().Debugf("telemetry message from %s:%d at location %s (minion ID: %s)", msgLog.GetSourceAddress(), msgLog.GetSourcePort(), msgLog.GetLocation(), msgLog.GetSystemId())
+		meta := Metadata{Location: msgLog.GetLocation(), SystemID: msgLog.GetSystemId(), SourceAddress: msgLog.GetSourceAddress()}
 		for _, msg := range msgLog.Message {
-			if cli.isNetflow() {
+			if ts := msg.GetTimestamp(); ts > 0 {
+				cli.observeMinionLatency(parser, meta.Location, time.Unix(0, int64(ts)*int64(time.Millisecond)))
+			}
+			var bytes []byte
+			if isNetflow(parser) {
 				flow := &netflow.FlowMessage{}
 				if err := proto.Unmarshal(msg.Bytes, flow); err != nil {
-					log.Printf("[warn] invalid netflow message received: %v", err)
-					return
+					cli.logger().Warnf("invalid netflow message received, emitting the raw packet: %v", err)
+					cli.countUnmarshalFailure(topic, parser)
+					bytes, _ = marshalIndent(newRawTelemetry(msgLog, msg))
+				} else {
+					bytes, _ = marshalIndent(flow)
 				}
-				bytes, _ := json.MarshalIndent(flow, "", "  ")
-				action(bytes)
-			} else if cli.isSflow() {
+			} else if isSflow(parser) {
 				doc := &bson.D{} // Assuming BSON Document
 				if err := bson.Unmarshal(msg.Bytes, doc); err != nil {
-					log.Printf("[warn] invalid sflow message received: %v", err)
-					return
+					cli.logger().Warnf("invalid sflow message received, emitting the raw packet: %v", err)
+					cli.countUnmarshalFailure(topic, parser)
+					bytes, _ = marshalIndent(newRawTelemetry(msgLog, msg))
+				} else {
+					bytes, _ = marshalIndent(doc)
 				}
-				bytes, _ := json.MarshalIndent(doc, "", "  ")
-				action(bytes)
 			} else {
-				log.Println("[warn] cannot parse telemetry message due to invalid parser")
+				bytes, _ = marshalIndent(newRawTelemetry(msgLog, msg))
 			}
+			action(bytes, meta)
 		}
-	} else if cli.isSyslog() {
+	} else if isSyslog(parser) {
 		syslog := &SyslogMessageLogDTO{}
 		if err := xml.Unmarshal(data, syslog); err != nil {
-			log.Printf("[warn] invalid syslog message received: %v", err)
+			cli.logger().Warnf("invalid syslog message received: %v", err)
+			cli.countUnmarshalFailure(topic, parser)
 			return
 		}
-		action([]byte(syslog.String()))
-	} else if cli.isSnmp() {
+		for _, m := range syslog.Messages {
+			if ts, err := time.Parse(time.RFC3339Nano, m.Timestamp); err == nil {
+				cli.observeMinionLatency(parser, syslog.Location, ts)
+			}
+		}
+		action([]byte(syslog.String()), Metadata{Location: syslog.Location, SystemID: syslog.SystemID, SourceAddress: syslog.SourceAddress})
+	} else if isSnmp(parser) {
 		trap := &TrapLogDTO{}
 		if err := xml.Unmarshal(data, trap); err != nil {
-			log.Printf("[warn] invalid snmp trap message received: %v", err)
+			cli.logger().Warnf("invalid snmp trap message received: %v", err)
+			cli.countUnmarshalFailure(topic, parser)
+			return
+		}
+		if cli.TrapStats != nil {
+			cli.TrapStats.Record(trap)
+		}
+		for _, t := range trap.Messages {
+			if t.CreationTime > 0 {
+				cli.observeMinionLatency(parser, trap.Location, time.Unix(0, t.CreationTime*int64(time.Millisecond)))
+			}
+		}
+		action([]byte(trap.String()), Metadata{Location: trap.Location, SystemID: trap.SystemID, SourceAddress: trap.TrapAddress})
+	} else if isEvents(parser) {
+		events := &EventLogDTO{}
+		if err := xml.Unmarshal(data, events); err != nil {
+			cli.logger().Warnf("invalid events message received: %v", err)
+			cli.countUnmarshalFailure(topic, parser)
+			return
+		}
+		action([]byte(events.String()), events.metadata())
+	} else if isHeartbeat(parser) {
+		heartbeat := &HeartbeatDTO{}
+		if err := xml.Unmarshal(data, heartbeat); err != nil {
+			cli.logger().Debugf("heartbeat message is not a Minion heartbeat, passing it as is: %v", err)
+			action(data, Metadata{})
 			return
 		}
-		action([]byte(trap.String()))
-	} else if cli.isHeartbeat() {
-		action(data)
+		recordHeartbeat(heartbeat)
+		action([]byte(heartbeat.String()), Metadata{Location: heartbeat.Location, SystemID: heartbeat.ID})
 	} else {
-		log.Printf("[error] invalid parser %s, ignoring payload", cli.Parser)
+		cli.logger().Errorf("invalid parser %s, ignoring payload", parser)
 	}
 }
 
@@ -247,16 +878,14 @@ func (cli *KafkaClient) processPayload(data []byte, action ProcessMessage) {
 // This is a concurrent safe method.
 func (cli *KafkaClient) bufferCleanup(id string) {
 	cli.mutex.Lock()
-	delete(cli.msgBuffer, id)
-	delete(cli.chunkTracker, id)
+	if partial, ok := cli.msgBuffer[id]; ok {
+		cli.discardPartial(id, partial)
+	}
 	cli.mutex.Unlock()
 }
 
-// Initialize Builds the Kafka consumer object and the cache for chunk handling.
-func (cli *KafkaClient) Initialize(ctx context.Context) error {
-	if cli.msgChannel != nil {
-		return fmt.Errorf("consumer already initialized")
-	}
+// Validate Verifies the client settings, applying defaults when necessary.
+func (cli *KafkaClient) Validate() error {
 	if cli.IPC == "" {
 		cli.IPC = "sink"
 	} else {
@@ -269,46 +898,391 @@ func (cli *KafkaClient) Initialize(ctx context.Context) error {
 			return fmt.Errorf("invalid Sink parser %s; expecting %s", cli.Parser, AvailableParsers.EnumAsString())
 		}
 	}
+	if err := cli.validateTopics(); err != nil {
+		return err
+	}
+	if err := cli.validateCommitPolicy(); err != nil {
+		return err
+	}
+	if err := cli.validateDelivery(); err != nil {
+		return err
+	}
+	if err := cli.validateWireFormat(); err != nil {
+		return err
+	}
+	if err := cli.validatePayloadCompression(); err != nil {
+		return err
+	}
+	if err := cli.validateCircuitBreaker(); err != nil {
+		return err
+	}
+	if err := cli.validateRateLimits(); err != nil {
+		return err
+	}
+	if err := cli.validateSeek(); err != nil {
+		return err
+	}
+	if cli.Source != nil && cli.ReassemblyCheckpoint != "" {
+		return fmt.Errorf("the reassembly checkpoint requires the Kafka consumer")
+	}
+	if cli.PartialBufferFile != "" && cli.ReassemblyCheckpoint != "" {
+		return fmt.Errorf("the partial buffer file and the reassembly checkpoint are mutually exclusive")
+	}
+	if cli.ShutdownTimeout < 0 {
+		return fmt.Errorf("invalid shutdown timeout %s", cli.ShutdownTimeout)
+	}
+	if err := cli.TLS.Validate(); err != nil {
+		return fmt.Errorf("invalid TLS settings: %v", err)
+	}
+	if err := cli.SASL.Validate(); err != nil {
+		return fmt.Errorf("invalid SASL settings: %v", err)
+	}
+	if _, err := cli.createConfig(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Initialize Builds the Kafka consumer object and the cache for chunk handling.
+func (cli *KafkaClient) Initialize(ctx context.Context) error {
+	if cli.msgChannel != nil {
+		return fmt.Errorf("consumer already initialized")
+	}
+	if err := cli.Validate(); err != nil {
+		return err
+	}
 
-	var err error
-	log.Printf("[info] creating consumer for topic %s at %s", cli.Topic, cli.Bootstrap)
-	cli.subscriber, err = kafka.NewSubscriber(
-		kafka.SubscriberConfig{
-			Brokers:               []string{cli.Bootstrap},
-			Unmarshaler:           kafka.DefaultMarshaler{},
-			OverwriteSaramaConfig: cli.createConfig(),
-			ConsumerGroup:         cli.GroupID,
-		},
-		watermill.NewStdLogger(false, false),
-	)
+	config, err := cli.createConfig()
 	if err != nil {
-		return fmt.Errorf("cannot create consumer: %v", err)
+		return err
+	}
+	atomic.StoreInt32(&cli.reloading, 0)
+	if cli.Source == nil {
+		if err := cli.seekOffsets(config); err != nil {
+			return err
+		}
+	}
+	if guarantee := cli.DeliveryGuarantee(); guarantee != DeliveryAtMostOnce {
+		cli.logger().Infof("messages are acknowledged after their %s delivery", guarantee)
 	}
-	cli.msgChannel, err = cli.subscriber.Subscribe(ctx, cli.Topic)
+	ctx, cli.cancel = context.WithCancel(ctx)
+	cli.ctx = ctx
+	cli.done = ctx.Done()
+	if cli.Source != nil {
+		cli.logger().Infof("subscribing to topic %s through %T", cli.Topic, cli.Source)
+		cli.subscriber = cli.Source
+	} else {
+		cli.logger().Infof("creating consumer for topic %s at %s", cli.Topic, cli.Bootstrap)
+		cli.subscriber = newGroupConsumer(cli, config)
+	}
+	cli.msgChannel, err = cli.subscribe(ctx)
 	if err != nil {
-		return fmt.Errorf("cannot subscribe to topic %s: %v", cli.Topic, err)
+		cli.closeSubscriber()
+		return err
 	}
 
 	cli.createVariables()
 	cli.createCounters()
+	cli.draining = make(chan struct{})
+	if err := cli.restorePartialMessages(); err != nil {
+		cli.closeSubscriber()
+		return err
+	}
+	if err := cli.recoverPartialMessages(config); err != nil {
+		cli.closeSubscriber()
+		return err
+	}
 	return nil
 }
 
+// closeSubscriber Closes the Kafka consumer.
+// The external sources are not closed, as they are owned by the caller and can be shared by multiple clients;
+// their subscriptions end when the context of the client is cancelled.
+func (cli *KafkaClient) closeSubscriber() {
+	if cli.subscriber == nil {
+		return
+	}
+	if cli.Source == nil {
+		if err := cli.subscriber.Close(); err != nil {
+			cli.logger().Warnf("cannot close consumer: %v", err)
+		}
+	}
+	cli.subscriber = nil
+}
+
 // Start Registers the consumer for the chosen topic, and reads messages from it on an infinite loop.
 // It is recommended to use it within a Go Routine as it is a blocking operation.
+//
+// Deprecated: use Handle, which receives the decoded messages with their coordinates and metadata, and supports failures.
 func (cli *KafkaClient) Start(action ProcessMessage) {
-	if cli.msgChannel == nil {
+	cli.consume(func(msg DecodedMessage) error {
+		action(msg.Payload)
+		return nil
+	})
+}
+
+// consume Reads messages from the chosen topic on an infinite loop.
+// The action receives each decoded message, including the Kafka coordinates and the extracted metadata.
+// The Kafka message is acknowledged after the action was executed for all its payloads.
+func (cli *KafkaClient) consume(action MessageHandler) {
+	msgChannel := cli.msgChannel
+	if msgChannel == nil {
 		log.Fatal("consumer not initialized")
 	}
 
-	jsonBytes, _ := json.Marshal(cli)
-	log.Printf("[info] starting kafka consumer: %s", string(jsonBytes))
+	jsonBytes, _ := Sanitize(cli)
+	cli.logger().Infof("starting kafka consumer: %s", string(jsonBytes))
+
+	atomic.StoreInt32(&cli.stopping, 0)
+	drained := make(chan struct{})
+	defer close(drained) // After waiting for the workers
+	cli.mutex.Lock()
+	draining := cli.draining
+	cli.drained = drained
+	cli.mutex.Unlock()
+	go cli.runJanitor(cli.done)
+	go cli.runSLOReport(cli.done)
+	go cli.runCheckpoint(cli.done, cli.reassemblyCheckpoint())
+	go cli.runLagMonitor(cli.done)
+	go cli.watchSecrets(cli.done, cli.cancel)
+	dispatch, wait, crashed := cli.startWorkers(action)
+	defer wait()
+	lastMessage := time.Now() // Before starting the idle timer, so the first idle period is not shorter than the timeout
+	var idle <-chan time.Time
+	var idleTimer *time.Timer
+	if cli.OnIdle != nil && cli.IdleTimeout > 0 {
+		idleTimer = time.NewTimer(cli.IdleTimeout)
+		defer idleTimer.Stop()
+		idle = idleTimer.C
+	}
+	var held []*message.Message // The new messages received while the pending bytes are over budget
+	for {
+		if !cli.gate.wait(cli.done) {
+			break
+		}
+		if !cli.breaker.wait(cli.done) {
+			break
+		}
+		var admitted <-chan struct{}
+		if len(held) > 0 {
+			admitted = cli.budget.whenAdmitted()
+		}
+		select {
+		case msg, ok := <-msgChannel:
+			if !ok {
+				return
+			}
+			lastMessage = time.Now()
+			resetTimer(idleTimer, cli.IdleTimeout)
+			if !cli.limiter.wait(len(msg.Payload), cli.done) {
+				return // Not acknowledged, so it is delivered again after restarting
+			}
+			// Backpressure: hold the new messages while the pending bytes are over budget, which pauses their partitions
+			// until they are acknowledged, but keep reading the chunks that complete the partial messages to release them
+			if !cli.budget.Admitted() && !cli.isBuffered(msg) {
+				held = append(held, msg)
+				continue
+			}
+			if !cli.partitions.hold(cli.topicOf(msg), msg, lastMessage) && !dispatch(msg) {
+				return
+			}
+		case <-admitted:
+			for _, msg := range held {
+				if !cli.partitions.hold(cli.topicOf(msg), msg, time.Now()) && !dispatch(msg) {
+					return
+				}
+			}
+			held = nil
+		case msg := <-cli.partitions.resumed:
+			if !dispatch(msg) { // Already accounted by the rate limits
+				return
+			}
+		case now := <-idle:
+			cli.OnIdle(now.Sub(lastMessage))
+			idleTimer.Reset(cli.IdleTimeout)
+		case <-draining:
+			return
+		case <-crashed:
+			return
+		}
+	}
+}
+
+// resetTimer Restarts a timer, discarding the pending expiration if any.
+// It does nothing when the timer is nil.
+func resetTimer(timer *time.Timer, d time.Duration) {
+	if timer == nil {
+		return
+	}
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(d)
+}
+
+// startWorkers Returns a function to dispatch the messages to a bounded pool of workers, and a function to wait for the in-flight messages once the dispatching is finished.
+// Each message is acknowledged by its worker once it was processed, and as the subscriber waits for the acknowledgement before
+// delivering the next message from the same partition, the messages of one partition are still processed in order.
+// Without workers, the messages are processed inline.
+// The dispatched messages are accounted as bytes in flight by the budget until they are processed.
+// A panic on a worker closes the crashed channel and stops the dispatching (which returns false), and it is raised again by wait
+// on the calling goroutine, so it fails the pipeline like a panic processing the messages inline, instead of crashing the process.
+func (cli *KafkaClient) startWorkers(action MessageHandler) (dispatch func(msg *message.Message) bool, wait func(), crashed <-chan struct{}) {
+	if cli.Workers <= 1 {
+		return func(msg *message.Message) bool {
+			cli.budget.AddInFlight(len(msg.Payload))
+			defer cli.budget.ReleaseInFlight(len(msg.Payload))
+			cli.handleMessage(msg, action)
+			return true
+		}, func() {}, nil
+	}
+	jobs := make(chan *message.Message)
+	failed := make(chan struct{})
+	var once sync.Once
+	var crash interface{}
+	wg := &sync.WaitGroup{}
+	for i := 0; i < cli.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					once.Do(func() {
+						crash = r
+						close(failed)
+					})
+				}
+			}()
+			for msg := range jobs {
+				func() {
+					defer cli.budget.ReleaseInFlight(len(msg.Payload))
+					cli.handleMessage(msg, action)
+				}()
+			}
+		}()
+	}
+	dispatch = func(msg *message.Message) bool {
+		cli.budget.AddInFlight(len(msg.Payload))
+		select {
+		case jobs <- msg:
+			return true
+		case <-failed:
+			cli.budget.ReleaseInFlight(len(msg.Payload))
+			return false // Not acknowledged, so it is delivered again after restarting
+		}
+	}
+	wait = func() {
+		close(jobs)
+		wg.Wait()
+		if crash != nil {
+			panic(fmt.Sprintf("worker crashed: %v", crash))
+		}
+	}
+	return dispatch, wait, failed
+}
+
+// handleMessage Processes a Kafka message, executing the action for each decoded message when the IPC message is complete.
+// The Kafka message is acknowledged afterwards, unless the client stopped while retrying the action.
+func (cli *KafkaClient) handleMessage(msg *message.Message, action MessageHandler) {
+	defer endMessageSpan(msg)
+	topic := cli.topicOf(msg)
+	parser := cli.parserFor(topic)
+	id, data := cli.reassemble(msg)
+	if data != nil { // The reassembled payload is in flight until it is processed by the action and the outputs
+		cli.budget.AddInFlight(len(data))
+		defer cli.budget.ReleaseInFlight(len(data))
+	}
+	if data = cli.anonymize(data, parser); data != nil {
+		decodeSpan := startDecodeSpan(msg, parser)
+		capturing := cli.Captures != nil && cli.Captures.Active()
+		var captured []DecodedMessage
+		delivered := true
+		decodedCount := 0
+		cli.decodePayload(data, topic, parser, func(payload []byte, meta Metadata) {
+			if !delivered {
+				return
+			}
+			decodedCount++
+			decoded := cli.newDecodedMessage(msg, payload)
+			decoded.Metadata = meta
+			decoded.id = id
+			decoded.spanContext = messageSpan(msg).SpanContext()
+			cli.trace(id, "decoded %s message %d with %d bytes", parser, decodedCount, len(payload))
+			if !cli.filter().Allows(decoded) {
+				if cli.ruleFiltered != nil {
+					cli.ruleFiltered.Inc()
+				}
+				cli.trace(id, "decoded message %d discarded by the filter rules", decodedCount)
+				return
+			}
+			if !cli.transform(&decoded) {
+				return
+			}
+			if delivered = cli.deliver(decoded, action); !delivered {
+				cli.trace(id, "processing interrupted while retrying the action")
+				return
+			}
+			cli.trace(id, "decoded message %d processed by the action", decodedCount)
+			if delivered = cli.sendOutputs(decoded); !delivered {
+				cli.trace(id, "processing interrupted while retrying the outputs")
+				return
+			}
+			if capturing {
+				captured = append(captured, decoded)
+			}
+		})
+		if len(captured) > 0 {
+			last := captured[len(captured)-1]
+			cli.Captures.Record(captured, func() *CaptureRecord {
+				return cli.captureRecord(last, id, data) // Keeps the original ID, for the deduplication and the tracing on replay
+			})
+		}
+		endDecodeSpan(decodeSpan, decodedCount)
+		if decodedCount == 0 {
+			cli.trace(id, "no message decoded with the %s parser", parser)
+		}
+		if !delivered {
+			return
+		}
+		cli.processed(id)
+		cli.trackLatency(msg)
+	}
+	msg.Ack()
+}
+
+// trackLatency Records the end-to-end latency of a processed message when the SLO is enabled.
+func (cli *KafkaClient) trackLatency(msg *message.Message) {
+	if cli.slo == nil {
+		return
+	}
+	if ts := recordMetadata(msg).Timestamp; !ts.IsZero() {
+		now := time.Now()
+		cli.slo.record(now.Sub(ts), now)
+	}
+}
 
-	cli.stopping = false
-	for msg := range cli.msgChannel {
-		if data := cli.processMessage(msg); data != nil {
-			cli.processPayload(data, action)
+// Stop Closes the Kafka consumer, which terminates the loop started by Start.
+// With a ShutdownTimeout, it stops reading new messages and waits for the in-flight ones first, so their final offsets are committed
+// when the consumer is closed; with a PartialBufferFile, the partial messages are saved to be restored by the next Initialize.
+// The client can be initialized again afterwards.
+func (cli *KafkaClient) Stop() {
+	atomic.StoreInt32(&cli.stopping, 1)
+	if !cli.drain() {
+		cli.logger().Warnf("the in-flight messages were not processed within %s, stopping anyway", cli.ShutdownTimeout)
+	}
+	cli.refreshCheckpoint()
+	if cli.PartialBufferFile != "" && cli.msgBuffer != nil {
+		if err := cli.savePartialMessages(); err != nil {
+			cli.logger().Errorf("cannot save partial messages: %v", err)
 		}
-		msg.Ack()
 	}
+	if cli.cancel != nil {
+		cli.cancel()
+		cli.cancel = nil
+	}
+	cli.closeSubscriber()
+	cli.msgChannel = nil
 }
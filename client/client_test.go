@@ -5,6 +5,7 @@ package client
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"strings"
@@ -12,6 +13,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Shopify/sarama"
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill-kafka/v2/pkg/kafka"
 	"github.com/ThreeDotsLabs/watermill/message"
@@ -19,9 +21,9 @@ import (
 	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/netflow"
 	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/sink"
 	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/telemetry"
-	"github.com/golang/protobuf/proto"
-	"github.com/golang/protobuf/ptypes/wrappers"
 	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 	"gotest.tools/v3/assert"
 )
 
@@ -142,12 +144,12 @@ func TestNetflowParser(t *testing.T) {
 		NetflowVersion: netflow.NetflowVersion_V9,
 		Direction:      netflow.Direction_EGRESS,
 		Timestamp:      ts,
-		DeltaSwitched:  &wrappers.UInt64Value{Value: ts},
-		FirstSwitched:  &wrappers.UInt64Value{Value: ts},
-		LastSwitched:   &wrappers.UInt64Value{Value: ts + 1},
+		DeltaSwitched:  &wrapperspb.UInt64Value{Value: ts},
+		FirstSwitched:  &wrapperspb.UInt64Value{Value: ts},
+		LastSwitched:   &wrapperspb.UInt64Value{Value: ts + 1},
 		SrcAddress:     "11.0.0.1",
 		DstAddress:     "12.0.0.2",
-		NumBytes:       &wrappers.UInt64Value{Value: 1000},
+		NumBytes:       &wrapperspb.UInt64Value{Value: 1000},
 	}
 	netflowBytes, err := proto.Marshal(netflow)
 	assert.NilError(t, err)
@@ -177,6 +179,86 @@ func TestNetflowParser(t *testing.T) {
 	cancel()
 }
 
+func TestTelemetryParsers(t *testing.T) {
+	cli := &KafkaClient{IPC: "sink"}
+	ts := uint64(1616785647091)
+	flow, err := proto.Marshal(&netflow.FlowMessage{NetflowVersion: netflow.NetflowVersion_IPFIX, SrcAddress: "11.0.0.1"})
+	assert.NilError(t, err)
+	build := func(bytes []byte) []byte {
+		data, err := proto.Marshal(&telemetry.TelemetryMessageLog{
+			Location:      proto.String("Apex"),
+			SystemId:      proto.String("minion01"),
+			SourceAddress: proto.String("10.0.0.1"),
+			SourcePort:    proto.Uint32(50000),
+			Message:       []*telemetry.TelemetryMessage{{Timestamp: &ts, Bytes: bytes}},
+		})
+		assert.NilError(t, err)
+		return data
+	}
+
+	// IPFIX flows are decoded like Netflow
+	var payload string
+	var meta Metadata
+	cli.decodePayload(build(flow), "OpenNMS.Sink.Telemetry-IPFIX", "ipfix", func(p []byte, m Metadata) {
+		payload, meta = string(p), m
+	})
+	assert.Assert(t, strings.Contains(payload, `"src_address": "11.0.0.1"`))
+	assert.Equal(t, "10.0.0.1", meta.SourceAddress)
+
+	// Streaming telemetry is emitted as is
+	cli.decodePayload(build([]byte("JTI")), "OpenNMS.Sink.Telemetry-JTI", "jti", func(p []byte, m Metadata) {
+		payload, meta = string(p), m
+	})
+	assert.Equal(t, `{
+  "timestamp": 1616785647091,
+  "sourceAddress": "10.0.0.1",
+  "sourcePort": 50000,
+  "bytes": "SlRJ"
+}`, payload)
+	assert.Equal(t, "Apex", meta.Location)
+	assert.Equal(t, "minion01", meta.SystemID)
+	assert.Equal(t, "nxos", inferParser("OpenNMS.Sink.Telemetry-NXOS"))
+
+	// The packets that can't be decoded are emitted as is
+	payload = ""
+	cli.decodePayload(build([]byte("JTI")), "OpenNMS.Sink.Telemetry-SFlow", "sflow", func(p []byte, m Metadata) {
+		payload, meta = string(p), m
+	})
+	assert.Assert(t, strings.Contains(payload, `"bytes": "SlRJ"`), payload)
+	assert.Equal(t, "10.0.0.1", meta.SourceAddress)
+}
+
+func TestRawEnvelope(t *testing.T) {
+	cli := &KafkaClient{Topic: "OpenNMS.Sink.Syslog", IPC: "sink", Parser: "syslog", Raw: true}
+	assert.NilError(t, cli.Validate())
+	var payload []byte
+	cli.decodePayload([]byte("<not-syslog/>"), cli.Topic, cli.Parser, func(p []byte, m Metadata) {
+		payload = p
+	})
+	assert.Equal(t, "<not-syslog/>", string(payload))
+
+	// The key of the records is kept, but not exposed as a header
+	msg, err := recordUnmarshaler{}.Unmarshal(&sarama.ConsumerMessage{
+		Key:     []byte("001"),
+		Value:   []byte("data"),
+		Headers: []*sarama.RecordHeader{{Key: []byte("tenant"), Value: []byte("acme")}},
+	})
+	assert.NilError(t, err)
+	decoded := cli.newDecodedMessage(msg, payload)
+	assert.Equal(t, "001", string(decoded.Key))
+	assert.DeepEqual(t, map[string]string{"tenant": "acme"}, decoded.Headers)
+	assert.Assert(t, !decoded.Received.IsZero())
+
+	data, err := decoded.Envelope()
+	assert.NilError(t, err)
+	envelope := forwardEnvelope{}
+	assert.NilError(t, json.Unmarshal(data, &envelope))
+	assert.Equal(t, "OpenNMS.Sink.Syslog", envelope.Topic)
+	assert.Equal(t, "001", string(envelope.Key))
+	assert.Equal(t, "acme", envelope.Headers["tenant"])
+	assert.Equal(t, "<not-syslog/>", string(envelope.Content))
+}
+
 func runProcessMessageTest(t *testing.T, wg *sync.WaitGroup, cli *KafkaClient, id string) {
 	var data []byte
 	data = cli.processMessage(buildMessage(id, 0, 3, []byte("ABC")))
@@ -230,3 +312,341 @@ func createKafkaClient() (*KafkaClient, *gochannel.GoChannel, context.CancelFunc
 	})
 	return cli, pubSub, cancel
 }
+
+func TestEvictPartialMessages(t *testing.T) {
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	cli.ChunkStallTimeout = time.Minute
+	cli.ChunkMaxAge = 5 * time.Minute
+	evicted := map[string]string{}
+	cli.OnPartialMessageEvicted = func(id, reason string, chunks, total int32) {
+		assert.Equal(t, int32(1), chunks)
+		assert.Equal(t, int32(3), total)
+		evicted[id] = reason
+	}
+
+	now := time.Now()
+	assert.Assert(t, cli.processMessage(buildMessage("stalled", 0, 3, []byte("ABC"))) == nil)
+	assert.Assert(t, cli.processMessage(buildMessage("expired", 0, 3, []byte("ABC"))) == nil)
+	assert.Assert(t, cli.processMessage(buildMessage("active", 0, 3, []byte("ABC"))) == nil)
+	cli.msgBuffer["stalled"].lastSeen = now.Add(-2 * time.Minute)
+	cli.msgBuffer["expired"].firstSeen = now.Add(-10 * time.Minute)
+
+	stalled, expired := cli.evictPartialMessages(now)
+	assert.Equal(t, 1, stalled)
+	assert.Equal(t, 1, expired)
+	assert.Equal(t, 1, len(cli.msgBuffer))
+	assert.Equal(t, int64(3), cli.budget.Pending())
+	assert.Assert(t, cli.msgBuffer["active"] != nil)
+	assert.DeepEqual(t, map[string]string{"stalled": EvictionStalled, "expired": EvictionExpired}, evicted)
+}
+
+func TestCheckAffinity(t *testing.T) {
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	violations := 0
+	cli.OnAffinityViolation = func(id string, expected, actual int32) {
+		assert.Equal(t, "0001", id)
+		assert.Equal(t, int32(1), expected)
+		assert.Equal(t, int32(2), actual)
+		violations++
+	}
+	cli.checkAffinity(&ipcMessage{id: "0001", chunk: 2, partition: 1}, 1)
+	cli.checkAffinity(&ipcMessage{id: "0001", chunk: 2, partition: -1}, 1)
+	cli.checkAffinity(&ipcMessage{id: "0001", chunk: 2, partition: 2}, 1)
+	assert.Equal(t, 1, violations)
+}
+
+func TestMessagesChannel(t *testing.T) {
+	cli, sub, cancel := createKafkaClient()
+	defer cancel()
+	cli.Parser = "heartbeat"
+	messages := cli.Messages()
+
+	sub.Publish("Test", buildMessage("001", 0, 1, []byte("ABC")))
+	select {
+	case msg := <-messages:
+		assert.Equal(t, "ABC", string(msg.Payload))
+		assert.Equal(t, "Test", msg.Topic)
+		assert.Equal(t, "heartbeat", msg.Parser)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	cli.Parser = "heartbeat"
+	cli.Workers = 3
+	started := make(chan string, cli.Workers)
+	release := make(chan struct{})
+	dispatch, wait, _ := cli.startWorkers(func(msg DecodedMessage) error {
+		started <- string(msg.Payload)
+		<-release
+		return nil
+	})
+
+	var messages []*message.Message
+	for i := 0; i < cli.Workers; i++ {
+		msg := buildMessage(fmt.Sprintf("msg%d", i), 0, 1, []byte("ABC"))
+		messages = append(messages, msg)
+		dispatch(msg)
+	}
+	for i := 0; i < cli.Workers; i++ { // All the messages are processed concurrently
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for workers")
+		}
+	}
+	for _, msg := range messages {
+		select {
+		case <-msg.Acked():
+			t.Fatal("message acknowledged before the action finished")
+		default:
+		}
+	}
+	close(release)
+	wait()
+	for _, msg := range messages {
+		<-msg.Acked()
+	}
+}
+
+func TestCommitOnSuccess(t *testing.T) {
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	cli.Parser = "heartbeat"
+	cli.CommitPolicy = CommitOnSuccess
+	cli.CommitRetryDelay = 10 * time.Millisecond
+	done := make(chan struct{})
+	cli.done = done
+	attempts := 0
+	handler := func(msg DecodedMessage) error {
+		if attempts++; attempts < 3 {
+			return fmt.Errorf("failure %d", attempts)
+		}
+		return nil
+	}
+
+	msg := buildMessage("001", 0, 1, []byte("ABC"))
+	cli.handleMessage(msg, handler)
+	assert.Equal(t, 3, attempts)
+	<-msg.Acked()
+
+	// The message is not acknowledged when the client stops while retrying
+	cli.CommitRetryDelay = time.Minute
+	close(done)
+	attempts = 0
+	msg = buildMessage("002", 0, 1, []byte("ABC"))
+	cli.handleMessage(msg, handler)
+	assert.Equal(t, 1, attempts)
+	select {
+	case <-msg.Acked():
+		t.Fatal("message acknowledged after a failure")
+	default:
+	}
+
+	// Failures are only logged with the other policies
+	cli.CommitPolicy = CommitPerMessage
+	attempts = 0
+	msg = buildMessage("003", 0, 1, []byte("ABC"))
+	cli.handleMessage(msg, handler)
+	assert.Equal(t, 1, attempts)
+	<-msg.Acked()
+}
+
+func TestActionRetry(t *testing.T) {
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	cli.Parser = "heartbeat"
+	cli.ActionRetry = RetryPolicy{MaxAttempts: 3, Delay: time.Millisecond, Multiplier: 2, MaxDelay: 3 * time.Millisecond, Jitter: 0.5}
+	assert.NilError(t, cli.validateCommitPolicy())
+	deadLetter := &countingOutput{name: "forward:dead-letter"}
+	cli.DeadLetter = deadLetter
+	attempts := 0
+	handler := func(msg DecodedMessage) error {
+		attempts++
+		return fmt.Errorf("failure %d", attempts)
+	}
+
+	// The message is acknowledged and sent to the dead letter output once the attempts are exhausted
+	msg := buildMessage("001", 0, 1, []byte("ABC"))
+	cli.handleMessage(msg, handler)
+	assert.Equal(t, 3, attempts)
+	<-msg.Acked()
+	assert.Equal(t, 1, deadLetter.sent)
+	assert.Equal(t, "failure 3", deadLetter.last.Headers["error"])
+
+	// The delay grows exponentially up to the maximum, reduced by the jitter
+	policy := RetryPolicy{Delay: time.Second, MaxDelay: 3 * time.Second}.withDefaults(0)
+	assert.Equal(t, time.Second, policy.backoff(1))
+	assert.Equal(t, 2*time.Second, policy.backoff(2))
+	assert.Equal(t, 3*time.Second, policy.backoff(3))
+	policy.Jitter = 0.5
+	delay := policy.backoff(1)
+	assert.Assert(t, delay >= 500*time.Millisecond && delay <= time.Second)
+
+	cli.ActionRetry = RetryPolicy{Jitter: 2}
+	assert.ErrorContains(t, cli.validateCommitPolicy(), "invalid retry jitter")
+}
+
+func TestOnIdle(t *testing.T) {
+	cli, sub, cancel := createKafkaClient()
+	defer cancel()
+	cli.Parser = "heartbeat"
+	cli.IdleTimeout = 50 * time.Millisecond
+	idle := make(chan time.Duration, 10)
+	cli.OnIdle = func(d time.Duration) {
+		idle <- d
+	}
+	messages := cli.Messages()
+
+	select {
+	case d := <-idle:
+		assert.Assert(t, d >= cli.IdleTimeout)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for idle callback")
+	}
+	sub.Publish("Test", buildMessage("001", 0, 1, []byte("ABC")))
+	<-messages
+	for len(idle) > 0 { // Discard the callbacks executed before the message arrived
+		<-idle
+	}
+	select {
+	case d := <-idle:
+		assert.Assert(t, d >= cli.IdleTimeout)
+		assert.Assert(t, d < time.Second)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for idle callback")
+	}
+}
+
+func TestPartitionController(t *testing.T) {
+	pc := newPartitionController(2)
+	pauses := 0
+	pc.onPause = func(tp TopicPartition, reason string) {
+		pauses++
+	}
+	now := time.Now()
+	msg := buildMessage("001", 0, 1, []byte("ABC"))
+	p1 := TopicPartition{"Test", 1}
+	p2 := TopicPartition{"Test", 2}
+
+	// Hot partition
+	assert.Assert(t, !pc.holdFrom(p1, msg, now))
+	assert.Assert(t, !pc.holdFrom(p1, msg, now))
+	assert.Assert(t, !pc.holdFrom(p2, msg, now))
+	assert.Assert(t, pc.holdFrom(p1, msg, now))
+	assert.DeepEqual(t, []TopicPartition{p1}, pc.pausedPartitions())
+	select {
+	case released := <-pc.resumed:
+		assert.Equal(t, msg, released)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for the held message")
+	}
+	assert.Equal(t, 0, len(pc.pausedPartitions()))
+
+	// Manual pause
+	pc.pause(p2)
+	assert.Assert(t, pc.holdFrom(p2, msg, now))
+	pc.release(p2, false)
+	assert.DeepEqual(t, []TopicPartition{p2}, pc.pausedPartitions())
+	go pc.release(p2, true)
+	assert.Equal(t, msg, <-pc.resumed)
+	assert.Equal(t, 0, len(pc.pausedPartitions()))
+	assert.Equal(t, 2, pauses)
+}
+
+func TestMultipleTopics(t *testing.T) {
+	cli := &KafkaClient{Topic: "OpenNMS.Sink.Trap, OpenNMS.Sink.Syslog,OpenNMS.Sink.Telemetry-Netflow-9,Custom.Flows:sflow,Custom", Parser: "heartbeat"}
+	assert.NilError(t, cli.Validate())
+	assert.DeepEqual(t, []TopicConfig{
+		{"OpenNMS.Sink.Trap", "snmp"},
+		{"OpenNMS.Sink.Syslog", "syslog"},
+		{"OpenNMS.Sink.Telemetry-Netflow-9", "netflow"},
+		{"Custom.Flows", "sflow"},
+		{"Custom", "heartbeat"},
+	}, cli.Topics())
+
+	msg := buildMessage("001", 0, 1, []byte("ABC"))
+	assert.Equal(t, "OpenNMS.Sink.Trap", cli.topicOf(msg))
+	msg.SetContext(context.WithValue(msg.Context(), topicContextKey{}, "OpenNMS.Sink.Syslog"))
+	decoded := cli.newDecodedMessage(msg, []byte("ABC"))
+	assert.Equal(t, "OpenNMS.Sink.Syslog", decoded.Topic)
+	assert.Equal(t, "syslog", decoded.Parser)
+
+	// The parser is not inferred for a single topic
+	cli = &KafkaClient{Topic: "OpenNMS.Sink.Trap", Parser: "heartbeat"}
+	assert.Equal(t, "heartbeat", cli.parserFor("OpenNMS.Sink.Trap"))
+
+	cli = &KafkaClient{Topic: "OpenNMS.Sink.Trap:unknown"}
+	assert.ErrorContains(t, cli.Validate(), "invalid Sink parser unknown for topic OpenNMS.Sink.Trap")
+}
+
+// blockingSource is a Source that feeds the messages of each topic without waiting for their acknowledgements, like a prefetching consumer,
+// and closes the channels once they are fed and the context is canceled. It fails to subscribe to the topics with a nil list.
+type blockingSource struct {
+	messages map[string][]*message.Message
+	fed      sync.WaitGroup
+}
+
+func (s *blockingSource) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	msgs, ok := s.messages[topic]
+	if !ok || msgs == nil {
+		return nil, fmt.Errorf("unknown topic")
+	}
+	channel := make(chan *message.Message)
+	s.fed.Add(1)
+	go func() {
+		defer s.fed.Done()
+		defer close(channel)
+		for _, msg := range msgs {
+			channel <- msg
+		}
+		<-ctx.Done()
+	}()
+	return channel, nil
+}
+
+func (s *blockingSource) Close() error {
+	return nil
+}
+
+func TestMultipleTopicsSubscriptions(t *testing.T) {
+	waitFed := func(source *blockingSource) {
+		fed := make(chan struct{})
+		go func() {
+			source.fed.Wait()
+			close(fed)
+		}()
+		select {
+		case <-fed:
+		case <-time.After(time.Second):
+			t.Fatal("the subscriptions were not drained")
+		}
+	}
+	msgs := func() []*message.Message {
+		return []*message.Message{buildMessage("001", 0, 1, []byte("ABC")), buildMessage("002", 0, 1, []byte("DEF"))}
+	}
+
+	// The subscriptions are drained once the consumer stops reading the messages
+	source := &blockingSource{messages: map[string][]*message.Message{"Trap": msgs(), "Syslog": msgs()}}
+	cli := &KafkaClient{Topic: "Trap,Syslog", subscriber: source}
+	ctx, cancel := context.WithCancel(context.Background())
+	out, err := cli.subscribe(ctx)
+	assert.NilError(t, err)
+	<-out
+	cancel()
+	waitFed(source)
+	for range out {
+	}
+
+	// The previous subscriptions are canceled when one of them fails
+	source = &blockingSource{messages: map[string][]*message.Message{"Trap": msgs(), "Syslog": nil}}
+	cli = &KafkaClient{Topic: "Trap,Syslog", subscriber: source}
+	_, err = cli.subscribe(context.Background())
+	assert.ErrorContains(t, err, "cannot subscribe to topic Syslog")
+	waitFed(source)
+}
@@ -0,0 +1,209 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Default cloud messaging output settings
+const (
+	DefaultCloudFlushInterval = time.Second
+	DefaultCloudMaxRetries    = 3
+	DefaultCloudRetryDelay    = time.Second
+)
+
+// cloudMessages tracks the final result of the messages published to the cloud messaging services.
+var cloudMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "onms_ipc_cloud_messages_total",
+	Help: "The total number of messages published to a cloud messaging service by destination and result (success or failure), after the retries",
+}, []string{"destination", "result"})
+
+// cloudMessage represents a message to publish, with the envelope as the body and the metadata as attributes.
+type cloudMessage struct {
+	id         string // Unique within a batch.
+	body       []byte
+	attributes map[string]string
+}
+
+// newCloudMessage Builds the message to publish for a decoded message.
+func newCloudMessage(msg DecodedMessage) (cloudMessage, error) {
+	body, err := msg.Envelope()
+	if err != nil {
+		return cloudMessage{}, fmt.Errorf("cannot encode message: %v", err)
+	}
+	attributes := map[string]string{
+		"parser": msg.Parser,
+		"source": msg.Coordinates(),
+	}
+	for key, value := range map[string]string{"location": msg.Metadata.Location, "systemId": msg.Metadata.SystemID, "sourceAddress": msg.Metadata.SourceAddress} {
+		if value != "" {
+			attributes[key] = value
+		}
+	}
+	return cloudMessage{body: body, attributes: attributes}, nil
+}
+
+// publishBatch sends a batch of messages to a cloud messaging service, returning the messages that should be retried,
+// and how many were rejected permanently (which are logged and discarded by the implementation).
+type publishBatch func(messages []cloudMessage) (retry []cloudMessage, rejected int, err error)
+
+// cloudBatcher queues the messages of a cloud messaging output, and publishes them in batches from the background,
+// retrying the failures with an exponential backoff. When the queue is full, queue blocks until there is room or the context expires,
+// which slows down the consumer instead of losing messages.
+type cloudBatcher struct {
+	destination   string
+	batchSize     int // The maximum number of messages per batch.
+	maxBytes      int // The maximum size of the bodies of a batch (0 for unlimited).
+	flushInterval time.Duration
+	maxRetries    int
+	retryDelay    time.Duration
+	publish       publishBatch
+
+	queue chan cloudMessage
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// start Starts the background publisher.
+func (b *cloudBatcher) start(queueSize int) {
+	b.queue = make(chan cloudMessage, queueSize)
+	b.stop = make(chan struct{})
+	b.wg.Add(1)
+	go b.run()
+}
+
+// enqueue Queues a message to be published.
+func (b *cloudBatcher) enqueue(ctx context.Context, msg cloudMessage) error {
+	select {
+	case b.queue <- msg:
+		return nil
+	case <-ctx.Done():
+		return &OutputError{Err: fmt.Errorf("cannot queue message: %v", ctx.Err()), Retryable: true}
+	}
+}
+
+// close Stops the background publisher, after publishing the queued messages.
+func (b *cloudBatcher) close() {
+	if b.stop != nil {
+		close(b.stop)
+		b.wg.Wait()
+		b.stop = nil
+	}
+}
+
+// run Publishes the queued messages in batches, until the batcher is closed.
+func (b *cloudBatcher) run() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.flushInterval)
+	defer ticker.Stop()
+	var batch []cloudMessage
+	size := 0
+	flush := func() {
+		if len(batch) > 0 {
+			b.send(batch)
+			batch = nil
+			size = 0
+		}
+	}
+	add := func(msg cloudMessage) {
+		if b.maxBytes > 0 && len(batch) > 0 && size+len(msg.body) > b.maxBytes {
+			flush()
+		}
+		msg.id = strconv.Itoa(len(batch))
+		batch = append(batch, msg)
+		if size += len(msg.body); len(batch) >= b.batchSize {
+			flush()
+		}
+	}
+	for {
+		select {
+		case msg := <-b.queue:
+			add(msg)
+		case <-ticker.C:
+			flush()
+		case <-b.stop:
+			for len(b.queue) > 0 {
+				add(<-b.queue)
+			}
+			flush()
+			return
+		}
+	}
+}
+
+// send Publishes a batch, retrying the failures with an exponential backoff; the messages rejected permanently, or after all the retries, are dropped.
+func (b *cloudBatcher) send(batch []cloudMessage) {
+	delay := b.retryDelay
+	total := len(batch)
+	for attempt := 0; ; attempt++ {
+		failed, rejected, err := b.publish(batch)
+		if err == nil {
+			cloudMessages.WithLabelValues(b.destination, OutputSuccess).Add(float64(len(batch) - len(failed) - rejected))
+			cloudMessages.WithLabelValues(b.destination, "failure").Add(float64(rejected))
+			if len(failed) == 0 {
+				return
+			}
+			batch = failed
+			err = fmt.Errorf("messages rejected temporarily")
+		} else if outputResult(err) != OutputRetryable {
+			cloudMessages.WithLabelValues(b.destination, "failure").Add(float64(len(batch)))
+			defaultLogger.Errorf("cannot publish %d messages to %s, dropping them: %v", len(batch), b.destination, err)
+			return
+		}
+		if attempt >= b.maxRetries {
+			cloudMessages.WithLabelValues(b.destination, "failure").Add(float64(len(batch)))
+			defaultLogger.Errorf("cannot publish %d of %d messages to %s after %d retries, dropping them: %v", len(batch), total, b.destination, attempt, err)
+			return
+		}
+		defaultLogger.Warnf("cannot publish %d messages to %s, retrying in %s: %v", len(batch), b.destination, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-b.stop:
+			if attempt > 0 { // Don't delay the shutdown for more than one retry
+				cloudMessages.WithLabelValues(b.destination, "failure").Add(float64(len(batch)))
+				return
+			}
+		}
+		delay *= 2
+	}
+}
+
+// doCloudRequest Sends a request to a cloud service, returning the body of a successful response.
+// Network failures, throttling and server errors are retryable.
+func doCloudRequest(client *http.Client, req *http.Request) ([]byte, error) {
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, &OutputError{Err: fmt.Errorf("cannot send request to %s: %v", req.URL.Host, err), Retryable: true}
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, 1024*1024))
+	if err != nil {
+		return nil, &OutputError{Err: fmt.Errorf("cannot read response from %s: %v", req.URL.Host, err), Retryable: true}
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		msg := body
+		if len(msg) > 512 {
+			msg = msg[:512]
+		}
+		return nil, &OutputError{
+			Err:       fmt.Errorf("unexpected response from %s: %s %s", req.URL.Host, res.Status, string(bytes.TrimSpace(msg))),
+			Retryable: res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500,
+		}
+	}
+	return body, nil
+}
@@ -0,0 +1,93 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// Commit policies
+const (
+	CommitPerMessage = "message"  // Each message is acknowledged once processed, and its offset is committed within a second.
+	CommitPeriodic   = "periodic" // Each message is acknowledged once processed, and the offsets are committed asynchronously every commit interval.
+	CommitOnSuccess  = "success"  // Each message is acknowledged only after the action succeeds; failures are retried (by default, until they succeed), blocking the partition.
+)
+
+// Default commit settings
+const (
+	DefaultCommitInterval   = 5 * time.Second
+	DefaultCommitRetryDelay = time.Second
+)
+
+// MessageHandler defines the action to execute for each decoded message.
+// Failures are retried according to the ActionRetry policy of the client; when the commit policy is CommitOnSuccess,
+// the message is not acknowledged until the handler succeeds or the attempts are exhausted.
+type MessageHandler func(msg DecodedMessage) error
+
+// validateCommitPolicy Verifies the commit settings, applying defaults when necessary.
+func (cli *KafkaClient) validateCommitPolicy() error {
+	switch cli.CommitPolicy {
+	case "":
+		cli.CommitPolicy = CommitPerMessage
+	case CommitPerMessage, CommitOnSuccess:
+	case CommitPeriodic:
+		if cli.CommitInterval <= 0 {
+			cli.CommitInterval = DefaultCommitInterval
+		}
+	default:
+		return fmt.Errorf("invalid commit policy %s; expecting %s, %s, %s", cli.CommitPolicy, CommitPerMessage, CommitPeriodic, CommitOnSuccess)
+	}
+	if cli.CommitRetryDelay <= 0 {
+		cli.CommitRetryDelay = DefaultCommitRetryDelay
+	}
+	return cli.ActionRetry.validate(cli.CommitRetryDelay)
+}
+
+// applyCommitPolicy Updates the consumer settings based on the commit policy.
+// The subscriber marks the offset of a message when it is acknowledged, and the marked offsets are committed in the background.
+func (cli *KafkaClient) applyCommitPolicy(config *sarama.Config) {
+	config.Consumer.Offsets.AutoCommit.Enable = true
+	if cli.CommitPolicy == CommitPeriodic {
+		config.Consumer.Offsets.AutoCommit.Interval = cli.CommitInterval
+	} else {
+		config.Consumer.Offsets.AutoCommit.Interval = time.Second
+	}
+}
+
+// deliver Executes the action for a decoded message, retrying the failures according to the ActionRetry policy,
+// and returning false when the client stops first.
+// Once the attempts are exhausted, the failure is logged, the message is sent to the dead letter output, and considered delivered.
+func (cli *KafkaClient) deliver(msg DecodedMessage, action MessageHandler) bool {
+	policy := cli.ActionRetry.withDefaults(cli.CommitRetryDelay)
+	for attempts := 1; ; attempts++ {
+		err := action(msg)
+		if err == nil {
+			return true
+		}
+		if policy.exhausted(attempts, cli.CommitPolicy) {
+			cli.logger().Errorf("cannot process message %s after %d attempt(s): %v", msg.Coordinates(), attempts, err)
+			cli.sendDeadLetter(msg, err)
+			return true
+		}
+		delay := policy.backoff(attempts)
+		cli.logger().Warnf("cannot process message %s, retrying in %s: %v", msg.Coordinates(), delay, err)
+		if cli.actionFailures != nil {
+			cli.actionFailures.Inc()
+		}
+		select {
+		case <-time.After(delay):
+		case <-cli.done:
+			return false
+		}
+	}
+}
+
+// Handle Reads messages from the chosen topic on an infinite loop, executing the handler for each decoded message.
+// This is an alternative to Start that supports failures, for instance to implement at-least-once processing with the CommitOnSuccess policy.
+// It is recommended to use it within a Go Routine as it is a blocking operation.
+func (cli *KafkaClient) Handle(handler MessageHandler) {
+	cli.consume(handler)
+}
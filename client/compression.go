@@ -0,0 +1,81 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Payload compression codecs
+const (
+	CompressionAuto = "auto" // Detects the codec through the magic bytes of the payload (default).
+	CompressionNone = "none" // The payloads are handed to the parsers as is.
+	CompressionGzip = "gzip" // The payloads are always decompressed with gzip.
+	CompressionZstd = "zstd" // The payloads are always decompressed with Zstandard.
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// zstdDecoder is shared by all the clients, as it is concurrent safe when used through DecodeAll.
+var zstdDecoder, _ = zstd.NewReader(nil)
+
+// validatePayloadCompression Verifies the payload compression settings, applying defaults when necessary.
+func (cli *KafkaClient) validatePayloadCompression() error {
+	switch cli.PayloadCompression {
+	case "":
+		cli.PayloadCompression = CompressionAuto
+	case CompressionAuto, CompressionNone, CompressionGzip, CompressionZstd:
+	default:
+		return fmt.Errorf("invalid payload compression %s; expecting %s, %s, %s or %s", cli.PayloadCompression, CompressionAuto, CompressionNone, CompressionGzip, CompressionZstd)
+	}
+	return nil
+}
+
+// detectCompression Returns the codec of a payload based on its magic bytes, or none when it doesn't look compressed.
+func detectCompression(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		return CompressionGzip
+	case bytes.HasPrefix(data, zstdMagic):
+		return CompressionZstd
+	default:
+		return CompressionNone
+	}
+}
+
+// decompressPayload Returns the reassembled payload decompressed with the configured codec, and the codec used.
+func (cli *KafkaClient) decompressPayload(data []byte) ([]byte, string, error) {
+	codec := cli.PayloadCompression
+	if codec == "" || codec == CompressionAuto {
+		codec = detectCompression(data)
+	}
+	switch codec {
+	case CompressionGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, codec, fmt.Errorf("invalid gzip payload: %v", err)
+		}
+		defer reader.Close()
+		out, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return nil, codec, fmt.Errorf("invalid gzip payload: %v", err)
+		}
+		return out, codec, nil
+	case CompressionZstd:
+		out, err := zstdDecoder.DecodeAll(data, nil)
+		if err != nil {
+			return nil, codec, fmt.Errorf("invalid zstd payload: %v", err)
+		}
+		return out, codec, nil
+	default:
+		return data, CompressionNone, nil
+	}
+}
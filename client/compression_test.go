@@ -0,0 +1,48 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"gotest.tools/v3/assert"
+)
+
+func TestPayloadCompression(t *testing.T) {
+	data := []byte("<log><messages><message>test</message></messages></log>")
+	var gzipped bytes.Buffer
+	writer := gzip.NewWriter(&gzipped)
+	writer.Write(data)
+	writer.Close()
+	encoder, err := zstd.NewWriter(nil)
+	assert.NilError(t, err)
+	zstded := encoder.EncodeAll(data, nil)
+
+	assert.Equal(t, CompressionGzip, detectCompression(gzipped.Bytes()))
+	assert.Equal(t, CompressionZstd, detectCompression(zstded))
+	assert.Equal(t, CompressionNone, detectCompression(data))
+
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	// The compressed payload spans multiple chunks
+	content := gzipped.Bytes()
+	half := len(content) / 2
+	assert.Assert(t, cli.processMessage(buildMessage("0001", 0, 2, content[:half])) == nil)
+	assert.Equal(t, string(data), string(cli.processMessage(buildMessage("0001", 1, 2, content[half:]))))
+	assert.Equal(t, string(data), string(cli.processMessage(buildMessage("0002", 0, 1, zstded))))
+	assert.Equal(t, string(data), string(cli.processMessage(buildMessage("0003", 0, 1, data))))
+
+	cli.PayloadCompression = CompressionNone
+	assert.DeepEqual(t, zstded, cli.processMessage(buildMessage("0004", 0, 1, zstded)))
+	cli.PayloadCompression = CompressionZstd
+	assert.Assert(t, cli.processMessage(buildMessage("0005", 0, 1, data)) == nil)
+
+	cli.PayloadCompression = "lz4"
+	assert.ErrorContains(t, cli.validatePayloadCompression(), "invalid payload compression")
+	cli.PayloadCompression = ""
+	assert.NilError(t, cli.validatePayloadCompression())
+	assert.Equal(t, CompressionAuto, cli.PayloadCompression)
+}
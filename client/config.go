@@ -0,0 +1,145 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigValues contains the settings of a configuration file, indexed by the name of the CLI flag they populate.
+// Each value is a list, as the flags that accept multiple values are set once per item.
+type ConfigValues map[string][]string
+
+// ReadConfigFile Parses a configuration file in JSON (when its extension is .json) or YAML format.
+// The keys are the names of the CLI flags; the values can be scalars, lists (for the flags that can be repeated),
+// or maps, which are converted into key=value items (i.e. for parameter or webhook-header).
+func ReadConfigFile(path string) (ConfigValues, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read configuration file: %v", err)
+	}
+	settings := make(map[string]interface{})
+	if err := unmarshalConfig(path, data, &settings); err != nil {
+		return nil, err
+	}
+	values := make(ConfigValues, len(settings))
+	for key, value := range settings {
+		items, err := configItems(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid setting %s: %v", key, err)
+		}
+		values[key] = items
+	}
+	return values, nil
+}
+
+// Apply Sets the flags that were not explicitly defined on the command line, so the CLI flags take precedence over the file.
+// It fails when the file contains a setting that doesn't correspond to a flag.
+func (values ConfigValues) Apply(fs *flag.FlagSet) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if fs.Lookup(key) == nil {
+			return fmt.Errorf("unknown setting %s", key)
+		}
+		if explicit[key] {
+			continue
+		}
+		for _, item := range values[key] {
+			if err := fs.Set(key, item); err != nil {
+				return fmt.Errorf("invalid setting %s: %v", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// unmarshalConfig Parses the content of a file in JSON (when its extension is .json) or YAML format, rejecting unknown fields.
+func unmarshalConfig(path string, data []byte, v interface{}) error {
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(v)
+	} else {
+		err = yaml.UnmarshalStrict(data, v)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot parse configuration file %s: %v", path, err)
+	}
+	return nil
+}
+
+// configItems Converts a value from a configuration file into the items to set on a flag.
+func configItems(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return []string{""}, nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, e := range v {
+			item, err := configScalar(e)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case map[interface{}]interface{}:
+		entries := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			entries[fmt.Sprint(k)] = e
+		}
+		return configItems(entries)
+	case map[string]interface{}:
+		items := make([]string, 0, len(v))
+		for k, e := range v {
+			item, err := configScalar(e)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, k+"="+item)
+		}
+		sort.Strings(items)
+		return items, nil
+	default:
+		item, err := configScalar(v)
+		if err != nil {
+			return nil, err
+		}
+		return []string{item}, nil
+	}
+}
+
+// configScalar Converts a scalar value from a configuration file into its string representation.
+func configScalar(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool, int, int64, uint64:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v; expecting a scalar", v)
+	}
+}
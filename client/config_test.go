@@ -0,0 +1,86 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestReadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "receiver.yaml")
+	assert.NilError(t, ioutil.WriteFile(yamlFile, []byte(`
+bootstrap: kafka1:9092
+workers: 4
+sample-rate: 0.5
+max-pending-bytes: 1000000
+debug: true
+idle-timeout: 5m
+parameter:
+  security.protocol: SASL_SSL
+  sasl.mechanism: PLAIN
+header-filter:
+  - tenant=acme
+  - env!=test
+`), 0644))
+	values, err := ReadConfigFile(yamlFile)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"kafka1:9092"}, values["bootstrap"])
+	assert.DeepEqual(t, []string{"4"}, values["workers"])
+	assert.DeepEqual(t, []string{"0.5"}, values["sample-rate"])
+	assert.DeepEqual(t, []string{"1000000"}, values["max-pending-bytes"])
+	assert.DeepEqual(t, []string{"true"}, values["debug"])
+	assert.DeepEqual(t, []string{"5m"}, values["idle-timeout"])
+	assert.DeepEqual(t, []string{"sasl.mechanism=PLAIN", "security.protocol=SASL_SSL"}, values["parameter"])
+	assert.DeepEqual(t, []string{"tenant=acme", "env!=test"}, values["header-filter"])
+
+	jsonFile := filepath.Join(dir, "receiver.json")
+	assert.NilError(t, ioutil.WriteFile(jsonFile, []byte(`{"bootstrap":"kafka2:9092","max-pending-bytes":1000000,"parameter":{"acks":"all"}}`), 0644))
+	values, err = ReadConfigFile(jsonFile)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"kafka2:9092"}, values["bootstrap"])
+	assert.DeepEqual(t, []string{"1000000"}, values["max-pending-bytes"])
+	assert.DeepEqual(t, []string{"acks=all"}, values["parameter"])
+
+	assert.NilError(t, ioutil.WriteFile(jsonFile, []byte(`{"parameter":{"acks":["all"]}}`), 0644))
+	_, err = ReadConfigFile(jsonFile)
+	assert.ErrorContains(t, err, "invalid setting parameter")
+
+	_, err = ReadConfigFile(filepath.Join(dir, "missing.yaml"))
+	assert.ErrorContains(t, err, "cannot read configuration file")
+}
+
+func TestConfigValuesApply(t *testing.T) {
+	cli := KafkaClient{}
+	var timeout time.Duration
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.StringVar(&cli.Bootstrap, "bootstrap", "localhost:9092", "")
+	fs.StringVar(&cli.Topic, "topic", "OpenNMS.Sink.Trap", "")
+	fs.StringVar(&cli.Parser, "parser", "snmp", "")
+	fs.Var(&cli.Parameters, "parameter", "")
+	fs.DurationVar(&timeout, "idle-timeout", 0, "")
+	assert.NilError(t, fs.Parse([]string{"-topic", "OpenNMS.Sink.Syslog"}))
+
+	assert.ErrorContains(t, ConfigValues{"unknown": {"x"}}.Apply(fs), "unknown setting unknown")
+	assert.ErrorContains(t, ConfigValues{"idle-timeout": {"x"}}.Apply(fs), "invalid setting idle-timeout")
+
+	values := ConfigValues{
+		"bootstrap":    {"kafka1:9092"},
+		"topic":        {"OpenNMS.Sink.Telemetry-NXOS"},
+		"parameter":    {"acks=all", "client.id=receiver"},
+		"idle-timeout": {"5m"},
+	}
+	assert.NilError(t, values.Apply(fs))
+	assert.Equal(t, "kafka1:9092", cli.Bootstrap)
+	assert.Equal(t, "OpenNMS.Sink.Syslog", cli.Topic) // CLI flags take precedence
+	assert.Equal(t, "snmp", cli.Parser)
+	assert.Equal(t, "all", cli.Parameters["acks"])
+	assert.Equal(t, "receiver", cli.Parameters["client.id"])
+	assert.Equal(t, 5*time.Minute, timeout)
+}
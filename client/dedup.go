@@ -0,0 +1,146 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// MessageIndex is a bounded set of the most recently processed IPC message IDs, persisted to a file,
+// so messages redelivered after a restart or a rebalance (as Kafka guarantees at-least-once delivery) are processed only once.
+// The file is append-only, one ID per line, and it is compacted when it holds twice as many IDs as the capacity.
+// This is a concurrent safe object.
+type MessageIndex struct {
+	Path     string // The path of the index file.
+	Capacity int    // The maximum number of IDs to remember.
+
+	mutex   sync.Mutex
+	ids     map[string]bool
+	order   []string // Ring buffer with the IDs in insertion order.
+	next    int      // The position of the oldest ID on the ring when full.
+	file    *os.File
+	written int // The number of IDs in the file.
+}
+
+// OpenMessageIndex opens or creates a message index, loading the most recent IDs from the file.
+func OpenMessageIndex(path string, capacity int) (*MessageIndex, error) {
+	if capacity <= 0 {
+		return nil, fmt.Errorf("invalid capacity %d", capacity)
+	}
+	idx := &MessageIndex{Path: path, Capacity: capacity, ids: make(map[string]bool)}
+	if file, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if id := scanner.Text(); id != "" {
+				idx.remember(id)
+			}
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("cannot read index file %s: %v", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("cannot open index file %s: %v", path, err)
+	}
+	if err := idx.compact(); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// remember Adds an ID to the in-memory set, evicting the oldest one when the index is full.
+// Must be called while holding the lock.
+func (idx *MessageIndex) remember(id string) bool {
+	if idx.ids[id] {
+		return false
+	}
+	if len(idx.order) < idx.Capacity {
+		idx.order = append(idx.order, id)
+	} else {
+		delete(idx.ids, idx.order[idx.next])
+		idx.order[idx.next] = id
+		idx.next = (idx.next + 1) % idx.Capacity
+	}
+	idx.ids[id] = true
+	return true
+}
+
+// compact Rewrites the index file with the IDs in memory, and reopens it for appending.
+// Must be called while holding the lock.
+func (idx *MessageIndex) compact() error {
+	if idx.file != nil {
+		idx.file.Close()
+	}
+	tmp := filepath.Join(filepath.Dir(idx.Path), "."+filepath.Base(idx.Path)+".tmp")
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("cannot create index file %s: %v", tmp, err)
+	}
+	writer := bufio.NewWriter(file)
+	for i := range idx.order {
+		writer.WriteString(idx.order[(idx.next+i)%len(idx.order)] + "\n")
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("cannot write index file %s: %v", tmp, err)
+	}
+	file.Close()
+	if err := os.Rename(tmp, idx.Path); err != nil {
+		return fmt.Errorf("cannot replace index file %s: %v", idx.Path, err)
+	}
+	if idx.file, err = os.OpenFile(idx.Path, os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return fmt.Errorf("cannot open index file %s: %v", idx.Path, err)
+	}
+	idx.written = len(idx.order)
+	return nil
+}
+
+// Add Records a message ID, returning false when it was already processed.
+func (idx *MessageIndex) Add(id string) (bool, error) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	if !idx.remember(id) {
+		return false, nil
+	}
+	if idx.file == nil {
+		return true, fmt.Errorf("index file %s is closed", idx.Path)
+	}
+	if _, err := idx.file.WriteString(id + "\n"); err != nil {
+		return true, fmt.Errorf("cannot write index file %s: %v", idx.Path, err)
+	}
+	idx.written++
+	if idx.written >= 2*idx.Capacity {
+		return true, idx.compact()
+	}
+	return true, nil
+}
+
+// Contains Returns true when a message ID was already processed, without recording it.
+func (idx *MessageIndex) Contains(id string) bool {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	return idx.ids[id]
+}
+
+// Len Returns the number of IDs in the index.
+func (idx *MessageIndex) Len() int {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	return len(idx.ids)
+}
+
+// Close Closes the index file.
+func (idx *MessageIndex) Close() error {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	if idx.file == nil {
+		return nil
+	}
+	err := idx.file.Close()
+	idx.file = nil
+	return err
+}
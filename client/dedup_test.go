@@ -0,0 +1,129 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestMessageIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index")
+	idx, err := OpenMessageIndex(path, 3)
+	assert.NilError(t, err)
+	for i := 0; i < 10; i++ {
+		added, err := idx.Add(fmt.Sprintf("msg%d", i))
+		assert.NilError(t, err)
+		assert.Assert(t, added)
+	}
+	added, err := idx.Add("msg9")
+	assert.NilError(t, err)
+	assert.Assert(t, !added)
+	assert.Equal(t, 3, idx.Len())
+	assert.NilError(t, idx.Close())
+
+	// The most recent IDs survive a restart
+	idx, err = OpenMessageIndex(path, 3)
+	assert.NilError(t, err)
+	defer idx.Close()
+	assert.Equal(t, 3, idx.Len())
+	for _, id := range []string{"msg7", "msg8", "msg9"} {
+		added, err := idx.Add(id)
+		assert.NilError(t, err)
+		assert.Assert(t, !added, id)
+	}
+	added, err = idx.Add("msg6")
+	assert.NilError(t, err)
+	assert.Assert(t, added)
+}
+
+func TestProcessDuplicates(t *testing.T) {
+	idx, err := OpenMessageIndex(filepath.Join(t.TempDir(), "index"), 10)
+	assert.NilError(t, err)
+	defer idx.Close()
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	cli.Dedup = idx
+	msg := buildMessage("msg1", 0, 1, []byte("data"))
+	assert.Equal(t, "data", string(cli.processMessage(msg)))
+	assert.Equal(t, "data", string(cli.processMessage(msg))) // Not recorded until it is delivered
+	cli.processed("msg1")
+	assert.Assert(t, cli.processMessage(msg) == nil)
+}
+
+func TestDedupInterruptedDelivery(t *testing.T) {
+	idx, err := OpenMessageIndex(filepath.Join(t.TempDir(), "index"), 10)
+	assert.NilError(t, err)
+	defer idx.Close()
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	cli.Parser = "heartbeat"
+	cli.Dedup = idx
+	cli.DedupCache, err = NewDedupCache(10, 0)
+	assert.NilError(t, err)
+	cli.CommitPolicy = CommitOnSuccess
+	cli.CommitRetryDelay = time.Minute
+	done := make(chan struct{})
+	cli.done = done
+	close(done)
+	attempts := 0
+	failing := func(msg DecodedMessage) error {
+		attempts++
+		return fmt.Errorf("failure %d", attempts)
+	}
+
+	// The client stops while retrying, so the message is neither acknowledged nor recorded
+	msg := buildMessage("msg1", 0, 1, []byte("data"))
+	cli.handleMessage(msg, failing)
+	assert.Equal(t, 1, attempts)
+	select {
+	case <-msg.Acked():
+		t.Fatal("message acknowledged after an interrupted delivery")
+	default:
+	}
+	assert.Assert(t, !idx.Contains("msg1"))
+	assert.Assert(t, !cli.DedupCache.Contains("msg1"))
+
+	// The redelivered message is processed, and discarded afterwards
+	var received []string
+	succeeding := func(msg DecodedMessage) error {
+		received = append(received, string(msg.Payload))
+		return nil
+	}
+	msg = buildMessage("msg1", 0, 1, []byte("data"))
+	cli.handleMessage(msg, succeeding)
+	<-msg.Acked()
+	assert.DeepEqual(t, []string{"data"}, received)
+	assert.Assert(t, idx.Contains("msg1"))
+	msg = buildMessage("msg1", 0, 1, []byte("data"))
+	cli.handleMessage(msg, succeeding)
+	<-msg.Acked()
+	assert.Equal(t, 1, len(received))
+}
+
+func TestDedupCache(t *testing.T) {
+	_, err := NewDedupCache(0, 0)
+	assert.ErrorContains(t, err, "invalid size")
+	cache, err := NewDedupCache(2, time.Minute)
+	assert.NilError(t, err)
+	now := time.Now()
+	assert.Assert(t, cache.add("msg1", now))
+	assert.Assert(t, cache.add("msg2", now))
+	assert.Assert(t, !cache.add("msg1", now.Add(time.Second)))
+
+	// The least recently seen ID is evicted when full
+	assert.Assert(t, cache.add("msg3", now.Add(time.Second)))
+	assert.Equal(t, 2, cache.Len())
+	assert.Assert(t, cache.add("msg2", now.Add(time.Second)))
+	assert.Assert(t, !cache.add("msg2", now.Add(2*time.Second)))
+
+	// The IDs are forgotten once they are older than the TTL
+	assert.Assert(t, cache.contains("msg2", now.Add(time.Minute)))
+	assert.Assert(t, !cache.contains("msg2", now.Add(2*time.Minute)))
+	assert.Assert(t, cache.add("msg2", now.Add(2*time.Minute)))
+	assert.Equal(t, 1, cache.Len())
+}
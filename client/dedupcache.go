@@ -0,0 +1,153 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// dedupCacheLookups tracks the lookups of the message IDs on the deduplication caches.
+	dedupCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "onms_ipc_dedup_cache_lookups_total",
+		Help: "The total number of lookups on the message deduplication cache, by result (hit for the duplicates, or miss)",
+	}, []string{"result"})
+	// dedupCacheEvictions tracks the message IDs removed from the deduplication caches.
+	dedupCacheEvictions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "onms_ipc_dedup_cache_evictions_total",
+		Help: "The total number of message IDs removed from the deduplication cache, by reason (size or ttl)",
+	}, []string{"reason"})
+)
+
+// dedupEntry is a message ID held by the deduplication cache.
+type dedupEntry struct {
+	id   string
+	seen time.Time // When the ID was first seen, or seen again after expiring.
+}
+
+// DedupCache is an in-memory set of the recently processed IPC message IDs (the Sink message ID or the RPC ID),
+// so the messages reprocessed after a rebalance or a retry are delivered only once.
+// When full, the least recently seen ID is evicted; with a TTL, the IDs are also forgotten once they are older than it.
+// Unlike MessageIndex, the IDs are not preserved across restarts.
+// This is a concurrent safe object.
+type DedupCache struct {
+	Size int           // The maximum number of IDs to remember.
+	TTL  time.Duration // How long an ID is remembered since it was first seen (0 to keep it until it is evicted by size).
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // The most recently seen ID first.
+}
+
+// NewDedupCache creates a deduplication cache with a given size and TTL.
+func NewDedupCache(size int, ttl time.Duration) (*DedupCache, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid size %d", size)
+	}
+	if ttl < 0 {
+		return nil, fmt.Errorf("invalid TTL %s", ttl)
+	}
+	return &DedupCache{Size: size, TTL: ttl, entries: make(map[string]*list.Element), order: list.New()}, nil
+}
+
+// Add Records a message ID, returning false when it was seen within the TTL.
+func (c *DedupCache) Add(id string) bool {
+	return c.add(id, time.Now())
+}
+
+// Contains Returns true when a message ID was seen within the TTL, without recording it.
+func (c *DedupCache) Contains(id string) bool {
+	return c.contains(id, time.Now())
+}
+
+// contains Verifies a message ID at a given time, tracking the result of the lookup.
+func (c *DedupCache) contains(id string, now time.Time) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	elem, ok := c.entries[id]
+	if ok && !c.expired(elem.Value.(*dedupEntry), now) {
+		dedupCacheLookups.WithLabelValues("hit").Inc()
+		return true
+	}
+	dedupCacheLookups.WithLabelValues("miss").Inc()
+	return false
+}
+
+// add Records a message ID seen at a given time.
+func (c *DedupCache) add(id string, now time.Time) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.expire(now)
+	if elem, ok := c.entries[id]; ok {
+		c.order.MoveToFront(elem)
+		entry := elem.Value.(*dedupEntry)
+		if !c.expired(entry, now) {
+			return false
+		}
+		dedupCacheEvictions.WithLabelValues("ttl").Inc()
+		entry.seen = now
+		return true
+	}
+	c.entries[id] = c.order.PushFront(&dedupEntry{id: id, seen: now})
+	for c.order.Len() > c.Size {
+		c.remove(c.order.Back(), "size")
+	}
+	return true
+}
+
+// expired Returns true when an ID is older than the TTL.
+func (c *DedupCache) expired(entry *dedupEntry, now time.Time) bool {
+	return c.TTL > 0 && now.Sub(entry.seen) >= c.TTL
+}
+
+// expire Removes the least recently seen IDs while they are older than the TTL.
+// As a hit keeps the time when the ID was first seen, an expired ID might be ahead of a valid one,
+// in which case it is removed by size, or treated as new when it is seen again.
+// Must be called while holding the lock.
+func (c *DedupCache) expire(now time.Time) {
+	for elem := c.order.Back(); elem != nil && c.expired(elem.Value.(*dedupEntry), now); elem = c.order.Back() {
+		c.remove(elem, "ttl")
+	}
+}
+
+// remove Removes an ID from the cache.
+// Must be called while holding the lock.
+func (c *DedupCache) remove(elem *list.Element, reason string) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*dedupEntry).id)
+	dedupCacheEvictions.WithLabelValues(reason).Inc()
+}
+
+// Len Returns the number of IDs in the cache.
+func (c *DedupCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
+
+// duplicated Returns true when a message ID was already processed according to the deduplication cache or the message index.
+// The IDs are recorded by processed once the messages are delivered, so the ones redelivered after an interrupted delivery are not discarded.
+func (cli *KafkaClient) duplicated(id string) bool {
+	if cli.DedupCache != nil && cli.DedupCache.Contains(id) {
+		return true
+	}
+	return cli.Dedup != nil && cli.Dedup.Contains(id)
+}
+
+// processed Records the ID of a delivered message on the deduplication cache and the message index.
+func (cli *KafkaClient) processed(id string) {
+	if cli.DedupCache != nil {
+		cli.DedupCache.Add(id)
+	}
+	if cli.Dedup != nil {
+		if _, err := cli.Dedup.Add(id); err != nil {
+			cli.logger().Errorf("cannot update message index: %v", err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Delivery modes
+const (
+	DeliveryAtMostOnce  = "at-most-once"  // A single attempt; failures are logged and the message is acknowledged anyway (default).
+	DeliveryAtLeastOnce = "at-least-once" // Retryable failures are retried until they succeed; the message is not acknowledged when the client stops first.
+	DeliveryExactlyOnce = "exactly-once"  // Like at-least-once, for outputs whose destination discards the redelivered messages.
+)
+
+// deliveryStrictness ranks the delivery modes, from the weakest to the strictest guarantee.
+var deliveryStrictness = map[string]int{DeliveryAtMostOnce: 0, DeliveryAtLeastOnce: 1, DeliveryExactlyOnce: 2}
+
+// IdempotentOutput is implemented by the outputs whose destination discards the messages delivered more than once,
+// which is required to use the exactly-once delivery mode.
+type IdempotentOutput interface {
+	Output
+	// Idempotent Returns true when sending the same message again has no effect on the destination.
+	Idempotent() bool
+}
+
+// OutputDelivery contains the delivery mode of each output, by kind (i.e. webhook) or by name (i.e. forward:traps).
+// The outputs without an explicit mode use DeliveryAtMostOnce.
+type OutputDelivery map[string]string
+
+// String gets a CSV with the delivery mode of each output
+func (d *OutputDelivery) String() string {
+	if d == nil {
+		return ""
+	}
+	names := make([]string, 0, len(*d))
+	for name := range *d {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	items := make([]string, 0, len(names))
+	for _, name := range names {
+		items = append(items, name+"="+(*d)[name])
+	}
+	return strings.Join(items, ", ")
+}
+
+// Set parses the delivery mode of an output as output=mode and adds it to the map
+func (d *OutputDelivery) Set(value string) error {
+	idx := strings.LastIndex(value, "=")
+	if idx < 1 {
+		return fmt.Errorf("invalid delivery mode %s; expecting output=mode", value)
+	}
+	mode := value[idx+1:]
+	if _, ok := deliveryStrictness[mode]; !ok {
+		return fmt.Errorf("invalid delivery mode %s; expecting %s, %s or %s", mode, DeliveryAtMostOnce, DeliveryAtLeastOnce, DeliveryExactlyOnce)
+	}
+	if *d == nil {
+		*d = make(OutputDelivery)
+	}
+	(*d)[value[:idx]] = mode
+	return nil
+}
+
+// modeOf Returns the delivery mode of an output, preferring the mode set for its name over the one set for its kind.
+func (d OutputDelivery) modeOf(output Output) string {
+	name := output.Name()
+	if mode, ok := d[name]; ok {
+		return mode
+	}
+	if mode, ok := d[strings.SplitN(name, ":", 2)[0]]; ok {
+		return mode
+	}
+	return DeliveryAtMostOnce
+}
+
+// validateDelivery Verifies that the delivery mode of each output is supported by it.
+func (cli *KafkaClient) validateDelivery() error {
+	for _, output := range cli.Outputs {
+		if cli.OutputDelivery.modeOf(output) != DeliveryExactlyOnce {
+			continue
+		}
+		if out, ok := output.(IdempotentOutput); !ok || !out.Idempotent() {
+			return fmt.Errorf("output %s doesn't support the %s delivery mode", output.Name(), DeliveryExactlyOnce)
+		}
+	}
+	return nil
+}
+
+// DeliveryGuarantee Returns the strictest delivery mode among the action and the outputs, which the offset commits honor:
+// when it is stricter than DeliveryAtMostOnce, a message is only acknowledged after it was delivered according to the mode of each output.
+// The action is considered at-least-once when the commit policy is CommitOnSuccess.
+func (cli *KafkaClient) DeliveryGuarantee() string {
+	strictest := DeliveryAtMostOnce
+	if cli.CommitPolicy == CommitOnSuccess {
+		strictest = DeliveryAtLeastOnce
+	}
+	for _, output := range cli.Outputs {
+		if mode := cli.OutputDelivery.modeOf(output); deliveryStrictness[mode] > deliveryStrictness[strictest] {
+			strictest = mode
+		}
+	}
+	return strictest
+}
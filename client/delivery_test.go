@@ -0,0 +1,89 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// flakyOutput fails with a retryable error on the first attempts.
+type flakyOutput struct {
+	name     string
+	failures int
+	attempts int
+}
+
+func (out *flakyOutput) Name() string {
+	return out.name
+}
+
+func (out *flakyOutput) Send(ctx context.Context, msg DecodedMessage) error {
+	if out.attempts++; out.attempts <= out.failures {
+		return &OutputError{Err: fmt.Errorf("failure %d", out.attempts), Retryable: true}
+	}
+	return nil
+}
+
+func TestOutputDelivery(t *testing.T) {
+	delivery := OutputDelivery{}
+	assert.NilError(t, delivery.Set("webhook=at-least-once"))
+	assert.NilError(t, delivery.Set("forward:traps=exactly-once"))
+	assert.ErrorContains(t, delivery.Set("webhook=twice"), "invalid delivery mode")
+	assert.ErrorContains(t, delivery.Set("at-least-once"), "invalid delivery mode")
+	assert.Equal(t, "forward:traps=exactly-once, webhook=at-least-once", delivery.String())
+
+	assert.Equal(t, DeliveryAtLeastOnce, delivery.modeOf(&countingOutput{name: "webhook:alerts"}))
+	assert.Equal(t, DeliveryExactlyOnce, delivery.modeOf(&countingOutput{name: "forward:traps"}))
+	assert.Equal(t, DeliveryAtMostOnce, delivery.modeOf(&countingOutput{name: "forward:flows"}))
+
+	// Exactly-once requires idempotent outputs
+	cli := &KafkaClient{Outputs: []Output{&countingOutput{name: "forward:traps"}}, OutputDelivery: delivery}
+	assert.ErrorContains(t, cli.validateDelivery(), "doesn't support the exactly-once delivery mode")
+	cli.Outputs = []Output{&ElasticOutput{}}
+	cli.OutputDelivery = OutputDelivery{"elasticsearch": DeliveryExactlyOnce}
+	assert.NilError(t, cli.validateDelivery())
+	assert.Equal(t, DeliveryExactlyOnce, cli.DeliveryGuarantee())
+
+	cli.Outputs = []Output{&countingOutput{name: "forward:traps"}}
+	assert.Equal(t, DeliveryAtMostOnce, cli.DeliveryGuarantee())
+	cli.CommitPolicy = CommitOnSuccess
+	assert.Equal(t, DeliveryAtLeastOnce, cli.DeliveryGuarantee())
+}
+
+func TestAtLeastOnceDelivery(t *testing.T) {
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	cli.Parser = "heartbeat"
+	cli.CommitRetryDelay = time.Millisecond
+	done := make(chan struct{})
+	cli.done = done
+	handler := func(msg DecodedMessage) error { return nil }
+	webhook := &flakyOutput{name: "webhook:alerts", failures: 2}
+	forward := &flakyOutput{name: "forward:traps", failures: 2}
+	cli.Outputs = []Output{webhook, forward}
+	cli.OutputDelivery = OutputDelivery{"webhook": DeliveryAtLeastOnce}
+
+	msg := buildMessage("001", 0, 1, []byte("ABC"))
+	cli.handleMessage(msg, handler)
+	assert.Equal(t, 3, webhook.attempts)
+	assert.Equal(t, 1, forward.attempts) // At most once
+	<-msg.Acked()
+
+	// The message is not acknowledged when the client stops while retrying
+	cli.CommitRetryDelay = time.Minute
+	close(done)
+	webhook.attempts = 0
+	msg = buildMessage("002", 0, 1, []byte("ABC"))
+	cli.handleMessage(msg, handler)
+	assert.Equal(t, 1, webhook.attempts)
+	select {
+	case <-msg.Acked():
+		t.Fatal("message acknowledged after a failure")
+	default:
+	}
+}
@@ -0,0 +1,347 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default Elasticsearch output settings
+const (
+	DefaultElasticIndex         = "onms-%{parser}-%{+yyyy.MM.dd}"
+	DefaultElasticBatchSize     = 500
+	DefaultElasticFlushInterval = 5 * time.Second
+	DefaultElasticMaxRetries    = 3
+	DefaultElasticRetryDelay    = time.Second
+)
+
+// indexPlaceholder matches the placeholders of an index pattern, i.e. {location}, {yyyy.MM.dd}, or the Logstash syntax like %{+yyyy.MM.dd}.
+var indexPlaceholder = regexp.MustCompile(`%?\{([^}]+)\}`)
+
+// datePattern matches the placeholders that only contain date tokens and separators.
+var datePattern = regexp.MustCompile(`^[yMdHm._-]+$`)
+
+// invalidIndexChars matches the characters not allowed on index names.
+var invalidIndexChars = regexp.MustCompile(`[\\/*?"<>|,# :]+`)
+
+// dateLayout converts the Joda-style date tokens used by Logstash into the Go layout.
+var dateLayout = strings.NewReplacer("yyyy", "2006", "yy", "06", "MM", "01", "dd", "02", "HH", "15", "mm", "04")
+
+// elasticDocument represents a document to be indexed.
+type elasticDocument struct {
+	index string
+	id    string // Derived from the source coordinates and the body, so redelivered messages overwrite the same document.
+	body  []byte
+}
+
+// ElasticOutput bulk-indexes the decoded Syslog messages, SNMP traps and flows into Elasticsearch,
+// as a lightweight alternative to the OpenNMS persistence.
+// Documents are queued and sent in batches from the background; when the queue is full, Send blocks until there is room
+// or the context expires, which slows down the consumer instead of losing messages.
+type ElasticOutput struct {
+	URL           string        // The Elasticsearch endpoint, i.e. http://localhost:9200.
+	Index         string        // The index pattern; accepts {parser}, {location}, and dates like {yyyy.MM.dd} (defaults to DefaultElasticIndex).
+	Username      string        // Username for basic authentication (optional).
+	Password      string        `json:"-"` // Password for basic authentication; accepts secret references (see ResolveSecret).
+	BatchSize     int           // The maximum number of documents per bulk request (defaults to DefaultElasticBatchSize).
+	FlushInterval time.Duration // The maximum time a document waits in the queue (defaults to DefaultElasticFlushInterval).
+	MaxRetries    int           // How many times a failed bulk request or document is retried (defaults to DefaultElasticMaxRetries).
+	RetryDelay    time.Duration // The delay before the first retry, doubled on each attempt (defaults to DefaultElasticRetryDelay).
+	QueueSize     int           // The maximum number of queued documents (defaults to 10 times the batch size).
+	Client        *http.Client  `json:"-"` // The HTTP client (optional).
+
+	queue chan elasticDocument
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// Validate Verifies the Elasticsearch output settings, applying defaults when necessary, and starts the background indexer.
+func (out *ElasticOutput) Validate() error {
+	if out.URL == "" {
+		return fmt.Errorf("the Elasticsearch URL is required")
+	}
+	out.URL = strings.TrimSuffix(out.URL, "/")
+	if out.Index == "" {
+		out.Index = DefaultElasticIndex
+	}
+	if out.Username != "" && out.Password == "" {
+		return fmt.Errorf("password is required for basic authentication")
+	}
+	if _, err := ResolveSecret(out.Password); err != nil {
+		return fmt.Errorf("cannot resolve Elasticsearch password: %v", err)
+	}
+	if out.BatchSize <= 0 {
+		out.BatchSize = DefaultElasticBatchSize
+	}
+	if out.FlushInterval <= 0 {
+		out.FlushInterval = DefaultElasticFlushInterval
+	}
+	if out.MaxRetries <= 0 {
+		out.MaxRetries = DefaultElasticMaxRetries
+	}
+	if out.RetryDelay <= 0 {
+		out.RetryDelay = DefaultElasticRetryDelay
+	}
+	if out.QueueSize <= 0 {
+		out.QueueSize = 10 * out.BatchSize
+	}
+	if out.queue == nil {
+		out.queue = make(chan elasticDocument, out.QueueSize)
+		out.stop = make(chan struct{})
+		out.wg.Add(1)
+		go out.run()
+	}
+	return nil
+}
+
+// Name Returns the name of the output.
+func (out *ElasticOutput) Name() string {
+	return "elasticsearch"
+}
+
+// Send Queues a Syslog message, an SNMP trap or a flow to be indexed.
+// Messages from other parsers are ignored.
+func (out *ElasticOutput) Send(ctx context.Context, msg DecodedMessage) error {
+	if !isSyslog(msg.Parser) && !isSnmp(msg.Parser) && !isTelemetry(msg.Parser) {
+		return nil
+	}
+	body, err := elasticBody(msg)
+	if err != nil {
+		return err
+	}
+	doc := elasticDocument{index: out.indexName(msg), id: elasticID(msg, body), body: body}
+	select {
+	case out.queue <- doc:
+		return nil
+	case <-ctx.Done():
+		return &OutputError{Err: fmt.Errorf("cannot queue document: %v", ctx.Err()), Retryable: true}
+	}
+}
+
+// Idempotent Returns true, as the documents are indexed with a deterministic ID, so redelivered messages don't create duplicates.
+func (out *ElasticOutput) Idempotent() bool {
+	return true
+}
+
+// elasticID Returns the ID of the document of a message, as the SHA-1 of its coordinates and its body.
+func elasticID(msg DecodedMessage, body []byte) string {
+	hash := sha1.New()
+	hash.Write([]byte(msg.Coordinates()))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Close Stops the background indexer, after sending the queued documents.
+func (out *ElasticOutput) Close() error {
+	if out.stop != nil {
+		close(out.stop)
+		out.wg.Wait()
+		out.stop = nil
+	}
+	return nil
+}
+
+// indexName Returns the index for a given message, based on the index pattern.
+// Dates are based on the Kafka timestamp of the message in UTC, and the result is always lowercase.
+// The location of the messages without one is replaced with "unknown", and the characters not allowed on index names are replaced with underscores.
+func (out *ElasticOutput) indexName(msg DecodedMessage) string {
+	ts := msg.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	name := indexPlaceholder.ReplaceAllStringFunc(out.Index, func(placeholder string) string {
+		key := indexPlaceholder.FindStringSubmatch(placeholder)[1]
+		switch {
+		case strings.HasPrefix(key, "+"):
+			return ts.UTC().Format(dateLayout.Replace(key[1:]))
+		case key == "parser":
+			return msg.Parser
+		case key == "location":
+			if msg.Metadata.Location == "" {
+				return "unknown"
+			}
+			return invalidIndexChars.ReplaceAllString(msg.Metadata.Location, "_")
+		case datePattern.MatchString(key):
+			return ts.UTC().Format(dateLayout.Replace(key))
+		}
+		return placeholder
+	})
+	return strings.ToLower(name)
+}
+
+// elasticBody Builds the document for a decoded message, adding its timestamp and metadata to the JSON payload.
+func elasticBody(msg DecodedMessage) ([]byte, error) {
+	doc := make(map[string]interface{})
+	if err := json.Unmarshal(msg.Payload, &doc); err != nil {
+		return nil, fmt.Errorf("invalid %s message: %v", msg.Parser, err)
+	}
+	ts := msg.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	doc["@timestamp"] = ts.UTC().Format(time.RFC3339Nano)
+	doc["@parser"] = msg.Parser
+	for key, value := range map[string]string{
+		"location":      msg.Metadata.Location,
+		"systemId":      msg.Metadata.SystemID,
+		"sourceAddress": msg.Metadata.SourceAddress,
+	} {
+		if _, ok := doc[key]; !ok && value != "" {
+			doc[key] = value
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// run Sends the queued documents in batches, until the output is closed.
+func (out *ElasticOutput) run() {
+	defer out.wg.Done()
+	ticker := time.NewTicker(out.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]elasticDocument, 0, out.BatchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			out.index(batch)
+			batch = make([]elasticDocument, 0, out.BatchSize)
+		}
+	}
+	for {
+		select {
+		case doc := <-out.queue:
+			if batch = append(batch, doc); len(batch) >= out.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-out.stop:
+			for len(out.queue) > 0 {
+				batch = append(batch, <-out.queue)
+				if len(batch) >= out.BatchSize {
+					flush()
+				}
+			}
+			flush()
+			return
+		}
+	}
+}
+
+// index Sends a batch of documents through the bulk API.
+// Retryable failures are retried with an exponential backoff; the documents rejected permanently, or after all the retries, are dropped.
+func (out *ElasticOutput) index(batch []elasticDocument) {
+	delay := out.RetryDelay
+	for attempt := 0; ; attempt++ {
+		failed, err := out.bulk(batch)
+		if err == nil {
+			if len(failed) == 0 {
+				return
+			}
+			batch = failed
+			err = fmt.Errorf("documents rejected temporarily")
+		} else if outputResult(err) != OutputRetryable {
+			defaultLogger.Errorf("cannot index %d documents, dropping them: %v", len(batch), err)
+			return
+		}
+		if attempt >= out.MaxRetries {
+			defaultLogger.Errorf("cannot index %d documents after %d retries, dropping them: %v", len(batch), attempt, err)
+			return
+		}
+		defaultLogger.Warnf("cannot index %d documents, retrying in %s: %v", len(batch), delay, err)
+		select {
+		case <-time.After(delay):
+		case <-out.stop:
+			if attempt > 0 { // Don't delay the shutdown for more than one retry
+				return
+			}
+		}
+		delay *= 2
+	}
+}
+
+// bulkResponse represents the relevant content of a response from the bulk API.
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// bulk Sends a single bulk request, returning the documents that should be retried.
+// The documents rejected permanently are logged and discarded.
+func (out *ElasticOutput) bulk(batch []elasticDocument) ([]elasticDocument, error) {
+	body := &bytes.Buffer{}
+	for _, doc := range batch {
+		action, _ := json.Marshal(map[string]interface{}{"index": map[string]string{"_index": doc.index, "_id": doc.id}})
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(doc.body)
+		body.WriteByte('\n')
+	}
+	url := out.URL + "/_bulk"
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if out.Username != "" {
+		password, err := ResolveSecret(out.Password)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve Elasticsearch password: %v", err)
+		}
+		req.SetBasicAuth(out.Username, password)
+	}
+	client := out.Client
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, &OutputError{Err: fmt.Errorf("cannot send request to %s: %v", url, err), Retryable: true}
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return nil, &OutputError{
+			Err:       fmt.Errorf("unexpected response from %s: %s %s", url, res.Status, string(bytes.TrimSpace(msg))),
+			Retryable: res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500,
+		}
+	}
+	result := &bulkResponse{}
+	if err := json.NewDecoder(res.Body).Decode(result); err != nil {
+		return nil, fmt.Errorf("invalid response from %s: %v", url, err)
+	}
+	if !result.Errors {
+		return nil, nil
+	}
+	var failed []elasticDocument
+	for i, item := range result.Items {
+		if i >= len(batch) {
+			break
+		}
+		for _, status := range item {
+			switch {
+			case status.Status == http.StatusTooManyRequests || status.Status >= 500:
+				failed = append(failed, batch[i])
+			case status.Status < 200 || status.Status > 299:
+				defaultLogger.Errorf("cannot index document on %s: %s %s", batch[i].index, status.Error.Type, status.Error.Reason)
+			}
+		}
+	}
+	return failed, nil
+}
@@ -0,0 +1,100 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestElasticIndexName(t *testing.T) {
+	out := &ElasticOutput{Index: "netflow-%{+yyyy.MM.dd}"}
+	msg := DecodedMessage{Parser: "Netflow", Timestamp: time.Date(2021, 3, 4, 23, 30, 0, 0, time.FixedZone("EST", -5*3600))}
+	assert.Equal(t, "netflow-2021.03.05", out.indexName(msg))
+	out.Index = "Sink-%{parser}-%{+yyyy.MM}-%{unknown}"
+	assert.Equal(t, "sink-netflow-2021.03-%{unknown}", out.indexName(msg))
+
+	out.Index = "sink-traps-{location}-{yyyy.MM.dd}"
+	assert.Equal(t, "sink-traps-unknown-2021.03.05", out.indexName(msg))
+	msg.Metadata.Location = "New York/East"
+	assert.Equal(t, "sink-traps-new_york_east-2021.03.05", out.indexName(msg))
+}
+
+func TestElasticOutput(t *testing.T) {
+	var mutex sync.Mutex
+	var indices []string
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		assert.Equal(t, "/_bulk", r.URL.Path)
+		user, pass, _ := r.BasicAuth()
+		assert.Equal(t, "elastic", user)
+		assert.Equal(t, "s3cr3t", pass)
+		attempts++
+		var items []string
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			action := map[string]map[string]string{}
+			assert.NilError(t, json.Unmarshal(scanner.Bytes(), &action))
+			scanner.Scan()
+			doc := map[string]interface{}{}
+			assert.NilError(t, json.Unmarshal(scanner.Bytes(), &doc))
+			assert.Equal(t, "Test", doc["location"])
+			status := `{"index":{"status":201}}`
+			if attempts == 1 && len(items) == 0 { // Reject the first document temporarily on the first request
+				status = `{"index":{"status":429,"error":{"type":"es_rejected_execution_exception"}}}`
+			} else {
+				indices = append(indices, action["index"]["_index"])
+			}
+			items = append(items, status)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"errors":true,"items":[`))
+		for i, item := range items {
+			if i > 0 {
+				w.Write([]byte(","))
+			}
+			w.Write([]byte(item))
+		}
+		w.Write([]byte(`]}`))
+	}))
+	defer server.Close()
+
+	out := &ElasticOutput{
+		URL:           server.URL,
+		Username:      "elastic",
+		Password:      "s3cr3t",
+		BatchSize:     2,
+		FlushInterval: time.Minute,
+		RetryDelay:    10 * time.Millisecond,
+	}
+	assert.NilError(t, out.Validate())
+	ts := time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)
+	for _, parser := range []string{"syslog", "snmp", "heartbeat"} {
+		msg := DecodedMessage{Parser: parser, Timestamp: ts, Metadata: Metadata{Location: "Test"}, Payload: []byte(`{"messages":[]}`)}
+		assert.NilError(t, out.Send(context.Background(), msg))
+	}
+	assert.NilError(t, out.Close())
+	assert.Equal(t, 2, attempts)
+	assert.DeepEqual(t, []string{"onms-snmp-2021.03.04", "onms-syslog-2021.03.04"}, indices)
+}
+
+func TestElasticOutputBackpressure(t *testing.T) {
+	out := &ElasticOutput{URL: "http://127.0.0.1:1", BatchSize: 1, QueueSize: 1}
+	out.queue = make(chan elasticDocument, 1) // No indexer, so the queue is never drained
+	assert.NilError(t, out.Validate())
+	msg := DecodedMessage{Parser: "syslog", Payload: []byte(`{}`)}
+	assert.NilError(t, out.Send(context.Background(), msg))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, OutputRetryable, outputResult(out.Send(ctx, msg)))
+}
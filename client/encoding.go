@@ -0,0 +1,56 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+)
+
+// maxPooledBuffer is the maximum capacity of the buffers returned to the pool, so an occasional huge message doesn't stay in memory.
+const maxPooledBuffer = 1 << 20
+
+// pooledEncoder is a JSON encoder that writes into its own buffer.
+type pooledEncoder struct {
+	buf bytes.Buffer
+	enc *json.Encoder
+}
+
+// encoderPool reuses the encoders and their buffers across messages, as the payloads of flows can be tens of KB each.
+var encoderPool = sync.Pool{
+	New: func() interface{} {
+		e := &pooledEncoder{}
+		e.enc = json.NewEncoder(&e.buf)
+		e.enc.SetIndent("", "  ")
+		return e
+	},
+}
+
+// encodeIndent Encodes an object as indented JSON into a pooled buffer, and executes the action with the result.
+// The data is only valid during the action, as the buffer is reused afterwards.
+func encodeIndent(v interface{}, action func(data []byte)) error {
+	e := encoderPool.Get().(*pooledEncoder)
+	defer func() {
+		if e.buf.Cap() <= maxPooledBuffer {
+			e.buf.Reset()
+			encoderPool.Put(e)
+		}
+	}()
+	if err := e.enc.Encode(v); err != nil {
+		return err
+	}
+	action(bytes.TrimSuffix(e.buf.Bytes(), []byte("\n")))
+	return nil
+}
+
+// marshalIndent Returns the indented JSON representation of an object, like json.MarshalIndent with two spaces,
+// but using pooled buffers, so the only allocation is the result.
+func marshalIndent(v interface{}) ([]byte, error) {
+	var out []byte
+	err := encodeIndent(v, func(data []byte) {
+		out = make([]byte, len(data))
+		copy(out, data)
+	})
+	return out, err
+}
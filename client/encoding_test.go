@@ -0,0 +1,46 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/netflow"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"gotest.tools/v3/assert"
+)
+
+func TestMarshalIndent(t *testing.T) {
+	flow := &netflow.FlowMessage{
+		Timestamp:  1000,
+		SrcAddress: "10.0.0.1",
+		DstAddress: "<script>",
+		NumBytes:   &wrapperspb.UInt64Value{Value: 1500},
+	}
+	expected, err := json.MarshalIndent(flow, "", "  ")
+	assert.NilError(t, err)
+	for i := 0; i < 3; i++ { // Reuses the pooled encoders
+		data, err := marshalIndent(flow)
+		assert.NilError(t, err)
+		assert.Equal(t, string(expected), string(data))
+	}
+
+	// Oversized buffers are not returned to the pool
+	big := strings.Repeat("x", maxPooledBuffer+1)
+	data, err := marshalIndent(big)
+	assert.NilError(t, err)
+	assert.Equal(t, maxPooledBuffer+3, len(data))
+
+	_, err = marshalIndent(func() {})
+	assert.ErrorContains(t, err, "unsupported type")
+}
+
+func BenchmarkMarshalIndent(b *testing.B) {
+	flow := &netflow.FlowMessage{Timestamp: 1000, SrcAddress: "10.0.0.1", DstAddress: "10.0.0.2", NumBytes: &wrapperspb.UInt64Value{Value: 1500}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		marshalIndent(flow)
+	}
+}
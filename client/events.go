@@ -0,0 +1,96 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+)
+
+// EventValueDTO represents the value of an event parameter
+type EventValueDTO struct {
+	Type     string `xml:"type,attr" json:"type"`
+	Encoding string `xml:"encoding,attr" json:"encoding"`
+	Content  string `xml:",chardata" json:"content"`
+}
+
+// MarshalJSON converts the event parameter value to JSON, decoding it when it is encoded in base64
+func (dto EventValueDTO) MarshalJSON() ([]byte, error) {
+	content := dto.Content
+	if dto.Encoding == "base64" {
+		if data, err := base64.StdEncoding.DecodeString(content); err == nil {
+			content = string(data)
+		} else {
+			defaultLogger.Errorf("cannot decode base64 value: %v", err)
+		}
+	}
+	return json.Marshal(struct {
+		Type    string `json:"type"`
+		Content string `json:"content"`
+	}{dto.Type, content})
+}
+
+// EventParameterDTO represents an event parameter
+type EventParameterDTO struct {
+	Name  string        `xml:"parmName" json:"name"`
+	Value EventValueDTO `xml:"value" json:"value"`
+}
+
+// EventLogMessageDTO represents the log message of an event
+type EventLogMessageDTO struct {
+	Dest    string `xml:"dest,attr" json:"dest,omitempty"`
+	Content string `xml:",chardata" json:"content"`
+}
+
+// EventAlarmDataDTO represents the alarm data of an event
+type EventAlarmDataDTO struct {
+	ReductionKey string `xml:"reduction-key,attr" json:"reductionKey"`
+	AlarmType    int    `xml:"alarm-type,attr" json:"alarmType"`
+	ClearKey     string `xml:"clear-key,attr" json:"clearKey,omitempty"`
+	AutoClean    bool   `xml:"auto-clean,attr" json:"autoClean"`
+}
+
+// EventDTO represents an OpenNMS event
+type EventDTO struct {
+	UUID         string              `xml:"uuid,attr" json:"uuid,omitempty"`
+	UEI          string              `xml:"uei" json:"uei"`
+	Source       string              `xml:"source" json:"source,omitempty"`
+	DistPoller   string              `xml:"dist-poller" json:"distPoller,omitempty"`
+	NodeID       int64               `xml:"nodeid" json:"nodeId,omitempty"`
+	Time         string              `xml:"time" json:"time,omitempty"`
+	CreationTime string              `xml:"creation-time" json:"creationTime,omitempty"`
+	Host         string              `xml:"host" json:"host,omitempty"`
+	Interface    string              `xml:"interface" json:"interface,omitempty"`
+	SNMPHost     string              `xml:"snmphost" json:"snmpHost,omitempty"`
+	Service      string              `xml:"service" json:"service,omitempty"`
+	IfIndex      int                 `xml:"ifIndex" json:"ifIndex,omitempty"`
+	Parameters   []EventParameterDTO `xml:"parms>parm" json:"parameters,omitempty"`
+	Description  string              `xml:"descr" json:"description,omitempty"`
+	LogMessage   *EventLogMessageDTO `xml:"logmsg" json:"logMessage,omitempty"`
+	Severity     string              `xml:"severity" json:"severity,omitempty"`
+	AlarmData    *EventAlarmDataDTO  `xml:"alarm-data" json:"alarmData,omitempty"`
+}
+
+// EventLogDTO represents a collection of OpenNMS events
+type EventLogDTO struct {
+	XMLName xml.Name   `xml:"log" json:"-"`
+	Events  []EventDTO `xml:"events>event" json:"events"`
+}
+
+// String Returns the JSON representation of the events
+func (dto EventLogDTO) String() string {
+	var s string
+	if err := encodeIndent(dto, func(data []byte) { s = string(data) }); err != nil {
+		defaultLogger.Errorf("cannot generate JSON for events: %v", err)
+	}
+	return s
+}
+
+// metadata Returns the metadata of the events, based on the first one, as the events sent together come from the same Minion.
+func (dto *EventLogDTO) metadata() Metadata {
+	if len(dto.Events) == 0 {
+		return Metadata{}
+	}
+	return Metadata{SystemID: dto.Events[0].DistPoller, SourceAddress: dto.Events[0].Interface}
+}
@@ -0,0 +1,86 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestEventsParser(t *testing.T) {
+	cli := &KafkaClient{IPC: "sink"}
+	data := []byte(`<log xmlns="http://xmlns.opennms.org/xsd/event">
+ <events>
+  <event uuid="5a1f3f4e-7a2c-4d8b-9a4e-0f6a3c1d2b7e">
+   <uei>uei.opennms.org/generic/traps/SNMP_Cold_Start</uei>
+   <source>trapd</source>
+   <dist-poller>minion01</dist-poller>
+   <nodeid>12</nodeid>
+   <time>2021-03-26T18:42:53.803Z</time>
+   <interface>10.0.0.1</interface>
+   <parms>
+    <parm><parmName><![CDATA[sysName]]></parmName><value type="string" encoding="text"><![CDATA[router01]]></value></parm>
+    <parm><parmName><![CDATA[sysDescr]]></parmName><value type="string" encoding="base64">Q2lzY28gSU9T</value></parm>
+   </parms>
+   <logmsg dest="logndisplay">Agent Up with Possible Changes</logmsg>
+   <severity>Normal</severity>
+   <alarm-data reduction-key="uei.opennms.org/generic/traps/SNMP_Cold_Start:12" alarm-type="3" auto-clean="false"/>
+  </event>
+ </events>
+</log>`)
+	var payload []byte
+	var meta Metadata
+	cli.decodePayload(data, "OpenNMS.Sink.Events", "events", func(p []byte, m Metadata) {
+		payload, meta = p, m
+	})
+	assert.Equal(t, `{
+  "events": [
+    {
+      "uuid": "5a1f3f4e-7a2c-4d8b-9a4e-0f6a3c1d2b7e",
+      "uei": "uei.opennms.org/generic/traps/SNMP_Cold_Start",
+      "source": "trapd",
+      "distPoller": "minion01",
+      "nodeId": 12,
+      "time": "2021-03-26T18:42:53.803Z",
+      "interface": "10.0.0.1",
+      "parameters": [
+        {
+          "name": "sysName",
+          "value": {
+            "type": "string",
+            "content": "router01"
+          }
+        },
+        {
+          "name": "sysDescr",
+          "value": {
+            "type": "string",
+            "content": "Cisco IOS"
+          }
+        }
+      ],
+      "logMessage": {
+        "dest": "logndisplay",
+        "content": "Agent Up with Possible Changes"
+      },
+      "severity": "Normal",
+      "alarmData": {
+        "reductionKey": "uei.opennms.org/generic/traps/SNMP_Cold_Start:12",
+        "alarmType": 3,
+        "autoClean": false
+      }
+    }
+  ]
+}`, string(payload))
+	assert.Equal(t, "minion01", meta.SystemID)
+	assert.Equal(t, "10.0.0.1", meta.SourceAddress)
+
+	// Invalid payloads are discarded
+	payload = nil
+	cli.decodePayload([]byte("ABC"), "OpenNMS.Sink.Events", "events", func(p []byte, m Metadata) {
+		payload = p
+	})
+	assert.Assert(t, payload == nil)
+	assert.Equal(t, "events", inferParser("OpenNMS.Sink.Events"))
+}
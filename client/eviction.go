@@ -0,0 +1,122 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"time"
+
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// partialMessage represents a multi-part message that is being reassembled.
+type partialMessage struct {
+	content   []byte // The content received so far, unless held by the chunk store.
+	size      int    // The number of bytes received so far.
+	chunk     int32  // The last processed chunk.
+	total     int32
+	firstSeen time.Time        // When the first chunk arrived.
+	lastSeen  time.Time        // When the latest chunk arrived.
+	topic     string           // The Kafka topic of the first chunk.
+	partition int32            // The Kafka partition of the first chunk, or -1 when unknown.
+	offset    int64            // The Kafka offset of the first chunk, or -1 when unknown.
+	chunkSize int              // The size of the first chunk.
+	invalid   string           // The first integrity failure found, if any.
+	links     []oteltrace.Link // The spans of the buffered chunks, when tracing through OpenTelemetry.
+}
+
+// Eviction reasons
+const (
+	EvictionStalled = "stalled"
+	EvictionExpired = "expired"
+)
+
+// PartialMessageEvicted defines the action to execute when a partial message is evicted from the reassembly buffer.
+// It receives the message ID, the eviction reason (stalled, expired, manual or revoked), the number of chunks received, and the total number of chunks.
+type PartialMessageEvicted func(id, reason string, chunks, total int32)
+
+// isStalled returns true when no new chunk arrived within the timeout.
+func (p *partialMessage) isStalled(now time.Time, timeout time.Duration) bool {
+	return timeout > 0 && now.Sub(p.lastSeen) > timeout
+}
+
+// isExpired returns true when the first chunk is older than the maximum age.
+func (p *partialMessage) isExpired(now time.Time, maxAge time.Duration) bool {
+	return maxAge > 0 && now.Sub(p.firstSeen) > maxAge
+}
+
+// evictPartialMessages Removes the partial messages that are stalled or too old.
+// Returns the number of stalled and expired messages that were evicted.
+// This is a concurrent safe method.
+func (cli *KafkaClient) evictPartialMessages(now time.Time) (stalled int, expired int) {
+	type eviction struct {
+		id      string
+		reason  string
+		partial *partialMessage
+	}
+	var evicted []eviction
+	defer func() { // The callback is executed without holding the lock
+		if cli.OnPartialMessageEvicted == nil {
+			return
+		}
+		for _, e := range evicted {
+			cli.OnPartialMessageEvicted(e.id, e.reason, e.partial.chunk, e.partial.total)
+		}
+	}()
+	cli.mutex.Lock()
+	defer cli.mutex.Unlock()
+	for id, partial := range cli.msgBuffer {
+		reason := EvictionExpired
+		if partial.isExpired(now, cli.ChunkMaxAge) {
+			cli.logger().Warnf("evicting message %s, received %d of %d chunks since %s", id, partial.chunk, partial.total, partial.firstSeen.Format(time.RFC3339))
+			expired++
+			if cli.expiredEvicted != nil {
+				cli.expiredEvicted.Inc()
+			}
+		} else if partial.isStalled(now, cli.ChunkStallTimeout) {
+			cli.logger().Warnf("evicting message %s, received %d of %d chunks and no new chunk since %s", id, partial.chunk, partial.total, partial.lastSeen.Format(time.RFC3339))
+			reason = EvictionStalled
+			stalled++
+			if cli.stalledEvicted != nil {
+				cli.stalledEvicted.Inc()
+			}
+		} else {
+			continue
+		}
+		cli.trace(id, "partial message evicted (%s)", reason)
+		evicted = append(evicted, eviction{id, reason, partial})
+		cli.countDroppedChunks(partial.topic, DropEvicted, partial.chunk)
+		cli.discardPartial(id, partial)
+	}
+	return
+}
+
+// janitorInterval Returns how often the partial messages should be verified.
+func (cli *KafkaClient) janitorInterval() time.Duration {
+	interval := cli.ChunkStallTimeout
+	if interval == 0 || (cli.ChunkMaxAge > 0 && cli.ChunkMaxAge < interval) {
+		interval = cli.ChunkMaxAge
+	}
+	interval = interval / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return interval
+}
+
+// runJanitor Evicts the stalled or expired partial messages periodically, until the done channel is closed.
+// It does nothing when both eviction policies are disabled.
+func (cli *KafkaClient) runJanitor(done <-chan struct{}) {
+	if cli.ChunkStallTimeout == 0 && cli.ChunkMaxAge == 0 {
+		return
+	}
+	ticker := time.NewTicker(cli.janitorInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			cli.evictPartialMessages(now)
+		case <-done:
+			return
+		}
+	}
+}
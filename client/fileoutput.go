@@ -0,0 +1,216 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fileOutputTimeFormat is the format of the timestamp added to the name of the rotated files, which sorts them chronologically.
+const fileOutputTimeFormat = "20060102T150405.000"
+
+// FileOutput appends the decoded messages to a file, one JSON document per line, using the same envelope as the ForwardOutput with the json format.
+// The file is rotated when it would exceed the maximum size, or on the first message after the rotation interval, renaming it
+// with the time of the rotation before the extension (i.e. messages-20210304T233000.000.jsonl), and optionally compressing it with gzip.
+// This is a concurrent safe object.
+type FileOutput struct {
+	Path           string        // The path of the active file, which is created if necessary.
+	MaxSize        int64         // Rotate the file when it would exceed this size in bytes (0 to disable).
+	RotateInterval time.Duration // Rotate the file when it was opened longer than this period ago (0 to disable).
+	Compress       bool          // Compress the rotated files with gzip.
+	MaxBackups     int           // The maximum number of rotated files to keep, removing the oldest ones (0 to keep all of them).
+
+	mutex  sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+	wg     sync.WaitGroup // Tracks the compression of the rotated files.
+	backup sync.Mutex     // Serializes the compression and pruning of the rotated files.
+}
+
+// Validate Verifies the file output settings.
+func (out *FileOutput) Validate() error {
+	if out.Path == "" {
+		return fmt.Errorf("the file path is required")
+	}
+	if out.MaxSize < 0 {
+		return fmt.Errorf("invalid maximum size %d", out.MaxSize)
+	}
+	if out.RotateInterval < 0 {
+		return fmt.Errorf("invalid rotation interval %s", out.RotateInterval)
+	}
+	if out.MaxBackups < 0 {
+		return fmt.Errorf("invalid maximum backups %d", out.MaxBackups)
+	}
+	return nil
+}
+
+// Name Returns the name of the output.
+func (out *FileOutput) Name() string {
+	return "file:" + out.Path
+}
+
+// Send Appends a decoded message to the file, rotating it when necessary.
+// Failures to write are reported as retryable, as they are usually transient, i.e. a full disk.
+func (out *FileOutput) Send(ctx context.Context, msg DecodedMessage) error {
+	data, err := json.Marshal(newForwardEnvelope(msg))
+	if err != nil {
+		return fmt.Errorf("cannot encode message: %v", err)
+	}
+	data = append(data, '\n')
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+	if out.file != nil && out.shouldRotate(int64(len(data))) {
+		if err := out.rotate(); err != nil {
+			return &OutputError{Err: err, Retryable: true}
+		}
+	}
+	if out.file == nil {
+		if err := out.open(); err != nil {
+			return &OutputError{Err: err, Retryable: true}
+		}
+	}
+	n, err := out.file.Write(data)
+	out.size += int64(n)
+	if err != nil {
+		return &OutputError{Err: fmt.Errorf("cannot write to %s: %v", out.Path, err), Retryable: true}
+	}
+	return nil
+}
+
+// Close Closes the active file, waiting for the rotated files to be compressed.
+func (out *FileOutput) Close() error {
+	out.mutex.Lock()
+	var err error
+	if out.file != nil {
+		err = out.file.Close()
+		out.file = nil
+	}
+	out.mutex.Unlock()
+	out.wg.Wait()
+	return err
+}
+
+// open Opens the active file for appending, creating its directory when necessary.
+func (out *FileOutput) open() error {
+	if err := os.MkdirAll(filepath.Dir(out.Path), 0755); err != nil {
+		return fmt.Errorf("cannot create directory for %s: %v", out.Path, err)
+	}
+	file, err := os.OpenFile(out.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot open %s: %v", out.Path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("cannot open %s: %v", out.Path, err)
+	}
+	out.file = file
+	out.size = info.Size()
+	out.opened = time.Now()
+	return nil
+}
+
+// shouldRotate Returns true when the active file must be rotated before appending a number of bytes.
+// A non-empty file is required, so messages bigger than the maximum size are still written.
+func (out *FileOutput) shouldRotate(bytes int64) bool {
+	if out.size == 0 {
+		return false
+	}
+	if out.MaxSize > 0 && out.size+bytes > out.MaxSize {
+		return true
+	}
+	return out.RotateInterval > 0 && time.Since(out.opened) >= out.RotateInterval
+}
+
+// rotate Closes and renames the active file, which is compressed and pruned in the background.
+func (out *FileOutput) rotate() error {
+	out.file.Close()
+	out.file = nil
+	ext := filepath.Ext(out.Path)
+	rotated := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(out.Path, ext), time.Now().Format(fileOutputTimeFormat), ext)
+	if err := os.Rename(out.Path, rotated); err != nil {
+		return fmt.Errorf("cannot rotate %s: %v", out.Path, err)
+	}
+	defaultLogger.Debugf("rotated %s to %s", out.Path, rotated)
+	out.wg.Add(1)
+	go func() {
+		defer out.wg.Done()
+		out.backup.Lock()
+		defer out.backup.Unlock()
+		if out.Compress {
+			if err := compressFile(rotated); err != nil {
+				defaultLogger.Errorf("cannot compress %s: %v", rotated, err)
+			}
+		}
+		out.prune()
+	}()
+	return nil
+}
+
+// prune Removes the oldest rotated files, keeping the maximum number of backups.
+func (out *FileOutput) prune() {
+	if out.MaxBackups == 0 {
+		return
+	}
+	ext := filepath.Ext(out.Path)
+	backups, err := filepath.Glob(fmt.Sprintf("%s-*%s*", strings.TrimSuffix(out.Path, ext), ext))
+	if err != nil {
+		return
+	}
+	unique := make(map[string]bool) // A file that couldn't be compressed might be left uncompressed
+	for _, backup := range backups {
+		unique[strings.TrimSuffix(backup, ".gz")] = true
+	}
+	names := make([]string, 0, len(unique))
+	for name := range unique {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for len(names) > out.MaxBackups {
+		for _, path := range []string{names[0], names[0] + ".gz"} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				defaultLogger.Errorf("cannot remove %s: %v", path, err)
+			}
+		}
+		names = names[1:]
+	}
+}
+
+// compressFile Replaces a file with a gzip compressed copy, adding the .gz extension.
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	writer := gzip.NewWriter(dst)
+	if _, err := io.Copy(writer, src); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,66 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestFileOutput(t *testing.T) {
+	dir := t.TempDir()
+	out := &FileOutput{Path: filepath.Join(dir, "messages.jsonl"), MaxSize: 200, Compress: true, MaxBackups: 2}
+	assert.NilError(t, out.Validate())
+	assert.Equal(t, "file:"+out.Path, out.Name())
+	for i := 0; i < 4; i++ {
+		msg := DecodedMessage{Topic: "OpenNMS.Sink.Syslog", Parser: "syslog", Offset: int64(i), Payload: []byte(`{"message":"test"}`)}
+		assert.NilError(t, out.Send(context.Background(), msg))
+		time.Sleep(2 * time.Millisecond) // Ensures unique names for the rotated files
+	}
+	assert.NilError(t, out.Close())
+
+	// Each message is bigger than half the maximum size, so the file is rotated on every message
+	backups, _ := filepath.Glob(filepath.Join(dir, "messages-*.jsonl.gz"))
+	assert.Equal(t, 2, len(backups))
+	file, err := os.Open(backups[1])
+	assert.NilError(t, err)
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	assert.NilError(t, err)
+	envelope := forwardEnvelope{}
+	assert.NilError(t, json.NewDecoder(reader).Decode(&envelope))
+	assert.Equal(t, int64(2), envelope.Offset)
+	assert.Equal(t, `{"message":"test"}`, string(envelope.Payload))
+
+	// The active file contains the last message, and is appended after reopening
+	out = &FileOutput{Path: out.Path, RotateInterval: time.Hour}
+	assert.NilError(t, out.Send(context.Background(), DecodedMessage{Offset: 4}))
+	assert.NilError(t, out.Close())
+	active, err := os.Open(out.Path)
+	assert.NilError(t, err)
+	defer active.Close()
+	lines := 0
+	for scanner := bufio.NewScanner(active); scanner.Scan(); lines++ {
+	}
+	assert.Equal(t, 2, lines)
+
+	// The file is rotated on the first message after the interval
+	out.opened = time.Now().Add(-2 * time.Hour)
+	out.file, _ = os.OpenFile(out.Path, os.O_WRONLY|os.O_APPEND, 0644)
+	out.size = 1
+	assert.NilError(t, out.Send(context.Background(), DecodedMessage{Offset: 5}))
+	assert.NilError(t, out.Close())
+	rotated, _ := filepath.Glob(filepath.Join(dir, "messages-*.jsonl"))
+	assert.Equal(t, 1, len(rotated))
+
+	assert.ErrorContains(t, (&FileOutput{}).Validate(), "required")
+	assert.ErrorContains(t, (&FileOutput{Path: "x", MaxSize: -1}).Validate(), "invalid maximum size")
+}
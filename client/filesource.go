@@ -0,0 +1,123 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// FileSource replays the Kafka records from a capture file (see CaptureRecord), for instance to reproduce an issue,
+// or to benchmark the parsers and the outputs without a Kafka cluster.
+// Each topic is replayed from the records of the same topic, preserving their coordinates, and its channel is closed
+// at the end of the file, which stops the pipelines consuming from it.
+type FileSource struct {
+	Path string // The path of the capture file.
+	Rate int    // The maximum number of records replayed per second on each topic (0 for unlimited).
+
+	mutex     sync.Mutex
+	exhausted map[string]bool
+}
+
+// Validate Verifies the file source settings.
+func (src *FileSource) Validate() error {
+	if src.Path == "" {
+		return fmt.Errorf("the capture file is required")
+	}
+	if _, err := os.Stat(src.Path); err != nil {
+		return fmt.Errorf("cannot access capture file: %v", err)
+	}
+	if src.Rate < 0 {
+		return fmt.Errorf("the rate cannot be negative")
+	}
+	return nil
+}
+
+// Subscribe Replays the records of a topic from the capture file, waiting for the acknowledgement of each of them.
+func (src *FileSource) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	file, err := os.Open(src.Path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open capture file %s: %v", src.Path, err)
+	}
+	src.setExhausted(topic, false)
+	var throttle <-chan time.Time
+	var ticker *time.Ticker
+	if src.Rate > 0 {
+		ticker = time.NewTicker(time.Second / time.Duration(src.Rate))
+		throttle = ticker.C
+	}
+	out := make(chan *message.Message)
+	go func() {
+		defer close(out)
+		defer file.Close()
+		if ticker != nil {
+			defer ticker.Stop()
+		}
+		count := 0
+		err := ReadCapture(file, func(rec *CaptureRecord) error {
+			if rec.Topic != topic {
+				return nil
+			}
+			if throttle != nil {
+				select {
+				case <-throttle:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			msg := message.NewMessage(watermill.NewUUID(), rec.Value)
+			msg.SetContext(WithRecordMetadata(msg.Context(), RecordMetadata{Partition: rec.Partition, Offset: rec.Offset, Timestamp: rec.Timestamp}))
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			select {
+			case <-msg.Acked():
+			case <-msg.Nacked():
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			count++
+			return nil
+		})
+		if ctx.Err() != nil {
+			return // Interrupted, so it can be replayed again
+		}
+		if err != nil {
+			defaultLogger.Errorf("cannot replay %s from %s: %v", topic, src.Path, err)
+		} else {
+			defaultLogger.Infof("replayed %d records of %s from %s", count, topic, src.Path)
+		}
+		src.setExhausted(topic, true)
+	}()
+	return out, nil
+}
+
+// Exhausted Returns true when all the records of a topic were replayed.
+func (src *FileSource) Exhausted(topic string) bool {
+	src.mutex.Lock()
+	defer src.mutex.Unlock()
+	return src.exhausted[topic]
+}
+
+// Close Does nothing, as each subscription closes the file when it finishes or it is cancelled.
+func (src *FileSource) Close() error {
+	return nil
+}
+
+// setExhausted Updates whether or not all the records of a topic were replayed.
+func (src *FileSource) setExhausted(topic string, exhausted bool) {
+	src.mutex.Lock()
+	defer src.mutex.Unlock()
+	if src.exhausted == nil {
+		src.exhausted = make(map[string]bool)
+	}
+	src.exhausted[topic] = exhausted
+}
@@ -0,0 +1,63 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	writer, err := NewCaptureWriter(path)
+	assert.NilError(t, err)
+	ts := time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)
+	for i, rec := range []*CaptureRecord{
+		{Topic: "Replay.Sink.Heartbeat", Partition: 1, Offset: 10, Timestamp: ts, Value: buildMessage("0001", 0, 1, []byte("Minion-1")).Payload},
+		{Topic: "Replay.Sink.Syslog", Partition: 0, Offset: 20, Value: buildMessage("0002", 0, 1, []byte("ignored")).Payload},
+		{Topic: "Replay.Sink.Heartbeat", Partition: 1, Offset: 11, Timestamp: ts, Value: buildMessage("0003", 0, 2, []byte("Minion")).Payload},
+		{Topic: "Replay.Sink.Heartbeat", Partition: 1, Offset: 12, Timestamp: ts, Value: buildMessage("0003", 1, 2, []byte("-2")).Payload},
+	} {
+		assert.NilError(t, writer.Write(rec), "record %d", i)
+	}
+	assert.NilError(t, writer.Close())
+
+	assert.ErrorContains(t, (&FileSource{Path: filepath.Join(t.TempDir(), "missing")}).Validate(), "cannot access")
+	src := &FileSource{Path: path, Rate: 1000}
+	assert.NilError(t, src.Validate())
+	var received []DecodedMessage
+	cli := &KafkaClient{Topic: "Replay.Sink.Heartbeat", GroupID: "file-source-test", Parser: "heartbeat", Source: src}
+	p := NewPipeline("replay", cli, func(msg []byte) {})
+	assert.NilError(t, cli.Initialize(context.Background()))
+	cli.Handle(func(msg DecodedMessage) error {
+		received = append(received, msg)
+		return nil
+	})
+	assert.Assert(t, src.Exhausted("Replay.Sink.Heartbeat"))
+	assert.Assert(t, !src.Exhausted("Replay.Sink.Syslog"))
+	assert.Assert(t, sourceExhausted(src, cli.Topics()))
+	cli.Stop()
+
+	assert.Equal(t, 2, len(received))
+	assert.Equal(t, "Minion-1", string(received[0].Payload))
+	assert.Equal(t, "Minion-2", string(received[1].Payload))
+	assert.Equal(t, "Replay.Sink.Heartbeat/1@12", received[1].Coordinates())
+	assert.Equal(t, ts, received[1].Timestamp)
+
+	// The pipeline stops once the file is exhausted, instead of restarting
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Run(context.Background())
+	}()
+	select {
+	case <-done:
+		assert.Equal(t, PipelineStopped, p.Status().State)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the pipeline")
+	}
+}
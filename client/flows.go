@@ -0,0 +1,170 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/Shopify/sarama"
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/flowdocument"
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/netflow"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultFlowTopic is the topic used by OpenNMS to persist the enriched flows, consumed by Nephron.
+const DefaultFlowTopic = "opennms-flows"
+
+// FlowOutput converts Netflow/IPFIX messages into the FlowDocument format used by the OpenNMS flow persistence,
+// and publishes them to Kafka, so they can be aggregated by Nephron as if they had been processed by OpenNMS.
+// Only the enrichment that doesn't require the OpenNMS inventory is applied (location, exporter, locality and conversation key).
+type FlowOutput struct {
+	Bootstrap  string              // The Kafka Server Bootstrap string.
+	Topic      string              // The name of the Kafka Topic (defaults to DefaultFlowTopic).
+	Parameters Properties          // Additional Kafka producer settings, i.e. security.protocol=SASL_SSL.
+	TLS        TLSConfig           // TLS settings to connect to Kafka (optional).
+	SASL       SASLConfig          // SASL settings to authenticate against Kafka (optional).
+	Producer   sarama.SyncProducer `json:"-"` // The Kafka producer (optional; created by Validate when not provided).
+}
+
+// Validate Verifies the flow output settings, and connects to Kafka.
+func (out *FlowOutput) Validate() error {
+	if out.Topic == "" {
+		out.Topic = DefaultFlowTopic
+	}
+	if out.Producer != nil {
+		return nil
+	}
+	config := sarama.NewConfig()
+	config.Version = sarama.V2_7_0_0
+	config.ClientID = "onms-kafka-ipc-receiver"
+	config.Producer.Return.Successes = true
+	if err := out.Parameters.apply(config); err != nil {
+		return err
+	}
+	if err := out.TLS.apply(config); err != nil {
+		return err
+	}
+	if err := out.SASL.apply(config); err != nil {
+		return err
+	}
+	producer, err := sarama.NewSyncProducer([]string{out.Bootstrap}, config)
+	if err != nil {
+		return fmt.Errorf("cannot create producer for %s: %v", out.Bootstrap, err)
+	}
+	out.Producer = producer
+	return nil
+}
+
+// Name Returns the name of the output.
+func (out *FlowOutput) Name() string {
+	return "flows:" + out.Topic
+}
+
+// Send Publishes a Netflow/IPFIX message as a FlowDocument.
+// Messages from other parsers are ignored.
+// The producer doesn't support cancellation, so the publication continues in the background when the context expires.
+func (out *FlowOutput) Send(ctx context.Context, msg DecodedMessage) error {
+	if !isNetflow(msg.Parser) {
+		return nil
+	}
+	flow := &netflow.FlowMessage{}
+	if err := json.Unmarshal(msg.Payload, flow); err != nil {
+		return fmt.Errorf("invalid flow message: %v", err)
+	}
+	value, err := proto.Marshal(flowDocument(flow, msg.Metadata))
+	if err != nil {
+		return fmt.Errorf("cannot encode flow document: %v", err)
+	}
+	result := make(chan error, 1)
+	go func() {
+		_, _, err := out.Producer.SendMessage(&sarama.ProducerMessage{Topic: out.Topic, Value: sarama.ByteEncoder(value)})
+		result <- err
+	}()
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		return &OutputError{Err: err, Retryable: true}
+	}
+	return nil
+}
+
+// flowDocument Converts a flow message into a flow document, enriched with the metadata of the telemetry message.
+func flowDocument(flow *netflow.FlowMessage, meta Metadata) *flowdocument.FlowDocument {
+	doc := &flowdocument.FlowDocument{
+		Timestamp:         flow.Timestamp,
+		NumBytes:          flow.NumBytes,
+		Direction:         flowdocument.Direction(flow.Direction),
+		DstAddress:        flow.DstAddress,
+		DstHostname:       flow.DstHostname,
+		DstAs:             flow.DstAs,
+		DstMaskLen:        flow.DstMaskLen,
+		DstPort:           flow.DstPort,
+		EngineId:          flow.EngineId,
+		EngineType:        flow.EngineType,
+		DeltaSwitched:     flow.DeltaSwitched,
+		FirstSwitched:     flow.FirstSwitched,
+		LastSwitched:      flow.LastSwitched,
+		NumFlowRecords:    flow.NumFlowRecords,
+		NumPackets:        flow.NumPackets,
+		FlowSeqNum:        flow.FlowSeqNum,
+		InputSnmpIfindex:  flow.InputSnmpIfindex,
+		OutputSnmpIfindex: flow.OutputSnmpIfindex,
+		IpProtocolVersion: flow.IpProtocolVersion,
+		NextHopAddress:    flow.NextHopAddress,
+		NextHopHostname:   flow.NextHopHostname,
+		Protocol:          flow.Protocol,
+		SamplingAlgorithm: flowdocument.SamplingAlgorithm(flow.SamplingAlgorithm),
+		SamplingInterval:  flow.SamplingInterval,
+		SrcAddress:        flow.SrcAddress,
+		SrcHostname:       flow.SrcHostname,
+		SrcAs:             flow.SrcAs,
+		SrcMaskLen:        flow.SrcMaskLen,
+		SrcPort:           flow.SrcPort,
+		TcpFlags:          flow.TcpFlags,
+		Tos:               flow.Tos,
+		NetflowVersion:    flowdocument.NetflowVersion(flow.NetflowVersion),
+		Host:              meta.SourceAddress,
+		Location:          meta.Location,
+		SrcLocality:       locality(flow.SrcAddress),
+		DstLocality:       locality(flow.DstAddress),
+	}
+	if flow.Vlan != nil {
+		doc.Vlan = strconv.Itoa(int(flow.Vlan.Value))
+	}
+	if doc.SrcLocality == flowdocument.Locality_PRIVATE && doc.DstLocality == flowdocument.Locality_PRIVATE {
+		doc.FlowLocality = flowdocument.Locality_PRIVATE
+	}
+	doc.ConvoKey = convoKey(meta.Location, flow)
+	return doc
+}
+
+// locality Returns the locality of an IP address; loopback, link-local and RFC1918/RFC4193 addresses are private.
+func locality(address string) flowdocument.Locality {
+	ip := net.ParseIP(address)
+	if ip != nil && (ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast()) {
+		return flowdocument.Locality_PRIVATE
+	}
+	return flowdocument.Locality_PUBLIC
+}
+
+// convoKey Builds the conversation key like OpenNMS, so both directions of a conversation share the same key.
+// When the flow has no application, the key uses null, as the classification requires the OpenNMS rules.
+func convoKey(location string, flow *netflow.FlowMessage) string {
+	var protocol interface{}
+	if flow.Protocol != nil {
+		protocol = flow.Protocol.Value
+	}
+	lower, upper := flow.SrcAddress, flow.DstAddress
+	if lower > upper {
+		lower, upper = upper, lower
+	}
+	key, _ := json.Marshal([]interface{}{location, protocol, lower, upper, nil})
+	return string(key)
+}
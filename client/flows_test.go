@@ -0,0 +1,66 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/flowdocument"
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/netflow"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"gotest.tools/v3/assert"
+)
+
+func TestFlowOutput(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	out := &FlowOutput{Producer: producer}
+	assert.NilError(t, out.Validate())
+	assert.Equal(t, "flows:"+DefaultFlowTopic, out.Name())
+
+	flow := &netflow.FlowMessage{
+		Timestamp:      1000,
+		NetflowVersion: netflow.NetflowVersion_IPFIX,
+		Direction:      netflow.Direction_EGRESS,
+		SrcAddress:     "192.168.0.1",
+		DstAddress:     "8.8.8.8",
+		Protocol:       &wrapperspb.UInt32Value{Value: 17},
+		NumBytes:       &wrapperspb.UInt64Value{Value: 1500},
+		Vlan:           &wrapperspb.UInt32Value{Value: 10},
+	}
+	payload, _ := json.MarshalIndent(flow, "", "  ")
+	meta := Metadata{Location: "Apex", SourceAddress: "10.0.0.1"}
+
+	producer.ExpectSendMessageWithCheckerFunctionAndSucceed(func(value []byte) error {
+		doc := &flowdocument.FlowDocument{}
+		assert.NilError(t, proto.Unmarshal(value, doc))
+		assert.Equal(t, uint64(1000), doc.Timestamp)
+		assert.Equal(t, flowdocument.NetflowVersion_IPFIX, doc.NetflowVersion)
+		assert.Equal(t, flowdocument.Direction_EGRESS, doc.Direction)
+		assert.Equal(t, uint64(1500), doc.NumBytes.Value)
+		assert.Equal(t, "10", doc.Vlan)
+		assert.Equal(t, "Apex", doc.Location)
+		assert.Equal(t, "10.0.0.1", doc.Host)
+		assert.Equal(t, flowdocument.Locality_PRIVATE, doc.SrcLocality)
+		assert.Equal(t, flowdocument.Locality_PUBLIC, doc.DstLocality)
+		assert.Equal(t, flowdocument.Locality_PUBLIC, doc.FlowLocality)
+		assert.Equal(t, `["Apex",17,"192.168.0.1","8.8.8.8",null]`, doc.ConvoKey)
+		return nil
+	})
+	assert.NilError(t, out.Send(context.Background(), DecodedMessage{Parser: "netflow", Metadata: meta, Payload: payload}))
+	assert.NilError(t, out.Send(context.Background(), DecodedMessage{Parser: "syslog", Payload: []byte("{}")})) // Ignored
+
+	producer.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+	assert.Equal(t, OutputRetryable, outputResult(out.Send(context.Background(), DecodedMessage{Parser: "netflow", Metadata: meta, Payload: payload})))
+	assert.NilError(t, producer.Close())
+}
+
+func TestConvoKey(t *testing.T) {
+	a := &netflow.FlowMessage{SrcAddress: "10.0.0.2", DstAddress: "10.0.0.1", Protocol: &wrapperspb.UInt32Value{Value: 6}}
+	b := &netflow.FlowMessage{SrcAddress: "10.0.0.1", DstAddress: "10.0.0.2", Protocol: &wrapperspb.UInt32Value{Value: 6}}
+	assert.Equal(t, convoKey("Default", a), convoKey("Default", b))
+}
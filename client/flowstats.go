@@ -0,0 +1,319 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/netflow"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Default flow statistics settings
+const (
+	DefaultFlowStatsTopN    = 10
+	DefaultFlowStatsMaxKeys = 10000
+	flowStatsBuckets        = 60 // The number of slots used to track the rolling counts of each window.
+)
+
+// The dimensions of the flow statistics
+const (
+	FlowTalkers       = "talkers"       // By IP address, either source or destination.
+	FlowConversations = "conversations" // By pair of IP addresses, regardless of the direction.
+	FlowApplications  = "applications"  // By protocol and well-known port, i.e. tcp/443.
+	FlowProtocols     = "protocols"     // By IP protocol, i.e. tcp.
+)
+
+// flowDimensions contains the dimensions in the order they are reported.
+var flowDimensions = []string{FlowTalkers, FlowConversations, FlowApplications, FlowProtocols}
+
+// ipProtocols contains the names of the most common IP protocols.
+var ipProtocols = map[uint32]string{1: "icmp", 2: "igmp", 6: "tcp", 17: "udp", 47: "gre", 50: "esp", 51: "ah", 58: "ipv6-icmp", 89: "ospf", 132: "sctp"}
+
+var (
+	flowTopBytesDesc   = prometheus.NewDesc("onms_ipc_flow_top_bytes", "The bytes of the top talkers, conversations, applications and protocols within the rolling window", []string{"window", "dimension", "key"}, nil)
+	flowTopPacketsDesc = prometheus.NewDesc("onms_ipc_flow_top_packets", "The packets of the top talkers, conversations, applications and protocols within the rolling window", []string{"window", "dimension", "key"}, nil)
+)
+
+// FlowStat represents the traffic of a given key within a rolling window.
+type FlowStat struct {
+	Key     string `json:"key"`
+	Bytes   uint64 `json:"bytes"`
+	Packets uint64 `json:"packets"`
+	Flows   uint64 `json:"flows"`
+}
+
+// FlowReport contains the top keys of each dimension within a rolling window, sorted by bytes.
+type FlowReport struct {
+	Window        string     `json:"window"`
+	Talkers       []FlowStat `json:"talkers"`
+	Conversations []FlowStat `json:"conversations"`
+	Applications  []FlowStat `json:"applications"`
+	Protocols     []FlowStat `json:"protocols"`
+}
+
+// flowCounter tracks the traffic of a key within a slot.
+type flowCounter struct {
+	bytes   uint64
+	packets uint64
+	flows   uint64
+}
+
+// flowBucket contains the counters of each dimension for a slot.
+type flowBucket struct {
+	slot   int64
+	counts map[string]map[string]*flowCounter
+}
+
+// flowWindow tracks the rolling counts of a window.
+type flowWindow struct {
+	size    time.Duration
+	buckets [flowStatsBuckets]flowBucket
+}
+
+// FlowStats aggregates the Netflow/IPFIX flows in memory, to report the top talkers, conversations, applications and protocols
+// over rolling windows, without an external analytics stack. The bytes and packets are scaled by the sampling interval of the flows.
+// It is used as an output, and it is a Prometheus collector that exposes the top keys of each window.
+// To cap the memory, only the first MaxKeys keys of each dimension are tracked individually on each slot, and the rest as "other".
+// This is a concurrent safe object.
+type FlowStats struct {
+	Windows []time.Duration // The sizes of the rolling windows.
+	TopN    int             // The number of keys reported by dimension, unless a limit is provided.
+	MaxKeys int             // The maximum number of keys tracked individually by dimension on each slot.
+
+	mutex   sync.Mutex
+	windows []*flowWindow
+}
+
+// NewFlowStats creates a flow statistics tracker for the given windows, using the default settings for the rest.
+func NewFlowStats(windows ...time.Duration) (*FlowStats, error) {
+	if len(windows) == 0 {
+		return nil, fmt.Errorf("at least one window is required")
+	}
+	s := &FlowStats{Windows: windows, TopN: DefaultFlowStatsTopN, MaxKeys: DefaultFlowStatsMaxKeys}
+	for _, size := range windows {
+		if size < time.Minute {
+			return nil, fmt.Errorf("invalid window %s; the minimum is 1m", size)
+		}
+		s.windows = append(s.windows, &flowWindow{size: size})
+	}
+	return s, nil
+}
+
+// Name Returns the name of the output.
+func (s *FlowStats) Name() string {
+	return "flow-stats"
+}
+
+// Send Aggregates a Netflow/IPFIX flow; messages from other parsers are ignored.
+func (s *FlowStats) Send(ctx context.Context, msg DecodedMessage) error {
+	if !isNetflow(msg.Parser) {
+		return nil
+	}
+	flow := &netflow.FlowMessage{}
+	if err := json.Unmarshal(msg.Payload, flow); err != nil {
+		return fmt.Errorf("invalid flow message: %v", err)
+	}
+	s.Record(flow, time.Now())
+	return nil
+}
+
+// Record Aggregates a flow at a given time.
+func (s *FlowStats) Record(flow *netflow.FlowMessage, now time.Time) {
+	counter := flowCounter{flows: 1}
+	if flow.NumBytes != nil {
+		counter.bytes = flow.NumBytes.Value
+	}
+	if flow.NumPackets != nil {
+		counter.packets = flow.NumPackets.Value
+	}
+	if flow.SamplingInterval != nil && flow.SamplingInterval.Value > 1 {
+		counter.bytes = uint64(float64(counter.bytes) * flow.SamplingInterval.Value)
+		counter.packets = uint64(float64(counter.packets) * flow.SamplingInterval.Value)
+	}
+	keys := flowKeys(flow)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, w := range s.windows {
+		slot := now.UnixNano() / int64(w.size/flowStatsBuckets)
+		bucket := &w.buckets[slot%flowStatsBuckets]
+		if bucket.slot > slot { // Older than the window
+			continue
+		}
+		if bucket.slot != slot || bucket.counts == nil {
+			*bucket = flowBucket{slot: slot, counts: make(map[string]map[string]*flowCounter)}
+		}
+		for dimension, values := range keys {
+			counts := bucket.counts[dimension]
+			if counts == nil {
+				counts = make(map[string]*flowCounter)
+				bucket.counts[dimension] = counts
+			}
+			for _, key := range values {
+				c, ok := counts[key]
+				if !ok {
+					if s.MaxKeys > 0 && len(counts) >= s.MaxKeys {
+						key = otherLabel
+						c = counts[key]
+					}
+					if c == nil {
+						c = &flowCounter{}
+						counts[key] = c
+					}
+				}
+				c.bytes += counter.bytes
+				c.packets += counter.packets
+				c.flows += counter.flows
+			}
+		}
+	}
+}
+
+// flowKeys Returns the keys of a flow for each dimension.
+func flowKeys(flow *netflow.FlowMessage) map[string][]string {
+	keys := make(map[string][]string)
+	src, dst := flow.SrcAddress, flow.DstAddress
+	if src != "" {
+		keys[FlowTalkers] = append(keys[FlowTalkers], src)
+	}
+	if dst != "" && dst != src {
+		keys[FlowTalkers] = append(keys[FlowTalkers], dst)
+	}
+	if src != "" && dst != "" {
+		if dst < src {
+			src, dst = dst, src
+		}
+		keys[FlowConversations] = []string{src + " <-> " + dst}
+	}
+	if flow.Protocol != nil {
+		protocol, ok := ipProtocols[flow.Protocol.Value]
+		if !ok {
+			protocol = strconv.Itoa(int(flow.Protocol.Value))
+		}
+		keys[FlowProtocols] = []string{protocol}
+		if flow.SrcPort != nil && flow.DstPort != nil && (flow.SrcPort.Value > 0 || flow.DstPort.Value > 0) {
+			port := flow.DstPort.Value // The lower port is assumed to be the service, as the client port is usually ephemeral.
+			if port == 0 || (flow.SrcPort.Value > 0 && flow.SrcPort.Value < port) {
+				port = flow.SrcPort.Value
+			}
+			keys[FlowApplications] = []string{protocol + "/" + strconv.Itoa(int(port))}
+		}
+	}
+	return keys
+}
+
+// Report Returns the top keys of each dimension within a rolling window, sorted by bytes; uses TopN when the limit is zero, and returns all the keys when it is negative.
+func (s *FlowStats) Report(window time.Duration, limit int) (*FlowReport, error) {
+	var w *flowWindow
+	for _, fw := range s.windows {
+		if fw.size == window {
+			w = fw
+		}
+	}
+	if w == nil {
+		return nil, fmt.Errorf("unknown window %s", window)
+	}
+	if limit == 0 {
+		limit = s.TopN
+	}
+	current := time.Now().UnixNano() / int64(w.size/flowStatsBuckets)
+	totals := make(map[string]map[string]*flowCounter)
+	s.mutex.Lock()
+	for _, bucket := range w.buckets {
+		if bucket.slot <= current-flowStatsBuckets || bucket.slot > current {
+			continue
+		}
+		for dimension, counts := range bucket.counts {
+			if totals[dimension] == nil {
+				totals[dimension] = make(map[string]*flowCounter)
+			}
+			for key, c := range counts {
+				total := totals[dimension][key]
+				if total == nil {
+					total = &flowCounter{}
+					totals[dimension][key] = total
+				}
+				total.bytes += c.bytes
+				total.packets += c.packets
+				total.flows += c.flows
+			}
+		}
+	}
+	s.mutex.Unlock()
+	top := func(dimension string) []FlowStat {
+		stats := make([]FlowStat, 0, len(totals[dimension]))
+		for key, c := range totals[dimension] {
+			stats = append(stats, FlowStat{Key: key, Bytes: c.bytes, Packets: c.packets, Flows: c.flows})
+		}
+		sort.Slice(stats, func(i, j int) bool {
+			if stats[i].Bytes == stats[j].Bytes {
+				return stats[i].Key < stats[j].Key
+			}
+			return stats[i].Bytes > stats[j].Bytes
+		})
+		if limit > 0 && len(stats) > limit {
+			stats = stats[:limit]
+		}
+		return stats
+	}
+	return &FlowReport{
+		Window:        window.String(),
+		Talkers:       top(FlowTalkers),
+		Conversations: top(FlowConversations),
+		Applications:  top(FlowApplications),
+		Protocols:     top(FlowProtocols),
+	}, nil
+}
+
+// Handler Returns an HTTP handler that exposes the flow statistics in JSON.
+// Accepts optional window (defaults to the first one) and limit (defaults to TopN) query parameters.
+func (s *FlowStats) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		window := s.Windows[0]
+		if value := r.URL.Query().Get("window"); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid window %s: %v", value, err), http.StatusBadRequest)
+				return
+			}
+			window = d
+		}
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		report, err := s.Report(window, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	})
+}
+
+// Describe Sends the descriptors of the metrics of the top keys.
+func (s *FlowStats) Describe(ch chan<- *prometheus.Desc) {
+	ch <- flowTopBytesDesc
+	ch <- flowTopPacketsDesc
+}
+
+// Collect Sends the bytes and packets of the top keys of each dimension and window, which are computed on every scrape.
+func (s *FlowStats) Collect(ch chan<- prometheus.Metric) {
+	for _, window := range s.Windows {
+		report, err := s.Report(window, 0)
+		if err != nil {
+			continue
+		}
+		for i, stats := range [][]FlowStat{report.Talkers, report.Conversations, report.Applications, report.Protocols} {
+			for _, stat := range stats {
+				ch <- prometheus.MustNewConstMetric(flowTopBytesDesc, prometheus.GaugeValue, float64(stat.Bytes), report.Window, flowDimensions[i], stat.Key)
+				ch <- prometheus.MustNewConstMetric(flowTopPacketsDesc, prometheus.GaugeValue, float64(stat.Packets), report.Window, flowDimensions[i], stat.Key)
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/netflow"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"gotest.tools/v3/assert"
+)
+
+func TestFlowStats(t *testing.T) {
+	stats, err := NewFlowStats(time.Minute, time.Hour)
+	assert.NilError(t, err)
+	newFlow := func(src, dst string, protocol, srcPort, dstPort uint32, bytes uint64) *netflow.FlowMessage {
+		return &netflow.FlowMessage{
+			SrcAddress: src,
+			DstAddress: dst,
+			Protocol:   wrapperspb.UInt32(protocol),
+			SrcPort:    wrapperspb.UInt32(srcPort),
+			DstPort:    wrapperspb.UInt32(dstPort),
+			NumBytes:   wrapperspb.UInt64(bytes),
+			NumPackets: wrapperspb.UInt64(1),
+		}
+	}
+	now := time.Now()
+	stats.Record(newFlow("10.0.0.1", "8.8.8.8", 17, 50000, 53, 100), now)
+	stats.Record(newFlow("8.8.8.8", "10.0.0.1", 17, 53, 50000, 200), now)
+	stats.Record(newFlow("10.0.0.2", "10.0.0.3", 6, 443, 61000, 1000), now)
+	sampled := newFlow("10.0.0.2", "10.0.0.2", 1, 0, 0, 10)
+	sampled.SamplingInterval = wrapperspb.Double(10)
+	stats.Record(sampled, now)
+	stats.Record(newFlow("10.0.0.4", "10.0.0.5", 6, 1024, 22, 5000), now.Add(-2*time.Minute)) // Outside of the shortest window
+
+	report, err := stats.Report(time.Minute, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, "1m0s", report.Window)
+	assert.DeepEqual(t, []FlowStat{
+		{Key: "10.0.0.2", Bytes: 1100, Packets: 11, Flows: 2},
+		{Key: "10.0.0.3", Bytes: 1000, Packets: 1, Flows: 1},
+		{Key: "10.0.0.1", Bytes: 300, Packets: 2, Flows: 2},
+		{Key: "8.8.8.8", Bytes: 300, Packets: 2, Flows: 2},
+	}, report.Talkers)
+	assert.DeepEqual(t, []FlowStat{
+		{Key: "10.0.0.2 <-> 10.0.0.3", Bytes: 1000, Packets: 1, Flows: 1},
+		{Key: "10.0.0.1 <-> 8.8.8.8", Bytes: 300, Packets: 2, Flows: 2},
+		{Key: "10.0.0.2 <-> 10.0.0.2", Bytes: 100, Packets: 10, Flows: 1},
+	}, report.Conversations)
+	assert.DeepEqual(t, []FlowStat{
+		{Key: "tcp/443", Bytes: 1000, Packets: 1, Flows: 1},
+		{Key: "udp/53", Bytes: 300, Packets: 2, Flows: 2},
+	}, report.Applications)
+	assert.DeepEqual(t, []FlowStat{
+		{Key: "tcp", Bytes: 1000, Packets: 1, Flows: 1},
+		{Key: "udp", Bytes: 300, Packets: 2, Flows: 2},
+		{Key: "icmp", Bytes: 100, Packets: 10, Flows: 1},
+	}, report.Protocols)
+
+	report, err = stats.Report(time.Hour, 1)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []FlowStat{{Key: "tcp/22", Bytes: 5000, Packets: 1, Flows: 1}}, report.Applications)
+	_, err = stats.Report(time.Second, 0)
+	assert.ErrorContains(t, err, "unknown window 1s")
+
+	// Through the messages, capping the keys
+	stats, err = NewFlowStats(time.Minute)
+	assert.NilError(t, err)
+	stats.MaxKeys = 1
+	payload, _ := json.Marshal(newFlow("10.0.0.1", "10.0.0.2", 6, 1024, 80, 10))
+	assert.NilError(t, stats.Send(nil, DecodedMessage{Parser: "netflow", Payload: payload}))
+	assert.NilError(t, stats.Send(nil, DecodedMessage{Parser: "syslog", Payload: []byte(`not json`)}))
+	assert.ErrorContains(t, stats.Send(nil, DecodedMessage{Parser: "ipfix", Payload: []byte(`not json`)}), "invalid flow message")
+	report, err = stats.Report(time.Minute, -1)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []FlowStat{{Key: "10.0.0.1", Bytes: 10, Packets: 1, Flows: 1}, {Key: otherLabel, Bytes: 10, Packets: 1, Flows: 1}}, report.Talkers)
+
+	// Through the API and the metrics
+	server := httptest.NewServer(stats.Handler())
+	defer server.Close()
+	res, err := http.Get(server.URL + "?window=1m&limit=1")
+	assert.NilError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	report = &FlowReport{}
+	assert.NilError(t, json.NewDecoder(res.Body).Decode(report))
+	res.Body.Close()
+	assert.Equal(t, 1, len(report.Talkers))
+	res, err = http.Get(server.URL + "?window=5m")
+	assert.NilError(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res.Body.Close()
+
+	registry := prometheus.NewPedanticRegistry()
+	assert.NilError(t, registry.Register(stats))
+	expected := `
+# HELP onms_ipc_flow_top_bytes The bytes of the top talkers, conversations, applications and protocols within the rolling window
+# TYPE onms_ipc_flow_top_bytes gauge
+onms_ipc_flow_top_bytes{dimension="applications",key="tcp/80",window="1m0s"} 10
+onms_ipc_flow_top_bytes{dimension="conversations",key="10.0.0.1 <-> 10.0.0.2",window="1m0s"} 10
+onms_ipc_flow_top_bytes{dimension="protocols",key="tcp",window="1m0s"} 10
+onms_ipc_flow_top_bytes{dimension="talkers",key="10.0.0.1",window="1m0s"} 10
+onms_ipc_flow_top_bytes{dimension="talkers",key="other",window="1m0s"} 10
+`
+	assert.NilError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "onms_ipc_flow_top_bytes"))
+
+	_, err = NewFlowStats()
+	assert.ErrorContains(t, err, "at least one window is required")
+	_, err = NewFlowStats(time.Second)
+	assert.ErrorContains(t, err, "the minimum is 1m")
+}
@@ -0,0 +1,208 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Forward formats
+const (
+	ForwardPayload = "payload" // The decoded payload as is.
+	ForwardJSON    = "json"    // A JSON envelope with the Kafka coordinates, the metadata and the decoded payload.
+)
+
+// forwardedMessages tracks the delivery reports of the forwarded messages.
+var forwardedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "onms_ipc_forwarded_messages_total",
+	Help: "The total number of messages forwarded to another topic by destination and result (success or failure), based on the delivery reports",
+}, []string{"destination", "result"})
+
+// forwardEnvelope represents a forwarded message in JSON format.
+type forwardEnvelope struct {
+	Topic     string            `json:"topic"`
+	Partition int32             `json:"partition"`
+	Offset    int64             `json:"offset"`
+	Timestamp time.Time         `json:"timestamp"`
+	Received  time.Time         `json:"received"`
+	Key       []byte            `json:"key,omitempty"` // In base64
+	Headers   map[string]string `json:"headers,omitempty"`
+	Parser    string            `json:"parser"`
+	Metadata  Metadata          `json:"metadata"`
+	Payload   json.RawMessage   `json:"payload,omitempty"`
+	Content   []byte            `json:"content,omitempty"` // The payload in base64 when it is not valid JSON, for instance from RPC messages.
+}
+
+// ForwardOutput re-publishes the reassembled and decoded messages to another Kafka topic, as single records,
+// so consumers that cannot handle the multi-part envelope of the OpenNMS Sink API can process them.
+// The source address is used as the key, and the metadata and the source coordinates are added as headers.
+// Messages are produced asynchronously, and the delivery reports are tracked through the onms_ipc_forwarded_messages_total metric.
+type ForwardOutput struct {
+	Bootstrap  string               // The Kafka Server Bootstrap string.
+	Topic      string               // The name of the destination Kafka Topic.
+	Format     string               // The format of the forwarded messages: payload (default) or json.
+	Parameters Properties           // Additional Kafka producer settings, i.e. acks=all or compression.type=lz4.
+	TLS        TLSConfig            // TLS settings to connect to Kafka (optional).
+	SASL       SASLConfig           // SASL settings to authenticate against Kafka (optional).
+	Producer   sarama.AsyncProducer `json:"-"` // The Kafka producer (optional; created by Validate when not provided); must return successes and errors.
+
+	wg sync.WaitGroup
+}
+
+// Validate Verifies the forward output settings, connects to Kafka, and starts processing the delivery reports.
+func (out *ForwardOutput) Validate() error {
+	if out.Topic == "" {
+		return fmt.Errorf("the destination topic is required")
+	}
+	switch out.Format {
+	case "":
+		out.Format = ForwardPayload
+	case ForwardPayload, ForwardJSON:
+	default:
+		return fmt.Errorf("invalid format %s; expecting %s or %s", out.Format, ForwardPayload, ForwardJSON)
+	}
+	if out.Producer == nil {
+		config := sarama.NewConfig()
+		config.Version = sarama.V2_7_0_0
+		config.ClientID = "onms-kafka-ipc-receiver"
+		config.Producer.Return.Successes = true
+		config.Producer.Return.Errors = true
+		if err := out.Parameters.apply(config); err != nil {
+			return err
+		}
+		if err := out.TLS.apply(config); err != nil {
+			return err
+		}
+		if err := out.SASL.apply(config); err != nil {
+			return err
+		}
+		producer, err := sarama.NewAsyncProducer([]string{out.Bootstrap}, config)
+		if err != nil {
+			return fmt.Errorf("cannot create producer for %s: %v", out.Bootstrap, err)
+		}
+		out.Producer = producer
+	}
+	out.wg.Add(2)
+	go out.handleSuccesses()
+	go out.handleErrors()
+	return nil
+}
+
+// Name Returns the name of the output.
+func (out *ForwardOutput) Name() string {
+	return "forward:" + out.Topic
+}
+
+// Send Queues a decoded message to be published to the destination topic.
+// The result of the delivery is reported asynchronously, so only the failures to queue the message are returned.
+func (out *ForwardOutput) Send(ctx context.Context, msg DecodedMessage) error {
+	value, err := out.value(msg)
+	if err != nil {
+		return err
+	}
+	record := &sarama.ProducerMessage{
+		Topic:    out.Topic,
+		Value:    sarama.ByteEncoder(value),
+		Headers:  forwardHeaders(msg),
+		Metadata: msg.Coordinates(),
+	}
+	if msg.Metadata.SourceAddress != "" {
+		record.Key = sarama.StringEncoder(msg.Metadata.SourceAddress)
+	}
+	select {
+	case out.Producer.Input() <- record:
+		return nil
+	case <-ctx.Done():
+		return &OutputError{Err: fmt.Errorf("cannot queue message: %v", ctx.Err()), Retryable: true}
+	}
+}
+
+// Close Flushes the pending messages and closes the producer, once all the delivery reports were processed.
+func (out *ForwardOutput) Close() error {
+	if out.Producer == nil {
+		return nil
+	}
+	out.Producer.AsyncClose()
+	out.wg.Wait()
+	out.Producer = nil
+	return nil
+}
+
+// value Returns the content of the forwarded message based on the format.
+func (out *ForwardOutput) value(msg DecodedMessage) ([]byte, error) {
+	if out.Format != ForwardJSON {
+		return msg.Payload, nil
+	}
+	value, err := json.Marshal(newForwardEnvelope(msg))
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode message: %v", err)
+	}
+	return value, nil
+}
+
+// newForwardEnvelope Returns the JSON envelope of a decoded message.
+func newForwardEnvelope(msg DecodedMessage) forwardEnvelope {
+	envelope := forwardEnvelope{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Timestamp: msg.Timestamp,
+		Received:  msg.Received,
+		Key:       msg.Key,
+		Headers:   msg.Headers,
+		Parser:    msg.Parser,
+		Metadata:  msg.Metadata,
+	}
+	if json.Valid(msg.Payload) {
+		envelope.Payload = msg.Payload
+	} else {
+		envelope.Content = msg.Payload
+	}
+	return envelope
+}
+
+// forwardHeaders Returns the Kafka headers of a forwarded message.
+func forwardHeaders(msg DecodedMessage) []sarama.RecordHeader {
+	headers := []sarama.RecordHeader{
+		{Key: []byte("source-topic"), Value: []byte(msg.Topic)},
+		{Key: []byte("source-partition"), Value: []byte(strconv.Itoa(int(msg.Partition)))},
+		{Key: []byte("source-offset"), Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		{Key: []byte("parser"), Value: []byte(msg.Parser)},
+	}
+	for _, header := range [][2]string{
+		{"location", msg.Metadata.Location},
+		{"system-id", msg.Metadata.SystemID},
+		{"source-address", msg.Metadata.SourceAddress},
+	} {
+		if header[1] != "" {
+			headers = append(headers, sarama.RecordHeader{Key: []byte(header[0]), Value: []byte(header[1])})
+		}
+	}
+	return headers
+}
+
+// handleSuccesses Processes the successful delivery reports, until the producer is closed.
+func (out *ForwardOutput) handleSuccesses() {
+	defer out.wg.Done()
+	for range out.Producer.Successes() {
+		forwardedMessages.WithLabelValues(out.Topic, OutputSuccess).Inc()
+	}
+}
+
+// handleErrors Processes the failed delivery reports, until the producer is closed.
+func (out *ForwardOutput) handleErrors() {
+	defer out.wg.Done()
+	for err := range out.Producer.Errors() {
+		forwardedMessages.WithLabelValues(out.Topic, "failure").Inc()
+		defaultLogger.Errorf("cannot forward message %v to %s: %v", err.Msg.Metadata, out.Topic, err.Err)
+	}
+}
@@ -0,0 +1,72 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama/mocks"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gotest.tools/v3/assert"
+)
+
+func TestForwardOutput(t *testing.T) {
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	producer := mocks.NewAsyncProducer(t, config)
+	out := &ForwardOutput{Topic: "syslog-json", Format: ForwardJSON, Producer: producer}
+	assert.NilError(t, out.Validate())
+	assert.Equal(t, "forward:syslog-json", out.Name())
+
+	msg := DecodedMessage{
+		Topic:     "OpenNMS.Sink.Syslog",
+		Partition: 2,
+		Offset:    10,
+		Timestamp: time.Now(),
+		Parser:    "syslog",
+		Metadata:  Metadata{Location: "Apex", SourceAddress: "10.0.0.1"},
+		Payload:   []byte(`{"messages":[]}`),
+	}
+	producer.ExpectInputWithCheckerFunctionAndSucceed(func(value []byte) error {
+		envelope := forwardEnvelope{}
+		assert.NilError(t, json.Unmarshal(value, &envelope))
+		assert.Equal(t, "OpenNMS.Sink.Syslog", envelope.Topic)
+		assert.Equal(t, int64(10), envelope.Offset)
+		assert.Equal(t, "Apex", envelope.Metadata.Location)
+		assert.Equal(t, `{"messages":[]}`, string(envelope.Payload))
+		return nil
+	})
+	producer.ExpectInputAndFail(fmt.Errorf("broker unavailable"))
+	assert.NilError(t, out.Send(context.Background(), msg))
+	assert.NilError(t, out.Send(context.Background(), msg))
+	assert.NilError(t, out.Close())
+	assert.Equal(t, float64(1), testutil.ToFloat64(forwardedMessages.WithLabelValues("syslog-json", OutputSuccess)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(forwardedMessages.WithLabelValues("syslog-json", "failure")))
+}
+
+func TestForwardValue(t *testing.T) {
+	out := &ForwardOutput{Topic: "forward", Format: ForwardPayload}
+	msg := DecodedMessage{Parser: "heartbeat", Payload: []byte("<minion/>")}
+	value, err := out.value(msg)
+	assert.NilError(t, err)
+	assert.Equal(t, "<minion/>", string(value))
+
+	out.Format = ForwardJSON
+	value, err = out.value(msg)
+	assert.NilError(t, err)
+	envelope := forwardEnvelope{}
+	assert.NilError(t, json.Unmarshal(value, &envelope))
+	assert.Equal(t, "<minion/>", string(envelope.Content))
+	assert.Assert(t, envelope.Payload == nil)
+
+	headers := forwardHeaders(DecodedMessage{Topic: "Test", Partition: 1, Offset: 2, Parser: "syslog", Metadata: Metadata{Location: "Apex"}})
+	assert.Equal(t, 5, len(headers))
+	assert.Equal(t, "location", string(headers[4].Key))
+
+	assert.ErrorContains(t, (&ForwardOutput{}).Validate(), "topic is required")
+	assert.ErrorContains(t, (&ForwardOutput{Topic: "forward", Format: "xml"}).Validate(), "invalid format")
+}
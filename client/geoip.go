@@ -0,0 +1,247 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Default GeoIP settings
+const (
+	DefaultGeoIPReloadInterval = time.Hour
+	maxGeoIPCache              = 100000 // The maximum number of addresses kept in memory; the cache is reset when it is full.
+)
+
+// geoIPLookups tracks the address lookups of the flows enrichment.
+var geoIPLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "onms_ipc_geoip_lookups_total",
+	Help: "The total number of address lookups of the flows enrichment by result (hit, miss or cached)",
+}, []string{"result"})
+
+// GeoIPRecord contains the location and the autonomous system of an IP address.
+type GeoIPRecord struct {
+	CountryCode    string  `json:"country_code,omitempty"`
+	Country        string  `json:"country,omitempty"`
+	City           string  `json:"city,omitempty"`
+	Latitude       float64 `json:"latitude,omitempty"`
+	Longitude      float64 `json:"longitude,omitempty"`
+	ASN            uint64  `json:"asn,omitempty"`
+	ASOrganization string  `json:"as_organization,omitempty"`
+}
+
+// geoIPDatabase is a MaxMind database that is reloaded when its file changes.
+type geoIPDatabase struct {
+	path     string
+	modTime  time.Time
+	reader   *mmdbReader
+	disabled bool
+}
+
+// GeoIP resolves the location and the autonomous system of the IP addresses through MaxMind GeoIP2 or GeoLite2 databases
+// (City or Country, and ASN), caching the results in memory. The databases are checked periodically, and reloaded when their files change,
+// i.e. after an update by geoipupdate.
+// This is a concurrent safe object.
+type GeoIP struct {
+	mutex sync.RWMutex
+	city  *geoIPDatabase
+	asn   *geoIPDatabase
+	cache map[string]*GeoIPRecord
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewGeoIP Opens the City (or Country) and ASN databases, either of which can be empty, checking for updates on every reload interval (0 to disable).
+func NewGeoIP(cityDB, asnDB string, reloadInterval time.Duration) (*GeoIP, error) {
+	if cityDB == "" && asnDB == "" {
+		return nil, fmt.Errorf("at least one GeoIP database is required")
+	}
+	g := &GeoIP{
+		city:  &geoIPDatabase{path: cityDB, disabled: cityDB == ""},
+		asn:   &geoIPDatabase{path: asnDB, disabled: asnDB == ""},
+		cache: make(map[string]*GeoIPRecord),
+	}
+	for _, db := range []*geoIPDatabase{g.city, g.asn} {
+		if db.disabled {
+			continue
+		}
+		if _, err := g.load(db); err != nil {
+			return nil, err
+		}
+	}
+	if reloadInterval > 0 {
+		g.stop = make(chan struct{})
+		g.wg.Add(1)
+		go g.watch(reloadInterval)
+	}
+	return g, nil
+}
+
+// Close Stops checking the databases for updates.
+func (g *GeoIP) Close() {
+	if g.stop != nil {
+		close(g.stop)
+		g.wg.Wait()
+		g.stop = nil
+	}
+}
+
+// load Opens a database when its file changed, returning true when it was reloaded.
+func (g *GeoIP) load(db *geoIPDatabase) (bool, error) {
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return false, fmt.Errorf("cannot open GeoIP database: %v", err)
+	}
+	if info.ModTime().Equal(db.modTime) {
+		return false, nil
+	}
+	reader, err := openMMDB(db.path)
+	if err != nil {
+		return false, fmt.Errorf("cannot open GeoIP database: %v", err)
+	}
+	g.mutex.Lock()
+	db.reader = reader
+	db.modTime = info.ModTime()
+	g.cache = make(map[string]*GeoIPRecord)
+	g.mutex.Unlock()
+	return true, nil
+}
+
+// watch Reloads the databases when their files change, until the GeoIP is closed.
+func (g *GeoIP) watch(interval time.Duration) {
+	defer g.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, db := range []*geoIPDatabase{g.city, g.asn} {
+				if db.disabled {
+					continue
+				}
+				if reloaded, err := g.load(db); err != nil {
+					defaultLogger.Warnf("cannot reload GeoIP database, keeping the current one: %v", err)
+				} else if reloaded {
+					defaultLogger.Infof("reloaded GeoIP database %s (%s)", db.path, db.reader.DatabaseType)
+				}
+			}
+		case <-g.stop:
+			return
+		}
+	}
+}
+
+// Lookup Returns the location and the autonomous system of an IP address, or nil when it is unknown or invalid.
+func (g *GeoIP) Lookup(address string) *GeoIPRecord {
+	g.mutex.RLock()
+	record, ok := g.cache[address]
+	city, asn := g.city.reader, g.asn.reader
+	g.mutex.RUnlock()
+	if ok {
+		geoIPLookups.WithLabelValues("cached").Inc()
+		return record
+	}
+	if ip := net.ParseIP(address); ip != nil {
+		record = lookupGeoIP(city, asn, ip)
+	}
+	if record != nil {
+		geoIPLookups.WithLabelValues("hit").Inc()
+	} else {
+		geoIPLookups.WithLabelValues("miss").Inc()
+	}
+	g.mutex.Lock()
+	if len(g.cache) >= maxGeoIPCache {
+		g.cache = make(map[string]*GeoIPRecord)
+	}
+	g.cache[address] = record
+	g.mutex.Unlock()
+	return record
+}
+
+// lookupGeoIP Builds the record of an IP address from the databases.
+func lookupGeoIP(city, asn *mmdbReader, ip net.IP) *GeoIPRecord {
+	record := &GeoIPRecord{}
+	found := false
+	if city != nil {
+		if value, err := city.lookup(ip); err != nil {
+			defaultLogger.Warnf("cannot lookup %s on the GeoIP database: %v", ip, err)
+		} else if m, ok := value.(map[string]interface{}); ok {
+			found = true
+			record.CountryCode, _ = mmdbPath(m, "country", "iso_code").(string)
+			record.Country, _ = mmdbPath(m, "country", "names", "en").(string)
+			record.City, _ = mmdbPath(m, "city", "names", "en").(string)
+			record.Latitude, _ = mmdbPath(m, "location", "latitude").(float64)
+			record.Longitude, _ = mmdbPath(m, "location", "longitude").(float64)
+		}
+	}
+	if asn != nil {
+		if value, err := asn.lookup(ip); err != nil {
+			defaultLogger.Warnf("cannot lookup %s on the ASN database: %v", ip, err)
+		} else if m, ok := value.(map[string]interface{}); ok {
+			found = true
+			record.ASN, _ = m["autonomous_system_number"].(uint64)
+			record.ASOrganization, _ = m["autonomous_system_organization"].(string)
+		}
+	}
+	if !found {
+		return nil
+	}
+	return record
+}
+
+// mmdbPath Returns a nested value of a record, or nil when it doesn't exist.
+func mmdbPath(m map[string]interface{}, keys ...string) interface{} {
+	var value interface{} = m
+	for _, key := range keys {
+		node, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = node[key]
+	}
+	return value
+}
+
+// EnrichFlows Returns a middleware that adds the location and the autonomous system of the source and destination addresses
+// to the Netflow/IPFIX flows, as src_geo and dst_geo, like the flow enrichment of OpenNMS; the src_as and dst_as are also set
+// from the ASN database when the exporter didn't provide them.
+// The payload is handled as generic JSON, so the fields are sorted by name.
+func EnrichFlows(g *GeoIP) Middleware {
+	return func(ctx *MessageContext) error {
+		if !isNetflow(ctx.Message.Parser) {
+			return nil
+		}
+		var flow map[string]json.RawMessage
+		if err := ctx.Decode(&flow); err != nil {
+			return err
+		}
+		enriched := false
+		for _, side := range []string{"src", "dst"} {
+			var address string
+			if err := json.Unmarshal(flow[side+"_address"], &address); err != nil || address == "" {
+				continue
+			}
+			record := g.Lookup(address)
+			if record == nil {
+				continue
+			}
+			flow[side+"_geo"], _ = json.Marshal(record)
+			if _, ok := flow[side+"_as"]; !ok && record.ASN > 0 {
+				flow[side+"_as"], _ = json.Marshal(map[string]uint64{"value": record.ASN})
+			}
+			enriched = true
+		}
+		if !enriched {
+			return nil
+		}
+		return ctx.Encode(flow)
+	}
+}
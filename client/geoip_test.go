@@ -0,0 +1,225 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// mmdbEncode Encodes a value of the data section of a MaxMind DB file.
+func mmdbEncode(value interface{}) []byte {
+	header := func(kind, size int) []byte {
+		var h []byte
+		ctrl := byte(kind << 5)
+		if kind > 7 {
+			ctrl = 0
+		}
+		if size < 29 {
+			h = []byte{ctrl | byte(size)}
+		} else {
+			h = []byte{ctrl | 29}
+		}
+		if kind > 7 {
+			h = append(h, byte(kind-7))
+		}
+		if size >= 29 {
+			h = append(h, byte(size-29))
+		}
+		return h
+	}
+	uint := func(kind int, v uint64) []byte {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, v)
+		for len(b) > 0 && b[0] == 0 {
+			b = b[1:]
+		}
+		return append(header(kind, len(b)), b...)
+	}
+	switch v := value.(type) {
+	case string:
+		return append(header(mmdbString, len(v)), v...)
+	case float64:
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, math.Float64bits(v))
+		return append(header(mmdbDouble, 8), b...)
+	case uint16:
+		return uint(mmdbUint16, uint64(v))
+	case uint32:
+		return uint(mmdbUint32, uint64(v))
+	case uint64:
+		return uint(mmdbUint64, v)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b := header(mmdbMap, len(v))
+		for _, key := range keys {
+			b = append(b, mmdbEncode(key)...)
+			b = append(b, mmdbEncode(v[key])...)
+		}
+		return b
+	}
+	panic("unsupported type")
+}
+
+// buildMMDB Builds a MaxMind DB file with the records of the given networks.
+func buildMMDB(dbType string, ipVersion, recordSize int, networks map[string]map[string]interface{}) []byte {
+	const empty = -1
+	nodes := [][2]int{{empty, empty}}
+	var data []byte
+	var targets [][3]int // node, bit, data offset
+	cidrs := make([]string, 0, len(networks))
+	for cidr := range networks {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+	for _, cidr := range cidrs {
+		_, network, _ := net.ParseCIDR(cidr)
+		ones, bits := network.Mask.Size()
+		ip := network.IP
+		if ipVersion == 6 {
+			ip, ones = network.IP.To16(), ones+128-bits
+			if bits == 32 {
+				copy(ip, make([]byte, 12))
+			}
+		}
+		node := 0
+		for i := 0; i < ones; i++ {
+			bit := int(ip[i/8] >> (7 - uint(i%8)) & 1)
+			if i == ones-1 {
+				targets = append(targets, [3]int{node, bit, len(data)})
+				break
+			}
+			if nodes[node][bit] == empty {
+				nodes = append(nodes, [2]int{empty, empty})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+		data = append(data, mmdbEncode(networks[cidr])...)
+	}
+	count := len(nodes)
+	for i := range nodes {
+		for bit := range nodes[i] {
+			if nodes[i][bit] == empty {
+				nodes[i][bit] = count
+			}
+		}
+	}
+	for _, t := range targets {
+		nodes[t[0]][t[1]] = count + 16 + t[2]
+	}
+	var tree []byte
+	for _, n := range nodes {
+		switch recordSize {
+		case 24:
+			tree = append(tree, byte(n[0]>>16), byte(n[0]>>8), byte(n[0]), byte(n[1]>>16), byte(n[1]>>8), byte(n[1]))
+		case 28:
+			tree = append(tree, byte(n[0]>>16), byte(n[0]>>8), byte(n[0]), byte(n[0]>>20&0xf0|n[1]>>24&0x0f), byte(n[1]>>16), byte(n[1]>>8), byte(n[1]))
+		default:
+			tree = append(tree, make([]byte, 8)...)
+			binary.BigEndian.PutUint32(tree[len(tree)-8:], uint32(n[0]))
+			binary.BigEndian.PutUint32(tree[len(tree)-4:], uint32(n[1]))
+		}
+	}
+	content := append(tree, make([]byte, 16)...)
+	content = append(content, data...)
+	content = append(content, mmdbMetadataMarker...)
+	return append(content, mmdbEncode(map[string]interface{}{
+		"node_count":    uint32(count),
+		"record_size":   uint16(recordSize),
+		"ip_version":    uint16(ipVersion),
+		"database_type": dbType,
+		"build_epoch":   uint64(1614900600),
+	})...)
+}
+
+func TestMMDBReader(t *testing.T) {
+	networks := map[string]map[string]interface{}{
+		"8.8.8.0/24":    {"autonomous_system_number": uint32(15169), "autonomous_system_organization": "GOOGLE"},
+		"2001:db8::/32": {"autonomous_system_number": uint32(64496), "autonomous_system_organization": "DOC"},
+	}
+	for _, recordSize := range []int{24, 28, 32} {
+		r, err := parseMMDB(buildMMDB("GeoLite2-ASN", 6, recordSize, networks))
+		assert.NilError(t, err)
+		assert.Equal(t, "GeoLite2-ASN", r.DatabaseType)
+		assert.Equal(t, uint64(1614900600), r.BuildEpoch)
+		value, err := r.lookup(net.ParseIP("8.8.8.8"))
+		assert.NilError(t, err)
+		assert.DeepEqual(t, map[string]interface{}{"autonomous_system_number": uint64(15169), "autonomous_system_organization": "GOOGLE"}, value)
+		value, err = r.lookup(net.ParseIP("2001:db8::1"))
+		assert.NilError(t, err)
+		assert.Equal(t, "DOC", value.(map[string]interface{})["autonomous_system_organization"])
+		value, err = r.lookup(net.ParseIP("8.8.4.4"))
+		assert.NilError(t, err)
+		assert.Assert(t, value == nil)
+	}
+	_, err := parseMMDB([]byte("not a database"))
+	assert.ErrorContains(t, err, "metadata not found")
+}
+
+func TestEnrichFlows(t *testing.T) {
+	dir := t.TempDir()
+	cityDB := filepath.Join(dir, "GeoLite2-City.mmdb")
+	asnDB := filepath.Join(dir, "GeoLite2-ASN.mmdb")
+	assert.NilError(t, ioutil.WriteFile(cityDB, buildMMDB("GeoLite2-City", 4, 24, map[string]map[string]interface{}{
+		"8.8.8.0/24": {
+			"country":  map[string]interface{}{"iso_code": "US", "names": map[string]interface{}{"en": "United States"}},
+			"city":     map[string]interface{}{"names": map[string]interface{}{"en": "Mountain View"}},
+			"location": map[string]interface{}{"latitude": 37.386, "longitude": -122.0838},
+		},
+	}), 0644))
+	assert.NilError(t, ioutil.WriteFile(asnDB, buildMMDB("GeoLite2-ASN", 4, 24, map[string]map[string]interface{}{
+		"8.8.8.0/24": {"autonomous_system_number": uint32(15169), "autonomous_system_organization": "GOOGLE"},
+	}), 0644))
+
+	geo, err := NewGeoIP(cityDB, asnDB, 0)
+	assert.NilError(t, err)
+	defer geo.Close()
+	expected := &GeoIPRecord{CountryCode: "US", Country: "United States", City: "Mountain View", Latitude: 37.386, Longitude: -122.0838, ASN: 15169, ASOrganization: "GOOGLE"}
+	assert.DeepEqual(t, expected, geo.Lookup("8.8.8.8"))
+	assert.DeepEqual(t, expected, geo.Lookup("8.8.8.8"))
+	assert.Assert(t, geo.Lookup("10.0.0.1") == nil)
+	assert.Assert(t, geo.Lookup("invalid") == nil)
+
+	mc := &MessageContext{Message: DecodedMessage{Parser: "netflow", Payload: []byte(`{"src_address":"10.0.0.1","dst_address":"8.8.8.8","dst_port":{"value":53}}`)}}
+	assert.NilError(t, EnrichFlows(geo)(mc))
+	flow := map[string]interface{}{}
+	assert.NilError(t, json.Unmarshal(mc.Message.Payload, &flow))
+	assert.Assert(t, flow["src_geo"] == nil)
+	assert.DeepEqual(t, map[string]interface{}{"value": float64(15169)}, flow["dst_as"])
+	assert.DeepEqual(t, map[string]interface{}{
+		"country_code": "US", "country": "United States", "city": "Mountain View", "latitude": 37.386, "longitude": -122.0838,
+		"asn": float64(15169), "as_organization": "GOOGLE",
+	}, flow["dst_geo"])
+	other := &MessageContext{Message: DecodedMessage{Parser: "syslog", Payload: []byte(`not json`)}}
+	assert.NilError(t, EnrichFlows(geo)(other))
+
+	// The databases are reloaded when they change, discarding the cached addresses
+	assert.NilError(t, ioutil.WriteFile(asnDB, buildMMDB("GeoLite2-ASN", 4, 24, map[string]map[string]interface{}{
+		"8.8.8.0/24": {"autonomous_system_number": uint32(15169), "autonomous_system_organization": "GOOGLE LLC"},
+	}), 0644))
+	assert.NilError(t, os.Chtimes(asnDB, time.Now(), time.Now().Add(time.Minute)))
+	reloaded, err := geo.load(geo.asn)
+	assert.NilError(t, err)
+	assert.Assert(t, reloaded)
+	assert.Equal(t, "GOOGLE LLC", geo.Lookup("8.8.8.8").ASOrganization)
+
+	_, err = NewGeoIP("", "", 0)
+	assert.ErrorContains(t, err, "at least one GeoIP database is required")
+	_, err = NewGeoIP(filepath.Join(dir, "missing.mmdb"), "", 0)
+	assert.ErrorContains(t, err, "cannot open GeoIP database")
+}
@@ -0,0 +1,165 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// grokPatterns contains the most common patterns of Logstash, adapted to RE2 (without lookarounds).
+var grokPatterns = map[string]string{
+	"USERNAME":          `[a-zA-Z0-9._-]+`,
+	"USER":              `%{USERNAME}`,
+	"INT":               `(?:[+-]?[0-9]+)`,
+	"BASE10NUM":         `(?:[+-]?(?:[0-9]+(?:\.[0-9]+)?|\.[0-9]+))`,
+	"NUMBER":            `%{BASE10NUM}`,
+	"BASE16NUM":         `(?:[+-]?(?:0x)?[0-9A-Fa-f]+)`,
+	"POSINT":            `\b[1-9][0-9]*\b`,
+	"NONNEGINT":         `\b[0-9]+\b`,
+	"WORD":              `\b\w+\b`,
+	"NOTSPACE":          `\S+`,
+	"SPACE":             `\s*`,
+	"DATA":              `.*?`,
+	"GREEDYDATA":        `.*`,
+	"QUOTEDSTRING":      `"(?:[^"\\]|\\.)*"`,
+	"UUID":              `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+	"MAC":               `(?:(?:[A-Fa-f0-9]{2}[:-]){5}[A-Fa-f0-9]{2}|(?:[A-Fa-f0-9]{4}\.){2}[A-Fa-f0-9]{4})`,
+	"IPV4":              `(?:(?:25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)\.){3}(?:25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)`,
+	"IPV6":              `(?:[0-9A-Fa-f]{0,4}:){2,7}(?:[0-9A-Fa-f]{1,4}|%{IPV4})?`,
+	"IP":                `(?:%{IPV6}|%{IPV4})`,
+	"HOSTNAME":          `\b[0-9A-Za-z][0-9A-Za-z-]{0,62}(?:\.[0-9A-Za-z][0-9A-Za-z-]{0,62})*\.?`,
+	"IPORHOST":          `(?:%{IP}|%{HOSTNAME})`,
+	"HOSTPORT":          `%{IPORHOST}:%{POSINT}`,
+	"MONTH":             `\b(?:[Jj]an(?:uary)?|[Ff]eb(?:ruary)?|[Mm]ar(?:ch)?|[Aa]pr(?:il)?|[Mm]ay|[Jj]un(?:e)?|[Jj]ul(?:y)?|[Aa]ug(?:ust)?|[Ss]ep(?:tember)?|[Oo]ct(?:ober)?|[Nn]ov(?:ember)?|[Dd]ec(?:ember)?)\b`,
+	"MONTHNUM":          `(?:0?[1-9]|1[0-2])`,
+	"MONTHDAY":          `(?:0[1-9]|[12][0-9]|3[01]|[1-9])`,
+	"DAY":               `(?:Mon(?:day)?|Tue(?:sday)?|Wed(?:nesday)?|Thu(?:rsday)?|Fri(?:day)?|Sat(?:urday)?|Sun(?:day)?)`,
+	"YEAR":              `(?:\d\d){1,2}`,
+	"HOUR":              `(?:2[0123]|[01]?[0-9])`,
+	"MINUTE":            `(?:[0-5][0-9])`,
+	"SECOND":            `(?:(?:[0-5]?[0-9]|60)(?:[:.,][0-9]+)?)`,
+	"TIME":              `%{HOUR}:%{MINUTE}(?::%{SECOND})?`,
+	"ISO8601_TIMEZONE":  `(?:Z|[+-]%{HOUR}(?::?%{MINUTE}))`,
+	"TIMESTAMP_ISO8601": `%{YEAR}-%{MONTHNUM}-%{MONTHDAY}[T ]%{HOUR}:?%{MINUTE}(?::?%{SECOND})?%{ISO8601_TIMEZONE}?`,
+	"SYSLOGTIMESTAMP":   `%{MONTH} +%{MONTHDAY} %{TIME}`,
+	"PROG":              `[\x21-\x5a\x5c\x5e-\x7e]+`,
+	"SYSLOGPROG":        `%{PROG:appName}(?:\[%{POSINT:procId}\])?`,
+	"SYSLOGHOST":        `%{IPORHOST}`,
+	"LOGLEVEL":          `(?i:alert|trace|debug|notice|info(?:rmation)?|warn(?:ing)?|err(?:or)?|crit(?:ical)?|fatal|severe|emerg(?:ency)?)`,
+}
+
+// grokReference matches the references to the patterns, as %{NAME} or %{NAME:field}.
+var grokReference = regexp.MustCompile(`%\{(\w+)(?::(\w+))?\}`)
+
+// maxGrokDepth limits the nesting of the patterns, to detect circular references.
+const maxGrokDepth = 10
+
+// expandGrok Replaces the references to the patterns with their regular expressions, as named groups for the ones with a field.
+func expandGrok(pattern string, depth int) (string, error) {
+	if depth > maxGrokDepth {
+		return "", fmt.Errorf("too many nested patterns")
+	}
+	var err error
+	expanded := grokReference.ReplaceAllStringFunc(pattern, func(ref string) string {
+		m := grokReference.FindStringSubmatch(ref)
+		definition, ok := grokPatterns[m[1]]
+		if !ok {
+			err = fmt.Errorf("unknown pattern %s", m[1])
+			return ref
+		}
+		inner, e := expandGrok(definition, depth+1)
+		if e != nil {
+			err = e
+			return ref
+		}
+		if m[2] != "" {
+			return "(?P<" + m[2] + ">" + inner + ")"
+		}
+		return "(?:" + inner + ")"
+	})
+	return expanded, err
+}
+
+// SyslogPatterns represents a list of Grok patterns or regular expressions, used to parse the Syslog messages whose headers
+// don't follow RFC 5424 or RFC 3164, i.e. from network devices. The fields are extracted through named groups, like %{HOSTNAME:hostname}
+// or (?P<hostname>\S+), where time, hostname, appName, procId, msgId and message populate the corresponding fields, and the rest are added as custom fields.
+// It can be used as a CLI flag, and can be repeated; the patterns are evaluated in order, and the first match wins.
+type SyslogPatterns []*regexp.Regexp
+
+// String gets a CSV with all the expanded patterns
+func (p *SyslogPatterns) String() string {
+	if p == nil {
+		return ""
+	}
+	items := make([]string, len(*p))
+	for i, re := range *p {
+		items[i] = re.String()
+	}
+	return strings.Join(items, ", ")
+}
+
+// Set parses a pattern and adds it to the list
+func (p *SyslogPatterns) Set(value string) error {
+	expanded, err := expandGrok(value, 0)
+	if err != nil {
+		return fmt.Errorf("invalid syslog pattern %s: %v", value, err)
+	}
+	re, err := regexp.Compile(expanded)
+	if err != nil {
+		return fmt.Errorf("invalid syslog pattern %s: %v", value, err)
+	}
+	*p = append(*p, re)
+	return nil
+}
+
+// syslogFallback contains the patterns used by ParseSyslog.
+var syslogFallback atomic.Value
+
+// SetSyslogPatterns Sets the patterns applied when the header of a Syslog message doesn't follow RFC 5424 or RFC 3164.
+func SetSyslogPatterns(patterns SyslogPatterns) {
+	syslogFallback.Store(patterns)
+}
+
+// parseFallback Applies the fallback patterns to the content of a message after its priority, returning true when one of them matches.
+func (fields *SyslogFields) parseFallback(content string) bool {
+	patterns, _ := syslogFallback.Load().(SyslogPatterns)
+	for _, re := range patterns {
+		m := re.FindStringSubmatch(content)
+		if m == nil {
+			continue
+		}
+		fields.Message = ""
+		for i, name := range re.SubexpNames() {
+			if name == "" || m[i] == "" {
+				continue
+			}
+			switch name {
+			case "time", "timestamp":
+				fields.Time = m[i]
+			case "hostname", "host":
+				fields.Hostname = m[i]
+			case "appName":
+				fields.AppName = m[i]
+			case "procId":
+				fields.ProcID = m[i]
+			case "msgId":
+				fields.MsgID = m[i]
+			case "message":
+				fields.Message = m[i]
+			default:
+				if fields.Fields == nil {
+					fields.Fields = make(map[string]string)
+				}
+				fields.Fields[name] = m[i]
+			}
+		}
+		if fields.Message == "" {
+			fields.Message = strings.TrimSpace(content)
+		}
+		return true
+	}
+	return false
+}
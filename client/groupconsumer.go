@@ -0,0 +1,191 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// Delays of the Kafka consumer, like the ones of the Watermill subscriber.
+const (
+	nackResendDelay = 100 * time.Millisecond // Before delivering again a record that was not acknowledged.
+	reconnectDelay  = time.Second            // Before joining again the consumer group after a failure.
+)
+
+// groupConsumer consumes the topics through a Kafka consumer group, delivering the records of each partition one at a time.
+// Unlike the Watermill subscriber, which commits the offset of each record once acknowledged, the committed offset of each
+// partition is held back to the first chunk of its oldest partial message, so the chunks of the pending messages are consumed
+// again after a crash, a restart or a rebalance.
+type groupConsumer struct {
+	cli     *KafkaClient
+	config  *sarama.Config
+	logger  watermill.LoggerAdapter
+	mutex   sync.Mutex
+	closing chan struct{}
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// newGroupConsumer creates a new consumer for the consumer group of a client.
+func newGroupConsumer(cli *KafkaClient, config *sarama.Config) *groupConsumer {
+	return &groupConsumer{
+		cli:     cli,
+		config:  config,
+		logger:  &consumerLogger{cli: cli},
+		closing: make(chan struct{}),
+	}
+}
+
+// Subscribe Joins the consumer group for a topic, delivering its records until the context is cancelled or the consumer is closed.
+func (c *groupConsumer) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return nil, fmt.Errorf("consumer is closed")
+	}
+	client, err := sarama.NewClient([]string{c.cli.Bootstrap}, c.config)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to %s: %v", c.cli.Bootstrap, err)
+	}
+	group, err := sarama.NewConsumerGroupFromClient(c.cli.GroupID, client)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("cannot create consumer group %s: %v", c.cli.GroupID, err)
+	}
+	fields := watermill.LogFields{"topic": topic, "consumer_group": c.cli.GroupID}
+	ctx, cancel := context.WithCancel(ctx)
+	out := make(chan *message.Message)
+	handler := &claimHandler{cli: c.cli, ctx: ctx, out: out, logger: c.logger.With(fields)}
+	c.wg.Add(2)
+	go func() {
+		defer c.wg.Done()
+		for err := range group.Errors() {
+			c.logger.Error("consumer group error", err, fields)
+		}
+	}()
+	go func() {
+		defer c.wg.Done()
+		defer close(out)
+		defer client.Close()
+		defer group.Close()
+		defer cancel()
+		go func() {
+			select {
+			case <-c.closing:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		for ctx.Err() == nil { // Consume returns on every rebalance
+			if err := group.Consume(ctx, []string{topic}, handler); err != nil && ctx.Err() == nil {
+				c.logger.Error("cannot consume from the consumer group", err, fields)
+				select {
+				case <-time.After(reconnectDelay):
+				case <-ctx.Done():
+				}
+			}
+		}
+	}()
+	c.logger.Info("subscribed to the consumer group", fields)
+	return out, nil
+}
+
+// Close Stops all the subscriptions, and waits until they leave the consumer group.
+func (c *groupConsumer) Close() error {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.closing)
+	c.mutex.Unlock()
+	c.wg.Wait()
+	return nil
+}
+
+// claimHandler delivers the records of the partitions claimed by a subscription.
+type claimHandler struct {
+	cli    *KafkaClient
+	ctx    context.Context
+	out    chan<- *message.Message
+	logger watermill.LoggerAdapter
+}
+
+// Setup Does nothing, as the claims are tracked by ConsumeClaim.
+func (h *claimHandler) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// Cleanup Does nothing, as the claims are tracked by ConsumeClaim.
+func (h *claimHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim Delivers the records of a claimed partition, waiting for each of them to be acknowledged before the next one.
+// The offset marked after each record is held back to the first chunk of the oldest partial message of the partition.
+func (h *claimHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	tp := TopicPartition{claim.Topic(), claim.Partition()}
+	if h.cli.rebalances != nil {
+		h.cli.partitionAssigned(tp, claim.InitialOffset())
+		defer h.cli.partitionRevoked(tp)
+	}
+	for {
+		select {
+		case record, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			if !h.deliver(record) {
+				return nil
+			}
+			sess.MarkOffset(record.Topic, record.Partition, h.cli.committableOffset(tp, record.Offset+1), "")
+		case <-h.ctx.Done():
+			return nil
+		}
+	}
+}
+
+// deliver Sends a record as a message, delivering it again when it is not acknowledged.
+// Returns false when the subscription stops before the message is acknowledged.
+func (h *claimHandler) deliver(record *sarama.ConsumerMessage) bool {
+	msg, err := (recordUnmarshaler{}).Unmarshal(record)
+	if err != nil {
+		h.logger.Error("cannot unmarshal record", err, watermill.LogFields{"kafka_partition": record.Partition, "kafka_offset": record.Offset})
+		return true
+	}
+	ctx := WithRecordMetadata(h.ctx, RecordMetadata{
+		Partition: record.Partition,
+		Offset:    record.Offset,
+		Timestamp: record.Timestamp,
+		Key:       record.Key,
+	})
+	for {
+		msg.SetContext(ctx)
+		select {
+		case h.out <- msg:
+		case <-h.ctx.Done():
+			return false
+		}
+		select {
+		case <-msg.Acked():
+			return true
+		case <-msg.Nacked():
+			msg = msg.Copy()
+			select {
+			case <-time.After(nackResendDelay):
+			case <-h.ctx.Done():
+				return false
+			}
+		case <-h.ctx.Done():
+			return false
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"gotest.tools/v3/assert"
+)
+
+type mockSession struct {
+	ctx    context.Context
+	mutex  sync.Mutex
+	marked []int64
+}
+
+func (s *mockSession) Claims() map[string][]int32 { return nil }
+func (s *mockSession) MemberID() string           { return "mock" }
+func (s *mockSession) GenerationID() int32        { return 1 }
+func (s *mockSession) Commit()                    {}
+func (s *mockSession) Context() context.Context   { return s.ctx }
+
+func (s *mockSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.marked = append(s.marked, offset)
+}
+
+func (s *mockSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {}
+
+func (s *mockSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, metadata)
+}
+
+type mockClaim struct {
+	topic    string
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *mockClaim) Topic() string                            { return c.topic }
+func (c *mockClaim) Partition() int32                         { return 0 }
+func (c *mockClaim) InitialOffset() int64                     { return 10 }
+func (c *mockClaim) HighWaterMarkOffset() int64               { return 13 }
+func (c *mockClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+func TestConsumeClaim(t *testing.T) {
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	var events []RebalanceEvent
+	cli.OnRebalance = func(event RebalanceEvent) {
+		events = append(events, event)
+	}
+	out := make(chan *message.Message)
+	handler := &claimHandler{cli: cli, ctx: context.Background(), out: out, logger: &consumerLogger{cli: cli}}
+	session := &mockSession{ctx: context.Background()}
+	claim := &mockClaim{topic: cli.Topic, messages: make(chan *sarama.ConsumerMessage, 3)}
+	for i, msg := range []*message.Message{
+		buildMessage("0001", 0, 2, []byte("ABC")),
+		buildMessage("0002", 0, 1, []byte("XYZ")),
+		buildMessage("0001", 1, 2, []byte("DEF")),
+	} {
+		claim.messages <- &sarama.ConsumerMessage{Topic: cli.Topic, Partition: 0, Offset: int64(10 + i), Value: msg.Payload}
+	}
+	close(claim.messages)
+
+	var payloads []string
+	go func() {
+		for msg := range out {
+			if data := cli.processMessage(msg); data != nil {
+				payloads = append(payloads, string(data))
+			}
+			msg.Ack()
+		}
+	}()
+	assert.NilError(t, handler.ConsumeClaim(session, claim))
+	close(out)
+
+	// The offset is held back to the first chunk of the partial message until it is completed
+	assert.DeepEqual(t, []int64{10, 10, 13}, session.marked)
+	assert.DeepEqual(t, []string{"XYZ", "ABCDEF"}, payloads)
+	assert.Equal(t, 2, len(events))
+	assert.DeepEqual(t, RebalanceEvent{Type: RebalanceAssigned, TopicPartition: TopicPartition{cli.Topic, 0}, Offset: 10}, events[0])
+	assert.Equal(t, RebalanceRevoked, events[1].Type)
+}
+
+func TestConsumeClaimNack(t *testing.T) {
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	out := make(chan *message.Message)
+	handler := &claimHandler{cli: cli, ctx: context.Background(), out: out, logger: &consumerLogger{cli: cli}}
+	session := &mockSession{ctx: context.Background()}
+	claim := &mockClaim{topic: cli.Topic, messages: make(chan *sarama.ConsumerMessage, 1)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: cli.Topic, Partition: 0, Offset: 10, Value: []byte("data")}
+	close(claim.messages)
+
+	go func() {
+		(<-out).Nack()
+		msg := <-out
+		assert.Equal(t, "data", string(msg.Payload))
+		msg.Ack()
+	}()
+	assert.NilError(t, handler.ConsumeClaim(session, claim))
+	assert.DeepEqual(t, []int64{11}, session.marked)
+}
@@ -0,0 +1,248 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/ipc"
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/sink"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// grpcMinions tracks the Minions connected to the gRPC source.
+	grpcMinions = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "onms_ipc_grpc_minions",
+		Help: "The number of Sink streams from Minions connected to the gRPC IPC source",
+	})
+	// grpcMessages tracks the Sink messages received by the gRPC source.
+	grpcMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "onms_ipc_grpc_messages_total",
+		Help: "The total number of Sink messages received through the gRPC IPC source by module and result (routed or unrouted)",
+	}, []string{"module", "result"})
+)
+
+// GRPCSource receives the Sink messages through the gRPC IPC transport of OpenNMS, for deployments that don't use Kafka.
+// As the Minions are the clients of the OpenNMS gRPC server, the source implements the same OpenNMSIpc service (see protobuf/ipc.proto),
+// so the Minions can point to the receiver instead of (or in addition to) OpenNMS.
+// The messages are routed to the subscriptions by module, based on the topic names, i.e. OpenNMS.Sink.Trap receives the Trap messages.
+// Only the Sink API is supported, as the RPC requests are initiated by OpenNMS; the RPC streams are accepted but ignored.
+type GRPCSource struct {
+	ipc.UnimplementedOpenNMSIpcServer
+
+	Address     string // The address to listen on, i.e. :8990.
+	TLSCert     string // Path to the TLS certificate (PEM); enables TLS when defined.
+	TLSKey      string // Path to the TLS private key (PEM).
+	TLSClientCA string // Path to the certificate authorities (PEM) to verify the client certificates of the Minions; requires TLS.
+
+	server        *grpc.Server
+	listener      net.Listener
+	mutex         sync.RWMutex
+	subscriptions map[string][]*sourceSubscription
+}
+
+// sourceSubscription represents a consumer of the messages of a module.
+type sourceSubscription struct {
+	ctx      context.Context
+	messages chan *message.Message
+}
+
+// Validate Verifies the gRPC source settings, and starts listening for Minions.
+func (src *GRPCSource) Validate() error {
+	if src.Address == "" {
+		return fmt.Errorf("the gRPC source address is required")
+	}
+	if (src.TLSCert == "") != (src.TLSKey == "") {
+		return fmt.Errorf("both TLS certificate and key are required")
+	}
+	if src.TLSClientCA != "" && src.TLSCert == "" {
+		return fmt.Errorf("the TLS client CA requires the TLS certificate and key")
+	}
+	if src.server != nil {
+		return nil
+	}
+	var options []grpc.ServerOption
+	if src.TLSCert != "" {
+		config, err := src.tlsConfig()
+		if err != nil {
+			return err
+		}
+		options = append(options, grpc.Creds(credentials.NewTLS(config)))
+	}
+	if src.TLSClientCA == "" {
+		defaultLogger.Warnf("the gRPC source accepts Sink messages from any client; use a TLS client CA to only accept the Minions")
+	}
+	listener, err := net.Listen("tcp", src.Address)
+	if err != nil {
+		return fmt.Errorf("cannot listen on %s: %v", src.Address, err)
+	}
+	src.listener = listener
+	src.subscriptions = make(map[string][]*sourceSubscription)
+	src.server = grpc.NewServer(options...)
+	ipc.RegisterOpenNMSIpcServer(src.server, src)
+	go func() {
+		if err := src.server.Serve(listener); err != nil {
+			defaultLogger.Errorf("gRPC source failed: %v", err)
+		}
+	}()
+	defaultLogger.Infof("gRPC IPC source listening on %s", listener.Addr())
+	return nil
+}
+
+// tlsConfig Returns the TLS settings of the server, which require a client certificate signed by the client CA when defined.
+func (src *GRPCSource) tlsConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(src.TLSCert, src.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load TLS certificate: %v", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if src.TLSClientCA != "" {
+		data, err := ioutil.ReadFile(src.TLSClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read TLS client CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("invalid TLS client CA %s", src.TLSClientCA)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// Addr Returns the address the source is listening on, or nil when it is not running.
+func (src *GRPCSource) Addr() net.Addr {
+	if src.listener == nil {
+		return nil
+	}
+	return src.listener.Addr()
+}
+
+// Subscribe Returns the channel with the messages of the module associated with the topic, until the context is cancelled.
+// When multiple clients subscribe to the same module, each of them receives all its messages.
+func (src *GRPCSource) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	if src.server == nil {
+		return nil, fmt.Errorf("gRPC source not running")
+	}
+	module := sinkModule(topic)
+	sub := &sourceSubscription{ctx: ctx, messages: make(chan *message.Message)}
+	src.mutex.Lock()
+	src.subscriptions[module] = append(src.subscriptions[module], sub)
+	src.mutex.Unlock()
+	go func() {
+		<-ctx.Done()
+		src.mutex.Lock() // Waits for the in-flight deliveries, which are aborted by the cancellation
+		defer src.mutex.Unlock()
+		subs := src.subscriptions[module]
+		for i, s := range subs {
+			if s == sub {
+				src.subscriptions[module] = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+		close(sub.messages)
+	}()
+	return sub.messages, nil
+}
+
+// Close Disconnects the Minions and stops the server.
+func (src *GRPCSource) Close() error {
+	if src.server == nil {
+		return nil
+	}
+	src.server.Stop()
+	src.server = nil
+	src.listener = nil
+	return nil
+}
+
+// SinkStreaming Receives the Sink messages from a Minion, delivering each of them once the previous one was processed.
+func (src *GRPCSource) SinkStreaming(stream ipc.OpenNMSIpc_SinkStreamingServer) error {
+	grpcMinions.Inc()
+	defer grpcMinions.Dec()
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&ipc.Empty{})
+		}
+		if err != nil {
+			return err
+		}
+		if err := src.deliver(stream.Context(), msg); err != nil {
+			return err
+		}
+	}
+}
+
+// RpcStreaming Keeps the RPC stream of a Minion open, ignoring its messages, as the receiver doesn't send RPC requests.
+func (src *GRPCSource) RpcStreaming(stream ipc.OpenNMSIpc_RpcStreamingServer) error {
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defaultLogger.Debugf("ignoring RPC message from minion %s at location %s (module %s)", msg.SystemId, msg.Location, msg.ModuleId)
+	}
+}
+
+// deliver Sends a Sink message as a single-chunk SinkMessage to each subscription of its module, waiting until they are processed.
+func (src *GRPCSource) deliver(ctx context.Context, msg *ipc.SinkMessage) error {
+	payload, err := proto.Marshal(&sink.SinkMessage{
+		MessageId:   msg.MessageId,
+		Content:     msg.Content,
+		TotalChunks: 1,
+		TracingInfo: msg.TracingInfo,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot encode message %s: %v", msg.MessageId, err)
+	}
+	type delivery struct {
+		msg *message.Message
+		sub *sourceSubscription
+	}
+	var pending []delivery
+	src.mutex.RLock()
+	for _, sub := range src.subscriptions[msg.ModuleId] {
+		m := message.NewMessage(watermill.NewUUID(), payload)
+		select {
+		case sub.messages <- m:
+			pending = append(pending, delivery{m, sub})
+		case <-sub.ctx.Done():
+		case <-ctx.Done():
+		}
+	}
+	src.mutex.RUnlock()
+	if len(pending) == 0 {
+		grpcMessages.WithLabelValues(msg.ModuleId, "unrouted").Inc()
+		return ctx.Err()
+	}
+	grpcMessages.WithLabelValues(msg.ModuleId, "routed").Inc()
+	for _, d := range pending {
+		select {
+		case <-d.msg.Acked():
+		case <-d.msg.Nacked():
+		case <-d.sub.ctx.Done():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
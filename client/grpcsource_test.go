@@ -0,0 +1,104 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/ipc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"gotest.tools/v3/assert"
+)
+
+func TestGRPCSource(t *testing.T) {
+	src := &GRPCSource{Address: "127.0.0.1:0"}
+	assert.NilError(t, src.Validate())
+	defer src.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cli := &KafkaClient{Topic: "OpenNMS.Sink.Heartbeat", GroupID: "grpc-source-test", Parser: "heartbeat", Source: src}
+	assert.ErrorContains(t, (&KafkaClient{Topic: "Test", Source: src, ReassemblyCheckpoint: "checkpoint"}).Validate(), "requires the Kafka consumer")
+	assert.NilError(t, cli.Initialize(ctx))
+	received := make(chan DecodedMessage, 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cli.Handle(func(msg DecodedMessage) error {
+			received <- msg
+			return nil
+		})
+	}()
+
+	conn, err := grpc.DialContext(ctx, src.Addr().String(), grpc.WithInsecure(), grpc.WithBlock())
+	assert.NilError(t, err)
+	defer conn.Close()
+	stream, err := ipc.NewOpenNMSIpcClient(conn).SinkStreaming(ctx)
+	assert.NilError(t, err)
+	assert.NilError(t, stream.Send(&ipc.SinkMessage{MessageId: "0001", ModuleId: "Syslog", Content: []byte("ignored")})) // Unrouted
+	assert.NilError(t, stream.Send(&ipc.SinkMessage{MessageId: "0002", ModuleId: "Heartbeat", Content: []byte("Minion")}))
+	_, err = stream.CloseAndRecv()
+	assert.NilError(t, err)
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, "OpenNMS.Sink.Heartbeat", msg.Topic)
+		assert.Equal(t, "Minion", string(msg.Payload))
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for message")
+	}
+
+	// The source is not closed when the client stops, so it can be initialized again
+	cli.Stop()
+	<-done
+	assert.Assert(t, src.Addr() != nil)
+	waitFor(t, func() bool {
+		src.mutex.RLock()
+		defer src.mutex.RUnlock()
+		return len(src.subscriptions["Heartbeat"]) == 0
+	})
+}
+
+func TestGRPCSourceClientCA(t *testing.T) {
+	cert, key := writeCertificate(t)
+	assert.ErrorContains(t, (&GRPCSource{Address: "127.0.0.1:0", TLSClientCA: cert}).Validate(), "requires the TLS certificate")
+	assert.ErrorContains(t, (&GRPCSource{Address: "127.0.0.1:0", TLSCert: cert, TLSKey: key, TLSClientCA: key}).Validate(), "invalid TLS client CA")
+	src := &GRPCSource{Address: "127.0.0.1:0", TLSCert: cert, TLSKey: key, TLSClientCA: cert}
+	assert.NilError(t, src.Validate())
+	defer src.Close()
+
+	send := func(config *tls.Config) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		conn, err := grpc.DialContext(ctx, src.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(config)))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		stream, err := ipc.NewOpenNMSIpcClient(conn).SinkStreaming(ctx)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&ipc.SinkMessage{MessageId: "0001", ModuleId: "Heartbeat", Content: []byte("Minion")}); err != nil {
+			return err
+		}
+		_, err = stream.CloseAndRecv()
+		return err
+	}
+
+	// The clients without a certificate signed by the client CA are rejected
+	assert.Assert(t, send(&tls.Config{InsecureSkipVerify: true}) != nil)
+	pair, err := tls.LoadX509KeyPair(cert, key)
+	assert.NilError(t, err)
+	assert.NilError(t, send(&tls.Config{InsecureSkipVerify: true, Certificates: []tls.Certificate{pair}}))
+}
+
+func TestSinkModule(t *testing.T) {
+	assert.Equal(t, "Trap", sinkModule("OpenNMS.Sink.Trap"))
+	assert.Equal(t, "Telemetry-Netflow-9", sinkModule("Sink.Sink.Telemetry-Netflow-9"))
+	assert.Equal(t, "Syslog", sinkModule("Syslog"))
+}
@@ -0,0 +1,146 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/protobuf/proto"
+)
+
+// Handoff compression modes
+const (
+	HandoffNone = "none" // Frames contain the serialized messages as is.
+	HandoffZstd = "zstd" // Each frame contains a Zstandard frame with the serialized message.
+)
+
+// handoffMagic identifies the handoff protocol on the preamble sent on each connection.
+const handoffMagic = "OIPC"
+
+// handoffVersion is the version of the handoff protocol.
+const handoffVersion = 1
+
+// handoffCompression contains the codes of each compression mode sent on the preamble.
+var handoffCompression = map[string]byte{HandoffNone: 0, HandoffZstd: 1}
+
+// HandoffOutput sends the decoded messages to a co-located process through a Unix socket, avoiding the JSON serialization overhead.
+// Each connection starts with a preamble with the magic OIPC, the protocol version, and the compression code (0 for none, 1 for zstd),
+// followed by a sequence of frames, each with the length as a 32-bit big-endian integer and a stream.Message in protobuf format
+// (see protobuf/stream.proto), optionally compressed with Zstandard.
+// The output connects to the socket on demand; when the connection fails, the message is reported as a retryable failure,
+// and the next message reconnects.
+type HandoffOutput struct {
+	Path        string // The path of the Unix socket, which must be created by the consumer process.
+	Compression string // The compression of the frames: none (default) or zstd.
+
+	mutex   sync.Mutex
+	conn    net.Conn
+	writer  *bufio.Writer
+	encoder *zstd.Encoder
+}
+
+// Validate Verifies the handoff output settings.
+// The socket doesn't have to exist yet, so the consumer process can start afterwards.
+func (out *HandoffOutput) Validate() error {
+	if out.Path == "" {
+		return fmt.Errorf("the socket path is required")
+	}
+	switch out.Compression {
+	case "":
+		out.Compression = HandoffNone
+	case HandoffNone:
+	case HandoffZstd:
+		if out.encoder == nil {
+			encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+			if err != nil {
+				return fmt.Errorf("cannot create zstd encoder: %v", err)
+			}
+			out.encoder = encoder
+		}
+	default:
+		return fmt.Errorf("invalid compression %s; expecting %s or %s", out.Compression, HandoffNone, HandoffZstd)
+	}
+	return nil
+}
+
+// Name Returns the name of the output.
+func (out *HandoffOutput) Name() string {
+	return "handoff:" + out.Path
+}
+
+// Send Writes a decoded message as a frame to the socket, connecting to it when necessary.
+func (out *HandoffOutput) Send(ctx context.Context, msg DecodedMessage) error {
+	data, err := proto.Marshal(newStreamMessage(msg))
+	if err != nil {
+		return fmt.Errorf("cannot encode message: %v", err)
+	}
+	if out.encoder != nil {
+		data = out.encoder.EncodeAll(data, make([]byte, 0, len(data)))
+	}
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+	if out.conn == nil {
+		if err := out.connect(ctx); err != nil {
+			return &OutputError{Err: err, Retryable: true}
+		}
+	}
+	deadline, _ := ctx.Deadline() // No deadline when zero
+	out.conn.SetWriteDeadline(deadline)
+	if err := out.writeFrame(data); err != nil {
+		out.disconnect()
+		return &OutputError{Err: fmt.Errorf("cannot write to %s: %v", out.Path, err), Retryable: true}
+	}
+	return nil
+}
+
+// Close Closes the connection to the socket.
+func (out *HandoffOutput) Close() error {
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+	out.disconnect()
+	if out.encoder != nil {
+		out.encoder.Close()
+		out.encoder = nil
+	}
+	return nil
+}
+
+// connect Opens the connection to the socket and sends the preamble.
+func (out *HandoffOutput) connect(ctx context.Context) error {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "unix", out.Path)
+	if err != nil {
+		return fmt.Errorf("cannot connect to %s: %v", out.Path, err)
+	}
+	out.conn = conn
+	out.writer = bufio.NewWriterSize(conn, 64*1024)
+	out.writer.WriteString(handoffMagic)
+	out.writer.Write([]byte{handoffVersion, handoffCompression[out.Compression]})
+	defaultLogger.Infof("connected to handoff socket %s", out.Path)
+	return nil
+}
+
+// disconnect Closes the connection to the socket, if any.
+func (out *HandoffOutput) disconnect() {
+	if out.conn != nil {
+		out.conn.Close()
+		out.conn = nil
+		out.writer = nil
+	}
+}
+
+// writeFrame Writes a length-prefixed frame, flushing it to the socket.
+func (out *HandoffOutput) writeFrame(data []byte) error {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(data)))
+	out.writer.Write(length[:])
+	out.writer.Write(data)
+	return out.writer.Flush()
+}
@@ -0,0 +1,83 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/stream"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/protobuf/proto"
+	"gotest.tools/v3/assert"
+)
+
+// readHandoff Accepts a connection on the handoff socket, and returns the preamble and the payload of the frames.
+func readHandoff(t *testing.T, listener net.Listener, frames int) ([]byte, [][]byte) {
+	conn, err := listener.Accept()
+	assert.NilError(t, err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	preamble := make([]byte, 6)
+	_, err = io.ReadFull(reader, preamble)
+	assert.NilError(t, err)
+	var payloads [][]byte
+	for i := 0; i < frames; i++ {
+		var length uint32
+		assert.NilError(t, binary.Read(reader, binary.BigEndian, &length))
+		data := make([]byte, length)
+		_, err = io.ReadFull(reader, data)
+		assert.NilError(t, err)
+		payloads = append(payloads, data)
+	}
+	return preamble, payloads
+}
+
+func TestHandoffOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "handoff.sock")
+
+	out := &HandoffOutput{Path: path, Compression: HandoffZstd}
+	assert.NilError(t, out.Validate())
+	defer out.Close()
+	msg := DecodedMessage{Topic: "Test", Parser: "netflow", Offset: 42, Metadata: Metadata{SourceAddress: "10.0.0.1"}, Payload: []byte(`{"id":1}`)}
+
+	// The consumer is not running yet
+	assert.Equal(t, OutputRetryable, outputResult(out.Send(context.Background(), msg)))
+
+	listener, err := net.Listen("unix", path)
+	assert.NilError(t, err)
+	defer listener.Close()
+	done := make(chan struct{})
+	var preamble []byte
+	var payloads [][]byte
+	go func() {
+		defer close(done)
+		preamble, payloads = readHandoff(t, listener, 2)
+	}()
+	assert.NilError(t, out.Send(context.Background(), msg))
+	msg.Offset++
+	assert.NilError(t, out.Send(context.Background(), msg))
+	<-done
+
+	assert.DeepEqual(t, []byte{'O', 'I', 'P', 'C', 1, 1}, preamble)
+	decoder, err := zstd.NewReader(nil)
+	assert.NilError(t, err)
+	defer decoder.Close()
+	for i, payload := range payloads {
+		data, err := decoder.DecodeAll(payload, nil)
+		assert.NilError(t, err)
+		record := &stream.Message{}
+		assert.NilError(t, proto.Unmarshal(data, record))
+		assert.Equal(t, "Test", record.Topic)
+		assert.Equal(t, "10.0.0.1", record.Key)
+		assert.Equal(t, int64(42+i), record.Offset)
+		assert.Equal(t, `{"id":1}`, string(record.Payload))
+	}
+
+	assert.ErrorContains(t, (&HandoffOutput{Path: path, Compression: "gzip"}).Validate(), "invalid compression")
+}
@@ -0,0 +1,158 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// HeaderRule represents a condition on a Kafka header, with the format key=value or key!=value.
+// The value is a glob pattern, so key=* requires the header, and key!=* requires its absence.
+type HeaderRule struct {
+	Key    string
+	Value  string
+	Negate bool
+}
+
+// String Returns the rule in its text format.
+func (r HeaderRule) String() string {
+	if r.Negate {
+		return r.Key + "!=" + r.Value
+	}
+	return r.Key + "=" + r.Value
+}
+
+// matches Returns true when the headers satisfy the rule; a missing header is treated as an empty value.
+func (r HeaderRule) matches(headers map[string]string) bool {
+	value, ok := headers[r.Key]
+	matched := false
+	if ok || r.Value != "*" {
+		matched, _ = path.Match(r.Value, value)
+	}
+	return matched != r.Negate
+}
+
+// parseHeaderRule Parses a rule with the format key=value or key!=value.
+func parseHeaderRule(value string) (HeaderRule, error) {
+	idx := strings.Index(value, "=")
+	if idx < 1 {
+		return HeaderRule{}, fmt.Errorf("invalid header rule %s; expecting key=value or key!=value", value)
+	}
+	rule := HeaderRule{Key: strings.TrimSpace(value[:idx]), Value: strings.TrimSpace(value[idx+1:])}
+	if strings.HasSuffix(rule.Key, "!") {
+		rule.Key = strings.TrimSpace(strings.TrimSuffix(rule.Key, "!"))
+		rule.Negate = true
+	}
+	if rule.Key == "" {
+		return HeaderRule{}, fmt.Errorf("invalid header rule %s; the key is required", value)
+	}
+	if _, err := path.Match(rule.Value, ""); err != nil {
+		return HeaderRule{}, fmt.Errorf("invalid header rule %s: %v", value, err)
+	}
+	return rule, nil
+}
+
+// HeaderRules represents a set of conditions on the Kafka headers, which must be all satisfied.
+// It can be used as a CLI flag with the format key=value or key!=value, and can be repeated.
+type HeaderRules []HeaderRule
+
+// String gets a CSV with all the rules
+func (r *HeaderRules) String() string {
+	if r == nil {
+		return ""
+	}
+	items := make([]string, len(*r))
+	for i, rule := range *r {
+		items[i] = rule.String()
+	}
+	return strings.Join(items, ", ")
+}
+
+// Set parses a rule and adds it to the set
+func (r *HeaderRules) Set(value string) error {
+	rule, err := parseHeaderRule(value)
+	if err != nil {
+		return err
+	}
+	*r = append(*r, rule)
+	return nil
+}
+
+// Matches Returns true when the headers satisfy all the rules, or when there are no rules.
+func (r HeaderRules) Matches(headers map[string]string) bool {
+	for _, rule := range r {
+		if !rule.matches(headers) {
+			return false
+		}
+	}
+	return true
+}
+
+// OutputRoutes represents the header rules that a message must satisfy to be sent to each output.
+// It can be used as a CLI flag with the format output:key=value or output:key!=value, and can be repeated.
+// The output is either its full name, like forward:traps, or its kind, like forward, which applies to all the outputs of that kind.
+// Outputs without rules receive all the messages.
+type OutputRoutes map[string]HeaderRules
+
+// String gets a CSV with all the routes
+func (r *OutputRoutes) String() string {
+	if r == nil {
+		return ""
+	}
+	names := make([]string, 0, len(*r))
+	for name := range *r {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var items []string
+	for _, name := range names {
+		for _, rule := range (*r)[name] {
+			items = append(items, name+":"+rule.String())
+		}
+	}
+	return strings.Join(items, ", ")
+}
+
+// Set parses a route and adds it to the set
+func (r *OutputRoutes) Set(value string) error {
+	idx := strings.LastIndex(strings.SplitN(value, "=", 2)[0], ":")
+	if idx < 1 {
+		return fmt.Errorf("invalid route %s; expecting output:key=value or output:key!=value", value)
+	}
+	rule, err := parseHeaderRule(value[idx+1:])
+	if err != nil {
+		return err
+	}
+	if *r == nil {
+		*r = make(OutputRoutes)
+	}
+	name := value[:idx]
+	(*r)[name] = append((*r)[name], rule)
+	return nil
+}
+
+// allows Returns true when a message with the given headers can be sent to the output.
+func (r OutputRoutes) allows(output Output, headers map[string]string) bool {
+	name := output.Name()
+	kind := strings.SplitN(name, ":", 2)[0]
+	return r[name].Matches(headers) && (kind == name || r[kind].Matches(headers))
+}
+
+// kafkaHeaders Returns a copy of the Kafka headers of a message.
+func kafkaHeaders(msg *message.Message) map[string]string {
+	if msg == nil || len(msg.Metadata) == 0 {
+		return nil
+	}
+	headers := make(map[string]string, len(msg.Metadata))
+	for key, value := range msg.Metadata {
+		if key != recordKeyMetadata {
+			headers[key] = value
+		}
+	}
+	return headers
+}
@@ -0,0 +1,106 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/sink"
+	"google.golang.org/protobuf/proto"
+	"gotest.tools/v3/assert"
+)
+
+func TestHeaderRules(t *testing.T) {
+	rules := HeaderRules{}
+	assert.Assert(t, rules.Matches(nil))
+	assert.NilError(t, rules.Set("tenant=acme"))
+	assert.NilError(t, rules.Set("priority != low"))
+	assert.NilError(t, rules.Set("region=us-*"))
+	assert.Equal(t, "tenant=acme, priority!=low, region=us-*", rules.String())
+
+	assert.Assert(t, rules.Matches(map[string]string{"tenant": "acme", "region": "us-east"}))
+	assert.Assert(t, rules.Matches(map[string]string{"tenant": "acme", "region": "us-east", "priority": "high"}))
+	assert.Assert(t, !rules.Matches(map[string]string{"tenant": "acme", "region": "us-east", "priority": "low"}))
+	assert.Assert(t, !rules.Matches(map[string]string{"tenant": "other", "region": "us-east"}))
+	assert.Assert(t, !rules.Matches(map[string]string{"tenant": "acme"}))
+
+	presence := HeaderRules{}
+	assert.NilError(t, presence.Set("tenant=*"))
+	assert.NilError(t, presence.Set("debug!=*"))
+	assert.Assert(t, presence.Matches(map[string]string{"tenant": ""}))
+	assert.Assert(t, !presence.Matches(map[string]string{}))
+	assert.Assert(t, !presence.Matches(map[string]string{"tenant": "acme", "debug": ""}))
+
+	assert.ErrorContains(t, rules.Set("tenant"), "expecting key=value")
+	assert.ErrorContains(t, rules.Set("!=acme"), "key is required")
+	assert.ErrorContains(t, rules.Set("tenant=[acme"), "invalid header rule")
+}
+
+func TestHeaderFilter(t *testing.T) {
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	assert.NilError(t, cli.HeaderFilter.Set("tenant=acme"))
+
+	msg := buildMessage("0001", 0, 1, []byte("ABC"))
+	assert.Assert(t, cli.processMessage(msg) == nil)
+	msg = buildMessage("0002", 0, 1, []byte("ABC"))
+	msg.Metadata = message.Metadata{"tenant": "acme"}
+	assert.Equal(t, "ABC", string(cli.processMessage(msg)))
+	assert.DeepEqual(t, map[string]string{"tenant": "acme"}, cli.newDecodedMessage(msg, nil).Headers)
+}
+
+func TestSinkHeaders(t *testing.T) {
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	data, err := proto.Marshal(&sink.SinkMessage{
+		MessageId:   "0001",
+		TotalChunks: 1,
+		Content:     []byte("ABC"),
+		TracingInfo: map[string]string{"trace": "1"},
+		Headers:     map[string]string{"tenant": "other", "priority": "high"},
+	})
+	assert.NilError(t, err)
+	msg := message.NewMessage("0001", data)
+	msg.Metadata = message.Metadata{"tenant": "acme"}
+	assert.Equal(t, "ABC", string(cli.processMessage(msg)))
+	assert.DeepEqual(t, map[string]string{"tenant": "acme", "priority": "high"}, cli.newDecodedMessage(msg, nil).Headers)
+}
+
+func TestOutputRoutes(t *testing.T) {
+	routes := OutputRoutes{}
+	assert.NilError(t, routes.Set("forward:tenant=acme"))
+	assert.NilError(t, routes.Set("webhook:priority!=low"))
+	assert.NilError(t, routes.Set("webhook:alerts:priority=high"))
+	assert.Equal(t, "forward:tenant=acme, webhook:priority!=low, webhook:alerts:priority=high", routes.String())
+	assert.ErrorContains(t, routes.Set("tenant=acme"), "expecting output:key=value")
+
+	forward := &countingOutput{name: "forward:traps"}
+	webhook := &countingOutput{name: "webhook:alerts"}
+	other := &countingOutput{name: "elasticsearch"}
+	cli := &KafkaClient{Outputs: []Output{forward, webhook, other}, OutputRoutes: routes}
+	cli.sendOutputs(DecodedMessage{Headers: map[string]string{"tenant": "acme", "priority": "high"}})
+	cli.sendOutputs(DecodedMessage{Headers: map[string]string{"tenant": "other", "priority": "medium"}})
+	cli.sendOutputs(DecodedMessage{})
+	assert.Equal(t, 1, forward.sent)
+	assert.Equal(t, 1, webhook.sent)
+	assert.Equal(t, 3, other.sent)
+}
+
+// countingOutput counts the messages it receives.
+type countingOutput struct {
+	name string
+	sent int
+	last DecodedMessage
+}
+
+func (out *countingOutput) Name() string {
+	return out.name
+}
+
+func (out *countingOutput) Send(ctx context.Context, msg DecodedMessage) error {
+	out.sent++
+	out.last = msg
+	return nil
+}
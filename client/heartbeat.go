@@ -0,0 +1,54 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/xml"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// minionLastSeen tracks the last heartbeat received from the Minions of each location.
+var minionLastSeen = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "onms_ipc_minion_last_seen_timestamp_seconds",
+	Help: "The timestamp of the latest heartbeat received from a Minion, by location",
+}, []string{"location"})
+
+// HeartbeatDTO represents the heartbeat of a Minion
+type HeartbeatDTO struct {
+	XMLName   xml.Name `xml:"minion" json:"-"`
+	ID        string   `xml:"id" json:"id"`
+	Location  string   `xml:"location" json:"location"`
+	Timestamp string   `xml:"timestamp" json:"timestamp"`
+	Version   string   `xml:"version" json:"version,omitempty"`
+}
+
+// String Returns the JSON representation of the heartbeat
+func (dto HeartbeatDTO) String() string {
+	var s string
+	if err := encodeIndent(dto, func(data []byte) { s = string(data) }); err != nil {
+		defaultLogger.Errorf("cannot generate JSON for heartbeat: %v", err)
+	}
+	return s
+}
+
+// Time Returns the time the heartbeat was sent, or the zero time when the timestamp cannot be parsed.
+func (dto *HeartbeatDTO) Time() time.Time {
+	ts, err := time.Parse(time.RFC3339Nano, dto.Timestamp)
+	if err != nil {
+		return time.Time{}
+	}
+	return ts
+}
+
+// recordHeartbeat Updates the last seen gauge of the location of a Minion, based on the time of its heartbeat,
+// or the current time when it is unknown.
+func recordHeartbeat(dto *HeartbeatDTO) {
+	ts := dto.Time()
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	minionLastSeen.WithLabelValues(dto.Location).Set(float64(ts.UnixNano()) / float64(time.Second))
+}
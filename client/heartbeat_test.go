@@ -0,0 +1,42 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gotest.tools/v3/assert"
+)
+
+func TestHeartbeatParser(t *testing.T) {
+	cli := &KafkaClient{IPC: "sink"}
+	data := []byte(`<minion><id>minion01</id><location>Apex</location><timestamp>2021-03-26T14:42:53.803-04:00</timestamp><version>28.0.0</version></minion>`)
+	var payload []byte
+	var meta Metadata
+	cli.decodePayload(data, "OpenNMS.Sink.Heartbeat", "heartbeat", func(p []byte, m Metadata) {
+		payload, meta = p, m
+	})
+	assert.Equal(t, `{
+  "id": "minion01",
+  "location": "Apex",
+  "timestamp": "2021-03-26T14:42:53.803-04:00",
+  "version": "28.0.0"
+}`, string(payload))
+	assert.Equal(t, "Apex", meta.Location)
+	assert.Equal(t, "minion01", meta.SystemID)
+	ts := time.Date(2021, 3, 26, 18, 42, 53, 803000000, time.UTC)
+	assert.Equal(t, float64(ts.UnixNano())/float64(time.Second), testutil.ToFloat64(minionLastSeen.WithLabelValues("Apex")))
+
+	// Without a valid timestamp, the current time is used
+	start := time.Now()
+	cli.decodePayload([]byte(`<minion><id>minion02</id><location>Remote</location></minion>`), "OpenNMS.Sink.Heartbeat", "heartbeat", func(p []byte, m Metadata) {})
+	assert.Assert(t, testutil.ToFloat64(minionLastSeen.WithLabelValues("Remote")) >= float64(start.Unix()))
+
+	// Other payloads are passed as is
+	cli.decodePayload([]byte("ABC"), "OpenNMS.Sink.Heartbeat", "heartbeat", func(p []byte, m Metadata) {
+		payload = p
+	})
+	assert.Equal(t, "ABC", string(payload))
+}
@@ -0,0 +1,130 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/stream"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// streamFilter represents the conditions a message must satisfy to be sent to a client.
+type streamFilter struct {
+	topics    []string
+	parsers   []string
+	locations []string
+	network   *net.IPNet
+	headers   HeaderRules
+}
+
+// newStreamFilter Parses the filter requested by a client.
+func newStreamFilter(req *stream.Filter) (*streamFilter, error) {
+	filter := &streamFilter{topics: req.Topics, parsers: req.Parsers, locations: req.Locations}
+	if req.Source != "" {
+		network, err := parseNetwork(req.Source)
+		if err != nil {
+			return nil, err
+		}
+		filter.network = network
+	}
+	for _, rule := range req.Headers {
+		if err := filter.headers.Set(rule); err != nil {
+			return nil, err
+		}
+	}
+	return filter, nil
+}
+
+// matches Returns true when the decoded message satisfies the filter.
+func (f *streamFilter) matches(msg DecodedMessage) bool {
+	if len(f.topics) > 0 && !containsString(f.topics, msg.Topic, false) {
+		return false
+	}
+	if len(f.parsers) > 0 && !containsString(f.parsers, msg.Parser, true) {
+		return false
+	}
+	if len(f.locations) > 0 && !containsString(f.locations, msg.Metadata.Location, false) {
+		return false
+	}
+	if f.network != nil {
+		ip := net.ParseIP(msg.Metadata.SourceAddress)
+		if ip == nil || !f.network.Contains(ip) {
+			return false
+		}
+	}
+	return f.headers.Matches(msg.Headers)
+}
+
+// containsString Returns true when the list contains the value.
+func containsString(list []string, value string, ignoreCase bool) bool {
+	for _, item := range list {
+		if item == value || (ignoreCase && strings.EqualFold(item, value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// hubSubscriber represents a client of a message hub.
+type hubSubscriber struct {
+	filter   *streamFilter
+	messages chan DecodedMessage
+}
+
+// messageHub fans out the decoded messages to the connected clients of the streaming endpoints, based on their filters.
+// Each client has its own buffer; when it is full, the messages for that client are dropped instead of blocking the consumer.
+type messageHub struct {
+	mutex       sync.RWMutex
+	subscribers map[*hubSubscriber]bool
+	clients     prometheus.Gauge
+	dropped     prometheus.Counter
+}
+
+// newMessageHub Creates a message hub that tracks the connected clients and the dropped messages through the given metrics.
+func newMessageHub(clients prometheus.Gauge, dropped prometheus.Counter) *messageHub {
+	return &messageHub{subscribers: make(map[*hubSubscriber]bool), clients: clients, dropped: dropped}
+}
+
+// subscribe Registers a client with a given filter and buffer size.
+func (h *messageHub) subscribe(filter *streamFilter, size int) *hubSubscriber {
+	sub := &hubSubscriber{filter: filter, messages: make(chan DecodedMessage, size)}
+	h.mutex.Lock()
+	h.subscribers[sub] = true
+	h.mutex.Unlock()
+	h.clients.Inc()
+	return sub
+}
+
+// unsubscribe Removes a client.
+func (h *messageHub) unsubscribe(sub *hubSubscriber) {
+	h.mutex.Lock()
+	delete(h.subscribers, sub)
+	h.mutex.Unlock()
+	h.clients.Dec()
+}
+
+// count Returns the number of connected clients.
+func (h *messageHub) count() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.subscribers)
+}
+
+// publish Queues a decoded message for each client whose filter it satisfies, without blocking.
+func (h *messageHub) publish(msg DecodedMessage) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for sub := range h.subscribers {
+		if !sub.filter.matches(msg) {
+			continue
+		}
+		select {
+		case sub.messages <- msg:
+		default:
+			h.dropped.Inc()
+		}
+	}
+}
@@ -0,0 +1,301 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/netflow"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Default InfluxDB output settings
+const (
+	DefaultInfluxBatchSize     = 5000
+	DefaultInfluxFlushInterval = 5 * time.Second
+	DefaultInfluxMaxRetries    = 3
+	DefaultInfluxRetryDelay    = time.Second
+)
+
+// influxPoints tracks the final result of the points written to InfluxDB.
+var influxPoints = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "onms_ipc_influx_points_total",
+	Help: "The total number of points written to InfluxDB by destination and result (success or failure), after the retries",
+}, []string{"destination", "result"})
+
+// influxTags contains the tags of the points, which can be renamed or removed through the tag mapping.
+var influxTags = []string{"exporter", "location", "interface", "direction", "protocol", "parser"}
+
+// influxEscaper escapes the tag keys and values, and the field keys, of the line protocol.
+var influxEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// InfluxOutput converts the telemetry messages into InfluxDB points in line protocol, written in batches through the HTTP API,
+// for dashboards built on InfluxDB. Each Netflow/IPFIX flow is a point of the flows measurement with the bytes and packets fields;
+// other telemetry messages are points of the telemetry measurement with the size of the payload as the bytes field.
+// The points are tagged by exporter, location, interface (the input ifIndex for ingress flows, the output one for egress flows),
+// direction, protocol and parser, when available; the tags can be renamed or removed through the tag mapping.
+// The write failures are retried with an exponential backoff; the batches that can't be written are dropped, as the messages were already acknowledged.
+// This is a concurrent safe object.
+type InfluxOutput struct {
+	URL           string        // The base URL of InfluxDB, i.e. http://localhost:8086.
+	Org           string        // The organization, for the v2 API.
+	Bucket        string        // The bucket, for the v2 API; when empty, the v1 API is used with the database.
+	Database      string        // The database, for the v1 API.
+	Token         string        `json:"-"` // The API token (or user:password for the v1 API); accepts secret references (optional).
+	Tags          Properties    // Renames the tags as tag=name; an empty name removes the tag (optional).
+	BatchSize     int           // The maximum number of points written at once (defaults to DefaultInfluxBatchSize).
+	FlushInterval time.Duration // How often the pending points are written (defaults to DefaultInfluxFlushInterval).
+	MaxRetries    int           // How many times a failed write is retried (defaults to DefaultInfluxMaxRetries).
+	RetryDelay    time.Duration // The delay before the first retry, doubled on each attempt (defaults to DefaultInfluxRetryDelay).
+	Client        *http.Client  `json:"-"` // The HTTP client (optional).
+
+	mutex    sync.Mutex
+	lines    []string
+	writeURL string
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// Validate Verifies the InfluxDB output settings, applying defaults when necessary, and starts the periodic writes.
+func (out *InfluxOutput) Validate() error {
+	if out.URL == "" {
+		return fmt.Errorf("the InfluxDB URL is required")
+	}
+	for tag := range out.Tags {
+		if !containsString(influxTags, tag, false) {
+			return fmt.Errorf("invalid tag %s; expecting %s", tag, strings.Join(influxTags, ", "))
+		}
+	}
+	params := url.Values{"precision": []string{"ms"}}
+	base := strings.TrimSuffix(out.URL, "/")
+	if out.Bucket != "" {
+		params.Set("org", out.Org)
+		params.Set("bucket", out.Bucket)
+		out.writeURL = base + "/api/v2/write?" + params.Encode()
+	} else if out.Database != "" {
+		params.Set("db", out.Database)
+		out.writeURL = base + "/write?" + params.Encode()
+	} else {
+		return fmt.Errorf("either the bucket or the database is required")
+	}
+	if out.BatchSize <= 0 {
+		out.BatchSize = DefaultInfluxBatchSize
+	}
+	if out.FlushInterval <= 0 {
+		out.FlushInterval = DefaultInfluxFlushInterval
+	}
+	if out.MaxRetries <= 0 {
+		out.MaxRetries = DefaultInfluxMaxRetries
+	}
+	if out.RetryDelay <= 0 {
+		out.RetryDelay = DefaultInfluxRetryDelay
+	}
+	if out.stop == nil {
+		out.stop = make(chan struct{})
+		out.wg.Add(1)
+		go out.flusher()
+	}
+	return nil
+}
+
+// Name Returns the name of the output.
+func (out *InfluxOutput) Name() string {
+	return "influx:" + out.URL
+}
+
+// Send Converts a telemetry message into a point, writing the pending points in the background when the batch is full.
+// Messages from other parsers are ignored.
+func (out *InfluxOutput) Send(ctx context.Context, msg DecodedMessage) error {
+	if !isTelemetry(msg.Parser) {
+		return nil
+	}
+	line, err := out.point(msg)
+	if err != nil {
+		return err
+	}
+	out.mutex.Lock()
+	out.lines = append(out.lines, line)
+	var lines []string
+	if len(out.lines) >= out.BatchSize {
+		lines = out.lines
+		out.lines = nil
+	}
+	out.mutex.Unlock()
+	if lines != nil {
+		out.wg.Add(1)
+		go func() {
+			defer out.wg.Done()
+			out.write(lines)
+		}()
+	}
+	return nil
+}
+
+// Close Stops the periodic writes, writing the pending points.
+func (out *InfluxOutput) Close() error {
+	if out.stop == nil {
+		return nil
+	}
+	close(out.stop)
+	out.wg.Wait()
+	out.stop = nil
+	return nil
+}
+
+// point Converts a telemetry message into a point in line protocol.
+func (out *InfluxOutput) point(msg DecodedMessage) (string, error) {
+	tags := map[string]string{
+		"exporter": msg.Metadata.SourceAddress,
+		"location": msg.Metadata.Location,
+		"parser":   strings.ToLower(msg.Parser),
+	}
+	if !isNetflow(msg.Parser) {
+		timestamp := msg.Timestamp
+		if timestamp.IsZero() {
+			timestamp = msg.Received
+		}
+		fields := fmt.Sprintf("bytes=%di", len(msg.Payload))
+		return out.line("telemetry", tags, fields, timestamp.UnixNano()/int64(time.Millisecond)), nil
+	}
+	flow := &netflow.FlowMessage{}
+	if err := json.Unmarshal(msg.Payload, flow); err != nil {
+		return "", fmt.Errorf("invalid flow message: %v", err)
+	}
+	tags["direction"] = strings.ToLower(flow.Direction.String())
+	ifIndex := flow.InputSnmpIfindex
+	if flow.Direction == netflow.Direction_EGRESS {
+		ifIndex = flow.OutputSnmpIfindex
+	}
+	if ifIndex != nil {
+		tags["interface"] = strconv.Itoa(int(ifIndex.Value))
+	}
+	if flow.Protocol != nil {
+		tags["protocol"] = strconv.Itoa(int(flow.Protocol.Value))
+	}
+	var bytes, packets uint64
+	if flow.NumBytes != nil {
+		bytes = flow.NumBytes.Value
+	}
+	if flow.NumPackets != nil {
+		packets = flow.NumPackets.Value
+	}
+	fields := fmt.Sprintf("bytes=%di,packets=%di", bytes, packets)
+	return out.line("flows", tags, fields, int64(flow.Timestamp)), nil
+}
+
+// line Builds a point in line protocol, applying the tag mapping, and sorting the tags as recommended by InfluxDB.
+func (out *InfluxOutput) line(measurement string, tags map[string]string, fields string, millis int64) string {
+	pairs := make([]string, 0, len(tags))
+	for tag, value := range tags {
+		if name, ok := out.Tags[tag]; ok {
+			tag = name
+		}
+		if tag == "" || value == "" {
+			continue
+		}
+		pairs = append(pairs, influxEscaper.Replace(tag)+"="+influxEscaper.Replace(value))
+	}
+	sort.Strings(pairs)
+	var sb strings.Builder
+	sb.WriteString(measurement)
+	for _, pair := range pairs {
+		sb.WriteByte(',')
+		sb.WriteString(pair)
+	}
+	fmt.Fprintf(&sb, " %s %d", fields, millis)
+	return sb.String()
+}
+
+// flusher Writes the pending points periodically, and once more when the output is closed.
+func (out *InfluxOutput) flusher() {
+	defer out.wg.Done()
+	ticker := time.NewTicker(out.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			out.flush()
+		case <-out.stop:
+			out.flush()
+			return
+		}
+	}
+}
+
+// flush Writes the pending points, if any.
+func (out *InfluxOutput) flush() {
+	out.mutex.Lock()
+	lines := out.lines
+	out.lines = nil
+	out.mutex.Unlock()
+	if len(lines) > 0 {
+		out.write(lines)
+	}
+}
+
+// write Sends a batch of points, retrying the retryable failures with an exponential backoff.
+func (out *InfluxOutput) write(lines []string) {
+	body := []byte(strings.Join(lines, "\n"))
+	delay := out.RetryDelay
+	for attempt := 0; ; attempt++ {
+		err := out.post(body)
+		if err == nil {
+			influxPoints.WithLabelValues(out.URL, OutputSuccess).Add(float64(len(lines)))
+			return
+		}
+		if outputResult(err) != OutputRetryable || attempt >= out.MaxRetries {
+			influxPoints.WithLabelValues(out.URL, "failure").Add(float64(len(lines)))
+			defaultLogger.Errorf("cannot write %d points to %s after %d retries, dropping them: %v", len(lines), out.URL, attempt, err)
+			return
+		}
+		defaultLogger.Warnf("cannot write %d points to %s, retrying in %s: %v", len(lines), out.URL, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// post Sends a batch of points in line protocol to the write endpoint.
+func (out *InfluxOutput) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, out.writeURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if out.Token != "" {
+		token, err := ResolveSecret(out.Token)
+		if err != nil {
+			return fmt.Errorf("cannot resolve InfluxDB token: %v", err)
+		}
+		req.Header.Set("Authorization", "Token "+token)
+	}
+	client := out.Client
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return &OutputError{Err: fmt.Errorf("cannot send request to %s: %v", out.URL, err), Retryable: true}
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return &OutputError{
+			Err:       fmt.Errorf("unexpected response from %s: %s %s", out.URL, res.Status, string(bytes.TrimSpace(msg))),
+			Retryable: res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500,
+		}
+	}
+	return nil
+}
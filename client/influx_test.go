@@ -0,0 +1,56 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestInfluxOutput(t *testing.T) {
+	var requests []string
+	var lines []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.String())
+		assert.Equal(t, "Token secret", r.Header.Get("Authorization"))
+		if len(requests) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable) // Retried
+			return
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		lines = append(lines, strings.Split(string(data), "\n")...)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	out := &InfluxOutput{URL: server.URL, Org: "OpenNMS", Bucket: "telemetry", Token: "secret", Tags: Properties{"exporter": "host", "protocol": ""}, RetryDelay: time.Millisecond}
+	assert.NilError(t, out.Validate())
+	meta := Metadata{Location: "Apex Office", SourceAddress: "10.0.0.254"}
+	flow := `{"timestamp":1614900600000,"num_bytes":{"value":1500},"num_packets":{"value":3},"direction":1,"input_snmp_ifindex":{"value":1},"output_snmp_ifindex":{"value":2},"protocol":{"value":6}}`
+	assert.NilError(t, out.Send(context.Background(), DecodedMessage{Parser: "netflow", Payload: []byte(flow), Metadata: meta}))
+	ts := time.Date(2021, 3, 4, 23, 30, 1, 0, time.UTC)
+	assert.NilError(t, out.Send(context.Background(), DecodedMessage{Parser: "jti", Payload: []byte("0123456789"), Metadata: meta, Timestamp: ts}))
+	assert.NilError(t, out.Send(context.Background(), DecodedMessage{Parser: "syslog", Payload: []byte("ignored")}))
+	assert.NilError(t, out.Close())
+
+	assert.Equal(t, 2, len(requests))
+	assert.Equal(t, "/api/v2/write?bucket=telemetry&org=OpenNMS&precision=ms", requests[1])
+	assert.DeepEqual(t, []string{
+		`flows,direction=egress,host=10.0.0.254,interface=2,location=Apex\ Office,parser=netflow bytes=1500i,packets=3i 1614900600000`,
+		`telemetry,host=10.0.0.254,location=Apex\ Office,parser=jti bytes=10i 1614900601000`,
+	}, lines)
+
+	v1 := &InfluxOutput{URL: "http://localhost:8086/", Database: "onms"}
+	assert.NilError(t, v1.Validate())
+	assert.Equal(t, "http://localhost:8086/write?db=onms&precision=ms", v1.writeURL)
+	assert.NilError(t, v1.Close())
+	assert.ErrorContains(t, (&InfluxOutput{URL: "http://localhost:8086"}).Validate(), "bucket or the database")
+	assert.ErrorContains(t, (&InfluxOutput{URL: "http://localhost:8086", Database: "onms", Tags: Properties{"node": "x"}}).Validate(), "invalid tag")
+}
@@ -0,0 +1,76 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+)
+
+// Optional tracing info keys to verify the reassembled content, for producers that add them.
+// OpenNMS doesn't include them, so only the structure of the chunks is verified by default.
+const (
+	ContentLengthKey   = "content-length" // The total size of the content in bytes.
+	ContentChecksumKey = "content-crc32"  // The CRC32 (IEEE) checksum of the content, in hexadecimal.
+)
+
+// Integrity failure reasons
+const (
+	IntegrityMissingChunks = "missing-chunks" // Some chunks were not received, or not received in order.
+	IntegrityChunkSize     = "chunk-size"     // The chunk sizes are inconsistent; OpenNMS uses a fixed size for all the chunks except the last one.
+	IntegrityLength        = "length"         // The content doesn't have the expected size.
+	IntegrityChecksum      = "checksum"       // The content doesn't have the expected checksum.
+)
+
+// checkChunk Verifies that an intermediate chunk is the next one expected, and that it has the same size as the previous chunks.
+// Returns the integrity failure reason, or an empty string when the chunk is valid.
+func (p *partialMessage) checkChunk(ipcmsg *ipcMessage) string {
+	if ipcmsg.chunk != p.chunk+1 {
+		return IntegrityMissingChunks
+	}
+	if p.chunk > 0 && len(ipcmsg.content) != p.chunkSize {
+		return IntegrityChunkSize
+	}
+	return ""
+}
+
+// checkLastChunk Verifies that the last chunk completes the partial message.
+// Returns the integrity failure reason, or an empty string when the message is valid.
+func (p *partialMessage) checkLastChunk(ipcmsg *ipcMessage) string {
+	if p.invalid != "" {
+		return p.invalid
+	}
+	if p.chunk != ipcmsg.total-1 {
+		return IntegrityMissingChunks
+	}
+	if len(ipcmsg.content) > p.chunkSize {
+		return IntegrityChunkSize
+	}
+	return ""
+}
+
+// checkContent Verifies the length and checksum of the reassembled content, when the IPC message carries them.
+// Returns the integrity failure reason, or an empty string when the content is valid.
+func checkContent(tracingInfo map[string]string, data []byte) string {
+	if value, ok := tracingInfo[ContentLengthKey]; ok {
+		if length, err := strconv.Atoi(value); err != nil || length != len(data) {
+			return IntegrityLength
+		}
+	}
+	if value, ok := tracingInfo[ContentChecksumKey]; ok {
+		if !strings.EqualFold(value, fmt.Sprintf("%08x", crc32.ChecksumIEEE(data))) {
+			return IntegrityChecksum
+		}
+	}
+	return ""
+}
+
+// integrityFailure Reports a reassembled message that failed the integrity checks.
+func (cli *KafkaClient) integrityFailure(ipcmsg *ipcMessage, reason string) {
+	cli.logger().Warnf("discarding message %s with %d chunks, integrity check failed: %s", ipcmsg.id, ipcmsg.total, reason)
+	if cli.integrityFailures != nil {
+		cli.integrityFailures.WithLabelValues(reason).Inc()
+	}
+}
@@ -0,0 +1,63 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"fmt"
+	"hash/crc32"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/sink"
+	"google.golang.org/protobuf/proto"
+	"gotest.tools/v3/assert"
+)
+
+func TestIntegrityChecks(t *testing.T) {
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+
+	// Missing intermediate chunk
+	assert.Assert(t, cli.processMessage(buildMessage("gap", 0, 3, []byte("ABC"))) == nil)
+	assert.Assert(t, cli.processMessage(buildMessage("gap", 2, 3, []byte("GHI"))) == nil)
+	assert.Equal(t, 0, len(cli.msgBuffer))
+
+	// Missing first chunk
+	assert.Assert(t, cli.processMessage(buildMessage("first", 1, 3, []byte("DEF"))) == nil)
+	assert.Assert(t, cli.processMessage(buildMessage("first", 2, 3, []byte("GHI"))) == nil)
+
+	// Missing all the previous chunks
+	assert.Assert(t, cli.processMessage(buildMessage("last", 2, 3, []byte("GHI"))) == nil)
+
+	// Inconsistent chunk sizes
+	assert.Assert(t, cli.processMessage(buildMessage("size", 0, 3, []byte("ABC"))) == nil)
+	assert.Assert(t, cli.processMessage(buildMessage("size", 1, 3, []byte("DE"))) == nil)
+	assert.Assert(t, cli.processMessage(buildMessage("size", 2, 3, []byte("F"))) == nil)
+	assert.Assert(t, cli.processMessage(buildMessage("bigger", 0, 2, []byte("ABC"))) == nil)
+	assert.Assert(t, cli.processMessage(buildMessage("bigger", 1, 2, []byte("DEFG"))) == nil)
+
+	// Valid message with a shorter last chunk
+	assert.Assert(t, cli.processMessage(buildMessage("valid", 0, 3, []byte("ABC"))) == nil)
+	assert.Assert(t, cli.processMessage(buildMessage("valid", 1, 3, []byte("DEF"))) == nil)
+	assert.Equal(t, "ABCDEFG", string(cli.processMessage(buildMessage("valid", 2, 3, []byte("G")))))
+}
+
+func TestCheckContent(t *testing.T) {
+	data := []byte("ABCDEF")
+	checksum := fmt.Sprintf("%08X", crc32.ChecksumIEEE(data))
+	assert.Equal(t, "", checkContent(nil, data))
+	assert.Equal(t, "", checkContent(map[string]string{ContentLengthKey: "6", ContentChecksumKey: checksum}, data))
+	assert.Equal(t, IntegrityLength, checkContent(map[string]string{ContentLengthKey: "5"}, data))
+	assert.Equal(t, IntegrityLength, checkContent(map[string]string{ContentLengthKey: "six"}, data))
+	assert.Equal(t, IntegrityChecksum, checkContent(map[string]string{ContentChecksumKey: "00000000"}, data))
+
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	bytes, _ := proto.Marshal(&sink.SinkMessage{
+		MessageId:   "0001",
+		Content:     data,
+		TotalChunks: 1,
+		TracingInfo: map[string]string{ContentLengthKey: "7"},
+	})
+	assert.Assert(t, cli.processMessage(&message.Message{UUID: "0001", Payload: bytes}) == nil)
+}
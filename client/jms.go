@@ -0,0 +1,181 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/sink"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/protobuf/proto"
+)
+
+// Default JMS source settings
+const (
+	DefaultJMSTimeout        = 10 * time.Second
+	DefaultJMSReconnectDelay = 5 * time.Second
+)
+
+// jmsMessages tracks the messages received by the JMS source.
+var jmsMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "onms_ipc_jms_messages_total",
+	Help: "The total number of Sink messages received through the JMS source by queue",
+}, []string{"queue"})
+
+// JMSSource receives the Sink messages from the ActiveMQ queues used by the JMS transport of older OpenNMS deployments, through STOMP.
+// Each topic is consumed from the queue with the same name, i.e. OpenNMS.Sink.Trap, through a dedicated connection.
+// As the JMS transport doesn't split the messages, each of them is delivered as a single chunk, and it is acknowledged
+// to the broker once processed, so the unprocessed messages are redelivered after a restart.
+// When the connection fails, it reconnects after a delay, until the subscription is cancelled.
+type JMSSource struct {
+	Address        string        // The STOMP address of the broker, i.e. activemq:61613.
+	Username       string        // The username to authenticate against the broker (optional).
+	Password       string        // The password; accepts secret references (@file, env:NAME, vault:path#field).
+	TLS            TLSConfig     // TLS settings to connect to the broker (optional).
+	Timeout        time.Duration // The timeout to connect to the broker (defaults to DefaultJMSTimeout).
+	ReconnectDelay time.Duration // How long to wait before reconnecting after a failure (defaults to DefaultJMSReconnectDelay).
+
+	tlsConfig *tls.Config
+}
+
+// Validate Verifies the JMS source settings, applying defaults when necessary.
+func (src *JMSSource) Validate() error {
+	if src.Address == "" {
+		return fmt.Errorf("the broker address is required")
+	}
+	if _, err := ResolveSecret(src.Password); err != nil {
+		return fmt.Errorf("invalid password: %v", err)
+	}
+	if src.Timeout <= 0 {
+		src.Timeout = DefaultJMSTimeout
+	}
+	if src.ReconnectDelay <= 0 {
+		src.ReconnectDelay = DefaultJMSReconnectDelay
+	}
+	if src.TLS.Enabled() {
+		config := sarama.NewConfig() // Reuses the TLS handling of the Kafka client
+		if err := src.TLS.apply(config); err != nil {
+			return fmt.Errorf("invalid TLS settings: %v", err)
+		}
+		src.tlsConfig = config.Net.TLS.Config
+	}
+	return nil
+}
+
+// Subscribe Consumes the messages from the queue with the name of the topic, until the context is cancelled.
+func (src *JMSSource) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	conn, err := src.connect(topic)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan *message.Message)
+	go func() {
+		defer close(out)
+		for {
+			err := src.consume(ctx, conn, topic, out)
+			conn.close()
+			if ctx.Err() != nil {
+				return
+			}
+			defaultLogger.Errorf("JMS subscription to %s failed, reconnecting in %s: %v", topic, src.ReconnectDelay, err)
+			for conn = nil; conn == nil; {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(src.ReconnectDelay):
+				}
+				if conn, err = src.connect(topic); err != nil {
+					defaultLogger.Errorf("cannot reconnect to %s: %v", src.Address, err)
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Close Does nothing, as each subscription closes its connection when cancelled.
+func (src *JMSSource) Close() error {
+	return nil
+}
+
+// connect Opens a connection to the broker, and subscribes to a queue with individual client acknowledgements.
+func (src *JMSSource) connect(queue string) (*stompConn, error) {
+	password, err := ResolveSecret(src.Password)
+	if err != nil {
+		return nil, fmt.Errorf("invalid password: %v", err)
+	}
+	conn, err := dialStomp(src.Address, src.Username, password, src.tlsConfig, src.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	err = conn.send("SUBSCRIBE", map[string]string{
+		"id":          "0",
+		"destination": "/queue/" + queue,
+		"ack":         "client-individual",
+	})
+	if err != nil {
+		conn.close()
+		return nil, err
+	}
+	defaultLogger.Infof("subscribed to queue %s at %s", queue, src.Address)
+	return conn, nil
+}
+
+// consume Delivers the messages from a connection, acknowledging each of them once processed.
+func (src *JMSSource) consume(ctx context.Context, conn *stompConn, queue string, out chan<- *message.Message) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() { // Unblocks the reader when the subscription is cancelled
+		select {
+		case <-ctx.Done():
+			conn.conn.SetReadDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+	for {
+		frame, err := conn.read()
+		if err != nil {
+			return err
+		}
+		if frame.command != "MESSAGE" {
+			return stompError(frame)
+		}
+		jmsMessages.WithLabelValues(queue).Inc()
+		payload, err := proto.Marshal(&sink.SinkMessage{
+			MessageId:   frame.headers["message-id"],
+			Content:     frame.body,
+			TotalChunks: 1,
+		})
+		if err != nil {
+			return fmt.Errorf("cannot encode message %s: %v", frame.headers["message-id"], err)
+		}
+		msg := message.NewMessage(watermill.NewUUID(), payload)
+		if ms, err := strconv.ParseInt(frame.headers["timestamp"], 10, 64); err == nil { // Set by the JMS producer
+			msg.SetContext(WithRecordMetadata(msg.Context(), RecordMetadata{Partition: -1, Offset: -1, Timestamp: time.Unix(0, ms*int64(time.Millisecond))}))
+		}
+		select {
+		case out <- msg:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		command := "ACK"
+		select {
+		case <-msg.Acked():
+		case <-msg.Nacked():
+			command = "NACK"
+		case <-ctx.Done():
+			return ctx.Err() // Unacknowledged messages are redelivered by the broker
+		}
+		if err := conn.send(command, map[string]string{"id": frame.headers["ack"]}); err != nil {
+			return err
+		}
+	}
+}
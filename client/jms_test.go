@@ -0,0 +1,97 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestJMSSource(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer listener.Close()
+	frames := make(chan *stompFrame, 10)
+	go fakeStompBroker(listener, frames)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	src := &JMSSource{Address: listener.Addr().String(), Username: "admin", Password: "admin", ReconnectDelay: 10 * time.Millisecond}
+	assert.ErrorContains(t, (&JMSSource{}).Validate(), "address is required")
+	assert.NilError(t, src.Validate())
+	cli := &KafkaClient{Topic: "JMS.Sink.Heartbeat", GroupID: "jms-source-test", Parser: "heartbeat", Source: src}
+	assert.NilError(t, cli.Initialize(ctx))
+	received := make(chan DecodedMessage, 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cli.Handle(func(msg DecodedMessage) error {
+			received <- msg
+			return nil
+		})
+	}()
+
+	// Each connection receives one message, and the broker disconnects after the acknowledgement
+	for i := 1; i <= 2; i++ {
+		expectStompFrame(t, frames, "CONNECT", "login", "admin")
+		expectStompFrame(t, frames, "SUBSCRIBE", "destination", "/queue/JMS.Sink.Heartbeat")
+		select {
+		case msg := <-received:
+			assert.Equal(t, "JMS.Sink.Heartbeat", msg.Topic)
+			assert.Equal(t, fmt.Sprintf("Minion-%d", i), string(msg.Payload))
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for message")
+		}
+		expectStompFrame(t, frames, "ACK", "id", fmt.Sprintf("ack-%d", i))
+	}
+
+	cli.Stop()
+	<-done
+}
+
+// fakeStompBroker Sends a message to each subscription, closing the connection once acknowledged.
+func fakeStompBroker(listener net.Listener, frames chan<- *stompFrame) {
+	for i := 1; ; i++ {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		sc := &stompConn{conn: conn, reader: bufio.NewReader(conn), writer: bufio.NewWriter(conn)}
+		for {
+			frame, err := sc.read()
+			if err != nil {
+				break
+			}
+			frames <- frame
+			switch frame.command {
+			case "CONNECT":
+				sc.send("CONNECTED", map[string]string{"version": "1.2"})
+			case "SUBSCRIBE":
+				body := fmt.Sprintf("Minion-%d", i)
+				fmt.Fprintf(sc.writer, "MESSAGE\nmessage-id:ID\\c%d\nack:ack-%d\ncontent-length:%d\n\n%s\x00\n", i, i, len(body), body)
+				sc.writer.Flush()
+			}
+			if frame.command == "ACK" {
+				break
+			}
+		}
+		conn.Close()
+	}
+}
+
+// expectStompFrame Verifies the command and a header of the next frame received by the broker.
+func expectStompFrame(t *testing.T, frames <-chan *stompFrame, command, header, value string) {
+	select {
+	case frame := <-frames:
+		assert.Equal(t, command, frame.command)
+		assert.Equal(t, value, frame.headers[header])
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for %s frame", command)
+	}
+}
@@ -0,0 +1,194 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// DefaultKeyStatsMaxSeries is the default number of Minions tracked individually by KeyStats.
+const DefaultKeyStatsMaxSeries = 100
+
+// keyMessages tracks the Sink messages by the system ID of their key and partition.
+var keyMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "onms_ipc_key_messages_total",
+	Help: "The total number of Sink messages by the system ID of their Kafka key and partition",
+}, []string{"system_id", "topic", "partition"})
+
+// SinkKey represents the Kafka key of a Sink message, as system-id/message-id.
+type SinkKey struct {
+	SystemID  string `json:"systemId,omitempty"` // The ID of the Minion that sent the message, empty when the key doesn't have it.
+	MessageID string `json:"messageId"`
+}
+
+// DecodeSinkKey Parses the Kafka key of a Sink message; a key without a slash is considered a plain message ID.
+func DecodeSinkKey(key []byte) SinkKey {
+	value := string(key)
+	if idx := strings.Index(value, "/"); idx >= 0 {
+		return SinkKey{SystemID: value[:idx], MessageID: value[idx+1:]}
+	}
+	return SinkKey{MessageID: value}
+}
+
+// KeyStat represents the messages received with the keys of a given Minion.
+type KeyStat struct {
+	SystemID   string           `json:"systemId"` // Empty for the keys without a system ID.
+	Messages   int64            `json:"messages"`
+	Bytes      int64            `json:"bytes"`
+	Partitions map[string]int64 `json:"partitions"` // The messages by topic/partition.
+	LastSeen   time.Time        `json:"lastSeen"`
+}
+
+// PartitionStat represents the messages received from a partition, and the Minion locations that produced them.
+type PartitionStat struct {
+	TopicPartition
+	Messages  int64            `json:"messages"`
+	Share     float64          `json:"share"`     // The fraction of the messages of the topic received from this partition.
+	Locations map[string]int64 `json:"locations"` // The messages by Minion location.
+}
+
+// KeyReport contains the statistics by Minion and by partition, to find unbalanced keys.
+type KeyReport struct {
+	Keys       []KeyStat           `json:"keys"`       // Sorted by messages, the busiest first.
+	Partitions []PartitionStat     `json:"partitions"` // Sorted by topic and partition.
+	Locations  map[string][]string `json:"locations"`  // The topic/partition pairs that received messages from each location.
+}
+
+// partitionEntry tracks the messages received from a partition.
+type partitionEntry struct {
+	messages  int64
+	locations map[string]int64
+}
+
+// KeyStats is an output that decodes the Kafka key of the Sink messages, and tracks the messages by Minion (the system ID of the key)
+// and the partitions that receive the messages of each location, as the key determines the partition of each record.
+// To cap the cardinality, only the first MaxSeries Minions are tracked individually, and the rest are aggregated as "other".
+// This is a concurrent safe object.
+type KeyStats struct {
+	MaxSeries int // The maximum number of Minions tracked individually.
+
+	mutex      sync.Mutex
+	keys       map[string]*KeyStat
+	partitions map[TopicPartition]*partitionEntry
+}
+
+// NewKeyStats creates a new key statistics tracker.
+func NewKeyStats(maxSeries int) *KeyStats {
+	return &KeyStats{
+		MaxSeries:  maxSeries,
+		keys:       make(map[string]*KeyStat),
+		partitions: make(map[TopicPartition]*partitionEntry),
+	}
+}
+
+// Name Returns the name of the output.
+func (s *KeyStats) Name() string {
+	return "keystats"
+}
+
+// Send Tracks a decoded message; it never fails.
+func (s *KeyStats) Send(ctx context.Context, msg DecodedMessage) error {
+	s.record(msg, time.Now())
+	return nil
+}
+
+func (s *KeyStats) record(msg DecodedMessage, now time.Time) {
+	systemID := DecodeSinkKey(msg.Key).SystemID
+	tp := TopicPartition{msg.Topic, msg.Partition}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stat, ok := s.keys[systemID]
+	if !ok {
+		if s.MaxSeries > 0 && len(s.keys) >= s.MaxSeries {
+			systemID = otherLabel
+			stat = s.keys[systemID]
+		}
+		if stat == nil {
+			stat = &KeyStat{SystemID: systemID, Partitions: make(map[string]int64)}
+			s.keys[systemID] = stat
+		}
+	}
+	stat.Messages++
+	stat.Bytes += int64(len(msg.Payload))
+	stat.Partitions[tp.String()]++
+	stat.LastSeen = now
+	entry, ok := s.partitions[tp]
+	if !ok {
+		entry = &partitionEntry{locations: make(map[string]int64)}
+		s.partitions[tp] = entry
+	}
+	entry.messages++
+	entry.locations[msg.Metadata.Location]++
+	keyMessages.WithLabelValues(systemID, tp.Topic, strconv.Itoa(int(tp.Partition))).Inc()
+}
+
+// Report Returns the statistics by Minion and by partition.
+func (s *KeyStats) Report() KeyReport {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	report := KeyReport{
+		Keys:       make([]KeyStat, 0, len(s.keys)),
+		Partitions: make([]PartitionStat, 0, len(s.partitions)),
+		Locations:  make(map[string][]string),
+	}
+	for _, stat := range s.keys {
+		copied := *stat
+		copied.Partitions = make(map[string]int64, len(stat.Partitions))
+		for tp, count := range stat.Partitions {
+			copied.Partitions[tp] = count
+		}
+		report.Keys = append(report.Keys, copied)
+	}
+	sort.Slice(report.Keys, func(i, j int) bool {
+		if report.Keys[i].Messages == report.Keys[j].Messages {
+			return report.Keys[i].SystemID < report.Keys[j].SystemID
+		}
+		return report.Keys[i].Messages > report.Keys[j].Messages
+	})
+	topics := make(map[string]int64)
+	for tp, entry := range s.partitions {
+		topics[tp.Topic] += entry.messages
+	}
+	for tp, entry := range s.partitions {
+		stat := PartitionStat{
+			TopicPartition: tp,
+			Messages:       entry.messages,
+			Share:          float64(entry.messages) / float64(topics[tp.Topic]),
+			Locations:      make(map[string]int64, len(entry.locations)),
+		}
+		for location, count := range entry.locations {
+			stat.Locations[location] = count
+		}
+		report.Partitions = append(report.Partitions, stat)
+	}
+	sort.Slice(report.Partitions, func(i, j int) bool {
+		if report.Partitions[i].Topic == report.Partitions[j].Topic {
+			return report.Partitions[i].Partition < report.Partitions[j].Partition
+		}
+		return report.Partitions[i].Topic < report.Partitions[j].Topic
+	})
+	for _, stat := range report.Partitions {
+		for location := range stat.Locations {
+			report.Locations[location] = append(report.Locations[location], stat.TopicPartition.String())
+		}
+	}
+	return report
+}
+
+// Handler Returns an HTTP handler that exposes the key statistics and the partition report in JSON.
+func (s *KeyStats) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.Report())
+	})
+}
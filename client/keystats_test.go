@@ -0,0 +1,49 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestDecodeSinkKey(t *testing.T) {
+	assert.Equal(t, SinkKey{SystemID: "minion-01", MessageID: "0001"}, DecodeSinkKey([]byte("minion-01/0001")))
+	assert.Equal(t, SinkKey{MessageID: "0001"}, DecodeSinkKey([]byte("0001")))
+	assert.Equal(t, SinkKey{}, DecodeSinkKey(nil))
+}
+
+func TestKeyStats(t *testing.T) {
+	stats := NewKeyStats(2)
+	now := time.Now()
+	send := func(key, location string, partition int32) {
+		stats.record(DecodedMessage{Topic: "Traps", Partition: partition, Key: []byte(key), Metadata: Metadata{Location: location}, Payload: []byte("ABC")}, now)
+	}
+	send("minion-01/0001", "Apex", 0)
+	send("minion-01/0002", "Apex", 0)
+	send("minion-01/0003", "Apex", 0)
+	send("minion-02/0004", "Durham", 1)
+	send("minion-03/0005", "Apex", 1) // Over the cap
+
+	report := stats.Report()
+	assert.Equal(t, 3, len(report.Keys))
+	assert.Equal(t, "minion-01", report.Keys[0].SystemID)
+	assert.Equal(t, int64(3), report.Keys[0].Messages)
+	assert.Equal(t, int64(9), report.Keys[0].Bytes)
+	assert.DeepEqual(t, map[string]int64{"Traps/0": 3}, report.Keys[0].Partitions)
+	assert.Equal(t, otherLabel, report.Keys[2].SystemID)
+
+	assert.Equal(t, 2, len(report.Partitions))
+	assert.Equal(t, int32(0), report.Partitions[0].Partition)
+	assert.Equal(t, 0.6, report.Partitions[0].Share)
+	assert.DeepEqual(t, map[string]int64{"Durham": 1, "Apex": 1}, report.Partitions[1].Locations)
+	assert.DeepEqual(t, map[string][]string{"Apex": {"Traps/0", "Traps/1"}, "Durham": {"Traps/1"}}, report.Locations)
+
+	rec := httptest.NewRecorder()
+	stats.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/key-stats", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
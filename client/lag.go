@@ -0,0 +1,185 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// consumerLag tracks how far behind each partition is the consumer group.
+	consumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "onms_ipc_consumer_lag",
+		Help: "The number of messages the consumer group is behind the high watermark, by topic and partition",
+	}, []string{"group", "topic", "partition"})
+	// consumerLagExceeded flags when the consumer group falls behind too much, to simplify the alerting rules.
+	consumerLagExceeded = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "onms_ipc_consumer_lag_exceeded",
+		Help: "Whether or not the lag of any partition exceeds the maximum lag",
+	}, []string{"group"})
+)
+
+// offsetReader retrieves the partitions and the high watermarks of the topics; implemented by sarama.Client.
+type offsetReader interface {
+	Partitions(topic string) ([]int32, error)
+	GetOffset(topic string, partition int32, time int64) (int64, error)
+}
+
+// offsetLister retrieves the offsets committed by a consumer group; implemented by sarama.ClusterAdmin.
+type offsetLister interface {
+	ListConsumerGroupOffsets(group string, topicPartitions map[string][]int32) (*sarama.OffsetFetchResponse, error)
+}
+
+// ConsumerLag Returns the lag of each partition from the last refresh, or nil when it was not measured yet.
+// This is a concurrent safe method.
+func (cli *KafkaClient) ConsumerLag() map[TopicPartition]int64 {
+	if cli.mutex == nil {
+		return nil
+	}
+	cli.mutex.RLock()
+	defer cli.mutex.RUnlock()
+	if cli.lag == nil {
+		return nil
+	}
+	lag := make(map[TopicPartition]int64, len(cli.lag))
+	for tp, value := range cli.lag {
+		lag[tp] = value
+	}
+	return lag
+}
+
+// measureLag Calculates the lag of each partition of the topics of the client, as the difference between the high watermark and the committed offset.
+// The partitions without a committed offset are ignored.
+func (cli *KafkaClient) measureLag(offsets offsetReader, lister offsetLister) (map[TopicPartition]int64, error) {
+	topics := make(map[string][]int32)
+	for _, tc := range cli.Topics() {
+		partitions, err := offsets.Partitions(tc.Name)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get the partitions of %s: %v", tc.Name, err)
+		}
+		topics[tc.Name] = partitions
+	}
+	committed, err := lister.ListConsumerGroupOffsets(cli.GroupID, topics)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get the offsets of group %s: %v", cli.GroupID, err)
+	}
+	lag := make(map[TopicPartition]int64)
+	for topic, partitions := range topics {
+		for _, partition := range partitions {
+			block := committed.GetBlock(topic, partition)
+			if block == nil || block.Offset < 0 {
+				continue
+			}
+			high, err := offsets.GetOffset(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				return nil, fmt.Errorf("cannot get the high watermark of partition %d of %s: %v", partition, topic, err)
+			}
+			value := high - block.Offset
+			if value < 0 { // The high watermark is cached for a while
+				value = 0
+			}
+			lag[TopicPartition{Topic: topic, Partition: partition}] = value
+		}
+	}
+	return lag, nil
+}
+
+// updateLag Publishes the lag of each partition, and returns the partitions that exceed the maximum lag, sorted by topic and partition.
+func (cli *KafkaClient) updateLag(lag map[TopicPartition]int64) []TopicPartition {
+	var exceeded []TopicPartition
+	for tp, value := range lag {
+		consumerLag.WithLabelValues(cli.GroupID, tp.Topic, strconv.Itoa(int(tp.Partition))).Set(float64(value))
+		if cli.MaxLag > 0 && value > cli.MaxLag {
+			exceeded = append(exceeded, tp)
+		}
+	}
+	if len(exceeded) > 0 {
+		consumerLagExceeded.WithLabelValues(cli.GroupID).Set(1)
+	} else {
+		consumerLagExceeded.WithLabelValues(cli.GroupID).Set(0)
+	}
+	sort.Slice(exceeded, func(i, j int) bool {
+		if exceeded[i].Topic != exceeded[j].Topic {
+			return exceeded[i].Topic < exceeded[j].Topic
+		}
+		return exceeded[i].Partition < exceeded[j].Partition
+	})
+	cli.mutex.Lock()
+	cli.lag = lag
+	cli.mutex.Unlock()
+	return exceeded
+}
+
+// runLagMonitor Refreshes the consumer lag periodically, until the done channel is closed.
+// It does nothing when the lag interval is not defined, or when the messages are not consumed from Kafka.
+// A warning is logged when the partitions start exceeding the maximum lag, and when they recover.
+func (cli *KafkaClient) runLagMonitor(done <-chan struct{}) {
+	if cli.LagInterval <= 0 || cli.Source != nil {
+		return
+	}
+	var admin sarama.ClusterAdmin
+	var client sarama.Client
+	defer func() {
+		if admin != nil {
+			admin.Close() // Closes the client too
+		}
+	}()
+	behind := false
+	ticker := time.NewTicker(cli.LagInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+		if admin == nil {
+			var err error
+			if client, admin, err = cli.createAdmin(); err != nil {
+				cli.logger().Warnf("cannot measure consumer lag: %v", err)
+				continue
+			}
+		}
+		lag, err := cli.measureLag(client, admin)
+		if err != nil {
+			cli.logger().Warnf("cannot measure consumer lag: %v", err)
+			admin.Close() // Reconnects on the next attempt
+			admin = nil
+			continue
+		}
+		exceeded := cli.updateLag(lag)
+		if len(exceeded) > 0 && !behind {
+			for _, tp := range exceeded {
+				cli.logger().Warnf("partition %d of %s is %d messages behind, exceeding the maximum lag of %d", tp.Partition, tp.Topic, lag[tp], cli.MaxLag)
+			}
+		} else if len(exceeded) == 0 && behind {
+			cli.logger().Infof("the lag of group %s is back under %d messages", cli.GroupID, cli.MaxLag)
+		}
+		behind = len(exceeded) > 0
+	}
+}
+
+// createAdmin Connects to Kafka to retrieve the offsets of the consumer group.
+func (cli *KafkaClient) createAdmin() (sarama.Client, sarama.ClusterAdmin, error) {
+	config, err := cli.createConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := sarama.NewClient([]string{cli.Bootstrap}, config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot connect to %s: %v", cli.Bootstrap, err)
+	}
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, nil, fmt.Errorf("cannot create cluster admin: %v", err)
+	}
+	return client, admin, nil
+}
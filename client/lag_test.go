@@ -0,0 +1,92 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gotest.tools/v3/assert"
+)
+
+// fakeOffsets simulates the offsets of the topics and the consumer group.
+type fakeOffsets struct {
+	high      map[TopicPartition]int64
+	committed map[TopicPartition]int64
+}
+
+func (f *fakeOffsets) Partitions(topic string) ([]int32, error) {
+	if topic == "Unknown" {
+		return nil, fmt.Errorf("unknown topic")
+	}
+	return []int32{0, 1, 2}, nil
+}
+
+func (f *fakeOffsets) GetOffset(topic string, partition int32, time int64) (int64, error) {
+	return f.high[TopicPartition{Topic: topic, Partition: partition}], nil
+}
+
+func (f *fakeOffsets) ListConsumerGroupOffsets(group string, topicPartitions map[string][]int32) (*sarama.OffsetFetchResponse, error) {
+	response := &sarama.OffsetFetchResponse{}
+	for topic, partitions := range topicPartitions {
+		for _, partition := range partitions {
+			offset, ok := f.committed[TopicPartition{Topic: topic, Partition: partition}]
+			if !ok {
+				offset = -1
+			}
+			response.AddBlock(topic, partition, &sarama.OffsetFetchResponseBlock{Offset: offset})
+		}
+	}
+	return response, nil
+}
+
+func TestConsumerLag(t *testing.T) {
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	cli.GroupID = "lag-test"
+	cli.Topic = "Trap,Syslog"
+	cli.MaxLag = 100
+	assert.Assert(t, cli.ConsumerLag() == nil)
+
+	offsets := &fakeOffsets{
+		high: map[TopicPartition]int64{
+			{Topic: "Trap", Partition: 0}:   500,
+			{Topic: "Trap", Partition: 1}:   100,
+			{Topic: "Syslog", Partition: 0}: 1000,
+			{Topic: "Syslog", Partition: 1}: 10,
+		},
+		committed: map[TopicPartition]int64{
+			{Topic: "Trap", Partition: 0}:   450,
+			{Topic: "Trap", Partition: 1}:   100,
+			{Topic: "Syslog", Partition: 0}: 200,
+			{Topic: "Syslog", Partition: 1}: 20, // Stale high watermark
+		},
+	}
+	lag, err := cli.measureLag(offsets, offsets)
+	assert.NilError(t, err)
+	expected := map[TopicPartition]int64{
+		{Topic: "Trap", Partition: 0}:   50,
+		{Topic: "Trap", Partition: 1}:   0,
+		{Topic: "Syslog", Partition: 0}: 800,
+		{Topic: "Syslog", Partition: 1}: 0,
+	}
+	assert.DeepEqual(t, expected, lag)
+
+	assert.DeepEqual(t, []TopicPartition{{Topic: "Syslog", Partition: 0}}, cli.updateLag(lag))
+	assert.DeepEqual(t, expected, cli.ConsumerLag())
+	assert.Equal(t, float64(800), testutil.ToFloat64(consumerLag.WithLabelValues("lag-test", "Syslog", "0")))
+	assert.Equal(t, float64(50), testutil.ToFloat64(consumerLag.WithLabelValues("lag-test", "Trap", "0")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(consumerLagExceeded.WithLabelValues("lag-test")))
+
+	offsets.committed[TopicPartition{Topic: "Syslog", Partition: 0}] = 1000
+	lag, err = cli.measureLag(offsets, offsets)
+	assert.NilError(t, err)
+	assert.Equal(t, 0, len(cli.updateLag(lag)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(consumerLagExceeded.WithLabelValues("lag-test")))
+
+	cli.Topic = "Unknown"
+	_, err = cli.measureLag(offsets, offsets)
+	assert.ErrorContains(t, err, "cannot get the partitions of Unknown")
+}
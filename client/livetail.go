@@ -0,0 +1,133 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/stream"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Default live tail settings
+const (
+	DefaultLiveTailBufferSize = 100
+	liveTailWriteTimeout      = 10 * time.Second
+	liveTailPingInterval      = 30 * time.Second
+)
+
+var (
+	// liveTailClients tracks the connected clients of the live tail endpoint.
+	liveTailClients = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "onms_ipc_live_tail_clients",
+		Help: "The number of clients connected to the live tail WebSocket endpoint",
+	})
+	// liveTailDropped tracks the messages not delivered to slow clients of the live tail endpoint.
+	liveTailDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "onms_ipc_live_tail_dropped_messages_total",
+		Help: "The total number of messages dropped because the buffer of a client of the live tail WebSocket endpoint was full",
+	})
+)
+
+// LiveTail pushes the decoded messages in real time to the clients connected through WebSockets, for interactive debugging from a browser.
+// Each message is sent as a JSON text frame, using the same envelope as the ForwardOutput with the json format.
+// Clients choose which messages to receive through the query parameters of the request; when the buffer of a slow client is full,
+// its messages are dropped instead of blocking the consumer.
+type LiveTail struct {
+	BufferSize int // The number of messages buffered for each client (defaults to DefaultLiveTailBufferSize).
+
+	hub      *messageHub
+	upgrader websocket.Upgrader // Rejects cross-origin requests from browsers
+}
+
+// NewLiveTail Creates a live tail with a given buffer size per client.
+func NewLiveTail(bufferSize int) *LiveTail {
+	if bufferSize <= 0 {
+		bufferSize = DefaultLiveTailBufferSize
+	}
+	return &LiveTail{
+		BufferSize: bufferSize,
+		hub:        newMessageHub(liveTailClients, liveTailDropped),
+	}
+}
+
+// Name Returns the name of the output.
+func (lt *LiveTail) Name() string {
+	return "livetail"
+}
+
+// Send Queues a decoded message for each client whose filter it satisfies.
+// It never blocks nor fails; the messages for the clients with a full buffer are dropped.
+func (lt *LiveTail) Send(ctx context.Context, msg DecodedMessage) error {
+	lt.hub.publish(msg)
+	return nil
+}
+
+// Handler Returns the WebSocket endpoint.
+// The query parameters parser, topic, location (which can be repeated), source (an IP address or CIDR),
+// and header (Kafka header rules as key=value, which can be repeated) restrict the messages sent to the client.
+func (lt *LiveTail) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		filter, err := newStreamFilter(&stream.Filter{
+			Topics:    query["topic"],
+			Parsers:   query["parser"],
+			Locations: query["location"],
+			Source:    query.Get("source"),
+			Headers:   query["header"],
+		})
+		if err != nil {
+			http.Error(w, "invalid filter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		conn, err := lt.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return // The upgrader already replied with an error
+		}
+		defer conn.Close()
+		sub := lt.hub.subscribe(filter, lt.BufferSize)
+		defer lt.hub.unsubscribe(sub)
+		lt.serve(conn, sub)
+	})
+}
+
+// serve Writes the messages to a client, until it disconnects.
+// The connection is kept alive through pings, and the messages from the client are discarded.
+func (lt *LiveTail) serve(conn *websocket.Conn, sub *hubSubscriber) {
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	ticker := time.NewTicker(liveTailPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg := <-sub.messages:
+			data, err := json.Marshal(newForwardEnvelope(msg))
+			if err != nil {
+				defaultLogger.Errorf("cannot encode message %s: %v", msg.Coordinates(), err)
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(liveTailWriteTimeout))
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(liveTailWriteTimeout)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
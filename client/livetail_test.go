@@ -0,0 +1,47 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"gotest.tools/v3/assert"
+)
+
+func TestLiveTail(t *testing.T) {
+	lt := NewLiveTail(10)
+	server := httptest.NewServer(lt.Handler())
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	_, res, err := websocket.DefaultDialer.Dial(url+"?source=invalid", nil)
+	assert.ErrorContains(t, err, "bad handshake")
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?parser=snmp&source=10.0.0.0/8", nil)
+	assert.NilError(t, err)
+	defer conn.Close()
+	waitFor(t, func() bool { return lt.hub.count() == 1 })
+
+	for _, msg := range []DecodedMessage{
+		{Topic: "Test", Parser: "syslog", Metadata: Metadata{SourceAddress: "10.0.0.1"}, Payload: []byte(`{"id":1}`)},
+		{Topic: "Test", Parser: "snmp", Metadata: Metadata{SourceAddress: "192.168.0.1"}, Payload: []byte(`{"id":2}`)},
+		{Topic: "Test", Parser: "Snmp", Offset: 42, Metadata: Metadata{SourceAddress: "10.0.0.3"}, Payload: []byte(`{"id":3}`)},
+	} {
+		assert.NilError(t, lt.Send(context.Background(), msg))
+	}
+	envelope := map[string]interface{}{}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	assert.NilError(t, conn.ReadJSON(&envelope))
+	assert.Equal(t, float64(42), envelope["offset"])
+	assert.DeepEqual(t, map[string]interface{}{"id": float64(3)}, envelope["payload"])
+
+	conn.Close()
+	waitFor(t, func() bool { return lt.hub.count() == 0 })
+}
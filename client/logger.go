@@ -0,0 +1,145 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLevel represents the severity of a log message.
+type LogLevel int
+
+// Log levels
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// logLevelNames contains the names of the log levels, as used on the log messages.
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+func (l LogLevel) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return logLevelNames[l]
+}
+
+// ParseLogLevel Parses a log level from its name: debug, info, warn or error.
+func ParseLogLevel(name string) (LogLevel, error) {
+	for i, n := range logLevelNames {
+		if strings.EqualFold(n, name) || (n == "warn" && strings.EqualFold(name, "warning")) {
+			return LogLevel(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("invalid log level %s; expecting %s", name, strings.Join(logLevelNames, ", "))
+}
+
+// Logger defines the methods used by the client to log messages, so applications embedding it can provide their own implementation.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// StdLogger is the default logger, which writes the messages with a minimum level as text, or as JSON objects.
+// This is a concurrent safe object.
+type StdLogger struct {
+	Level LogLevel // The minimum level of the messages to write.
+	JSON  bool     // Write the messages as JSON objects with time, level and msg.
+
+	mutex  sync.Mutex
+	output io.Writer
+	text   *log.Logger
+}
+
+// NewLogger creates a new logger that writes to the given output.
+func NewLogger(output io.Writer, level LogLevel, json bool) *StdLogger {
+	return &StdLogger{Level: level, JSON: json, output: output, text: log.New(output, "", log.LstdFlags)}
+}
+
+// write Logs a message when its level is enabled.
+func (l *StdLogger) write(level LogLevel, format string, args []interface{}) {
+	if level < l.level() {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	if !l.JSON {
+		l.text.Printf("[%s] %s", level, msg)
+		return
+	}
+	data, _ := json.Marshal(map[string]string{
+		"time":  time.Now().Format(time.RFC3339Nano),
+		"level": level.String(),
+		"msg":   msg,
+	})
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.output.Write(append(data, '\n'))
+}
+
+// SetLevel Changes the minimum level of the messages to write while the logger is in use.
+func (l *StdLogger) SetLevel(level LogLevel) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.Level = level
+}
+
+// level Returns the minimum level of the messages to write.
+func (l *StdLogger) level() LogLevel {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.Level
+}
+
+// Debugf Logs a debug message.
+func (l *StdLogger) Debugf(format string, args ...interface{}) {
+	l.write(LevelDebug, format, args)
+}
+
+// Infof Logs an informational message.
+func (l *StdLogger) Infof(format string, args ...interface{}) {
+	l.write(LevelInfo, format, args)
+}
+
+// Warnf Logs a warning.
+func (l *StdLogger) Warnf(format string, args ...interface{}) {
+	l.write(LevelWarn, format, args)
+}
+
+// Errorf Logs an error.
+func (l *StdLogger) Errorf(format string, args ...interface{}) {
+	l.write(LevelError, format, args)
+}
+
+// defaultLogger is used by the clients without a logger, and by the rest of the package.
+var defaultLogger Logger = NewLogger(os.Stderr, LevelInfo, false)
+
+// SetLogger Replaces the default logger.
+// It should be called before creating any client, as it is not concurrent safe.
+func SetLogger(logger Logger) {
+	defaultLogger = logger
+}
+
+// DefaultLogger Returns the default logger.
+func DefaultLogger() Logger {
+	return defaultLogger
+}
+
+// logger Returns the logger of the client, or the default one.
+func (cli *KafkaClient) logger() Logger {
+	if cli.Logger != nil {
+		return cli.Logger
+	}
+	return defaultLogger
+}
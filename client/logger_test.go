@@ -0,0 +1,42 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestLogger(t *testing.T) {
+	level, err := ParseLogLevel("WARNING")
+	assert.NilError(t, err)
+	assert.Equal(t, LevelWarn, level)
+	_, err = ParseLogLevel("trace")
+	assert.ErrorContains(t, err, "invalid log level")
+
+	out := &bytes.Buffer{}
+	logger := NewLogger(out, LevelWarn, false)
+	logger.Infof("ignored")
+	logger.Warnf("chunk %d ignored", 1)
+	assert.Assert(t, strings.HasSuffix(out.String(), "[warn] chunk 1 ignored\n"), out.String())
+	logger.SetLevel(LevelInfo)
+	logger.Infof("not ignored")
+	assert.Assert(t, strings.HasSuffix(out.String(), "[info] not ignored\n"), out.String())
+
+	out.Reset()
+	logger = NewLogger(out, LevelDebug, true)
+	logger.Debugf("telemetry message from %s", "10.0.0.1")
+	entry := map[string]string{}
+	assert.NilError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, "debug", entry["level"])
+	assert.Equal(t, "telemetry message from 10.0.0.1", entry["msg"])
+
+	cli := &KafkaClient{}
+	assert.Equal(t, DefaultLogger(), cli.logger())
+	cli.Logger = logger
+	assert.Equal(t, Logger(logger), cli.logger())
+}
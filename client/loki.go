@@ -0,0 +1,303 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Default Loki output settings
+const (
+	DefaultLokiBatchSize     = 1000
+	DefaultLokiFlushInterval = time.Second
+	DefaultLokiMaxRetries    = 3
+	DefaultLokiRetryDelay    = time.Second
+)
+
+// lokiEntries tracks the final result of the log entries pushed to Loki.
+var lokiEntries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "onms_ipc_loki_entries_total",
+	Help: "The total number of log entries pushed to Loki by destination and result (success or failure), after the retries",
+}, []string{"destination", "result"})
+
+// LokiOutput pushes the decoded Syslog messages to Grafana Loki, for log search without Elasticsearch.
+// Each Syslog message is a log entry with its original content, timestamped from its header (or the reception time of the Minion),
+// and labeled by location, hostname (the address of the exporter when the message has no host name), facility and severity,
+// plus the static labels. The entries are pushed in batches through the HTTP API; the failures are retried with an exponential backoff,
+// and the batches that can't be pushed are dropped, as the messages were already acknowledged. Messages from other parsers are ignored.
+// This is a concurrent safe object.
+type LokiOutput struct {
+	URL           string        // The base URL of Loki, i.e. http://loki:3100.
+	TenantID      string        // The tenant, sent as X-Scope-OrgID for multi-tenant deployments (optional).
+	Username      string        // The user for basic authentication (optional).
+	Password      string        `json:"-"` // The password for basic authentication, or the bearer token without user; accepts secret references (optional).
+	Labels        Properties    // Static labels added to all the entries, i.e. job=syslog (optional).
+	BatchSize     int           // The maximum number of entries pushed at once (defaults to DefaultLokiBatchSize).
+	FlushInterval time.Duration // How often the pending entries are pushed (defaults to DefaultLokiFlushInterval).
+	MaxRetries    int           // How many times a failed push is retried (defaults to DefaultLokiMaxRetries).
+	RetryDelay    time.Duration // The delay before the first retry, doubled on each attempt (defaults to DefaultLokiRetryDelay).
+	Client        *http.Client  `json:"-"` // The HTTP client (optional).
+
+	mutex   sync.Mutex
+	entries []lokiEntry
+	pushURL string
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// lokiEntry represents a log entry with the labels of its stream.
+type lokiEntry struct {
+	labels    map[string]string
+	timestamp time.Time
+	line      string
+}
+
+// lokiStream represents a stream of the push API, with the entries as pairs of timestamp in nanoseconds and line.
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// Validate Verifies the Loki output settings, applying defaults when necessary, and starts the periodic pushes.
+func (out *LokiOutput) Validate() error {
+	if out.URL == "" {
+		return fmt.Errorf("the Loki URL is required")
+	}
+	for label := range out.Labels {
+		if !lokiLabelName(label) {
+			return fmt.Errorf("invalid label name %s", label)
+		}
+	}
+	out.pushURL = strings.TrimSuffix(out.URL, "/") + "/loki/api/v1/push"
+	if out.BatchSize <= 0 {
+		out.BatchSize = DefaultLokiBatchSize
+	}
+	if out.FlushInterval <= 0 {
+		out.FlushInterval = DefaultLokiFlushInterval
+	}
+	if out.MaxRetries <= 0 {
+		out.MaxRetries = DefaultLokiMaxRetries
+	}
+	if out.RetryDelay <= 0 {
+		out.RetryDelay = DefaultLokiRetryDelay
+	}
+	if out.stop == nil {
+		out.stop = make(chan struct{})
+		out.wg.Add(1)
+		go out.flusher()
+	}
+	return nil
+}
+
+// Name Returns the name of the output.
+func (out *LokiOutput) Name() string {
+	return "loki:" + out.URL
+}
+
+// Send Converts the Syslog messages of a decoded message into log entries, pushing the pending entries in the background when the batch is full.
+// Messages from other parsers are ignored.
+func (out *LokiOutput) Send(ctx context.Context, msg DecodedMessage) error {
+	if !isSyslog(msg.Parser) {
+		return nil
+	}
+	log := &syslogLog{}
+	if err := json.Unmarshal(msg.Payload, log); err != nil {
+		return fmt.Errorf("invalid syslog message: %v", err)
+	}
+	entries := make([]lokiEntry, 0, len(log.Messages))
+	for _, m := range log.Messages {
+		entries = append(entries, out.entry(m.Content, m.Timestamp, log.SourceAddress, msg.Metadata.Location))
+	}
+	out.mutex.Lock()
+	out.entries = append(out.entries, entries...)
+	var batch []lokiEntry
+	if len(out.entries) >= out.BatchSize {
+		batch = out.entries
+		out.entries = nil
+	}
+	out.mutex.Unlock()
+	if batch != nil {
+		out.wg.Add(1)
+		go func() {
+			defer out.wg.Done()
+			out.push(batch)
+		}()
+	}
+	return nil
+}
+
+// Close Stops the periodic pushes, pushing the pending entries.
+func (out *LokiOutput) Close() error {
+	if out.stop == nil {
+		return nil
+	}
+	close(out.stop)
+	out.wg.Wait()
+	out.stop = nil
+	return nil
+}
+
+// entry Builds the log entry of a Syslog message, with its labels.
+func (out *LokiOutput) entry(content, received, source, location string) lokiEntry {
+	labels := make(map[string]string, len(out.Labels)+4)
+	for key, value := range out.Labels {
+		labels[key] = value
+	}
+	fields, ok := ParseSyslog(content)
+	if !ok {
+		fields = &SyslogFields{Priority: syslogDefaultPriority, Facility: syslogDefaultPriority / 8, Severity: syslogDefaultPriority % 8}
+	}
+	if host := fields.Hostname; host != "" {
+		labels["hostname"] = host
+	} else if source != "" {
+		labels["hostname"] = source
+	}
+	if location != "" {
+		labels["location"] = location
+	}
+	labels["facility"] = syslogFacilityName(fields.Facility)
+	if fields.Severity >= 0 && fields.Severity < len(syslogSeverities) {
+		labels["severity"] = syslogSeverities[fields.Severity]
+	}
+	return lokiEntry{labels: labels, timestamp: syslogTime(fields.Time, received), line: strings.TrimSpace(content)}
+}
+
+// syslogFacilityName Returns the name of a Syslog facility, or its code when unknown.
+func syslogFacilityName(code int) string {
+	for name, c := range syslogFacilities {
+		if c == code {
+			return name
+		}
+	}
+	return strconv.Itoa(code)
+}
+
+// lokiLabelName Returns true when the name is a valid Loki label name.
+func lokiLabelName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// flusher Pushes the pending entries periodically, and once more when the output is closed.
+func (out *LokiOutput) flusher() {
+	defer out.wg.Done()
+	ticker := time.NewTicker(out.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			out.flush()
+		case <-out.stop:
+			out.flush()
+			return
+		}
+	}
+}
+
+// flush Pushes the pending entries, if any.
+func (out *LokiOutput) flush() {
+	out.mutex.Lock()
+	entries := out.entries
+	out.entries = nil
+	out.mutex.Unlock()
+	if len(entries) > 0 {
+		out.push(entries)
+	}
+}
+
+// lokiStreams Groups the entries by their labels, sorting the entries of each stream by timestamp.
+func lokiStreams(entries []lokiEntry) []lokiStream {
+	sort.SliceStable(entries, func(a, b int) bool {
+		return entries[a].timestamp.Before(entries[b].timestamp)
+	})
+	var streams []lokiStream
+	index := make(map[string]int)
+	for _, e := range entries {
+		keys := make([]string, 0, len(e.labels))
+		for key := range e.labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var sb strings.Builder
+		for _, key := range keys {
+			sb.WriteString(key + "=" + strconv.Quote(e.labels[key]) + ",")
+		}
+		i, ok := index[sb.String()]
+		if !ok {
+			i = len(streams)
+			index[sb.String()] = i
+			streams = append(streams, lokiStream{Stream: e.labels})
+		}
+		streams[i].Values = append(streams[i].Values, [2]string{strconv.FormatInt(e.timestamp.UnixNano(), 10), e.line})
+	}
+	return streams
+}
+
+// push Sends a batch of entries, retrying the retryable failures with an exponential backoff.
+func (out *LokiOutput) push(entries []lokiEntry) {
+	body, err := json.Marshal(map[string][]lokiStream{"streams": lokiStreams(entries)})
+	if err != nil {
+		defaultLogger.Errorf("cannot encode %d entries for %s: %v", len(entries), out.URL, err)
+		return
+	}
+	delay := out.RetryDelay
+	for attempt := 0; ; attempt++ {
+		err := out.post(body)
+		if err == nil {
+			lokiEntries.WithLabelValues(out.URL, OutputSuccess).Add(float64(len(entries)))
+			return
+		}
+		if outputResult(err) != OutputRetryable || attempt >= out.MaxRetries {
+			lokiEntries.WithLabelValues(out.URL, "failure").Add(float64(len(entries)))
+			defaultLogger.Errorf("cannot push %d entries to %s after %d retries, dropping them: %v", len(entries), out.URL, attempt, err)
+			return
+		}
+		defaultLogger.Warnf("cannot push %d entries to %s, retrying in %s: %v", len(entries), out.URL, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// post Sends a batch of streams to the push endpoint.
+func (out *LokiOutput) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, out.pushURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if out.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", out.TenantID)
+	}
+	if out.Password != "" {
+		password, err := ResolveSecret(out.Password)
+		if err != nil {
+			return fmt.Errorf("cannot resolve Loki password: %v", err)
+		}
+		if out.Username != "" {
+			req.SetBasicAuth(out.Username, password)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+password)
+		}
+	}
+	_, err = doCloudRequest(out.Client, req)
+	return err
+}
@@ -0,0 +1,59 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestLokiOutput(t *testing.T) {
+	var mutex sync.Mutex
+	var streams []lokiStream
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/loki/api/v1/push", r.URL.Path)
+		assert.Equal(t, "acme", r.Header.Get("X-Scope-OrgID"))
+		user, password, ok := r.BasicAuth()
+		assert.Assert(t, ok && user == "admin" && password == "secret")
+		request := struct {
+			Streams []lokiStream `json:"streams"`
+		}{}
+		assert.NilError(t, json.NewDecoder(r.Body).Decode(&request))
+		mutex.Lock()
+		streams = append(streams, request.Streams...)
+		mutex.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	payload := []byte(`{"sourceAddress":"192.168.75.1","messages":[
+		{"timestamp":"2021-03-26T14:49:27.734-04:00","content":"<190>1 2021-03-26T14:49:27.000-04:00 router01 sshd 9601 LOGIN - Accepted password"},
+		{"timestamp":"2021-03-26T14:49:29.000-04:00","content":"no header"},
+		{"timestamp":"2021-03-26T14:49:28.000-04:00","content":"<13>Mar 26 14:49:28 192.168.75.1 kernel: link down"}
+	]}`)
+	out := &LokiOutput{URL: server.URL, TenantID: "acme", Username: "admin", Password: "secret", Labels: Properties{"job": "syslog"}, FlushInterval: time.Hour}
+	assert.NilError(t, out.Validate())
+	assert.Equal(t, "loki:"+server.URL, out.Name())
+	assert.NilError(t, out.Send(context.Background(), DecodedMessage{Parser: "syslog", Metadata: Metadata{Location: "Apex"}, Payload: payload}))
+	assert.NilError(t, out.Send(context.Background(), DecodedMessage{Parser: "snmp", Payload: []byte("ignored")}))
+	assert.NilError(t, out.Close())
+
+	// The messages without header and from the same host with the same priority share a stream, sorted by timestamp
+	assert.Equal(t, 2, len(streams))
+	assert.DeepEqual(t, map[string]string{"job": "syslog", "location": "Apex", "hostname": "router01", "facility": "local7", "severity": "info"}, streams[0].Stream)
+	assert.DeepEqual(t, [][2]string{{"1616784567000000000", "<190>1 2021-03-26T14:49:27.000-04:00 router01 sshd 9601 LOGIN - Accepted password"}}, streams[0].Values)
+	assert.DeepEqual(t, map[string]string{"job": "syslog", "location": "Apex", "hostname": "192.168.75.1", "facility": "user", "severity": "notice"}, streams[1].Stream)
+	assert.Equal(t, 2, len(streams[1].Values))
+	assert.Equal(t, "<13>Mar 26 14:49:28 192.168.75.1 kernel: link down", streams[1].Values[0][1])
+	assert.Equal(t, "no header", streams[1].Values[1][1])
+
+	assert.ErrorContains(t, (&LokiOutput{}).Validate(), "the Loki URL is required")
+	assert.ErrorContains(t, (&LokiOutput{URL: server.URL, Labels: Properties{"1job": "syslog"}}).Validate(), "invalid label name")
+}
@@ -0,0 +1,146 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// ReadPipelinesFile Parses a file in JSON (when its extension is .json) or YAML format with a list of pipelines under the pipelines key.
+// Each pipeline requires a name and a topic; the rest of its settings are inherited from the base client when not defined.
+func ReadPipelinesFile(path string) (PipelineConfigs, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read pipelines file: %v", err)
+	}
+	file := struct {
+		Pipelines []PipelineConfig `json:"pipelines" yaml:"pipelines"`
+	}{}
+	if err := unmarshalConfig(path, data, &file); err != nil {
+		return nil, err
+	}
+	configs := PipelineConfigs{}
+	for _, cfg := range file.Pipelines {
+		if err := configs.Add(cfg); err != nil {
+			return nil, fmt.Errorf("invalid pipelines file %s: %v", path, err)
+		}
+	}
+	return configs, nil
+}
+
+// ConsumerGroupManager runs multiple pipelines within a single process, each with its own Kafka client, topics, parser and outputs,
+// sharing the metrics server and the lifecycle, instead of running one process per topic.
+// When there is more than one pipeline, each of them uses a dedicated consumer group, so a rebalance on one doesn't affect the others.
+// The outputs, the Sampler and the deduplication stores of the base client are shared on purpose: the outputs hold the connections
+// and the batches to each destination, and the message IDs are unique across topics. A pipeline only waits for the outputs it uses,
+// which can be selected per pipeline, and OutputTimeout bounds how long a slow destination stalls them.
+type ConsumerGroupManager struct {
+	pipelines []*Pipeline
+}
+
+// NewConsumerGroupManager Creates a manager with one pipeline per configuration, whose clients inherit the settings of the base client.
+// When no pipelines are configured, a single one is created based on the base client settings.
+// The action or the handler of each pipeline must be defined before running the manager.
+func NewConsumerGroupManager(base KafkaClient, configs PipelineConfigs) (*ConsumerGroupManager, error) {
+	if len(configs) == 0 {
+		configs = PipelineConfigs{{Name: base.Parser, Topic: base.Topic, Parser: base.Parser, IPC: base.IPC}}
+	}
+	m := &ConsumerGroupManager{}
+	for _, cfg := range configs {
+		cli, err := pipelineClient(base, cfg, len(configs) > 1)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pipeline %s: %v", cfg.Name, err)
+		}
+		m.pipelines = append(m.pipelines, NewPipeline(cfg.Name, cli, nil))
+	}
+	return m, nil
+}
+
+// Pipelines Returns the managed pipelines.
+func (m *ConsumerGroupManager) Pipelines() []*Pipeline {
+	return m.pipelines
+}
+
+// Run Executes all the pipelines until the context is cancelled, or until all of them finished.
+// It is recommended to use it within a Go Routine as it is a blocking operation.
+func (m *ConsumerGroupManager) Run(ctx context.Context) {
+	defaultLogger.Infof("starting %d pipeline(s)", len(m.pipelines))
+	wg := &sync.WaitGroup{}
+	for _, p := range m.pipelines {
+		wg.Add(1)
+		go func(p *Pipeline) {
+			defer wg.Done()
+			p.Run(ctx)
+		}(p)
+	}
+	wg.Wait()
+}
+
+// pipelineClient Creates and validates the client of a pipeline, based on a copy of the base client.
+// With dedicated, the pipeline gets its own consumer group and files, using its name as a suffix.
+// The outputs, the Sampler and the deduplication stores are the same instances of the base client.
+func pipelineClient(base KafkaClient, cfg PipelineConfig, dedicated bool) (*KafkaClient, error) {
+	cli := base // Each pipeline inherits the global settings
+	cli.Topic = cfg.Topic
+	cli.Outputs = append([]Output(nil), base.Outputs...) // Shared outputs, but each pipeline owns its list
+	if cfg.IPC != "" {
+		cli.IPC = cfg.IPC
+	}
+	if cfg.Parser != "" {
+		cli.Parser = cfg.Parser
+	}
+	if dedicated {
+		cli.GroupID = base.GroupID + "-" + cfg.Name
+		if base.ReassemblyCheckpoint != "" {
+			cli.ReassemblyCheckpoint = base.ReassemblyCheckpoint + "." + cfg.Name // Each pipeline rewrites its own checkpoint
+		}
+		if base.PartialBufferFile != "" {
+			cli.PartialBufferFile = base.PartialBufferFile + "." + cfg.Name
+		}
+	}
+	if cfg.GroupID != "" {
+		cli.GroupID = cfg.GroupID
+	}
+	if len(cfg.Outputs) > 0 {
+		outputs, err := selectOutputs(base.Outputs, cfg.Outputs)
+		if err != nil {
+			return nil, err
+		}
+		cli.Outputs = outputs
+	}
+	if err := cli.Validate(); err != nil {
+		return nil, err
+	}
+	return &cli, nil
+}
+
+// selectOutputs Returns the outputs whose kind (i.e. webhook) or name (i.e. forward:traps) is on the list, keeping their order.
+// It fails when an entry of the list doesn't match any output.
+func selectOutputs(outputs []Output, names []string) ([]Output, error) {
+	matched := make(map[string]bool, len(names))
+	selected := make([]Output, 0, len(outputs))
+	for _, output := range outputs {
+		name := output.Name()
+		kind := strings.SplitN(name, ":", 2)[0]
+		found := false
+		for _, n := range names {
+			if n == name || n == kind {
+				matched[n] = true
+				found = true
+			}
+		}
+		if found {
+			selected = append(selected, output)
+		}
+	}
+	for _, n := range names {
+		if !matched[n] {
+			return nil, fmt.Errorf("unknown output %s", n)
+		}
+	}
+	return selected, nil
+}
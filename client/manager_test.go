@@ -0,0 +1,66 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestConsumerGroupManager(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipelines.yaml")
+	assert.NilError(t, ioutil.WriteFile(path, []byte(`
+pipelines:
+  - name: traps
+    topic: OpenNMS.Sink.Trap
+    outputs: [webhook]
+  - name: flows
+    topic: OpenNMS.Sink.Telemetry-Netflow-9
+    parser: netflow
+    group-id: flows-receiver
+`), 0644))
+	configs, err := ReadPipelinesFile(path)
+	assert.NilError(t, err)
+	assert.Equal(t, 2, len(configs))
+	assert.ErrorContains(t, configs.Add(PipelineConfig{Name: "traps", Topic: "Test"}), "already defined")
+
+	webhook := &countingOutput{name: "webhook:alerts"}
+	forward := &countingOutput{name: "forward:traps"}
+	base := KafkaClient{Bootstrap: "127.0.0.1:9092", Topic: "Test", GroupID: "receiver", IPC: "sink", Parser: "snmp", Outputs: []Output{webhook, forward}}
+	manager, err := NewConsumerGroupManager(base, configs)
+	assert.NilError(t, err)
+	pipelines := manager.Pipelines()
+	assert.Equal(t, 2, len(pipelines))
+
+	traps := pipelines[0].Client
+	assert.Equal(t, "snmp", traps.Parser) // Inherited from the base client
+	assert.Equal(t, "receiver-traps", traps.GroupID)
+	assert.Equal(t, 1, len(traps.Outputs))
+	assert.Equal(t, Output(webhook), traps.Outputs[0])
+
+	flows := pipelines[1].Client
+	assert.Equal(t, "netflow", flows.Parser)
+	assert.Equal(t, "flows-receiver", flows.GroupID)
+	assert.Equal(t, 2, len(flows.Outputs))
+
+	// The outputs and the deduplication state are shared, but not the lists of outputs
+	base.DedupCache, err = NewDedupCache(10, 0)
+	assert.NilError(t, err)
+	manager, err = NewConsumerGroupManager(base, configs)
+	assert.NilError(t, err)
+	pipelines = manager.Pipelines()
+	traps, flows = pipelines[0].Client, pipelines[1].Client
+	assert.Equal(t, Output(webhook), flows.Outputs[0])
+	assert.Equal(t, Output(forward), flows.Outputs[1])
+	assert.Equal(t, base.DedupCache, traps.DedupCache)
+	assert.Equal(t, base.DedupCache, flows.DedupCache)
+	flows.Outputs[0] = &countingOutput{name: "stdout"}
+	assert.Equal(t, Output(webhook), base.Outputs[0])
+
+	configs[0].Outputs = []string{"elasticsearch"}
+	_, err = NewConsumerGroupManager(base, configs)
+	assert.ErrorContains(t, err, "unknown output elasticsearch")
+}
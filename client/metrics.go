@@ -0,0 +1,135 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Results of the reassembled messages, used by the onms_ipc_messages_total metric
+const (
+	ResultProcessed   = "processed"   // The message was passed to the parser.
+	ResultDuplicate   = "duplicate"   // The message was already processed.
+	ResultSampled     = "sampled"     // The message was discarded by the sampling.
+	ResultInvalid     = "invalid"     // The message failed the integrity checks.
+	ResultUnavailable = "unavailable" // The offloaded payload of the message couldn't be fetched.
+)
+
+// Reasons for dropping chunks, used by the onms_ipc_dropped_chunks_total metric
+const (
+	DropHeaderFilter = "header-filter" // The chunk didn't satisfy the header filter.
+	DropUnmarshal    = "unmarshal"     // The chunk is not a valid IPC message.
+	DropDuplicate    = "duplicate"     // The chunk was already received.
+	DropEvicted      = "evicted"       // The chunk belongs to a partial message that was evicted.
+	DropStore        = "store"         // The chunk couldn't be added to the chunk store, i.e. due to its limits.
+)
+
+// The metrics with per-message labels are shared by all the clients, and labeled by consumer group and topic,
+// as a client can consume from multiple topics.
+var (
+	// messageResults tracks the reassembled messages by result.
+	messageResults = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "onms_ipc_messages_total",
+		Help: "The total number of reassembled messages by topic, parser and result",
+	}, []string{"group", "topic", "parser", "result"})
+	// unmarshalFailures tracks the messages that couldn't be decoded.
+	unmarshalFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "onms_ipc_unmarshal_failures_total",
+		Help: "The total number of messages that couldn't be decoded by topic and parser, or by IPC API (sink or rpc) for invalid IPC messages",
+	}, []string{"group", "topic", "parser"})
+	// droppedChunks tracks the chunks discarded before reassembling the messages.
+	droppedChunks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "onms_ipc_dropped_chunks_total",
+		Help: "The total number of chunks discarded before reassembling the messages by topic and reason",
+	}, []string{"group", "topic", "reason"})
+	// messageSizes tracks the size of the reassembled messages.
+	messageSizes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "onms_ipc_message_size_bytes",
+		Help:    "The size of the reassembled messages by topic and parser",
+		Buckets: prometheus.ExponentialBuckets(256, 4, 8), // Up to 4 MB
+	}, []string{"group", "topic", "parser"})
+	// minionLatency tracks the time between the reception of the messages by the Minions and their decoding.
+	minionLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "onms_ipc_minion_latency_seconds",
+		Help:    "The time between the reception of the traps, syslog messages and telemetry by the Minions and their decoding, by parser and location",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 15), // Up to 82 seconds
+	}, []string{"group", "parser", "location"})
+	// consumerErrors tracks the errors reported asynchronously by the Kafka consumer.
+	consumerErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "onms_ipc_consumer_errors_total",
+		Help: "The total number of errors reported by the Kafka consumer in the background, like offset commit failures",
+	}, []string{"group"})
+)
+
+// countMessage Tracks the result of a reassembled message.
+func (cli *KafkaClient) countMessage(topic, result string) {
+	messageResults.WithLabelValues(cli.GroupID, topic, cli.parserFor(topic), result).Inc()
+}
+
+// countUnmarshalFailure Tracks a message that couldn't be decoded.
+func (cli *KafkaClient) countUnmarshalFailure(topic, parser string) {
+	unmarshalFailures.WithLabelValues(cli.GroupID, topic, parser).Inc()
+}
+
+// countDroppedChunks Tracks the chunks discarded from a topic.
+func (cli *KafkaClient) countDroppedChunks(topic, reason string, chunks int32) {
+	droppedChunks.WithLabelValues(cli.GroupID, topic, reason).Add(float64(chunks))
+}
+
+// observeMessageSize Tracks the size of a reassembled message.
+func (cli *KafkaClient) observeMessageSize(topic string, size int) {
+	messageSizes.WithLabelValues(cli.GroupID, topic, cli.parserFor(topic)).Observe(float64(size))
+}
+
+// observeMinionLatency Tracks the time since a message was received by a Minion, based on the timestamp embedded in its payload.
+// Negative values, caused by clock skew between the Minion and the receiver, are recorded as zero.
+func (cli *KafkaClient) observeMinionLatency(parser, location string, received time.Time) {
+	if received.IsZero() {
+		return
+	}
+	latency := time.Since(received).Seconds()
+	if latency < 0 {
+		latency = 0
+	}
+	minionLatency.WithLabelValues(cli.GroupID, parser, location).Observe(latency)
+}
+
+// consumerLogger adapts the logger of a client for the Kafka consumer, counting the errors it reports in the background.
+type consumerLogger struct {
+	cli    *KafkaClient
+	fields watermill.LogFields
+}
+
+// Error Logs and counts an error.
+func (l *consumerLogger) Error(msg string, err error, fields watermill.LogFields) {
+	consumerErrors.WithLabelValues(l.cli.GroupID).Inc()
+	l.cli.logger().Errorf("%s: %v %s", msg, err, l.format(fields))
+}
+
+// Info Logs an informational message.
+func (l *consumerLogger) Info(msg string, fields watermill.LogFields) {
+	l.cli.logger().Infof("%s %s", msg, l.format(fields))
+}
+
+// Debug Logs a debug message.
+func (l *consumerLogger) Debug(msg string, fields watermill.LogFields) {
+	l.cli.logger().Debugf("%s %s", msg, l.format(fields))
+}
+
+// Trace Discards the trace messages.
+func (l *consumerLogger) Trace(msg string, fields watermill.LogFields) {}
+
+// With Returns a logger with additional fields.
+func (l *consumerLogger) With(fields watermill.LogFields) watermill.LoggerAdapter {
+	return &consumerLogger{cli: l.cli, fields: l.fields.Add(fields)}
+}
+
+// format Returns the fields of a log entry as text.
+func (l *consumerLogger) format(fields watermill.LogFields) string {
+	return fmt.Sprintf("%v", l.fields.Add(fields))
+}
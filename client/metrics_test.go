@@ -0,0 +1,89 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/telemetry"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+	"gotest.tools/v3/assert"
+)
+
+func TestLabeledMetrics(t *testing.T) {
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	cli.GroupID = "metrics-test"
+	cli.Parser = "syslog"
+
+	assert.Equal(t, "ABC", string(cli.processMessage(buildMessage("0001", 0, 1, []byte("ABC")))))
+	assert.Assert(t, cli.processMessage(buildMessage("0002", 0, 3, []byte("ABC"))) == nil)
+	assert.Assert(t, cli.processMessage(buildMessage("0002", 0, 3, []byte("ABC"))) == nil)
+	assert.Assert(t, cli.EvictPartialMessage("0002"))
+	assert.Assert(t, cli.processMessage(buildMessage("0003", 2, 3, []byte("ABC"))) == nil) // Missing chunks
+	assert.Assert(t, cli.processMessage(message.NewMessage("0004", []byte("invalid"))) == nil)
+	cli.decodePayload([]byte("invalid"), "Test", "syslog", func(payload []byte, meta Metadata) {
+		t.Fatal("unexpected message")
+	})
+	(&consumerLogger{cli: cli}).With(nil).Error("cannot commit offsets", errors.New("broker unavailable"), nil)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(messageResults.WithLabelValues("metrics-test", "Test", "syslog", ResultProcessed)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(messageResults.WithLabelValues("metrics-test", "Test", "syslog", ResultInvalid)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(droppedChunks.WithLabelValues("metrics-test", "Test", DropDuplicate)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(droppedChunks.WithLabelValues("metrics-test", "Test", DropEvicted)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(droppedChunks.WithLabelValues("metrics-test", "Test", DropUnmarshal)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(unmarshalFailures.WithLabelValues("metrics-test", "Test", "sink")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(unmarshalFailures.WithLabelValues("metrics-test", "Test", "syslog")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(consumerErrors.WithLabelValues("metrics-test")))
+	sizes := &dto.Metric{}
+	assert.NilError(t, messageSizes.WithLabelValues("metrics-test", "Test", "syslog").(prometheus.Histogram).Write(sizes))
+	assert.Equal(t, uint64(1), sizes.Histogram.GetSampleCount())
+	assert.Equal(t, float64(3), sizes.Histogram.GetSampleSum())
+}
+
+func TestMinionLatency(t *testing.T) {
+	cli := &KafkaClient{IPC: "sink", GroupID: "latency-test"}
+	received := time.Now().Add(-2 * time.Second)
+	noop := func(payload []byte, meta Metadata) {}
+
+	syslog, err := xml.Marshal(SyslogMessageLogDTO{Location: "Apex", Messages: []SyslogMessageDTO{
+		{Timestamp: received.Format(time.RFC3339Nano), Content: []byte(base64.StdEncoding.EncodeToString([]byte("<13>test")))},
+		{Timestamp: "invalid", Content: []byte(base64.StdEncoding.EncodeToString([]byte("<13>test")))},
+	}})
+	assert.NilError(t, err)
+	cli.decodePayload(syslog, "Test", "syslog", noop)
+
+	trap, err := xml.Marshal(TrapLogDTO{Location: "Apex", Messages: []TrapDTO{{CreationTime: received.UnixNano() / int64(time.Millisecond)}}})
+	assert.NilError(t, err)
+	cli.decodePayload(trap, "Test", "snmp", noop)
+
+	ts := uint64(time.Now().Add(time.Minute).UnixNano() / int64(time.Millisecond)) // Clock skew
+	flows, err := proto.Marshal(&telemetry.TelemetryMessageLog{
+		Location:      proto.String("Lab"),
+		SystemId:      proto.String("minion01"),
+		SourceAddress: proto.String("10.0.0.1"),
+		Message:       []*telemetry.TelemetryMessage{{Timestamp: &ts, Bytes: []byte("JTI")}},
+	})
+	assert.NilError(t, err)
+	cli.decodePayload(flows, "Test", "jti", noop)
+
+	histogram := func(parser, location string) *dto.Histogram {
+		m := &dto.Metric{}
+		assert.NilError(t, minionLatency.WithLabelValues("latency-test", parser, location).(prometheus.Histogram).Write(m))
+		return m.GetHistogram()
+	}
+	assert.Equal(t, uint64(1), histogram("syslog", "Apex").GetSampleCount())
+	assert.Assert(t, histogram("syslog", "Apex").GetSampleSum() >= 2)
+	assert.Equal(t, uint64(1), histogram("snmp", "Apex").GetSampleCount())
+	assert.Assert(t, histogram("snmp", "Apex").GetSampleSum() >= 2)
+	assert.Equal(t, uint64(1), histogram("jti", "Lab").GetSampleCount())
+	assert.Equal(t, float64(0), histogram("jti", "Lab").GetSampleSum())
+}
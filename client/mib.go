@@ -0,0 +1,556 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// mibMacros contains the SMI macros that assign an OID to a name.
+var mibMacros = map[string]bool{
+	"MODULE-IDENTITY": true, "OBJECT-TYPE": true, "OBJECT-IDENTITY": true, "NOTIFICATION-TYPE": true, "TRAP-TYPE": true,
+	"OBJECT-GROUP": true, "NOTIFICATION-GROUP": true, "MODULE-COMPLIANCE": true, "AGENT-CAPABILITIES": true,
+}
+
+// mibRoots contains the OIDs defined by SNMPv2-SMI and RFC1155-SMI, so the MIBs can be loaded without them.
+var mibRoots = []struct {
+	name string
+	oid  string
+}{
+	{"ccitt", ".0"}, {"iso", ".1"}, {"joint-iso-ccitt", ".2"},
+	{"org", ".1.3"}, {"dod", ".1.3.6"}, {"internet", ".1.3.6.1"}, {"directory", ".1.3.6.1.1"}, {"mgmt", ".1.3.6.1.2"},
+	{"mib-2", ".1.3.6.1.2.1"}, {"transmission", ".1.3.6.1.2.1.10"}, {"experimental", ".1.3.6.1.3"}, {"private", ".1.3.6.1.4"},
+	{"enterprises", ".1.3.6.1.4.1"}, {"security", ".1.3.6.1.5"}, {"snmpV2", ".1.3.6.1.6"}, {"snmpDomains", ".1.3.6.1.6.1"},
+	{"snmpProxys", ".1.3.6.1.6.2"}, {"snmpModules", ".1.3.6.1.6.3"}, {"zeroDotZero", ".0.0"},
+}
+
+// MIBObject represents a named OID of a MIB, with the syntax and the enumerations of the objects.
+type MIBObject struct {
+	Module string           // The name of the module (i.e. IF-MIB).
+	Name   string           // The descriptor (i.e. ifOperStatus).
+	OID    string           // The numeric OID, with a leading dot.
+	Syntax string           // The syntax of the object type, either a base type or a textual convention (optional).
+	Enums  map[int64]string // The labels of the enumerated values (optional).
+}
+
+// mibType represents a type assignment or a textual convention.
+type mibType struct {
+	syntax string
+	enums  map[int64]string
+}
+
+// mibDefinition represents a name assigned to an OID while parsing the modules, before resolving its parent.
+type mibDefinition struct {
+	object *MIBObject
+	parent string
+	path   []string
+}
+
+// MIBTree translates the numeric OIDs into names, based on the MIB modules loaded from files.
+// The parser supports the SMIv1 and SMIv2 macros used to assign OIDs (OBJECT-TYPE, NOTIFICATION-TYPE, TRAP-TYPE, etc.),
+// and the syntax and enumerations of the object types and textual conventions; the other ASN.1 constructs are ignored.
+// The names are global, so the IMPORTS are not required to be loaded, as long as the resolved parents are loaded from any file.
+// This is a concurrent safe object, as it is read-only once loaded.
+type MIBTree struct {
+	objects map[string]*MIBObject // By OID.
+	types   map[string]*mibType   // By name.
+	modules []string
+}
+
+// LoadMIBs Parses all the MIB files from the given directories (subdirectories are not included).
+// The files that can't be parsed are skipped with a warning, and the OIDs whose parents are not defined are ignored.
+func LoadMIBs(dirs ...string) (*MIBTree, error) {
+	t := &MIBTree{objects: make(map[string]*MIBObject), types: make(map[string]*mibType)}
+	var definitions []mibDefinition
+	for _, dir := range dirs {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read MIB directory: %v", err)
+		}
+		for _, file := range files {
+			if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+				continue
+			}
+			path := filepath.Join(dir, file.Name())
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read MIB file: %v", err)
+			}
+			defs, modules, err := t.parse(string(data))
+			if err != nil {
+				defaultLogger.Warnf("skipping MIB file %s: %v", path, err)
+				continue
+			}
+			definitions = append(definitions, defs...)
+			t.modules = append(t.modules, modules...)
+		}
+	}
+	if len(t.modules) == 0 {
+		return nil, fmt.Errorf("no MIB modules found on %s", strings.Join(dirs, ", "))
+	}
+	t.resolve(definitions)
+	sort.Strings(t.modules)
+	return t, nil
+}
+
+// Modules Returns the names of the loaded modules.
+func (t *MIBTree) Modules() []string {
+	return t.modules
+}
+
+// resolve Assigns the OIDs to the definitions once their parents are known, ignoring the ones whose parents are never defined.
+func (t *MIBTree) resolve(definitions []mibDefinition) {
+	names := make(map[string]string)
+	for _, root := range mibRoots {
+		names[root.name] = root.oid
+	}
+	for progress := true; progress && len(definitions) > 0; {
+		progress = false
+		pending := definitions[:0]
+		for _, def := range definitions {
+			parent, ok := names[def.parent]
+			if !ok {
+				if _, err := strconv.Atoi(def.parent); err != nil {
+					pending = append(pending, def)
+					continue
+				}
+				parent = "." + def.parent
+			}
+			def.object.OID = parent
+			for _, c := range def.path {
+				def.object.OID += "." + c
+			}
+			if _, ok := names[def.object.Name]; !ok {
+				names[def.object.Name] = def.object.OID
+			}
+			if _, ok := t.objects[def.object.OID]; !ok {
+				t.objects[def.object.OID] = def.object
+			}
+			progress = true
+		}
+		definitions = pending
+	}
+	for _, def := range definitions {
+		defaultLogger.Debugf("ignoring %s::%s, as its parent %s is not defined", def.object.Module, def.object.Name, def.parent)
+	}
+}
+
+// Object Returns the closest object of an OID, with the remaining suffix as the instance (i.e. 3 for ifIndex.3), or nil when unknown.
+func (t *MIBTree) Object(oid string) (*MIBObject, string) {
+	oid = "." + strings.TrimPrefix(strings.TrimSpace(oid), ".")
+	for prefix := oid; prefix != ""; {
+		if object, ok := t.objects[prefix]; ok {
+			return object, strings.TrimPrefix(oid[len(prefix):], ".")
+		}
+		i := strings.LastIndex(prefix, ".")
+		if i <= 0 {
+			break
+		}
+		prefix = prefix[:i]
+	}
+	return nil, ""
+}
+
+// Name Returns the name of an OID as MODULE::name followed by the instance, i.e. IF-MIB::ifIndex.3, or an empty string when unknown.
+func (t *MIBTree) Name(oid string) string {
+	object, instance := t.Object(oid)
+	if object == nil {
+		return ""
+	}
+	name := object.Module + "::" + object.Name
+	if instance != "" {
+		name += "." + instance
+	}
+	return name
+}
+
+// enums Returns the enumerations of an object, either its own or the ones of its textual convention.
+func (t *MIBTree) enums(object *MIBObject) map[int64]string {
+	if len(object.Enums) > 0 {
+		return object.Enums
+	}
+	for syntax, depth := object.Syntax, 0; syntax != "" && depth < 10; depth++ {
+		tc, ok := t.types[syntax]
+		if !ok {
+			break
+		}
+		if len(tc.enums) > 0 {
+			return tc.enums
+		}
+		syntax = tc.syntax
+	}
+	return nil
+}
+
+// mibTokenize Splits a MIB module into tokens, removing the comments and keeping the quoted strings as single tokens.
+func mibTokenize(content string) []string {
+	var tokens []string
+	runes := []rune(content)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '-' && i+1 < len(runes) && runes[i+1] == '-': // Comments end with the line or another --
+			i += 2
+			for i < len(runes) && runes[i] != '\n' {
+				if runes[i] == '-' && i+1 < len(runes) && runes[i+1] == '-' {
+					i += 2
+					break
+				}
+				i++
+			}
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(runes) && runes[j] != c {
+				j++
+			}
+			if c == '\'' && j+1 < len(runes) { // Binary or hexadecimal strings, i.e. '0F'H
+				j++
+			}
+			if j >= len(runes) {
+				j = len(runes) - 1
+			}
+			tokens = append(tokens, string(runes[i:j+1]))
+			i = j + 1
+		case c == ':' && i+2 < len(runes) && runes[i+1] == ':' && runes[i+2] == '=':
+			tokens = append(tokens, "::=")
+			i += 3
+		case c == '.' && i+1 < len(runes) && runes[i+1] == '.':
+			tokens = append(tokens, "..")
+			i += 2
+		case unicode.IsLetter(c) || unicode.IsDigit(c) || c == '-' || c == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' ||
+				(runes[j] == '-' && !(j+1 < len(runes) && runes[j+1] == '-'))) {
+				j++
+			}
+			if j == i { // A lone hyphen
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		default:
+			tokens = append(tokens, string(c))
+			i++
+		}
+	}
+	return tokens
+}
+
+// parse Parses the modules of a MIB file, returning the OID definitions and the names of the modules; the types are added to the tree.
+func (t *MIBTree) parse(content string) ([]mibDefinition, []string, error) {
+	tokens := mibTokenize(content)
+	at := func(i int) string {
+		if i < len(tokens) {
+			return tokens[i]
+		}
+		return ""
+	}
+	var definitions []mibDefinition
+	var modules []string
+	module := ""
+	for i := 0; i < len(tokens); {
+		tok := at(i)
+		switch {
+		case at(i+1) == "DEFINITIONS":
+			module = tok
+			modules = append(modules, module)
+			for i < len(tokens) && tokens[i] != "BEGIN" {
+				i++
+			}
+			i++
+		case module == "":
+			i++
+		case tok == "END":
+			module = ""
+			i++
+		case tok == "IMPORTS" || tok == "EXPORTS":
+			for i < len(tokens) && tokens[i] != ";" {
+				i++
+			}
+			i++
+		case at(i+1) == "MACRO":
+			for i < len(tokens) && tokens[i] != "END" {
+				i++
+			}
+			i++
+		case at(i+1) == "OBJECT" && at(i+2) == "IDENTIFIER" && at(i+3) == "::=":
+			def, next, err := mibOID(tokens, i+4)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid OID of %s: %v", tok, err)
+			}
+			def.object = &MIBObject{Module: module, Name: tok}
+			definitions = append(definitions, def)
+			i = next
+		case mibMacros[at(i+1)]:
+			object := &MIBObject{Module: module, Name: tok}
+			macro := at(i + 1)
+			enterprise := ""
+			j := i + 2
+			for ; j < len(tokens) && tokens[j] != "::="; j++ {
+				switch {
+				case tokens[j] == "SYNTAX" && macro == "OBJECT-TYPE":
+					var tc mibType
+					tc, j = mibSyntax(tokens, j+1)
+					object.Syntax, object.Enums = tc.syntax, tc.enums
+					j--
+				case tokens[j] == "ENTERPRISE" && macro == "TRAP-TYPE":
+					enterprise = at(j + 1)
+				}
+			}
+			if macro == "TRAP-TYPE" { // RFC 3584: enterprise.0.specific
+				if _, err := strconv.Atoi(at(j + 1)); err != nil || enterprise == "" {
+					return nil, nil, fmt.Errorf("invalid trap %s", tok)
+				}
+				definitions = append(definitions, mibDefinition{object: object, parent: enterprise, path: []string{"0", at(j + 1)}})
+				i = j + 2
+				continue
+			}
+			def, next, err := mibOID(tokens, j+1)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid OID of %s: %v", tok, err)
+			}
+			def.object = object
+			definitions = append(definitions, def)
+			i = next
+		case at(i+1) == "::=" && tok != "" && unicode.IsUpper([]rune(tok)[0]):
+			j := i + 2
+			if at(j) == "TEXTUAL-CONVENTION" {
+				for j < len(tokens) && tokens[j] != "SYNTAX" {
+					j++
+				}
+				j++
+			}
+			tc, next := mibSyntax(tokens, j)
+			t.types[tok] = &tc
+			i = next
+		default:
+			i++
+		}
+	}
+	if len(modules) == 0 {
+		return nil, nil, fmt.Errorf("no module definitions found")
+	}
+	return definitions, modules, nil
+}
+
+// mibOID Parses an OID value like { parent 1 2 } or { iso org(3) 6 }, returning the index of the next token.
+func mibOID(tokens []string, i int) (mibDefinition, int, error) {
+	def := mibDefinition{}
+	if i >= len(tokens) || tokens[i] != "{" {
+		return def, i, fmt.Errorf("expecting {")
+	}
+	for i++; i < len(tokens) && tokens[i] != "}"; i++ {
+		tok := tokens[i]
+		if i+3 < len(tokens) && tokens[i+1] == "(" && tokens[i+3] == ")" { // name(number)
+			tok = tokens[i+2]
+			i += 3
+		}
+		if def.parent == "" {
+			def.parent = tok
+			continue
+		}
+		if _, err := strconv.Atoi(tok); err != nil {
+			return def, i, fmt.Errorf("invalid sub-identifier %s", tok)
+		}
+		def.path = append(def.path, tok)
+	}
+	if def.parent == "" {
+		return def, i, fmt.Errorf("empty OID")
+	}
+	return def, i + 1, nil
+}
+
+// mibSyntax Parses a syntax with its enumerations, skipping the tags, the constraints and the sequences, returning the index of the next token.
+func mibSyntax(tokens []string, i int) (mibType, int) {
+	tc := mibType{}
+	at := func(i int) string {
+		if i < len(tokens) {
+			return tokens[i]
+		}
+		return ""
+	}
+	skip := func(i int, open, close string) int {
+		for depth := 0; i < len(tokens); i++ {
+			if tokens[i] == open {
+				depth++
+			} else if tokens[i] == close {
+				if depth--; depth == 0 {
+					return i + 1
+				}
+			}
+		}
+		return i
+	}
+	if at(i) == "[" {
+		i = skip(i, "[", "]")
+	}
+	if at(i) == "IMPLICIT" {
+		i++
+	}
+	tc.syntax = at(i)
+	i++
+	switch {
+	case tc.syntax == "OCTET" && at(i) == "STRING", tc.syntax == "OBJECT" && at(i) == "IDENTIFIER":
+		tc.syntax += " " + at(i)
+		i++
+	case tc.syntax == "SEQUENCE" && at(i) == "OF":
+		tc.syntax += " OF " + at(i+1)
+		i += 2
+	}
+	if at(i) == "{" {
+		if tc.syntax == "SEQUENCE" || tc.syntax == "CHOICE" {
+			return tc, skip(i, "{", "}")
+		}
+		tc.enums = make(map[int64]string)
+		for i++; i < len(tokens) && tokens[i] != "}"; i++ {
+			if at(i+1) == "(" && at(i+3) == ")" {
+				if n, err := strconv.ParseInt(at(i+2), 10, 64); err == nil {
+					tc.enums[n] = tokens[i]
+				}
+				i += 3
+			}
+		}
+		i++
+	}
+	if at(i) == "(" {
+		i = skip(i, "(", ")")
+	}
+	return tc, i
+}
+
+// ResolveOIDs Returns a middleware that adds the names of the OIDs of the SNMP traps, based on the loaded MIBs.
+// Each varbind gets its name (i.e. IF-MIB::ifOperStatus.3), and its value gets a display with the label of the enumerations (i.e. down(2)),
+// the name of OID values (i.e. IF-MIB::linkDown for snmpTrapOID.0), or the TimeTicks as a duration.
+// Each trap gets its name, from its identity (i.e. IF-MIB::linkDown, or SNMPv2-MIB::coldStart for the generic SNMPv1 traps).
+// The payload is handled as generic JSON, so the fields are sorted by name.
+func ResolveOIDs(t *MIBTree) Middleware {
+	return func(ctx *MessageContext) error {
+		if !isSnmp(ctx.Message.Parser) {
+			return nil
+		}
+		var trapLog map[string]json.RawMessage
+		if err := ctx.Decode(&trapLog); err != nil {
+			return err
+		}
+		var traps []map[string]json.RawMessage
+		if err := json.Unmarshal(trapLog["messages"], &traps); err != nil {
+			return fmt.Errorf("invalid snmp traps: %v", err)
+		}
+		for _, trap := range traps {
+			identity := &TrapIdentityDTO{}
+			if err := json.Unmarshal(trap["trapIdentity"], identity); err == nil && identity.EnterpriseID != "" {
+				if name := t.trapName(identity); name != "" {
+					trap["trapName"], _ = json.Marshal(name)
+				}
+			}
+			var results map[string]json.RawMessage
+			if err := json.Unmarshal(trap["results"], &results); err != nil {
+				continue
+			}
+			var varbinds []map[string]json.RawMessage
+			if err := json.Unmarshal(results["varbinds"], &varbinds); err != nil {
+				continue
+			}
+			for _, varbind := range varbinds {
+				t.resolveVarbind(varbind)
+			}
+			results["varbinds"], _ = json.Marshal(varbinds)
+			trap["results"], _ = json.Marshal(results)
+		}
+		trapLog["messages"], _ = json.Marshal(traps)
+		return ctx.Encode(trapLog)
+	}
+}
+
+// trapName Returns the name of a trap from its identity, following RFC 3584.
+func (t *MIBTree) trapName(identity *TrapIdentityDTO) string {
+	if identity.Generic >= 0 && identity.Generic < 6 {
+		return t.exactName("." + oidSnmpTraps + "." + strconv.Itoa(identity.Generic+1))
+	}
+	enterprise := "." + strings.TrimPrefix(identity.EnterpriseID, ".")
+	if name := t.exactName(enterprise + ".0." + strconv.Itoa(identity.Specific)); name != "" {
+		return name
+	}
+	return t.exactName(enterprise + "." + strconv.Itoa(identity.Specific))
+}
+
+// exactName Returns the name of an OID only when it is defined by a MIB, without an instance.
+func (t *MIBTree) exactName(oid string) string {
+	if object, instance := t.Object(oid); object != nil && instance == "" {
+		return object.Module + "::" + object.Name
+	}
+	return ""
+}
+
+// resolveVarbind Adds the name of a varbind, and the display of its value.
+func (t *MIBTree) resolveVarbind(varbind map[string]json.RawMessage) {
+	var base, instance string
+	json.Unmarshal(varbind["base"], &base)
+	json.Unmarshal(varbind["instance"], &instance)
+	oid := base
+	if instance != "" {
+		oid += "." + strings.TrimPrefix(instance, ".")
+	}
+	object, suffix := t.Object(oid)
+	if object == nil {
+		return
+	}
+	name := object.Module + "::" + object.Name
+	if suffix != "" {
+		name += "." + suffix
+	}
+	varbind["name"], _ = json.Marshal(name)
+	var value map[string]json.RawMessage
+	if err := json.Unmarshal(varbind["value"], &value); err != nil {
+		return
+	}
+	var kind int
+	var content string
+	json.Unmarshal(value["type"], &kind)
+	json.Unmarshal(value["value"], &content)
+	display := ""
+	switch kind {
+	case snmpInteger:
+		if n, err := strconv.ParseInt(content, 10, 64); err == nil {
+			if label, ok := t.enums(object)[n]; ok {
+				display = fmt.Sprintf("%s(%d)", label, n)
+			}
+		}
+	case snmpObjectID:
+		display = t.Name(content)
+	case snmpTimeTicks:
+		if n, err := strconv.ParseUint(content, 10, 64); err == nil {
+			display = formatTimeTicks(n)
+		}
+	}
+	if object.Syntax != "" {
+		value["mibSyntax"], _ = json.Marshal(object.Syntax)
+	}
+	if display != "" {
+		value["display"], _ = json.Marshal(display)
+	}
+	varbind["value"], _ = json.Marshal(value)
+}
+
+// formatTimeTicks Formats the hundredths of second of a TimeTicks value, like net-snmp, i.e. 1 day, 2:03:04.05.
+func formatTimeTicks(ticks uint64) string {
+	days := ticks / 8640000
+	s := fmt.Sprintf("%d:%02d:%02d.%02d", ticks/360000%24, ticks/6000%60, ticks/100%60, ticks%100)
+	switch days {
+	case 0:
+		return s
+	case 1:
+		return "1 day, " + s
+	default:
+		return fmt.Sprintf("%d days, %s", days, s)
+	}
+}
@@ -0,0 +1,219 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const testIFMIB = `
+IF-MIB DEFINITIONS ::= BEGIN
+
+IMPORTS
+    MODULE-IDENTITY, OBJECT-TYPE, NOTIFICATION-TYPE, mib-2 FROM SNMPv2-SMI
+    TEXTUAL-CONVENTION FROM SNMPv2-TC; -- Not loaded
+
+ifMIB MODULE-IDENTITY
+    LAST-UPDATED "200006140000Z"
+    ORGANIZATION "IETF Interfaces MIB Working Group"
+    CONTACT-INFO "-- not a comment"
+    DESCRIPTION  "The MIB module to describe generic objects for network interface sub-layers."
+    ::= { mib-2 31 }
+
+interfaces   OBJECT IDENTIFIER ::= { mib-2 2 }
+
+InterfaceIndex ::= TEXTUAL-CONVENTION
+    DISPLAY-HINT "d"
+    STATUS       current
+    DESCRIPTION  "A unique value, greater than zero, for each interface."
+    SYNTAX       Integer32 (1..2147483647)
+
+IfOperStatus ::= TEXTUAL-CONVENTION
+    STATUS       current
+    DESCRIPTION  "The current operational state of the interface."
+    SYNTAX  INTEGER { up(1), down(2), testing(3) }
+
+ifTable OBJECT-TYPE
+    SYNTAX      SEQUENCE OF IfEntry
+    MAX-ACCESS  not-accessible
+    STATUS      current
+    DESCRIPTION "A list of interface entries."
+    ::= { interfaces 2 }
+
+ifEntry OBJECT-TYPE
+    SYNTAX      IfEntry
+    MAX-ACCESS  not-accessible
+    STATUS      current
+    DESCRIPTION "An entry containing management information applicable to a particular interface."
+    INDEX   { ifIndex }
+    ::= { ifTable 1 }
+
+IfEntry ::=
+    SEQUENCE {
+        ifIndex                 InterfaceIndex,
+        ifAdminStatus           INTEGER,
+        ifOperStatus            IfOperStatus
+    }
+
+ifIndex OBJECT-TYPE
+    SYNTAX      InterfaceIndex
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "A unique value, greater than zero, for each interface."
+    ::= { ifEntry 1 }
+
+ifAdminStatus OBJECT-TYPE
+    SYNTAX  INTEGER {
+                up(1),       -- ready to pass packets
+                down(2),
+                testing(3)   -- in some test mode
+            }
+    MAX-ACCESS  read-write
+    STATUS      current
+    DESCRIPTION "The desired state of the interface."
+    ::= { ifEntry 7 }
+
+ifOperStatus OBJECT-TYPE
+    SYNTAX      IfOperStatus
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "The current operational state of the interface."
+    DEFVAL      { up }
+    ::= { ifEntry 8 }
+
+ifLastChange OBJECT-TYPE
+    SYNTAX      TimeTicks
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "The value of sysUpTime at the time the interface entered its current operational state."
+    ::= { ifEntry 9 }
+
+linkDown NOTIFICATION-TYPE
+    OBJECTS { ifIndex, ifAdminStatus, ifOperStatus }
+    STATUS  current
+    DESCRIPTION "A linkDown trap signifies that the SNMP entity has detected a failure."
+    ::= { snmpTraps 3 }
+
+END
+`
+
+const testTrapMIBs = `
+SNMPv2-MIB DEFINITIONS ::= BEGIN
+snmpMIB          OBJECT IDENTIFIER ::= { snmpModules 1 }
+snmpMIBObjects   OBJECT IDENTIFIER ::= { snmpMIB 1 }
+snmpTrap         OBJECT IDENTIFIER ::= { snmpMIBObjects 4 }
+snmpTrapOID      OBJECT-TYPE
+    SYNTAX     OBJECT IDENTIFIER
+    MAX-ACCESS accessible-for-notify
+    STATUS     current
+    DESCRIPTION "The authoritative identification of the notification currently being sent."
+    ::= { snmpTrap 1 }
+snmpTraps        OBJECT IDENTIFIER ::= { snmpMIBObjects 5 }
+coldStart NOTIFICATION-TYPE
+    STATUS  current
+    DESCRIPTION "A coldStart trap signifies that the SNMP entity is reinitializing itself."
+    ::= { snmpTraps 1 }
+END
+
+ACME-TRAP-MIB DEFINITIONS ::= BEGIN
+acme OBJECT IDENTIFIER ::= { iso org(3) dod(6) internet(1) private(4) enterprises(1) 99999 }
+acmeFanFailure TRAP-TYPE
+    ENTERPRISE  acme
+    VARIABLES   { ifIndex }
+    DESCRIPTION "The fan failed."
+    ::= 7
+END
+`
+
+func TestLoadMIBs(t *testing.T) {
+	dir := t.TempDir()
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, "IF-MIB.txt"), []byte(testIFMIB), 0644))
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, "traps.mib"), []byte(testTrapMIBs), 0644))
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a MIB"), 0644))
+
+	mibs, err := LoadMIBs(dir)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"ACME-TRAP-MIB", "IF-MIB", "SNMPv2-MIB"}, mibs.Modules())
+	assert.Equal(t, "IF-MIB::ifMIB", mibs.Name(".1.3.6.1.2.1.31"))
+	assert.Equal(t, "IF-MIB::ifIndex.3", mibs.Name(".1.3.6.1.2.1.2.2.1.1.3"))
+	assert.Equal(t, "IF-MIB::linkDown", mibs.Name("1.3.6.1.6.3.1.1.5.3"))
+	assert.Equal(t, "ACME-TRAP-MIB::acmeFanFailure", mibs.Name(".1.3.6.1.4.1.99999.0.7"))
+	assert.Equal(t, "", mibs.Name(".1.3.6.1.4.1.8072"))
+
+	object, instance := mibs.Object(".1.3.6.1.2.1.2.2.1.7.3")
+	assert.Equal(t, "3", instance)
+	assert.DeepEqual(t, &MIBObject{Module: "IF-MIB", Name: "ifAdminStatus", OID: ".1.3.6.1.2.1.2.2.1.7", Syntax: "INTEGER",
+		Enums: map[int64]string{1: "up", 2: "down", 3: "testing"}}, object)
+	object, _ = mibs.Object(".1.3.6.1.2.1.2.2.1.8")
+	assert.Equal(t, "IfOperStatus", object.Syntax)
+	assert.DeepEqual(t, map[int64]string{1: "up", 2: "down", 3: "testing"}, mibs.enums(object))
+
+	_, err = LoadMIBs(t.TempDir())
+	assert.ErrorContains(t, err, "no MIB modules found")
+	_, err = LoadMIBs(filepath.Join(dir, "missing"))
+	assert.ErrorContains(t, err, "cannot read MIB directory")
+}
+
+func TestResolveOIDs(t *testing.T) {
+	dir := t.TempDir()
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, "IF-MIB"), []byte(testIFMIB+testTrapMIBs), 0644))
+	mibs, err := LoadMIBs(dir)
+	assert.NilError(t, err)
+
+	trapLog := TrapLogDTO{Location: "Apex", Messages: []TrapDTO{
+		{
+			Version:      "v2",
+			TrapIdentity: &TrapIdentityDTO{EnterpriseID: ".1.3.6.1.6.3.1.1.5", Generic: 2, Specific: 0},
+			Results: &SNMPResults{Results: []SNMPResultDTO{
+				{Base: ".1.3.6.1.6.3.1.1.4.1", Instance: "0", Value: SNMPValueDTO{Type: snmpObjectID, Value: "LjEuMy42LjEuNi4zLjEuMS41LjM="}},
+				{Base: ".1.3.6.1.2.1.2.2.1.1", Instance: "3", Value: SNMPValueDTO{Type: snmpInteger, Value: "Aw=="}},
+				{Base: ".1.3.6.1.2.1.2.2.1.8.3", Value: SNMPValueDTO{Type: snmpInteger, Value: "Ag=="}},
+				{Base: ".1.3.6.1.2.1.2.2.1.9", Instance: "3", Value: SNMPValueDTO{Type: snmpTimeTicks, Value: "CTrP7Q=="}},
+				{Base: ".1.3.6.1.4.1.8072.1", Value: SNMPValueDTO{Type: snmpOctetString, Value: "dGVzdA=="}},
+			}},
+		},
+		{
+			Version:      "v1",
+			TrapIdentity: &TrapIdentityDTO{EnterpriseID: ".1.3.6.1.4.1.99999", Generic: 6, Specific: 7},
+			Results:      &SNMPResults{},
+		},
+	}}
+	payload, err := json.Marshal(trapLog)
+	assert.NilError(t, err)
+	mc := &MessageContext{Message: DecodedMessage{Parser: "snmp", Payload: payload}}
+	assert.NilError(t, ResolveOIDs(mibs)(mc))
+
+	result := struct {
+		Location string `json:"location"`
+		Messages []struct {
+			TrapName string `json:"trapName"`
+			Results  struct {
+				Varbinds []map[string]interface{} `json:"varbinds"`
+			} `json:"results"`
+		} `json:"messages"`
+	}{}
+	assert.NilError(t, json.Unmarshal(mc.Message.Payload, &result))
+	assert.Equal(t, "Apex", result.Location)
+	assert.Equal(t, 2, len(result.Messages))
+	assert.Equal(t, "IF-MIB::linkDown", result.Messages[0].TrapName)
+	assert.Equal(t, "ACME-TRAP-MIB::acmeFanFailure", result.Messages[1].TrapName)
+
+	varbinds := result.Messages[0].Results.Varbinds
+	assert.Equal(t, 5, len(varbinds))
+	assert.Equal(t, "SNMPv2-MIB::snmpTrapOID.0", varbinds[0]["name"])
+	assert.DeepEqual(t, map[string]interface{}{"type": float64(6), "syntax": "ObjectIdentifier", "value": ".1.3.6.1.6.3.1.1.5.3", "mibSyntax": "OBJECT IDENTIFIER", "display": "IF-MIB::linkDown"}, varbinds[0]["value"])
+	assert.Equal(t, "IF-MIB::ifIndex.3", varbinds[1]["name"])
+	assert.DeepEqual(t, map[string]interface{}{"type": float64(2), "syntax": "Integer32", "value": "3", "mibSyntax": "InterfaceIndex"}, varbinds[1]["value"])
+	assert.Equal(t, "IF-MIB::ifOperStatus.3", varbinds[2]["name"])
+	assert.Equal(t, "down(2)", varbinds[2]["value"].(map[string]interface{})["display"])
+	assert.Equal(t, "17 days, 22:08:12.61", varbinds[3]["value"].(map[string]interface{})["display"])
+	assert.Assert(t, varbinds[4]["name"] == nil)
+
+	other := &MessageContext{Message: DecodedMessage{Parser: "syslog", Payload: []byte(`not json`)}}
+	assert.NilError(t, ResolveOIDs(mibs)(other))
+}
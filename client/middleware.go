@@ -0,0 +1,119 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// Middleware transforms a decoded message before it reaches the action and the outputs, i.e. to enrich it or redact sensitive fields.
+// When it returns an error, the message is discarded.
+type Middleware func(ctx *MessageContext) error
+
+// MessageContext holds a decoded message while it goes through the middleware chain.
+type MessageContext struct {
+	Context context.Context // The context of the consumer, cancelled when it stops, carrying the span of the message.
+	Message DecodedMessage  // The decoded message, which can be modified.
+	ID      string          // The ID of the IPC message.
+
+	dropped bool
+}
+
+// Drop Discards the message without an error, stopping the middleware chain.
+func (mc *MessageContext) Drop() {
+	mc.dropped = true
+}
+
+// Dropped Returns true when the message was discarded by a middleware.
+func (mc *MessageContext) Dropped() bool {
+	return mc.dropped
+}
+
+// Decode Parses the JSON payload of the message, which is the format used by all the parsers and the Minion heartbeats, but not by the RPC API.
+func (mc *MessageContext) Decode(v interface{}) error {
+	if err := json.Unmarshal(mc.Message.Payload, v); err != nil {
+		return fmt.Errorf("invalid %s payload: %v", mc.Message.Parser, err)
+	}
+	return nil
+}
+
+// Encode Replaces the payload of the message with an object encoded as JSON, using the same format as the parsers.
+func (mc *MessageContext) Encode(v interface{}) error {
+	data, err := marshalIndent(v)
+	if err != nil {
+		return fmt.Errorf("cannot encode %s payload: %v", mc.Message.Parser, err)
+	}
+	mc.Message.Payload = data
+	return nil
+}
+
+// Use Adds middlewares to the chain, which are executed in order for each decoded message between the reassembly and the action.
+// Must be called before starting the client.
+func (cli *KafkaClient) Use(middlewares ...Middleware) {
+	cli.middlewares = append(cli.middlewares, middlewares...)
+}
+
+// transform Executes the middleware chain on a decoded message.
+// Returns false when the message was discarded.
+func (cli *KafkaClient) transform(msg *DecodedMessage) bool {
+	if len(cli.middlewares) == 0 {
+		return true
+	}
+	ctx := cli.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	mc := &MessageContext{Context: oteltrace.ContextWithSpanContext(ctx, msg.spanContext), Message: *msg, ID: msg.id}
+	for i, middleware := range cli.middlewares {
+		if err := middleware(mc); err != nil {
+			cli.logger().Errorf("middleware %d discarded message %s: %v", i+1, msg.Coordinates(), err)
+			if cli.transformErrors != nil {
+				cli.transformErrors.Inc()
+			}
+			cli.trace(msg.id, "discarded by middleware %d: %v", i+1, err)
+			return false
+		}
+		if mc.dropped {
+			cli.trace(msg.id, "dropped by middleware %d", i+1)
+			return false
+		}
+	}
+	*msg = mc.Message
+	msg.id = mc.ID
+	return true
+}
+
+// RedactCommunity Returns a middleware that replaces the community strings of the SNMP traps with a fixed value.
+// The payload is handled as generic JSON, as the trap values are already formatted, so the fields are sorted by name.
+func RedactCommunity(replacement string) Middleware {
+	value, _ := json.Marshal(replacement)
+	return func(ctx *MessageContext) error {
+		if !isSnmp(ctx.Message.Parser) {
+			return nil
+		}
+		var trapLog map[string]json.RawMessage
+		if err := ctx.Decode(&trapLog); err != nil {
+			return err
+		}
+		var traps []map[string]json.RawMessage
+		if err := json.Unmarshal(trapLog["messages"], &traps); err != nil {
+			return fmt.Errorf("invalid snmp traps: %v", err)
+		}
+		redacted := false
+		for _, trap := range traps {
+			if _, ok := trap["community"]; ok {
+				trap["community"] = value
+				redacted = true
+			}
+		}
+		if !redacted {
+			return nil
+		}
+		trapLog["messages"], _ = json.Marshal(traps)
+		return ctx.Encode(trapLog)
+	}
+}
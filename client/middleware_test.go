@@ -0,0 +1,62 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestMiddlewareChain(t *testing.T) {
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	cli.Parser = "heartbeat"
+	cli.Use(func(ctx *MessageContext) error {
+		switch ctx.ID {
+		case "0002":
+			ctx.Drop()
+		case "0003":
+			return fmt.Errorf("cannot enrich message")
+		}
+		return nil
+	}, func(ctx *MessageContext) error {
+		ctx.Message.Metadata.Location = "Apex"
+		ctx.Message.Payload = []byte(strings.ToLower(string(ctx.Message.Payload)))
+		return nil
+	})
+	var received []DecodedMessage
+	handler := func(msg DecodedMessage) error {
+		received = append(received, msg)
+		return nil
+	}
+	for _, id := range []string{"0001", "0002", "0003"} {
+		msg := buildMessage(id, 0, 1, []byte("ABC"))
+		cli.handleMessage(msg, handler)
+		<-msg.Acked()
+	}
+	assert.Equal(t, 1, len(received))
+	assert.Equal(t, "abc", string(received[0].Payload))
+	assert.Equal(t, "Apex", received[0].Metadata.Location)
+}
+
+func TestRedactCommunity(t *testing.T) {
+	redact := RedactCommunity("***")
+	trap := `{"location":"Apex","messages":[{"agentAddress":"10.0.0.1","community":"public","version":"v2c"},{"agentAddress":"10.0.0.2","version":"v3"}]}`
+	ctx := &MessageContext{Message: DecodedMessage{Parser: "snmp", Payload: []byte(trap)}}
+	assert.NilError(t, redact(ctx))
+	payload := string(ctx.Message.Payload)
+	assert.Assert(t, strings.Contains(payload, `"community": "***"`), payload)
+	assert.Assert(t, !strings.Contains(payload, "public"), payload)
+	assert.Assert(t, strings.Contains(payload, `"agentAddress": "10.0.0.2"`), payload)
+
+	// Other parsers are ignored
+	ctx = &MessageContext{Message: DecodedMessage{Parser: "syslog", Payload: []byte(`{"community":"public"}`)}}
+	assert.NilError(t, redact(ctx))
+	assert.Equal(t, `{"community":"public"}`, string(ctx.Message.Payload))
+
+	ctx = &MessageContext{Message: DecodedMessage{Parser: "snmp", Payload: []byte(`invalid`)}}
+	assert.ErrorContains(t, redact(ctx), "invalid snmp payload")
+}
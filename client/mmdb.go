@@ -0,0 +1,292 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"net"
+)
+
+// mmdbMetadataMarker precedes the metadata at the end of a MaxMind DB file.
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// MaxMind DB data types
+const (
+	mmdbExtended  = 0
+	mmdbPointer   = 1
+	mmdbString    = 2
+	mmdbDouble    = 3
+	mmdbBytes     = 4
+	mmdbUint16    = 5
+	mmdbUint32    = 6
+	mmdbMap       = 7
+	mmdbInt32     = 8
+	mmdbUint64    = 9
+	mmdbUint128   = 10
+	mmdbArray     = 11
+	mmdbContainer = 12
+	mmdbEndMarker = 13
+	mmdbBoolean   = 14
+	mmdbFloat     = 15
+)
+
+// mmdbReader is a minimal reader of the MaxMind DB format used by the GeoIP2 and GeoLite2 databases.
+// The whole file is kept in memory, and the records are decoded as generic values: strings, float64, uint64, int64, bool, []byte,
+// *big.Int, []interface{} and map[string]interface{}.
+// This is a concurrent safe object, as it is read-only.
+type mmdbReader struct {
+	DatabaseType string
+	BuildEpoch   uint64
+
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+}
+
+// openMMDB Loads a MaxMind DB file.
+func openMMDB(path string) (*mmdbReader, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %v", path, err)
+	}
+	return parseMMDB(content)
+}
+
+// parseMMDB Parses the content of a MaxMind DB file.
+func parseMMDB(content []byte) (*mmdbReader, error) {
+	start := bytes.LastIndex(content, mmdbMetadataMarker)
+	if start == -1 {
+		return nil, fmt.Errorf("invalid MaxMind DB: metadata not found")
+	}
+	metadataStart := start + len(mmdbMetadataMarker)
+	value, _, err := (&mmdbDecoder{data: content[metadataStart:]}).decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MaxMind DB metadata: %v", err)
+	}
+	metadata, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid MaxMind DB metadata: not a map")
+	}
+	r := &mmdbReader{}
+	r.DatabaseType, _ = metadata["database_type"].(string)
+	r.BuildEpoch, _ = metadata["build_epoch"].(uint64)
+	nodeCount, _ := metadata["node_count"].(uint64)
+	recordSize, _ := metadata["record_size"].(uint64)
+	ipVersion, _ := metadata["ip_version"].(uint64)
+	r.nodeCount, r.recordSize, r.ipVersion = uint(nodeCount), uint(recordSize), uint(ipVersion)
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, fmt.Errorf("invalid MaxMind DB: unsupported record size %d", r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("invalid MaxMind DB: unsupported IP version %d", r.ipVersion)
+	}
+	treeSize := int(r.nodeCount * r.recordSize / 4)
+	if treeSize+16 > start {
+		return nil, fmt.Errorf("invalid MaxMind DB: the search tree exceeds the file")
+	}
+	r.tree = content[:treeSize]
+	r.data = content[treeSize+16 : start]
+	if r.ipVersion == 6 { // The IPv4 addresses are mapped to ::/96
+		for i := 0; i < 96 && r.ipv4Start < r.nodeCount; i++ {
+			r.ipv4Start = r.record(r.ipv4Start, 0)
+		}
+	}
+	return r, nil
+}
+
+// record Returns the left (0) or right (1) record of a node of the search tree.
+func (r *mmdbReader) record(node, bit uint) uint {
+	b := r.tree[node*r.recordSize/4:]
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// lookup Returns the record of an IP address, or nil when the database has no record for it.
+func (r *mmdbReader) lookup(ip net.IP) (interface{}, error) {
+	node := uint(0)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		node = r.ipv4Start
+	} else if r.ipVersion == 4 {
+		return nil, nil
+	}
+	for i := 0; i < len(ip)*8 && node < r.nodeCount; i++ {
+		node = r.record(node, uint(ip[i/8]>>(7-uint(i%8))&1))
+	}
+	if node <= r.nodeCount {
+		return nil, nil
+	}
+	offset := int(node - r.nodeCount - 16)
+	if offset >= len(r.data) {
+		return nil, fmt.Errorf("invalid MaxMind DB: record out of the data section")
+	}
+	value, _, err := (&mmdbDecoder{data: r.data}).decode(offset)
+	return value, err
+}
+
+// mmdbDecoder decodes the values of the data section, or the metadata, of a MaxMind DB file.
+type mmdbDecoder struct {
+	data []byte
+}
+
+// decode Decodes the value at an offset, returning the offset of the next value.
+func (d *mmdbDecoder) decode(offset int) (interface{}, int, error) {
+	if offset >= len(d.data) {
+		return nil, 0, fmt.Errorf("unexpected end of data")
+	}
+	ctrl := d.data[offset]
+	offset++
+	kind := int(ctrl >> 5)
+	if kind == mmdbPointer {
+		pointer, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer)
+		return value, next, err
+	}
+	if kind == mmdbExtended {
+		if offset >= len(d.data) {
+			return nil, 0, fmt.Errorf("unexpected end of data")
+		}
+		kind = 7 + int(d.data[offset])
+		offset++
+	}
+	size, offset, err := d.size(ctrl, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch kind {
+	case mmdbMap:
+		m := make(map[string]interface{}, size)
+		for i := 0; i < size; i++ {
+			var key, value interface{}
+			if key, offset, err = d.decode(offset); err != nil {
+				return nil, 0, err
+			}
+			if value, offset, err = d.decode(offset); err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("invalid map key %v", key)
+			}
+			m[name] = value
+		}
+		return m, offset, nil
+	case mmdbArray:
+		a := make([]interface{}, size)
+		for i := range a {
+			if a[i], offset, err = d.decode(offset); err != nil {
+				return nil, 0, err
+			}
+		}
+		return a, offset, nil
+	case mmdbBoolean:
+		return size != 0, offset, nil
+	case mmdbContainer, mmdbEndMarker:
+		return nil, offset, nil
+	}
+	if offset+size > len(d.data) {
+		return nil, 0, fmt.Errorf("unexpected end of data")
+	}
+	b := d.data[offset : offset+size]
+	offset += size
+	switch kind {
+	case mmdbString:
+		return string(b), offset, nil
+	case mmdbBytes:
+		return append([]byte(nil), b...), offset, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64:
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, offset, nil
+	case mmdbInt32:
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), offset, nil
+	case mmdbUint128:
+		return new(big.Int).SetBytes(b), offset, nil
+	}
+	return nil, 0, fmt.Errorf("unknown data type %d", kind)
+}
+
+// pointer Decodes a pointer, returning its target and the offset of the next value.
+func (d *mmdbDecoder) pointer(ctrl byte, offset int) (int, int, error) {
+	size := int(ctrl>>3&0x3) + 1
+	if offset+size > len(d.data) {
+		return 0, 0, fmt.Errorf("unexpected end of data")
+	}
+	b := d.data[offset : offset+size]
+	var pointer int
+	if size < 4 {
+		pointer = int(ctrl & 0x7)
+	}
+	for _, c := range b {
+		pointer = pointer<<8 | int(c)
+	}
+	switch size {
+	case 2:
+		pointer += 2048
+	case 3:
+		pointer += 526336
+	}
+	return pointer, offset + size, nil
+}
+
+// size Decodes the size of a value, returning the offset of its content.
+func (d *mmdbDecoder) size(ctrl byte, offset int) (int, int, error) {
+	size := int(ctrl & 0x1f)
+	if size < 29 {
+		return size, offset, nil
+	}
+	n := size - 28
+	if offset+n > len(d.data) {
+		return 0, 0, fmt.Errorf("unexpected end of data")
+	}
+	extra := 0
+	for _, c := range d.data[offset : offset+n] {
+		extra = extra<<8 | int(c)
+	}
+	switch n {
+	case 1:
+		size = 29 + extra
+	case 2:
+		size = 285 + extra
+	default:
+		size = 65821 + extra
+	}
+	return size, offset + n, nil
+}
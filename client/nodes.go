@@ -0,0 +1,292 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Default node enrichment settings
+const (
+	DefaultNodeCacheTTL  = 10 * time.Minute
+	DefaultNodeCacheSize = 10000
+	DefaultNodeTimeout   = 5 * time.Second
+	nodeFailureBackoff   = 30 * time.Second // How long a failed lookup is cached, so an unavailable OpenNMS is not queried for every message.
+)
+
+// Kafka headers that identify the node of a message by its requisition
+const (
+	HeaderForeignSource = "foreignSource"
+	HeaderForeignID     = "foreignId"
+)
+
+// nodeLookups tracks the node lookups of the node enrichment.
+var nodeLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "onms_ipc_node_lookups_total",
+	Help: "The total number of node lookups against the OpenNMS REST API by result (hit, miss, cached or error)",
+}, []string{"result"})
+
+// NodeInfo contains the details of an OpenNMS node added to the decoded messages.
+type NodeInfo struct {
+	ID            int64             `json:"id"`
+	Label         string            `json:"label"`
+	ForeignSource string            `json:"foreignSource,omitempty"`
+	ForeignID     string            `json:"foreignId,omitempty"`
+	Location      string            `json:"location,omitempty"`
+	Categories    []string          `json:"categories,omitempty"`
+	Assets        map[string]string `json:"assets,omitempty"`
+}
+
+// nodeCacheEntry is a cached lookup, where a nil node means that the node doesn't exist or the lookup failed.
+type nodeCacheEntry struct {
+	node    *NodeInfo
+	expires time.Time
+}
+
+// NodeResolver looks up the OpenNMS nodes through the REST API, by node ID, foreign source and foreign ID, or IP address,
+// caching the results (including the unknown nodes) to avoid querying OpenNMS for every message.
+// This is a concurrent safe object.
+type NodeResolver struct {
+	URL         string        // The base URL of OpenNMS, i.e. http://opennms:8980/opennms.
+	Username    string        // The user for basic authentication (optional).
+	Password    string        `json:"-"` // The password for basic authentication; accepts secret references (optional).
+	AssetFields []string      // The asset fields added to the nodes, i.e. building and region; all the non-empty ones when empty.
+	CacheTTL    time.Duration // How long the nodes are cached (defaults to DefaultNodeCacheTTL).
+	CacheSize   int           // The maximum number of cached lookups; the cache is reset when it is full (defaults to DefaultNodeCacheSize).
+	Timeout     time.Duration // The timeout of each request (defaults to DefaultNodeTimeout).
+	Client      *http.Client  `json:"-"` // The HTTP client (optional; the timeout is ignored when provided).
+
+	mutex sync.Mutex
+	cache map[string]nodeCacheEntry
+}
+
+// Validate Verifies the node enrichment settings, applying defaults when necessary.
+func (r *NodeResolver) Validate() error {
+	if r.URL == "" {
+		return fmt.Errorf("the OpenNMS URL is required")
+	}
+	if _, err := url.Parse(r.URL); err != nil {
+		return fmt.Errorf("invalid OpenNMS URL %s: %v", r.URL, err)
+	}
+	r.URL = strings.TrimSuffix(r.URL, "/")
+	if r.CacheTTL <= 0 {
+		r.CacheTTL = DefaultNodeCacheTTL
+	}
+	if r.CacheSize <= 0 {
+		r.CacheSize = DefaultNodeCacheSize
+	}
+	if r.Timeout <= 0 {
+		r.Timeout = DefaultNodeTimeout
+	}
+	if r.Client == nil {
+		r.Client = &http.Client{Timeout: r.Timeout}
+	}
+	r.cache = make(map[string]nodeCacheEntry)
+	return nil
+}
+
+// ByID Returns a node by its ID, or nil when it doesn't exist or OpenNMS is not available.
+func (r *NodeResolver) ByID(ctx context.Context, id int64) *NodeInfo {
+	return r.resolve(ctx, "id:"+strconv.FormatInt(id, 10), "/rest/nodes/"+strconv.FormatInt(id, 10), false)
+}
+
+// ByForeignID Returns a node by its foreign source and foreign ID, or nil when it doesn't exist or OpenNMS is not available.
+func (r *NodeResolver) ByForeignID(ctx context.Context, foreignSource, foreignID string) *NodeInfo {
+	return r.resolve(ctx, "fs:"+foreignSource+":"+foreignID, "/rest/nodes/"+url.PathEscape(foreignSource+":"+foreignID), false)
+}
+
+// ByAddress Returns the node with an IP interface with the given address, or nil when there is none or OpenNMS is not available.
+func (r *NodeResolver) ByAddress(ctx context.Context, address string) *NodeInfo {
+	if net.ParseIP(address) == nil {
+		return nil
+	}
+	return r.resolve(ctx, "ip:"+address, "/rest/nodes?limit=1&ipInterface.ipAddress="+url.QueryEscape(address), true)
+}
+
+// resolve Returns a cached node, or looks it up through the REST API.
+func (r *NodeResolver) resolve(ctx context.Context, key, path string, list bool) *NodeInfo {
+	now := time.Now()
+	r.mutex.Lock()
+	entry, ok := r.cache[key]
+	r.mutex.Unlock()
+	if ok && now.Before(entry.expires) {
+		nodeLookups.WithLabelValues("cached").Inc()
+		return entry.node
+	}
+	node, err := r.fetch(ctx, path, list)
+	ttl := r.CacheTTL
+	switch {
+	case err != nil:
+		nodeLookups.WithLabelValues("error").Inc()
+		defaultLogger.Warnf("cannot lookup node %s on OpenNMS: %v", key, err)
+		ttl = nodeFailureBackoff
+	case node == nil:
+		nodeLookups.WithLabelValues("miss").Inc()
+	default:
+		nodeLookups.WithLabelValues("hit").Inc()
+	}
+	r.mutex.Lock()
+	if len(r.cache) >= r.CacheSize {
+		r.cache = make(map[string]nodeCacheEntry)
+	}
+	r.cache[key] = nodeCacheEntry{node: node, expires: now.Add(ttl)}
+	r.mutex.Unlock()
+	return node
+}
+
+// onmsNode represents the relevant fields of a node from the OpenNMS REST API.
+type onmsNode struct {
+	ID            json.Number `json:"id"`
+	Label         string      `json:"label"`
+	ForeignSource string      `json:"foreignSource"`
+	ForeignID     string      `json:"foreignId"`
+	Location      string      `json:"location"`
+	Categories    []struct {
+		Name string `json:"name"`
+	} `json:"categories"`
+	AssetRecord map[string]interface{} `json:"assetRecord"`
+}
+
+// fetch Retrieves a node, or the first node of a list, from the REST API; it returns nil when the node doesn't exist.
+func (r *NodeResolver) fetch(ctx context.Context, path string, list bool) (*NodeInfo, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if r.Username != "" {
+		password, err := ResolveSecret(r.Password)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve OpenNMS password: %v", err)
+		}
+		req.SetBasicAuth(r.Username, password)
+	}
+	res, err := r.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot send request to %s: %v", req.URL.Host, err)
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusNoContent:
+		return nil, nil
+	case res.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("unexpected response from %s: %s", req.URL.Host, res.Status)
+	}
+	node := &onmsNode{}
+	decoder := json.NewDecoder(res.Body)
+	if list {
+		nodes := struct {
+			Node []*onmsNode `json:"node"`
+		}{}
+		if err := decoder.Decode(&nodes); err != nil {
+			return nil, fmt.Errorf("invalid nodes from %s: %v", req.URL.Host, err)
+		}
+		if len(nodes.Node) == 0 {
+			return nil, nil
+		}
+		node = nodes.Node[0]
+	} else if err := decoder.Decode(node); err != nil {
+		return nil, fmt.Errorf("invalid node from %s: %v", req.URL.Host, err)
+	}
+	return r.nodeInfo(node), nil
+}
+
+// nodeInfo Converts a node from the REST API, keeping the selected asset fields.
+func (r *NodeResolver) nodeInfo(node *onmsNode) *NodeInfo {
+	id, _ := node.ID.Int64()
+	info := &NodeInfo{ID: id, Label: node.Label, ForeignSource: node.ForeignSource, ForeignID: node.ForeignID, Location: node.Location}
+	for _, c := range node.Categories {
+		info.Categories = append(info.Categories, c.Name)
+	}
+	sort.Strings(info.Categories)
+	for key, value := range node.AssetRecord {
+		if key == "id" || value == nil || (len(r.AssetFields) > 0 && !containsString(r.AssetFields, key, false)) {
+			continue
+		}
+		switch v := value.(type) {
+		case map[string]interface{}, []interface{}:
+			continue
+		case string:
+			if v == "" {
+				continue
+			}
+		}
+		if info.Assets == nil {
+			info.Assets = make(map[string]string)
+		}
+		info.Assets[key] = fmt.Sprint(value)
+	}
+	return info
+}
+
+// EnrichNodes Returns a middleware that adds the OpenNMS node of each decoded message to its payload as node.
+// The node is identified by the foreignSource and foreignId Kafka headers when present, or by the source address of the message otherwise;
+// the events with a nodeId get their own node instead. Messages without a known node are left untouched, including when OpenNMS is not available.
+// The payload is handled as generic JSON, so the fields are sorted by name.
+func EnrichNodes(r *NodeResolver) Middleware {
+	return func(ctx *MessageContext) error {
+		var payload map[string]json.RawMessage
+		if err := json.Unmarshal(ctx.Message.Payload, &payload); err != nil {
+			return nil // Not JSON, i.e. the RPC API or the raw telemetry
+		}
+		if isEvents(ctx.Message.Parser) {
+			return enrichEvents(ctx, r, payload)
+		}
+		var node *NodeInfo
+		msg := ctx.Message
+		if fs, fid := msg.Headers[HeaderForeignSource], msg.Headers[HeaderForeignID]; fs != "" && fid != "" {
+			node = r.ByForeignID(ctx.Context, fs, fid)
+		} else if msg.Metadata.SourceAddress != "" {
+			node = r.ByAddress(ctx.Context, msg.Metadata.SourceAddress)
+		}
+		if node == nil {
+			return nil
+		}
+		payload["node"], _ = json.Marshal(node)
+		return ctx.Encode(payload)
+	}
+}
+
+// enrichEvents Adds the node to each event with a nodeId, or with an interface when the event has no node.
+func enrichEvents(ctx *MessageContext, r *NodeResolver, eventLog map[string]json.RawMessage) error {
+	var events []map[string]json.RawMessage
+	if err := json.Unmarshal(eventLog["events"], &events); err != nil {
+		return nil
+	}
+	enriched := false
+	for _, event := range events {
+		var id int64
+		var address string
+		var node *NodeInfo
+		if json.Unmarshal(event["nodeId"], &id); id > 0 {
+			node = r.ByID(ctx.Context, id)
+		} else if json.Unmarshal(event["interface"], &address); address != "" {
+			node = r.ByAddress(ctx.Context, address)
+		}
+		if node != nil {
+			event["node"], _ = json.Marshal(node)
+			enriched = true
+		}
+	}
+	if !enriched {
+		return nil
+	}
+	eventLog["events"], _ = json.Marshal(events)
+	return ctx.Encode(eventLog)
+}
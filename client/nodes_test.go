@@ -0,0 +1,100 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestEnrichNodes(t *testing.T) {
+	var mutex sync.Mutex
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		assert.Assert(t, ok && user == "admin" && password == "admin")
+		assert.Equal(t, "application/json", r.Header.Get("Accept"))
+		mutex.Lock()
+		requests[r.URL.RequestURI()]++
+		mutex.Unlock()
+		node := `{"id":"%d","label":"%s","foreignSource":"Routers","foreignId":"%s","location":"Apex","categories":[{"id":2,"name":"Production"},{"id":1,"name":"Core"}],"assetRecord":{"id":7,"building":"HQ","region":"","rack":null,"geolocation":{"latitude":1}}}`
+		switch r.URL.RequestURI() {
+		case "/opennms/rest/nodes?limit=1&ipInterface.ipAddress=10.0.0.1":
+			fmt.Fprintf(w, `{"count":1,"totalCount":1,"node":[`+node+`]}`, 1, "router01", "r01")
+		case "/opennms/rest/nodes?limit=1&ipInterface.ipAddress=10.0.0.2":
+			fmt.Fprint(w, `{"count":0,"totalCount":0,"node":[]}`)
+		case "/opennms/rest/nodes/Routers:r02":
+			fmt.Fprintf(w, node, 2, "router02", "r02")
+		case "/opennms/rest/nodes/3":
+			fmt.Fprintf(w, node, 3, "router03", "r03")
+		case "/opennms/rest/nodes/4":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	resolver := &NodeResolver{URL: server.URL + "/opennms/", Username: "admin", Password: "admin"}
+	assert.NilError(t, resolver.Validate())
+	expected := &NodeInfo{ID: 1, Label: "router01", ForeignSource: "Routers", ForeignID: "r01", Location: "Apex", Categories: []string{"Core", "Production"}, Assets: map[string]string{"building": "HQ"}}
+	assert.DeepEqual(t, expected, resolver.ByAddress(context.Background(), "10.0.0.1"))
+	assert.DeepEqual(t, expected, resolver.ByAddress(context.Background(), "10.0.0.1"))
+	assert.Equal(t, 1, requests["/opennms/rest/nodes?limit=1&ipInterface.ipAddress=10.0.0.1"])
+	assert.Assert(t, resolver.ByAddress(context.Background(), "10.0.0.2") == nil)
+	assert.Assert(t, resolver.ByAddress(context.Background(), "invalid") == nil)
+	assert.Assert(t, resolver.ByID(context.Background(), 4) == nil)
+	assert.Assert(t, resolver.ByID(context.Background(), 4) == nil)
+	assert.Equal(t, 1, requests["/opennms/rest/nodes/4"])
+
+	// By the foreign source and ID from the headers, or by the source address
+	enrich := EnrichNodes(resolver)
+	mc := &MessageContext{Context: context.Background(), Message: DecodedMessage{
+		Parser:   "syslog",
+		Metadata: Metadata{SourceAddress: "10.0.0.1"},
+		Headers:  map[string]string{HeaderForeignSource: "Routers", HeaderForeignID: "r02"},
+		Payload:  []byte(`{"sourceAddress":"10.0.0.1","messages":[]}`),
+	}}
+	assert.NilError(t, enrich(mc))
+	payload := struct {
+		Node *NodeInfo `json:"node"`
+	}{}
+	assert.NilError(t, json.Unmarshal(mc.Message.Payload, &payload))
+	assert.Equal(t, "router02", payload.Node.Label)
+	mc.Message.Headers = nil
+	assert.NilError(t, enrich(mc))
+	assert.NilError(t, json.Unmarshal(mc.Message.Payload, &payload))
+	assert.Equal(t, "router01", payload.Node.Label)
+
+	// Each event gets its own node
+	mc = &MessageContext{Context: context.Background(), Message: DecodedMessage{
+		Parser:  "events",
+		Payload: []byte(`{"events":[{"uei":"uei.opennms.org/test","nodeId":3},{"uei":"uei.opennms.org/test","interface":"10.0.0.1"},{"uei":"uei.opennms.org/test"}]}`),
+	}}
+	assert.NilError(t, enrich(mc))
+	events := struct {
+		Events []struct {
+			Node *NodeInfo `json:"node"`
+		} `json:"events"`
+	}{}
+	assert.NilError(t, json.Unmarshal(mc.Message.Payload, &events))
+	assert.Equal(t, 3, len(events.Events))
+	assert.Equal(t, "router03", events.Events[0].Node.Label)
+	assert.Equal(t, "router01", events.Events[1].Node.Label)
+	assert.Assert(t, events.Events[2].Node == nil)
+
+	// Messages without a known node are left untouched
+	raw := []byte(`not json`)
+	mc = &MessageContext{Context: context.Background(), Message: DecodedMessage{Parser: "rpc", Payload: raw}}
+	assert.NilError(t, enrich(mc))
+	assert.DeepEqual(t, raw, mc.Message.Payload)
+
+	assert.ErrorContains(t, (&NodeResolver{}).Validate(), "the OpenNMS URL is required")
+}
@@ -0,0 +1,197 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// otelInstrumentation identifies the spans created by the client.
+const otelInstrumentation = "github.com/agalue/onms-kafka-ipc-receiver/client"
+
+// DefaultOTLPServiceName is the default service name of the spans exported through OTLP.
+const DefaultOTLPServiceName = "onms-kafka-ipc-receiver"
+
+// OTLPConfig contains the settings to export the OpenTelemetry spans to a collector through OTLP/gRPC.
+// The client creates a span for each chunk, a span for each reassembled message linked to the spans of its chunks,
+// and child spans for decoding the payload and delivering it to each output. The spans continue the traces propagated
+// by the producer through the W3C trace context or the B3 headers, either on the tracing info of the IPC messages or on the Kafka headers.
+type OTLPConfig struct {
+	Endpoint    string  // The address of the collector, i.e. localhost:4317.
+	Insecure    bool    // Whether or not to disable TLS.
+	ServiceName string  // The name of the service on the exported spans (defaults to DefaultOTLPServiceName).
+	SampleRatio float64 // The fraction of the new traces to sample (defaults to 1); the decision of the producer is honored otherwise.
+}
+
+// Enabled Returns true when the spans should be exported.
+func (c *OTLPConfig) Enabled() bool {
+	return c.Endpoint != ""
+}
+
+// Setup Registers the OTLP exporter as the global tracer provider, returning a function to flush the pending spans and stop it.
+func (c *OTLPConfig) Setup(ctx context.Context) (func(ctx context.Context) error, error) {
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return nil, fmt.Errorf("invalid sample ratio %f; expecting a value between 0 and 1", c.SampleRatio)
+	}
+	if c.SampleRatio == 0 {
+		c.SampleRatio = 1
+	}
+	if c.ServiceName == "" {
+		c.ServiceName = DefaultOTLPServiceName
+	}
+	options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(c.Endpoint)}
+	if c.Insecure {
+		options = append(options, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create OTLP exporter: %v", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(c.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(c.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, b3Propagator{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// otelTracer Returns the tracer of the client from the global provider, whose spans are no-ops unless an SDK was registered.
+func otelTracer() oteltrace.Tracer {
+	return otel.Tracer(otelInstrumentation)
+}
+
+// mapCarrier adapts the tracing info of the IPC messages and the Kafka headers to extract the propagated trace context.
+type mapCarrier map[string]string
+
+// Get Returns the value of a key.
+func (c mapCarrier) Get(key string) string {
+	return c[key]
+}
+
+// Set Sets the value of a key.
+func (c mapCarrier) Set(key string, value string) {
+	c[key] = value
+}
+
+// Keys Returns the keys of the carrier.
+func (c mapCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// messageSpanKey is used to attach the span of a reassembled message to the context of its last chunk.
+type messageSpanKey struct{}
+
+// startChunkSpan Starts the span of a chunk, continuing the trace of the producer when available.
+func startChunkSpan(msg *message.Message, ipcmsg *ipcMessage, start time.Time) (context.Context, oteltrace.Span) {
+	propagator := otel.GetTextMapPropagator()
+	ctx := propagator.Extract(context.Background(), mapCarrier(ipcmsg.tracing))
+	if !oteltrace.SpanContextFromContext(ctx).IsValid() {
+		ctx = propagator.Extract(context.Background(), mapCarrier(msg.Metadata))
+	}
+	return otelTracer().Start(ctx, ipcmsg.topic+" receive",
+		oteltrace.WithTimestamp(start),
+		oteltrace.WithSpanKind(oteltrace.SpanKindConsumer),
+		oteltrace.WithAttributes(
+			semconv.MessagingSystemKey.String("kafka"),
+			semconv.MessagingDestinationKey.String(ipcmsg.topic),
+			semconv.MessagingDestinationKindTopic,
+			semconv.MessagingOperationReceive,
+			semconv.MessagingMessageIDKey.String(ipcmsg.id),
+			semconv.MessagingKafkaPartitionKey.Int64(int64(ipcmsg.partition)),
+			attribute.Int64("messaging.kafka.offset", ipcmsg.offset),
+			attribute.String("onms.ipc.chunk", strconv.Itoa(int(ipcmsg.chunk))+"/"+strconv.Itoa(int(ipcmsg.total))),
+		),
+	)
+}
+
+// startMessageSpan Starts the span of a reassembled message, as a child of the span of its last chunk, linked to the spans of all its chunks.
+// The span is attached to the context of the last chunk, and must be finished through endMessageSpan.
+func startMessageSpan(ctx context.Context, msg *message.Message, ipcmsg *ipcMessage, links []oteltrace.Link, size int) {
+	_, span := otelTracer().Start(ctx, ipcmsg.topic+" process",
+		oteltrace.WithLinks(links...),
+		oteltrace.WithAttributes(
+			semconv.MessagingSystemKey.String("kafka"),
+			semconv.MessagingDestinationKey.String(ipcmsg.topic),
+			semconv.MessagingOperationProcess,
+			semconv.MessagingMessageIDKey.String(ipcmsg.id),
+			attribute.Int("onms.ipc.chunks", int(ipcmsg.total)),
+			semconv.MessagingMessagePayloadSizeBytesKey.Int(size),
+		),
+	)
+	msg.SetContext(context.WithValue(msg.Context(), messageSpanKey{}, span))
+}
+
+// messageSpan Returns the span of the reassembled message of a chunk, or a no-op span when the message is not complete.
+func messageSpan(msg *message.Message) oteltrace.Span {
+	if span, ok := msg.Context().Value(messageSpanKey{}).(oteltrace.Span); ok {
+		return span
+	}
+	return oteltrace.SpanFromContext(context.Background())
+}
+
+// endMessageSpan Finishes the span of the reassembled message of a chunk, if any.
+func endMessageSpan(msg *message.Message) {
+	messageSpan(msg).End()
+}
+
+// failSpan Flags a span as failed.
+func failSpan(span oteltrace.Span, reason string) {
+	span.SetStatus(codes.Error, reason)
+}
+
+// resultAttribute Returns the attribute with the outcome of the processing of a message.
+func resultAttribute(result string) attribute.KeyValue {
+	return attribute.String("onms.ipc.result", result)
+}
+
+// startDecodeSpan Starts the span for decoding the payload of a reassembled message, as a child of its span.
+func startDecodeSpan(msg *message.Message, parser string) oteltrace.Span {
+	ctx := oteltrace.ContextWithSpan(context.Background(), messageSpan(msg))
+	_, span := otelTracer().Start(ctx, "decode "+parser, oteltrace.WithAttributes(attribute.String("onms.ipc.parser", parser)))
+	return span
+}
+
+// endDecodeSpan Finishes the span for decoding a payload with the number of decoded messages, failing it when there are none.
+func endDecodeSpan(span oteltrace.Span, decoded int) {
+	span.SetAttributes(attribute.Int("onms.ipc.decoded", decoded))
+	if decoded == 0 {
+		failSpan(span, "no message decoded")
+	}
+	span.End()
+}
+
+// startOutputSpan Starts the span for delivering a decoded message to an output, as a child of the span of the reassembled message.
+// The returned context carries the span, so outputs can propagate it.
+func startOutputSpan(ctx context.Context, msg DecodedMessage, output Output) (context.Context, oteltrace.Span) {
+	ctx = oteltrace.ContextWithSpanContext(ctx, msg.spanContext)
+	return otelTracer().Start(ctx, "output "+output.Name(), oteltrace.WithSpanKind(oteltrace.SpanKindProducer))
+}
+
+// endOutputSpan Finishes the span for delivering a message to an output, recording the error if any.
+func endOutputSpan(span oteltrace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		failSpan(span, outputResult(err)+" failure")
+	}
+	span.End()
+}
@@ -0,0 +1,98 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"gotest.tools/v3/assert"
+)
+
+func TestOpenTelemetrySpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(oteltrace.NewNoopTracerProvider())
+
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	cli.Parser = "heartbeat"
+	cli.Outputs = []Output{&countingOutput{name: "webhook:alerts"}}
+	handler := func(msg DecodedMessage) error { return nil }
+
+	first := buildMessage("0001", 0, 2, []byte("ABC"))
+	first.Metadata = message.Metadata{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+	cli.handleMessage(first, handler)
+	cli.handleMessage(buildMessage("0001", 1, 2, []byte("DEF")), handler)
+	cli.handleMessage(buildMessage("0002", 2, 3, []byte("GHI")), handler) // Missing chunks
+
+	spans := map[string][]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = append(spans[span.Name()], span)
+	}
+	assert.Equal(t, 3, len(spans["Test receive"]))
+	receive := spans["Test receive"]
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", receive[0].SpanContext().TraceID().String()) // Continues the producer trace
+	assert.Equal(t, codes.Error, receive[2].Status().Code)
+
+	assert.Equal(t, 1, len(spans["Test process"]))
+	process := spans["Test process"][0]
+	assert.Equal(t, receive[1].SpanContext().SpanID(), process.Parent().SpanID())
+	assert.Equal(t, 2, len(process.Links()))
+	assert.Assert(t, receive[0].SpanContext().Equal(process.Links()[0].SpanContext))
+	assert.Assert(t, receive[1].SpanContext().Equal(process.Links()[1].SpanContext))
+
+	assert.Equal(t, 1, len(spans["decode heartbeat"]))
+	assert.Equal(t, process.SpanContext().SpanID(), spans["decode heartbeat"][0].Parent().SpanID())
+	assert.Equal(t, 1, len(spans["output webhook:alerts"]))
+	assert.Equal(t, process.SpanContext().SpanID(), spans["output webhook:alerts"][0].Parent().SpanID())
+}
+
+func TestOTLPConfig(t *testing.T) {
+	config := &OTLPConfig{}
+	assert.Assert(t, !config.Enabled())
+	config = &OTLPConfig{Endpoint: "127.0.0.1:4317", SampleRatio: 2}
+	assert.Assert(t, config.Enabled())
+	_, err := config.Setup(nil)
+	assert.ErrorContains(t, err, "invalid sample ratio")
+}
+
+func TestB3Propagator(t *testing.T) {
+	propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, b3Propagator{})
+	extract := func(headers map[string]string) oteltrace.SpanContext {
+		return oteltrace.SpanContextFromContext(propagator.Extract(context.Background(), mapCarrier(headers)))
+	}
+
+	sc := extract(map[string]string{"b3": "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90"})
+	assert.Equal(t, "80f198ee56343ba864fe8b2a57d3eff7", sc.TraceID().String())
+	assert.Equal(t, "e457b5a2e4d86bd1", sc.SpanID().String())
+	assert.Assert(t, sc.IsSampled() && sc.IsRemote())
+
+	// The multiple headers are matched case-insensitively, and the 64-bit trace IDs are padded
+	sc = extract(map[string]string{"X-B3-TraceId": "a3ce929d0e0e4736", "X-B3-SpanId": "00f067aa0ba902b7", "X-B3-Sampled": "0"})
+	assert.Equal(t, "0000000000000000a3ce929d0e0e4736", sc.TraceID().String())
+	assert.Assert(t, !sc.IsSampled())
+
+	// The W3C trace context takes precedence
+	sc = extract(map[string]string{
+		"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"b3":          "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1",
+	})
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID().String())
+
+	assert.Assert(t, !extract(map[string]string{"b3": "1"}).IsValid())
+	assert.Assert(t, !extract(map[string]string{"b3": "invalid-id"}).IsValid())
+
+	headers := mapCarrier{}
+	b3Propagator{}.Inject(oteltrace.ContextWithSpanContext(context.Background(), sc), headers)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1", headers["b3"])
+}
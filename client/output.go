@@ -0,0 +1,153 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Output represents a destination for the decoded messages.
+type Output interface {
+	// Name Returns a unique name that identifies the destination.
+	Name() string
+	// Send Forwards a decoded message to the destination.
+	// The context is canceled on shutdown, or when the message deadline expires.
+	Send(ctx context.Context, msg DecodedMessage) error
+}
+
+// Output results
+const (
+	OutputSuccess   = "success"
+	OutputRetryable = "retryable"
+	OutputPermanent = "permanent"
+)
+
+// OutputError represents a failure sending a message to an output.
+type OutputError struct {
+	Err       error
+	Retryable bool // True when the same message might be accepted later, for instance on network errors or when the destination is overloaded.
+}
+
+func (e *OutputError) Error() string {
+	return e.Err.Error()
+}
+
+// outputResult Classifies the result of sending a message to an output.
+// Unclassified errors are considered permanent.
+func outputResult(err error) string {
+	if err == nil {
+		return OutputSuccess
+	}
+	if e, ok := err.(*OutputError); ok && e.Retryable {
+		return OutputRetryable
+	}
+	return OutputPermanent
+}
+
+// defaultHTTPClient is used by the outputs when no client is provided.
+var defaultHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// sendOutputs Forwards a decoded message to all the configured outputs, based on the delivery mode of each of them.
+// Failures are logged, so a broken destination doesn't interrupt the consumer; the retryable failures of the outputs
+// with at-least-once or exactly-once delivery are retried, returning false when the client stops first.
+// The results and latency are tracked per output, so slow or broken destinations can be identified.
+// All the outputs share the same deadline, based on the output timeout, which is renewed on each retry.
+func (cli *KafkaClient) sendOutputs(msg DecodedMessage) bool {
+	if len(cli.Outputs) == 0 {
+		return true
+	}
+	ctx, cancel := cli.outputContext()
+	defer func() { cancel() }()
+	for _, output := range cli.Outputs {
+		if !cli.outputRoutes().allows(output, msg.Headers) {
+			cli.trace(msg.id, "not routed to %s", output.Name())
+			continue
+		}
+		mode := cli.OutputDelivery.modeOf(output)
+		for !cli.sendOutput(ctx, output, msg) && mode != DeliveryAtMostOnce {
+			select {
+			case <-time.After(cli.CommitRetryDelay):
+			case <-cli.done:
+				return false
+			}
+			if !cli.breaker.wait(cli.done) { // Don't retry against a broken destination while the circuit is open
+				return false
+			}
+			cancel()
+			ctx, cancel = cli.outputContext()
+		}
+	}
+	return true
+}
+
+// outputContext Returns the context to send a message to the outputs, with the output timeout as the deadline.
+func (cli *KafkaClient) outputContext() (context.Context, context.CancelFunc) {
+	ctx := cli.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if cli.OutputTimeout > 0 {
+		return context.WithTimeout(ctx, cli.OutputTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// sendOutput Sends a decoded message to an output, returning false on retryable failures.
+func (cli *KafkaClient) sendOutput(ctx context.Context, output Output, msg DecodedMessage) bool {
+	start := time.Now()
+	spanCtx, span := startOutputSpan(ctx, msg, output)
+	err := output.Send(spanCtx, msg)
+	endOutputSpan(span, err)
+	result := outputResult(err)
+	cli.breaker.record(result == OutputRetryable, time.Since(start), time.Now())
+	if cli.outputResults != nil {
+		cli.outputLatency.WithLabelValues(output.Name()).Observe(time.Since(start).Seconds())
+		cli.outputResults.WithLabelValues(output.Name(), result).Inc()
+	}
+	if err != nil {
+		cli.logger().Errorf("cannot send message %s to %s (%s failure): %v", msg.Coordinates(), output.Name(), result, err)
+		cli.trace(msg.id, "cannot send to %s (%s failure): %v", output.Name(), result, err)
+	} else {
+		cli.trace(msg.id, "sent to %s in %s", output.Name(), time.Since(start))
+	}
+	return result != OutputRetryable
+}
+
+// postJSON Sends an object as JSON through an HTTP POST request, expecting a successful response.
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("cannot encode request: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("cannot create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return &OutputError{Err: fmt.Errorf("cannot send request to %s: %v", url, err), Retryable: true}
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return &OutputError{
+			Err:       fmt.Errorf("unexpected response from %s: %s %s", url, res.Status, string(bytes.TrimSpace(msg))),
+			Retryable: res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestPostJSONResults(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	url := server.URL
+	body := map[string]string{"id": "0001"}
+
+	assert.Equal(t, OutputSuccess, outputResult(postJSON(context.Background(), nil, url, nil, body)))
+	status = http.StatusServiceUnavailable
+	assert.Equal(t, OutputRetryable, outputResult(postJSON(context.Background(), nil, url, nil, body)))
+	status = http.StatusTooManyRequests
+	assert.Equal(t, OutputRetryable, outputResult(postJSON(context.Background(), nil, url, nil, body)))
+	status = http.StatusBadRequest
+	assert.Equal(t, OutputPermanent, outputResult(postJSON(context.Background(), nil, url, nil, body)))
+	server.Close()
+	assert.Equal(t, OutputRetryable, outputResult(postJSON(context.Background(), nil, url, nil, body)))
+	assert.Equal(t, OutputPermanent, outputResult(fmt.Errorf("invalid message")))
+}
+
+// slowOutput waits for the context to expire.
+type slowOutput struct {
+	err error
+}
+
+func (out *slowOutput) Name() string {
+	return "slow"
+}
+
+func (out *slowOutput) Send(ctx context.Context, msg DecodedMessage) error {
+	<-ctx.Done()
+	out.err = ctx.Err()
+	return out.err
+}
+
+func TestOutputTimeout(t *testing.T) {
+	out := &slowOutput{}
+	cli := &KafkaClient{Outputs: []Output{out}, OutputTimeout: 10 * time.Millisecond}
+	cli.sendOutputs(DecodedMessage{})
+	assert.Equal(t, context.DeadlineExceeded, out.err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, OutputRetryable, outputResult(postJSON(ctx, nil, server.URL, nil, "{}")))
+}
@@ -0,0 +1,243 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// TopicPartition identifies a partition of a given topic.
+type TopicPartition struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+}
+
+func (tp TopicPartition) String() string {
+	return fmt.Sprintf("%s/%d", tp.Topic, tp.Partition)
+}
+
+// partitionWindow tracks the number of messages received from a partition within the current second.
+type partitionWindow struct {
+	start time.Time
+	count int
+}
+
+// partitionController pauses individual partitions, either manually or automatically when they are too hot.
+//
+// A paused partition has its next message held without being acknowledged. As the consumer waits for the
+// acknowledgement before delivering the next message of the same partition, that effectively pauses the
+// partition without affecting the rest of the subscription.
+// This is a concurrent safe object.
+type partitionController struct {
+	maxRate int // Maximum number of messages per second per partition (0 to disable).
+
+	mutex   sync.Mutex
+	paused  map[TopicPartition]bool
+	windows map[TopicPartition]*partitionWindow
+	held    map[TopicPartition]*message.Message
+	resumed chan *message.Message
+
+	onPause func(tp TopicPartition, reason string)
+}
+
+// newPartitionController creates a new controller.
+func newPartitionController(maxRate int) *partitionController {
+	return &partitionController{
+		maxRate: maxRate,
+		paused:  make(map[TopicPartition]bool),
+		windows: make(map[TopicPartition]*partitionWindow),
+		held:    make(map[TopicPartition]*message.Message),
+		resumed: make(chan *message.Message, 64),
+	}
+}
+
+// hold Returns true when the message was held because its partition is paused or too hot.
+// Held messages are sent to the resumed channel once the partition can be processed again.
+func (pc *partitionController) hold(topic string, msg *message.Message, now time.Time) bool {
+	partition := getPartition(msg)
+	if partition < 0 {
+		return false
+	}
+	return pc.holdFrom(TopicPartition{topic, partition}, msg, now)
+}
+
+// holdFrom Returns true when the message from a given partition was held.
+func (pc *partitionController) holdFrom(partition TopicPartition, msg *message.Message, now time.Time) bool {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	if pc.paused[partition] {
+		pc.held[partition] = msg
+		return true
+	}
+	if pc.maxRate <= 0 {
+		return false
+	}
+	window, ok := pc.windows[partition]
+	if !ok || now.Sub(window.start) >= time.Second {
+		window = &partitionWindow{start: now}
+		pc.windows[partition] = window
+	}
+	window.count++
+	if window.count <= pc.maxRate {
+		return false
+	}
+	pc.held[partition] = msg
+	delete(pc.windows, partition) // The held message starts the next window
+	if pc.onPause != nil {
+		pc.onPause(partition, "hot")
+	}
+	time.AfterFunc(window.start.Add(time.Second).Sub(now), func() {
+		pc.release(partition, false)
+	})
+	return true
+}
+
+// setMaxRate Updates the maximum number of messages per second per partition.
+func (pc *partitionController) setMaxRate(maxRate int) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	pc.maxRate = maxRate
+}
+
+// release Sends the held message of a partition to the resumed channel.
+// Manually paused partitions are only released when forced.
+func (pc *partitionController) release(partition TopicPartition, force bool) {
+	pc.mutex.Lock()
+	if force {
+		delete(pc.paused, partition)
+	}
+	msg, ok := pc.held[partition]
+	if !ok || pc.paused[partition] {
+		pc.mutex.Unlock()
+		return
+	}
+	delete(pc.held, partition)
+	pc.mutex.Unlock()
+	pc.resumed <- msg
+}
+
+// pause Pauses a partition until it is manually resumed.
+func (pc *partitionController) pause(partition TopicPartition) {
+	pc.mutex.Lock()
+	pc.paused[partition] = true
+	pc.mutex.Unlock()
+	if pc.onPause != nil {
+		pc.onPause(partition, "manual")
+	}
+}
+
+// pausedPartitions Returns the partitions that are manually paused, or throttled because they are too hot.
+func (pc *partitionController) pausedPartitions() []TopicPartition {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	partitions := make([]TopicPartition, 0, len(pc.held))
+	for p := range pc.paused {
+		partitions = append(partitions, p)
+	}
+	for p := range pc.held {
+		if !pc.paused[p] {
+			partitions = append(partitions, p)
+		}
+	}
+	sort.Slice(partitions, func(i, j int) bool {
+		if partitions[i].Topic == partitions[j].Topic {
+			return partitions[i].Partition < partitions[j].Partition
+		}
+		return partitions[i].Topic < partitions[j].Topic
+	})
+	return partitions
+}
+
+// PausePartition Stops processing messages from a given partition of a topic until ResumePartition is called,
+// without pausing the rest of the subscription.
+func (cli *KafkaClient) PausePartition(topic string, partition int32) {
+	cli.partitions.pause(TopicPartition{topic, partition})
+}
+
+// ResumePartition Resumes processing messages from a given partition of a topic.
+func (cli *KafkaClient) ResumePartition(topic string, partition int32) {
+	cli.logger().Infof("resuming partition %d of %s", partition, topic)
+	go cli.partitions.release(TopicPartition{topic, partition}, true)
+}
+
+// PausedPartitions Returns the partitions that are currently paused, either manually or because they are too hot.
+func (cli *KafkaClient) PausedPartitions() []TopicPartition {
+	if cli.partitions == nil {
+		return []TopicPartition{}
+	}
+	return cli.partitions.pausedPartitions()
+}
+
+// consumptionGate blocks the poll loop while the consumption is paused on demand.
+// This is a concurrent safe object.
+type consumptionGate struct {
+	mutex   sync.Mutex
+	resumed chan struct{} // Closed when resumed, or nil when not paused.
+}
+
+// setPaused Pauses or resumes the consumption, returning false when it was already in that state.
+func (g *consumptionGate) setPaused(paused bool) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if paused == (g.resumed != nil) {
+		return false
+	}
+	if paused {
+		g.resumed = make(chan struct{})
+	} else {
+		close(g.resumed)
+		g.resumed = nil
+	}
+	return true
+}
+
+// paused Returns true when the consumption is paused.
+func (g *consumptionGate) paused() bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.resumed != nil
+}
+
+// wait Blocks while the consumption is paused, or until the done channel is closed.
+// Returns true if the consumption is not paused.
+func (g *consumptionGate) wait(done <-chan struct{}) bool {
+	g.mutex.Lock()
+	resumed := g.resumed
+	g.mutex.Unlock()
+	if resumed == nil {
+		return true
+	}
+	select {
+	case <-resumed:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// Pause Stops reading messages from all the partitions until Resume is called.
+// Unlike closing the client, the consumer keeps its membership on the group, so the partitions are not rebalanced,
+// and the partial messages stay in the reassembly buffer. The pause is kept when the pipeline restarts the client.
+// It does nothing when the client was not initialized.
+func (cli *KafkaClient) Pause() {
+	if cli.gate != nil && cli.gate.setPaused(true) {
+		cli.logger().Infof("pausing consumption of %s on demand", cli.Topic)
+	}
+}
+
+// Resume Resumes reading messages after Pause.
+func (cli *KafkaClient) Resume() {
+	if cli.gate != nil && cli.gate.setPaused(false) {
+		cli.logger().Infof("resuming consumption of %s on demand", cli.Topic)
+	}
+}
+
+// Paused Returns true when the consumption was paused through Pause.
+func (cli *KafkaClient) Paused() bool {
+	return cli.gate != nil && cli.gate.paused()
+}
@@ -0,0 +1,131 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PayloadRefKey is the tracing info entry or Kafka header that carries the reference to an offloaded payload.
+const PayloadRefKey = "payload-ref"
+
+// maxPayloadSize is the maximum size of an offloaded payload.
+const maxPayloadSize = 256 * 1024 * 1024
+
+// PayloadStore fetches payloads offloaded to an external store, like a filesystem or an S3 bucket shared with OpenNMS.
+type PayloadStore interface {
+	// Fetch Returns the content of an offloaded payload given its reference as a URI.
+	Fetch(ref *url.URL) ([]byte, error)
+}
+
+// PayloadStores is a PayloadStore that delegates to the store registered for the scheme of each reference.
+type PayloadStores map[string]PayloadStore
+
+// Fetch Returns the content of an offloaded payload, using the store registered for the scheme of the reference.
+func (s PayloadStores) Fetch(ref *url.URL) ([]byte, error) {
+	store, ok := s[ref.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("no payload store for scheme %q", ref.Scheme)
+	}
+	return store.Fetch(ref)
+}
+
+// FileStore reads offloaded payloads from a directory shared with OpenNMS, with references like file:///shared/payloads/0001.
+// References outside the root directory are rejected.
+type FileStore struct {
+	Root string
+}
+
+// Fetch Returns the content of a file within the root directory.
+func (s *FileStore) Fetch(ref *url.URL) ([]byte, error) {
+	root, err := filepath.Abs(s.Root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid root directory %s: %v", s.Root, err)
+	}
+	path := filepath.Clean(filepath.FromSlash(ref.Path))
+	if !strings.HasPrefix(path, root+string(filepath.Separator)) {
+		return nil, fmt.Errorf("%s is outside of %s", path, root)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open payload: %v", err)
+	}
+	defer file.Close()
+	return readPayload(file)
+}
+
+// HTTPStore downloads offloaded payloads through HTTP(S), for instance, from pre-signed S3 URLs.
+type HTTPStore struct {
+	Client *http.Client // The HTTP client (optional).
+}
+
+// Fetch Downloads the payload from the reference URL.
+func (s *HTTPStore) Fetch(ref *url.URL) ([]byte, error) {
+	return httpGetPayload(s.Client, ref.String())
+}
+
+// S3Store downloads offloaded payloads from an S3 compatible endpoint, with references like s3://bucket/key.
+// It uses path-style URLs without signing the requests, so the bucket must allow reads from the receiver (i.e. through a bucket or VPC endpoint policy).
+type S3Store struct {
+	Endpoint string       // The S3 endpoint, i.e. https://s3.us-east-1.amazonaws.com
+	Client   *http.Client // The HTTP client (optional).
+}
+
+// Fetch Downloads the object referenced as s3://bucket/key.
+func (s *S3Store) Fetch(ref *url.URL) ([]byte, error) {
+	if ref.Host == "" || ref.Path == "" {
+		return nil, fmt.Errorf("invalid S3 reference %s; expecting s3://bucket/key", ref)
+	}
+	return httpGetPayload(s.Client, strings.TrimSuffix(s.Endpoint, "/")+"/"+ref.Host+ref.EscapedPath())
+}
+
+// httpGetPayload Downloads a payload through an HTTP GET request.
+func httpGetPayload(client *http.Client, url string) ([]byte, error) {
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	res, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("cannot download payload: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot download payload: %s", res.Status)
+	}
+	return readPayload(res.Body)
+}
+
+// readPayload Reads a payload, limiting its size.
+func readPayload(reader io.Reader) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(reader, maxPayloadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read payload: %v", err)
+	}
+	if len(data) > maxPayloadSize {
+		return nil, fmt.Errorf("payload exceeds %d bytes", maxPayloadSize)
+	}
+	return data, nil
+}
+
+// fetchPayload Returns the content of the offloaded payload referenced by an IPC message.
+func (cli *KafkaClient) fetchPayload(ref string) ([]byte, error) {
+	if cli.PayloadStore == nil {
+		return nil, fmt.Errorf("no payload store configured")
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload reference %s: %v", ref, err)
+	}
+	data, err := cli.PayloadStore.Fetch(u)
+	if cli.offloadedPayloads != nil {
+		cli.offloadedPayloads.WithLabelValues(outputResult(err)).Inc()
+	}
+	return data, err
+}
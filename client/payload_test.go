@@ -0,0 +1,80 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/sink"
+	"google.golang.org/protobuf/proto"
+	"gotest.tools/v3/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, "0001"), []byte("ABC"), 0644))
+	store := PayloadStores{"file": &FileStore{Root: dir}}
+
+	ref, _ := url.Parse("file://" + filepath.ToSlash(filepath.Join(dir, "0001")))
+	data, err := store.Fetch(ref)
+	assert.NilError(t, err)
+	assert.Equal(t, "ABC", string(data))
+
+	ref, _ = url.Parse("file://" + filepath.ToSlash(filepath.Join(dir, "..", "passwd")))
+	_, err = store.Fetch(ref)
+	assert.ErrorContains(t, err, "outside of")
+
+	ref, _ = url.Parse("s3://bucket/0001")
+	_, err = store.Fetch(ref)
+	assert.ErrorContains(t, err, "no payload store")
+}
+
+func TestS3Store(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/payloads/traps/0001" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("ABC"))
+	}))
+	defer server.Close()
+	store := &S3Store{Endpoint: server.URL}
+
+	ref, _ := url.Parse("s3://payloads/traps/0001")
+	data, err := store.Fetch(ref)
+	assert.NilError(t, err)
+	assert.Equal(t, "ABC", string(data))
+
+	ref, _ = url.Parse("s3://payloads/traps/0002")
+	_, err = store.Fetch(ref)
+	assert.ErrorContains(t, err, "404")
+}
+
+func TestOffloadedPayload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "0001")
+	assert.NilError(t, ioutil.WriteFile(path, []byte("ABC"), 0644))
+
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	cli.PayloadStore = PayloadStores{"file": &FileStore{Root: dir}}
+
+	bytes, _ := proto.Marshal(&sink.SinkMessage{
+		MessageId:   "0001",
+		TotalChunks: 1,
+		TracingInfo: map[string]string{PayloadRefKey: "file://" + filepath.ToSlash(path)},
+	})
+	msg := buildMessage("0001", 0, 1, nil)
+	msg.Payload = bytes
+	assert.Equal(t, "ABC", string(cli.processMessage(msg)))
+
+	// Payload references through Kafka headers
+	msg = buildMessage("0002", 0, 1, []byte("ignored"))
+	msg.Metadata = map[string]string{PayloadRefKey: "file://" + filepath.ToSlash(filepath.Join(dir, "missing"))}
+	assert.Assert(t, cli.processMessage(msg) == nil)
+}
@@ -0,0 +1,289 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PipelineConfig represents the settings of a pipeline passed through the CLI or a pipelines file.
+// The expected format on the CLI is name:topic:parser[:ipc].
+type PipelineConfig struct {
+	Name    string   `json:"name" yaml:"name"`
+	Topic   string   `json:"topic" yaml:"topic"`
+	Parser  string   `json:"parser" yaml:"parser"`                       // Defaults to the parser of the base client.
+	IPC     string   `json:"ipc" yaml:"ipc"`                             // Defaults to the IPC API of the base client.
+	GroupID string   `json:"group-id,omitempty" yaml:"group-id"`         // Defaults to the group ID of the base client, with the name as a suffix.
+	Outputs []string `json:"outputs,omitempty" yaml:"outputs,omitempty"` // The kinds or names of the outputs to use (defaults to all of them).
+}
+
+// PipelineConfigs a list of pipeline configurations that can be used as a CLI flag.
+type PipelineConfigs []PipelineConfig
+
+// String gets a CSV with all the configured pipelines
+func (p *PipelineConfigs) String() string {
+	items := make([]string, len(*p))
+	for i, cfg := range *p {
+		items[i] = fmt.Sprintf("%s:%s:%s:%s", cfg.Name, cfg.Topic, cfg.Parser, cfg.IPC)
+	}
+	return strings.Join(items, ", ")
+}
+
+// Set parses a pipeline definition and adds it to the list
+func (p *PipelineConfigs) Set(value string) error {
+	parts := strings.Split(value, ":")
+	if len(parts) < 3 || len(parts) > 4 {
+		return fmt.Errorf("invalid pipeline %s; expecting name:topic:parser[:ipc]", value)
+	}
+	cfg := PipelineConfig{Name: parts[0], Topic: parts[1], Parser: parts[2], IPC: "sink"}
+	if len(parts) == 4 {
+		cfg.IPC = parts[3]
+	}
+	if cfg.Name == "" || cfg.Topic == "" {
+		return fmt.Errorf("invalid pipeline %s; name and topic are required", value)
+	}
+	return p.Add(cfg)
+}
+
+// Add adds a pipeline to the list, verifying that its name is unique.
+func (p *PipelineConfigs) Add(cfg PipelineConfig) error {
+	if cfg.Name == "" || cfg.Topic == "" {
+		return fmt.Errorf("invalid pipeline %s; name and topic are required", cfg.Name)
+	}
+	for _, c := range *p {
+		if c.Name == cfg.Name {
+			return fmt.Errorf("pipeline %s already defined", cfg.Name)
+		}
+	}
+	*p = append(*p, cfg)
+	return nil
+}
+
+// errReloading is returned when the consumer was closed to reload its settings.
+var errReloading = errors.New("reloading consumer")
+
+// Pipeline states
+const (
+	PipelineStarting = "starting"
+	PipelineRunning  = "running"
+	PipelineFailed   = "failed"
+	PipelineStalled  = "stalled"
+	PipelineStopped  = "stopped"
+)
+
+// PipelineStatus represents the current health of a pipeline.
+type PipelineStatus struct {
+	Name      string    `json:"name"`
+	Topic     string    `json:"topic"`
+	Parser    string    `json:"parser"`
+	State     string    `json:"state"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"lastError,omitempty"`
+	Since     time.Time `json:"since"`
+}
+
+// Healthy returns true if the pipeline is consuming messages.
+func (s PipelineStatus) Healthy() bool {
+	return s.State == PipelineRunning
+}
+
+// Pipeline runs a Kafka client and its action in its own failure domain.
+// Each pipeline has its own consumer, so a crash or a stall in one of them doesn't affect the others.
+type Pipeline struct {
+	Name         string         // The name of the pipeline.
+	Client       *KafkaClient   // The Kafka client dedicated to this pipeline.
+	Action       ProcessMessage // The action to execute for each message.
+	Handler      MessageHandler // The action to execute for each decoded message with its coordinates; takes precedence over Action (optional).
+	RestartDelay time.Duration  // How long to wait before restarting the pipeline after a failure.
+	StallTimeout time.Duration  // How long an action can take before flagging the pipeline as stalled (0 to disable).
+
+	mutex     sync.RWMutex
+	status    PipelineStatus
+	busySince time.Time
+}
+
+// NewPipeline creates a new pipeline for a given client and action.
+func NewPipeline(name string, cli *KafkaClient, action ProcessMessage) *Pipeline {
+	return &Pipeline{
+		Name:         name,
+		Client:       cli,
+		Action:       action,
+		RestartDelay: 5 * time.Second,
+		StallTimeout: time.Minute,
+		status: PipelineStatus{
+			Name:   name,
+			Topic:  cli.Topic,
+			Parser: cli.Parser,
+			State:  PipelineStopped,
+			Since:  time.Now(),
+		},
+	}
+}
+
+// Status returns the current status of the pipeline.
+// This is a concurrent safe method.
+func (p *Pipeline) Status() PipelineStatus {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	status := p.status
+	if status.State == PipelineRunning && p.StallTimeout > 0 && !p.busySince.IsZero() && time.Since(p.busySince) > p.StallTimeout {
+		status.State = PipelineStalled
+	}
+	return status
+}
+
+// setBusy tracks when the action started processing a message.
+// This is a concurrent safe method.
+func (p *Pipeline) setBusy(busy bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if busy {
+		p.busySince = time.Now()
+	} else {
+		p.busySince = time.Time{}
+	}
+}
+
+// setState updates the state of the pipeline.
+// This is a concurrent safe method.
+func (p *Pipeline) setState(state string, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.status.State = state
+	p.status.Since = time.Now()
+	if err != nil {
+		p.status.LastError = err.Error()
+	}
+	if state == PipelineStarting && err != nil {
+		p.status.Restarts++
+	}
+}
+
+// runOnce initializes and starts the client, recovering from panics.
+// It returns nil when the consumer was stopped due to the context being cancelled.
+// The client is not bound to the context, but stopped once it is cancelled, so the in-flight messages are drained.
+func (p *Pipeline) runOnce(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("pipeline %s crashed: %v", p.Name, r)
+		}
+		p.Client.Stop()
+	}()
+	if err := p.Client.Initialize(context.Background()); err != nil {
+		return err
+	}
+	finished := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			p.Client.Stop()
+		case <-finished:
+		}
+	}()
+	defer func() { // Before stopping the client again
+		close(finished)
+		<-stopped
+	}()
+	p.setState(PipelineRunning, nil)
+	p.Client.Handle(func(msg DecodedMessage) error {
+		p.setBusy(true)
+		defer p.setBusy(false)
+		if p.Handler != nil {
+			return p.Handler(msg)
+		}
+		p.Action(msg.Payload)
+		return nil
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+	if atomic.LoadInt32(&p.Client.reloading) == 1 {
+		return errReloading
+	}
+	if sourceExhausted(p.Client.Source, p.Client.Topics()) {
+		p.Client.logger().Infof("pipeline %s finished, all the messages were delivered", p.Name)
+		return nil
+	}
+	return fmt.Errorf("pipeline %s consumer closed unexpectedly", p.Name)
+}
+
+// Run executes the pipeline until the context is cancelled, restarting it after failures.
+// It is recommended to use it within a Go Routine as it is a blocking operation.
+func (p *Pipeline) Run(ctx context.Context) {
+	var err error
+	for {
+		p.setState(PipelineStarting, err)
+		if err = p.runOnce(ctx); err == nil {
+			break
+		}
+		if err == errReloading {
+			err = nil // Restart right away, as the consumer was closed on purpose
+			continue
+		}
+		p.Client.logger().Errorf("pipeline %s failed: %v", p.Name, err)
+		p.setState(PipelineFailed, err)
+		select {
+		case <-ctx.Done():
+			p.setState(PipelineStopped, nil)
+			return
+		case <-time.After(p.RestartDelay):
+		}
+	}
+	p.setState(PipelineStopped, nil)
+}
+
+// StatusHandler returns an HTTP handler that reports the status and the sanitized configuration of each pipeline.
+func StatusHandler(pipelines []*Pipeline) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type pipelineInfo struct {
+			PipelineStatus
+			Config json.RawMessage `json:"config"`
+		}
+		infos := make([]pipelineInfo, len(pipelines))
+		for i, p := range pipelines {
+			config, err := Sanitize(p.Client)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("cannot encode configuration of %s: %v", p.Name, err), http.StatusInternalServerError)
+				return
+			}
+			infos[i] = pipelineInfo{p.Status(), config}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"pipelines": infos,
+		})
+	})
+}
+
+// ReadyHandler returns an HTTP handler that reports the health of each pipeline.
+// It responds with 200 when all the pipelines are running, or 503 otherwise.
+func ReadyHandler(pipelines []*Pipeline) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ready := true
+		statuses := make([]PipelineStatus, len(pipelines))
+		for i, p := range pipelines {
+			statuses[i] = p.Status()
+			if !statuses[i].Healthy() {
+				ready = false
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ready":     ready,
+			"pipelines": statuses,
+		})
+	})
+}
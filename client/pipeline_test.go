@@ -0,0 +1,80 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestPipelineConfigs(t *testing.T) {
+	configs := PipelineConfigs{}
+	assert.NilError(t, configs.Set("traps:OpenNMS.Sink.Trap:snmp"))
+	assert.NilError(t, configs.Set("flows:OpenNMS.Sink.Telemetry-Netflow-9:netflow:sink"))
+	assert.ErrorContains(t, configs.Set("traps:OpenNMS.Sink.Trap:snmp"), "already defined")
+	assert.ErrorContains(t, configs.Set("invalid"), "expecting")
+	assert.Equal(t, 2, len(configs))
+	assert.Equal(t, "sink", configs[0].IPC)
+	assert.Equal(t, "netflow", configs[1].Parser)
+}
+
+func TestReadyHandler(t *testing.T) {
+	traps := NewPipeline("traps", &KafkaClient{Topic: "OpenNMS.Sink.Trap", Parser: "snmp"}, nil)
+	flows := NewPipeline("flows", &KafkaClient{Topic: "OpenNMS.Sink.Telemetry-Netflow-9", Parser: "netflow"}, nil)
+	handler := ReadyHandler([]*Pipeline{traps, flows})
+
+	traps.setState(PipelineRunning, nil)
+	flows.setState(PipelineRunning, nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// A stalled action on one pipeline must not affect the health of the other
+	flows.StallTimeout = time.Millisecond
+	flows.setBusy(true)
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, PipelineStalled, flows.Status().State)
+	assert.Equal(t, PipelineRunning, traps.Status().State)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestPipelineWorkerPanic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	writer, err := NewCaptureWriter(path)
+	assert.NilError(t, err)
+	for i := 0; i < 4; i++ {
+		assert.NilError(t, writer.Write(&CaptureRecord{Topic: "Panic.Sink.Heartbeat", Offset: int64(i), Value: buildMessage(fmt.Sprintf("%04d", i), 0, 1, []byte("Minion")).Payload}))
+	}
+	assert.NilError(t, writer.Close())
+
+	cli := &KafkaClient{Topic: "Panic.Sink.Heartbeat", GroupID: "worker-panic-test", Parser: "heartbeat", Workers: 2, Source: &FileSource{Path: path}}
+	p := NewPipeline("panic", cli, nil)
+	p.RestartDelay = time.Minute
+	p.Handler = func(msg DecodedMessage) error {
+		panic("broken handler")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Run(ctx)
+	}()
+	waitFor(t, func() bool { return p.Status().State == PipelineFailed })
+	assert.Equal(t, "pipeline panic crashed: worker crashed: broken handler", p.Status().LastError)
+	cancel()
+	select {
+	case <-done:
+		assert.Equal(t, PipelineStopped, p.Status().State)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the pipeline")
+	}
+}
@@ -0,0 +1,61 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestPostgresOutput(t *testing.T) {
+	var mutex sync.Mutex
+	var batches [][][]interface{}
+	failures := 1
+	out := &PostgresOutput{Table: "netflow.flows", BatchSize: 2, RetryDelay: time.Millisecond}
+	out.insert = func(rows [][]interface{}) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if failures > 0 {
+			failures--
+			return fmt.Errorf("connection refused")
+		}
+		batches = append(batches, rows)
+		return nil
+	}
+	assert.NilError(t, out.Validate())
+	assert.Equal(t, "postgres:netflow.flows", out.Name())
+
+	flow := `{"timestamp":1614900600000,"num_bytes":{"value":1500},"direction":1,"src_address":"10.0.0.1","src_port":{"value":5000},"dst_address":"10.0.0.2","dst_port":{"value":443},"protocol":{"value":6},"netflow_version":1}`
+	meta := Metadata{Location: "Apex", SourceAddress: "10.0.0.254"}
+	for i := 0; i < 3; i++ {
+		assert.NilError(t, out.Send(context.Background(), DecodedMessage{Parser: "netflow", Payload: []byte(flow), Metadata: meta}))
+	}
+	assert.NilError(t, out.Send(context.Background(), DecodedMessage{Parser: "syslog", Payload: []byte("ignored")}))
+	assert.NilError(t, out.Close())
+
+	// The full batch is retried after the failure, and the pending flow is inserted on close
+	assert.Equal(t, 2, len(batches))
+	assert.Equal(t, 3, len(batches[0])+len(batches[1]))
+	row := batches[0][0]
+	assert.Equal(t, len(postgresColumns), len(row))
+	assert.Equal(t, time.Date(2021, 3, 4, 23, 30, 0, 0, time.UTC), row[0])
+	assert.Equal(t, "Apex", row[1])
+	assert.Equal(t, "10.0.0.254", row[2])
+	assert.Equal(t, "EGRESS", row[3])
+	assert.Equal(t, "V9", row[4])
+	assert.Equal(t, int64(443), row[10])
+	assert.Equal(t, int64(1500), row[15])
+	assert.Assert(t, row[16] == nil)
+
+	schema := out.schema()
+	assert.Equal(t, 2, len(schema))
+	assert.Equal(t, "CREATE INDEX IF NOT EXISTS flows_exporter_time_idx ON netflow.flows (exporter, time DESC)", schema[1])
+	out.Hypertable = true
+	assert.Equal(t, "SELECT create_hypertable('netflow.flows', 'time', if_not_exists => TRUE)", out.schema()[2])
+	assert.ErrorContains(t, (&PostgresOutput{Table: "flows; DROP TABLE flows"}).Validate(), "invalid table name")
+}
@@ -0,0 +1,102 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Print formats
+const (
+	PrintLog    = "log"    // Logs the payload of each message (default).
+	PrintJSON   = "json"   // Prints the JSON envelope of each message in a single line, suitable for jq.
+	PrintPretty = "pretty" // Prints the indented JSON envelope of each message.
+	PrintHex    = "hex"    // Prints the coordinates of each message followed by a hexdump of its payload, for binary payloads.
+)
+
+// printMessage is the data passed to the templates, which promotes the metadata, i.e. {{.Location}} {{.SourceAddress}}.
+type printMessage struct {
+	DecodedMessage
+	Metadata
+	Text string // The payload as a string.
+}
+
+// printFuncs contains the additional functions available to the templates.
+var printFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"hex": func(data []byte) string {
+		return hex.EncodeToString(data)
+	},
+}
+
+// MessagePrinter writes the decoded messages to a stream (usually the standard output) with a given format,
+// so the output can be processed by scripts.
+// This is a concurrent safe object.
+type MessagePrinter struct {
+	format   string
+	template *template.Template
+	mutex    sync.Mutex
+	writer   io.Writer
+}
+
+// NewMessagePrinter creates a new printer for the given format: json, pretty, hex, or a Go template when it contains {{,
+// which receives the fields of the decoded message and its metadata, plus Text with the payload as a string,
+// and the json and hex functions, i.e. '{{.Location}} {{.SourceAddress}} {{.Text}}'.
+func NewMessagePrinter(format string, w io.Writer) (*MessagePrinter, error) {
+	p := &MessagePrinter{format: format, writer: w}
+	switch format {
+	case PrintJSON, PrintPretty, PrintHex:
+	default:
+		if !strings.Contains(format, "{{") {
+			return nil, fmt.Errorf("invalid format %s; expecting %s, %s, %s or a Go template", format, PrintJSON, PrintPretty, PrintHex)
+		}
+		tmpl, err := template.New("format").Funcs(printFuncs).Parse(format)
+		if err != nil {
+			return nil, fmt.Errorf("invalid format template: %v", err)
+		}
+		p.template = tmpl
+	}
+	return p, nil
+}
+
+// Print Writes a decoded message, followed by a new line.
+func (p *MessagePrinter) Print(msg DecodedMessage) error {
+	var buf bytes.Buffer
+	switch {
+	case p.template != nil:
+		if err := p.template.Execute(&buf, printMessage{DecodedMessage: msg, Metadata: msg.Metadata, Text: string(msg.Payload)}); err != nil {
+			return fmt.Errorf("cannot format message %s: %v", msg.Coordinates(), err)
+		}
+	case p.format == PrintHex:
+		fmt.Fprintf(&buf, "%s %s %d bytes\n%s", msg.Coordinates(), msg.Parser, len(msg.Payload), hex.Dump(msg.Payload))
+	default:
+		data, err := msg.Envelope()
+		if err != nil {
+			return fmt.Errorf("cannot encode message %s: %v", msg.Coordinates(), err)
+		}
+		if p.format == PrintPretty {
+			if err := json.Indent(&buf, data, "", "  "); err != nil {
+				return fmt.Errorf("cannot encode message %s: %v", msg.Coordinates(), err)
+			}
+		} else {
+			buf.Write(data)
+		}
+	}
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	_, err := p.writer.Write(buf.Bytes())
+	return err
+}
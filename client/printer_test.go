@@ -0,0 +1,47 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bytes"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestMessagePrinter(t *testing.T) {
+	msg := DecodedMessage{
+		Topic:     "OpenNMS.Sink.Syslog",
+		Parser:    "syslog",
+		Partition: 1,
+		Offset:    10,
+		Metadata:  Metadata{Location: "Apex", SourceAddress: "10.0.0.1"},
+		Payload:   []byte(`{"message":"test"}`),
+	}
+	render := func(format string) string {
+		var buf bytes.Buffer
+		p, err := NewMessagePrinter(format, &buf)
+		assert.NilError(t, err)
+		assert.NilError(t, p.Print(msg))
+		return buf.String()
+	}
+
+	assert.Equal(t, "Apex 10.0.0.1 syslog {\"message\":\"test\"}\n", render("{{.Location}} {{.SourceAddress}} {{.Parser}} {{.Text}}"))
+	assert.Equal(t, "1 \"Apex\"\n", render(`{{.Partition}} {{json .Metadata.Location}}`))
+	line := render(PrintJSON)
+	assert.Assert(t, bytes.Count([]byte(line), []byte("\n")) == 1, line)
+	assert.Assert(t, bytes.Contains([]byte(line), []byte(`"payload":{"message":"test"}`)), line)
+	pretty := render(PrintPretty)
+	assert.Assert(t, bytes.Contains([]byte(pretty), []byte("\n  \"topic\": \"OpenNMS.Sink.Syslog\",\n")), pretty)
+	assert.Equal(t, "OpenNMS.Sink.Syslog/1@10 syslog 18 bytes\n"+
+		"00000000  7b 22 6d 65 73 73 61 67  65 22 3a 22 74 65 73 74  |{\"message\":\"test|\n"+
+		"00000010  22 7d                                             |\"}|\n", render(PrintHex))
+
+	_, err := NewMessagePrinter("yaml", &bytes.Buffer{})
+	assert.ErrorContains(t, err, "invalid format yaml")
+	_, err = NewMessagePrinter("{{.Location", &bytes.Buffer{})
+	assert.ErrorContains(t, err, "invalid format template")
+	p, err := NewMessagePrinter("{{.Unknown}}", &bytes.Buffer{})
+	assert.NilError(t, err)
+	assert.ErrorContains(t, p.Print(msg), "cannot format message OpenNMS.Sink.Syslog/1@10")
+}
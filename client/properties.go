@@ -0,0 +1,224 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// jaasOption extracts the options of a JAAS configuration, i.e. username="admin".
+var jaasOption = regexp.MustCompile(`(\w+)\s*=\s*"((?:[^"\\]|\\.)*)"`)
+
+// Properties represents a set of Kafka client settings using the standard (librdkafka/Java) names.
+// It can be used as a CLI flag with the format key=value, and can be repeated.
+// Values can be quoted, and can be secret references (see ResolveSecret), which are resolved on each connection.
+type Properties map[string]string
+
+// String gets a CSV with all the properties, hiding the values of the sensitive ones
+func (p *Properties) String() string {
+	if p == nil {
+		return ""
+	}
+	masked := p.masked()
+	keys := make([]string, 0, len(masked))
+	for k := range masked {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	items := make([]string, len(keys))
+	for i, k := range keys {
+		items[i] = k + "=" + masked[k]
+	}
+	return strings.Join(items, ", ")
+}
+
+// MarshalJSON converts the properties to JSON, hiding the values of the sensitive ones
+func (p Properties) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.masked())
+}
+
+// masked Returns a copy of the properties, where the sensitive values are hidden unless they are secret references.
+func (p Properties) masked() map[string]string {
+	masked := make(map[string]string, len(p))
+	for k, v := range p {
+		if isSensitive(k) && !isSecretReference(v) {
+			v = maskedValue
+		}
+		masked[k] = v
+	}
+	return masked
+}
+
+// Set parses a property and adds it to the set
+func (p *Properties) Set(property string) error {
+	idx := strings.Index(property, "=")
+	if idx < 1 {
+		return fmt.Errorf("invalid property %s; expecting key=value", property)
+	}
+	key := strings.TrimSpace(property[:idx])
+	value, err := unquote(strings.TrimSpace(property[idx+1:]))
+	if err != nil {
+		return fmt.Errorf("invalid property %s: %v", key, err)
+	}
+	if _, err := ResolveSecret(value); err != nil {
+		return fmt.Errorf("invalid property %s: %v", key, err)
+	}
+	if *p == nil {
+		*p = make(Properties)
+	}
+	(*p)[key] = value
+	return nil
+}
+
+// unquote Removes the quotes from a value.
+func unquote(value string) (string, error) {
+	switch {
+	case len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"':
+		return strconv.Unquote(value)
+	case len(value) > 1 && value[0] == '\'' && value[len(value)-1] == '\'':
+		return value[1 : len(value)-1], nil
+	}
+	return value, nil
+}
+
+// apply Updates the Sarama configuration based on the properties.
+func (p Properties) apply(config *sarama.Config) error {
+	for key, ref := range p {
+		value, err := ResolveSecret(ref)
+		if err != nil {
+			return fmt.Errorf("invalid property %s: %v", key, err)
+		}
+		switch key {
+		case "client.id":
+			config.ClientID = value
+		case "security.protocol":
+			switch strings.ToUpper(value) {
+			case "PLAINTEXT":
+			case "SSL":
+				config.Net.TLS.Enable = true
+			case "SASL_PLAINTEXT":
+				config.Net.SASL.Enable = true
+			case "SASL_SSL":
+				config.Net.TLS.Enable = true
+				config.Net.SASL.Enable = true
+			default:
+				err = fmt.Errorf("expecting PLAINTEXT, SSL, SASL_PLAINTEXT or SASL_SSL")
+			}
+		case "sasl.mechanism", "sasl.mechanisms":
+			if strings.ToUpper(value) != sarama.SASLTypePlaintext {
+				err = fmt.Errorf("only %s is supported", sarama.SASLTypePlaintext)
+			}
+			config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		case "sasl.username":
+			config.Net.SASL.User = value
+		case "sasl.password":
+			config.Net.SASL.Password = value
+		case "sasl.jaas.config":
+			for _, match := range jaasOption.FindAllStringSubmatch(value, -1) {
+				option, _ := strconv.Unquote(`"` + match[2] + `"`)
+				switch match[1] {
+				case "username":
+					config.Net.SASL.User = option
+				case "password":
+					config.Net.SASL.Password = option
+				}
+			}
+		case "ssl.ca.location":
+			err = loadCA(config, value)
+		case "enable.ssl.certificate.verification":
+			var verify bool
+			if verify, err = strconv.ParseBool(value); err == nil {
+				ensureTLSConfig(config).InsecureSkipVerify = !verify
+			}
+		case "session.timeout.ms":
+			var ms int
+			if ms, err = strconv.Atoi(value); err == nil {
+				config.Consumer.Group.Session.Timeout = time.Duration(ms) * time.Millisecond
+			}
+		case "auto.offset.reset":
+			switch value {
+			case "earliest", "smallest":
+				config.Consumer.Offsets.Initial = sarama.OffsetOldest
+			case "latest", "largest":
+				config.Consumer.Offsets.Initial = sarama.OffsetNewest
+			default:
+				err = fmt.Errorf("expecting earliest or latest")
+			}
+		case "max.partition.fetch.bytes":
+			var size int
+			if size, err = strconv.Atoi(value); err == nil {
+				config.Consumer.Fetch.Default = int32(size)
+			}
+		case "acks":
+			switch value {
+			case "all", "-1":
+				config.Producer.RequiredAcks = sarama.WaitForAll
+			case "1":
+				config.Producer.RequiredAcks = sarama.WaitForLocal
+			case "0":
+				config.Producer.RequiredAcks = sarama.NoResponse
+			default:
+				err = fmt.Errorf("expecting all, 1 or 0")
+			}
+		case "compression.type":
+			codec, ok := compressionCodecs[strings.ToLower(value)]
+			if !ok {
+				err = fmt.Errorf("expecting none, gzip, snappy, lz4 or zstd")
+			}
+			config.Producer.Compression = codec
+		case "linger.ms":
+			var ms int
+			if ms, err = strconv.Atoi(value); err == nil {
+				config.Producer.Flush.Frequency = time.Duration(ms) * time.Millisecond
+			}
+		default:
+			err = fmt.Errorf("unsupported property")
+		}
+		if err != nil {
+			return fmt.Errorf("invalid property %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// compressionCodecs maps the compression types to the Sarama codecs.
+var compressionCodecs = map[string]sarama.CompressionCodec{
+	"none":   sarama.CompressionNone,
+	"gzip":   sarama.CompressionGZIP,
+	"snappy": sarama.CompressionSnappy,
+	"lz4":    sarama.CompressionLZ4,
+	"zstd":   sarama.CompressionZSTD,
+}
+
+// ensureTLSConfig Returns the TLS configuration, creating it when necessary.
+func ensureTLSConfig(config *sarama.Config) *tls.Config {
+	if config.Net.TLS.Config == nil {
+		config.Net.TLS.Config = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return config.Net.TLS.Config
+}
+
+// loadCA Adds the certificates from a PEM file to the trusted certificate authorities.
+func loadCA(config *sarama.Config, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read file: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return fmt.Errorf("no certificates found in %s", path)
+	}
+	ensureTLSConfig(config).RootCAs = pool
+	return nil
+}
@@ -0,0 +1,61 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"gotest.tools/v3/assert"
+)
+
+func TestPropertiesSet(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "password")
+	assert.NilError(t, ioutil.WriteFile(secret, []byte("s3cr3t=\n"), 0600))
+
+	p := Properties{}
+	assert.NilError(t, p.Set("security.protocol=SASL_SSL"))
+	assert.NilError(t, p.Set(`sasl.jaas.config=org.apache.kafka.common.security.plain.PlainLoginModule required username="admin" password="a=b";`))
+	assert.NilError(t, p.Set(`client.id="my client"`))
+	assert.NilError(t, p.Set("sasl.password=@"+secret))
+	assert.NilError(t, p.Set("sasl.username=@@admin"))
+	assert.NilError(t, p.Set("session.timeout.ms=10000"))
+	assert.ErrorContains(t, p.Set("invalid"), "expecting key=value")
+	assert.ErrorContains(t, p.Set("sasl.password=@/missing/file"), "cannot read file")
+
+	assert.Equal(t, "my client", p["client.id"])
+	assert.Equal(t, "client.id=my client, sasl.jaas.config=***, sasl.password=@"+secret+", sasl.username=@@admin, security.protocol=SASL_SSL, session.timeout.ms=10000", p.String())
+
+	// Secret references are resolved when applied
+	config := sarama.NewConfig()
+	jaas := p["sasl.jaas.config"]
+	delete(p, "sasl.jaas.config")
+	assert.NilError(t, p.apply(config))
+	assert.Equal(t, "s3cr3t=", config.Net.SASL.Password)
+	assert.Equal(t, "@admin", config.Net.SASL.User)
+
+	config = sarama.NewConfig()
+	p["sasl.jaas.config"] = jaas
+	delete(p, "sasl.password")
+	delete(p, "sasl.username")
+	assert.NilError(t, p.apply(config))
+	assert.Assert(t, config.Net.TLS.Enable)
+	assert.Assert(t, config.Net.SASL.Enable)
+	assert.Equal(t, "admin", config.Net.SASL.User)
+	assert.Equal(t, "a=b", config.Net.SASL.Password)
+	assert.Equal(t, "my client", config.ClientID)
+	assert.Equal(t, 10*time.Second, config.Consumer.Group.Session.Timeout)
+
+	assert.ErrorContains(t, Properties{"unknown": "value"}.apply(config), "unsupported property")
+	assert.ErrorContains(t, Properties{"sasl.mechanism": "GSSAPI"}.apply(config), "only PLAIN is supported")
+
+	config = sarama.NewConfig()
+	assert.NilError(t, Properties{"acks": "all", "compression.type": "LZ4", "linger.ms": "50"}.apply(config))
+	assert.Equal(t, sarama.WaitForAll, config.Producer.RequiredAcks)
+	assert.Equal(t, sarama.CompressionLZ4, config.Producer.Compression)
+	assert.Equal(t, 50*time.Millisecond, config.Producer.Flush.Frequency)
+	assert.ErrorContains(t, Properties{"compression.type": "brotli"}.apply(config), "expecting none")
+}
@@ -0,0 +1,354 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default Pub/Sub output settings
+const (
+	DefaultPubSubEndpoint  = "https://pubsub.googleapis.com"
+	DefaultPubSubBatchSize = 100
+	pubSubMaxBatchSize     = 1000            // The maximum number of messages of a publish request.
+	pubSubMaxBatchBytes    = 9 * 1024 * 1024 // Below the 10MB limit of a publish request, leaving room for the base64 encoding overhead.
+	pubSubScope            = "https://www.googleapis.com/auth/pubsub"
+)
+
+// gcpMetadataURL is the endpoint of the metadata server of GCE and GKE.
+var gcpMetadataURL = "http://metadata.google.internal"
+
+// gcpCredentialsFile represents the content of a service account key or of the application default credentials of gcloud.
+type gcpCredentialsFile struct {
+	Type         string `json:"type"` // service_account or authorized_user
+	ProjectID    string `json:"project_id"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+	QuotaProject string `json:"quota_project_id"`
+}
+
+// gcpTokenSource obtains and caches the OAuth2 access tokens for the Google APIs, like the Google SDKs:
+// from a service account key (signing a JWT with its private key), from the user credentials of gcloud (with its refresh token),
+// or from the metadata server when running on Google Cloud.
+// This is a concurrent safe object.
+type gcpTokenSource struct {
+	credentials *gcpCredentialsFile // Nil to use the metadata server.
+	client      *http.Client
+
+	mutex   sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// newGCPTokenSource Creates a token source based on a credentials file. When the path is empty, GOOGLE_APPLICATION_CREDENTIALS is used,
+// followed by the application default credentials of gcloud, and the metadata server.
+func newGCPTokenSource(path string) (*gcpTokenSource, error) {
+	if path == "" {
+		path = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	}
+	if path == "" {
+		if dir, err := os.UserConfigDir(); err == nil {
+			adc := filepath.Join(dir, "gcloud", "application_default_credentials.json")
+			if _, err := os.Stat(adc); err == nil {
+				path = adc
+			}
+		}
+	}
+	if path == "" {
+		return &gcpTokenSource{}, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read Google credentials: %v", err)
+	}
+	creds := &gcpCredentialsFile{}
+	if err := json.Unmarshal(data, creds); err != nil {
+		return nil, fmt.Errorf("invalid Google credentials %s: %v", path, err)
+	}
+	switch creds.Type {
+	case "service_account":
+		if creds.TokenURI == "" {
+			creds.TokenURI = "https://oauth2.googleapis.com/token"
+		}
+		if _, err := parseRSAPrivateKey(creds.PrivateKey); err != nil {
+			return nil, fmt.Errorf("invalid private key on %s: %v", path, err)
+		}
+	case "authorized_user":
+		creds.TokenURI = "https://oauth2.googleapis.com/token"
+		creds.ProjectID = creds.QuotaProject
+	default:
+		return nil, fmt.Errorf("unsupported Google credentials type %q on %s", creds.Type, path)
+	}
+	return &gcpTokenSource{credentials: creds}, nil
+}
+
+// get Returns a valid access token.
+func (s *gcpTokenSource) get() (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.token != "" && time.Until(s.expires) > time.Minute {
+		return s.token, nil
+	}
+	var req *http.Request
+	var err error
+	switch {
+	case s.credentials == nil:
+		req, err = http.NewRequest(http.MethodGet, gcpMetadataURL+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+		if err == nil {
+			req.Header.Set("Metadata-Flavor", "Google")
+		}
+	case s.credentials.Type == "service_account":
+		var assertion string
+		if assertion, err = s.assertion(time.Now()); err == nil {
+			req, err = s.tokenRequest(url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}})
+		}
+	default:
+		req, err = s.tokenRequest(url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {s.credentials.ClientID},
+			"client_secret": {s.credentials.ClientSecret},
+			"refresh_token": {s.credentials.RefreshToken},
+		})
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot create token request: %v", err)
+	}
+	body, err := doCloudRequest(s.client, req)
+	if err != nil {
+		return "", fmt.Errorf("cannot obtain Google access token: %v", err)
+	}
+	result := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}{}
+	if err := json.Unmarshal(body, &result); err != nil || result.AccessToken == "" {
+		return "", fmt.Errorf("invalid Google access token response: %s", string(body))
+	}
+	s.token = result.AccessToken
+	s.expires = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	return s.token, nil
+}
+
+// tokenRequest Builds a request for the OAuth2 token endpoint.
+func (s *gcpTokenSource) tokenRequest(form url.Values) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, s.credentials.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+// assertion Builds the JWT signed with the private key of the service account, to be exchanged for an access token.
+func (s *gcpTokenSource) assertion(now time.Time) (string, error) {
+	key, err := parseRSAPrivateKey(s.credentials.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": s.credentials.PrivateKeyID})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   s.credentials.ClientEmail,
+		"scope": pubSubScope,
+		"aud":   s.credentials.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("cannot sign token: %v", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parseRSAPrivateKey Parses a PEM encoded RSA private key, in PKCS#8 or PKCS#1 format.
+func parseRSAPrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("cannot decode PEM private key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+		return rsaKey, nil
+	}
+	return nil, fmt.Errorf("the private key is not an RSA key")
+}
+
+// PubSubOutput publishes the decoded messages to a Google Cloud Pub/Sub topic, for instance to feed cloud analytics.
+// Each message contains the same envelope used by the ForwardOutput with the json format, and its parser, Kafka coordinates
+// and metadata as message attributes. Messages are queued and published in batches from the background; the failures are retried
+// with an exponential backoff, and when the queue is full, Send blocks until there is room or the context expires,
+// which slows down the consumer instead of losing messages.
+// The credentials are discovered like the Google SDKs, and no credentials are used with the emulator (PUBSUB_EMULATOR_HOST).
+type PubSubOutput struct {
+	Project         string        // The ID of the project (defaults to GOOGLE_CLOUD_PROJECT or the project of the credentials).
+	Topic           string        // The ID of the topic, or its full name as projects/<project>/topics/<topic>.
+	Endpoint        string        // The endpoint of the API (defaults to DefaultPubSubEndpoint, or the emulator when PUBSUB_EMULATOR_HOST is defined).
+	CredentialsFile string        // The path to a service account key (defaults to GOOGLE_APPLICATION_CREDENTIALS, the credentials of gcloud, or the metadata server).
+	BatchSize       int           // The maximum number of messages per request (defaults to DefaultPubSubBatchSize, up to 1000).
+	FlushInterval   time.Duration // The maximum time a message waits in the queue (defaults to DefaultCloudFlushInterval).
+	MaxRetries      int           // How many times a failed batch is retried (defaults to DefaultCloudMaxRetries).
+	RetryDelay      time.Duration // The delay before the first retry, doubled on each attempt (defaults to DefaultCloudRetryDelay).
+	QueueSize       int           // The maximum number of queued messages (defaults to 10 times the batch size).
+	Client          *http.Client  `json:"-"` // The HTTP client (optional).
+
+	tokens  *gcpTokenSource // Nil for the emulator.
+	batcher *cloudBatcher
+}
+
+// Validate Verifies the Pub/Sub output settings, applying defaults when necessary, and starts the background publisher.
+func (out *PubSubOutput) Validate() error {
+	if out.Topic == "" {
+		return fmt.Errorf("the Pub/Sub topic is required")
+	}
+	if parts := strings.Split(out.Topic, "/"); len(parts) == 4 && parts[0] == "projects" && parts[2] == "topics" {
+		out.Project, out.Topic = parts[1], parts[3]
+	} else if len(parts) != 1 {
+		return fmt.Errorf("invalid Pub/Sub topic %s; expecting projects/<project>/topics/<topic>", out.Topic)
+	}
+	emulator := os.Getenv("PUBSUB_EMULATOR_HOST")
+	if out.Endpoint == "" {
+		if emulator != "" {
+			out.Endpoint = "http://" + emulator
+		} else {
+			out.Endpoint = DefaultPubSubEndpoint
+		}
+	}
+	out.Endpoint = strings.TrimSuffix(out.Endpoint, "/")
+	if out.tokens == nil && (emulator == "" || out.CredentialsFile != "") {
+		tokens, err := newGCPTokenSource(out.CredentialsFile)
+		if err != nil {
+			return err
+		}
+		out.tokens = tokens
+	}
+	if out.Project == "" {
+		out.Project = os.Getenv("GOOGLE_CLOUD_PROJECT")
+	}
+	if out.Project == "" && out.tokens != nil && out.tokens.credentials != nil {
+		out.Project = out.tokens.credentials.ProjectID
+	}
+	if out.Project == "" {
+		return fmt.Errorf("the Pub/Sub project is required")
+	}
+	if out.BatchSize <= 0 {
+		out.BatchSize = DefaultPubSubBatchSize
+	}
+	if out.BatchSize > pubSubMaxBatchSize {
+		return fmt.Errorf("invalid Pub/Sub batch size %d; the maximum is %d", out.BatchSize, pubSubMaxBatchSize)
+	}
+	if out.FlushInterval <= 0 {
+		out.FlushInterval = DefaultCloudFlushInterval
+	}
+	if out.MaxRetries <= 0 {
+		out.MaxRetries = DefaultCloudMaxRetries
+	}
+	if out.RetryDelay <= 0 {
+		out.RetryDelay = DefaultCloudRetryDelay
+	}
+	if out.QueueSize <= 0 {
+		out.QueueSize = 10 * out.BatchSize
+	}
+	if out.batcher == nil {
+		out.batcher = &cloudBatcher{
+			destination:   out.Name(),
+			batchSize:     out.BatchSize,
+			maxBytes:      pubSubMaxBatchBytes,
+			flushInterval: out.FlushInterval,
+			maxRetries:    out.MaxRetries,
+			retryDelay:    out.RetryDelay,
+			publish:       out.publish,
+		}
+		out.batcher.start(out.QueueSize)
+	}
+	return nil
+}
+
+// Name Returns the name of the output.
+func (out *PubSubOutput) Name() string {
+	return "pubsub:" + out.Topic
+}
+
+// Send Queues a decoded message to be published.
+func (out *PubSubOutput) Send(ctx context.Context, msg DecodedMessage) error {
+	m, err := newCloudMessage(msg)
+	if err != nil {
+		return err
+	}
+	return out.batcher.enqueue(ctx, m)
+}
+
+// Close Stops the background publisher, after publishing the queued messages.
+func (out *PubSubOutput) Close() error {
+	if out.batcher != nil {
+		out.batcher.close()
+		out.batcher = nil
+	}
+	return nil
+}
+
+// pubSubMessage represents a message of a publish request.
+type pubSubMessage struct {
+	Data       []byte            `json:"data"` // Encoded as base64.
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// publish Sends a batch through the REST API; Pub/Sub accepts or rejects the whole batch.
+func (out *PubSubOutput) publish(messages []cloudMessage) ([]cloudMessage, int, error) {
+	request := struct {
+		Messages []pubSubMessage `json:"messages"`
+	}{}
+	for _, msg := range messages {
+		request.Messages = append(request.Messages, pubSubMessage{Data: msg.body, Attributes: msg.attributes})
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot encode messages: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, out.Endpoint+"/v1/projects/"+out.Project+"/topics/"+out.Topic+":publish", bytes.NewReader(payload))
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if out.tokens != nil {
+		token, err := out.tokens.get()
+		if err != nil {
+			return nil, 0, &OutputError{Err: err, Retryable: true}
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if _, err := doCloudRequest(out.Client, req); err != nil {
+		return nil, 0, err
+	}
+	return nil, 0, nil
+}
@@ -0,0 +1,87 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestPubSubOutput(t *testing.T) {
+	var mutex sync.Mutex
+	var published []pubSubMessage
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			r.ParseForm()
+			assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.PostForm.Get("grant_type"))
+			assert.Equal(t, 3, len(strings.Split(r.PostForm.Get("assertion"), ".")))
+			fmt.Fprint(w, `{"access_token":"access","expires_in":3600}`)
+			return
+		}
+		assert.Equal(t, "/v1/projects/opennms/topics/traps:publish", r.URL.Path)
+		assert.Equal(t, "Bearer access", r.Header.Get("Authorization"))
+		mutex.Lock()
+		defer mutex.Unlock()
+		if requests++; requests == 1 { // Throttled, then retried
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		request := struct {
+			Messages []pubSubMessage `json:"messages"`
+		}{}
+		assert.NilError(t, json.NewDecoder(r.Body).Decode(&request))
+		published = append(published, request.Messages...)
+		fmt.Fprint(w, `{"messageIds":["1"]}`)
+	}))
+	defer server.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	creds, _ := json.Marshal(gcpCredentialsFile{Type: "service_account", ProjectID: "opennms", ClientEmail: "receiver@opennms.iam.gserviceaccount.com", PrivateKey: string(pemKey), TokenURI: server.URL + "/token"})
+	path := filepath.Join(t.TempDir(), "sa.json")
+	assert.NilError(t, ioutil.WriteFile(path, creds, 0600))
+
+	out := &PubSubOutput{Topic: "traps", Endpoint: server.URL, CredentialsFile: path, RetryDelay: time.Millisecond}
+	assert.NilError(t, out.Validate())
+	assert.Equal(t, "pubsub:traps", out.Name())
+	assert.Equal(t, "opennms", out.Project)
+	msg := DecodedMessage{Topic: "OpenNMS.Sink.Trap", Parser: "snmp", Payload: []byte(`{"trap":1}`)}
+	assert.NilError(t, out.Send(context.Background(), msg))
+	assert.NilError(t, out.Close())
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, 1, len(published))
+	assert.Assert(t, strings.Contains(string(published[0].Data), `"payload":{"trap":1}`))
+	assert.Equal(t, "snmp", published[0].Attributes["parser"])
+
+	// The emulator doesn't require credentials
+	os.Setenv("PUBSUB_EMULATOR_HOST", "localhost:8085")
+	defer os.Unsetenv("PUBSUB_EMULATOR_HOST")
+	emulator := &PubSubOutput{Topic: "projects/lab/topics/traps"}
+	assert.NilError(t, emulator.Validate())
+	assert.Equal(t, "http://localhost:8085", emulator.Endpoint)
+	assert.Equal(t, "lab", emulator.Project)
+	assert.Assert(t, emulator.tokens == nil)
+	assert.NilError(t, emulator.Close())
+
+	assert.ErrorContains(t, (&PubSubOutput{}).Validate(), "topic is required")
+	assert.ErrorContains(t, (&PubSubOutput{Topic: "lab/traps"}).Validate(), "invalid Pub/Sub topic")
+	assert.ErrorContains(t, (&PubSubOutput{Project: "lab", Topic: "traps", BatchSize: 2000}).Validate(), "invalid Pub/Sub batch size")
+}
@@ -0,0 +1,127 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// tokenBucket limits the amount of units consumed per second, allowing bursts of up to one second worth of units.
+// Consuming more units than the available ones leaves the bucket in debt, which is paid by waiting,
+// so units larger than the rate (i.e. a chunk bigger than the bytes per second) are still accepted.
+// This is not a concurrent safe object.
+type tokenBucket struct {
+	rate   float64 // Units per second.
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a full bucket with a given rate.
+func newTokenBucket(rate float64, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: rate, last: now}
+}
+
+// take Consumes units from the bucket, returning how long to wait until the bucket is no longer in debt.
+func (b *tokenBucket) take(n int, now time.Time) time.Duration {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// throughputLimiter limits the messages and bytes per second read from the source.
+// While waiting, no messages are read, so the consumer stops fetching new records from all the partitions,
+// and resumes as the limits allow it.
+// This is a concurrent safe object, so the rates can be changed while it is in use.
+type throughputLimiter struct {
+	mutex    sync.Mutex
+	messages *tokenBucket // nil when disabled.
+	bytes    *tokenBucket // nil when disabled.
+
+	onWait func(d time.Duration)
+}
+
+// newThroughputLimiter creates a limiter for a given number of messages and bytes per second (0 to disable each limit).
+func newThroughputLimiter(messages int, bytes int64) *throughputLimiter {
+	limiter := &throughputLimiter{}
+	limiter.setRates(messages, bytes, time.Now())
+	return limiter
+}
+
+// setRates Changes the number of messages and bytes per second (0 to disable each limit).
+// A bucket whose rate changes starts full, so the new rate applies immediately.
+func (l *throughputLimiter) setRates(messages int, bytes int64, now time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.messages = resizeBucket(l.messages, float64(messages), now)
+	l.bytes = resizeBucket(l.bytes, float64(bytes), now)
+}
+
+// resizeBucket Returns a bucket with a given rate, reusing the current one when the rate didn't change, or nil when disabled.
+func resizeBucket(bucket *tokenBucket, rate float64, now time.Time) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	if bucket != nil && bucket.rate == rate {
+		return bucket
+	}
+	return newTokenBucket(rate, now)
+}
+
+// delay Accounts for a message of a given size, returning how long to wait before processing it.
+func (l *throughputLimiter) delay(size int, now time.Time) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	var d time.Duration
+	if l.messages != nil {
+		d = l.messages.take(1, now)
+	}
+	if l.bytes != nil {
+		if bd := l.bytes.take(size, now); bd > d {
+			d = bd
+		}
+	}
+	return d
+}
+
+// wait Blocks until a message of a given size can be processed, or until the done channel is closed.
+// Returns true if the message can be processed; it always does when the limiter is nil or disabled.
+func (l *throughputLimiter) wait(size int, done <-chan struct{}) bool {
+	if l == nil {
+		return true
+	}
+	d := l.delay(size, time.Now())
+	if d <= 0 {
+		return true
+	}
+	if l.onWait != nil {
+		l.onWait(d)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// validateRateLimits Verifies the rate limit settings.
+func (cli *KafkaClient) validateRateLimits() error {
+	if cli.MaxMessageRate < 0 {
+		return fmt.Errorf("invalid maximum message rate %d", cli.MaxMessageRate)
+	}
+	if cli.MaxByteRate < 0 {
+		return fmt.Errorf("invalid maximum byte rate %d", cli.MaxByteRate)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestThroughputLimiter(t *testing.T) {
+	assert.Assert(t, newThroughputLimiter(0, 0).wait(1000, nil))
+	var disabled *throughputLimiter
+	assert.Assert(t, disabled.wait(1000, nil))
+
+	limiter := newThroughputLimiter(10, 1000)
+	now := limiter.messages.last
+
+	// The first second worth of messages goes through right away
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, time.Duration(0), limiter.delay(10, now))
+	}
+	assert.Equal(t, 100*time.Millisecond, limiter.delay(10, now))
+
+	// The bytes limit applies when it is stricter, even for chunks bigger than the rate
+	now = now.Add(2 * time.Second)
+	assert.Equal(t, 1500*time.Millisecond, limiter.delay(2500, now))
+	assert.Equal(t, 500*time.Millisecond, limiter.delay(0, now.Add(time.Second)))
+
+	done := make(chan struct{})
+	close(done)
+	assert.Assert(t, !limiter.wait(100, done))
+
+	// Changing a rate starts a full bucket, while the unchanged one keeps its debt
+	bytes := limiter.bytes
+	limiter.setRates(20, 1000, now)
+	assert.Assert(t, limiter.bytes == bytes)
+	assert.Equal(t, 20.0, limiter.messages.tokens)
+	limiter.setRates(0, 0, now)
+	assert.Assert(t, limiter.messages == nil && limiter.bytes == nil)
+	assert.Equal(t, time.Duration(0), limiter.delay(1000, now))
+}
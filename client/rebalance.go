@@ -0,0 +1,159 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultRebalanceGracePeriod is the default time the partial messages of a revoked partition are kept, waiting for the partition to be reassigned.
+const DefaultRebalanceGracePeriod = 30 * time.Second
+
+// EvictionRevoked is the reason of the partial messages drained because their partition was revoked and not reassigned on time.
+const EvictionRevoked = "revoked"
+
+// Rebalance event types
+const (
+	RebalanceAssigned = "assigned" // The partition was assigned to the consumer.
+	RebalanceRevoked  = "revoked"  // The partition was revoked from the consumer.
+	RebalanceDrained  = "drained"  // The partial messages of a revoked partition were discarded, as it wasn't reassigned within the grace period.
+)
+
+// RebalanceEvent represents a change on the partitions assigned to the consumer.
+type RebalanceEvent struct {
+	Type string `json:"type"`
+	TopicPartition
+	Offset  int64 `json:"offset,omitempty"`  // The initial offset of an assigned partition.
+	Drained int   `json:"drained,omitempty"` // The number of partial messages discarded from a drained partition.
+}
+
+// RebalanceHandler defines the action to execute when a partition is assigned, revoked or drained.
+// It is executed from the consumer, so it must not block.
+type RebalanceHandler func(event RebalanceEvent)
+
+// rebalanceTracker tracks the partitions assigned to the consumer, and the revoked ones waiting to be drained.
+// This is a concurrent safe object.
+type rebalanceTracker struct {
+	mutex    sync.Mutex
+	assigned map[TopicPartition]time.Time
+	pending  map[TopicPartition]*time.Timer
+}
+
+// newRebalanceTracker creates a new tracker.
+func newRebalanceTracker() *rebalanceTracker {
+	return &rebalanceTracker{
+		assigned: make(map[TopicPartition]time.Time),
+		pending:  make(map[TopicPartition]*time.Timer),
+	}
+}
+
+// AssignedPartitions Returns the partitions currently assigned to the consumer, sorted by topic and partition.
+// This is a concurrent safe method.
+func (cli *KafkaClient) AssignedPartitions() []TopicPartition {
+	if cli.rebalances == nil {
+		return nil
+	}
+	t := cli.rebalances
+	t.mutex.Lock()
+	partitions := make([]TopicPartition, 0, len(t.assigned))
+	for tp := range t.assigned {
+		partitions = append(partitions, tp)
+	}
+	t.mutex.Unlock()
+	sort.Slice(partitions, func(i, j int) bool {
+		if partitions[i].Topic == partitions[j].Topic {
+			return partitions[i].Partition < partitions[j].Partition
+		}
+		return partitions[i].Topic < partitions[j].Topic
+	})
+	return partitions
+}
+
+// partitionAssigned Tracks a partition claimed by the consumer, cancelling the pending drain of its partial messages.
+func (cli *KafkaClient) partitionAssigned(tp TopicPartition, offset int64) {
+	t := cli.rebalances
+	t.mutex.Lock()
+	if timer, ok := t.pending[tp]; ok {
+		timer.Stop()
+		delete(t.pending, tp)
+	}
+	t.assigned[tp] = time.Now()
+	t.mutex.Unlock()
+	cli.logger().Infof("partition %s assigned at offset %d", tp, offset)
+	cli.rebalanceEvent(RebalanceEvent{Type: RebalanceAssigned, TopicPartition: tp, Offset: offset})
+}
+
+// partitionRevoked Tracks a partition released by the consumer, scheduling the drain of its partial messages after the grace period.
+func (cli *KafkaClient) partitionRevoked(tp TopicPartition) {
+	grace := cli.RebalanceGracePeriod
+	if grace <= 0 {
+		grace = DefaultRebalanceGracePeriod
+	}
+	t := cli.rebalances
+	t.mutex.Lock()
+	delete(t.assigned, tp)
+	if _, ok := t.pending[tp]; !ok {
+		t.pending[tp] = time.AfterFunc(grace, func() { cli.drainRevoked(tp) })
+	}
+	t.mutex.Unlock()
+	cli.logger().Infof("partition %s revoked", tp)
+	cli.rebalanceEvent(RebalanceEvent{Type: RebalanceRevoked, TopicPartition: tp})
+}
+
+// drainRevoked Discards the partial messages of a revoked partition, unless it was reassigned in the meantime.
+func (cli *KafkaClient) drainRevoked(tp TopicPartition) {
+	t := cli.rebalances
+	t.mutex.Lock()
+	_, ok := t.pending[tp]
+	delete(t.pending, tp)
+	t.mutex.Unlock()
+	if !ok {
+		return
+	}
+	drained := cli.drainPartition(tp)
+	if drained > 0 {
+		cli.logger().Warnf("drained %d partial messages of partition %s, as it wasn't reassigned after the rebalance", drained, tp)
+	}
+	cli.rebalanceEvent(RebalanceEvent{Type: RebalanceDrained, TopicPartition: tp, Drained: drained})
+}
+
+// drainPartition Removes the partial messages whose first chunk came from a given partition, as their remaining chunks go to another consumer.
+// Returns the number of messages removed.
+// This is a concurrent safe method.
+func (cli *KafkaClient) drainPartition(tp TopicPartition) int {
+	if cli.mutex == nil {
+		return 0
+	}
+	evicted := make(map[string]*partialMessage)
+	cli.mutex.Lock()
+	for id, partial := range cli.msgBuffer {
+		if partial.topic == tp.Topic && partial.partition == tp.Partition {
+			evicted[id] = partial
+			cli.trace(id, "partial message evicted (%s)", EvictionRevoked)
+			cli.countDroppedChunks(partial.topic, DropEvicted, partial.chunk)
+			cli.discardPartial(id, partial)
+		}
+	}
+	cli.mutex.Unlock()
+	if cli.revokedEvicted != nil {
+		cli.revokedEvicted.Add(float64(len(evicted)))
+	}
+	if cli.OnPartialMessageEvicted != nil {
+		for id, partial := range evicted {
+			cli.OnPartialMessageEvicted(id, EvictionRevoked, partial.chunk, partial.total)
+		}
+	}
+	return len(evicted)
+}
+
+// rebalanceEvent Counts a rebalance event and executes the rebalance handler.
+func (cli *KafkaClient) rebalanceEvent(event RebalanceEvent) {
+	if cli.rebalanceEvents != nil {
+		cli.rebalanceEvents.WithLabelValues(event.Type).Inc()
+	}
+	if cli.OnRebalance != nil {
+		cli.OnRebalance(event)
+	}
+}
@@ -0,0 +1,63 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRebalance(t *testing.T) {
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	cli.RebalanceGracePeriod = 50 * time.Millisecond
+	var mutex sync.Mutex
+	var events []RebalanceEvent
+	cli.OnRebalance = func(event RebalanceEvent) {
+		mutex.Lock()
+		events = append(events, event)
+		mutex.Unlock()
+	}
+	evicted := make(chan string, 2)
+	cli.OnPartialMessageEvicted = func(id, reason string, chunks, total int32) {
+		evicted <- id + ":" + reason
+	}
+	for i, id := range []string{"0001", "0002"} {
+		msg := buildMessage(id, 0, 2, []byte("ABC"))
+		msg.SetContext(WithRecordMetadata(msg.Context(), RecordMetadata{Partition: int32(i), Offset: 10}))
+		assert.Assert(t, cli.processMessage(msg) == nil)
+	}
+
+	cli.partitionAssigned(TopicPartition{cli.Topic, 0}, 10)
+	cli.partitionAssigned(TopicPartition{cli.Topic, 1}, 10)
+	assert.DeepEqual(t, []TopicPartition{{cli.Topic, 0}, {cli.Topic, 1}}, cli.AssignedPartitions())
+
+	// Partition 0 is reassigned within the grace period, but partition 1 goes to another consumer
+	cli.partitionRevoked(TopicPartition{cli.Topic, 0})
+	cli.partitionRevoked(TopicPartition{cli.Topic, 1})
+	assert.Equal(t, 0, len(cli.AssignedPartitions()))
+	cli.partitionAssigned(TopicPartition{cli.Topic, 0}, 11)
+	select {
+	case id := <-evicted:
+		assert.Equal(t, "0002:revoked", id)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the eviction of the revoked partition")
+	}
+	waitFor(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(events) == 6
+	})
+
+	assert.DeepEqual(t, []TopicPartition{{cli.Topic, 0}}, cli.AssignedPartitions())
+	assert.Equal(t, 0, len(evicted))
+	partials := cli.PartialMessages()
+	assert.Equal(t, 1, len(partials))
+	assert.Equal(t, "0001", partials[0].ID)
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.DeepEqual(t, RebalanceEvent{Type: RebalanceDrained, TopicPartition: TopicPartition{cli.Topic, 1}, Drained: 1}, events[5])
+}
@@ -0,0 +1,175 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/sink"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultReinjectChunkSize is the default maximum size of the content of each chunk, matching the default max.buffer.size of OpenNMS.
+const DefaultReinjectChunkSize = 921600
+
+// Reinjector republishes the Sink messages from capture files or a topic (i.e. a dead letter topic) to an OpenNMS Sink topic,
+// to recover after an outage on the OpenNMS side.
+// The chunks of each message are reassembled, and the complete message is split again into chunks that OpenNMS can handle,
+// keeping the original message ID (used as the Kafka key, like OpenNMS) and tracing info.
+// This is not a concurrent safe object.
+type Reinjector struct {
+	Bootstrap  string     // The Kafka Server Bootstrap string.
+	Topic      string     // The destination topic (defaults to the topic of each record).
+	Parameters Properties // Additional Kafka producer settings, i.e. security.protocol=SASL_SSL.
+	TLS        TLSConfig  // TLS settings to connect to Kafka (optional).
+	SASL       SASLConfig // SASL settings to authenticate against Kafka (optional).
+	Rate       int        // The maximum number of messages republished per second (0 for unlimited).
+	ChunkSize  int        // The maximum size of the content of each chunk (defaults to DefaultReinjectChunkSize).
+
+	producer   sarama.SyncProducer
+	ticker     *time.Ticker
+	pending    map[string]*reinjectMessage
+	reinjected int
+	chunks     int
+}
+
+// reinjectMessage contains the chunks received so far of a message to republish.
+type reinjectMessage struct {
+	chunks  map[int32][]byte
+	total   int32
+	tracing map[string]string
+}
+
+// Open Verifies the settings, applying defaults when necessary, and connects to Kafka.
+func (r *Reinjector) Open() error {
+	if r.Rate < 0 {
+		return fmt.Errorf("invalid rate %d", r.Rate)
+	}
+	if r.ChunkSize < 0 {
+		return fmt.Errorf("invalid chunk size %d", r.ChunkSize)
+	}
+	if r.ChunkSize == 0 {
+		r.ChunkSize = DefaultReinjectChunkSize
+	}
+	r.pending = make(map[string]*reinjectMessage)
+	if r.producer != nil {
+		return nil
+	}
+	config := sarama.NewConfig()
+	config.Version = sarama.V2_7_0_0
+	config.ClientID = "onms-kafka-ipc-receiver"
+	config.Producer.Return.Successes = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	if err := r.Parameters.apply(config); err != nil {
+		return err
+	}
+	if err := r.TLS.apply(config); err != nil {
+		return err
+	}
+	if err := r.SASL.apply(config); err != nil {
+		return err
+	}
+	producer, err := sarama.NewSyncProducer([]string{r.Bootstrap}, config)
+	if err != nil {
+		return fmt.Errorf("cannot create producer: %v", err)
+	}
+	r.producer = producer
+	return nil
+}
+
+// Add Processes a record with a chunk of a Sink message, republishing the message once all its chunks have been received.
+func (r *Reinjector) Add(rec *CaptureRecord) error {
+	chunk := &sink.SinkMessage{}
+	if err := proto.Unmarshal(rec.Value, chunk); err != nil {
+		return fmt.Errorf("invalid sink message at %s: %v", rec.Coordinates(), err)
+	}
+	topic := r.Topic
+	if topic == "" {
+		topic = rec.Topic
+	}
+	key := topic + "/" + chunk.MessageId
+	msg, ok := r.pending[key]
+	if !ok {
+		msg = &reinjectMessage{chunks: make(map[int32][]byte), total: chunk.TotalChunks, tracing: chunk.TracingInfo}
+		r.pending[key] = msg
+	}
+	msg.chunks[chunk.CurrentChunkNumber] = chunk.Content
+	if int32(len(msg.chunks)) < msg.total {
+		return nil
+	}
+	delete(r.pending, key)
+	var data []byte
+	for i := int32(0); i < msg.total; i++ {
+		data = append(data, msg.chunks[i]...)
+	}
+	if msg.total <= 0 {
+		data = chunk.Content
+	}
+	return r.publish(topic, chunk.MessageId, data, msg.tracing)
+}
+
+// publish Splits the content of a message into chunks, and sends them to the topic, honoring the rate limit.
+func (r *Reinjector) publish(topic, id string, data []byte, tracing map[string]string) error {
+	if r.Rate > 0 {
+		if r.ticker == nil {
+			r.ticker = time.NewTicker(time.Second / time.Duration(r.Rate))
+		} else {
+			<-r.ticker.C
+		}
+	}
+	total := (len(data) + r.ChunkSize - 1) / r.ChunkSize
+	if total == 0 {
+		total = 1
+	}
+	for chunk := 0; chunk < total; chunk++ {
+		start := chunk * r.ChunkSize
+		end := start + r.ChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		value, err := proto.Marshal(&sink.SinkMessage{
+			MessageId:          id,
+			CurrentChunkNumber: int32(chunk),
+			TotalChunks:        int32(total),
+			Content:            data[start:end],
+			TracingInfo:        tracing,
+		})
+		if err != nil {
+			return fmt.Errorf("cannot encode chunk %d of message %s: %v", chunk, id, err)
+		}
+		_, _, err = r.producer.SendMessage(&sarama.ProducerMessage{Topic: topic, Key: sarama.StringEncoder(id), Value: sarama.ByteEncoder(value)})
+		if err != nil {
+			return fmt.Errorf("cannot send chunk %d of message %s to %s: %v", chunk, id, topic, err)
+		}
+		r.chunks++
+	}
+	r.reinjected++
+	defaultLogger.Debugf("message %s republished to %s with %d chunks", id, topic, total)
+	return nil
+}
+
+// Reinjected Returns the number of messages and chunks republished so far.
+func (r *Reinjector) Reinjected() (messages int, chunks int) {
+	return r.reinjected, r.chunks
+}
+
+// Pending Returns the number of messages whose chunks haven't been all received, which are not republished.
+func (r *Reinjector) Pending() int {
+	return len(r.pending)
+}
+
+// Close Disconnects from Kafka.
+func (r *Reinjector) Close() error {
+	if r.ticker != nil {
+		r.ticker.Stop()
+		r.ticker = nil
+	}
+	if r.producer == nil {
+		return nil
+	}
+	err := r.producer.Close()
+	r.producer = nil
+	return err
+}
@@ -0,0 +1,57 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama/mocks"
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/sink"
+	"google.golang.org/protobuf/proto"
+	"gotest.tools/v3/assert"
+)
+
+func TestReinjector(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	var sent []*sink.SinkMessage
+	check := func(value []byte) error {
+		msg := &sink.SinkMessage{}
+		if err := proto.Unmarshal(value, msg); err != nil {
+			return err
+		}
+		sent = append(sent, msg)
+		return nil
+	}
+	for i := 0; i < 3; i++ {
+		producer.ExpectSendMessageWithCheckerFunctionAndSucceed(check)
+	}
+	r := &Reinjector{Topic: "OpenNMS.Sink.Syslog", ChunkSize: 4, Rate: 100, producer: producer}
+	assert.NilError(t, r.Open())
+	defer r.Close()
+
+	record := func(id string, chunk, total int32, data string) *CaptureRecord {
+		value, _ := proto.Marshal(&sink.SinkMessage{MessageId: id, CurrentChunkNumber: chunk, TotalChunks: total, Content: []byte(data), TracingInfo: map[string]string{"tenant": "acme"}})
+		return &CaptureRecord{Topic: "DLQ", Value: value}
+	}
+	start := time.Now()
+	assert.NilError(t, r.Add(record("0001", 1, 2, "EFG")))
+	assert.Equal(t, 1, r.Pending())
+	assert.NilError(t, r.Add(record("0001", 0, 2, "ABCD")))
+	assert.NilError(t, r.Add(record("0002", 0, 1, "XYZ")))
+	assert.NilError(t, r.Add(record("0003", 0, 2, "ABC"))) // Incomplete
+	assert.Assert(t, time.Since(start) >= 10*time.Millisecond)
+	assert.ErrorContains(t, r.Add(&CaptureRecord{Value: []byte("invalid")}), "invalid sink message")
+
+	messages, chunks := r.Reinjected()
+	assert.Equal(t, 2, messages)
+	assert.Equal(t, 3, chunks)
+	assert.Equal(t, 1, r.Pending())
+	assert.Equal(t, 3, len(sent))
+	assert.Equal(t, "ABCD", string(sent[0].Content))
+	assert.Equal(t, "EFG", string(sent[1].Content))
+	assert.Equal(t, int32(1), sent[1].CurrentChunkNumber)
+	assert.Equal(t, int32(2), sent[1].TotalChunks)
+	assert.Equal(t, "acme", sent[1].TracingInfo["tenant"])
+	assert.Equal(t, "XYZ", string(sent[2].Content))
+}
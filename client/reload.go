@@ -0,0 +1,89 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"time"
+)
+
+// RuntimeSettings contains the settings of a client that can be changed while it is running,
+// without closing the consumer, which would trigger a rebalance and the redelivery of the in-flight messages.
+type RuntimeSettings struct {
+	HeaderFilter   HeaderRules  // Only process the chunks whose Kafka headers satisfy these rules (optional).
+	Filter         *FilterRules // Only process the decoded messages allowed by these include/exclude rules (optional).
+	OutputRoutes   OutputRoutes // Only send the messages to an output when their Kafka headers satisfy its rules (optional).
+	MaxMessageRate int          // The maximum number of chunks read per second (0 for unlimited).
+	MaxByteRate    int64        // The maximum number of bytes read per second (0 for unlimited).
+}
+
+// RuntimeSettings Returns the current settings that can be changed at runtime.
+// This is a concurrent safe method.
+func (cli *KafkaClient) RuntimeSettings() RuntimeSettings {
+	unlock := cli.lockSettings(false)
+	defer unlock()
+	return RuntimeSettings{
+		HeaderFilter:   cli.HeaderFilter,
+		Filter:         cli.Filter,
+		OutputRoutes:   cli.OutputRoutes,
+		MaxMessageRate: cli.MaxMessageRate,
+		MaxByteRate:    cli.MaxByteRate,
+	}
+}
+
+// Reconfigure Applies new runtime settings, which take effect on the next chunk without restarting the consumer.
+// This is a concurrent safe method.
+func (cli *KafkaClient) Reconfigure(settings RuntimeSettings) error {
+	unlock := cli.lockSettings(true)
+	previous := RuntimeSettings{MaxMessageRate: cli.MaxMessageRate, MaxByteRate: cli.MaxByteRate}
+	cli.MaxMessageRate, cli.MaxByteRate = settings.MaxMessageRate, settings.MaxByteRate
+	if err := cli.validateRateLimits(); err != nil {
+		cli.MaxMessageRate, cli.MaxByteRate = previous.MaxMessageRate, previous.MaxByteRate
+		unlock()
+		return err
+	}
+	cli.HeaderFilter = settings.HeaderFilter
+	cli.Filter = settings.Filter
+	cli.OutputRoutes = settings.OutputRoutes
+	unlock()
+	if cli.limiter != nil {
+		cli.limiter.setRates(settings.MaxMessageRate, settings.MaxByteRate, time.Now())
+	}
+	cli.logger().Infof("runtime settings of %s updated", cli.Topic)
+	return nil
+}
+
+// lockSettings Locks the runtime settings for reading or writing, returning the function to unlock them.
+// The settings are not locked before the client is initialized, as they can't be accessed concurrently yet.
+func (cli *KafkaClient) lockSettings(write bool) func() {
+	mutex := cli.settingsMutex
+	if mutex == nil {
+		return func() {}
+	}
+	if write {
+		mutex.Lock()
+		return mutex.Unlock
+	}
+	mutex.RLock()
+	return mutex.RUnlock
+}
+
+// headerFilter Returns the current header filter.
+func (cli *KafkaClient) headerFilter() HeaderRules {
+	unlock := cli.lockSettings(false)
+	defer unlock()
+	return cli.HeaderFilter
+}
+
+// filter Returns the current filter rules.
+func (cli *KafkaClient) filter() *FilterRules {
+	unlock := cli.lockSettings(false)
+	defer unlock()
+	return cli.Filter
+}
+
+// outputRoutes Returns the current output routes.
+func (cli *KafkaClient) outputRoutes() OutputRoutes {
+	unlock := cli.lockSettings(false)
+	defer unlock()
+	return cli.OutputRoutes
+}
@@ -0,0 +1,35 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"gotest.tools/v3/assert"
+)
+
+func TestReconfigure(t *testing.T) {
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	assert.DeepEqual(t, RuntimeSettings{}, cli.RuntimeSettings())
+
+	msg := buildMessage("0001", 0, 1, []byte("ABC"))
+	msg.Metadata = message.Metadata{"tenant": "other"}
+	assert.Equal(t, "ABC", string(cli.processMessage(msg)))
+
+	settings := RuntimeSettings{MaxMessageRate: 100}
+	assert.NilError(t, settings.HeaderFilter.Set("tenant=acme"))
+	assert.NilError(t, cli.Reconfigure(settings))
+	assert.Equal(t, 100, cli.RuntimeSettings().MaxMessageRate)
+	assert.Equal(t, 100.0, cli.limiter.messages.rate)
+	msg = buildMessage("0002", 0, 1, []byte("ABC"))
+	msg.Metadata = message.Metadata{"tenant": "other"}
+	assert.Assert(t, cli.processMessage(msg) == nil)
+
+	// Invalid settings are rejected as a whole
+	assert.ErrorContains(t, cli.Reconfigure(RuntimeSettings{MaxByteRate: -1}), "invalid maximum byte rate")
+	current := cli.RuntimeSettings()
+	assert.Equal(t, 100, current.MaxMessageRate)
+	assert.Equal(t, "tenant=acme", current.HeaderFilter.String())
+}
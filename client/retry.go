@@ -0,0 +1,102 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Default retry settings
+const (
+	DefaultRetryMaxDelay   = 30 * time.Second
+	DefaultRetryMultiplier = 2.0
+)
+
+// RetryPolicy defines how many times the action is executed for a message that fails, and how long to wait between the attempts,
+// before the message is sent to the dead letter output (if any) and acknowledged.
+type RetryPolicy struct {
+	MaxAttempts int           // The maximum number of executions for each message, including the first one (0 for unlimited with the success commit policy, or 1 otherwise).
+	Delay       time.Duration // The delay before the first retry (defaults to CommitRetryDelay).
+	MaxDelay    time.Duration // The maximum delay between the attempts (defaults to DefaultRetryMaxDelay).
+	Multiplier  float64       // The factor applied to the delay after each retry (defaults to DefaultRetryMultiplier; 1 for a constant delay).
+	Jitter      float64       // The fraction of each delay that is randomized, from 0 (default) to 1, to avoid retrying in lockstep.
+}
+
+// validate Verifies the retry settings, applying defaults when necessary.
+func (p *RetryPolicy) validate(delay time.Duration) error {
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("invalid maximum attempts %d", p.MaxAttempts)
+	}
+	if p.Multiplier != 0 && p.Multiplier < 1 {
+		return fmt.Errorf("invalid retry multiplier %g; expecting at least 1", p.Multiplier)
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("invalid retry jitter %g; expecting a value between 0 and 1", p.Jitter)
+	}
+	*p = p.withDefaults(delay)
+	return nil
+}
+
+// withDefaults Returns a copy of the policy with the defaults applied, using a given delay when it is not defined.
+func (p RetryPolicy) withDefaults(delay time.Duration) RetryPolicy {
+	if p.Delay <= 0 {
+		p.Delay = delay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = DefaultRetryMaxDelay
+	}
+	if p.MaxDelay < p.Delay {
+		p.MaxDelay = p.Delay
+	}
+	if p.Multiplier == 0 {
+		p.Multiplier = DefaultRetryMultiplier
+	}
+	return p
+}
+
+// exhausted Returns true when a message shouldn't be retried after a given number of failed attempts.
+func (p RetryPolicy) exhausted(attempts int, commitPolicy string) bool {
+	if p.MaxAttempts == 0 {
+		return commitPolicy != CommitOnSuccess
+	}
+	return attempts >= p.MaxAttempts
+}
+
+// backoff Returns the delay before the next attempt after a given number of failed attempts.
+func (p RetryPolicy) backoff(attempts int) time.Duration {
+	delay := float64(p.Delay) * math.Pow(p.Multiplier, float64(attempts-1))
+	if delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay -= delay * p.Jitter * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// sendDeadLetter Sends a message whose action failed after all the attempts to the dead letter output, if any,
+// adding the error to its headers.
+func (cli *KafkaClient) sendDeadLetter(msg DecodedMessage, cause error) {
+	if cli.DeadLetter == nil {
+		return
+	}
+	headers := make(map[string]string, len(msg.Headers)+1)
+	for key, value := range msg.Headers {
+		headers[key] = value
+	}
+	headers["error"] = cause.Error()
+	msg.Headers = headers
+	ctx, cancel := cli.outputContext()
+	defer cancel()
+	result := "success"
+	if err := cli.DeadLetter.Send(ctx, msg); err != nil {
+		cli.logger().Errorf("cannot send message %s to %s: %v", msg.Coordinates(), cli.DeadLetter.Name(), err)
+		result = "failure"
+	}
+	if cli.deadLettered != nil {
+		cli.deadLettered.WithLabelValues(result).Inc()
+	}
+}
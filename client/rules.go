@@ -0,0 +1,252 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Filter rule actions
+const (
+	RuleInclude = "include"
+	RuleExclude = "exclude"
+)
+
+// syslogFacilities contains the codes of the Syslog facilities by name, based on RFC 5424.
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11, "ntp": 12, "security": 13, "console": 14, "solaris-cron": 15,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// FilterRule defines the conditions of an include or exclude rule.
+// A message satisfies the rule when it satisfies all the conditions defined, and a condition with multiple values
+// is satisfied when any of them matches. A rule without conditions matches all the messages.
+type FilterRule struct {
+	Action     string   `json:"action" yaml:"action"`                             // Either include or exclude.
+	Sources    []string `json:"sources,omitempty" yaml:"sources,omitempty"`       // IP addresses or CIDRs of the devices that sent the messages.
+	Locations  []string `json:"locations,omitempty" yaml:"locations,omitempty"`   // Locations of the Minions that forwarded the messages.
+	TrapOIDs   []string `json:"trap-oids,omitempty" yaml:"trap-oids,omitempty"`   // Enterprise OID prefixes of the SNMP traps.
+	Facilities []string `json:"facilities,omitempty" yaml:"facilities,omitempty"` // Names (i.e. auth) or codes of the Syslog facilities.
+	Exporters  []string `json:"exporters,omitempty" yaml:"exporters,omitempty"`   // IP addresses or CIDRs of the flow exporters.
+
+	sources    []*net.IPNet
+	exporters  []*net.IPNet
+	facilities []int
+}
+
+// compile Verifies the rule and parses its conditions.
+func (r *FilterRule) compile() error {
+	if r.Action != RuleInclude && r.Action != RuleExclude {
+		return fmt.Errorf("invalid action %q; expecting %s or %s", r.Action, RuleInclude, RuleExclude)
+	}
+	var err error
+	if r.sources, err = parseNetworks(r.Sources); err != nil {
+		return fmt.Errorf("invalid sources: %v", err)
+	}
+	if r.exporters, err = parseNetworks(r.Exporters); err != nil {
+		return fmt.Errorf("invalid exporters: %v", err)
+	}
+	r.facilities = make([]int, len(r.Facilities))
+	for i, name := range r.Facilities {
+		code, ok := syslogFacilities[strings.ToLower(name)]
+		if !ok {
+			if code, err = strconv.Atoi(name); err != nil || code < 0 || code > 23 {
+				return fmt.Errorf("invalid facility %s", name)
+			}
+		}
+		r.facilities[i] = code
+	}
+	return nil
+}
+
+// matches Returns true when the message satisfies all the conditions of the rule.
+func (r *FilterRule) matches(msg DecodedMessage, fields *ruleFields) bool {
+	if len(r.sources) > 0 && !containsIP(r.sources, msg.Metadata.SourceAddress) {
+		return false
+	}
+	if len(r.Locations) > 0 && !containsString(r.Locations, msg.Metadata.Location, false) {
+		return false
+	}
+	if len(r.exporters) > 0 && (!isTelemetry(msg.Parser) || !containsIP(r.exporters, msg.Metadata.SourceAddress)) {
+		return false
+	}
+	if len(r.TrapOIDs) > 0 && !r.matchesTrap(fields.trapOIDs(msg)) {
+		return false
+	}
+	if len(r.facilities) > 0 && !r.matchesFacility(fields.facilities(msg)) {
+		return false
+	}
+	return true
+}
+
+// matchesTrap Returns true when any of the enterprise OIDs matches one of the prefixes of the rule.
+func (r *FilterRule) matchesTrap(oids []string) bool {
+	for _, oid := range oids {
+		for _, prefix := range r.TrapOIDs {
+			if oid == prefix || strings.HasPrefix(oid, strings.TrimSuffix(prefix, ".")+".") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchesFacility Returns true when any of the facilities is one of the facilities of the rule.
+func (r *FilterRule) matchesFacility(facilities []int) bool {
+	for _, facility := range facilities {
+		for _, code := range r.facilities {
+			if facility == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FilterRules is an ordered list of include and exclude rules, to restrict the messages that reach the action and the outputs,
+// i.e. to process only the traps from a few subnets on a shared topic.
+// The first rule satisfied by a message decides whether it is processed. When no rule is satisfied, the default action applies,
+// which is exclude when there is at least one include rule, or include otherwise.
+type FilterRules struct {
+	Default string       `json:"default,omitempty" yaml:"default,omitempty"` // The action when no rule applies (optional).
+	Rules   []FilterRule `json:"rules" yaml:"rules"`
+}
+
+// LoadFilterRules Reads the filter rules from a file in JSON (when its extension is .json) or YAML format.
+func LoadFilterRules(path string) (*FilterRules, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read filter rules: %v", err)
+	}
+	rules := &FilterRules{}
+	if err := unmarshalConfig(path, data, rules); err != nil {
+		return nil, err
+	}
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Validate Verifies the rules, applying defaults when necessary.
+func (f *FilterRules) Validate() error {
+	for i := range f.Rules {
+		if err := f.Rules[i].compile(); err != nil {
+			return fmt.Errorf("invalid rule %d: %v", i+1, err)
+		}
+	}
+	switch f.Default {
+	case RuleInclude, RuleExclude:
+	case "":
+		f.Default = RuleInclude
+		for _, r := range f.Rules {
+			if r.Action == RuleInclude {
+				f.Default = RuleExclude
+				break
+			}
+		}
+	default:
+		return fmt.Errorf("invalid default action %q; expecting %s or %s", f.Default, RuleInclude, RuleExclude)
+	}
+	return nil
+}
+
+// Allows Returns true when the decoded message should be processed.
+// Must be called after Validate.
+func (f *FilterRules) Allows(msg DecodedMessage) bool {
+	if f == nil {
+		return true
+	}
+	fields := &ruleFields{}
+	for i := range f.Rules {
+		if f.Rules[i].matches(msg, fields) {
+			return f.Rules[i].Action == RuleInclude
+		}
+	}
+	return f.Default == RuleInclude
+}
+
+// ruleFields extracts the fields of the payload used by the rules on demand, only once per message.
+type ruleFields struct {
+	oids         []string
+	codes        []int
+	parsedTraps  bool
+	parsedSyslog bool
+}
+
+// trapOIDs Returns the enterprise OIDs of the traps of an SNMP message.
+func (f *ruleFields) trapOIDs(msg DecodedMessage) []string {
+	if f.parsedTraps || !isSnmp(msg.Parser) {
+		return f.oids
+	}
+	f.parsedTraps = true
+	var trapLog struct {
+		Messages []struct {
+			TrapIdentity *TrapIdentityDTO `json:"trapIdentity"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(msg.Payload, &trapLog); err != nil {
+		return nil
+	}
+	for _, trap := range trapLog.Messages {
+		if trap.TrapIdentity != nil {
+			f.oids = append(f.oids, trap.TrapIdentity.EnterpriseID)
+		}
+	}
+	return f.oids
+}
+
+// facilities Returns the facilities of the messages of a Syslog message.
+func (f *ruleFields) facilities(msg DecodedMessage) []int {
+	if f.parsedSyslog || !isSyslog(msg.Parser) {
+		return f.codes
+	}
+	f.parsedSyslog = true
+	var syslog struct {
+		Messages []struct {
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(msg.Payload, &syslog); err != nil {
+		return nil
+	}
+	for _, m := range syslog.Messages {
+		if fields, ok := ParseSyslog(m.Content); ok {
+			f.codes = append(f.codes, fields.Facility)
+		}
+	}
+	return f.codes
+}
+
+// parseNetworks Parses a list of IP addresses or CIDRs.
+func parseNetworks(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, len(values))
+	for i, value := range values {
+		network, err := parseNetwork(value)
+		if err != nil {
+			return nil, err
+		}
+		networks[i] = network
+	}
+	return networks, nil
+}
+
+// containsIP Returns true when the address belongs to any of the networks.
+func containsIP(networks []*net.IPNet, address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
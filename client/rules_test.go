@@ -0,0 +1,86 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestLoadFilterRules(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.yaml")
+	assert.NilError(t, ioutil.WriteFile(path, []byte(`
+rules:
+- action: exclude
+  trap-oids: [.1.3.6.1.4.1.9.9.41]
+- action: include
+  sources: [10.1.0.0/16, 192.168.10.1]
+- action: include
+  facilities: [auth, "10"]
+  locations: [Apex]
+- action: include
+  exporters: [172.16.0.0/12]
+`), 0644))
+	rules, err := LoadFilterRules(path)
+	assert.NilError(t, err)
+	assert.Equal(t, 4, len(rules.Rules))
+	assert.Equal(t, RuleExclude, rules.Default)
+	assert.DeepEqual(t, []int{4, 10}, rules.Rules[2].facilities)
+
+	for content, expected := range map[string]string{
+		"rules:\n- action: drop\n":                           "invalid action",
+		"rules:\n- action: include\n  sources: [invalid]\n":  "invalid sources",
+		"rules:\n- action: include\n  facilities: [web]\n":   "invalid facility",
+		"rules:\n- action: include\n  subnets: [10.0.0.1]\n": "not found in type",
+		"default: drop\nrules: []\n":                         "invalid default action",
+	} {
+		assert.NilError(t, ioutil.WriteFile(path, []byte(content), 0644))
+		_, err := LoadFilterRules(path)
+		assert.ErrorContains(t, err, expected)
+	}
+
+	path = filepath.Join(dir, "rules.json")
+	assert.NilError(t, ioutil.WriteFile(path, []byte(`{"rules":[{"action":"exclude","locations":["Lab"]}]}`), 0644))
+	rules, err = LoadFilterRules(path)
+	assert.NilError(t, err)
+	assert.Equal(t, RuleInclude, rules.Default)
+}
+
+func TestFilterRulesAllows(t *testing.T) {
+	rules := &FilterRules{Rules: []FilterRule{
+		{Action: RuleExclude, TrapOIDs: []string{".1.3.6.1.4.1.9.9.41"}},
+		{Action: RuleInclude, Sources: []string{"10.1.0.0/16"}},
+		{Action: RuleInclude, Facilities: []string{"auth"}, Locations: []string{"Apex"}},
+		{Action: RuleInclude, Exporters: []string{"172.16.0.0/12"}},
+	}}
+	assert.NilError(t, rules.Validate())
+	trap := func(source, oid string) DecodedMessage {
+		return DecodedMessage{
+			Parser:   "snmp",
+			Metadata: Metadata{SourceAddress: source},
+			Payload:  []byte(`{"trapAddress":"` + source + `","messages":[{"trapIdentity":{"enterpriseID":"` + oid + `"}}]}`),
+		}
+	}
+	syslog := func(location, content string) DecodedMessage {
+		return DecodedMessage{
+			Parser:   "syslog",
+			Metadata: Metadata{SourceAddress: "192.168.0.1", Location: location},
+			Payload:  []byte(`{"messages":[{"content":"` + content + `"}]}`),
+		}
+	}
+	assert.Assert(t, rules.Allows(trap("10.1.2.3", ".1.3.6.1.4.1.8072.4")))
+	assert.Assert(t, !rules.Allows(trap("10.1.2.3", ".1.3.6.1.4.1.9.9.41.2")))
+	assert.Assert(t, !rules.Allows(trap("10.2.0.1", ".1.3.6.1.4.1.8072.4")))
+	assert.Assert(t, rules.Allows(syslog("Apex", "<34>Oct 11 22:14:15 host su: failed"))) // auth
+	assert.Assert(t, !rules.Allows(syslog("Lab", "<34>Oct 11 22:14:15 host su: failed"))) // auth
+	assert.Assert(t, !rules.Allows(syslog("Apex", "<13>Oct 11 22:14:15 host app: test"))) // user
+	assert.Assert(t, rules.Allows(DecodedMessage{Parser: "netflow", Metadata: Metadata{SourceAddress: "172.16.1.1"}}))
+	assert.Assert(t, !rules.Allows(DecodedMessage{Parser: "syslog", Metadata: Metadata{SourceAddress: "172.16.1.1"}}))
+
+	var noRules *FilterRules
+	assert.Assert(t, noRules.Allows(trap("10.2.0.1", ".1.3.6.1.4.1.8072.4")))
+}
@@ -0,0 +1,338 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Default S3 output settings
+const (
+	DefaultS3Region        = "us-east-1"
+	DefaultS3FlushInterval = 5 * time.Minute
+	DefaultS3MaxBatchSize  = 64 * 1024 * 1024
+	DefaultS3MaxRetries    = 3
+	DefaultS3RetryDelay    = time.Second
+)
+
+// s3Objects tracks the final result of the batches uploaded to the S3 buckets.
+var s3Objects = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "onms_ipc_s3_objects_total",
+	Help: "The total number of batches uploaded as objects to an S3 bucket by bucket and result (success or failure), after the retries",
+}, []string{"bucket", "result"})
+
+// S3Output batches the decoded messages into objects uploaded to an S3 compatible storage, for cheap long-term retention.
+// Each object contains the messages received within a time window, one JSON document per line, using the same envelope as
+// the ForwardOutput with the json format, optionally compressed with gzip. The objects are named after the window, as
+// prefix/yyyy/mm/dd/HH/start-end-instance-sequence.jsonl[.gz] (in UTC), where the instance is random, so multiple receivers can share a prefix.
+// A batch is uploaded when the flush interval expires, or when it exceeds the maximum size. The upload failures are retried
+// with an exponential backoff; the batches that can't be uploaded are dropped, as the messages were already acknowledged.
+// The requests are signed through AWS Signature Version 4 when an access key is provided, using path-style URLs.
+// This is a concurrent safe object.
+type S3Output struct {
+	Endpoint      string        // The S3 endpoint (defaults to https://s3.<region>.amazonaws.com).
+	Region        string        // The region of the bucket, used to sign the requests (defaults to DefaultS3Region).
+	Bucket        string        // The name of the bucket.
+	Prefix        string        // The prefix of the object keys (optional).
+	AccessKey     string        // The access key ID to sign the requests (optional).
+	SecretKey     string        `json:"-"` // The secret access key; accepts secret references (optional).
+	FlushInterval time.Duration // How often the batch is uploaded (defaults to DefaultS3FlushInterval).
+	MaxBatchSize  int           // Upload the batch when it exceeds this size in bytes, before compression (defaults to DefaultS3MaxBatchSize).
+	Compress      bool          // Compress the objects with gzip.
+	MaxRetries    int           // How many times a failed upload is retried (defaults to DefaultS3MaxRetries).
+	RetryDelay    time.Duration // The delay before the first retry, doubled on each attempt (defaults to DefaultS3RetryDelay).
+	Client        *http.Client  `json:"-"` // The HTTP client (optional).
+
+	mutex    sync.Mutex
+	batch    bytes.Buffer
+	start    time.Time // When the first message of the batch arrived.
+	instance string
+	sequence int // The number of batches taken, which makes the object keys unique within the instance.
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// s3Batch contains the messages of a time window to upload.
+type s3Batch struct {
+	data     []byte
+	start    time.Time
+	end      time.Time
+	sequence int
+}
+
+// Validate Verifies the S3 output settings, applying defaults when necessary, and starts the periodic uploads.
+func (out *S3Output) Validate() error {
+	if out.Bucket == "" {
+		return fmt.Errorf("the bucket is required")
+	}
+	if out.Region == "" {
+		out.Region = DefaultS3Region
+	}
+	if out.Endpoint == "" {
+		out.Endpoint = "https://s3." + out.Region + ".amazonaws.com"
+	}
+	out.Endpoint = strings.TrimSuffix(out.Endpoint, "/")
+	out.Prefix = strings.Trim(out.Prefix, "/")
+	if out.FlushInterval <= 0 {
+		out.FlushInterval = DefaultS3FlushInterval
+	}
+	if out.MaxBatchSize <= 0 {
+		out.MaxBatchSize = DefaultS3MaxBatchSize
+	}
+	if out.MaxRetries <= 0 {
+		out.MaxRetries = DefaultS3MaxRetries
+	}
+	if out.RetryDelay <= 0 {
+		out.RetryDelay = DefaultS3RetryDelay
+	}
+	if out.stop == nil {
+		id := make([]byte, 4)
+		if _, err := rand.Read(id); err != nil {
+			return fmt.Errorf("cannot generate instance ID: %v", err)
+		}
+		out.instance = hex.EncodeToString(id)
+		out.stop = make(chan struct{})
+		out.wg.Add(1)
+		go out.flusher()
+	}
+	return nil
+}
+
+// Name Returns the name of the output.
+func (out *S3Output) Name() string {
+	return "s3:" + out.Bucket
+}
+
+// Send Adds a decoded message to the current batch, uploading it in the background when it exceeds the maximum size.
+func (out *S3Output) Send(ctx context.Context, msg DecodedMessage) error {
+	data, err := json.Marshal(newForwardEnvelope(msg))
+	if err != nil {
+		return fmt.Errorf("cannot encode message: %v", err)
+	}
+	out.mutex.Lock()
+	if out.batch.Len() == 0 {
+		out.start = time.Now()
+	}
+	out.batch.Write(data)
+	out.batch.WriteByte('\n')
+	var batch *s3Batch
+	if out.batch.Len() >= out.MaxBatchSize {
+		batch = out.takeBatch()
+	}
+	out.mutex.Unlock()
+	if batch != nil {
+		out.wg.Add(1)
+		go func() {
+			defer out.wg.Done()
+			out.upload(batch)
+		}()
+	}
+	return nil
+}
+
+// Close Stops the periodic uploads, uploading the current batch.
+func (out *S3Output) Close() error {
+	if out.stop == nil {
+		return nil
+	}
+	close(out.stop)
+	out.wg.Wait()
+	out.stop = nil
+	return nil
+}
+
+// flusher Uploads the current batch periodically, and once more when the output is closed.
+func (out *S3Output) flusher() {
+	defer out.wg.Done()
+	ticker := time.NewTicker(out.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			out.flush()
+		case <-out.stop:
+			out.flush()
+			return
+		}
+	}
+}
+
+// flush Uploads the current batch, if any.
+func (out *S3Output) flush() {
+	out.mutex.Lock()
+	batch := out.takeBatch()
+	out.mutex.Unlock()
+	if batch != nil {
+		out.upload(batch)
+	}
+}
+
+// takeBatch Returns the current batch, starting a new one; must be called while holding the lock.
+func (out *S3Output) takeBatch() *s3Batch {
+	if out.batch.Len() == 0 {
+		return nil
+	}
+	out.sequence++
+	batch := &s3Batch{data: append([]byte(nil), out.batch.Bytes()...), start: out.start, end: time.Now(), sequence: out.sequence}
+	out.batch.Reset()
+	return batch
+}
+
+// objectKey Returns the key of the object of a batch.
+func (out *S3Output) objectKey(batch *s3Batch) string {
+	start := batch.start.UTC()
+	key := fmt.Sprintf("%s/%s-%s-%s-%d.jsonl", start.Format("2006/01/02/15"), start.Format("20060102T150405Z"), batch.end.UTC().Format("20060102T150405Z"), out.instance, batch.sequence)
+	if out.Prefix != "" {
+		key = out.Prefix + "/" + key
+	}
+	if out.Compress {
+		key += ".gz"
+	}
+	return key
+}
+
+// upload Sends a batch to the bucket, retrying the failures with an exponential backoff.
+func (out *S3Output) upload(batch *s3Batch) {
+	key := out.objectKey(batch)
+	data := batch.data
+	if out.Compress {
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		writer.Write(data)
+		writer.Close()
+		data = buf.Bytes()
+	}
+	delay := out.RetryDelay
+	for attempt := 0; ; attempt++ {
+		err := out.put(key, data)
+		if err == nil {
+			s3Objects.WithLabelValues(out.Bucket, OutputSuccess).Inc()
+			defaultLogger.Debugf("uploaded %s to %s with %d bytes", key, out.Bucket, len(data))
+			return
+		}
+		if attempt >= out.MaxRetries {
+			s3Objects.WithLabelValues(out.Bucket, "failure").Inc()
+			defaultLogger.Errorf("cannot upload %s to %s after %d retries, dropping it: %v", key, out.Bucket, attempt, err)
+			return
+		}
+		defaultLogger.Warnf("cannot upload %s to %s, retrying in %s: %v", key, out.Bucket, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// put Uploads an object to the bucket.
+func (out *S3Output) put(key string, data []byte) error {
+	path := "/" + s3Escape(out.Bucket) + "/" + s3Escape(key)
+	req, err := http.NewRequest(http.MethodPut, out.Endpoint+path, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("cannot create request: %v", err)
+	}
+	if out.Compress {
+		req.Header.Set("Content-Type", "application/gzip")
+	} else {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	}
+	if out.AccessKey != "" {
+		secret, err := ResolveSecret(out.SecretKey)
+		if err != nil {
+			return fmt.Errorf("cannot resolve S3 secret key: %v", err)
+		}
+		signS3Request(req, path, data, out.Region, out.AccessKey, secret, time.Now())
+	}
+	client := out.Client
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot upload object: %v", err)
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("cannot upload object: %s", res.Status)
+	}
+	return nil
+}
+
+// signS3Request Adds the AWS Signature Version 4 headers to a request for S3, based on its escaped path and payload.
+func signS3Request(req *http.Request, path string, payload []byte, region, accessKey, secretKey string, now time.Time) {
+	signAWSRequest(req, path, payload, "s3", region, awsCredentials{AccessKey: accessKey, SecretKey: secretKey}, now)
+}
+
+// signAWSRequest Adds the AWS Signature Version 4 headers to a request for a given service, based on its escaped path and payload.
+// The session token of temporary credentials is added, and signed, as X-Amz-Security-Token.
+func signAWSRequest(req *http.Request, path string, payload []byte, service, region string, creds awsCredentials, now time.Time) {
+	timestamp := now.UTC().Format("20060102T150405Z")
+	date := timestamp[:8]
+	payloadHash := sha256.Sum256(payload)
+	req.Header.Set("X-Amz-Date", timestamp)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	signed := "host;x-amz-content-sha256;x-amz-date"
+	headers := []string{
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + hex.EncodeToString(payloadHash[:]),
+		"x-amz-date:" + timestamp,
+	}
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+		signed += ";x-amz-security-token"
+		headers = append(headers, "x-amz-security-token:"+creds.SessionToken)
+	}
+	canonical := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		strings.Join(headers, "\n"),
+		"",
+		signed,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + timestamp + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+	key := []byte("AWS4" + creds.SecretKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", creds.AccessKey, scope, signed, signature))
+}
+
+// hmacSHA256 Returns the HMAC-SHA256 of a message.
+func hmacSHA256(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// s3Escape Encodes an object key for the canonical path of the signature, keeping the slashes and the unreserved characters.
+func s3Escape(key string) string {
+	var sb strings.Builder
+	for _, b := range []byte(key) {
+		if ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z') || ('0' <= b && b <= '9') || strings.IndexByte("-_.~/", b) >= 0 {
+			sb.WriteByte(b)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", b)
+		}
+	}
+	return sb.String()
+}
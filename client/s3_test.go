@@ -0,0 +1,67 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestS3Output(t *testing.T) {
+	var mutex sync.Mutex
+	objects := make(map[string][]byte)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Assert(t, regexp.MustCompile(`^AWS4-HMAC-SHA256 Credential=AKID/\d{8}/eu-west-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=[0-9a-f]{64}$`).MatchString(r.Header.Get("Authorization")))
+		data, _ := ioutil.ReadAll(r.Body)
+		mutex.Lock()
+		objects[r.URL.Path] = data
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	out := &S3Output{Endpoint: server.URL, Region: "eu-west-1", Bucket: "flows", Prefix: "/receiver/", AccessKey: "AKID", SecretKey: "secret", MaxBatchSize: 300, Compress: true}
+	assert.NilError(t, out.Validate())
+	assert.Equal(t, "s3:flows", out.Name())
+	for i := 0; i < 3; i++ {
+		msg := DecodedMessage{Topic: "OpenNMS.Sink.Netflow-9", Parser: "netflow", Offset: int64(i), Payload: []byte(`{"flows":[]}`)}
+		assert.NilError(t, out.Send(context.Background(), msg))
+	}
+	assert.NilError(t, out.Close())
+
+	// The first batch exceeded the maximum size, and the second one was uploaded on close
+	assert.Equal(t, 2, len(objects))
+	lines := 0
+	for path, data := range objects {
+		assert.Assert(t, regexp.MustCompile(`^/flows/receiver/\d{4}/\d{2}/\d{2}/\d{2}/\d{8}T\d{6}Z-\d{8}T\d{6}Z-[0-9a-f]{8}-\d+\.jsonl\.gz$`).MatchString(path), path)
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		assert.NilError(t, err)
+		content, err := ioutil.ReadAll(reader)
+		assert.NilError(t, err)
+		lines += strings.Count(string(content), `"parser":"netflow"`)
+	}
+	assert.Equal(t, 3, lines)
+	assert.ErrorContains(t, (&S3Output{}).Validate(), "bucket is required")
+}
+
+func TestS3Signature(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPut, "https://s3.amazonaws.com/examplebucket/test.jsonl", nil)
+	signS3Request(req, "/examplebucket/test.jsonl", []byte("data"), "us-east-1", "AKID", "secret", time.Date(2021, 3, 4, 23, 30, 0, 0, time.UTC))
+	assert.Equal(t, "20210304T233000Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7", req.Header.Get("X-Amz-Content-Sha256"))
+	first := req.Header.Get("Authorization")
+	signS3Request(req, "/examplebucket/other.jsonl", []byte("data"), "us-east-1", "AKID", "secret", time.Date(2021, 3, 4, 23, 30, 0, 0, time.UTC))
+	assert.Assert(t, first != req.Header.Get("Authorization"))
+	assert.Equal(t, "a%20b/c%2Bd.jsonl", s3Escape("a b/c+d.jsonl"))
+}
@@ -0,0 +1,197 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Sampling defines the settings to reduce the volume of processed messages.
+// The rates are either the fraction of the messages to process, from 0 (exclusive) to 1 (all messages),
+// or an integer N greater than 1 to process 1 in N messages.
+type Sampling struct {
+	Rate             float64     `json:"rate"`              // The rate for the parsers without an override.
+	MaxPartitionRate int         `json:"maxPartitionRate"`  // Throttle each partition to this number of messages per second (0 to disable).
+	Parsers          ParserRates `json:"parsers,omitempty"` // The rate of specific parsers, overriding the default rate.
+}
+
+// Validate Verifies the sampling settings.
+func (s Sampling) Validate() error {
+	if err := validateSamplingRate(s.Rate); err != nil {
+		return err
+	}
+	for parser, rate := range s.Parsers {
+		if err := validateSamplingRate(rate); err != nil {
+			return fmt.Errorf("parser %s: %v", parser, err)
+		}
+	}
+	if s.MaxPartitionRate < 0 {
+		return fmt.Errorf("invalid maximum partition rate %d", s.MaxPartitionRate)
+	}
+	return nil
+}
+
+// validateSamplingRate Verifies a sampling rate, either a fraction or an integer N for 1 in N messages.
+func validateSamplingRate(rate float64) error {
+	if rate <= 0 || (rate > 1 && rate != math.Trunc(rate)) {
+		return fmt.Errorf("invalid sampling rate %g; expecting a value greater than 0 and up to 1, or an integer N to process 1 in N messages", rate)
+	}
+	return nil
+}
+
+// samplingThreshold Returns the hash threshold of the message IDs to process for a given rate.
+func samplingThreshold(rate float64) uint32 {
+	if rate > 1 {
+		rate = 1 / rate
+	}
+	return uint32(math.Round(rate * math.MaxUint32))
+}
+
+// ParserRates contains the sampling rate by parser, i.e. netflow=100; it can be used as a flag.
+type ParserRates map[string]float64
+
+func (r ParserRates) String() string {
+	items := make([]string, 0, len(r))
+	for parser, rate := range r {
+		items = append(items, fmt.Sprintf("%s=%g", parser, rate))
+	}
+	sort.Strings(items)
+	return strings.Join(items, ", ")
+}
+
+// Set Adds the rate of a parser, as parser=rate.
+func (r *ParserRates) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("invalid parser rate %s; expecting parser=rate", value)
+	}
+	rate, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return fmt.Errorf("invalid rate for parser %s: %v", parts[0], err)
+	}
+	if err := validateSamplingRate(rate); err != nil {
+		return err
+	}
+	if *r == nil {
+		*r = make(ParserRates)
+	}
+	(*r)[strings.ToLower(parts[0])] = rate
+	return nil
+}
+
+// Sampler holds the sampling settings, which can be updated at runtime, for instance to reduce the volume during incidents.
+// The decision is based on the message ID, so it is consistent across restarts and replicas.
+// It can be shared by multiple clients.
+// This is a concurrent safe object.
+type Sampler struct {
+	mutex      sync.RWMutex
+	settings   Sampling
+	threshold  uint32
+	parsers    map[string]uint32 // The thresholds of the parsers with their own rate.
+	partitions map[*KafkaClient]*partitionController
+}
+
+// NewSampler creates a new sampler with the given settings.
+func NewSampler(settings Sampling) (*Sampler, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	s := &Sampler{partitions: make(map[*KafkaClient]*partitionController)}
+	s.apply(settings)
+	return s, nil
+}
+
+// apply Updates the settings.
+// Must be called while holding the lock.
+func (s *Sampler) apply(settings Sampling) {
+	s.settings = settings
+	s.threshold = samplingThreshold(settings.Rate)
+	s.parsers = make(map[string]uint32, len(settings.Parsers))
+	for parser, rate := range settings.Parsers {
+		s.parsers[strings.ToLower(parser)] = samplingThreshold(rate)
+	}
+	for _, pc := range s.partitions {
+		pc.setMaxRate(settings.MaxPartitionRate)
+	}
+}
+
+// Settings Returns the current settings.
+func (s *Sampler) Settings() Sampling {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.settings
+}
+
+// Update Changes the settings, applying them to all the clients immediately.
+func (s *Sampler) Update(settings Sampling) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.apply(settings)
+	defaultLogger.Infof("sampling updated: rate %g, max partition rate %d, parser rates [%s]", settings.Rate, settings.MaxPartitionRate, settings.Parsers)
+	return nil
+}
+
+// Keep Returns true when a message should be processed, based on the default rate.
+func (s *Sampler) Keep(id string) bool {
+	return s.KeepParser(id, "")
+}
+
+// KeepParser Returns true when a message for a given parser should be processed, based on the rate of the parser, or the default rate.
+func (s *Sampler) KeepParser(id, parser string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	threshold, ok := s.parsers[strings.ToLower(parser)]
+	if !ok {
+		threshold = s.threshold
+	}
+	if threshold == math.MaxUint32 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return h.Sum32() < threshold
+}
+
+// register Applies the partition rate to the partition controller of a client, and tracks it for future updates.
+func (s *Sampler) register(cli *KafkaClient, pc *partitionController) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.partitions[cli] = pc
+	pc.setMaxRate(s.settings.MaxPartitionRate)
+}
+
+// Handler Returns an HTTP handler to manage the sampling settings.
+// GET returns the current settings, and PUT replaces them from a JSON Sampling.
+func (s *Sampler) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			settings := Sampling{}
+			if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := s.Update(settings); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.Settings())
+	})
+}
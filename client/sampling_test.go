@@ -0,0 +1,75 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestSampler(t *testing.T) {
+	_, err := NewSampler(Sampling{})
+	assert.ErrorContains(t, err, "invalid sampling rate")
+	s, err := NewSampler(Sampling{Rate: 1, MaxPartitionRate: 10})
+	assert.NilError(t, err)
+
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	s.register(cli, cli.partitions)
+	assert.Equal(t, 10, cli.partitions.maxRate)
+
+	count := func() int {
+		kept := 0
+		for i := 0; i < 1000; i++ {
+			if s.Keep(fmt.Sprintf("message-%d", i)) {
+				kept++
+			}
+		}
+		return kept
+	}
+	assert.Equal(t, 1000, count())
+	assert.NilError(t, s.Update(Sampling{Rate: 0.25}))
+	kept := count()
+	assert.Assert(t, kept > 150 && kept < 350, kept)
+	assert.Equal(t, kept, count()) // Consistent decisions
+	assert.Equal(t, 0, cli.partitions.maxRate)
+	assert.ErrorContains(t, s.Update(Sampling{Rate: 1, MaxPartitionRate: -1}), "invalid maximum partition rate")
+
+	// 1 in N messages, with a per-parser override
+	parsers := ParserRates{}
+	assert.NilError(t, parsers.Set("NetFlow=1"))
+	assert.ErrorContains(t, parsers.Set("netflow"), "expecting parser=rate")
+	assert.ErrorContains(t, parsers.Set("netflow=2.5"), "invalid sampling rate")
+	assert.Equal(t, "netflow=1", parsers.String())
+	assert.NilError(t, s.Update(Sampling{Rate: 10, Parsers: parsers}))
+	kept = count()
+	assert.Assert(t, kept > 50 && kept < 150, kept)
+	for i := 0; i < 1000; i++ {
+		assert.Assert(t, s.KeepParser(fmt.Sprintf("message-%d", i), "netflow"))
+	}
+	assert.ErrorContains(t, s.Update(Sampling{Rate: 1, Parsers: ParserRates{"syslog": 0}}), "parser syslog: invalid sampling rate")
+}
+
+func TestSamplerHandler(t *testing.T) {
+	s, err := NewSampler(Sampling{Rate: 1})
+	assert.NilError(t, err)
+	handler := s.Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/admin/sampling", strings.NewReader(`{"rate":0.5,"maxPartitionRate":100}`)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.DeepEqual(t, Sampling{Rate: 0.5, MaxPartitionRate: 100}, s.Settings())
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/admin/sampling", strings.NewReader(`{"rate":2.5}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/sampling", nil))
+	assert.Equal(t, `{"rate":0.5,"maxPartitionRate":100}`, strings.TrimSpace(rec.Body.String()))
+}
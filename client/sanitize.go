@@ -0,0 +1,96 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// maskedValue replaces the sensitive values.
+const maskedValue = "***"
+
+// sensitiveKeys contains the patterns of the names of the settings that might contain secrets, at any level, like sasl.jaas.config.
+var sensitiveKeys = []string{"password", "passwd", "secret", "jaas", "token", "credential", "keystore", "apikey", "routingkey", "authorization"}
+
+// sensitiveLeaves contains the suffixes of the names of the settings with the location of private keys, like TLSKey or Keytab.
+var sensitiveLeaves = []string{"tlskey", "sslkey", "privatekey", "keytab"}
+
+// keyContexts contains the settings whose key entry is a private key, like TLS.Key or ssl.key.location.
+var keyContexts = map[string]bool{"tls": true, "ssl": true}
+
+// normalizeKey Returns the lowercase name of a setting without separators, so TLS_Key, tls-key and TLSKey are equivalent.
+func normalizeKey(key string) string {
+	return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(key))
+}
+
+// isSensitive Returns true when a setting might contain a secret, where the dots of its name are treated as levels, like ssl.key.location.
+func isSensitive(key string) bool {
+	return isSensitivePath(strings.Split(key, "."))
+}
+
+// isSensitivePath Returns true when the setting at the given path might contain a secret, or reveal where it is stored.
+func isSensitivePath(path []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+	segments := make([]string, len(path))
+	for i, segment := range path {
+		segments[i] = normalizeKey(segment)
+	}
+	for _, segment := range segments {
+		for _, s := range sensitiveKeys {
+			if strings.Contains(segment, s) {
+				return true
+			}
+		}
+	}
+	leaf := segments[len(segments)-1]
+	for _, s := range sensitiveLeaves {
+		if strings.HasSuffix(leaf, s) {
+			return true
+		}
+	}
+	for i := 1; i < len(segments); i++ {
+		if segments[i] == "key" && keyContexts[segments[i-1]] {
+			return true
+		}
+	}
+	return false
+}
+
+// Sanitize Returns the JSON representation of a configuration object, masking the values of the sensitive settings,
+// like passwords, tokens and keystore paths, so it can be safely logged or exposed.
+// Secret references (see ResolveSecret) are not masked, as they don't reveal the secrets.
+func Sanitize(config interface{}) ([]byte, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	return json.Marshal(sanitizeValue(nil, generic))
+}
+
+// sanitizeValue Masks the sensitive values of a decoded JSON object recursively, based on the full path of each setting.
+func sanitizeValue(path []string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = sanitizeValue(append(path[:len(path):len(path)], strings.Split(k, ".")...), item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = sanitizeValue(path, item)
+		}
+		return v
+	case string:
+		if v != "" && isSensitivePath(path) && !isSecretReference(v) {
+			return maskedValue
+		}
+	}
+	return value
+}
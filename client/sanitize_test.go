@@ -0,0 +1,69 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestSanitize(t *testing.T) {
+	config := map[string]interface{}{
+		"bootstrap": "kafka:9092",
+		"settings": map[string]interface{}{
+			"sasl.password":           "s3cr3t",
+			"ssl.keystore.location":   "/etc/kafka/keystore.jks",
+			"ssl.truststore.location": "/etc/kafka/truststore.jks",
+			"http_token":              "env:HTTP_TOKEN",
+			"empty_password":          "",
+			"ssl.key.location":        "/etc/kafka/client.key",
+		},
+		"TLS":          map[string]interface{}{"CACert": "/etc/ca.pem", "Key": "/etc/tls/client.key"},
+		"SASL":         map[string]interface{}{"Username": "admin", "Keytab": "/etc/krb5.keytab"},
+		"HeaderFilter": []interface{}{map[string]interface{}{"Key": "tenant", "Value": "acme"}},
+		"stream":       map[string]interface{}{"tls_key": "/etc/stream.key"},
+		"outputs":      []interface{}{map[string]interface{}{"apiKey": "abc", "url": "https://example.com"}},
+	}
+	data, err := Sanitize(config)
+	assert.NilError(t, err)
+	sanitized := map[string]interface{}{}
+	assert.NilError(t, json.Unmarshal(data, &sanitized))
+	settings := sanitized["settings"].(map[string]interface{})
+	assert.Equal(t, "kafka:9092", sanitized["bootstrap"])
+	assert.Equal(t, maskedValue, settings["sasl.password"])
+	assert.Equal(t, maskedValue, settings["ssl.keystore.location"])
+	assert.Equal(t, "/etc/kafka/truststore.jks", settings["ssl.truststore.location"])
+	assert.Equal(t, "env:HTTP_TOKEN", settings["http_token"])
+	assert.Equal(t, "", settings["empty_password"])
+	assert.Equal(t, maskedValue, settings["ssl.key.location"])
+	assert.DeepEqual(t, map[string]interface{}{"CACert": "/etc/ca.pem", "Key": maskedValue}, sanitized["TLS"])
+	assert.DeepEqual(t, map[string]interface{}{"Username": "admin", "Keytab": maskedValue}, sanitized["SASL"])
+	assert.DeepEqual(t, []interface{}{map[string]interface{}{"Key": "tenant", "Value": "acme"}}, sanitized["HeaderFilter"])
+	assert.DeepEqual(t, map[string]interface{}{"tls_key": maskedValue}, sanitized["stream"])
+	output := sanitized["outputs"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, maskedValue, output["apiKey"])
+	assert.Equal(t, "https://example.com", output["url"])
+}
+
+func TestStatusHandler(t *testing.T) {
+	cli := &KafkaClient{Topic: "Test", Parameters: Properties{"sasl.password": "s3cr3t", "sasl.username": "admin"}}
+	recorder := httptest.NewRecorder()
+	StatusHandler([]*Pipeline{NewPipeline("traps", cli, nil)}).ServeHTTP(recorder, httptest.NewRequest("GET", "/admin/status", nil))
+	body := recorder.Body.String()
+	assert.Assert(t, strings.Contains(body, `"sasl.username":"admin"`))
+	assert.Assert(t, !strings.Contains(body, "s3cr3t"))
+	assert.Assert(t, strings.Contains(body, `"name":"traps"`))
+}
+
+func TestSanitizeClient(t *testing.T) {
+	cli := &KafkaClient{Topic: "Test", TLS: TLSConfig{Cert: "/etc/tls/client.pem", Key: "/etc/tls/client.key"}, SASL: SASLConfig{Mechanism: "GSSAPI", Keytab: "/etc/krb5.keytab"}}
+	data, err := Sanitize(cli)
+	assert.NilError(t, err)
+	assert.Assert(t, !strings.Contains(string(data), "/etc/tls/client.key"))
+	assert.Assert(t, !strings.Contains(string(data), "/etc/krb5.keytab"))
+	assert.Assert(t, strings.Contains(string(data), "/etc/tls/client.pem"))
+}
@@ -0,0 +1,117 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Shopify/sarama"
+)
+
+// SASL mechanisms
+const (
+	SASLPlain       = sarama.SASLTypePlaintext
+	SASLScramSHA256 = sarama.SASLTypeSCRAMSHA256
+	SASLScramSHA512 = sarama.SASLTypeSCRAMSHA512
+	SASLGSSAPI      = sarama.SASLTypeGSSAPI
+)
+
+// SASLConfig defines the SASL settings to authenticate against Kafka.
+// It takes precedence over the equivalent settings passed through the parameters.
+type SASLConfig struct {
+	Mechanism      string // The SASL mechanism: PLAIN, SCRAM-SHA-256, SCRAM-SHA-512 or GSSAPI (disabled when empty).
+	Username       string // The user name, or the Kerberos principal as user@REALM for GSSAPI.
+	Password       string `json:"-"` // The password (optional for GSSAPI with a keytab); accepts secret references (see ResolveSecret).
+	Keytab         string // Path to the Kerberos keytab (GSSAPI only).
+	KerberosConfig string // Path to the Kerberos configuration (GSSAPI only; defaults to /etc/krb5.conf).
+	ServiceName    string // The Kerberos service name of the brokers (GSSAPI only; defaults to kafka).
+}
+
+// Enabled Returns true when a SASL mechanism is defined.
+func (s *SASLConfig) Enabled() bool {
+	return s.Mechanism != ""
+}
+
+// Validate Verifies the SASL settings.
+func (s *SASLConfig) Validate() error {
+	if !s.Enabled() {
+		return nil
+	}
+	s.Mechanism = strings.ToUpper(s.Mechanism)
+	switch s.Mechanism {
+	case SASLPlain, SASLScramSHA256, SASLScramSHA512:
+		if s.Username == "" || s.Password == "" {
+			return fmt.Errorf("username and password are required for %s", s.Mechanism)
+		}
+	case SASLGSSAPI:
+		if !strings.Contains(s.Username, "@") {
+			return fmt.Errorf("the principal is required for %s as user@REALM", s.Mechanism)
+		}
+		if s.Keytab == "" && s.Password == "" {
+			return fmt.Errorf("either keytab or password is required for %s", s.Mechanism)
+		}
+		for _, path := range []string{s.Keytab, s.KerberosConfig} {
+			if path == "" {
+				continue
+			}
+			if _, err := os.Stat(path); err != nil {
+				return fmt.Errorf("cannot access %s: %v", path, err)
+			}
+		}
+	default:
+		return fmt.Errorf("invalid SASL mechanism %s; expecting %s, %s, %s or %s", s.Mechanism, SASLPlain, SASLScramSHA256, SASLScramSHA512, SASLGSSAPI)
+	}
+	if _, err := ResolveSecret(s.Password); err != nil {
+		return fmt.Errorf("cannot resolve SASL password: %v", err)
+	}
+	return nil
+}
+
+// apply Updates the Sarama configuration based on the SASL settings.
+func (s *SASLConfig) apply(config *sarama.Config) error {
+	if !s.Enabled() {
+		return nil
+	}
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	password, err := ResolveSecret(s.Password)
+	if err != nil {
+		return fmt.Errorf("cannot resolve SASL password: %v", err)
+	}
+	config.Net.SASL.Enable = true
+	config.Net.SASL.Mechanism = sarama.SASLMechanism(s.Mechanism)
+	if s.Mechanism != SASLGSSAPI {
+		config.Net.SASL.User = s.Username
+		config.Net.SASL.Password = password
+		if s.Mechanism != SASLPlain {
+			mechanism := s.Mechanism
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return newSCRAMClient(mechanism)
+			}
+		}
+		return nil
+	}
+	gssapi := &config.Net.SASL.GSSAPI
+	idx := strings.LastIndex(s.Username, "@")
+	gssapi.Username = s.Username[:idx]
+	gssapi.Realm = s.Username[idx+1:]
+	gssapi.ServiceName = s.ServiceName
+	if gssapi.ServiceName == "" {
+		gssapi.ServiceName = "kafka"
+	}
+	gssapi.KerberosConfigPath = s.KerberosConfig
+	if gssapi.KerberosConfigPath == "" {
+		gssapi.KerberosConfigPath = "/etc/krb5.conf"
+	}
+	if s.Keytab != "" {
+		gssapi.AuthType = sarama.KRB5_KEYTAB_AUTH
+		gssapi.KeyTabPath = s.Keytab
+	} else {
+		gssapi.AuthType = sarama.KRB5_USER_AUTH
+		gssapi.Password = password
+	}
+	return nil
+}
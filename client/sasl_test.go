@@ -0,0 +1,63 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"gotest.tools/v3/assert"
+)
+
+func TestSCRAMClient(t *testing.T) {
+	// Test vector from RFC 7677
+	c := newSCRAMClient(SASLScramSHA256)
+	c.nonce = func() string { return "rOprNGfwEbeRWgbNEkqO" }
+	assert.NilError(t, c.Begin("user", "pencil", ""))
+	msg, err := c.Step("")
+	assert.NilError(t, err)
+	assert.Equal(t, "n,,n=user,r=rOprNGfwEbeRWgbNEkqO", msg)
+	msg, err = c.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	assert.NilError(t, err)
+	assert.Equal(t, "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=", msg)
+	assert.Assert(t, !c.Done())
+	_, err = c.Step("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=")
+	assert.NilError(t, err)
+	assert.Assert(t, c.Done())
+
+	c = newSCRAMClient(SASLScramSHA512)
+	assert.NilError(t, c.Begin("user", "pencil", ""))
+	c.Step("")
+	_, err = c.Step("r=invalid,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	assert.ErrorContains(t, err, "invalid server nonce")
+}
+
+func TestSASLConfig(t *testing.T) {
+	config := sarama.NewConfig()
+	assert.NilError(t, (&SASLConfig{}).apply(config))
+	assert.Assert(t, !config.Net.SASL.Enable)
+
+	config = sarama.NewConfig()
+	assert.NilError(t, (&SASLConfig{Mechanism: "scram-sha-512", Username: "opennms", Password: "0p3nNM5"}).apply(config))
+	assert.Assert(t, config.Net.SASL.Enable)
+	assert.Equal(t, sarama.SASLMechanism(SASLScramSHA512), config.Net.SASL.Mechanism)
+	assert.Equal(t, "0p3nNM5", config.Net.SASL.Password)
+	assert.Assert(t, config.Net.SASL.SCRAMClientGeneratorFunc != nil)
+	assert.NilError(t, config.Validate())
+
+	keytab := filepath.Join(t.TempDir(), "kafka.keytab")
+	assert.NilError(t, ioutil.WriteFile(keytab, nil, 0600))
+	config = sarama.NewConfig()
+	assert.NilError(t, (&SASLConfig{Mechanism: SASLGSSAPI, Username: "opennms@EXAMPLE.COM", Keytab: keytab}).apply(config))
+	assert.Equal(t, "opennms", config.Net.SASL.GSSAPI.Username)
+	assert.Equal(t, "EXAMPLE.COM", config.Net.SASL.GSSAPI.Realm)
+	assert.Equal(t, "kafka", config.Net.SASL.GSSAPI.ServiceName)
+	assert.Equal(t, sarama.KRB5_KEYTAB_AUTH, config.Net.SASL.GSSAPI.AuthType)
+
+	assert.ErrorContains(t, (&SASLConfig{Mechanism: "OAUTHBEARER"}).Validate(), "invalid SASL mechanism")
+	assert.ErrorContains(t, (&SASLConfig{Mechanism: SASLPlain, Username: "opennms"}).Validate(), "password are required")
+	assert.ErrorContains(t, (&SASLConfig{Mechanism: SASLGSSAPI, Username: "opennms", Keytab: keytab}).Validate(), "principal is required")
+	assert.ErrorContains(t, (&SASLConfig{Mechanism: SASLGSSAPI, Username: "opennms@EXAMPLE.COM"}).Validate(), "either keytab or password")
+}
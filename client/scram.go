@@ -0,0 +1,139 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// scramClient implements the client side of the SCRAM authentication (RFC 5802), as required by Sarama for SCRAM-SHA-256 and SCRAM-SHA-512.
+type scramClient struct {
+	hash  func() hash.Hash
+	nonce func() string // Generates the client nonce (random by default).
+
+	password    string
+	gs2Header   string
+	clientNonce string
+	firstBare   string
+	serverSig   []byte
+	step        int
+}
+
+// newSCRAMClient creates a SCRAM client for a given mechanism.
+func newSCRAMClient(mechanism string) *scramClient {
+	c := &scramClient{hash: sha512.New, nonce: randomNonce}
+	if mechanism == "SCRAM-SHA-256" {
+		c.hash = sha256.New
+	}
+	return c
+}
+
+// randomNonce Returns a random nonce.
+func randomNonce() string {
+	data := make([]byte, 24)
+	rand.Read(data)
+	return base64.RawStdEncoding.EncodeToString(data)
+}
+
+// Begin Prepares the exchange with the server.
+func (c *scramClient) Begin(username, password, authzID string) error {
+	c.password = password
+	c.gs2Header = "n,"
+	if authzID != "" {
+		c.gs2Header += "a=" + scramName(authzID)
+	}
+	c.gs2Header += ","
+	c.clientNonce = c.nonce()
+	c.firstBare = "n=" + scramName(username) + ",r=" + c.clientNonce
+	c.step = 0
+	return nil
+}
+
+// Step Processes a challenge from the server, and returns the response.
+func (c *scramClient) Step(challenge string) (string, error) {
+	c.step++
+	switch c.step {
+	case 1:
+		return c.gs2Header + c.firstBare, nil
+	case 2:
+		return c.clientFinal(challenge)
+	case 3:
+		attrs := scramAttributes(challenge)
+		if e, ok := attrs["e"]; ok {
+			return "", fmt.Errorf("server error: %s", e)
+		}
+		signature, err := base64.StdEncoding.DecodeString(attrs["v"])
+		if err != nil || !hmac.Equal(signature, c.serverSig) {
+			return "", fmt.Errorf("invalid server signature")
+		}
+		return "", nil
+	}
+	return "", fmt.Errorf("unexpected challenge")
+}
+
+// Done Returns true when the exchange is completed.
+func (c *scramClient) Done() bool {
+	return c.step >= 3
+}
+
+// clientFinal Builds the final message with the client proof, from the first message of the server.
+func (c *scramClient) clientFinal(serverFirst string) (string, error) {
+	attrs := scramAttributes(serverFirst)
+	nonce := attrs["r"]
+	if !strings.HasPrefix(nonce, c.clientNonce) {
+		return "", fmt.Errorf("invalid server nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil {
+		return "", fmt.Errorf("invalid salt: %v", err)
+	}
+	iterations, err := strconv.Atoi(attrs["i"])
+	if err != nil || iterations <= 0 {
+		return "", fmt.Errorf("invalid iteration count %q", attrs["i"])
+	}
+	salted := pbkdf2.Key([]byte(c.password), salt, iterations, c.hash().Size(), c.hash)
+	clientKey := c.hmac(salted, "Client Key")
+	h := c.hash()
+	h.Write(clientKey)
+	storedKey := h.Sum(nil)
+	withoutProof := "c=" + base64.StdEncoding.EncodeToString([]byte(c.gs2Header)) + ",r=" + nonce
+	authMessage := c.firstBare + "," + serverFirst + "," + withoutProof
+	proof := c.hmac(storedKey, authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+	c.serverSig = c.hmac(c.hmac(salted, "Server Key"), authMessage)
+	return withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+func (c *scramClient) hmac(key []byte, data string) []byte {
+	mac := hmac.New(c.hash, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// scramName Escapes a user name for SCRAM.
+func scramName(name string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(name)
+}
+
+// scramAttributes Parses the attributes of a SCRAM message.
+func scramAttributes(msg string) map[string]string {
+	attrs := make(map[string]string)
+	for _, attr := range strings.Split(msg, ",") {
+		if len(attr) > 1 && attr[1] == '=' {
+			attrs[attr[:1]] = attr[2:]
+		}
+	}
+	return attrs
+}
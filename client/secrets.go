@@ -0,0 +1,201 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SecretTTL is how long the resolved secrets are cached, which defines how fast rotated secrets are picked up.
+var SecretTTL = 30 * time.Second
+
+// cachedSecret represents a resolved secret.
+type cachedSecret struct {
+	value   string
+	expires time.Time
+}
+
+var (
+	secretsMutex sync.Mutex
+	secrets      = make(map[string]cachedSecret)
+)
+
+// ResolveSecret Returns the value of a secret, which can be passed directly or as a reference:
+// @path or file:path reads it from a file (i.e. a mounted Kubernetes secret); env:NAME reads it from an environment variable;
+// and vault:path#field reads it from HashiCorp Vault (KV v1 or v2) using the VAULT_ADDR and VAULT_TOKEN environment variables.
+// Use @@ for a literal value starting with @. The resolved references are cached for SecretTTL, so rotated secrets are picked up.
+func ResolveSecret(ref string) (string, error) {
+	if !isSecretReference(ref) {
+		return strings.TrimPrefix(ref, "@"), nil // Only @@ reaches this point with a leading @
+	}
+	secretsMutex.Lock()
+	cached, ok := secrets[ref]
+	secretsMutex.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.value, nil
+	}
+	value, err := readSecret(ref)
+	if err != nil {
+		return "", err
+	}
+	secretsMutex.Lock()
+	secrets[ref] = cachedSecret{value: value, expires: time.Now().Add(SecretTTL)}
+	secretsMutex.Unlock()
+	return value, nil
+}
+
+// isSecretReference Returns true when the value is a reference to a secret, instead of the secret itself.
+func isSecretReference(value string) bool {
+	if strings.HasPrefix(value, "@@") {
+		return false
+	}
+	for _, prefix := range []string{"@", "file:", "env:", "vault:"} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// readSecret Reads the value of a secret reference.
+func readSecret(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "@"), strings.HasPrefix(ref, "file:"):
+		path := strings.TrimPrefix(strings.TrimPrefix(ref, "@"), "file:")
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("cannot read file: %v", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s not defined", name)
+		}
+		return value, nil
+	default:
+		return readVaultSecret(strings.TrimPrefix(ref, "vault:"))
+	}
+}
+
+// readVaultSecret Reads a field of a HashiCorp Vault secret, with the format path#field.
+func readVaultSecret(ref string) (string, error) {
+	idx := strings.LastIndex(ref, "#")
+	if idx < 1 {
+		return "", fmt.Errorf("invalid vault reference %s; expecting path#field", ref)
+	}
+	path, field := strings.Trim(ref[:idx], "/"), ref[idx+1:]
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR is required to read secrets from vault")
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(addr, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot create vault request: %v", err)
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	res, err := defaultHTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("cannot read vault secret %s: %v", path, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cannot read vault secret %s: %s", path, res.Status)
+	}
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("invalid vault response for %s: %v", path, err)
+	}
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok { // KV v2
+		data = nested
+	}
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("field %s not found on vault secret %s", field, path)
+	}
+	return value, nil
+}
+
+// fingerprint Returns a hash of the resolved properties, used to detect rotated secrets.
+func (p Properties) fingerprint() (uint64, error) {
+	keys := make([]string, 0, len(p))
+	for k := range p {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := fnv.New64a()
+	for _, k := range keys {
+		value, err := ResolveSecret(p[k])
+		if err != nil {
+			return 0, fmt.Errorf("cannot resolve property %s: %v", k, err)
+		}
+		fmt.Fprintf(h, "%s=%s\n", k, value)
+	}
+	return h.Sum64(), nil
+}
+
+// kafkaSecrets Returns the secret references used to connect to Kafka, from the Kafka settings and the SASL password.
+// The other credentials, like the ones of the outputs and the HTTP server, are resolved on each request or connection instead.
+func (cli *KafkaClient) kafkaSecrets() Properties {
+	refs := make(Properties)
+	for key, value := range cli.Parameters {
+		if isSecretReference(value) {
+			refs[key] = value
+		}
+	}
+	if isSecretReference(cli.SASL.Password) {
+		refs["SASL.Password"] = cli.SASL.Password // Not a valid Kafka setting, so it doesn't collide with them
+	}
+	return refs
+}
+
+// watchSecrets Reconnects the consumer when the secrets referenced by the Kafka settings or the SASL password change, until the done channel is closed.
+// It does nothing when none of them are references.
+func (cli *KafkaClient) watchSecrets(done <-chan struct{}, reconnect func()) {
+	refs := cli.kafkaSecrets()
+	if len(refs) == 0 {
+		return
+	}
+	initial, err := refs.fingerprint()
+	if err != nil {
+		cli.logger().Warnf("cannot watch the kafka credentials: %v", err)
+		return
+	}
+	ticker := time.NewTicker(SecretTTL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			current, err := refs.fingerprint()
+			if err != nil {
+				cli.logger().Warnf("cannot verify the kafka credentials: %v", err)
+				continue
+			}
+			if current != initial {
+				cli.logger().Infof("kafka credentials changed for %s, reconnecting", cli.Topic)
+				atomic.StoreInt32(&cli.reloading, 1)
+				reconnect()
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
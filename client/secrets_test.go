@@ -0,0 +1,97 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestResolveSecret(t *testing.T) {
+	defer func(ttl time.Duration) { SecretTTL = ttl }(SecretTTL)
+	SecretTTL = 0
+
+	value, err := ResolveSecret("plain")
+	assert.NilError(t, err)
+	assert.Equal(t, "plain", value)
+	value, err = ResolveSecret("@@literal")
+	assert.NilError(t, err)
+	assert.Equal(t, "@literal", value)
+
+	path := filepath.Join(t.TempDir(), "secret")
+	assert.NilError(t, ioutil.WriteFile(path, []byte("first\n"), 0600))
+	value, err = ResolveSecret("file:" + path)
+	assert.NilError(t, err)
+	assert.Equal(t, "first", value)
+	assert.NilError(t, ioutil.WriteFile(path, []byte("rotated\n"), 0600))
+	value, err = ResolveSecret("@" + path)
+	assert.NilError(t, err)
+	assert.Equal(t, "rotated", value)
+
+	os.Setenv("TEST_SECRET_VALUE", "from-env")
+	defer os.Unsetenv("TEST_SECRET_VALUE")
+	value, err = ResolveSecret("env:TEST_SECRET_VALUE")
+	assert.NilError(t, err)
+	assert.Equal(t, "from-env", value)
+	_, err = ResolveSecret("env:TEST_SECRET_MISSING")
+	assert.ErrorContains(t, err, "not defined")
+
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/secret/data/kafka", r.URL.Path)
+		assert.Equal(t, "my-token", r.Header.Get("X-Vault-Token"))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"data": map[string]string{"password": "from-vault"}},
+		})
+	}))
+	defer vault.Close()
+	os.Setenv("VAULT_ADDR", vault.URL)
+	os.Setenv("VAULT_TOKEN", "my-token")
+	defer os.Unsetenv("VAULT_ADDR")
+	defer os.Unsetenv("VAULT_TOKEN")
+	value, err = ResolveSecret("vault:secret/data/kafka#password")
+	assert.NilError(t, err)
+	assert.Equal(t, "from-vault", value)
+	_, err = ResolveSecret("vault:secret/data/kafka#username")
+	assert.ErrorContains(t, err, "field username not found")
+}
+
+func TestPropertiesJSON(t *testing.T) {
+	p := Properties{"sasl.password": "s3cr3t", "sasl.username": "admin", "sasl.oauth.token": "env:TOKEN"}
+	data, err := json.Marshal(p)
+	assert.NilError(t, err)
+	assert.Equal(t, `{"sasl.oauth.token":"env:TOKEN","sasl.password":"***","sasl.username":"admin"}`, string(data))
+}
+
+func TestWatchSecrets(t *testing.T) {
+	defer func(ttl time.Duration) { SecretTTL = ttl }(SecretTTL)
+	SecretTTL = 10 * time.Millisecond
+
+	path := filepath.Join(t.TempDir(), "password")
+	assert.NilError(t, ioutil.WriteFile(path, []byte("first\n"), 0600))
+	cli := &KafkaClient{Topic: "Test", SASL: SASLConfig{Mechanism: SASLPlain, Username: "admin", Password: "@" + path}}
+	assert.DeepEqual(t, Properties{"SASL.Password": "@" + path}, cli.kafkaSecrets())
+
+	// The consumer reconnects when the SASL password is rotated
+	reconnected := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go cli.watchSecrets(done, func() { close(reconnected) })
+	time.Sleep(3 * SecretTTL)
+	assert.NilError(t, ioutil.WriteFile(path, []byte("rotated\n"), 0600))
+	select {
+	case <-reconnected:
+	case <-time.After(time.Second):
+		t.Fatal("the consumer didn't reconnect after rotating the SASL password")
+	}
+
+	cli = &KafkaClient{Parameters: Properties{"sasl.username": "admin"}, SASL: SASLConfig{Password: "s3cr3t"}}
+	assert.Equal(t, 0, len(cli.kafkaSecrets()))
+}
@@ -0,0 +1,157 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// Seek positions
+const (
+	SeekBeginning = "beginning" // The oldest record available on each partition.
+	SeekEnd       = "end"       // The next record produced on each partition, skipping the backlog.
+)
+
+// validateSeek Verifies the seek settings.
+func (cli *KafkaClient) validateSeek() error {
+	if err := validateSeekPosition(cli.Seek, cli.SeekTimestamp); err != nil {
+		return err
+	}
+	if cli.seekRequested() && cli.Source != nil {
+		return fmt.Errorf("seeking requires the Kafka consumer")
+	}
+	return nil
+}
+
+// validateSeekPosition Verifies a seek position and timestamp, which are mutually exclusive.
+func validateSeekPosition(position string, timestamp time.Time) error {
+	if position != "" && !timestamp.IsZero() {
+		return fmt.Errorf("the seek position and the seek timestamp are mutually exclusive")
+	}
+	switch position {
+	case "", SeekBeginning, SeekEnd:
+	default:
+		if offset, err := strconv.ParseInt(position, 10, 64); err != nil || offset < 0 {
+			return fmt.Errorf("invalid seek position %s; expecting %s, %s or an offset", position, SeekBeginning, SeekEnd)
+		}
+	}
+	return nil
+}
+
+// SeekTo Resets the offsets of the consumer group at runtime to a position (beginning, end or an offset) or a timestamp, like Seek and SeekTimestamp.
+// The consumer is closed, and the offsets are reset before joining the group again, so the client must run within a Pipeline, which restarts it.
+// As Kafka rejects the commits from non-members while the group is active, the other members of the group must be stopped first.
+func (cli *KafkaClient) SeekTo(position string, timestamp time.Time) error {
+	if position == "" && timestamp.IsZero() {
+		return fmt.Errorf("either the seek position or the seek timestamp is required")
+	}
+	if err := validateSeekPosition(position, timestamp); err != nil {
+		return err
+	}
+	if cli.Source != nil {
+		return fmt.Errorf("seeking requires the Kafka consumer")
+	}
+	if cli.cancel == nil {
+		return fmt.Errorf("consumer not initialized")
+	}
+	cli.mutex.Lock()
+	cli.Seek, cli.SeekTimestamp, cli.seeked = position, timestamp, false
+	atomic.StoreInt32(&cli.reloading, 1)
+	cli.mutex.Unlock()
+	cli.logger().Infof("seeking group %s on demand, reconnecting", cli.GroupID)
+	cli.cancel()
+	return nil
+}
+
+// seekRequested Returns true when the offsets of the consumer group should be reset.
+func (cli *KafkaClient) seekRequested() bool {
+	return cli.Seek != "" || !cli.SeekTimestamp.IsZero()
+}
+
+// seekOffsets Resets the committed offsets of the consumer group on every partition of the topics, before joining the group.
+// This is done once, so restarts of the client continue from the committed offsets instead of seeking again.
+// As Kafka rejects the commits from non-members while the group is active, the other members must be stopped first.
+func (cli *KafkaClient) seekOffsets(config *sarama.Config) error {
+	if cli.seeked || !cli.seekRequested() {
+		return nil
+	}
+	client, err := sarama.NewClient([]string{cli.Bootstrap}, config)
+	if err != nil {
+		return fmt.Errorf("cannot connect to %s: %v", cli.Bootstrap, err)
+	}
+	defer client.Close()
+	offsets, err := cli.resolveSeekOffsets(client)
+	if err != nil {
+		return err
+	}
+	manager, err := sarama.NewOffsetManagerFromClient(cli.GroupID, client)
+	if err != nil {
+		return fmt.Errorf("cannot create offset manager: %v", err)
+	}
+	for tp, offset := range offsets {
+		pom, err := manager.ManagePartition(tp.Topic, tp.Partition)
+		if err != nil {
+			manager.Close()
+			return fmt.Errorf("cannot manage partition %d of %s: %v", tp.Partition, tp.Topic, err)
+		}
+		pom.ResetOffset(offset, "")
+		cli.logger().Infof("moving group %s to offset %d on partition %d of %s", cli.GroupID, offset, tp.Partition, tp.Topic)
+	}
+	manager.Commit()
+	if err := manager.Close(); err != nil {
+		return fmt.Errorf("cannot reset the offsets of group %s: %v", cli.GroupID, err)
+	}
+	cli.seeked = true
+	return nil
+}
+
+// resolveSeekOffsets Returns the offset to resume from on each partition of the topics, based on the seek settings.
+// A timestamp resolves to the first record produced at or after it, through the offsets-for-times API, or the end of the partition
+// when there is none; explicit offsets are limited to the records available on each partition.
+func (cli *KafkaClient) resolveSeekOffsets(offsets offsetReader) (map[TopicPartition]int64, error) {
+	result := make(map[TopicPartition]int64)
+	for _, tc := range cli.Topics() {
+		partitions, err := offsets.Partitions(tc.Name)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get partitions of %s: %v", tc.Name, err)
+		}
+		for _, partition := range partitions {
+			oldest, err := offsets.GetOffset(tc.Name, partition, sarama.OffsetOldest)
+			if err != nil {
+				return nil, fmt.Errorf("cannot get start offset of partition %d of %s: %v", partition, tc.Name, err)
+			}
+			newest, err := offsets.GetOffset(tc.Name, partition, sarama.OffsetNewest)
+			if err != nil {
+				return nil, fmt.Errorf("cannot get end offset of partition %d of %s: %v", partition, tc.Name, err)
+			}
+			var offset int64
+			switch cli.Seek {
+			case SeekBeginning:
+				offset = oldest
+			case SeekEnd:
+				offset = newest
+			case "":
+				if offset, err = offsets.GetOffset(tc.Name, partition, cli.SeekTimestamp.UnixNano()/int64(time.Millisecond)); err != nil {
+					return nil, fmt.Errorf("cannot get offset at %s of partition %d of %s: %v", cli.SeekTimestamp.Format(time.RFC3339), partition, tc.Name, err)
+				}
+				if offset < 0 {
+					offset = newest
+				}
+			default:
+				offset, _ = strconv.ParseInt(cli.Seek, 10, 64)
+				if offset < oldest {
+					offset = oldest
+				} else if offset > newest {
+					offset = newest
+				}
+			}
+			result[TopicPartition{Topic: tc.Name, Partition: partition}] = offset
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,65 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"gotest.tools/v3/assert"
+)
+
+// fakeTimeOffsets simulates two partitions with the records 100 to 199, produced one per second starting at a given time.
+type fakeTimeOffsets struct {
+	start time.Time
+}
+
+func (f *fakeTimeOffsets) Partitions(topic string) ([]int32, error) {
+	return []int32{0, 1}, nil
+}
+
+func (f *fakeTimeOffsets) GetOffset(topic string, partition int32, ts int64) (int64, error) {
+	switch ts {
+	case sarama.OffsetOldest:
+		return 100, nil
+	case sarama.OffsetNewest:
+		return 200, nil
+	}
+	elapsed := time.Duration(ts)*time.Millisecond - time.Duration(f.start.UnixNano())
+	if elapsed >= 100*time.Second {
+		return -1, nil
+	}
+	return 100 + int64(elapsed/time.Second), nil
+}
+
+func TestSeekOffsets(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	offsets := &fakeTimeOffsets{start: start}
+	tp := TopicPartition{Topic: "Trap", Partition: 1}
+	for seek, expected := range map[string]int64{SeekBeginning: 100, SeekEnd: 200, "150": 150, "10": 100, "500": 200} {
+		cli := &KafkaClient{Topic: "Trap", Seek: seek}
+		result, err := cli.resolveSeekOffsets(offsets)
+		assert.NilError(t, err)
+		assert.Equal(t, 2, len(result))
+		assert.Equal(t, expected, result[tp], seek)
+	}
+
+	cli := &KafkaClient{Topic: "Trap", SeekTimestamp: start.Add(30 * time.Second)}
+	result, err := cli.resolveSeekOffsets(offsets)
+	assert.NilError(t, err)
+	assert.Equal(t, int64(130), result[tp])
+	cli.SeekTimestamp = start.Add(time.Hour) // No records afterwards
+	result, err = cli.resolveSeekOffsets(offsets)
+	assert.NilError(t, err)
+	assert.Equal(t, int64(200), result[tp])
+
+	assert.ErrorContains(t, (&KafkaClient{Seek: "first"}).validateSeek(), "invalid seek position first")
+	assert.ErrorContains(t, (&KafkaClient{Seek: SeekEnd, SeekTimestamp: start}).validateSeek(), "mutually exclusive")
+	assert.ErrorContains(t, (&KafkaClient{Seek: SeekBeginning, Source: &FileSource{}}).validateSeek(), "requires the Kafka consumer")
+	assert.NilError(t, (&KafkaClient{Seek: "42"}).validateSeek())
+
+	// The offsets are only reset once
+	cli.seeked = true
+	assert.NilError(t, cli.seekOffsets(nil))
+}
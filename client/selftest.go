@@ -0,0 +1,154 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/sink"
+	"google.golang.org/protobuf/proto"
+)
+
+// SelfTest defines a smoke test against a live cluster: it produces a synthetic multi-part Syslog message to a temporary topic,
+// consumes it back, verifies the reassembly and the decoding, and deletes the topic.
+type SelfTest struct {
+	Bootstrap  string     // The Kafka Server Bootstrap string.
+	Parameters Properties // Additional Kafka settings, i.e. security.protocol=SASL_SSL.
+	TLS        TLSConfig  // TLS settings to connect to Kafka (optional).
+	SASL       SASLConfig // SASL settings to authenticate against Kafka (optional).
+	Chunks     int        // The number of chunks of the synthetic message (defaults to 3).
+}
+
+// createConfig Builds the Sarama configuration for the test.
+func (st *SelfTest) createConfig() (*sarama.Config, error) {
+	config := sarama.NewConfig()
+	config.Version = sarama.V2_7_0_0
+	config.ClientID = "onms-kafka-ipc-receiver"
+	config.Producer.Return.Successes = true
+	if err := st.Parameters.apply(config); err != nil {
+		return nil, err
+	}
+	if err := st.TLS.apply(config); err != nil {
+		return nil, err
+	}
+	if err := st.SASL.apply(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Run Executes the test, returning an error when any step fails.
+// The temporary topic is deleted even when the test fails.
+func (st *SelfTest) Run() error {
+	if st.Chunks <= 1 {
+		st.Chunks = 3
+	}
+	config, err := st.createConfig()
+	if err != nil {
+		return err
+	}
+	id := watermill.NewUUID()
+	topic := "onms-ipc-selftest-" + id
+
+	admin, err := sarama.NewClusterAdmin([]string{st.Bootstrap}, config)
+	if err != nil {
+		return fmt.Errorf("cannot connect to %s: %v", st.Bootstrap, err)
+	}
+	defer admin.Close()
+	if err := admin.CreateTopic(topic, &sarama.TopicDetail{NumPartitions: 1, ReplicationFactor: -1}, false); err != nil {
+		return fmt.Errorf("cannot create topic %s: %v", topic, err)
+	}
+	defaultLogger.Infof("created topic %s", topic)
+	defer func() {
+		if err := admin.DeleteTopic(topic); err != nil {
+			defaultLogger.Warnf("cannot delete topic %s: %v", topic, err)
+		} else {
+			defaultLogger.Infof("deleted topic %s", topic)
+		}
+	}()
+
+	content := fmt.Sprintf("<14>%s selftest onms-kafka-ipc-receiver: self-test %s", time.Now().Format(time.Stamp), id)
+	data, err := xml.Marshal(&SyslogMessageLogDTO{
+		SystemID:      "selftest",
+		Location:      "selftest",
+		SourceAddress: "127.0.0.1",
+		Messages: []SyslogMessageDTO{{
+			Timestamp: time.Now().Format(time.RFC3339),
+			Content:   []byte(base64.StdEncoding.EncodeToString([]byte(content))),
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot build message: %v", err)
+	}
+	if err := st.produce(config, topic, id, data); err != nil {
+		return err
+	}
+	defaultLogger.Infof("produced message %s with %d chunks", id, st.Chunks)
+
+	cli := &KafkaClient{Bootstrap: st.Bootstrap, Topic: topic, IPC: "sink", Parser: "syslog"}
+	if err := cli.Prepare(); err != nil {
+		return err
+	}
+	var records int
+	var decoded []DecodedMessage
+	tr := TopicRange{Bootstrap: st.Bootstrap, Topic: topic, Parameters: st.Parameters, TLS: st.TLS, SASL: st.SASL}
+	err = ScanTopic(tr, func(rec *CaptureRecord) error {
+		records++
+		cli.DecodeRecord(rec, func(msg DecodedMessage) {
+			decoded = append(decoded, msg)
+		})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("cannot consume topic %s: %v", topic, err)
+	}
+	defaultLogger.Infof("consumed %d chunks", records)
+	if records != st.Chunks {
+		return fmt.Errorf("expected %d chunks, got %d", st.Chunks, records)
+	}
+	if len(decoded) != 1 {
+		return fmt.Errorf("expected a reassembled message, got %d", len(decoded))
+	}
+	if !strings.Contains(string(decoded[0].Payload), id) || decoded[0].Metadata.SystemID != "selftest" {
+		return fmt.Errorf("unexpected decoded message: %s", decoded[0].Payload)
+	}
+	defaultLogger.Infof("message %s reassembled and decoded", id)
+	return nil
+}
+
+// produce Splits the data into chunks, and sends them to the topic using the message ID as the key, like OpenNMS.
+func (st *SelfTest) produce(config *sarama.Config, topic, id string, data []byte) error {
+	producer, err := sarama.NewSyncProducer([]string{st.Bootstrap}, config)
+	if err != nil {
+		return fmt.Errorf("cannot create producer: %v", err)
+	}
+	defer producer.Close()
+	size := (len(data) + st.Chunks - 1) / st.Chunks
+	for chunk := 0; chunk < st.Chunks; chunk++ {
+		start := chunk * size
+		end := start + size
+		if end > len(data) {
+			end = len(data)
+		}
+		value, err := proto.Marshal(&sink.SinkMessage{
+			MessageId:          id,
+			CurrentChunkNumber: int32(chunk),
+			TotalChunks:        int32(st.Chunks),
+			Content:            data[start:end],
+		})
+		if err != nil {
+			return fmt.Errorf("cannot encode chunk %d: %v", chunk, err)
+		}
+		_, _, err = producer.SendMessage(&sarama.ProducerMessage{Topic: topic, Key: sarama.StringEncoder(id), Value: sarama.ByteEncoder(value)})
+		if err != nil {
+			return fmt.Errorf("cannot send chunk %d to %s: %v", chunk, topic, err)
+		}
+	}
+	return nil
+}
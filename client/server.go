@@ -0,0 +1,116 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// HTTPServer defines the settings of the embedded HTTP server used for metrics and the other endpoints.
+type HTTPServer struct {
+	Port        int    // The TCP port to listen on.
+	TLSCert     string // Path to the TLS certificate (PEM); enables HTTPS when defined.
+	TLSKey      string // Path to the TLS private key (PEM).
+	Username    string // Username for basic authentication (optional).
+	Password    string `json:"-"` // Password for basic authentication; accepts secret references (see ResolveSecret).
+	BearerToken string `json:"-"` // Static token for bearer authentication (optional); accepts secret references (see ResolveSecret).
+}
+
+// Validate Verifies the server settings.
+func (srv *HTTPServer) Validate() error {
+	if (srv.TLSCert == "") != (srv.TLSKey == "") {
+		return fmt.Errorf("both TLS certificate and key are required")
+	}
+	for _, path := range []string{srv.TLSCert, srv.TLSKey} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("cannot access %s: %v", path, err)
+		}
+	}
+	if srv.Username != "" && srv.Password == "" {
+		return fmt.Errorf("password is required for basic authentication")
+	}
+	for _, ref := range []string{srv.Password, srv.BearerToken} {
+		if _, err := ResolveSecret(ref); err != nil {
+			return fmt.Errorf("cannot resolve HTTP credentials: %v", err)
+		}
+	}
+	return nil
+}
+
+// authEnabled Returns true when either basic or bearer authentication is configured.
+func (srv *HTTPServer) authEnabled() bool {
+	return srv.Username != "" || srv.BearerToken != ""
+}
+
+// authorized Returns true when the request has valid credentials.
+func (srv *HTTPServer) authorized(r *http.Request) bool {
+	return srv.authorizedHeader(r.Header.Get("Authorization"))
+}
+
+// authorizedHeader Returns true when the value of an Authorization header has valid credentials, either bearer or basic.
+func (srv *HTTPServer) authorizedHeader(auth string) bool {
+	if srv.BearerToken != "" {
+		if strings.HasPrefix(auth, "Bearer ") {
+			expected, err := ResolveSecret(srv.BearerToken)
+			if err != nil {
+				defaultLogger.Errorf("cannot resolve bearer token: %v", err)
+				return false
+			}
+			token := strings.TrimPrefix(auth, "Bearer ")
+			return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+		}
+	}
+	if srv.Username != "" {
+		r := &http.Request{Header: http.Header{"Authorization": []string{auth}}}
+		if user, pass, ok := r.BasicAuth(); ok {
+			expected, err := ResolveSecret(srv.Password)
+			if err != nil {
+				defaultLogger.Errorf("cannot resolve password: %v", err)
+				return false
+			}
+			validUser := subtle.ConstantTimeCompare([]byte(user), []byte(srv.Username)) == 1
+			validPass := subtle.ConstantTimeCompare([]byte(pass), []byte(expected)) == 1
+			return validUser && validPass
+		}
+	}
+	return false
+}
+
+// Protect Wraps a handler so it requires authentication when configured.
+func (srv *HTTPServer) Protect(handler http.Handler) http.Handler {
+	if !srv.authEnabled() {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !srv.authorized(r) {
+			if srv.Username != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="onms-kafka-ipc-receiver"`)
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// ListenAndServe Starts the HTTP server, using TLS when configured.
+// It is a blocking operation.
+func (srv *HTTPServer) ListenAndServe(handler http.Handler) error {
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", srv.Port),
+		Handler: handler,
+	}
+	if srv.TLSCert != "" {
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		return server.ListenAndServeTLS(srv.TLSCert, srv.TLSKey)
+	}
+	return server.ListenAndServe()
+}
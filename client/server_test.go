@@ -0,0 +1,38 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestHTTPServerProtect(t *testing.T) {
+	srv := &HTTPServer{Username: "admin", Password: "secret", BearerToken: "token"}
+	assert.NilError(t, srv.Validate())
+	handler := srv.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	check := func(setup func(r *http.Request), expected int) {
+		r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		setup(r)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		assert.Equal(t, expected, rec.Code)
+	}
+	check(func(r *http.Request) {}, http.StatusUnauthorized)
+	check(func(r *http.Request) { r.SetBasicAuth("admin", "wrong") }, http.StatusUnauthorized)
+	check(func(r *http.Request) { r.SetBasicAuth("admin", "secret") }, http.StatusOK)
+	check(func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") }, http.StatusUnauthorized)
+	check(func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") }, http.StatusOK)
+}
+
+func TestHTTPServerValidate(t *testing.T) {
+	assert.ErrorContains(t, (&HTTPServer{TLSCert: "cert.pem"}).Validate(), "both")
+	assert.ErrorContains(t, (&HTTPServer{TLSCert: "/nonexistent.pem", TLSKey: "/nonexistent.key"}).Validate(), "cannot access")
+	assert.ErrorContains(t, (&HTTPServer{Username: "admin"}).Validate(), "password")
+}
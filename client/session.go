@@ -0,0 +1,297 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/rpc"
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/sink"
+	"google.golang.org/protobuf/proto"
+)
+
+// validSessionName restricts the session names, as they are used as file names.
+var validSessionName = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// CaptureRequest represents the settings of a capture session.
+type CaptureRequest struct {
+	Name        string   `json:"name"`                  // The name of the session, used as the file name.
+	Topic       string   `json:"topic,omitempty"`       // Only capture messages from this topic.
+	Parser      string   `json:"parser,omitempty"`      // Only capture messages handled by this parser.
+	Source      string   `json:"source,omitempty"`      // Only capture messages from this IP address or CIDR.
+	Location    string   `json:"location,omitempty"`    // Only capture messages from this Minion location.
+	Headers     []string `json:"headers,omitempty"`     // Only capture messages whose Kafka headers satisfy these rules, i.e. tenant=acme (see HeaderRules).
+	Duration    string   `json:"duration"`              // How long the session should run, i.e. 10m.
+	MaxMessages int      `json:"maxMessages,omitempty"` // Stop the session after capturing this number of messages.
+}
+
+// CaptureSession represents a bounded and filtered capture of messages written to a dedicated file.
+type CaptureSession struct {
+	CaptureRequest
+	Path     string    `json:"path"`
+	Started  time.Time `json:"started"`
+	Expires  time.Time `json:"expires"`
+	Messages int       `json:"messages"`
+	Active   bool      `json:"active"`
+
+	network *net.IPNet
+	headers HeaderRules
+	writer  *CaptureWriter
+	timer   *time.Timer
+}
+
+// matches Returns true when the decoded message satisfies the session filters.
+func (s *CaptureSession) matches(msg DecodedMessage) bool {
+	if s.Topic != "" && s.Topic != msg.Topic {
+		return false
+	}
+	if s.Parser != "" && !strings.EqualFold(s.Parser, msg.Parser) {
+		return false
+	}
+	if s.Location != "" && s.Location != msg.Metadata.Location {
+		return false
+	}
+	if s.network != nil {
+		ip := net.ParseIP(msg.Metadata.SourceAddress)
+		if ip == nil || !s.network.Contains(ip) {
+			return false
+		}
+	}
+	return s.headers.Matches(msg.Headers)
+}
+
+// CaptureManager handles capture sessions, which record the reassembled messages matching a filter,
+// like tcpdump for the Sink stream, without restarting or reconfiguring the pipelines.
+// Each session writes to a dedicated capture file that can be processed through the grep subcommand.
+// This is a concurrent safe object.
+type CaptureManager struct {
+	Directory   string        // Where to store the capture files.
+	MaxDuration time.Duration // The maximum duration of a session.
+
+	mutex    sync.RWMutex
+	sessions map[string]*CaptureSession
+}
+
+// NewCaptureManager creates a new capture manager.
+func NewCaptureManager(directory string, maxDuration time.Duration) *CaptureManager {
+	return &CaptureManager{
+		Directory:   directory,
+		MaxDuration: maxDuration,
+		sessions:    make(map[string]*CaptureSession),
+	}
+}
+
+// Start Creates a new capture session.
+func (m *CaptureManager) Start(req CaptureRequest) (*CaptureSession, error) {
+	if !validSessionName.MatchString(req.Name) {
+		return nil, fmt.Errorf("invalid session name %q", req.Name)
+	}
+	duration, err := time.ParseDuration(req.Duration)
+	if err != nil || duration <= 0 {
+		return nil, fmt.Errorf("invalid duration %q", req.Duration)
+	}
+	if m.MaxDuration > 0 && duration > m.MaxDuration {
+		return nil, fmt.Errorf("duration %s exceeds the maximum of %s", duration, m.MaxDuration)
+	}
+	session := &CaptureSession{
+		CaptureRequest: req,
+		Path:           filepath.Join(m.Directory, req.Name+".jsonl"),
+	}
+	if req.Source != "" {
+		if session.network, err = parseNetwork(req.Source); err != nil {
+			return nil, err
+		}
+	}
+	for _, rule := range req.Headers {
+		if err := session.headers.Set(rule); err != nil {
+			return nil, err
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if s, ok := m.sessions[req.Name]; ok && s.Active {
+		return nil, fmt.Errorf("session %s is already active", req.Name)
+	}
+	if _, err := os.Stat(session.Path); err == nil {
+		return nil, fmt.Errorf("capture file %s already exists", session.Path)
+	}
+	if session.writer, err = NewCaptureWriter(session.Path); err != nil {
+		return nil, err
+	}
+	session.Active = true
+	session.Started = time.Now()
+	session.Expires = session.Started.Add(duration)
+	session.timer = time.AfterFunc(duration, func() {
+		m.Stop(req.Name)
+	})
+	m.sessions[req.Name] = session
+	defaultLogger.Infof("capture session %s started, writing to %s until %s", req.Name, session.Path, session.Expires.Format(time.RFC3339))
+	return session, nil
+}
+
+// Stop Finishes an active capture session.
+func (m *CaptureManager) Stop(name string) (*CaptureSession, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	session, ok := m.sessions[name]
+	if !ok {
+		return nil, fmt.Errorf("session %s not found", name)
+	}
+	m.finish(session)
+	return session, nil
+}
+
+// finish Closes the capture file of a session.
+// Must be called while holding the lock.
+func (m *CaptureManager) finish(session *CaptureSession) {
+	if !session.Active {
+		return
+	}
+	session.Active = false
+	session.timer.Stop()
+	if err := session.writer.Close(); err != nil {
+		defaultLogger.Errorf("cannot close capture file %s: %v", session.Path, err)
+	}
+	defaultLogger.Infof("capture session %s finished with %d messages", session.Name, session.Messages)
+}
+
+// Sessions Returns the current and finished sessions sorted by name.
+func (m *CaptureManager) Sessions() []CaptureSession {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	sessions := make([]CaptureSession, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		sessions = append(sessions, *s)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Name < sessions[j].Name
+	})
+	return sessions
+}
+
+// Active Returns true when there is at least one active session.
+func (m *CaptureManager) Active() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, s := range m.sessions {
+		if s.Active {
+			return true
+		}
+	}
+	return false
+}
+
+// Record Writes a reassembled IPC message to all the active sessions where at least one of its decoded messages matches the filters.
+// The record is built lazily, only when needed.
+func (m *CaptureManager) Record(decoded []DecodedMessage, build func() *CaptureRecord) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var rec *CaptureRecord
+	for _, session := range m.sessions {
+		if !session.Active {
+			continue
+		}
+		matched := false
+		for _, msg := range decoded {
+			if session.matches(msg) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		if rec == nil {
+			rec = build()
+		}
+		if err := session.writer.Write(rec); err != nil {
+			defaultLogger.Errorf("cannot write to capture file %s: %v", session.Path, err)
+			continue
+		}
+		session.Messages++
+		if session.MaxMessages > 0 && session.Messages >= session.MaxMessages {
+			m.finish(session)
+		}
+	}
+}
+
+// Handler Returns an HTTP handler to manage the capture sessions.
+// GET lists the sessions, POST starts a new session from a JSON CaptureRequest, and DELETE stops the session passed through the name query parameter.
+func (m *CaptureManager) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result interface{}
+		var err error
+		status := http.StatusOK
+		switch r.Method {
+		case http.MethodGet:
+			result = m.Sessions()
+		case http.MethodPost:
+			req := CaptureRequest{}
+			if err = json.NewDecoder(r.Body).Decode(&req); err == nil {
+				result, err = m.Start(req)
+				status = http.StatusCreated
+			}
+		case http.MethodDelete:
+			result, err = m.Stop(r.URL.Query().Get("name"))
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(result)
+	})
+}
+
+// parseNetwork Parses an IP address or a CIDR.
+func parseNetwork(value string) (*net.IPNet, error) {
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %s", value)
+		}
+		bits := 32
+		if ip.To4() == nil {
+			bits = 128
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR %s: %v", value, err)
+	}
+	return network, nil
+}
+
+// captureRecord Builds a capture record with a reassembled IPC message as a single chunk, using its original ID and the coordinates of its last chunk.
+func (cli *KafkaClient) captureRecord(last DecodedMessage, id string, data []byte) *CaptureRecord {
+	var value []byte
+	if cli.IPC == "rpc" {
+		value, _ = proto.Marshal(&rpc.RpcMessageProto{RpcId: id, RpcContent: data, TotalChunks: 1})
+	} else {
+		value, _ = proto.Marshal(&sink.SinkMessage{MessageId: id, Content: data, TotalChunks: 1})
+	}
+	return &CaptureRecord{
+		Topic:     last.Topic,
+		Partition: last.Partition,
+		Offset:    last.Offset,
+		Timestamp: last.Timestamp,
+		Key:       last.Key,
+		Value:     value,
+	}
+}
@@ -0,0 +1,92 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/sink"
+	"google.golang.org/protobuf/proto"
+	"gotest.tools/v3/assert"
+)
+
+func TestCaptureSession(t *testing.T) {
+	manager := NewCaptureManager(t.TempDir(), 0)
+	handler := manager.Handler()
+	rec := httptest.NewRecorder()
+	body := `{"name":"traps","parser":"snmp","source":"10.0.0.0/8","duration":"10m","maxMessages":2}`
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/capture", strings.NewReader(body)))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Assert(t, manager.Active())
+
+	cli := &KafkaClient{IPC: "sink"}
+	record := func(source string) {
+		msg := DecodedMessage{Topic: "OpenNMS.Sink.Trap", Parser: "snmp", Metadata: Metadata{SourceAddress: source}}
+		manager.Record([]DecodedMessage{msg}, func() *CaptureRecord {
+			return cli.captureRecord(msg, "0001", []byte("ABC"))
+		})
+	}
+	record("192.168.0.1") // Ignored
+	record("10.0.0.1")
+	record("10.1.1.1") // Reaches the maximum
+
+	_, err := manager.Start(CaptureRequest{Name: "traps", Duration: "1m"})
+	assert.ErrorContains(t, err, "already exists")
+	sessions := manager.Sessions()
+	assert.Equal(t, 1, len(sessions))
+	assert.Equal(t, 2, sessions[0].Messages)
+	assert.Assert(t, !sessions[0].Active)
+
+	decoder := &KafkaClient{Topic: "OpenNMS.Sink.Trap", IPC: "sink", Parser: "heartbeat"}
+	decoder.createVariables()
+	decoder.createCounters()
+	count := 0
+	err = ReadCaptureFile(sessions[0].Path, func(rec *CaptureRecord) error {
+		decoder.DecodeRecord(rec, func(msg DecodedMessage) {
+			assert.Equal(t, "ABC", string(msg.Payload))
+			count++
+		})
+		return nil
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestCaptureSessionMessageID(t *testing.T) {
+	manager := NewCaptureManager(t.TempDir(), 0)
+	_, err := manager.Start(CaptureRequest{Name: "heartbeats", Duration: "1m", MaxMessages: 1})
+	assert.NilError(t, err)
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	cli.Parser = "heartbeat"
+	cli.Captures = manager
+	msg := buildMessage("msg1", 0, 1, []byte("ABC"))
+	cli.handleMessage(msg, func(msg DecodedMessage) error { return nil })
+	<-msg.Acked()
+
+	// The reassembled message is captured with its original ID
+	sessions := manager.Sessions()
+	assert.Equal(t, 1, sessions[0].Messages)
+	var ids []string
+	err = ReadCaptureFile(sessions[0].Path, func(rec *CaptureRecord) error {
+		sinkMsg := &sink.SinkMessage{}
+		assert.NilError(t, proto.Unmarshal(rec.Value, sinkMsg))
+		ids = append(ids, sinkMsg.MessageId)
+		return nil
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"msg1"}, ids)
+}
+
+func TestCaptureRequestValidation(t *testing.T) {
+	manager := NewCaptureManager(t.TempDir(), 0)
+	_, err := manager.Start(CaptureRequest{Name: "../etc/passwd", Duration: "1m"})
+	assert.ErrorContains(t, err, "invalid session name")
+	_, err = manager.Start(CaptureRequest{Name: "test", Duration: "forever"})
+	assert.ErrorContains(t, err, "invalid duration")
+	_, err = manager.Start(CaptureRequest{Name: "test", Duration: "1m", Source: "10.0.0.0/33"})
+	assert.ErrorContains(t, err, "invalid CIDR")
+}
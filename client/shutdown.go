@@ -0,0 +1,136 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// savedPartialMessage represents a partial message persisted on the partial buffer file.
+type savedPartialMessage struct {
+	ID        string    `json:"id"`
+	Topic     string    `json:"topic"`
+	Partition int32     `json:"partition"`
+	Offset    int64     `json:"offset"`
+	Chunk     int32     `json:"chunk"`
+	Total     int32     `json:"total"`
+	ChunkSize int       `json:"chunkSize"`
+	FirstSeen time.Time `json:"firstSeen"`
+	Invalid   string    `json:"invalid,omitempty"`
+	Content   []byte    `json:"content"`
+}
+
+// drain Stops reading new messages, and waits for the in-flight messages to be processed, up to the shutdown timeout.
+// Returns false when the timeout expired first.
+func (cli *KafkaClient) drain() bool {
+	if cli.mutex == nil {
+		return true
+	}
+	cli.mutex.Lock()
+	draining, drained := cli.draining, cli.drained
+	cli.draining = nil
+	cli.mutex.Unlock()
+	if draining == nil {
+		return true
+	}
+	close(draining)
+	if drained == nil || cli.ShutdownTimeout <= 0 {
+		return true
+	}
+	select {
+	case <-drained:
+		return true
+	case <-time.After(cli.ShutdownTimeout):
+		return false
+	}
+}
+
+// savePartialMessages Writes the partial messages of the reassembly buffer to the partial buffer file.
+// This is a concurrent safe method.
+func (cli *KafkaClient) savePartialMessages() error {
+	cli.mutex.RLock()
+	saved := make([]savedPartialMessage, 0, len(cli.msgBuffer))
+	for id, partial := range cli.msgBuffer {
+		content, err := cli.partialContent(id, partial)
+		if err != nil {
+			cli.logger().Errorf("cannot retrieve message %s from the chunk store: %v", id, err)
+			continue
+		}
+		saved = append(saved, savedPartialMessage{
+			ID:        id,
+			Topic:     partial.topic,
+			Partition: partial.partition,
+			Offset:    partial.offset,
+			Chunk:     partial.chunk,
+			Total:     partial.total,
+			ChunkSize: partial.chunkSize,
+			FirstSeen: partial.firstSeen,
+			Invalid:   partial.invalid,
+			Content:   content,
+		})
+	}
+	cli.mutex.RUnlock()
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return fmt.Errorf("cannot encode partial messages: %v", err)
+	}
+	tmp := cli.PartialBufferFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("cannot write partial buffer file: %v", err)
+	}
+	if err := os.Rename(tmp, cli.PartialBufferFile); err != nil {
+		return fmt.Errorf("cannot write partial buffer file: %v", err)
+	}
+	cli.logger().Infof("saved %d partial messages to %s", len(saved), cli.PartialBufferFile)
+	return nil
+}
+
+// restorePartialMessages Loads the partial messages saved on the partial buffer file into the reassembly buffer.
+// The file is removed afterwards, so the messages are not restored again if the client crashes before saving them.
+func (cli *KafkaClient) restorePartialMessages() error {
+	if cli.PartialBufferFile == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(cli.PartialBufferFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read partial buffer file: %v", err)
+	}
+	saved := []savedPartialMessage{}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("invalid partial buffer file %s: %v", cli.PartialBufferFile, err)
+	}
+	now := time.Now()
+	cli.mutex.Lock()
+	for _, s := range saved {
+		partial := &partialMessage{
+			chunk:     s.Chunk,
+			total:     s.Total,
+			firstSeen: s.FirstSeen,
+			lastSeen:  now, // The stall timeout restarts, as no chunks were consumed meanwhile
+			topic:     s.Topic,
+			partition: s.Partition,
+			offset:    s.Offset,
+			chunkSize: s.ChunkSize,
+			invalid:   s.Invalid,
+		}
+		if err := cli.appendChunk(s.ID, partial, s.Content); err != nil {
+			cli.logger().Errorf("cannot restore message %s: %v", s.ID, err)
+			continue
+		}
+		cli.msgBuffer[s.ID] = partial
+		cli.budget.Add(partial.size)
+	}
+	cli.mutex.Unlock()
+	if err := os.Remove(cli.PartialBufferFile); err != nil {
+		return fmt.Errorf("cannot remove partial buffer file: %v", err)
+	}
+	cli.logger().Infof("restored %d partial messages from %s", len(saved), cli.PartialBufferFile)
+	return nil
+}
@@ -0,0 +1,66 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"gotest.tools/v3/assert"
+)
+
+func TestGracefulShutdown(t *testing.T) {
+	pubSub := gochannel.NewGoChannel(gochannel.Config{}, watermill.NewStdLogger(false, false))
+	defer pubSub.Close()
+	path := filepath.Join(t.TempDir(), "partial.json")
+	cli := &KafkaClient{Topic: "Shutdown.Sink.Heartbeat", GroupID: "shutdown-test", Parser: "heartbeat", Source: pubSub, ShutdownTimeout: 5 * time.Second, PartialBufferFile: path}
+	assert.NilError(t, cli.Initialize(context.Background()))
+	var started, finished int32
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cli.Handle(func(msg DecodedMessage) error {
+			atomic.StoreInt32(&started, 1)
+			time.Sleep(200 * time.Millisecond)
+			atomic.StoreInt32(&finished, 1)
+			return nil
+		})
+	}()
+	pubSub.Publish("Shutdown.Sink.Heartbeat", buildMessage("0001", 0, 2, []byte("Minion")))
+	waitFor(t, func() bool { return cli.pendingMessages() == 1 })
+	pubSub.Publish("Shutdown.Sink.Heartbeat", buildMessage("0002", 0, 1, []byte("Minion-1")))
+	waitFor(t, func() bool { return atomic.LoadInt32(&started) == 1 })
+
+	// The in-flight message is processed before stopping, and the partial message is saved
+	cli.Stop()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&finished))
+	<-done
+	_, err := os.Stat(path)
+	assert.NilError(t, err)
+
+	// The partial message is restored, so it can be completed; a new source avoids publishing while the previous subscriber is removed
+	pubSub = gochannel.NewGoChannel(gochannel.Config{}, watermill.NewStdLogger(false, false))
+	defer pubSub.Close()
+	cli.Source = pubSub
+	assert.NilError(t, cli.Initialize(context.Background()))
+	assert.Equal(t, 1, cli.pendingMessages())
+	_, err = os.Stat(path)
+	assert.Assert(t, os.IsNotExist(err))
+	payloads := make(chan string, 1)
+	go cli.Handle(func(msg DecodedMessage) error {
+		payloads <- string(msg.Payload)
+		return nil
+	})
+	pubSub.Publish("Shutdown.Sink.Heartbeat", buildMessage("0001", 1, 2, []byte("-2")))
+	waitFor(t, func() bool { return cli.pendingMessages() == 0 })
+	cli.Stop()
+	assert.Equal(t, "Minion-2", <-payloads)
+
+	assert.ErrorContains(t, (&KafkaClient{PartialBufferFile: path, ReassemblyCheckpoint: path}).Validate(), "mutually exclusive")
+}
@@ -0,0 +1,211 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// LatencySLO defines an end-to-end latency objective, i.e. 95% of the messages processed within 5 seconds of their creation.
+// It can be used as a CLI flag with the format objective:threshold, for instance 0.95:5s or 95%:5s.
+type LatencySLO struct {
+	Objective      float64       // The target ratio of messages processed within the threshold (0 to disable).
+	Threshold      time.Duration // The maximum expected latency.
+	ReportInterval time.Duration // How often to log the SLO report (defaults to 1 minute).
+}
+
+// String gets the SLO as string
+func (slo *LatencySLO) String() string {
+	if slo.Objective == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%g:%s", slo.Objective, slo.Threshold)
+}
+
+// Set parses the SLO from a string with the format objective:threshold
+func (slo *LatencySLO) Set(value string) error {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid SLO %s; expecting objective:threshold", value)
+	}
+	objective, err := strconv.ParseFloat(strings.TrimSuffix(parts[0], "%"), 64)
+	if err != nil {
+		return fmt.Errorf("invalid SLO objective %s: %v", parts[0], err)
+	}
+	if strings.HasSuffix(parts[0], "%") {
+		objective = objective / 100
+	}
+	if objective <= 0 || objective >= 1 {
+		return fmt.Errorf("invalid SLO objective %s; expecting a value between 0 and 1", parts[0])
+	}
+	threshold, err := time.ParseDuration(parts[1])
+	if err != nil {
+		return fmt.Errorf("invalid SLO threshold %s: %v", parts[1], err)
+	}
+	slo.Objective = objective
+	slo.Threshold = threshold
+	return nil
+}
+
+// Enabled returns true when the SLO is defined.
+func (slo *LatencySLO) Enabled() bool {
+	return slo.Objective > 0 && slo.Threshold > 0
+}
+
+// rollingBucket counts the messages processed within a slot of a rolling window.
+type rollingBucket struct {
+	slot  int64
+	good  int64
+	total int64
+}
+
+// sloTracker tracks the compliance of a latency SLO over rolling windows.
+// This is a concurrent safe object.
+type sloTracker struct {
+	slo     LatencySLO
+	mutex   sync.Mutex
+	buckets [60]rollingBucket // One bucket per minute for the last hour.
+
+	good prometheus.Counter
+	bad  prometheus.Counter
+}
+
+// sloWindows are the rolling windows used to compute the burn rates.
+var sloWindows = []time.Duration{5 * time.Minute, time.Hour}
+
+// newSLOTracker creates a tracker for a given SLO, registering the metrics with the given labels.
+func newSLOTracker(slo LatencySLO, labels prometheus.Labels) *sloTracker {
+	t := &sloTracker{slo: slo}
+	t.good = promauto.NewCounter(prometheus.CounterOpts{
+		Name:        "onms_ipc_slo_good_messages_total",
+		Help:        "The total number of messages processed within the latency SLO threshold",
+		ConstLabels: labels,
+	})
+	t.bad = promauto.NewCounter(prometheus.CounterOpts{
+		Name:        "onms_ipc_slo_bad_messages_total",
+		Help:        "The total number of messages processed after the latency SLO threshold",
+		ConstLabels: labels,
+	})
+	promauto.NewGauge(prometheus.GaugeOpts{
+		Name:        "onms_ipc_slo_objective",
+		Help:        "The target ratio of messages processed within the latency SLO threshold",
+		ConstLabels: labels,
+	}).Set(slo.Objective)
+	for _, window := range sloWindows {
+		window := window
+		windowLabels := prometheus.Labels{"window": shortDuration(window)}
+		for k, v := range labels {
+			windowLabels[k] = v
+		}
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "onms_ipc_slo_burn_rate",
+			Help:        "The rate at which the latency SLO error budget is consumed (1 means exactly on budget)",
+			ConstLabels: windowLabels,
+		}, func() float64 {
+			return t.burnRate(window, time.Now())
+		})
+	}
+	return t
+}
+
+// record Tracks the latency of a processed message.
+func (t *sloTracker) record(latency time.Duration, now time.Time) {
+	good := latency <= t.slo.Threshold
+	if good {
+		t.good.Inc()
+	} else {
+		t.bad.Inc()
+	}
+	minute := now.Unix() / 60
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	bucket := &t.buckets[minute%int64(len(t.buckets))]
+	if bucket.slot != minute {
+		*bucket = rollingBucket{slot: minute}
+	}
+	bucket.total++
+	if good {
+		bucket.good++
+	}
+}
+
+// compliance Returns the ratio of good messages and the total number of messages within a rolling window.
+func (t *sloTracker) compliance(window time.Duration, now time.Time) (float64, int64) {
+	current := now.Unix() / 60
+	oldest := current - int64(window/time.Minute) + 1
+	var good, total int64
+	t.mutex.Lock()
+	for _, bucket := range t.buckets {
+		if bucket.slot >= oldest && bucket.slot <= current {
+			good += bucket.good
+			total += bucket.total
+		}
+	}
+	t.mutex.Unlock()
+	if total == 0 {
+		return 1, 0
+	}
+	return float64(good) / float64(total), total
+}
+
+// burnRate Returns the ratio between the observed error rate and the error budget within a rolling window.
+func (t *sloTracker) burnRate(window time.Duration, now time.Time) float64 {
+	ratio, _ := t.compliance(window, now)
+	return (1 - ratio) / (1 - t.slo.Objective)
+}
+
+// report Logs the compliance and burn rates of the SLO.
+func (t *sloTracker) report(topic string, now time.Time) {
+	ratio, total := t.compliance(time.Hour, now)
+	rates := make([]string, len(sloWindows))
+	for i, window := range sloWindows {
+		rates[i] = fmt.Sprintf("%s=%.2f", shortDuration(window), t.burnRate(window, now))
+	}
+	status := "met"
+	if ratio < t.slo.Objective {
+		status = "violated"
+	}
+	defaultLogger.Infof("SLO report for %s: %.2f%% of %d messages within %s during the last hour (objective %.2f%%, %s), burn rate %s",
+		topic, ratio*100, total, t.slo.Threshold, t.slo.Objective*100, status, strings.Join(rates, " "))
+}
+
+// runSLOReport Logs the SLO report periodically, until the done channel is closed.
+// It does nothing when the SLO is not enabled.
+func (cli *KafkaClient) runSLOReport(done <-chan struct{}) {
+	if cli.slo == nil {
+		return
+	}
+	interval := cli.LatencySLO.ReportInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			cli.slo.report(cli.Topic, now)
+		case <-done:
+			return
+		}
+	}
+}
+
+// shortDuration formats a duration without the zero units, i.e. 5m instead of 5m0s.
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
@@ -0,0 +1,43 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gotest.tools/v3/assert"
+)
+
+func TestLatencySLOFlag(t *testing.T) {
+	slo := &LatencySLO{}
+	assert.NilError(t, slo.Set("95%:5s"))
+	assert.Equal(t, 0.95, slo.Objective)
+	assert.Equal(t, 5*time.Second, slo.Threshold)
+	assert.NilError(t, slo.Set("0.99:500ms"))
+	assert.Equal(t, 0.99, slo.Objective)
+	assert.ErrorContains(t, slo.Set("95"), "expecting")
+	assert.ErrorContains(t, slo.Set("150%:5s"), "between")
+	assert.ErrorContains(t, slo.Set("95%:five"), "threshold")
+}
+
+func TestSLOBurnRate(t *testing.T) {
+	tracker := newSLOTracker(LatencySLO{Objective: 0.9, Threshold: time.Second}, prometheus.Labels{"topic": "slo-test", "group": "slo-test"})
+	now := time.Now()
+	for i := 0; i < 80; i++ {
+		tracker.record(100*time.Millisecond, now)
+	}
+	for i := 0; i < 20; i++ {
+		tracker.record(2*time.Second, now)
+	}
+	ratio, total := tracker.compliance(5*time.Minute, now)
+	assert.Equal(t, int64(100), total)
+	assert.Equal(t, 0.8, ratio)
+	assert.Assert(t, tracker.burnRate(5*time.Minute, now) > 1.99 && tracker.burnRate(5*time.Minute, now) < 2.01)
+
+	// Old buckets must be ignored by the shorter windows
+	later := now.Add(10 * time.Minute)
+	assert.Equal(t, 0.0, tracker.burnRate(5*time.Minute, later))
+	assert.Assert(t, tracker.burnRate(time.Hour, later) > 1.99)
+}
@@ -7,9 +7,10 @@ import (
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
-	"log"
 	"math/big"
-	"strings"
+	"net"
+	"unicode"
+	"unicode/utf8"
 )
 
 // SNMPValueDTO represents an SNMP value
@@ -19,9 +20,46 @@ type SNMPValueDTO struct {
 	Value   string   `xml:",chardata" json:"content"`
 }
 
-func (dto SNMPValueDTO) isASCII(s string) bool {
+// SNMP value types, as defined by OpenNMS
+const (
+	snmpInteger        = 2
+	snmpOctetString    = 4
+	snmpNull           = 5
+	snmpObjectID       = 6
+	snmpIPAddress      = 64
+	snmpCounter32      = 65
+	snmpGauge32        = 66
+	snmpTimeTicks      = 67
+	snmpOpaque         = 68
+	snmpCounter64      = 70
+	snmpNoSuchObject   = 128
+	snmpNoSuchInstance = 129
+	snmpEndOfMibView   = 130
+)
+
+// snmpSyntax contains the names of the SNMP value types.
+var snmpSyntax = map[int]string{
+	snmpInteger:        "Integer32",
+	snmpOctetString:    "OctetString",
+	snmpNull:           "Null",
+	snmpObjectID:       "ObjectIdentifier",
+	snmpIPAddress:      "IpAddress",
+	snmpCounter32:      "Counter32",
+	snmpGauge32:        "Gauge32",
+	snmpTimeTicks:      "TimeTicks",
+	snmpOpaque:         "Opaque",
+	snmpCounter64:      "Counter64",
+	snmpNoSuchObject:   "noSuchObject",
+	snmpNoSuchInstance: "noSuchInstance",
+	snmpEndOfMibView:   "endOfMibView",
+}
+
+func (dto SNMPValueDTO) isPrintable(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
 	for _, c := range s {
-		if c > 127 {
+		if !unicode.IsPrint(c) && !unicode.IsSpace(c) {
 			return false
 		}
 	}
@@ -32,25 +70,40 @@ func (dto SNMPValueDTO) isASCII(s string) bool {
 func (dto SNMPValueDTO) MarshalJSON() ([]byte, error) {
 	data, err := base64.StdEncoding.DecodeString(string(dto.Value))
 	var content string = string(dto.Value)
-	if dto.Type == 4 || dto.Type == 6 { // OCTETSTRING(4), OID(6)
+	switch dto.Type {
+	case snmpOctetString, snmpObjectID:
 		if err == nil {
 			content = string(data)
-			if !dto.isASCII(content) { // TODO parse hex-content
-				content = fmt.Sprintf("0x%x", string(data))
+			if !dto.isPrintable(content) {
+				content = fmt.Sprintf("0x%x", data)
 			}
 		} else {
-			log.Printf("[error] cannot decode base64 value: %v", err)
+			defaultLogger.Errorf("cannot decode base64 value: %v", err)
+		}
+	case snmpIPAddress:
+		if len(data) == net.IPv4len || len(data) == net.IPv6len {
+			content = net.IP(data).String()
+		} else {
+			content = fmt.Sprintf("0x%x", data)
 		}
-	} else if dto.Type == 64 { // IPADDRESS
-		elements := make([]string, len(data))
-		for i, n := range data {
-			elements[i] = new(big.Int).SetBytes([]byte{n}).String()
+	case snmpOpaque:
+		content = fmt.Sprintf("0x%x", data)
+	case snmpNull, snmpNoSuchObject, snmpNoSuchInstance, snmpEndOfMibView:
+		content = ""
+	case snmpInteger:
+		value := new(big.Int).SetBytes(data)
+		if len(data) > 0 && data[0]&0x80 != 0 { // Two's complement
+			value.Sub(value, new(big.Int).Lsh(big.NewInt(1), uint(len(data)*8)))
 		}
-		content = strings.Join(elements, ".")
-	} else { // Assume numeric value
+		content = value.String()
+	default: // Assume unsigned numeric value
 		content = new(big.Int).SetBytes(data).String()
 	}
-	return []byte(fmt.Sprintf(`{"type": %d, "value": "%s"}`, dto.Type, content)), nil
+	return json.Marshal(struct {
+		Type   int    `json:"type"`
+		Syntax string `json:"syntax,omitempty"`
+		Value  string `json:"value"`
+	}{dto.Type, snmpSyntax[dto.Type], content})
 }
 
 // SNMPResultDTO represents an SNMP result
@@ -96,9 +149,9 @@ type TrapLogDTO struct {
 }
 
 func (dto TrapLogDTO) String() string {
-	bytes, err := json.MarshalIndent(dto, "", "  ")
-	if err != nil {
-		log.Printf("[error] cannot generate JSON for SNMP trap: %v", err)
+	var s string
+	if err := encodeIndent(dto, func(data []byte) { s = string(data) }); err != nil {
+		defaultLogger.Errorf("cannot generate JSON for SNMP trap: %v", err)
 	}
-	return string(bytes)
+	return s
 }
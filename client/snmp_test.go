@@ -3,6 +3,8 @@
 package client
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"strings"
@@ -82,3 +84,24 @@ func TestSnmpV2(t *testing.T) {
 
 	fmt.Println(text)
 }
+
+func TestSnmpValues(t *testing.T) {
+	encode := func(data ...byte) string { return base64.StdEncoding.EncodeToString(data) }
+	tests := []struct {
+		value    SNMPValueDTO
+		expected string
+	}{
+		{SNMPValueDTO{Type: 2, Value: encode(0xff, 0xfe)}, `{"type":2,"syntax":"Integer32","value":"-2"}`},
+		{SNMPValueDTO{Type: 2, Value: encode(0x00, 0xff)}, `{"type":2,"syntax":"Integer32","value":"255"}`},
+		{SNMPValueDTO{Type: 65, Value: encode(0xff, 0xfe)}, `{"type":65,"syntax":"Counter32","value":"65534"}`},
+		{SNMPValueDTO{Type: 4, Value: encode([]byte(`say "hello"`)...)}, `{"type":4,"syntax":"OctetString","value":"say \"hello\""}`},
+		{SNMPValueDTO{Type: 4, Value: encode(0x00, 0x1b, 0x21, 0x3c, 0x9a, 0x10)}, `{"type":4,"syntax":"OctetString","value":"0x001b213c9a10"}`},
+		{SNMPValueDTO{Type: 64, Value: encode(10, 0, 0, 1)}, `{"type":64,"syntax":"IpAddress","value":"10.0.0.1"}`},
+		{SNMPValueDTO{Type: 129, Value: ""}, `{"type":129,"syntax":"noSuchInstance","value":""}`},
+	}
+	for _, test := range tests {
+		data, err := json.Marshal(test.value)
+		assert.NilError(t, err)
+		assert.Equal(t, test.expected, string(data))
+	}
+}
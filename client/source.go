@@ -0,0 +1,110 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/ThreeDotsLabs/watermill-kafka/v2/pkg/kafka"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// Source is a transport that delivers the IPC messages, replacing the Kafka consumer.
+// The payload of each message must be a serialized SinkMessage or RpcMessageProto, like the Kafka records,
+// so the chunks go through the same reassembly and decoding pipeline. Each message must be acknowledged before
+// the next one from the same stream is delivered, to preserve the order.
+// The channel returned by Subscribe must be closed when the context is cancelled.
+// The sources can attach the coordinates of each message through WithRecordMetadata.
+type Source interface {
+	Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error)
+	Close() error
+}
+
+// BoundedSource is a Source with a finite number of messages, like FileSource, which closes the channel of a topic
+// once all its messages were delivered. The pipelines stop once their topics are exhausted, instead of restarting.
+type BoundedSource interface {
+	Source
+	Exhausted(topic string) bool
+}
+
+// RecordMetadata contains the coordinates of a message within its source.
+type RecordMetadata struct {
+	Partition int32     // The partition of the message, or -1 when unknown.
+	Offset    int64     // The offset of the message within the partition, or -1 when unknown.
+	Timestamp time.Time // When the message was produced; zero when unknown.
+	Key       []byte    // The key of the message; nil when unknown.
+}
+
+// recordKeyMetadata is the metadata entry with the key of the Kafka records, which is not exposed as a header.
+const recordKeyMetadata = "_onms_record_key"
+
+// recordUnmarshaler converts the Kafka records into watermill messages, keeping the key of each record,
+// as the subscriber only attaches the coordinates to the context of the messages.
+type recordUnmarshaler struct {
+	kafka.DefaultMarshaler
+}
+
+// Unmarshal Converts a Kafka record into a watermill message.
+func (u recordUnmarshaler) Unmarshal(rec *sarama.ConsumerMessage) (*message.Message, error) {
+	msg, err := u.DefaultMarshaler.Unmarshal(rec)
+	if err == nil && rec.Key != nil {
+		msg.Metadata.Set(recordKeyMetadata, string(rec.Key))
+	}
+	return msg, err
+}
+
+// recordContextKey is used to attach the coordinates of a message to its context.
+type recordContextKey struct{}
+
+// WithRecordMetadata Returns a context with the coordinates of a message, to be attached by the sources.
+func WithRecordMetadata(ctx context.Context, md RecordMetadata) context.Context {
+	return context.WithValue(ctx, recordContextKey{}, md)
+}
+
+// recordMetadata Returns the coordinates of a message, either from the Kafka consumer or from the source that delivered it.
+func recordMetadata(msg *message.Message) RecordMetadata {
+	ctx := msg.Context()
+	if md, ok := ctx.Value(recordContextKey{}).(RecordMetadata); ok {
+		return md
+	}
+	md := RecordMetadata{Partition: -1, Offset: -1}
+	if partition, ok := kafka.MessagePartitionFromCtx(ctx); ok {
+		md.Partition = partition
+	}
+	if offset, ok := kafka.MessagePartitionOffsetFromCtx(ctx); ok {
+		md.Offset = offset
+	}
+	if ts, ok := kafka.MessageTimestampFromCtx(ctx); ok {
+		md.Timestamp = ts
+	}
+	if key, ok := msg.Metadata[recordKeyMetadata]; ok {
+		md.Key = []byte(key)
+	}
+	return md
+}
+
+// sourceExhausted Returns true when the messages of all the topics were delivered by a bounded source.
+func sourceExhausted(src Source, topics []TopicConfig) bool {
+	bounded, ok := src.(BoundedSource)
+	if !ok {
+		return false
+	}
+	for _, tc := range topics {
+		if !bounded.Exhausted(tc.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+// sinkModule Returns the module of the Sink API that produces the messages of a topic, i.e. Trap for OpenNMS.Sink.Trap.
+// Returns the topic as is when it doesn't follow the naming convention of OpenNMS.
+func sinkModule(topic string) string {
+	if idx := strings.Index(topic, ".Sink."); idx >= 0 {
+		return topic[idx+len(".Sink."):]
+	}
+	return topic
+}
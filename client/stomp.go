@@ -0,0 +1,173 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stompMaxFrameSize is the maximum size of the body of a STOMP frame.
+const stompMaxFrameSize = 64 * 1024 * 1024
+
+// stompEscaper and stompUnescaper handle the escaping of the header values, as defined by STOMP 1.2.
+var (
+	stompEscaper   = strings.NewReplacer("\\", "\\\\", "\r", "\\r", "\n", "\\n", ":", "\\c")
+	stompUnescaper = strings.NewReplacer("\\\\", "\\", "\\r", "\r", "\\n", "\n", "\\c", ":")
+)
+
+// stompFrame represents a STOMP frame.
+type stompFrame struct {
+	command string
+	headers map[string]string
+	body    []byte
+}
+
+// stompConn is a minimal STOMP 1.2 client, with the features required to consume messages from a broker like ActiveMQ.
+// It is not a concurrent safe object.
+type stompConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+// dialStomp Connects and authenticates against a STOMP broker.
+func dialStomp(address, login, passcode string, tlsConfig *tls.Config, timeout time.Duration) (*stompConn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	var err error
+	if tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to %s: %v", address, err)
+	}
+	sc := &stompConn{conn: conn, reader: bufio.NewReader(conn), writer: bufio.NewWriter(conn)}
+	host, _, _ := net.SplitHostPort(address)
+	headers := map[string]string{"accept-version": "1.2", "host": host, "heart-beat": "0,0"}
+	if login != "" {
+		headers["login"] = login
+		headers["passcode"] = passcode
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err := sc.send("CONNECT", headers); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	frame, err := sc.read()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	if frame.command != "CONNECTED" {
+		conn.Close()
+		return nil, stompError(frame)
+	}
+	return sc, nil
+}
+
+// send Writes a frame without body.
+func (sc *stompConn) send(command string, headers map[string]string) error {
+	sc.writer.WriteString(command)
+	sc.writer.WriteByte('\n')
+	for k, v := range headers {
+		if command != "CONNECT" { // The headers of the CONNECT frame are not escaped
+			k, v = stompEscaper.Replace(k), stompEscaper.Replace(v)
+		}
+		sc.writer.WriteString(k + ":" + v + "\n")
+	}
+	sc.writer.WriteString("\n\x00")
+	if err := sc.writer.Flush(); err != nil {
+		return fmt.Errorf("cannot send %s frame: %v", command, err)
+	}
+	return nil
+}
+
+// read Reads the next frame, skipping the heart-beats.
+func (sc *stompConn) read() (*stompFrame, error) {
+	var command string
+	for command == "" {
+		line, err := sc.readLine()
+		if err != nil {
+			return nil, err
+		}
+		command = line
+	}
+	frame := &stompFrame{command: command, headers: make(map[string]string)}
+	for {
+		line, err := sc.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if line == "" {
+			break
+		}
+		idx := strings.Index(line, ":")
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid STOMP header %q", line)
+		}
+		key := stompUnescaper.Replace(line[:idx])
+		if _, ok := frame.headers[key]; !ok { // The first occurrence wins
+			frame.headers[key] = stompUnescaper.Replace(line[idx+1:])
+		}
+	}
+	if value, ok := frame.headers["content-length"]; ok {
+		length, err := strconv.Atoi(value)
+		if err != nil || length < 0 || length > stompMaxFrameSize {
+			return nil, fmt.Errorf("invalid STOMP content length %q", value)
+		}
+		frame.body = make([]byte, length+1)
+		if _, err := io.ReadFull(sc.reader, frame.body); err != nil {
+			return nil, fmt.Errorf("cannot read STOMP frame: %v", err)
+		}
+		if frame.body[length] != 0 {
+			return nil, fmt.Errorf("invalid STOMP frame: missing NULL terminator")
+		}
+		frame.body = frame.body[:length]
+	} else {
+		body, err := sc.reader.ReadBytes(0)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read STOMP frame: %v", err)
+		}
+		frame.body = body[:len(body)-1]
+	}
+	return frame, nil
+}
+
+// readLine Reads a line, removing the optional carriage return.
+func (sc *stompConn) readLine() (string, error) {
+	line, err := sc.reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("cannot read STOMP frame: %v", err)
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+// close Sends the DISCONNECT frame and closes the connection.
+func (sc *stompConn) close() error {
+	sc.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	sc.send("DISCONNECT", nil)
+	return sc.conn.Close()
+}
+
+// stompError Converts an ERROR frame, or an unexpected frame, into an error.
+func stompError(frame *stompFrame) error {
+	if frame.command != "ERROR" {
+		return fmt.Errorf("unexpected STOMP frame %s", frame.command)
+	}
+	msg := frame.headers["message"]
+	if details := string(bytes.TrimSpace(frame.body)); details != "" {
+		msg += ": " + details
+	}
+	return fmt.Errorf("STOMP error: %s", msg)
+}
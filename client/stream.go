@@ -0,0 +1,196 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/stream"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultStreamBufferSize is the default number of messages buffered for each client of the stream server.
+const DefaultStreamBufferSize = 1000
+
+var (
+	// streamClients tracks the connected clients of the stream server.
+	streamClients = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "onms_ipc_stream_clients",
+		Help: "The number of clients connected to the gRPC stream server",
+	})
+	// streamDropped tracks the messages not delivered to slow clients of the stream server.
+	streamDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "onms_ipc_stream_dropped_messages_total",
+		Help: "The total number of messages dropped because the buffer of a client of the gRPC stream server was full",
+	})
+)
+
+// StreamServer is an embedded gRPC server that streams the decoded messages to the connected clients (see protobuf/stream.proto),
+// so the receiver can be used as a fan-out point for other services. Each client chooses which messages to receive through a filter.
+// Messages are buffered for each client; when the buffer of a slow client is full, its messages are dropped instead of blocking the consumer.
+// With Auth, the clients must send the same credentials as the HTTP endpoints through the authorization metadata.
+type StreamServer struct {
+	stream.UnimplementedMessageStreamServer
+
+	Address    string      // The address to listen on, i.e. :8990.
+	BufferSize int         // The number of messages buffered for each client (defaults to DefaultStreamBufferSize).
+	TLSCert    string      // Path to the TLS certificate (PEM); enables TLS when defined.
+	TLSKey     string      // Path to the TLS private key (PEM).
+	Auth       *HTTPServer // Requires the basic or bearer credentials of the HTTP server when defined (optional).
+
+	server   *grpc.Server
+	listener net.Listener
+	stop     chan struct{}
+	hub      *messageHub
+}
+
+// Validate Verifies the stream server settings, applying defaults when necessary, and starts listening for clients.
+func (srv *StreamServer) Validate() error {
+	if srv.Address == "" {
+		return fmt.Errorf("the stream server address is required")
+	}
+	if (srv.TLSCert == "") != (srv.TLSKey == "") {
+		return fmt.Errorf("both TLS certificate and key are required")
+	}
+	if srv.BufferSize <= 0 {
+		srv.BufferSize = DefaultStreamBufferSize
+	}
+	if srv.server != nil {
+		return nil
+	}
+	options := []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := srv.authenticate(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(server interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := srv.authenticate(ss.Context()); err != nil {
+				return err
+			}
+			return handler(server, ss)
+		}),
+	}
+	if srv.TLSCert != "" {
+		creds, err := credentials.NewServerTLSFromFile(srv.TLSCert, srv.TLSKey)
+		if err != nil {
+			return fmt.Errorf("cannot load TLS certificate: %v", err)
+		}
+		options = append(options, grpc.Creds(creds))
+	}
+	listener, err := net.Listen("tcp", srv.Address)
+	if err != nil {
+		return fmt.Errorf("cannot listen on %s: %v", srv.Address, err)
+	}
+	srv.listener = listener
+	srv.stop = make(chan struct{})
+	srv.hub = newMessageHub(streamClients, streamDropped)
+	srv.server = grpc.NewServer(options...)
+	stream.RegisterMessageStreamServer(srv.server, srv)
+	go func() {
+		if err := srv.server.Serve(listener); err != nil {
+			defaultLogger.Errorf("stream server failed: %v", err)
+		}
+	}()
+	defaultLogger.Infof("stream server listening on %s", listener.Addr())
+	return nil
+}
+
+// authenticate Verifies the credentials sent by a client through the authorization metadata, when the authentication is enabled.
+func (srv *StreamServer) authenticate(ctx context.Context) error {
+	if srv.Auth == nil || !srv.Auth.authEnabled() {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, auth := range md.Get("authorization") {
+		if srv.Auth.authorizedHeader(auth) {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "unauthorized")
+}
+
+// Addr Returns the address the server is listening on, or nil when it is not running.
+func (srv *StreamServer) Addr() net.Addr {
+	if srv.listener == nil {
+		return nil
+	}
+	return srv.listener.Addr()
+}
+
+// Name Returns the name of the output.
+func (srv *StreamServer) Name() string {
+	return "stream"
+}
+
+// Send Queues a decoded message for each client whose filter it satisfies.
+// It never blocks nor fails; the messages for the clients with a full buffer are dropped.
+func (srv *StreamServer) Send(ctx context.Context, msg DecodedMessage) error {
+	if srv.hub != nil {
+		srv.hub.publish(msg)
+	}
+	return nil
+}
+
+// Close Disconnects the clients and stops the server.
+func (srv *StreamServer) Close() error {
+	if srv.server == nil {
+		return nil
+	}
+	close(srv.stop)
+	srv.server.GracefulStop()
+	srv.server = nil
+	srv.listener = nil
+	return nil
+}
+
+// Subscribe Streams the decoded messages that satisfy the filter, until the client disconnects or the server stops.
+func (srv *StreamServer) Subscribe(req *stream.Filter, client stream.MessageStream_SubscribeServer) error {
+	filter, err := newStreamFilter(req)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid filter: %v", err)
+	}
+	sub := srv.hub.subscribe(filter, srv.BufferSize)
+	defer srv.hub.unsubscribe(sub)
+	for {
+		select {
+		case msg := <-sub.messages:
+			if err := client.Send(newStreamMessage(msg)); err != nil {
+				return err
+			}
+		case <-client.Context().Done():
+			return nil
+		case <-srv.stop:
+			return nil
+		}
+	}
+}
+
+// newStreamMessage Converts a decoded message into its protobuf representation.
+func newStreamMessage(msg DecodedMessage) *stream.Message {
+	record := &stream.Message{
+		Topic:     msg.Topic,
+		Key:       msg.Metadata.SourceAddress,
+		Payload:   msg.Payload,
+		Parser:    msg.Parser,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Location:  msg.Metadata.Location,
+		SystemId:  msg.Metadata.SystemID,
+		Headers:   msg.Headers,
+	}
+	if !msg.Timestamp.IsZero() {
+		record.Timestamp = msg.Timestamp.UnixNano() / int64(time.Millisecond)
+	}
+	return record
+}
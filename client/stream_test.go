@@ -0,0 +1,115 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/stream"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gotest.tools/v3/assert"
+)
+
+func TestStreamServer(t *testing.T) {
+	srv := &StreamServer{Address: "127.0.0.1:0", BufferSize: 10}
+	assert.NilError(t, srv.Validate())
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, srv.Addr().String(), grpc.WithInsecure(), grpc.WithBlock())
+	assert.NilError(t, err)
+	defer conn.Close()
+	client := stream.NewMessageStreamClient(conn)
+
+	// Invalid filter
+	invalid, err := client.Subscribe(ctx, &stream.Filter{Source: "invalid"})
+	assert.NilError(t, err)
+	_, err = invalid.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	sub, err := client.Subscribe(ctx, &stream.Filter{Parsers: []string{"syslog"}, Source: "10.0.0.0/8", Headers: []string{"tenant=acme"}})
+	assert.NilError(t, err)
+	waitFor(t, func() bool { return srv.hub.count() == 1 })
+
+	ts := time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)
+	headers := map[string]string{"tenant": "acme"}
+	for _, msg := range []DecodedMessage{
+		{Topic: "Test", Parser: "snmp", Metadata: Metadata{SourceAddress: "10.0.0.1"}, Headers: headers},
+		{Topic: "Test", Parser: "Syslog", Metadata: Metadata{SourceAddress: "192.168.0.1"}, Headers: headers},
+		{Topic: "Test", Parser: "Syslog", Metadata: Metadata{SourceAddress: "10.0.0.2"}},
+		{Topic: "Test", Parser: "Syslog", Offset: 42, Timestamp: ts, Metadata: Metadata{SourceAddress: "10.0.0.3", Location: "Apex"}, Headers: headers, Payload: []byte(`{}`)},
+	} {
+		assert.NilError(t, srv.Send(context.Background(), msg))
+	}
+	record, err := sub.Recv()
+	assert.NilError(t, err)
+	assert.Equal(t, "Test", record.Topic)
+	assert.Equal(t, "10.0.0.3", record.Key)
+	assert.Equal(t, "Apex", record.Location)
+	assert.Equal(t, int64(42), record.Offset)
+	assert.Equal(t, ts.UnixNano()/int64(time.Millisecond), record.Timestamp)
+	assert.Equal(t, "{}", string(record.Payload))
+	assert.DeepEqual(t, headers, record.Headers)
+
+	// Slow clients don't block the server
+	for i := 0; i < 20; i++ {
+		assert.NilError(t, srv.Send(context.Background(), DecodedMessage{Parser: "syslog", Metadata: Metadata{SourceAddress: "10.0.0.1"}, Headers: headers}))
+	}
+
+	assert.NilError(t, srv.Close())
+	for err == nil {
+		_, err = sub.Recv()
+	}
+}
+
+// waitFor Waits until the condition is true, failing the test after a second.
+func waitFor(t *testing.T, condition func() bool) {
+	for i := 0; i < 100; i++ {
+		if condition() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timeout waiting for condition")
+}
+
+func TestStreamServerAuth(t *testing.T) {
+	srv := &StreamServer{Address: "127.0.0.1:0", Auth: &HTTPServer{Username: "admin", Password: "secret", BearerToken: "token"}}
+	assert.NilError(t, srv.Validate())
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, srv.Addr().String(), grpc.WithInsecure(), grpc.WithBlock())
+	assert.NilError(t, err)
+	defer conn.Close()
+	client := stream.NewMessageStreamClient(conn)
+
+	for _, auth := range []string{"", "Bearer invalid", "Basic YWRtaW46aW52YWxpZA=="} {
+		callCtx := ctx
+		if auth != "" {
+			callCtx = metadata.AppendToOutgoingContext(ctx, "authorization", auth)
+		}
+		sub, err := client.Subscribe(callCtx, &stream.Filter{})
+		assert.NilError(t, err)
+		_, err = sub.Recv()
+		assert.Equal(t, codes.Unauthenticated, status.Code(err), auth)
+	}
+	assert.Equal(t, 0, srv.hub.count())
+
+	for i, auth := range []string{"Bearer token", "Basic YWRtaW46c2VjcmV0"} {
+		sub, err := client.Subscribe(metadata.AppendToOutgoingContext(ctx, "authorization", auth), &stream.Filter{})
+		assert.NilError(t, err)
+		waitFor(t, func() bool { return srv.hub.count() == i+1 })
+		assert.NilError(t, srv.Send(context.Background(), DecodedMessage{Topic: "Test", Parser: "syslog"}))
+		record, err := sub.Recv()
+		assert.NilError(t, err, auth)
+		assert.Equal(t, "Test", record.Topic)
+	}
+}
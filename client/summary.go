@@ -0,0 +1,137 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Summary dimensions
+const (
+	DimensionTotal    = "total"
+	DimensionType     = "type"
+	DimensionSource   = "source"
+	DimensionSeverity = "severity"
+)
+
+// syslogSeverities contains the names of the Syslog severities.
+var syslogSeverities = []string{"emergency", "alert", "critical", "error", "warning", "notice", "info", "debug"}
+
+// MessageSummary counts the decoded messages by type, source and severity.
+// Syslog messages and SNMP traps are counted individually, even when they arrive in the same IPC message.
+type MessageSummary struct {
+	Counts map[string]map[string]int // Counts by dimension and key.
+}
+
+// NewMessageSummary creates an empty summary.
+func NewMessageSummary() *MessageSummary {
+	return &MessageSummary{Counts: map[string]map[string]int{
+		DimensionTotal:    {},
+		DimensionType:     {},
+		DimensionSource:   {},
+		DimensionSeverity: {},
+	}}
+}
+
+// add Counts a message with a given type, source and severity.
+func (s *MessageSummary) add(kind, source, severity string) {
+	if source == "" {
+		source = "unknown"
+	}
+	s.Counts[DimensionTotal][DimensionTotal]++
+	s.Counts[DimensionType][kind]++
+	s.Counts[DimensionSource][source]++
+	if severity != "" {
+		s.Counts[DimensionSeverity][severity]++
+	}
+}
+
+// Add Counts a decoded message.
+func (s *MessageSummary) Add(msg DecodedMessage) {
+	switch msg.Parser {
+	case "syslog":
+		var syslog struct {
+			Messages []SyslogFields `json:"messages"`
+		}
+		if err := json.Unmarshal(msg.Payload, &syslog); err == nil {
+			for _, m := range syslog.Messages {
+				kind := "syslog"
+				if m.AppName != "" {
+					kind = "syslog " + m.AppName
+				}
+				s.add(kind, msg.Metadata.SourceAddress, syslogSeverities[m.Severity%8])
+			}
+			return
+		}
+	case "snmp":
+		var trapLog struct {
+			Messages []struct {
+				TrapIdentity *TrapIdentityDTO `json:"trapIdentity"`
+			} `json:"messages"`
+		}
+		if err := json.Unmarshal(msg.Payload, &trapLog); err == nil {
+			for _, trap := range trapLog.Messages {
+				kind := "trap"
+				if id := trap.TrapIdentity; id != nil {
+					kind = fmt.Sprintf("trap %s/%d/%d", id.EnterpriseID, id.Generic, id.Specific)
+				}
+				s.add(kind, msg.Metadata.SourceAddress, "")
+			}
+			return
+		}
+	}
+	s.add(msg.Parser, msg.Metadata.SourceAddress, "")
+}
+
+// SummaryDelta represents the difference between two summaries for a given dimension and key.
+type SummaryDelta struct {
+	Dimension string
+	Key       string
+	Before    int
+	After     int
+}
+
+// Delta Returns the difference between the counts.
+func (d SummaryDelta) Delta() int {
+	return d.After - d.Before
+}
+
+// DiffSummaries Returns the differences between two summaries, sorted by dimension and the magnitude of the change.
+// When all is true, the keys without changes are included.
+func DiffSummaries(before, after *MessageSummary, all bool) []SummaryDelta {
+	var deltas []SummaryDelta
+	for _, dimension := range []string{DimensionTotal, DimensionType, DimensionSource, DimensionSeverity} {
+		keys := map[string]bool{}
+		for k := range before.Counts[dimension] {
+			keys[k] = true
+		}
+		for k := range after.Counts[dimension] {
+			keys[k] = true
+		}
+		var list []SummaryDelta
+		for k := range keys {
+			d := SummaryDelta{dimension, k, before.Counts[dimension][k], after.Counts[dimension][k]}
+			if all || d.Delta() != 0 {
+				list = append(list, d)
+			}
+		}
+		sort.Slice(list, func(i, j int) bool {
+			di, dj := abs(list[i].Delta()), abs(list[j].Delta())
+			if di == dj {
+				return list[i].Key < list[j].Key
+			}
+			return di > dj
+		})
+		deltas = append(deltas, list...)
+	}
+	return deltas
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,42 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestDiffSummaries(t *testing.T) {
+	syslog := func(contents ...string) DecodedMessage {
+		dto := SyslogMessageLogDTO{SourceAddress: "10.0.0.1"}
+		for _, c := range contents {
+			dto.Messages = append(dto.Messages, SyslogMessageDTO{Content: []byte(base64.StdEncoding.EncodeToString([]byte(c)))})
+		}
+		return DecodedMessage{Parser: "syslog", Metadata: Metadata{SourceAddress: "10.0.0.1"}, Payload: []byte(dto.String())}
+	}
+	trap := DecodedMessage{
+		Parser:   "snmp",
+		Metadata: Metadata{SourceAddress: "10.0.0.2"},
+		Payload:  []byte(TrapLogDTO{Messages: []TrapDTO{{TrapIdentity: &TrapIdentityDTO{EnterpriseID: ".1.3.6.1.4.1.9", Generic: 6, Specific: 1}}}}.String()),
+	}
+
+	before := NewMessageSummary()
+	before.Add(syslog("<34>Oct 11 22:14:15 host su: failed", "<38>Oct 11 22:14:15 host sshd: accepted"))
+	before.Add(trap)
+	after := NewMessageSummary()
+	after.Add(syslog("<38>Oct 11 22:14:15 host sshd: accepted"))
+	after.Add(trap)
+	after.Add(trap)
+
+	assert.DeepEqual(t, []SummaryDelta{
+		{DimensionType, "syslog su", 1, 0},
+		{DimensionType, "trap .1.3.6.1.4.1.9/6/1", 1, 2},
+		{DimensionSource, "10.0.0.1", 2, 1},
+		{DimensionSource, "10.0.0.2", 1, 2},
+		{DimensionSeverity, "critical", 1, 0},
+	}, DiffSummaries(before, after, false))
+	assert.Equal(t, 8, len(DiffSummaries(before, after, true)))
+}
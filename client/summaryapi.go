@@ -0,0 +1,363 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Default summary API settings
+const (
+	DefaultSummaryInterval   = 10 * time.Second
+	DefaultSummaryHistory    = time.Hour
+	DefaultSummaryMaxSources = 10000
+	DefaultSummaryTopSources = 10
+)
+
+// Prefixes of the targets of the Grafana JSON datasource; the targets with series are followed by the topic, i.e. messages:OpenNMS.Sink.Trap.
+const (
+	SummaryMessages = "messages:" // The processed messages per second.
+	SummaryErrors   = "errors:"   // The messages per second that couldn't be decoded or failed the integrity checks.
+	SummaryLag      = "lag:"      // The consumer lag.
+	SummarySources  = "sources"   // A table with the top sources.
+)
+
+// TopicSummary reports the activity of a topic.
+type TopicSummary struct {
+	Topic       string  `json:"topic"`
+	MessageRate float64 `json:"messageRate"` // Processed messages per second.
+	ErrorRate   float64 `json:"errorRate"`   // Messages per second that couldn't be decoded or failed the integrity checks.
+	Lag         int64   `json:"lag"`         // The consumer lag across all the partitions.
+}
+
+// SourceSummary reports the number of messages received from a source address.
+type SourceSummary struct {
+	Source string `json:"source"`
+	Count  int64  `json:"count"`
+}
+
+// summaryPoint contains the activity of each topic at a given time.
+type summaryPoint struct {
+	time   time.Time
+	topics map[string]TopicSummary
+}
+
+// summaryTotals contains the value of the counters of a topic on the previous sample.
+type summaryTotals struct {
+	messages float64
+	errors   float64
+}
+
+// SummaryAPI exposes the message and error rates by topic, the consumer lag and the top sources in JSON, including the endpoints
+// of the Grafana JSON datasource, so a dashboard can be built without Prometheus for small lab setups.
+// The rates are derived from the metrics of the clients sampled every Interval, and the sources are counted as an output
+// since the receiver started; to cap the memory, only the first MaxSources addresses are tracked individually, and the rest as "other".
+// This is a concurrent safe object.
+type SummaryAPI struct {
+	Interval   time.Duration       // How often to sample the metrics.
+	History    time.Duration       // How long to keep the samples.
+	MaxSources int                 // The maximum number of source addresses tracked individually.
+	Gatherer   prometheus.Gatherer // The source of the metrics (defaults to the default registry).
+
+	mutex   sync.Mutex
+	points  []summaryPoint
+	last    map[string]summaryTotals
+	sources map[string]int64
+}
+
+// NewSummaryAPI creates a summary API with a given sampling interval, using the default settings for the rest.
+func NewSummaryAPI(interval time.Duration) *SummaryAPI {
+	if interval <= 0 {
+		interval = DefaultSummaryInterval
+	}
+	return &SummaryAPI{
+		Interval:   interval,
+		History:    DefaultSummaryHistory,
+		MaxSources: DefaultSummaryMaxSources,
+		Gatherer:   prometheus.DefaultGatherer,
+		sources:    make(map[string]int64),
+	}
+}
+
+// Name Returns the name of the output.
+func (s *SummaryAPI) Name() string {
+	return "summary"
+}
+
+// Send Counts a decoded message by its source address.
+func (s *SummaryAPI) Send(ctx context.Context, msg DecodedMessage) error {
+	source := msg.Metadata.SourceAddress
+	if source == "" {
+		source = "unknown"
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.sources[source]; !ok && s.MaxSources > 0 && len(s.sources) >= s.MaxSources {
+		source = otherLabel
+	}
+	s.sources[source]++
+	return nil
+}
+
+// Run Samples the metrics periodically, until the context is cancelled.
+// It is recommended to use it within a Go Routine as it is a blocking operation.
+func (s *SummaryAPI) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			if err := s.sample(now); err != nil {
+				defaultLogger.Warnf("cannot sample metrics for the summary: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sample Records the rates and the lag of each topic, based on the difference with the previous sample.
+func (s *SummaryAPI) sample(now time.Time) error {
+	families, err := s.Gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	totals := make(map[string]summaryTotals)
+	lag := make(map[string]int64)
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, pair := range m.GetLabel() {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			topic := labels["topic"]
+			t := totals[topic]
+			switch family.GetName() {
+			case "onms_ipc_messages_total":
+				switch labels["result"] {
+				case ResultProcessed:
+					t.messages += m.GetCounter().GetValue()
+				case ResultInvalid:
+					t.errors += m.GetCounter().GetValue()
+				default:
+					continue
+				}
+			case "onms_ipc_unmarshal_failures_total":
+				t.errors += m.GetCounter().GetValue()
+			case "onms_ipc_consumer_lag":
+				lag[topic] += int64(m.GetGauge().GetValue())
+				continue
+			default:
+				continue
+			}
+			totals[topic] = t
+		}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	point := summaryPoint{time: now, topics: make(map[string]TopicSummary)}
+	var elapsed float64
+	if len(s.points) > 0 {
+		elapsed = now.Sub(s.points[len(s.points)-1].time).Seconds()
+	}
+	for topic, t := range totals {
+		summary := TopicSummary{Topic: topic, Lag: lag[topic]}
+		if elapsed > 0 { // The topics without a previous sample started from zero
+			prev := s.last[topic]
+			summary.MessageRate = counterRate(t.messages, prev.messages, elapsed)
+			summary.ErrorRate = counterRate(t.errors, prev.errors, elapsed)
+		}
+		point.topics[topic] = summary
+	}
+	for topic, value := range lag {
+		if _, ok := point.topics[topic]; !ok {
+			point.topics[topic] = TopicSummary{Topic: topic, Lag: value}
+		}
+	}
+	s.last = totals
+	s.points = append(s.points, point)
+	for len(s.points) > 0 && now.Sub(s.points[0].time) > s.History {
+		s.points = s.points[1:]
+	}
+	return nil
+}
+
+// counterRate Returns the rate per second between two values of a counter, assuming a reset when the counter decreases.
+func counterRate(current, previous, seconds float64) float64 {
+	if current < previous {
+		previous = 0
+	}
+	return (current - previous) / seconds
+}
+
+// Topics Returns the activity of each topic from the last sample, sorted by topic.
+func (s *SummaryAPI) Topics() []TopicSummary {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	topics := []TopicSummary{}
+	if len(s.points) == 0 {
+		return topics
+	}
+	for _, summary := range s.points[len(s.points)-1].topics {
+		topics = append(topics, summary)
+	}
+	sort.Slice(topics, func(i, j int) bool { return topics[i].Topic < topics[j].Topic })
+	return topics
+}
+
+// TopSources Returns the sources with more messages, sorted by count; returns all of them when limit is zero.
+func (s *SummaryAPI) TopSources(limit int) []SourceSummary {
+	s.mutex.Lock()
+	sources := make([]SourceSummary, 0, len(s.sources))
+	for source, count := range s.sources {
+		sources = append(sources, SourceSummary{source, count})
+	}
+	s.mutex.Unlock()
+	sort.Slice(sources, func(i, j int) bool {
+		if sources[i].Count == sources[j].Count {
+			return sources[i].Source < sources[j].Source
+		}
+		return sources[i].Count > sources[j].Count
+	})
+	if limit > 0 && len(sources) > limit {
+		sources = sources[:limit]
+	}
+	return sources
+}
+
+// Handler Returns an HTTP handler that exposes the summary in JSON on GET, accepting an optional limit query parameter for the sources.
+// It also implements the search and query endpoints of the Grafana JSON datasource, when the request path ends with /search or /query.
+func (s *SummaryAPI) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/search"):
+			s.search(w, r)
+		case strings.HasSuffix(r.URL.Path, "/query"):
+			s.query(w, r)
+		case r.Method == http.MethodGet:
+			limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+			if err != nil {
+				limit = DefaultSummaryTopSources
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"interval": shortDuration(s.Interval),
+				"topics":   s.Topics(),
+				"sources":  s.TopSources(limit),
+			})
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// search Returns the available targets for the Grafana JSON datasource.
+func (s *SummaryAPI) search(w http.ResponseWriter, r *http.Request) {
+	targets := []string{}
+	for _, summary := range s.Topics() {
+		targets = append(targets, SummaryMessages+summary.Topic, SummaryErrors+summary.Topic, SummaryLag+summary.Topic)
+	}
+	targets = append(targets, SummarySources)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(targets)
+}
+
+// summaryQuery represents a query from the Grafana JSON datasource.
+type summaryQuery struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	Targets []struct {
+		Target string `json:"target"`
+	} `json:"targets"`
+}
+
+// summaryColumn represents a column of a table for the Grafana JSON datasource.
+type summaryColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+// query Returns the time series or the table of each target, in the format of the Grafana JSON datasource.
+func (s *SummaryAPI) query(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := &summaryQuery{}
+	if err := json.NewDecoder(r.Body).Decode(query); err != nil {
+		http.Error(w, "invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	results := []interface{}{}
+	for _, target := range query.Targets {
+		if target.Target == SummarySources {
+			rows := [][]interface{}{}
+			for _, source := range s.TopSources(DefaultSummaryTopSources) {
+				rows = append(rows, []interface{}{source.Source, source.Count})
+			}
+			results = append(results, map[string]interface{}{
+				"type":    "table",
+				"columns": []summaryColumn{{"Source", "string"}, {"Count", "number"}},
+				"rows":    rows,
+			})
+			continue
+		}
+		datapoints, ok := s.series(target.Target, query.Range.From, query.Range.To)
+		if !ok {
+			http.Error(w, "unknown target "+target.Target, http.StatusBadRequest)
+			return
+		}
+		results = append(results, map[string]interface{}{
+			"target":     target.Target,
+			"datapoints": datapoints,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// series Returns the data points of a target within a time range (unbounded when zero), as [value, milliseconds since the epoch].
+// Returns false when the target is invalid.
+func (s *SummaryAPI) series(target string, from, to time.Time) ([][2]float64, bool) {
+	var prefix string
+	for _, p := range []string{SummaryMessages, SummaryErrors, SummaryLag} {
+		if strings.HasPrefix(target, p) {
+			prefix = p
+		}
+	}
+	if prefix == "" {
+		return nil, false
+	}
+	topic := strings.TrimPrefix(target, prefix)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	datapoints := [][2]float64{}
+	for _, point := range s.points {
+		if (!from.IsZero() && point.time.Before(from)) || (!to.IsZero() && point.time.After(to)) {
+			continue
+		}
+		summary, ok := point.topics[topic]
+		if !ok {
+			continue
+		}
+		value := summary.MessageRate
+		if prefix == SummaryErrors {
+			value = summary.ErrorRate
+		} else if prefix == SummaryLag {
+			value = float64(summary.Lag)
+		}
+		datapoints = append(datapoints, [2]float64{value, float64(point.time.UnixNano() / int64(time.Millisecond))})
+	}
+	return datapoints, true
+}
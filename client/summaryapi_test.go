@@ -0,0 +1,87 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gotest.tools/v3/assert"
+)
+
+func TestSummaryAPI(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	messages := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "onms_ipc_messages_total"}, []string{"group", "topic", "parser", "result"})
+	failures := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "onms_ipc_unmarshal_failures_total"}, []string{"group", "topic", "parser"})
+	lag := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "onms_ipc_consumer_lag"}, []string{"group", "topic", "partition"})
+	registry.MustRegister(messages, failures, lag)
+
+	api := NewSummaryAPI(10 * time.Second)
+	api.MaxSources = 2
+	api.Gatherer = registry
+	now := time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)
+	assert.NilError(t, api.sample(now))
+	messages.WithLabelValues("g", "Trap", "snmp", ResultProcessed).Add(100)
+	messages.WithLabelValues("g", "Trap", "snmp", ResultInvalid).Add(5)
+	messages.WithLabelValues("g", "Trap", "snmp", ResultDuplicate).Add(50)
+	failures.WithLabelValues("g", "Trap", "snmp").Add(5)
+	lag.WithLabelValues("g", "Trap", "0").Set(30)
+	lag.WithLabelValues("g", "Trap", "1").Set(12)
+	assert.NilError(t, api.sample(now.Add(10*time.Second)))
+	assert.DeepEqual(t, []TopicSummary{{Topic: "Trap", MessageRate: 10, ErrorRate: 1, Lag: 42}}, api.Topics())
+
+	for _, source := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.1", "10.0.0.3", "10.0.0.4"} {
+		assert.NilError(t, api.Send(context.Background(), DecodedMessage{Metadata: Metadata{SourceAddress: source}}))
+	}
+	assert.DeepEqual(t, []SourceSummary{{"10.0.0.1", 2}, {otherLabel, 2}, {"10.0.0.2", 1}}, api.TopSources(0))
+	assert.Equal(t, 1, len(api.TopSources(1)))
+
+	handler := api.Handler()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/summary", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var summary struct {
+		Interval string          `json:"interval"`
+		Topics   []TopicSummary  `json:"topics"`
+		Sources  []SourceSummary `json:"sources"`
+	}
+	assert.NilError(t, json.NewDecoder(rec.Body).Decode(&summary))
+	assert.Equal(t, "10s", summary.Interval)
+	assert.Equal(t, 1, len(summary.Topics))
+	assert.Equal(t, 3, len(summary.Sources))
+
+	// Grafana JSON datasource
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/summary/search", strings.NewReader(`{"target":""}`)))
+	var targets []string
+	assert.NilError(t, json.NewDecoder(rec.Body).Decode(&targets))
+	assert.DeepEqual(t, []string{"messages:Trap", "errors:Trap", "lag:Trap", "sources"}, targets)
+
+	rec = httptest.NewRecorder()
+	body := `{"range":{"from":"2021-03-04T00:00:05Z","to":"2021-03-04T01:00:00Z"},"targets":[{"target":"messages:Trap"},{"target":"lag:Trap"},{"target":"sources"}]}`
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/summary/query", strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var results []struct {
+		Target     string          `json:"target"`
+		Datapoints [][2]float64    `json:"datapoints"`
+		Type       string          `json:"type"`
+		Rows       [][]interface{} `json:"rows"`
+	}
+	assert.NilError(t, json.NewDecoder(rec.Body).Decode(&results))
+	assert.Equal(t, 3, len(results))
+	ts := float64(now.Add(10*time.Second).UnixNano() / int64(time.Millisecond))
+	assert.DeepEqual(t, [][2]float64{{10, ts}}, results[0].Datapoints)
+	assert.DeepEqual(t, [][2]float64{{42, ts}}, results[1].Datapoints)
+	assert.Equal(t, "table", results[2].Type)
+	assert.Equal(t, 3, len(results[2].Rows))
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/summary/query", strings.NewReader(`{"targets":[{"target":"invalid"}]}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -6,8 +6,8 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"encoding/xml"
-	"fmt"
-	"log"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -17,14 +17,104 @@ type SyslogMessageDTO struct {
 	Content   []byte `xml:",chardata" json:"content"`
 }
 
-// MarshalJSON converts Syslog message to JSON
+// MarshalJSON converts Syslog message to JSON, including the fields parsed from its header when possible
 func (dto *SyslogMessageDTO) MarshalJSON() ([]byte, error) {
 	bytes, err := base64.StdEncoding.DecodeString(string(dto.Content))
 	content := strings.TrimSuffix(string(bytes), "\n")
 	if err != nil {
-		log.Printf("[error] cannot decode base64 value: %v", err)
+		defaultLogger.Errorf("cannot decode base64 value: %v", err)
 	}
-	return []byte(fmt.Sprintf(`{"timestamp": "%s", "content": "%s"}`, dto.Timestamp, content)), nil
+	fields, _ := ParseSyslog(content)
+	return json.Marshal(struct {
+		Timestamp string `json:"timestamp"`
+		Content   string `json:"content"`
+		*SyslogFields
+	}{dto.Timestamp, content, fields})
+}
+
+// SyslogFields represents the fields parsed from a Syslog message
+type SyslogFields struct {
+	Priority int    `json:"priority"`
+	Facility int    `json:"facility"`
+	Severity int    `json:"severity"`
+	Time     string `json:"time,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+	AppName  string `json:"appName,omitempty"`
+	ProcID   string `json:"procId,omitempty"`
+	MsgID    string `json:"msgId,omitempty"`
+	Message  string `json:"message"`
+
+	StructuredData map[string]map[string]string `json:"structuredData,omitempty"` // The parameters of each SD-ELEMENT by SD-ID (RFC 5424).
+	Fields         map[string]string            `json:"fields,omitempty"`         // The custom fields extracted by the fallback patterns.
+}
+
+var (
+	syslogPriority = regexp.MustCompile(`^\s*<(\d{1,3})>`)
+	syslogRFC5424  = regexp.MustCompile(`(?s)^1 (\S+) (\S+) (\S+) (\S+) (\S+) (-|(?:\[(?:[^\]\\]|\\.)*\])+) ?(.*)$`)
+	syslogRFC3164  = regexp.MustCompile(`(?s)^([A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}) (\S+) ([^:\[\s]+)(?:\[([^\]]+)\])?: ?(.*)$`)
+	syslogSDParam  = regexp.MustCompile(`^\s*([^\s="\]]+)="((?:[^"\\]|\\.)*)"`)
+	sdUnescaper    = strings.NewReplacer(`\"`, `"`, `\\`, `\`, `\]`, `]`) // The escaped characters of the values of the structured data
+)
+
+// ParseSyslog Parses the header of a Syslog message, based on RFC 5424 (including its structured data) or RFC 3164.
+// When the header doesn't follow any of them, the patterns from SetSyslogPatterns are applied, and when none matches,
+// only the priority is extracted, and the rest is treated as the message.
+// Returns false when the message doesn't start with a priority.
+func ParseSyslog(content string) (*SyslogFields, bool) {
+	match := syslogPriority.FindStringSubmatch(content)
+	if match == nil {
+		return nil, false
+	}
+	priority, _ := strconv.Atoi(match[1])
+	fields := &SyslogFields{Priority: priority, Facility: priority / 8, Severity: priority % 8}
+	rest := content[len(match[0]):]
+	if m := syslogRFC5424.FindStringSubmatch(rest); m != nil {
+		fields.Time, fields.Hostname, fields.AppName, fields.ProcID, fields.MsgID = nilValue(m[1]), nilValue(m[2]), nilValue(m[3]), nilValue(m[4]), nilValue(m[5])
+		fields.Message = strings.TrimPrefix(m[7], "\ufeff")
+		fields.StructuredData = parseStructuredData(m[6])
+	} else if m := syslogRFC3164.FindStringSubmatch(rest); m != nil {
+		fields.Time, fields.Hostname, fields.AppName, fields.ProcID = m[1], m[2], m[3], m[4]
+		fields.Message = m[5]
+	} else if !fields.parseFallback(rest) {
+		fields.Message = strings.TrimSpace(rest)
+	}
+	return fields, true
+}
+
+// parseStructuredData Parses the SD-ELEMENTs of an RFC 5424 message, unescaping the values of their parameters; returns nil for the NILVALUE.
+func parseStructuredData(sd string) map[string]map[string]string {
+	if sd == "-" {
+		return nil
+	}
+	elements := make(map[string]map[string]string)
+	for strings.HasPrefix(sd, "[") {
+		sd = sd[1:]
+		end := strings.IndexAny(sd, " ]")
+		if end < 0 {
+			break
+		}
+		params := make(map[string]string)
+		elements[sd[:end]] = params
+		sd = sd[end:]
+		for {
+			m := syslogSDParam.FindStringSubmatch(sd)
+			if m == nil {
+				break
+			}
+			params[m[1]] = sdUnescaper.Replace(m[2])
+			sd = sd[len(m[0]):]
+		}
+		sd = strings.TrimPrefix(strings.TrimLeft(sd, " "), "]")
+	}
+	return elements
+}
+
+// nilValue Returns an empty string for the RFC 5424 NILVALUE.
+func nilValue(value string) string {
+	if value == "-" {
+		return ""
+	}
+	return value
 }
 
 // SyslogMessageLogDTO represents a collection of Syslog messages
@@ -38,9 +128,9 @@ type SyslogMessageLogDTO struct {
 }
 
 func (dto SyslogMessageLogDTO) String() string {
-	bytes, err := json.MarshalIndent(dto, "", "  ")
-	if err != nil {
-		log.Printf("[error] cannot generate JSON for syslog message: %v", err)
+	var s string
+	if err := encodeIndent(dto, func(data []byte) { s = string(data) }); err != nil {
+		defaultLogger.Errorf("cannot generate JSON for syslog message: %v", err)
 	}
-	return string(bytes)
+	return s
 }
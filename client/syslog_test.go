@@ -0,0 +1,110 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseSyslog(t *testing.T) {
+	fields, ok := ParseSyslog(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application"] An application event log entry`)
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, &SyslogFields{
+		Priority: 165,
+		Facility: 20,
+		Severity: 5,
+		Time:     "2003-10-11T22:14:15.003Z",
+		Hostname: "mymachine.example.com",
+		AppName:  "evntslog",
+		MsgID:    "ID47",
+		Message:  "An application event log entry",
+		StructuredData: map[string]map[string]string{
+			"exampleSDID@32473": {"iut": "3", "eventSource": "Application"},
+		},
+	}, fields)
+
+	fields, ok = ParseSyslog(`<165>1 2003-10-11T22:14:15.003Z host app - - [origin ip="10.0.0.1"][meta note="a \"quoted\" \] value" empty=""][flag] Message`)
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, map[string]map[string]string{
+		"origin": {"ip": "10.0.0.1"},
+		"meta":   {"note": `a "quoted" ] value`, "empty": ""},
+		"flag":   {},
+	}, fields.StructuredData)
+	assert.Equal(t, "Message", fields.Message)
+
+	fields, ok = ParseSyslog(`<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed for lonvick on /dev/pts/8`)
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, &SyslogFields{
+		Priority: 34,
+		Facility: 4,
+		Severity: 2,
+		Time:     "Oct 11 22:14:15",
+		Hostname: "mymachine",
+		AppName:  "su",
+		ProcID:   "123",
+		Message:  "'su root' failed for lonvick on /dev/pts/8",
+	}, fields)
+
+	fields, ok = ParseSyslog(`<189>42: *Mar  1 18:46:11: %SYS-5-CONFIG_I: Configured from console`)
+	assert.Assert(t, ok)
+	assert.Equal(t, 5, fields.Severity)
+	assert.Equal(t, `42: *Mar  1 18:46:11: %SYS-5-CONFIG_I: Configured from console`, fields.Message)
+
+	_, ok = ParseSyslog("This is a test")
+	assert.Assert(t, !ok)
+}
+
+func TestSyslogPatterns(t *testing.T) {
+	patterns := SyslogPatterns{}
+	assert.NilError(t, patterns.Set(`^%{POSINT:sequence}: \*?%{SYSLOGTIMESTAMP:time}: %%{PROG:appName}-%{INT:level}-%{WORD:mnemonic}: %{GREEDYDATA:message}$`))
+	assert.NilError(t, patterns.Set(`^(?P<hostname>\S+) says (?P<message>.*)$`))
+	assert.ErrorContains(t, patterns.Set(`%{UNKNOWN:field}`), "unknown pattern UNKNOWN")
+	assert.ErrorContains(t, patterns.Set(`(?P<broken`), "invalid syslog pattern")
+	assert.Equal(t, 2, len(patterns))
+	SetSyslogPatterns(patterns)
+	defer SetSyslogPatterns(nil)
+
+	fields, ok := ParseSyslog(`<189>42: *Mar  1 18:46:11: %SYS-5-CONFIG_I: Configured from console`)
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, &SyslogFields{
+		Priority: 189,
+		Facility: 23,
+		Severity: 5,
+		Time:     "Mar  1 18:46:11",
+		AppName:  "SYS",
+		Message:  "Configured from console",
+		Fields:   map[string]string{"sequence": "42", "level": "5", "mnemonic": "CONFIG_I"},
+	}, fields)
+
+	fields, ok = ParseSyslog(`<13>router01 says hello`)
+	assert.Assert(t, ok)
+	assert.Equal(t, "router01", fields.Hostname)
+	assert.Equal(t, "hello", fields.Message)
+
+	// The standard headers take precedence, and unmatched messages keep the content after the priority
+	fields, _ = ParseSyslog(`<34>Oct 11 22:14:15 mymachine su: says nothing`)
+	assert.Equal(t, "mymachine", fields.Hostname)
+	assert.Equal(t, "says nothing", fields.Message)
+	fields, _ = ParseSyslog(`<13> unstructured `)
+	assert.Equal(t, "unstructured", fields.Message)
+	assert.Assert(t, fields.Fields == nil)
+}
+
+func TestSyslogMessageJSON(t *testing.T) {
+	dto := &SyslogMessageDTO{
+		Timestamp: "2021-01-01T00:00:00Z",
+		Content:   []byte(base64.StdEncoding.EncodeToString([]byte("<13>Jan  1 00:00:00 host app: \"quoted\" message\n"))),
+	}
+	data, err := json.Marshal(dto)
+	assert.NilError(t, err)
+	result := map[string]interface{}{}
+	assert.NilError(t, json.Unmarshal(data, &result))
+	assert.Equal(t, `"quoted" message`, result["message"])
+	assert.Equal(t, "host", result["hostname"])
+	assert.Equal(t, float64(5), result["severity"])
+	assert.Equal(t, "<13>Jan  1 00:00:00 host app: \"quoted\" message", result["content"])
+}
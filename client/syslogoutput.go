@@ -0,0 +1,225 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// Syslog output formats
+const (
+	SyslogRFC5424 = "rfc5424" // The header is rebuilt based on RFC 5424 (default).
+	SyslogRFC3164 = "rfc3164" // The header is rebuilt based on RFC 3164 (BSD syslog).
+	SyslogRaw     = "raw"     // The messages are sent as received by the Minion.
+)
+
+// Syslog output transports
+const (
+	SyslogUDP = "udp"
+	SyslogTCP = "tcp"
+	SyslogTLS = "tls"
+)
+
+// syslogDefaultPriority is the priority of the messages without one (user.notice).
+const syslogDefaultPriority = 13
+
+// syslogTimeFormat is the RFC 5424 timestamp format, with millisecond precision.
+const syslogTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// SyslogOutput re-emits the decoded Syslog messages to a downstream Syslog server, acting as a Kafka-to-Syslog bridge.
+// The header of each message is rebuilt based on RFC 5424 or RFC 3164 from the fields parsed from the original one, preserving
+// the original priority, timestamp, host name and content; the address of the exporter is used when the message has no host name,
+// and the reception time of the Minion when it has no timestamp. Alternatively, the raw format sends the messages as received.
+// Over TCP and TLS, the messages are framed with octet counting (RFC 6587) with RFC 5424, and delimited by newlines otherwise.
+// The output connects to the server on demand; when the connection fails, the message is reported as a retryable failure,
+// and the next message reconnects. Messages from other parsers are ignored.
+// This is a concurrent safe object.
+type SyslogOutput struct {
+	Address  string    // The address of the Syslog server as host:port.
+	Protocol string    // The transport: udp (default), tcp or tls.
+	Format   string    // The format of the messages: rfc5424 (default), rfc3164 or raw.
+	TLS      TLSConfig // TLS settings to connect to the server with the tls transport (optional).
+
+	mutex     sync.Mutex
+	conn      net.Conn
+	tlsConfig *tls.Config
+}
+
+// syslogLog contains the fields of the decoded Syslog messages used by the output.
+type syslogLog struct {
+	SourceAddress string `json:"sourceAddress"`
+	Messages      []struct {
+		Timestamp string `json:"timestamp"`
+		Content   string `json:"content"`
+	} `json:"messages"`
+}
+
+// Validate Verifies the Syslog output settings, applying defaults when necessary.
+func (out *SyslogOutput) Validate() error {
+	if out.Address == "" {
+		return fmt.Errorf("the Syslog server address is required")
+	}
+	switch out.Protocol {
+	case "":
+		out.Protocol = SyslogUDP
+	case SyslogUDP, SyslogTCP:
+	case SyslogTLS:
+		config := sarama.NewConfig() // Reuses the TLS handling of the Kafka client
+		config.Net.TLS.Enable = true
+		if err := out.TLS.apply(config); err != nil {
+			return fmt.Errorf("invalid TLS settings: %v", err)
+		}
+		out.tlsConfig = ensureTLSConfig(config)
+	default:
+		return fmt.Errorf("invalid protocol %s; expecting %s, %s or %s", out.Protocol, SyslogUDP, SyslogTCP, SyslogTLS)
+	}
+	switch out.Format {
+	case "":
+		out.Format = SyslogRFC5424
+	case SyslogRFC5424, SyslogRFC3164, SyslogRaw:
+	default:
+		return fmt.Errorf("invalid format %s; expecting %s, %s or %s", out.Format, SyslogRFC5424, SyslogRFC3164, SyslogRaw)
+	}
+	return nil
+}
+
+// Name Returns the name of the output.
+func (out *SyslogOutput) Name() string {
+	return "syslog:" + out.Address
+}
+
+// Send Writes the Syslog messages of a decoded message to the server, connecting to it when necessary.
+func (out *SyslogOutput) Send(ctx context.Context, msg DecodedMessage) error {
+	if !isSyslog(msg.Parser) {
+		return nil
+	}
+	log := &syslogLog{}
+	if err := json.Unmarshal(msg.Payload, log); err != nil {
+		return fmt.Errorf("invalid syslog message: %v", err)
+	}
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+	for _, m := range log.Messages {
+		line := out.format(m.Content, m.Timestamp, log.SourceAddress)
+		if out.conn == nil {
+			if err := out.connect(ctx); err != nil {
+				return &OutputError{Err: err, Retryable: true}
+			}
+		}
+		deadline, _ := ctx.Deadline() // No deadline when zero
+		out.conn.SetWriteDeadline(deadline)
+		if _, err := out.conn.Write(out.frame(line)); err != nil {
+			out.disconnect()
+			return &OutputError{Err: fmt.Errorf("cannot write to %s: %v", out.Address, err), Retryable: true}
+		}
+	}
+	return nil
+}
+
+// Close Closes the connection to the server.
+func (out *SyslogOutput) Close() error {
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+	out.disconnect()
+	return nil
+}
+
+// connect Opens the connection to the server.
+func (out *SyslogOutput) connect(ctx context.Context) error {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	var conn net.Conn
+	var err error
+	if out.Protocol == SyslogTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", out.Address, out.tlsConfig)
+	} else {
+		conn, err = dialer.DialContext(ctx, out.Protocol, out.Address)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot connect to %s: %v", out.Address, err)
+	}
+	out.conn = conn
+	defaultLogger.Infof("connected to Syslog server %s through %s", out.Address, out.Protocol)
+	return nil
+}
+
+// disconnect Closes the connection to the server, if any.
+func (out *SyslogOutput) disconnect() {
+	if out.conn != nil {
+		out.conn.Close()
+		out.conn = nil
+	}
+}
+
+// frame Adds the framing of the transport to a message.
+func (out *SyslogOutput) frame(line string) []byte {
+	if out.Protocol == SyslogUDP {
+		return []byte(line)
+	}
+	if out.Format == SyslogRFC5424 {
+		return []byte(strconv.Itoa(len(line)) + " " + line)
+	}
+	return []byte(line + "\n")
+}
+
+// format Builds a Syslog message based on the output format, from the content received by the Minion.
+func (out *SyslogOutput) format(content, received, source string) string {
+	if out.Format == SyslogRaw {
+		return content
+	}
+	fields, ok := ParseSyslog(content)
+	if !ok {
+		fields = &SyslogFields{Priority: syslogDefaultPriority, Message: strings.TrimSpace(content)}
+	}
+	host := fields.Hostname
+	if host == "" {
+		host = source
+	}
+	timestamp := syslogTime(fields.Time, received)
+	if out.Format == SyslogRFC3164 {
+		tag := fields.AppName
+		if tag != "" && fields.ProcID != "" {
+			tag += "[" + fields.ProcID + "]"
+		}
+		if tag != "" {
+			tag += ": "
+		}
+		return fmt.Sprintf("<%d>%s %s %s%s", fields.Priority, timestamp.Format(time.Stamp), syslogValue(host), tag, fields.Message)
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %s %s - %s", fields.Priority, timestamp.Format(syslogTimeFormat),
+		syslogValue(host), syslogValue(fields.AppName), syslogValue(fields.ProcID), syslogValue(fields.MsgID), fields.Message)
+}
+
+// syslogTime Returns the timestamp of a message from its header, supporting the RFC 5424 and RFC 3164 formats,
+// or the reception time of the Minion when the header has no valid timestamp.
+// As RFC 3164 timestamps have no year, the year of the reception time is used.
+func syslogTime(header, received string) time.Time {
+	fallback, err := time.Parse(time.RFC3339Nano, received)
+	if err != nil {
+		fallback = time.Now()
+	}
+	if t, err := time.Parse(time.RFC3339Nano, header); err == nil {
+		return t
+	}
+	if t, err := time.ParseInLocation(time.Stamp, header, fallback.Location()); err == nil {
+		return t.AddDate(fallback.Year(), 0, 0)
+	}
+	return fallback
+}
+
+// syslogValue Returns the RFC 5424 NILVALUE for empty values, and replaces the spaces, which are not allowed on the header fields.
+func syslogValue(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return strings.ReplaceAll(value, " ", "_")
+}
@@ -0,0 +1,78 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestSyslogOutput(t *testing.T) {
+	payload := []byte(`{"sourceAddress":"192.168.75.1","messages":[
+		{"timestamp":"2021-03-26T14:49:27.734-04:00","content":"<190>1 2021-03-26T14:49:27.000-04:00 router01 sshd 9601 LOGIN - Accepted password"},
+		{"timestamp":"2021-03-26T14:49:28.000-04:00","content":"<13>Mar 26 14:49:28 router02 kernel: link down"},
+		{"timestamp":"2021-03-26T14:49:29.000-04:00","content":"no header"}
+	]}`)
+
+	// UDP, rebuilding the header
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer conn.Close()
+	out := &SyslogOutput{Address: conn.LocalAddr().String()}
+	assert.NilError(t, out.Validate())
+	assert.Equal(t, SyslogUDP, out.Protocol)
+	assert.Equal(t, SyslogRFC5424, out.Format)
+	assert.NilError(t, out.Send(context.Background(), DecodedMessage{Parser: "syslog", Payload: payload}))
+	assert.NilError(t, out.Send(context.Background(), DecodedMessage{Parser: "snmp", Payload: []byte("ignored")}))
+	expected := []string{
+		"<190>1 2021-03-26T14:49:27.000-04:00 router01 sshd 9601 LOGIN - Accepted password",
+		"<13>1 2021-03-26T14:49:28.000-04:00 router02 kernel - - - link down",
+		"<13>1 2021-03-26T14:49:29.000-04:00 192.168.75.1 - - - - no header",
+	}
+	buf := make([]byte, 1024)
+	for _, line := range expected {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		assert.NilError(t, err)
+		assert.Equal(t, line, string(buf[:n]))
+	}
+	assert.NilError(t, out.Close())
+
+	// TCP with RFC 3164, delimited by newlines
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer listener.Close()
+	out = &SyslogOutput{Address: listener.Addr().String(), Protocol: SyslogTCP, Format: SyslogRFC3164}
+	assert.NilError(t, out.Validate())
+	assert.NilError(t, out.Send(context.Background(), DecodedMessage{Parser: "syslog", Payload: payload}))
+	server, err := listener.Accept()
+	assert.NilError(t, err)
+	defer server.Close()
+	reader := bufio.NewReader(server)
+	for _, line := range []string{
+		"<190>Mar 26 14:49:27 router01 sshd[9601]: Accepted password\n",
+		"<13>Mar 26 14:49:28 router02 kernel: link down\n",
+		"<13>Mar 26 14:49:29 192.168.75.1 no header\n",
+	} {
+		data, err := reader.ReadString('\n')
+		assert.NilError(t, err)
+		assert.Equal(t, line, data)
+	}
+	assert.NilError(t, out.Close())
+
+	// Octet counting with RFC 5424 over TCP
+	out = &SyslogOutput{Protocol: SyslogTCP, Format: SyslogRFC5424}
+	assert.Equal(t, "5 <13>x", string(out.frame("<13>x")))
+	out.Format = SyslogRaw
+	assert.Equal(t, "<13>x\n", string(out.frame("<13>x")))
+	assert.Equal(t, "no header", out.format("no header", "", "10.0.0.1"))
+
+	assert.ErrorContains(t, (&SyslogOutput{}).Validate(), "required")
+	assert.ErrorContains(t, (&SyslogOutput{Address: "localhost:514", Protocol: "sctp"}).Validate(), "invalid protocol")
+	assert.ErrorContains(t, (&SyslogOutput{Address: "localhost:514", Format: "cef"}).Validate(), "invalid format")
+}
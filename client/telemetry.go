@@ -0,0 +1,26 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/telemetry"
+)
+
+// RawTelemetryDTO represents a telemetry message whose protocol cannot be decoded, like the Cisco NX-OS and Juniper JTI streams,
+// which use vendor-specific protobuf definitions.
+type RawTelemetryDTO struct {
+	Timestamp     uint64 `json:"timestamp"`
+	SourceAddress string `json:"sourceAddress,omitempty"`
+	SourcePort    uint32 `json:"sourcePort,omitempty"`
+	Bytes         []byte `json:"bytes"` // Encoded in base64
+}
+
+// newRawTelemetry Creates the representation of a raw telemetry message.
+func newRawTelemetry(msgLog *telemetry.TelemetryMessageLog, msg *telemetry.TelemetryMessage) *RawTelemetryDTO {
+	return &RawTelemetryDTO{
+		Timestamp:     msg.GetTimestamp(),
+		SourceAddress: msgLog.GetSourceAddress(),
+		SourcePort:    msgLog.GetSourcePort(),
+		Bytes:         msg.GetBytes(),
+	}
+}
@@ -0,0 +1,69 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+
+	"github.com/Shopify/sarama"
+)
+
+// TLSConfig defines the TLS settings to connect to Kafka.
+// It takes precedence over the equivalent settings passed through the parameters.
+type TLSConfig struct {
+	CACert             string // Path to the PEM file with the trusted certificate authorities (optional; defaults to the system pool).
+	Cert               string // Path to the PEM client certificate for mutual TLS (optional).
+	Key                string // Path to the PEM private key of the client certificate.
+	InsecureSkipVerify bool   // Do not verify the broker certificates (for testing only).
+}
+
+// Enabled Returns true when any TLS setting is defined.
+func (t *TLSConfig) Enabled() bool {
+	return t.CACert != "" || t.Cert != "" || t.Key != "" || t.InsecureSkipVerify
+}
+
+// Validate Verifies the TLS settings, including the certificate files.
+func (t *TLSConfig) Validate() error {
+	if (t.Cert == "") != (t.Key == "") {
+		return fmt.Errorf("both TLS client certificate and key are required")
+	}
+	for _, path := range []string{t.CACert, t.Cert, t.Key} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("cannot access %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// apply Updates the Sarama configuration based on the TLS settings.
+func (t *TLSConfig) apply(config *sarama.Config) error {
+	if !t.Enabled() {
+		return nil
+	}
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	config.Net.TLS.Enable = true
+	tlsConfig := ensureTLSConfig(config)
+	if t.CACert != "" {
+		if err := loadCA(config, t.CACert); err != nil {
+			return fmt.Errorf("invalid TLS CA certificate: %v", err)
+		}
+	}
+	if t.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(t.Cert, t.Key)
+		if err != nil {
+			return fmt.Errorf("invalid TLS client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if t.InsecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	return nil
+}
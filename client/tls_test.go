@@ -0,0 +1,68 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"gotest.tools/v3/assert"
+)
+
+// writeCertificate Creates a self-signed certificate and its private key on a temporary directory.
+func writeCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kafka"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NilError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NilError(t, err)
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	assert.NilError(t, ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NilError(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certPath, keyPath
+}
+
+func TestTLSConfig(t *testing.T) {
+	cert, key := writeCertificate(t)
+
+	config := sarama.NewConfig()
+	assert.NilError(t, (&TLSConfig{}).apply(config))
+	assert.Assert(t, !config.Net.TLS.Enable)
+
+	config = sarama.NewConfig()
+	assert.NilError(t, (&TLSConfig{CACert: cert, Cert: cert, Key: key, InsecureSkipVerify: true}).apply(config))
+	assert.Assert(t, config.Net.TLS.Enable)
+	assert.Assert(t, config.Net.TLS.Config.RootCAs != nil)
+	assert.Equal(t, 1, len(config.Net.TLS.Config.Certificates))
+	assert.Assert(t, config.Net.TLS.Config.InsecureSkipVerify)
+
+	assert.ErrorContains(t, (&TLSConfig{Cert: cert}).Validate(), "both")
+	assert.ErrorContains(t, (&TLSConfig{CACert: "/nonexistent.pem"}).Validate(), "cannot access")
+	assert.ErrorContains(t, (&TLSConfig{CACert: key}).apply(sarama.NewConfig()), "invalid TLS CA certificate")
+	assert.ErrorContains(t, (&TLSConfig{Cert: key, Key: cert}).apply(sarama.NewConfig()), "invalid TLS client certificate")
+
+	cli := &KafkaClient{Bootstrap: "localhost:9092", Topic: "test", TLS: TLSConfig{CACert: "/nonexistent.pem"}}
+	assert.ErrorContains(t, cli.Initialize(context.Background()), "invalid TLS settings")
+}
@@ -0,0 +1,155 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// topicContextKey is used to tag the messages with their originating topic.
+type topicContextKey struct{}
+
+// TopicConfig represents a topic and the parser for its messages.
+type TopicConfig struct {
+	Name   string
+	Parser string
+}
+
+// topicParsers maps the standard OpenNMS Sink topic names to their parsers.
+var topicParsers = []struct {
+	pattern string
+	parser  string
+}{
+	{".Sink.Trap", "snmp"},
+	{".Sink.Syslog", "syslog"},
+	{".Sink.Heartbeat", "heartbeat"},
+	{".Sink.Events", "events"},
+	{".Sink.Telemetry-Netflow", "netflow"},
+	{".Sink.Telemetry-IPFIX", "netflow"},
+	{".Sink.Telemetry-SFlow", "sflow"},
+	{".Sink.Telemetry-NXOS", "nxos"},
+	{".Sink.Telemetry-JTI", "jti"},
+}
+
+// inferParser Returns the parser for a standard OpenNMS Sink topic, or an empty string if unknown.
+func inferParser(topic string) string {
+	for _, tp := range topicParsers {
+		if strings.Contains(strings.ToLower(topic), strings.ToLower(tp.pattern)) {
+			return tp.parser
+		}
+	}
+	return ""
+}
+
+// Topics Returns the topics handled by the client.
+// The Topic can be a comma-separated list, where each entry can set its own parser with the format topic:parser.
+// When multiple topics are configured without an explicit parser, it is inferred from the standard OpenNMS topic names,
+// falling back to the client's parser.
+func (cli *KafkaClient) Topics() []TopicConfig {
+	entries := strings.Split(cli.Topic, ",")
+	topics := make([]TopicConfig, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		tc := TopicConfig{Name: entry, Parser: cli.Parser}
+		if idx := strings.LastIndex(entry, ":"); idx > 0 {
+			tc.Name, tc.Parser = entry[:idx], entry[idx+1:]
+		} else if len(entries) > 1 {
+			if parser := inferParser(entry); parser != "" {
+				tc.Parser = parser
+			}
+		}
+		topics = append(topics, tc)
+	}
+	return topics
+}
+
+// topicOf Returns the originating topic of a message.
+func (cli *KafkaClient) topicOf(msg *message.Message) string {
+	if msg != nil {
+		if topic, ok := msg.Context().Value(topicContextKey{}).(string); ok {
+			return topic
+		}
+	}
+	if topics := cli.Topics(); len(topics) > 0 {
+		return topics[0].Name
+	}
+	return cli.Topic
+}
+
+// parserFor Returns the parser for the messages of a given topic.
+func (cli *KafkaClient) parserFor(topic string) string {
+	for _, tc := range cli.Topics() {
+		if tc.Name == topic {
+			return tc.Parser
+		}
+	}
+	return cli.Parser
+}
+
+// validateTopics Verifies the parser of each topic.
+func (cli *KafkaClient) validateTopics() error {
+	for _, tc := range cli.Topics() {
+		if tc.Parser == "" {
+			continue
+		}
+		if err := AvailableParsers.Set(tc.Parser); err != nil {
+			return fmt.Errorf("invalid Sink parser %s for topic %s; expecting %s", tc.Parser, tc.Name, AvailableParsers.EnumAsString())
+		}
+	}
+	return nil
+}
+
+// subscribe Subscribes to all the topics, tagging each message with its originating topic when there is more than one.
+// Once the context is canceled, the pending messages are not forwarded, so they are delivered again after restarting, and the
+// subscriptions are drained until the source closes them; when a subscription fails, the previous ones are canceled.
+func (cli *KafkaClient) subscribe(ctx context.Context) (<-chan *message.Message, error) {
+	topics := cli.Topics()
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("at least one topic is required")
+	}
+	if len(topics) == 1 {
+		channel, err := cli.subscriber.Subscribe(ctx, topics[0].Name)
+		if err != nil {
+			return nil, fmt.Errorf("cannot subscribe to topic %s: %v", topics[0].Name, err)
+		}
+		return channel, nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	out := make(chan *message.Message)
+	wg := &sync.WaitGroup{}
+	for _, tc := range topics {
+		channel, err := cli.subscriber.Subscribe(ctx, tc.Name)
+		if err != nil {
+			cancel() // Stops the forwarders of the previous topics
+			return nil, fmt.Errorf("cannot subscribe to topic %s: %v", tc.Name, err)
+		}
+		wg.Add(1)
+		go func(topic string, channel <-chan *message.Message) {
+			defer wg.Done()
+			for msg := range channel {
+				msg.SetContext(context.WithValue(msg.Context(), topicContextKey{}, topic))
+				select {
+				case out <- msg:
+				case <-ctx.Done():
+					for range channel { // Not acknowledged, so the source doesn't wait for them
+					}
+					return
+				}
+			}
+		}(tc.Name, channel)
+	}
+	go func() {
+		wg.Wait()
+		cancel()
+		close(out)
+	}()
+	return out, nil
+}
@@ -0,0 +1,173 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/rpc"
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/sink"
+	"google.golang.org/protobuf/proto"
+)
+
+// Default tracing settings
+const (
+	DefaultTraceDuration = 10 * time.Minute
+	MaxTraceDuration     = time.Hour
+)
+
+// TraceSession represents an active trace of a message ID.
+type TraceSession struct {
+	ID      string    `json:"id"`
+	Expires time.Time `json:"expires"`
+}
+
+// Tracer logs every processing step of the messages with given IDs for a limited time, for targeted debugging in production:
+// the arrival of each chunk, the reassembly, the filtering decisions, the decoding, the result of the action, and the result of each output.
+// It can be shared by multiple clients.
+// This is a concurrent safe object.
+type Tracer struct {
+	mutex    sync.RWMutex
+	sessions map[string]time.Time
+}
+
+// NewTracer creates a new tracer without active sessions.
+func NewTracer() *Tracer {
+	return &Tracer{sessions: make(map[string]time.Time)}
+}
+
+// Start Traces the messages with a given ID for a period, which is limited to MaxTraceDuration.
+// Starting an active trace extends it.
+func (t *Tracer) Start(id string, duration time.Duration) (TraceSession, error) {
+	if id == "" {
+		return TraceSession{}, fmt.Errorf("the message ID is required")
+	}
+	if duration <= 0 || duration > MaxTraceDuration {
+		return TraceSession{}, fmt.Errorf("invalid duration %s; expecting a value greater than 0 and up to %s", duration, MaxTraceDuration)
+	}
+	session := TraceSession{ID: id, Expires: time.Now().Add(duration)}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.sessions[id] = session.Expires
+	defaultLogger.Infof("tracing message %s until %s", id, session.Expires.Format(time.RFC3339))
+	return session, nil
+}
+
+// Stop Stops tracing the messages with a given ID.
+// Returns false when the ID was not being traced.
+func (t *Tracer) Stop(id string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if _, ok := t.sessions[id]; !ok {
+		return false
+	}
+	delete(t.sessions, id)
+	defaultLogger.Infof("stopped tracing message %s", id)
+	return true
+}
+
+// Sessions Returns the active traces, removing the expired ones.
+func (t *Tracer) Sessions() []TraceSession {
+	now := time.Now()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	sessions := make([]TraceSession, 0, len(t.sessions))
+	for id, expires := range t.sessions {
+		if now.After(expires) {
+			delete(t.sessions, id)
+			continue
+		}
+		sessions = append(sessions, TraceSession{ID: id, Expires: expires})
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].ID < sessions[j].ID
+	})
+	return sessions
+}
+
+// active Returns true when there is at least one trace, expired or not.
+func (t *Tracer) active() bool {
+	if t == nil {
+		return false
+	}
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return len(t.sessions) > 0
+}
+
+// traces Returns true when the messages with a given ID are being traced.
+func (t *Tracer) traces(id string) bool {
+	if t == nil || id == "" {
+		return false
+	}
+	t.mutex.RLock()
+	expires, ok := t.sessions[id]
+	t.mutex.RUnlock()
+	return ok && time.Now().Before(expires)
+}
+
+// Handler Returns the HTTP handler to manage the traces.
+// GET lists the active traces, POST starts tracing the message passed through the id query parameter
+// for the period passed through the duration query parameter (defaults to DefaultTraceDuration), and DELETE stops it.
+func (t *Tracer) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("id")
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			duration := DefaultTraceDuration
+			if value := r.URL.Query().Get("duration"); value != "" {
+				d, err := time.ParseDuration(value)
+				if err != nil {
+					http.Error(w, "invalid duration: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+				duration = d
+			}
+			if _, err := t.Start(id, duration); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		case http.MethodDelete:
+			if !t.Stop(id) {
+				http.Error(w, "message "+id+" is not being traced", http.StatusNotFound)
+				return
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t.Sessions())
+	})
+}
+
+// trace Logs a processing step of a message when its ID is being traced.
+func (cli *KafkaClient) trace(id string, format string, args ...interface{}) {
+	if cli.Tracer.traces(id) {
+		cli.logger().Infof("[trace %s] %s", id, fmt.Sprintf(format, args...))
+	}
+}
+
+// messageID Returns the ID of the IPC message of a chunk, or an empty string when it cannot be parsed.
+// Used to trace the chunks discarded before being fully parsed.
+func (cli *KafkaClient) messageID(msg *message.Message) string {
+	if cli.IPC == "rpc" {
+		rpcMsg := &rpc.RpcMessageProto{}
+		if err := proto.Unmarshal(msg.Payload, rpcMsg); err != nil {
+			return ""
+		}
+		return rpcMsg.RpcId
+	}
+	sinkMsg := &sink.SinkMessage{}
+	if err := proto.Unmarshal(msg.Payload, sinkMsg); err != nil {
+		return ""
+	}
+	return sinkMsg.MessageId
+}
@@ -0,0 +1,98 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestTracer(t *testing.T) {
+	tracer := NewTracer()
+	_, err := tracer.Start("", time.Minute)
+	assert.ErrorContains(t, err, "message ID is required")
+	_, err = tracer.Start("0001", 2*MaxTraceDuration)
+	assert.ErrorContains(t, err, "invalid duration")
+
+	_, err = tracer.Start("0001", time.Minute)
+	assert.NilError(t, err)
+	_, err = tracer.Start("0002", time.Millisecond)
+	assert.NilError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	assert.Assert(t, tracer.traces("0001"))
+	assert.Assert(t, !tracer.traces("0002")) // Expired
+	assert.Assert(t, !tracer.traces("0003"))
+	sessions := tracer.Sessions()
+	assert.Equal(t, 1, len(sessions))
+	assert.Equal(t, "0001", sessions[0].ID)
+	assert.Assert(t, tracer.Stop("0001"))
+	assert.Assert(t, !tracer.Stop("0001"))
+	assert.Assert(t, !tracer.active())
+
+	var nilTracer *Tracer
+	assert.Assert(t, !nilTracer.traces("0001"))
+}
+
+func TestTracerHandler(t *testing.T) {
+	tracer := NewTracer()
+	handler := tracer.Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/trace?id=0001&duration=5m", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	sessions := []TraceSession{}
+	assert.NilError(t, json.NewDecoder(rec.Body).Decode(&sessions))
+	assert.Equal(t, 1, len(sessions))
+	assert.Assert(t, time.Until(sessions[0].Expires) > 4*time.Minute)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/trace?id=0002&duration=2h", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/trace?id=0002", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/trace?id=0001", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "[]\n", rec.Body.String())
+}
+
+func TestTraceMessage(t *testing.T) {
+	cli, _, cancel := createKafkaClient()
+	defer cancel()
+	out := &bytes.Buffer{}
+	cli.Logger = NewLogger(out, LevelInfo, false)
+	cli.Parser = "heartbeat"
+	cli.Tracer = NewTracer()
+	cli.Outputs = []Output{&countingOutput{name: "forward:traps"}, &countingOutput{name: "webhook:alerts"}}
+	cli.OutputRoutes = OutputRoutes{"webhook": HeaderRules{{Key: "tenant", Value: "acme"}}}
+	_, err := cli.Tracer.Start("0001", time.Minute)
+	assert.NilError(t, err)
+	handler := func(msg DecodedMessage) error { return nil }
+
+	cli.handleMessage(buildMessage("0001", 0, 2, []byte("ABC")), handler)
+	cli.handleMessage(buildMessage("0002", 0, 1, []byte("ABC")), handler)
+	cli.handleMessage(buildMessage("0001", 1, 2, []byte("DEF")), handler)
+
+	logs := out.String()
+	assert.Assert(t, !strings.Contains(logs, "[trace 0002]"), logs)
+	for _, step := range []string{
+		"chunk 1 of 2 received",
+		"chunk 1 of 2 buffered, 3 bytes received so far",
+		"chunk 2 of 2 received",
+		"message reassembled from 2 chunks with 6 bytes",
+		"decoded heartbeat message 1",
+		"decoded message 1 processed by the action",
+		"sent to forward:traps",
+		"not routed to webhook:alerts",
+	} {
+		assert.Assert(t, strings.Contains(logs, "[trace 0001] "+step), "missing %s in %s", step, logs)
+	}
+}
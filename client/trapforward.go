@@ -0,0 +1,372 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Well-known OIDs used to build the SNMPv2 traps
+const (
+	oidSysUpTime       = "1.3.6.1.2.1.1.3.0"
+	oidSnmpTrapOID     = "1.3.6.1.6.3.1.1.4.1.0"
+	oidSnmpTrapAddress = "1.3.6.1.6.3.18.1.3.0"
+	oidSnmpTraps       = "1.3.6.1.6.3.1.1.5"
+)
+
+// BER tags of the SNMP messages
+const (
+	berSequence byte = 0x30
+	berTrapV1   byte = 0xa4
+	berTrapV2   byte = 0xa7
+)
+
+// DefaultTrapPort is the default port of the trap destinations.
+const DefaultTrapPort = "162"
+
+// TrapForwardOutput rebuilds the decoded SNMP traps as SNMP trap PDUs, and sends them to one or more trap destinations,
+// to mirror the traps to a legacy NMS. The SNMPv1 traps are sent as SNMPv1 traps with the original enterprise, agent address,
+// generic and specific types, and time stamp; the other traps are sent as SNMPv2c traps, with the sysUpTime and snmpTrapOID
+// rebuilt from the time stamp and the trap identity (following RFC 3584), and the snmpTrapAddress with the agent address when missing,
+// as the destinations see the receiver as the source. The varbind values are rebuilt from the decoded values, so binary
+// octet strings must be formatted as hexadecimal, as the parser does. Optionally, the raw PDU is sent as is when OpenNMS includes it.
+// Messages from other parsers are ignored.
+// This is a concurrent safe object.
+type TrapForwardOutput struct {
+	Destinations []string // The trap destinations as host[:port] (the port defaults to DefaultTrapPort).
+	Community    string   // The community of the forwarded traps (defaults to the original community, or public).
+	Raw          bool     // Send the raw PDU as is when it is included in the trap, which preserves the original community and SNMPv3 traps.
+
+	mutex     sync.Mutex
+	conn      net.PacketConn
+	addresses []*net.UDPAddr
+	requestID int32
+}
+
+// forwardedTrapLog contains the fields of the decoded SNMP traps used by the output.
+type forwardedTrapLog struct {
+	Messages []struct {
+		AgentAddress string           `json:"agentAddress"`
+		Community    string           `json:"community"`
+		Version      string           `json:"version"`
+		Timestamp    int64            `json:"timestamp"`
+		RawMessage   []byte           `json:"rawMessage"`
+		TrapIdentity *TrapIdentityDTO `json:"trapIdentity"`
+		Results      *struct {
+			Varbinds []struct {
+				Base     string `json:"base"`
+				Instance string `json:"instance"`
+				Value    struct {
+					Type  int    `json:"type"`
+					Value string `json:"value"`
+				} `json:"value"`
+			} `json:"varbinds"`
+		} `json:"results"`
+	} `json:"messages"`
+}
+
+// Validate Verifies the trap forward output settings, resolving the destinations, and opens the socket.
+func (out *TrapForwardOutput) Validate() error {
+	if len(out.Destinations) == 0 {
+		return fmt.Errorf("at least one trap destination is required")
+	}
+	addresses := make([]*net.UDPAddr, 0, len(out.Destinations))
+	for _, dest := range out.Destinations {
+		if _, _, err := net.SplitHostPort(dest); err != nil {
+			dest = net.JoinHostPort(dest, DefaultTrapPort)
+		}
+		addr, err := net.ResolveUDPAddr("udp", dest)
+		if err != nil {
+			return fmt.Errorf("invalid trap destination %s: %v", dest, err)
+		}
+		addresses = append(addresses, addr)
+	}
+	out.addresses = addresses
+	if out.conn == nil {
+		conn, err := net.ListenPacket("udp", ":0")
+		if err != nil {
+			return fmt.Errorf("cannot open socket: %v", err)
+		}
+		out.conn = conn
+	}
+	return nil
+}
+
+// Name Returns the name of the output.
+func (out *TrapForwardOutput) Name() string {
+	return "traps:" + strings.Join(out.Destinations, ",")
+}
+
+// Send Rebuilds the SNMP traps of a decoded message, and sends them to every destination.
+// A trap that cannot be rebuilt is a permanent failure, while a failure to send it is retryable.
+func (out *TrapForwardOutput) Send(ctx context.Context, msg DecodedMessage) error {
+	if !isSnmp(msg.Parser) {
+		return nil
+	}
+	log := &forwardedTrapLog{}
+	if err := json.Unmarshal(msg.Payload, log); err != nil {
+		return fmt.Errorf("invalid snmp trap: %v", err)
+	}
+	for i := range log.Messages {
+		pdu, err := out.encode(log, i)
+		if err != nil {
+			return fmt.Errorf("cannot rebuild trap from %s: %v", log.Messages[i].AgentAddress, err)
+		}
+		out.mutex.Lock()
+		for _, addr := range out.addresses {
+			if _, err = out.conn.WriteTo(pdu, addr); err != nil {
+				break
+			}
+		}
+		out.mutex.Unlock()
+		if err != nil {
+			return &OutputError{Err: fmt.Errorf("cannot send trap: %v", err), Retryable: true}
+		}
+	}
+	return nil
+}
+
+// Close Closes the socket.
+func (out *TrapForwardOutput) Close() error {
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+	if out.conn == nil {
+		return nil
+	}
+	err := out.conn.Close()
+	out.conn = nil
+	return err
+}
+
+// encode Builds the SNMP message of a trap.
+func (out *TrapForwardOutput) encode(log *forwardedTrapLog, idx int) ([]byte, error) {
+	trap := log.Messages[idx]
+	if out.Raw && len(trap.RawMessage) > 0 {
+		return trap.RawMessage, nil
+	}
+	if trap.TrapIdentity == nil {
+		return nil, fmt.Errorf("missing trap identity")
+	}
+	community := out.Community
+	if community == "" {
+		community = trap.Community
+	}
+	if community == "" {
+		community = "public"
+	}
+	var varbinds []byte
+	hasTrapAddress := false
+	if trap.Results != nil {
+		for _, vb := range trap.Results.Varbinds {
+			oid := vb.Base
+			if vb.Instance != "" {
+				oid += "." + vb.Instance
+			}
+			if strings.TrimPrefix(oid, ".") == oidSnmpTrapAddress {
+				hasTrapAddress = true
+			}
+			value, err := berValue(vb.Value.Type, vb.Value.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value of %s: %v", oid, err)
+			}
+			varbind, err := berVarbind(oid, value)
+			if err != nil {
+				return nil, err
+			}
+			varbinds = append(varbinds, varbind...)
+		}
+	}
+	enterprise, err := berOID(trap.TrapIdentity.EnterpriseID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid enterprise: %v", err)
+	}
+	agent := net.ParseIP(trap.AgentAddress).To4()
+	var version int64
+	var pdu []byte
+	if trap.Version == "v1" {
+		if agent == nil {
+			agent = net.IPv4zero.To4()
+		}
+		pdu = berTLV(berTrapV1, concat(
+			enterprise,
+			berTLV(snmpIPAddress, agent),
+			berInteger(snmpInteger, int64(trap.TrapIdentity.Generic)),
+			berInteger(snmpInteger, int64(trap.TrapIdentity.Specific)),
+			berInteger(snmpTimeTicks, trap.Timestamp),
+			berTLV(berSequence, varbinds),
+		))
+	} else {
+		version = 1
+		trapOID := strings.TrimPrefix(trap.TrapIdentity.EnterpriseID, ".") + ".0." + strconv.Itoa(trap.TrapIdentity.Specific)
+		if trap.TrapIdentity.Generic < 6 {
+			trapOID = oidSnmpTraps + "." + strconv.Itoa(trap.TrapIdentity.Generic+1)
+		}
+		oid, err := berOID(trapOID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trap OID: %v", err)
+		}
+		uptime, _ := berVarbind(oidSysUpTime, berInteger(snmpTimeTicks, trap.Timestamp))
+		trapID, _ := berVarbind(oidSnmpTrapOID, oid)
+		header := concat(uptime, trapID)
+		if !hasTrapAddress && agent != nil {
+			address, _ := berVarbind(oidSnmpTrapAddress, berTLV(snmpIPAddress, agent))
+			varbinds = append(varbinds, address...)
+		}
+		pdu = berTLV(berTrapV2, concat(
+			berInteger(snmpInteger, int64(atomic.AddInt32(&out.requestID, 1))),
+			berInteger(snmpInteger, 0),
+			berInteger(snmpInteger, 0),
+			berTLV(berSequence, concat(header, varbinds)),
+		))
+	}
+	return berTLV(berSequence, concat(
+		berInteger(snmpInteger, version),
+		berTLV(snmpOctetString, []byte(community)),
+		pdu,
+	)), nil
+}
+
+// berValue Encodes a decoded varbind value based on its SNMP type.
+func berValue(snmpType int, value string) ([]byte, error) {
+	switch snmpType {
+	case snmpInteger:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return berInteger(snmpInteger, n), nil
+	case snmpCounter32, snmpGauge32, snmpTimeTicks, snmpCounter64:
+		n, ok := new(big.Int).SetString(value, 10)
+		if !ok || n.Sign() < 0 {
+			return nil, fmt.Errorf("invalid unsigned value %s", value)
+		}
+		return berUnsigned(byte(snmpType), n), nil
+	case snmpOctetString:
+		if data, ok := hexValue(value); ok {
+			return berTLV(snmpOctetString, data), nil
+		}
+		return berTLV(snmpOctetString, []byte(value)), nil
+	case snmpOpaque:
+		data, ok := hexValue(value)
+		if !ok {
+			return nil, fmt.Errorf("invalid opaque value %s", value)
+		}
+		return berTLV(snmpOpaque, data), nil
+	case snmpObjectID:
+		return berOID(value)
+	case snmpIPAddress:
+		ip := net.ParseIP(value).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IPv4 address %s", value)
+		}
+		return berTLV(snmpIPAddress, ip), nil
+	case snmpNull, snmpNoSuchObject, snmpNoSuchInstance, snmpEndOfMibView:
+		return berTLV(byte(snmpType), nil), nil
+	default:
+		return nil, fmt.Errorf("unsupported type %d", snmpType)
+	}
+}
+
+// hexValue Decodes a value formatted as hexadecimal with the 0x prefix.
+func hexValue(value string) ([]byte, bool) {
+	if !strings.HasPrefix(value, "0x") {
+		return nil, false
+	}
+	data, err := hex.DecodeString(value[2:])
+	return data, err == nil
+}
+
+// berVarbind Encodes a varbind with an encoded value.
+func berVarbind(oid string, value []byte) ([]byte, error) {
+	name, err := berOID(oid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OID %s: %v", oid, err)
+	}
+	return berTLV(berSequence, concat(name, value)), nil
+}
+
+// berTLV Encodes a value with its tag and length.
+func berTLV(tag byte, value []byte) []byte {
+	var length []byte
+	switch n := len(value); {
+	case n < 0x80:
+		length = []byte{byte(n)}
+	case n <= 0xff:
+		length = []byte{0x81, byte(n)}
+	case n <= 0xffff:
+		length = []byte{0x82, byte(n >> 8), byte(n)}
+	default:
+		length = []byte{0x84, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}
+	}
+	return concat([]byte{tag}, length, value)
+}
+
+// berInteger Encodes a signed integer in two's complement with the minimum number of bytes.
+func berInteger(tag byte, n int64) []byte {
+	data := []byte{byte(n)}
+	for n > 127 || n < -128 {
+		n >>= 8
+		data = append([]byte{byte(n)}, data...)
+	}
+	return berTLV(tag, data)
+}
+
+// berUnsigned Encodes an unsigned integer, adding a leading zero when the most significant bit is set.
+func berUnsigned(tag byte, n *big.Int) []byte {
+	data := n.Bytes()
+	if len(data) == 0 || data[0]&0x80 != 0 {
+		data = append([]byte{0}, data...)
+	}
+	return berTLV(tag, data)
+}
+
+// berOID Encodes an object identifier in dotted notation, with or without the leading dot.
+func berOID(oid string) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(oid, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID %s", oid)
+	}
+	ids := make([]uint64, len(parts))
+	for i, part := range parts {
+		id, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %s", oid)
+		}
+		ids[i] = id
+	}
+	if ids[0] > 2 || (ids[0] < 2 && ids[1] > 39) {
+		return nil, fmt.Errorf("invalid OID %s", oid)
+	}
+	data := base128(ids[0]*40 + ids[1])
+	for _, id := range ids[2:] {
+		data = append(data, base128(id)...)
+	}
+	return berTLV(snmpObjectID, data), nil
+}
+
+// base128 Encodes a sub-identifier of an OID in base 128, with the most significant bit set on all the bytes but the last.
+func base128(n uint64) []byte {
+	data := []byte{byte(n & 0x7f)}
+	for n >>= 7; n > 0; n >>= 7 {
+		data = append([]byte{byte(n&0x7f) | 0x80}, data...)
+	}
+	return data
+}
+
+// concat Joins byte slices.
+func concat(parts ...[]byte) []byte {
+	var data []byte
+	for _, part := range parts {
+		data = append(data, part...)
+	}
+	return data
+}
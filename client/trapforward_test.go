@@ -0,0 +1,86 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestTrapForwardOutput(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer conn.Close()
+	out := &TrapForwardOutput{Destinations: []string{conn.LocalAddr().String()}}
+	assert.NilError(t, out.Validate())
+	defer out.Close()
+
+	// SNMPv1
+	v1 := []byte(`{"messages":[{"agentAddress":"10.0.0.1","community":"public","version":"v1","timestamp":100,
+		"trapIdentity":{"enterpriseID":".1.3.6.1.4.1.9","generic":6,"specific":2},
+		"results":{"varbinds":[{"base":".1.3.6.1.2.1.1.5","instance":"0","value":{"type":4,"value":"r1"}}]}}]}`)
+	assert.NilError(t, out.Send(context.Background(), DecodedMessage{Parser: "snmp", Payload: v1}))
+	buf := make([]byte, 1500)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.NilError(t, err)
+	expected := "3036" + "020100" + "0406" + hex.EncodeToString([]byte("public")) +
+		"a429" + "06062b0601040109" + "40040a000001" + "020106" + "020102" + "430164" +
+		"3010" + "300e" + "06082b06010201010500" + "04027231"
+	assert.Equal(t, expected, hex.EncodeToString(buf[:n]))
+
+	// SNMPv2c, with the sysUpTime, snmpTrapOID and snmpTrapAddress, and the community override
+	out.Community = "mirror"
+	v2 := []byte(`{"messages":[{"agentAddress":"10.0.0.1","community":"public","version":"v2","timestamp":22318014,
+		"trapIdentity":{"enterpriseID":".1.3.6.1.4.1.9.9.171.2","generic":6,"specific":2},
+		"results":{"varbinds":[
+			{"base":".1.3.6.1.4.1.9.9.171.1.2.2.1.6","value":{"type":4,"value":"0xd047b002"}},
+			{"base":".1.3.6.1.4.1.9.9.171.1.2.3.1.16","value":{"type":2,"value":"-10"}},
+			{"base":".1.3.6.1.4.1.9.9.171.1.2.3.1.17","value":{"type":65,"value":"4294967295"}}
+		]}}]}`)
+	assert.NilError(t, out.Send(context.Background(), DecodedMessage{Parser: "snmp", Payload: v2}))
+	n, _, err = conn.ReadFrom(buf)
+	assert.NilError(t, err)
+	pdu := buf[:n]
+	assert.Assert(t, bytes.Contains(pdu, []byte("\x02\x01\x01\x04\x06mirror\xa7")))
+	assert.Assert(t, bytes.Contains(pdu, concat(mustOID(t, oidSysUpTime), berInteger(snmpTimeTicks, 22318014))))
+	assert.Assert(t, bytes.Contains(pdu, concat(mustOID(t, oidSnmpTrapOID), mustOID(t, "1.3.6.1.4.1.9.9.171.2.0.2"))))
+	assert.Assert(t, bytes.Contains(pdu, concat(mustOID(t, oidSnmpTrapAddress), []byte{0x40, 4, 10, 0, 0, 1})))
+	assert.Assert(t, bytes.Contains(pdu, []byte{0x04, 0x04, 0xd0, 0x47, 0xb0, 0x02}))
+	assert.Assert(t, bytes.Contains(pdu, []byte{0x02, 0x01, 0xf6}))
+	assert.Assert(t, bytes.Contains(pdu, []byte{0x41, 0x05, 0x00, 0xff, 0xff, 0xff, 0xff}))
+
+	// Raw PDU and other parsers
+	out.Raw = true
+	raw := []byte(`{"messages":[{"version":"v3","rawMessage":"AQID"}]}`)
+	assert.NilError(t, out.Send(context.Background(), DecodedMessage{Parser: "snmp", Payload: raw}))
+	n, _, err = conn.ReadFrom(buf)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []byte{1, 2, 3}, buf[:n])
+	assert.NilError(t, out.Send(context.Background(), DecodedMessage{Parser: "syslog", Payload: []byte("ignored")}))
+
+	assert.ErrorContains(t, out.Send(context.Background(), DecodedMessage{Parser: "snmp", Payload: []byte(`{"messages":[{"version":"v2"}]}`)}), "missing trap identity")
+	assert.ErrorContains(t, (&TrapForwardOutput{}).Validate(), "at least one")
+}
+
+func TestBEREncoding(t *testing.T) {
+	assert.Equal(t, "0201ff", hex.EncodeToString(berInteger(snmpInteger, -1)))
+	assert.Equal(t, "02020080", hex.EncodeToString(berInteger(snmpInteger, 128)))
+	assert.Equal(t, "0603550403", hex.EncodeToString(mustOID(t, "2.5.4.3")))
+	assert.Equal(t, "06072b0601048fc77f", hex.EncodeToString(mustOID(t, ".1.3.6.1.4.254975")))
+	assert.Equal(t, "0481c8", hex.EncodeToString(berTLV(snmpOctetString, make([]byte, 200))[:3]))
+	_, err := berOID("1")
+	assert.ErrorContains(t, err, "invalid OID")
+}
+
+func mustOID(t *testing.T, oid string) []byte {
+	data, err := berOID(oid)
+	assert.NilError(t, err)
+	return data
+}
@@ -0,0 +1,169 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// otherLabel is used for the series that exceed the cardinality cap.
+const otherLabel = "other"
+
+// trapKey identifies a trap type.
+type trapKey struct {
+	Enterprise string
+	Generic    int
+	Specific   int
+}
+
+// trapStatsBuckets is the number of slots used to track the rolling counts.
+const trapStatsBuckets = 60
+
+// trapEntry tracks the counts of a given trap type.
+type trapEntry struct {
+	slots    [trapStatsBuckets]rollingBucket
+	total    int64
+	lastSeen time.Time
+}
+
+// TrapStat represents the statistics of a given trap type.
+type TrapStat struct {
+	EnterpriseID string    `json:"enterpriseId"`
+	Generic      int       `json:"generic"`
+	Specific     int       `json:"specific"`
+	Count        int64     `json:"count"` // Within the rolling window.
+	Total        int64     `json:"total"` // Since the application started.
+	LastSeen     time.Time `json:"lastSeen"`
+}
+
+// TrapStats maintains rolling counts of SNMP traps by enterprise OID, generic and specific type.
+// To cap the cardinality, only the first MaxSeries trap types are tracked individually, and the rest are aggregated as "other".
+// This is a concurrent safe object.
+type TrapStats struct {
+	Window    time.Duration // The size of the rolling window.
+	MaxSeries int           // The maximum number of trap types tracked individually.
+
+	mutex   sync.Mutex
+	entries map[trapKey]*trapEntry
+	counter *prometheus.CounterVec
+}
+
+// NewTrapStats creates a new trap statistics tracker, and registers its metric.
+func NewTrapStats(window time.Duration, maxSeries int) *TrapStats {
+	if window < time.Minute {
+		window = time.Minute
+	}
+	return &TrapStats{
+		Window:    window,
+		MaxSeries: maxSeries,
+		entries:   make(map[trapKey]*trapEntry),
+		counter: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "onms_ipc_traps_total",
+			Help: "The total number of SNMP traps by enterprise OID, generic and specific type",
+		}, []string{"enterprise", "generic", "specific"}),
+	}
+}
+
+// slot Returns the rolling slot for a given time.
+func (s *TrapStats) slot(ts time.Time) int64 {
+	return ts.UnixNano() / int64(s.Window/trapStatsBuckets)
+}
+
+// Record Tracks all the traps from a trap log.
+func (s *TrapStats) Record(log *TrapLogDTO) {
+	now := time.Now()
+	for _, trap := range log.Messages {
+		if trap.TrapIdentity == nil {
+			continue
+		}
+		s.record(trapKey{trap.TrapIdentity.EnterpriseID, trap.TrapIdentity.Generic, trap.TrapIdentity.Specific}, now)
+	}
+}
+
+func (s *TrapStats) record(key trapKey, now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		if s.MaxSeries > 0 && len(s.entries) >= s.MaxSeries {
+			key = trapKey{Enterprise: otherLabel, Generic: -1, Specific: -1}
+			entry = s.entries[key]
+		}
+		if entry == nil {
+			entry = &trapEntry{}
+			s.entries[key] = entry
+		}
+	}
+	slot := s.slot(now)
+	bucket := &entry.slots[slot%trapStatsBuckets]
+	if bucket.slot != slot {
+		*bucket = rollingBucket{slot: slot}
+	}
+	bucket.total++
+	entry.total++
+	entry.lastSeen = now
+	if key.Enterprise == otherLabel {
+		s.counter.WithLabelValues(otherLabel, otherLabel, otherLabel).Inc()
+	} else {
+		s.counter.WithLabelValues(key.Enterprise, strconv.Itoa(key.Generic), strconv.Itoa(key.Specific)).Inc()
+	}
+}
+
+// Top Returns the statistics of the trap types, sorted by the count within the rolling window.
+// Returns all of them when limit is zero.
+func (s *TrapStats) Top(limit int) []TrapStat {
+	now := time.Now()
+	current := s.slot(now)
+	s.mutex.Lock()
+	stats := make([]TrapStat, 0, len(s.entries))
+	for key, entry := range s.entries {
+		stat := TrapStat{
+			EnterpriseID: key.Enterprise,
+			Generic:      key.Generic,
+			Specific:     key.Specific,
+			Total:        entry.total,
+			LastSeen:     entry.lastSeen,
+		}
+		for _, bucket := range entry.slots {
+			if bucket.slot > current-trapStatsBuckets && bucket.slot <= current {
+				stat.Count += bucket.total
+			}
+		}
+		stats = append(stats, stat)
+	}
+	s.mutex.Unlock()
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Count == stats[j].Count {
+			if stats[i].Total == stats[j].Total {
+				return stats[i].EnterpriseID < stats[j].EnterpriseID
+			}
+			return stats[i].Total > stats[j].Total
+		}
+		return stats[i].Count > stats[j].Count
+	})
+	if limit > 0 && len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats
+}
+
+// Handler Returns an HTTP handler that exposes the trap statistics in JSON.
+// Accepts an optional limit query parameter.
+func (s *TrapStats) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"window": s.Window.String(),
+			"traps":  s.Top(limit),
+		})
+	})
+}
@@ -0,0 +1,32 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestTrapStats(t *testing.T) {
+	stats := NewTrapStats(time.Hour, 2)
+	newLog := func(oids ...string) *TrapLogDTO {
+		log := &TrapLogDTO{}
+		for _, oid := range oids {
+			log.Messages = append(log.Messages, TrapDTO{TrapIdentity: &TrapIdentityDTO{EnterpriseID: oid, Generic: 6, Specific: 1}})
+		}
+		return log
+	}
+	stats.Record(newLog(".1.3.6.1.4.1.9", ".1.3.6.1.4.1.9", ".1.3.6.1.4.1.9"))
+	stats.Record(newLog(".1.3.6.1.4.1.2636", ".1.3.6.1.4.1.2636"))
+	stats.Record(newLog(".1.3.6.1.4.1.674", ".1.3.6.1.4.1.11")) // Exceed the cap
+
+	top := stats.Top(0)
+	assert.Equal(t, 3, len(top))
+	assert.Equal(t, ".1.3.6.1.4.1.9", top[0].EnterpriseID)
+	assert.Equal(t, int64(3), top[0].Count)
+	assert.Equal(t, otherLabel, top[2].EnterpriseID)
+	assert.Equal(t, int64(2), top[2].Count)
+	assert.Equal(t, 1, len(stats.Top(1)))
+}
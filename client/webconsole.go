@@ -0,0 +1,93 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	_ "embed" // For the page of the web console
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed webconsole/index.html
+var webConsolePage []byte
+
+// parserCounter tracks the messages decoded by a parser.
+type parserCounter struct {
+	Parser   string    `json:"parser"`
+	Messages int64     `json:"messages"`
+	Bytes    int64     `json:"bytes"` // The size of the decoded payloads.
+	Last     time.Time `json:"last"`  // When the last message was received.
+}
+
+// WebConsole is an output that counts the decoded messages by parser, and serves a single page to troubleshoot the pipelines from a browser.
+// The page shows the live messages through the LiveTail WebSocket endpoint on /stream, with the filters it supports,
+// and the state, lag and partial messages of each pipeline, with the controls to pause and resume them, through the AdminAPI on /api/v1/.
+// This is a concurrent safe object.
+type WebConsole struct {
+	mutex    sync.Mutex
+	counters map[string]*parserCounter
+}
+
+// NewWebConsole creates a new web console.
+func NewWebConsole() *WebConsole {
+	return &WebConsole{counters: make(map[string]*parserCounter)}
+}
+
+// Name Returns the name of the output.
+func (wc *WebConsole) Name() string {
+	return "webconsole"
+}
+
+// Send Counts a decoded message; it never fails.
+func (wc *WebConsole) Send(ctx context.Context, msg DecodedMessage) error {
+	wc.mutex.Lock()
+	defer wc.mutex.Unlock()
+	counter, ok := wc.counters[msg.Parser]
+	if !ok {
+		counter = &parserCounter{Parser: msg.Parser}
+		wc.counters[msg.Parser] = counter
+	}
+	counter.Messages++
+	counter.Bytes += int64(len(msg.Payload))
+	counter.Last = msg.Received
+	return nil
+}
+
+// parserCounters Returns the counters sorted by parser.
+func (wc *WebConsole) parserCounters() []parserCounter {
+	wc.mutex.Lock()
+	defer wc.mutex.Unlock()
+	counters := make([]parserCounter, 0, len(wc.counters))
+	for _, counter := range wc.counters {
+		counters = append(counters, *counter)
+	}
+	sort.Slice(counters, func(i, j int) bool {
+		return counters[i].Parser < counters[j].Parser
+	})
+	return counters
+}
+
+// Handler Returns the HTTP handler of the console, to be served under a path ending with a slash (i.e. /ui/).
+// The counters are served as JSON under counters, relative to that path; any other path returns the page.
+func (wc *WebConsole) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/counters") {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"parsers": wc.parserCounters(),
+			})
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(webConsolePage)
+	})
+}
@@ -0,0 +1,46 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestWebConsole(t *testing.T) {
+	wc := NewWebConsole()
+	now := time.Now()
+	assert.NilError(t, wc.Send(context.Background(), DecodedMessage{Parser: "snmp", Payload: []byte("ABC"), Received: now}))
+	assert.NilError(t, wc.Send(context.Background(), DecodedMessage{Parser: "snmp", Payload: []byte("DEFG"), Received: now}))
+	assert.NilError(t, wc.Send(context.Background(), DecodedMessage{Parser: "heartbeat", Payload: []byte("{}"), Received: now}))
+	handler := wc.Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/counters", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var counters struct {
+		Parsers []parserCounter `json:"parsers"`
+	}
+	assert.NilError(t, json.NewDecoder(rec.Body).Decode(&counters))
+	assert.Equal(t, 2, len(counters.Parsers))
+	assert.Equal(t, "heartbeat", counters.Parsers[0].Parser)
+	assert.Equal(t, int64(2), counters.Parsers[1].Messages)
+	assert.Equal(t, int64(7), counters.Parsers[1].Bytes)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Assert(t, strings.Contains(rec.Body.String(), "/api/v1/status"))
+	assert.Assert(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html"))
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/ui/", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,174 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Default webhook output settings
+const (
+	DefaultWebhookTimeout     = 10 * time.Second
+	DefaultWebhookConcurrency = 4
+	DefaultWebhookMaxRetries  = 3
+	DefaultWebhookRetryDelay  = time.Second
+)
+
+// webhookMessages tracks the final result of the messages posted to the webhooks.
+var webhookMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "onms_ipc_webhook_messages_total",
+	Help: "The total number of messages posted to a webhook by destination and result (success or failure), after the retries",
+}, []string{"destination", "result"})
+
+// WebhookOutput posts each decoded message as JSON to an HTTP endpoint, for instance a serverless function.
+// The body is the same envelope used by the ForwardOutput with the json format.
+// Messages are queued and posted from the background by a limited number of concurrent requests; when the queue is full,
+// Send blocks until there is room or the context expires, which slows down the consumer instead of losing messages.
+type WebhookOutput struct {
+	URL         string        // The HTTP endpoint.
+	Headers     Properties    // Additional HTTP headers as key=value, i.e. Authorization=env:WEBHOOK_TOKEN; accepts secret references (see ResolveSecret).
+	Timeout     time.Duration // The timeout of each request (defaults to DefaultWebhookTimeout).
+	Concurrency int           // The maximum number of concurrent requests (defaults to DefaultWebhookConcurrency).
+	MaxRetries  int           // How many times a retryable failure is retried (defaults to DefaultWebhookMaxRetries).
+	RetryDelay  time.Duration // The delay before the first retry, doubled on each attempt (defaults to DefaultWebhookRetryDelay).
+	QueueSize   int           // The maximum number of queued messages (defaults to 10 times the concurrency).
+	Client      *http.Client  `json:"-"` // The HTTP client (optional; the timeout is ignored when provided).
+
+	queue chan DecodedMessage
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// Validate Verifies the webhook output settings, applying defaults when necessary, and starts the background senders.
+func (out *WebhookOutput) Validate() error {
+	if out.URL == "" {
+		return fmt.Errorf("the webhook URL is required")
+	}
+	if _, err := out.headers(); err != nil {
+		return err
+	}
+	if out.Timeout <= 0 {
+		out.Timeout = DefaultWebhookTimeout
+	}
+	if out.Concurrency <= 0 {
+		out.Concurrency = DefaultWebhookConcurrency
+	}
+	if out.MaxRetries <= 0 {
+		out.MaxRetries = DefaultWebhookMaxRetries
+	}
+	if out.RetryDelay <= 0 {
+		out.RetryDelay = DefaultWebhookRetryDelay
+	}
+	if out.QueueSize <= 0 {
+		out.QueueSize = 10 * out.Concurrency
+	}
+	if out.Client == nil {
+		out.Client = &http.Client{Timeout: out.Timeout}
+	}
+	if out.queue == nil {
+		out.queue = make(chan DecodedMessage, out.QueueSize)
+		out.stop = make(chan struct{})
+		out.wg.Add(out.Concurrency)
+		for i := 0; i < out.Concurrency; i++ {
+			go out.run()
+		}
+	}
+	return nil
+}
+
+// Name Returns the name of the output.
+func (out *WebhookOutput) Name() string {
+	return "webhook:" + out.URL
+}
+
+// Send Queues a decoded message to be posted to the webhook.
+// The result of the request is reported asynchronously, so only the failures to queue the message are returned.
+func (out *WebhookOutput) Send(ctx context.Context, msg DecodedMessage) error {
+	select {
+	case out.queue <- msg:
+		return nil
+	case <-ctx.Done():
+		return &OutputError{Err: fmt.Errorf("cannot queue message: %v", ctx.Err()), Retryable: true}
+	}
+}
+
+// Close Stops the background senders, after posting the queued messages.
+func (out *WebhookOutput) Close() error {
+	if out.stop != nil {
+		close(out.stop)
+		out.wg.Wait()
+		out.stop = nil
+	}
+	return nil
+}
+
+// headers Returns the HTTP headers, resolving the secret references.
+func (out *WebhookOutput) headers() (map[string]string, error) {
+	headers := make(map[string]string, len(out.Headers))
+	for key, ref := range out.Headers {
+		value, err := ResolveSecret(ref)
+		if err != nil {
+			return nil, fmt.Errorf("invalid header %s: %v", key, err)
+		}
+		headers[key] = value
+	}
+	return headers, nil
+}
+
+// run Posts the queued messages, until the output is closed.
+func (out *WebhookOutput) run() {
+	defer out.wg.Done()
+	for {
+		select {
+		case msg := <-out.queue:
+			out.post(msg)
+		case <-out.stop:
+			for {
+				select {
+				case msg := <-out.queue:
+					out.post(msg)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// post Sends a message to the webhook.
+// Retryable failures are retried with an exponential backoff; the messages rejected permanently, or after all the retries, are dropped.
+func (out *WebhookOutput) post(msg DecodedMessage) {
+	delay := out.RetryDelay
+	for attempt := 0; ; attempt++ {
+		headers, err := out.headers()
+		if err == nil {
+			err = postJSON(context.Background(), out.Client, out.URL, headers, newForwardEnvelope(msg))
+		}
+		if err == nil {
+			webhookMessages.WithLabelValues(out.URL, OutputSuccess).Inc()
+			return
+		}
+		if outputResult(err) != OutputRetryable || attempt >= out.MaxRetries {
+			webhookMessages.WithLabelValues(out.URL, "failure").Inc()
+			defaultLogger.Errorf("cannot post message %s to %s after %d retries, dropping it: %v", msg.Coordinates(), out.URL, attempt, err)
+			return
+		}
+		defaultLogger.Warnf("cannot post message %s to %s, retrying in %s: %v", msg.Coordinates(), out.URL, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-out.stop:
+			if attempt > 0 { // Don't delay the shutdown for more than one retry
+				webhookMessages.WithLabelValues(out.URL, "failure").Inc()
+				return
+			}
+		}
+		delay *= 2
+	}
+}
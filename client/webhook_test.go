@@ -0,0 +1,87 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestWebhookOutput(t *testing.T) {
+	var mutex sync.Mutex
+	var offsets []int
+	attempts := 0
+	active, maxActive := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		attempts++
+		first := attempts == 1
+		if active++; active > maxActive {
+			maxActive = active
+		}
+		mutex.Unlock()
+		defer func() {
+			mutex.Lock()
+			active--
+			mutex.Unlock()
+		}()
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer s3cr3t", r.Header.Get("Authorization"))
+		if first { // Reject the first request temporarily
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+		envelope := map[string]interface{}{}
+		assert.NilError(t, json.NewDecoder(r.Body).Decode(&envelope))
+		assert.Equal(t, "Test", envelope["topic"])
+		assert.Equal(t, "syslog", envelope["parser"])
+		assert.DeepEqual(t, map[string]interface{}{"id": "0001"}, envelope["payload"])
+		mutex.Lock()
+		offsets = append(offsets, int(envelope["offset"].(float64)))
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	out := &WebhookOutput{
+		URL:         server.URL,
+		Headers:     Properties{"Authorization": "Bearer s3cr3t"},
+		Concurrency: 2,
+		RetryDelay:  10 * time.Millisecond,
+	}
+	assert.NilError(t, out.Validate())
+	for i := 0; i < 6; i++ {
+		msg := DecodedMessage{Topic: "Test", Parser: "syslog", Offset: int64(i), Payload: []byte(`{"id":"0001"}`)}
+		assert.NilError(t, out.Send(context.Background(), msg))
+	}
+	assert.NilError(t, out.Close())
+	sort.Ints(offsets)
+	assert.DeepEqual(t, []int{0, 1, 2, 3, 4, 5}, offsets)
+	assert.Equal(t, 7, attempts)
+	assert.Equal(t, 2, maxActive)
+}
+
+func TestWebhookOutputPermanentFailure(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	out := &WebhookOutput{URL: server.URL, Concurrency: 1, RetryDelay: 10 * time.Millisecond}
+	assert.NilError(t, out.Validate())
+	assert.NilError(t, out.Send(context.Background(), DecodedMessage{Payload: []byte("invalid")}))
+	assert.NilError(t, out.Close())
+	assert.Equal(t, 1, attempts)
+
+	assert.ErrorContains(t, (&WebhookOutput{}).Validate(), "required")
+}
@@ -0,0 +1,122 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package clienttest
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/rpc"
+	"github.com/agalue/onms-kafka-ipc-receiver/protobuf/sink"
+	"google.golang.org/protobuf/proto"
+)
+
+// split Splits the content into chunks of the given size, or a single chunk when the size is not positive.
+func split(content []byte, chunkSize int) [][]byte {
+	if chunkSize <= 0 || len(content) <= chunkSize {
+		return [][]byte{content}
+	}
+	var parts [][]byte
+	for start := 0; start < len(content); start += chunkSize {
+		end := start + chunkSize
+		if end > len(content) {
+			end = len(content)
+		}
+		parts = append(parts, content[start:end])
+	}
+	return parts
+}
+
+// marshal Serializes a chunk; it panics on failure, which cannot happen with valid messages.
+func marshal(m proto.Message) []byte {
+	value, err := proto.Marshal(m)
+	if err != nil {
+		panic(fmt.Sprintf("cannot encode chunk: %v", err))
+	}
+	return value
+}
+
+// SinkChunks Returns the serialized SinkMessage chunks of a message, splitting its content like OpenNMS does on the Sink API.
+// When the chunk size is not positive, the message is sent as a single chunk.
+func SinkChunks(id string, content []byte, chunkSize int) [][]byte {
+	parts := split(content, chunkSize)
+	chunks := make([][]byte, len(parts))
+	for i, part := range parts {
+		chunks[i] = marshal(&sink.SinkMessage{
+			MessageId:          id,
+			CurrentChunkNumber: int32(i),
+			TotalChunks:        int32(len(parts)),
+			Content:            part,
+		})
+	}
+	return chunks
+}
+
+// RPCChunks Returns the serialized RpcMessageProto chunks of a message for a given module, like OpenNMS does on the RPC API.
+// When the chunk size is not positive, the message is sent as a single chunk.
+func RPCChunks(id, module string, content []byte, chunkSize int) [][]byte {
+	parts := split(content, chunkSize)
+	chunks := make([][]byte, len(parts))
+	for i, part := range parts {
+		chunks[i] = marshal(&rpc.RpcMessageProto{
+			RpcId:              id,
+			ModuleId:           module,
+			CurrentChunkNumber: int32(i),
+			TotalChunks:        int32(len(parts)),
+			RpcContent:         part,
+		})
+	}
+	return chunks
+}
+
+// Shuffle Returns the chunks in a random order, which is reproducible for a given seed.
+func Shuffle(seed int64, chunks [][]byte) [][]byte {
+	shuffled := append([][]byte(nil), chunks...)
+	rand.New(rand.NewSource(seed)).Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return shuffled
+}
+
+// Reverse Returns the chunks in the reverse order.
+func Reverse(chunks [][]byte) [][]byte {
+	reversed := make([][]byte, len(chunks))
+	for i, chunk := range chunks {
+		reversed[len(chunks)-1-i] = chunk
+	}
+	return reversed
+}
+
+// Duplicate Returns the chunks, repeating the ones at the given indexes right after them, like a producer retrying a send.
+func Duplicate(chunks [][]byte, indexes ...int) [][]byte {
+	repeat := make(map[int]int)
+	for _, i := range indexes {
+		repeat[i]++
+	}
+	var duplicated [][]byte
+	for i, chunk := range chunks {
+		duplicated = append(duplicated, chunk)
+		for n := 0; n < repeat[i]; n++ {
+			duplicated = append(duplicated, chunk)
+		}
+	}
+	return duplicated
+}
+
+// Interleave Returns the chunks of multiple messages alternating between them, like concurrent producers on the same partition,
+// preserving the order of the chunks of each message.
+func Interleave(messages ...[][]byte) [][]byte {
+	var interleaved [][]byte
+	for i := 0; ; i++ {
+		added := false
+		for _, chunks := range messages {
+			if i < len(chunks) {
+				interleaved = append(interleaved, chunks[i])
+				added = true
+			}
+		}
+		if !added {
+			return interleaved
+		}
+	}
+}
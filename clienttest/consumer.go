@@ -0,0 +1,210 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+// Package clienttest provides helpers to unit test the applications embedding the client, like their action handlers,
+// middlewares and outputs, without a Kafka cluster: an in-memory consumer, the chunks of the Sink and RPC messages, and golden files.
+package clienttest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/agalue/onms-kafka-ipc-receiver/client"
+)
+
+// Record represents a Kafka record delivered by the Consumer.
+type Record struct {
+	Key       []byte            // The key of the record (optional).
+	Value     []byte            // The serialized SinkMessage or RpcMessageProto.
+	Headers   map[string]string // The Kafka headers (optional).
+	Partition int32             // The partition of the record (defaults to 0).
+	Offset    int64             // Assigned by the Consumer, sequentially within each partition.
+	Timestamp time.Time         // When the record was produced (defaults to the time it was added to the Consumer).
+}
+
+// topicLog contains the records of a topic, and the position of the subscription.
+type topicLog struct {
+	records   []Record
+	next      int
+	acked     int
+	nacked    int
+	offsets   map[int32]int64
+	exhausted bool
+	notify    chan struct{}
+}
+
+// Consumer is an in-memory replacement of the Kafka consumer, to be used as the Source of a KafkaClient.
+// The records of each topic are delivered in order, waiting for the acknowledgement of each of them; the records that are
+// negatively acknowledged, or interrupted by stopping the client, are delivered again, like with the Kafka consumer.
+// By default, it is a BoundedSource: the channel of a topic is closed once all its records were acknowledged, so Handle
+// returns after processing them, as well as the pipelines; with Follow, it waits for more records until the client is stopped.
+// Each topic supports a single subscription at a time, like a consumer group with a single member.
+// This is a concurrent safe object.
+type Consumer struct {
+	Follow bool // Wait for more records instead of closing the channels of the topics.
+
+	mutex  sync.Mutex
+	topics map[string]*topicLog
+}
+
+// NewConsumer creates an empty in-memory consumer.
+func NewConsumer() *Consumer {
+	return &Consumer{topics: make(map[string]*topicLog)}
+}
+
+// topic Returns the log of a topic, creating it when necessary; the mutex must be locked.
+func (c *Consumer) topic(name string) *topicLog {
+	if c.topics == nil {
+		c.topics = make(map[string]*topicLog)
+	}
+	log, ok := c.topics[name]
+	if !ok {
+		log = &topicLog{offsets: make(map[int32]int64), notify: make(chan struct{})}
+		c.topics[name] = log
+	}
+	return log
+}
+
+// Produce Adds records with the given values to a topic, i.e. the chunks from SinkChunks.
+func (c *Consumer) Produce(topic string, values ...[]byte) {
+	records := make([]Record, len(values))
+	for i, value := range values {
+		records[i] = Record{Value: value}
+	}
+	c.ProduceRecords(topic, records...)
+}
+
+// ProduceRecords Adds records to a topic, assigning their offsets.
+func (c *Consumer) ProduceRecords(topic string, records ...Record) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	log := c.topic(topic)
+	now := time.Now()
+	for _, rec := range records {
+		rec.Offset = log.offsets[rec.Partition]
+		log.offsets[rec.Partition]++
+		if rec.Timestamp.IsZero() {
+			rec.Timestamp = now
+		}
+		log.records = append(log.records, rec)
+	}
+	log.exhausted = false
+	close(log.notify)
+	log.notify = make(chan struct{})
+}
+
+// Subscribe Delivers the records of a topic, starting after the last acknowledged one, waiting for the acknowledgement of each of them.
+func (c *Consumer) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	out := make(chan *message.Message)
+	go func() {
+		defer close(out)
+		for {
+			c.mutex.Lock()
+			log := c.topic(topic)
+			if log.next >= len(log.records) {
+				if !c.Follow {
+					log.exhausted = true
+					c.mutex.Unlock()
+					return
+				}
+				notify := log.notify
+				c.mutex.Unlock()
+				select {
+				case <-notify:
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+			rec := log.records[log.next]
+			log.next++
+			c.mutex.Unlock()
+			result := c.deliver(ctx, out, rec)
+			c.mutex.Lock()
+			switch result {
+			case resultAcked:
+				log.acked++
+			case resultNacked:
+				log.nacked++
+				log.next--
+			default:
+				log.next--
+			}
+			c.mutex.Unlock()
+			if result == resultInterrupted {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Results of the delivery of a record
+const (
+	resultAcked = iota
+	resultNacked
+	resultInterrupted
+)
+
+// deliver Sends a record as a watermill message, with its coordinates, and waits for its acknowledgement.
+func (c *Consumer) deliver(ctx context.Context, out chan<- *message.Message, rec Record) int {
+	msg := message.NewMessage(watermill.NewUUID(), rec.Value)
+	for key, value := range rec.Headers {
+		msg.Metadata.Set(key, value)
+	}
+	msg.SetContext(client.WithRecordMetadata(msg.Context(), client.RecordMetadata{
+		Partition: rec.Partition,
+		Offset:    rec.Offset,
+		Timestamp: rec.Timestamp,
+		Key:       rec.Key,
+	}))
+	select {
+	case out <- msg:
+	case <-ctx.Done():
+		return resultInterrupted
+	}
+	select {
+	case <-msg.Acked():
+		return resultAcked
+	case <-msg.Nacked():
+		return resultNacked
+	case <-ctx.Done():
+		return resultInterrupted
+	}
+}
+
+// Exhausted Returns true when all the records of a topic were acknowledged, and the channel of its subscription was closed.
+func (c *Consumer) Exhausted(topic string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.topic(topic).exhausted
+}
+
+// Acked Returns the number of records of a topic that were acknowledged.
+func (c *Consumer) Acked(topic string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.topic(topic).acked
+}
+
+// Nacked Returns the number of times the records of a topic were negatively acknowledged.
+func (c *Consumer) Nacked(topic string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.topic(topic).nacked
+}
+
+// Pending Returns the number of records of a topic that were not acknowledged yet.
+func (c *Consumer) Pending(topic string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	log := c.topic(topic)
+	return len(log.records) - log.next
+}
+
+// Close Does nothing, as the subscriptions end when the context of the client is cancelled.
+func (c *Consumer) Close() error {
+	return nil
+}
@@ -0,0 +1,105 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package clienttest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/client"
+	"gotest.tools/v3/assert"
+)
+
+func TestConsumer(t *testing.T) {
+	consumer := NewConsumer()
+	consumer.Produce("OpenNMS.Sink.Heartbeat", Interleave(
+		Duplicate(SinkChunks("0001", []byte("Minion-1"), 3), 1),
+		SinkChunks("0002", []byte("Minion-2"), 0),
+		Reverse(SinkChunks("0003", []byte("Minion-3"), 3)),
+	)...)
+	consumer.ProduceRecords("OpenNMS.Sink.Heartbeat", Record{Key: []byte("0004"), Partition: 1, Headers: map[string]string{"tenant": "acme"}, Value: SinkChunks("0004", []byte("Minion-4"), 0)[0]})
+	assert.Equal(t, 9, consumer.Pending("OpenNMS.Sink.Heartbeat"))
+
+	var received []client.DecodedMessage
+	cli := &client.KafkaClient{Topic: "OpenNMS.Sink.Heartbeat", GroupID: "clienttest", Parser: "heartbeat", Source: consumer}
+	assert.NilError(t, cli.Initialize(context.Background()))
+	cli.Handle(func(msg client.DecodedMessage) error {
+		received = append(received, msg)
+		return nil
+	})
+	cli.Stop()
+
+	// The duplicated chunk is ignored, and the message with the chunks out of order is discarded
+	assert.Equal(t, 3, len(received))
+	assert.Equal(t, "Minion-2", string(received[0].Payload))
+	assert.Equal(t, "Minion-1", string(received[1].Payload))
+	assert.Equal(t, "Minion-4", string(received[2].Payload))
+	assert.Equal(t, "OpenNMS.Sink.Heartbeat/1@0", received[2].Coordinates())
+	assert.Equal(t, "acme", received[2].Headers["tenant"])
+	assert.Equal(t, "0004", string(received[2].Key))
+	assert.Assert(t, consumer.Exhausted("OpenNMS.Sink.Heartbeat"))
+	assert.Equal(t, 9, consumer.Acked("OpenNMS.Sink.Heartbeat"))
+	assert.Equal(t, 0, consumer.Pending("OpenNMS.Sink.Heartbeat"))
+	assert.NilError(t, consumer.Close())
+}
+
+func TestConsumerRPC(t *testing.T) {
+	consumer := NewConsumer()
+	consumer.Produce("OpenNMS.Apex.rpc-request", Interleave(
+		RPCChunks("0001", "SNMP", []byte(`{"request":1}`), 4),
+		RPCChunks("0002", "Echo", []byte(`{"request":2}`), 5),
+	)...)
+	var received []string
+	cli := &client.KafkaClient{Topic: "OpenNMS.Apex.rpc-request", GroupID: "clienttest", IPC: "rpc", Source: consumer}
+	assert.NilError(t, cli.Initialize(context.Background()))
+	cli.Handle(func(msg client.DecodedMessage) error {
+		received = append(received, string(msg.Payload))
+		return nil
+	})
+	cli.Stop()
+	assert.DeepEqual(t, []string{`{"request":2}`, `{"request":1}`}, received)
+}
+
+func TestConsumerRedelivery(t *testing.T) {
+	consumer := NewConsumer()
+	consumer.Follow = true
+	consumer.Produce("Test", []byte("first"))
+	ctx, cancel := context.WithCancel(context.Background())
+	messages, err := consumer.Subscribe(ctx, "Test")
+	assert.NilError(t, err)
+
+	msg := <-messages
+	assert.Equal(t, "first", string(msg.Payload))
+	msg.Nack()
+	msg = <-messages // Delivered again after the negative acknowledgement
+	assert.Equal(t, "first", string(msg.Payload))
+	msg.Ack()
+	assert.Equal(t, 1, consumer.Nacked("Test"))
+
+	consumer.Produce("Test", []byte("second"))
+	msg = <-messages // Waits for more records
+	assert.Equal(t, "second", string(msg.Payload))
+	cancel()
+	select {
+	case _, ok := <-messages:
+		assert.Assert(t, !ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the channel to be closed")
+	}
+	assert.Equal(t, 1, consumer.Acked("Test"))
+	assert.Equal(t, 1, consumer.Pending("Test")) // Not acknowledged before stopping, so it is delivered again
+	assert.Assert(t, !consumer.Exhausted("Test"))
+}
+
+func TestChunks(t *testing.T) {
+	chunks := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	assert.DeepEqual(t, [][]byte{[]byte("c"), []byte("b"), []byte("a")}, Reverse(chunks))
+	assert.DeepEqual(t, [][]byte{[]byte("a"), []byte("a"), []byte("b"), []byte("c"), []byte("c"), []byte("c")}, Duplicate(chunks, 0, 2, 2))
+	assert.DeepEqual(t, Shuffle(7, chunks), Shuffle(7, chunks))
+	assert.Equal(t, 3, len(Shuffle(7, chunks)))
+	assert.DeepEqual(t, [][]byte{[]byte("a"), []byte("x"), []byte("b"), []byte("c")}, Interleave(chunks, [][]byte{[]byte("x")}))
+	assert.Equal(t, 3, len(SinkChunks("0001", []byte("12345"), 2)))
+	assert.Equal(t, 1, len(SinkChunks("0001", []byte("12345"), 0)))
+	assert.Equal(t, 1, len(RPCChunks("0001", "SNMP", nil, 2)))
+}
@@ -0,0 +1,62 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package clienttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// GoldenDir is the directory with the golden files, relative to the package of the test.
+var GoldenDir = "testdata"
+
+var updateGolden = flag.Bool("update-golden", false, "update the golden files with the actual content")
+
+// normalize Indents the content when it is valid JSON, so the golden files are readable and the comparison ignores the formatting.
+func normalize(content []byte) []byte {
+	buf := &bytes.Buffer{}
+	if json.Valid(content) && json.Indent(buf, bytes.TrimSpace(content), "", "  ") == nil {
+		buf.WriteByte('\n')
+		return buf.Bytes()
+	}
+	return content
+}
+
+// AssertGolden Verifies that the content, i.e. the payload of a decoded message, matches the golden file GoldenDir/<name>.golden.
+// JSON content is compared regardless of its formatting. When the test runs with -update-golden, the file is written instead.
+func AssertGolden(t testing.TB, name string, actual []byte) {
+	t.Helper()
+	path := filepath.Join(GoldenDir, name+".golden")
+	actual = normalize(actual)
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("cannot create golden directory: %v", err)
+		}
+		if err := ioutil.WriteFile(path, actual, 0644); err != nil {
+			t.Fatalf("cannot write golden file %s: %v", path, err)
+		}
+		return
+	}
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cannot read golden file %s (run with -update-golden to create it): %v", path, err)
+	}
+	if !bytes.Equal(normalize(expected), actual) {
+		t.Errorf("content doesn't match golden file %s (run with -update-golden to update it)\nexpected:\n%s\nactual:\n%s", path, expected, actual)
+	}
+}
+
+// AssertGoldenJSON Verifies that a value, serialized as JSON, matches the golden file GoldenDir/<name>.golden.
+func AssertGoldenJSON(t testing.TB, name string, value interface{}) {
+	t.Helper()
+	actual, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("cannot encode value: %v", err)
+	}
+	AssertGolden(t, name, actual)
+}
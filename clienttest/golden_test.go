@@ -0,0 +1,30 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package clienttest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/client"
+	"gotest.tools/v3/assert"
+)
+
+func TestAssertGolden(t *testing.T) {
+	consumer := NewConsumer()
+	heartbeat := `<minion><id>minion-01</id><location>Apex</location><timestamp>2021-03-04T00:00:00.000Z</timestamp></minion>`
+	consumer.Produce("OpenNMS.Sink.Heartbeat", SinkChunks("0001", []byte(heartbeat), 16)...)
+	var received []client.DecodedMessage
+	cli := &client.KafkaClient{Topic: "OpenNMS.Sink.Heartbeat", GroupID: "clienttest-golden", Parser: "heartbeat", Source: consumer}
+	assert.NilError(t, cli.Initialize(context.Background()))
+	cli.Handle(func(msg client.DecodedMessage) error {
+		received = append(received, msg)
+		return nil
+	})
+	cli.Stop()
+	assert.Equal(t, 1, len(received))
+	AssertGolden(t, "heartbeat", received[0].Payload)
+	// The formatting of JSON content is ignored
+	AssertGolden(t, "heartbeat", []byte(`{"id":"minion-01","location":"Apex","timestamp":"2021-03-04T00:00:00.000Z"}`))
+	AssertGoldenJSON(t, "heartbeat", client.HeartbeatDTO{ID: "minion-01", Location: "Apex", Timestamp: "2021-03-04T00:00:00.000Z"})
+}
@@ -0,0 +1,95 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/client"
+)
+
+// runDiff implements the diff subcommand, which compares two capture files or two time ranges of a topic,
+// and reports the differences in the number of messages by type, source and severity.
+func runDiff(args []string) {
+	log.SetOutput(os.Stderr) // Keep the standard output for the report
+	cli := client.KafkaClient{}
+	tr := client.TopicRange{}
+	var all bool
+
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s diff [options] <before> <after>\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Each side is either a capture file, or a time range as since..until in RFC3339 format when scanning a topic.")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&cli.IPC, "ipc", "sink", "IPC API: sink, rpc")
+	fs.StringVar(&cli.Parser, "parser", "snmp", "Sink API Parser: "+client.AvailableParsers.EnumAsString())
+	fs.StringVar(&tr.Bootstrap, "bootstrap", "localhost:9092", "kafka bootstrap server (when scanning a topic)")
+	fs.StringVar(&tr.Topic, "topic", "", "kafka topic to scan instead of capture files")
+	fs.Var(&tr.Parameters, "parameter", "additional kafka consumer setting as key=value (when scanning a topic); can be repeated")
+	fs.BoolVar(&all, "all", false, "include the types, sources and severities without changes")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if tr.Topic != "" {
+		cli.Topic = tr.Topic
+	}
+	if err := cli.Prepare(); err != nil {
+		log.Fatalf("invalid settings: %v", err)
+	}
+	before, err := summarize(&cli, tr, fs.Arg(0))
+	if err != nil {
+		log.Fatalf("cannot process %s: %v", fs.Arg(0), err)
+	}
+	after, err := summarize(&cli, tr, fs.Arg(1))
+	if err != nil {
+		log.Fatalf("cannot process %s: %v", fs.Arg(1), err)
+	}
+
+	deltas := client.DiffSummaries(before, after, all)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DIMENSION\tKEY\tBEFORE\tAFTER\tDELTA")
+	changes := 0
+	for _, d := range deltas {
+		if d.Delta() != 0 {
+			changes++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%+d\n", d.Dimension, d.Key, d.Before, d.After, d.Delta())
+	}
+	w.Flush()
+	if changes > 0 {
+		os.Exit(1)
+	}
+}
+
+// summarize counts the messages from a capture file or a time range of the topic.
+func summarize(cli *client.KafkaClient, tr client.TopicRange, source string) (*client.MessageSummary, error) {
+	summary := client.NewMessageSummary()
+	decode := func(rec *client.CaptureRecord) error {
+		cli.DecodeRecord(rec, summary.Add)
+		return nil
+	}
+	if tr.Topic == "" {
+		return summary, client.ReadCaptureFile(source, decode)
+	}
+	parts := strings.SplitN(source, "..", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid time range %s; expecting since..until", source)
+	}
+	var err error
+	if tr.Since, err = parseTime(parts[0]); err != nil {
+		return nil, fmt.Errorf("invalid since: %v", err)
+	}
+	if tr.Until, err = parseTime(parts[1]); err != nil {
+		return nil, fmt.Errorf("invalid until: %v", err)
+	}
+	return summary, client.ScanTopic(tr, decode)
+}
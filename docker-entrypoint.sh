@@ -19,6 +19,11 @@ fi
 if [ ! -z "${PARSER}" ]; then
   OPTIONS+=(-parser "${PARSER}")
 fi
+if [ ! -z "${PIPELINES}" ]; then
+  for pipeline in ${PIPELINES}; do
+    OPTIONS+=(-pipeline "${pipeline}")
+  done
+fi
 
 echo "Starting onms-kafka-ipc-receiver with: ${OPTIONS[@]}"
 exec /onms-kafka-ipc-receiver ${OPTIONS[@]}
@@ -0,0 +1,105 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/client"
+)
+
+// runGrep implements the grep subcommand, which decodes the messages from capture files
+// or a range of a topic, and prints the ones matching a regular expression with their Kafka coordinates.
+func runGrep(args []string) {
+	log.SetOutput(os.Stderr) // Keep the standard output for the matches
+	cli := client.KafkaClient{}
+	tr := client.TopicRange{}
+	var since, until string
+	var ignoreCase, invert, count bool
+
+	fs := flag.NewFlagSet("grep", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s grep [options] <regexp> [capture-file...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&cli.IPC, "ipc", "sink", "IPC API: sink, rpc")
+	fs.StringVar(&cli.Parser, "parser", "snmp", "Sink API Parser: "+client.AvailableParsers.EnumAsString())
+	fs.StringVar(&tr.Bootstrap, "bootstrap", "localhost:9092", "kafka bootstrap server (when scanning a topic)")
+	fs.StringVar(&tr.Topic, "topic", "", "kafka topic to scan instead of capture files")
+	fs.Var(&tr.Parameters, "parameter", "additional kafka consumer setting as key=value (when scanning a topic); can be repeated")
+	fs.StringVar(&since, "since", "", "scan messages after this time in RFC3339 format (when scanning a topic)")
+	fs.StringVar(&until, "until", "", "scan messages before this time in RFC3339 format (when scanning a topic)")
+	fs.BoolVar(&ignoreCase, "i", false, "ignore case distinctions")
+	fs.BoolVar(&invert, "v", false, "select non-matching messages")
+	fs.BoolVar(&count, "c", false, "only print the number of matching messages")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 || (fs.NArg() < 2 && tr.Topic == "") {
+		fs.Usage()
+		os.Exit(2)
+	}
+	expression := fs.Arg(0)
+	if ignoreCase {
+		expression = "(?i)" + expression
+	}
+	re, err := regexp.Compile(expression)
+	if err != nil {
+		log.Fatalf("invalid expression: %v", err)
+	}
+	if tr.Since, err = parseTime(since); err != nil {
+		log.Fatalf("invalid since: %v", err)
+	}
+	if tr.Until, err = parseTime(until); err != nil {
+		log.Fatalf("invalid until: %v", err)
+	}
+	if err := cli.Prepare(); err != nil {
+		log.Fatalf("invalid settings: %v", err)
+	}
+
+	matches := 0
+	decode := func(rec *client.CaptureRecord) error {
+		cli.DecodeRecord(rec, func(msg client.DecodedMessage) {
+			if re.Match(msg.Payload) == invert {
+				return
+			}
+			matches++
+			if !count {
+				fmt.Printf("%s: %s\n", msg.Coordinates(), string(msg.Payload))
+			}
+		})
+		return nil
+	}
+
+	if tr.Topic != "" {
+		cli.Topic = tr.Topic
+		err = client.ScanTopic(tr, decode)
+	} else {
+		for _, file := range fs.Args()[1:] {
+			if err = client.ReadCaptureFile(file, decode); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		log.Fatalf("cannot scan messages: %v", err)
+	}
+	if count {
+		fmt.Println(matches)
+	}
+	if matches == 0 {
+		os.Exit(1)
+	}
+}
+
+// parseTime parses a time in RFC3339 format, returning the zero time when empty.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
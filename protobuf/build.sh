@@ -7,3 +7,10 @@ for module in rpc sink telemetry netflow flowdocument; do
   mkdir -p $module
   protoc --proto_path=./ --go_out=./ $module.proto
 done
+
+type protoc-gen-go-grpc >/dev/null 2>&1 || { echo >&2 "protoc-gen-go-grpc required but it's not installed; aborting."; exit 1; }
+
+for module in stream ipc; do
+  mkdir -p $module
+  protoc --proto_path=./ --go_out=./ --go-grpc_out=./ $module.proto
+done
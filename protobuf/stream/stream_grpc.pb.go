@@ -0,0 +1,130 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package stream
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// MessageStreamClient is the client API for MessageStream service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MessageStreamClient interface {
+	// Streams the decoded messages that satisfy the filter, until the client disconnects or the server stops.
+	Subscribe(ctx context.Context, in *Filter, opts ...grpc.CallOption) (MessageStream_SubscribeClient, error)
+}
+
+type messageStreamClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMessageStreamClient(cc grpc.ClientConnInterface) MessageStreamClient {
+	return &messageStreamClient{cc}
+}
+
+func (c *messageStreamClient) Subscribe(ctx context.Context, in *Filter, opts ...grpc.CallOption) (MessageStream_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &MessageStream_ServiceDesc.Streams[0], "/stream.MessageStream/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &messageStreamSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type MessageStream_SubscribeClient interface {
+	Recv() (*Message, error)
+	grpc.ClientStream
+}
+
+type messageStreamSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *messageStreamSubscribeClient) Recv() (*Message, error) {
+	m := new(Message)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// MessageStreamServer is the server API for MessageStream service.
+// All implementations must embed UnimplementedMessageStreamServer
+// for forward compatibility
+type MessageStreamServer interface {
+	// Streams the decoded messages that satisfy the filter, until the client disconnects or the server stops.
+	Subscribe(*Filter, MessageStream_SubscribeServer) error
+	mustEmbedUnimplementedMessageStreamServer()
+}
+
+// UnimplementedMessageStreamServer must be embedded to have forward compatible implementations.
+type UnimplementedMessageStreamServer struct {
+}
+
+func (UnimplementedMessageStreamServer) Subscribe(*Filter, MessageStream_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedMessageStreamServer) mustEmbedUnimplementedMessageStreamServer() {}
+
+// UnsafeMessageStreamServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MessageStreamServer will
+// result in compilation errors.
+type UnsafeMessageStreamServer interface {
+	mustEmbedUnimplementedMessageStreamServer()
+}
+
+func RegisterMessageStreamServer(s grpc.ServiceRegistrar, srv MessageStreamServer) {
+	s.RegisterService(&MessageStream_ServiceDesc, srv)
+}
+
+func _MessageStream_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Filter)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MessageStreamServer).Subscribe(m, &messageStreamSubscribeServer{stream})
+}
+
+type MessageStream_SubscribeServer interface {
+	Send(*Message) error
+	grpc.ServerStream
+}
+
+type messageStreamSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *messageStreamSubscribeServer) Send(m *Message) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// MessageStream_ServiceDesc is the grpc.ServiceDesc for MessageStream service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MessageStream_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "stream.MessageStream",
+	HandlerType: (*MessageStreamServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _MessageStream_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "stream.proto",
+}
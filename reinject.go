@@ -0,0 +1,82 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/client"
+)
+
+// runReinject implements the reinject subcommand, which republishes the Sink messages from capture files
+// or a range of a topic (i.e. a dead letter topic) to an OpenNMS Sink topic at a controlled rate.
+func runReinject(args []string) {
+	r := client.Reinjector{}
+	tr := client.TopicRange{}
+	var since, until string
+
+	fs := flag.NewFlagSet("reinject", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s reinject [options] [capture-file...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&r.Bootstrap, "bootstrap", "localhost:9092", "kafka bootstrap server")
+	fs.StringVar(&r.Topic, "target", "", "OpenNMS Sink topic to republish the messages to (defaults to the topic of each record)")
+	fs.IntVar(&r.Rate, "rate", 100, "maximum number of messages republished per second (0 for unlimited)")
+	fs.IntVar(&r.ChunkSize, "chunk-size", client.DefaultReinjectChunkSize, "maximum size of the content of each chunk in bytes; should match max.buffer.size on OpenNMS")
+	fs.StringVar(&tr.Topic, "topic", "", "kafka topic to read the messages from instead of capture files, i.e. a dead letter topic")
+	fs.StringVar(&since, "since", "", "read messages after this time in RFC3339 format (when reading a topic)")
+	fs.StringVar(&until, "until", "", "read messages before this time in RFC3339 format (when reading a topic)")
+	fs.Var(&r.Parameters, "parameter", "additional kafka setting as key=value; can be repeated")
+	fs.StringVar(&r.TLS.CACert, "tls-ca-cert", "", "path to the PEM file with the certificate authorities to verify the Kafka brokers (enables TLS)")
+	fs.StringVar(&r.TLS.Cert, "tls-cert", "", "path to the PEM client certificate for mutual TLS with Kafka (enables TLS)")
+	fs.StringVar(&r.TLS.Key, "tls-key", "", "path to the PEM private key of the client certificate")
+	fs.BoolVar(&r.TLS.InsecureSkipVerify, "tls-insecure-skip-verify", false, "do not verify the certificates of the Kafka brokers (enables TLS; for testing only)")
+	fs.StringVar(&r.SASL.Mechanism, "sasl-mechanism", envOr("KAFKA_SASL_MECHANISM", ""), "SASL mechanism: PLAIN, SCRAM-SHA-256, SCRAM-SHA-512 or GSSAPI (env KAFKA_SASL_MECHANISM)")
+	fs.StringVar(&r.SASL.Username, "sasl-username", envOr("KAFKA_SASL_USERNAME", ""), "SASL user name, or the Kerberos principal as user@REALM for GSSAPI (env KAFKA_SASL_USERNAME)")
+	fs.StringVar(&r.SASL.Password, "sasl-password", envOr("KAFKA_SASL_PASSWORD", ""), "SASL password; accepts secret references (env KAFKA_SASL_PASSWORD)")
+	fs.StringVar(&r.SASL.Keytab, "sasl-keytab", envOr("KAFKA_SASL_KEYTAB", ""), "path to the Kerberos keytab for GSSAPI (env KAFKA_SASL_KEYTAB)")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 && tr.Topic == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if tr.Topic != "" && r.Topic == "" {
+		log.Fatal("the target topic is required when reading a topic")
+	}
+	var err error
+	if tr.Since, err = parseTime(since); err != nil {
+		log.Fatalf("invalid since: %v", err)
+	}
+	if tr.Until, err = parseTime(until); err != nil {
+		log.Fatalf("invalid until: %v", err)
+	}
+	if err := r.Open(); err != nil {
+		log.Fatalf("invalid settings: %v", err)
+	}
+	defer r.Close()
+
+	if tr.Topic != "" {
+		tr.Bootstrap, tr.Parameters, tr.TLS, tr.SASL = r.Bootstrap, r.Parameters, r.TLS, r.SASL
+		err = client.ScanTopic(tr, r.Add)
+	} else {
+		for _, file := range fs.Args() {
+			if err = client.ReadCaptureFile(file, r.Add); err != nil {
+				break
+			}
+		}
+	}
+	messages, chunks := r.Reinjected()
+	log.Printf("republished %d messages with %d chunks", messages, chunks)
+	if pending := r.Pending(); pending > 0 {
+		log.Printf("ignored %d incomplete messages", pending)
+	}
+	if err != nil {
+		r.Close()
+		log.Fatalf("cannot republish messages: %v", err)
+	}
+}
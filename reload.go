@@ -0,0 +1,248 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/client"
+)
+
+// reloadableSettings contains the keys of the configuration file applied without restarting the consumers.
+var reloadableSettings = map[string]bool{
+	"log-level":          true,
+	"header-filter":      true,
+	"filter-rules":       true,
+	"route":              true,
+	"max-message-rate":   true,
+	"max-byte-rate":      true,
+	"sample-rate":        true,
+	"sample-parser-rate": true,
+	"max-partition-rate": true,
+}
+
+// configReloader applies the changes of the configuration file to the running pipelines on SIGHUP, or when the file is modified.
+// The flags passed on the command line take precedence, so their settings are never reloaded;
+// the reloadable settings removed from the file revert to the default value of their flag.
+type configReloader struct {
+	path      string
+	fs        *flag.FlagSet
+	explicit  map[string]bool // The flags passed on the command line.
+	logger    *client.StdLogger
+	sampler   *client.Sampler
+	pipelines []*client.Pipeline
+
+	values  client.ConfigValues // The settings applied last.
+	modTime time.Time
+}
+
+// newConfigReloader creates a reloader for the settings already applied from a configuration file.
+func newConfigReloader(path string, fs *flag.FlagSet, explicit map[string]bool, logger *client.StdLogger, sampler *client.Sampler, pipelines []*client.Pipeline) *configReloader {
+	r := &configReloader{path: path, fs: fs, explicit: explicit, logger: logger, sampler: sampler, pipelines: pipelines}
+	if info, err := os.Stat(path); err == nil {
+		r.modTime = info.ModTime()
+	}
+	r.values, _ = client.ReadConfigFile(path)
+	return r
+}
+
+// explicitFlags Returns the names of the flags set on the command line; it must be called before applying the configuration file.
+func explicitFlags(fs *flag.FlagSet) map[string]bool {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	return explicit
+}
+
+// run Reloads the configuration on SIGHUP, and when its modification time changes (checked on each interval, 0 to disable), until the context is done.
+func (r *configReloader) run(ctx context.Context, interval time.Duration) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			r.logger.Infof("reloading configuration file %s", r.path)
+		case <-tick:
+			info, err := os.Stat(r.path)
+			if err != nil || info.ModTime().Equal(r.modTime) {
+				continue
+			}
+			r.modTime = info.ModTime()
+			r.logger.Infof("configuration file %s changed, reloading it", r.path)
+		}
+		if err := r.reload(); err != nil {
+			r.logger.Errorf("cannot reload configuration file %s: %v", r.path, err)
+		}
+	}
+}
+
+// reload Reads the configuration file and applies the reloadable settings to the logger, the sampler and all the pipelines.
+// Nothing is applied when any of the settings is invalid.
+func (r *configReloader) reload() error {
+	values, err := client.ReadConfigFile(r.path)
+	if err != nil {
+		return err
+	}
+	for key := range values {
+		if r.fs.Lookup(key) == nil {
+			return fmt.Errorf("unknown setting %s", key)
+		}
+	}
+	for _, key := range r.changedSettings(values) {
+		if !reloadableSettings[key] && !r.explicit[key] {
+			r.logger.Warnf("setting %s changed, restart to apply it", key)
+		}
+	}
+
+	level, err := client.ParseLogLevel(r.lastItem(values, "log-level", r.logger.Level.String()))
+	if err != nil {
+		return err
+	}
+	sampling := r.sampler.Settings()
+	if s := r.lastItem(values, "sample-rate", ""); s != "" {
+		if sampling.Rate, err = strconv.ParseFloat(s, 64); err != nil {
+			return fmt.Errorf("invalid setting sample-rate: %v", err)
+		}
+	}
+	if items, ok := r.items(values, "sample-parser-rate"); ok {
+		sampling.Parsers = nil
+		for _, item := range items {
+			if err := sampling.Parsers.Set(item); err != nil {
+				return fmt.Errorf("invalid setting sample-parser-rate: %v", err)
+			}
+		}
+	}
+	if s := r.lastItem(values, "max-partition-rate", ""); s != "" {
+		if sampling.MaxPartitionRate, err = strconv.Atoi(s); err != nil {
+			return fmt.Errorf("invalid setting max-partition-rate: %v", err)
+		}
+	}
+	if err := sampling.Validate(); err != nil {
+		return fmt.Errorf("invalid sampling settings: %v", err)
+	}
+	settings := make([]client.RuntimeSettings, len(r.pipelines))
+	for i, p := range r.pipelines {
+		if settings[i], err = r.runtimeSettings(values, p.Client.RuntimeSettings()); err != nil {
+			return err
+		}
+	}
+
+	r.logger.SetLevel(level)
+	if !reflect.DeepEqual(sampling, r.sampler.Settings()) {
+		r.sampler.Update(sampling)
+	}
+	for i, p := range r.pipelines {
+		if err := p.Client.Reconfigure(settings[i]); err != nil {
+			return fmt.Errorf("cannot reconfigure pipeline %s: %v", p.Name, err)
+		}
+	}
+	r.values = values
+	return nil
+}
+
+// runtimeSettings Returns the runtime settings of a client updated with the reloadable settings of the configuration file.
+func (r *configReloader) runtimeSettings(values client.ConfigValues, settings client.RuntimeSettings) (client.RuntimeSettings, error) {
+	var err error
+	if items, ok := r.items(values, "header-filter"); ok {
+		settings.HeaderFilter = nil
+		for _, item := range items {
+			if err := settings.HeaderFilter.Set(item); err != nil {
+				return settings, fmt.Errorf("invalid setting header-filter: %v", err)
+			}
+		}
+	}
+	if items, ok := r.items(values, "route"); ok {
+		settings.OutputRoutes = nil
+		for _, item := range items {
+			if err := settings.OutputRoutes.Set(item); err != nil {
+				return settings, fmt.Errorf("invalid setting route: %v", err)
+			}
+		}
+	}
+	if items, ok := r.items(values, "filter-rules"); ok {
+		settings.Filter = nil
+		if path := lastOf(items); path != "" {
+			if settings.Filter, err = client.LoadFilterRules(path); err != nil {
+				return settings, fmt.Errorf("invalid filter rules: %v", err)
+			}
+		}
+	}
+	if s := r.lastItem(values, "max-message-rate", ""); s != "" {
+		if settings.MaxMessageRate, err = strconv.Atoi(s); err != nil {
+			return settings, fmt.Errorf("invalid setting max-message-rate: %v", err)
+		}
+	}
+	if s := r.lastItem(values, "max-byte-rate", ""); s != "" {
+		if settings.MaxByteRate, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return settings, fmt.Errorf("invalid setting max-byte-rate: %v", err)
+		}
+	}
+	return settings, nil
+}
+
+// items Returns the values of a reloadable setting from the file, or the default value of its flag when it is missing.
+// It returns false when the flag was passed on the command line, so the current value must be kept.
+func (r *configReloader) items(values client.ConfigValues, key string) ([]string, bool) {
+	if r.explicit[key] {
+		return nil, false
+	}
+	if items, ok := values[key]; ok {
+		return items, true
+	}
+	if def := r.fs.Lookup(key).DefValue; def != "" {
+		return []string{def}, true
+	}
+	return nil, true
+}
+
+// lastItem Returns the effective value of a scalar reloadable setting, or the current value when the flag was passed on the command line.
+func (r *configReloader) lastItem(values client.ConfigValues, key, current string) string {
+	if items, ok := r.items(values, key); ok {
+		return lastOf(items)
+	}
+	return current
+}
+
+// changedSettings Returns the keys whose values differ from the ones applied last.
+func (r *configReloader) changedSettings(values client.ConfigValues) []string {
+	var keys []string
+	for key, items := range values {
+		if !reflect.DeepEqual(items, r.values[key]) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range r.values {
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// lastOf Returns the last item of a list, as a scalar flag set several times keeps the last value, or an empty string.
+func lastOf(items []string) string {
+	if len(items) == 0 {
+		return ""
+	}
+	return items[len(items)-1]
+}
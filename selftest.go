@@ -0,0 +1,40 @@
+// @author Alejandro Galue <agalue@opennms.org>
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/agalue/onms-kafka-ipc-receiver/client"
+)
+
+// runSelfTest implements the selftest subcommand, a one-shot smoke test against a live cluster
+// that verifies the reassembly and decoding of a synthetic multi-part message through a temporary topic.
+func runSelfTest(args []string) {
+	st := client.SelfTest{}
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s selftest [options]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&st.Bootstrap, "bootstrap", "localhost:9092", "kafka bootstrap server")
+	fs.Var(&st.Parameters, "parameter", "additional kafka setting as key=value; can be repeated")
+	fs.StringVar(&st.TLS.CACert, "tls-ca-cert", "", "path to the PEM file with the certificate authorities to verify the Kafka brokers (enables TLS)")
+	fs.StringVar(&st.TLS.Cert, "tls-cert", "", "path to the PEM client certificate for mutual TLS with Kafka (enables TLS)")
+	fs.StringVar(&st.TLS.Key, "tls-key", "", "path to the PEM private key of the client certificate")
+	fs.BoolVar(&st.TLS.InsecureSkipVerify, "tls-insecure-skip-verify", false, "do not verify the certificates of the Kafka brokers (enables TLS; for testing only)")
+	fs.StringVar(&st.SASL.Mechanism, "sasl-mechanism", envOr("KAFKA_SASL_MECHANISM", ""), "SASL mechanism: PLAIN, SCRAM-SHA-256, SCRAM-SHA-512 or GSSAPI (env KAFKA_SASL_MECHANISM)")
+	fs.StringVar(&st.SASL.Username, "sasl-username", envOr("KAFKA_SASL_USERNAME", ""), "SASL user name, or the Kerberos principal as user@REALM for GSSAPI (env KAFKA_SASL_USERNAME)")
+	fs.StringVar(&st.SASL.Password, "sasl-password", envOr("KAFKA_SASL_PASSWORD", ""), "SASL password; accepts secret references (env KAFKA_SASL_PASSWORD)")
+	fs.StringVar(&st.SASL.Keytab, "sasl-keytab", envOr("KAFKA_SASL_KEYTAB", ""), "path to the Kerberos keytab for GSSAPI (env KAFKA_SASL_KEYTAB)")
+	fs.IntVar(&st.Chunks, "chunks", 3, "number of chunks of the synthetic message")
+	fs.Parse(args)
+
+	if err := st.Run(); err != nil {
+		log.Fatalf("self-test failed: %v", err)
+	}
+	log.Println("self-test passed")
+}